@@ -0,0 +1,62 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command policydrift compares a security configuration snapshot with a
+// baseline, as written by policydrift.Snapshot.WriteTo, and exits with a
+// non-zero status if they differ.
+//
+// Usage:
+//
+//	policydrift baseline.snapshot current.snapshot
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/google/go-safeweb/safehttp/plugins/policydrift"
+)
+
+func main() {
+	if len(os.Args) != 3 {
+		fmt.Fprintln(os.Stderr, "usage: policydrift baseline current")
+		os.Exit(2)
+	}
+	if err := run(os.Args[1], os.Args[2]); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		if errors.Is(err, policydrift.ErrDrift) {
+			os.Exit(1)
+		}
+		os.Exit(2)
+	}
+}
+
+func run(baselinePath, currentPath string) error {
+	f, err := os.Open(currentPath)
+	if err != nil {
+		return err
+	}
+	current, err := policydrift.Parse(f)
+	f.Close()
+	if err != nil {
+		return fmt.Errorf("%s: %v", currentPath, err)
+	}
+	b, err := os.Open(baselinePath)
+	if err != nil {
+		return err
+	}
+	defer b.Close()
+	return policydrift.Check(b, current)
+}
@@ -0,0 +1,178 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package autotls serves a safehttp.Server over HTTPS with certificates
+// obtained and renewed automatically through ACME, e.g. from Let's Encrypt.
+//
+// Along with the HTTPS server, a plaintext HTTP server answers the HTTP-01
+// challenges of the certificate authority and redirects everything else to
+// HTTPS.
+//
+// # Usage
+//
+//	err := autotls.ListenAndServe(&safehttp.Server{Mux: mux}, autotls.Options{
+//		Hosts:    []string{"example.com", "www.example.com"},
+//		Email:    "admin@example.com",
+//		CacheDir: "/var/cache/example/certs",
+//	})
+package autotls
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"net/http"
+
+	"github.com/google/go-safeweb/safehttp"
+	"github.com/google/go-safeweb/safehttp/restricted"
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// challengePrefix is the path prefix of HTTP-01 challenges.
+const challengePrefix = "/.well-known/acme-challenge/"
+
+// Options configures a Manager.
+type Options struct {
+	// Hosts are the host names to obtain certificates for. Requests for
+	// other hosts are rejected. Hosts are required.
+	Hosts []string
+	// Email is the contact address of the ACME account, used by the
+	// certificate authority to notify about problems with the certificates.
+	Email string
+	// CacheDir is the directory storing the account key and the
+	// certificates, so that they survive restarts without hitting the rate
+	// limits of the certificate authority. CacheDir is required.
+	CacheDir string
+	// DirectoryURL is the ACME directory of the certificate authority. If
+	// empty, Let's Encrypt is used.
+	DirectoryURL string
+	// HTTPAddr is the address of the plaintext HTTP server used by
+	// ListenAndServe. If empty, ":http" (port 80) is used.
+	HTTPAddr string
+}
+
+// Manager obtains and renews certificates.
+type Manager struct {
+	m     *autocert.Manager
+	hosts []string
+	// challenges serves HTTP-01 challenges.
+	challenges http.Handler
+	httpAddr   string
+}
+
+// New creates a Manager. The terms of service of the certificate authority
+// are accepted on behalf of the caller.
+func New(opts Options) (*Manager, error) {
+	if len(opts.Hosts) == 0 {
+		return nil, errors.New("autotls: no hosts configured")
+	}
+	if opts.CacheDir == "" {
+		return nil, errors.New("autotls: no cache directory configured")
+	}
+	m := &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		HostPolicy: autocert.HostWhitelist(opts.Hosts...),
+		Cache:      autocert.DirCache(opts.CacheDir),
+		Email:      opts.Email,
+	}
+	if opts.DirectoryURL != "" {
+		m.Client = &acme.Client{DirectoryURL: opts.DirectoryURL}
+	}
+	if opts.HTTPAddr == "" {
+		opts.HTTPAddr = ":http"
+	}
+	return &Manager{
+		m:     m,
+		hosts: append([]string(nil), opts.Hosts...),
+		// Calling HTTPHandler enables HTTP-01 challenges. The redirects it
+		// does for other requests are never used.
+		challenges: m.HTTPHandler(nil),
+		httpAddr:   opts.HTTPAddr,
+	}, nil
+}
+
+// TLSConfig returns a hardened TLS configuration, as built by
+// safehttp.ServerTLSConfig, using the certificates of the Manager. It also
+// answers TLS-ALPN-01 challenges.
+func (m *Manager) TLSConfig() *tls.Config {
+	cfg := safehttp.NewServerTLSConfig().Config()
+	cfg.GetCertificate = m.m.GetCertificate
+	cfg.NextProtos = append(cfg.NextProtos, acme.ALPNProto)
+	return cfg
+}
+
+// HTTPMux returns the ServeMux of the plaintext HTTP server: it answers the
+// HTTP-01 challenges and redirects the other requests for the configured
+// hosts to HTTPS, see safehttp.HTTPSRedirectMux.
+func (m *Manager) HTTPMux() *safehttp.ServeMux {
+	mux := safehttp.HTTPSRedirectMux(m.hosts...)
+	mux.Handle(challengePrefix, safehttp.MethodGet, safehttp.HandlerFunc(m.serveChallenge))
+	mux.Handle(challengePrefix, safehttp.MethodHead, safehttp.HandlerFunc(m.serveChallenge))
+	return mux
+}
+
+func (m *Manager) serveChallenge(w safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+	rec := &tokenRecorder{header: http.Header{}, code: http.StatusOK}
+	m.challenges.ServeHTTP(rec, restricted.RawRequest(r))
+	if rec.code != http.StatusOK {
+		return w.WriteError(safehttp.StatusNotFound)
+	}
+	token := rec.body.Bytes()
+	return w.Write(safehttp.StreamingResponse{
+		ContentType: "text/plain; charset=utf-8",
+		Stream: func(sw *safehttp.StreamWriter) error {
+			_, err := sw.Write(token)
+			return err
+		},
+	})
+}
+
+// tokenRecorder records the response of the autocert challenge handler.
+type tokenRecorder struct {
+	header http.Header
+	code   int
+	body   bytes.Buffer
+}
+
+func (r *tokenRecorder) Header() http.Header         { return r.header }
+func (r *tokenRecorder) WriteHeader(code int)        { r.code = code }
+func (r *tokenRecorder) Write(b []byte) (int, error) { return r.body.Write(b) }
+
+// ListenAndServe serves s over HTTPS, on s.Addr or ":https" if empty, with
+// certificates obtained through ACME, along with the plaintext HTTP server
+// returned by Manager.HTTPMux. The TLSConfig of s is replaced.
+//
+// ListenAndServe returns when either server fails, after closing the other
+// one.
+func ListenAndServe(s *safehttp.Server, opts Options) error {
+	m, err := New(opts)
+	if err != nil {
+		return err
+	}
+	if s.Addr == "" {
+		s.Addr = ":https"
+	}
+	s.TLSConfig = m.TLSConfig()
+	plain := &safehttp.Server{Addr: m.httpAddr, Mux: m.HTTPMux()}
+
+	errc := make(chan error, 2)
+	go func() { errc <- plain.ListenAndServe() }()
+	go func() { errc <- s.ListenAndServeTLS("", "") }()
+	err = <-errc
+	// Closing fails for the server that didn't start.
+	plain.Close()
+	s.Close()
+	return err
+}
@@ -0,0 +1,116 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package autotls_test
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-safeweb/safehttp/autotls"
+	"golang.org/x/crypto/acme"
+)
+
+func newManager(t *testing.T) *autotls.Manager {
+	t.Helper()
+	m, err := autotls.New(autotls.Options{Hosts: []string{"example.com"}, CacheDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("autotls.New: %v", err)
+	}
+	return m
+}
+
+func TestNewInvalid(t *testing.T) {
+	if _, err := autotls.New(autotls.Options{CacheDir: t.TempDir()}); err == nil {
+		t.Error("autotls.New without hosts: got nil error")
+	}
+	if _, err := autotls.New(autotls.Options{Hosts: []string{"example.com"}}); err == nil {
+		t.Error("autotls.New without cache directory: got nil error")
+	}
+}
+
+func TestTLSConfig(t *testing.T) {
+	cfg := newManager(t).TLSConfig()
+	if cfg.MinVersion < tls.VersionTLS12 {
+		t.Errorf("MinVersion: got %#x, want at least TLS 1.2", cfg.MinVersion)
+	}
+	if cfg.GetCertificate == nil {
+		t.Error("GetCertificate: got nil")
+	}
+	found := false
+	for _, p := range cfg.NextProtos {
+		found = found || p == acme.ALPNProto
+	}
+	if !found {
+		t.Errorf("NextProtos: got %v, want %q", cfg.NextProtos, acme.ALPNProto)
+	}
+}
+
+func TestHTTPMux(t *testing.T) {
+	tests := []struct {
+		name         string
+		method       string
+		target       string
+		wantCode     int
+		wantLocation string
+	}{
+		{
+			name:         "Redirect",
+			method:       http.MethodGet,
+			target:       "http://example.com/path?q=1",
+			wantCode:     http.StatusMovedPermanently,
+			wantLocation: "https://example.com/path?q=1",
+		},
+		{
+			name:         "Redirect with port",
+			method:       http.MethodHead,
+			target:       "http://example.com:80/",
+			wantCode:     http.StatusMovedPermanently,
+			wantLocation: "https://example.com/",
+		},
+		{
+			name:     "Unknown host",
+			method:   http.MethodGet,
+			target:   "http://evil.com/",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Unknown challenge",
+			method:   http.MethodGet,
+			target:   "http://example.com/.well-known/acme-challenge/token",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Unsafe method",
+			method:   http.MethodPost,
+			target:   "http://example.com/",
+			wantCode: http.StatusMethodNotAllowed,
+		},
+	}
+	mux := newManager(t).HTTPMux()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rw := httptest.NewRecorder()
+			mux.ServeHTTP(rw, httptest.NewRequest(tt.method, tt.target, nil))
+			if rw.Code != tt.wantCode {
+				t.Errorf("rw.Code: got %v, want %v", rw.Code, tt.wantCode)
+			}
+			if got := rw.Header().Get("Location"); got != tt.wantLocation {
+				t.Errorf("Location: got %q, want %q", got, tt.wantLocation)
+			}
+		})
+	}
+}
@@ -0,0 +1,218 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package safehttp
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// TrustedProxies configures which proxies in front of the server are trusted
+// to report the address of the client they forward requests for, see
+// IncomingRequest.ClientIP.
+//
+// The addresses are read from right to left, starting with the address of
+// the peer connected to the server: the first address which isn't of a
+// trusted proxy is the client address. Addresses set by the client itself, to
+// the left of it, are ignored, so that they can't be spoofed.
+type TrustedProxies struct {
+	// Networks are the address ranges of the trusted proxies, e.g. those of a
+	// load balancer.
+	Networks []*net.IPNet
+	// Depth is the number of proxies trusted regardless of their address,
+	// counting from the peer connected to the server. Use it when the proxies
+	// are known to be in front of the server but their addresses aren't, e.g.
+	// a single load balancer of a hosting provider.
+	Depth int
+	// Forwarded selects the Forwarded header, as specified by RFC 7239, to
+	// read the forwarded addresses from. By default, the X-Forwarded-For
+	// header is used.
+	Forwarded bool
+}
+
+// ParseTrustedNetworks parses the given CIDRs, e.g. "10.0.0.0/8", for use as
+// TrustedProxies.Networks. Single addresses are accepted too.
+func ParseTrustedNetworks(cidrs ...string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, c := range cidrs {
+		if !strings.Contains(c, "/") {
+			ip := net.ParseIP(c)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy address %q", c)
+			}
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(c)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy network: %v", err)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+// ClientIP returns the address of the client which sent r. It returns nil if
+// the address of the peer connected to the server can't be parsed, e.g. for
+// requests not received from the network.
+//
+// If the address forwarded by the last trusted proxy is missing or malformed,
+// e.g. an obfuscated identifier of the Forwarded header, the address of that
+// proxy is returned instead.
+func (p TrustedProxies) ClientIP(r *http.Request) net.IP {
+	peer := parseHostIP(r.RemoteAddr)
+	if peer == nil {
+		return nil
+	}
+	if len(p.Networks) == 0 && p.Depth == 0 {
+		return peer
+	}
+	var forwarded []string
+	if p.Forwarded {
+		forwarded = forwardedFor(r.Header.Values("Forwarded"))
+	} else {
+		forwarded = xForwardedFor(r.Header.Values("X-Forwarded-For"))
+	}
+
+	ip := peer
+	for hops := 1; p.trusted(ip, hops); hops++ {
+		if len(forwarded) == 0 {
+			break
+		}
+		next := parseHostIP(forwarded[len(forwarded)-1])
+		forwarded = forwarded[:len(forwarded)-1]
+		if next == nil {
+			break
+		}
+		ip = next
+	}
+	return ip
+}
+
+func (p TrustedProxies) trusted(ip net.IP, hops int) bool {
+	if hops <= p.Depth {
+		return true
+	}
+	for _, n := range p.Networks {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// xForwardedFor returns the addresses of the X-Forwarded-For header values,
+// from the leftmost to the rightmost.
+func xForwardedFor(values []string) []string {
+	var addrs []string
+	for _, v := range values {
+		for _, a := range strings.Split(v, ",") {
+			addrs = append(addrs, strings.TrimSpace(a))
+		}
+	}
+	return addrs
+}
+
+// forwardedFor returns the "for" parameters of the elements of the Forwarded
+// header values, from the leftmost to the rightmost. Elements without one
+// result in an empty address.
+func forwardedFor(values []string) []string {
+	var addrs []string
+	for _, v := range values {
+		for _, elem := range splitQuoted(v, ',') {
+			addr := ""
+			for _, pair := range splitQuoted(elem, ';') {
+				eq := strings.IndexByte(pair, '=')
+				if eq < 0 || !strings.EqualFold(strings.TrimSpace(pair[:eq]), "for") {
+					continue
+				}
+				addr = strings.Trim(strings.TrimSpace(pair[eq+1:]), `"`)
+			}
+			addrs = append(addrs, addr)
+		}
+	}
+	return addrs
+}
+
+// splitQuoted splits s around sep, ignoring the separators in quoted
+// strings.
+func splitQuoted(s string, sep byte) []string {
+	var (
+		parts  []string
+		quoted bool
+		start  int
+	)
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '"':
+			quoted = !quoted
+		case s[i] == '\\' && quoted:
+			i++
+		case s[i] == sep && !quoted:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// parseHostIP parses an IP address optionally followed by a port, with IPv6
+// addresses in brackets when they are, e.g. "192.0.2.1:4711" or
+// "[2001:db8::1]:4711".
+func parseHostIP(s string) net.IP {
+	if strings.HasPrefix(s, "[") {
+		end := strings.IndexByte(s, ']')
+		if end < 0 {
+			return nil
+		}
+		s = s[1:end]
+	} else if strings.Count(s, ":") == 1 {
+		s = s[:strings.IndexByte(s, ':')]
+	}
+	ip := net.ParseIP(s)
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4
+	}
+	return ip
+}
+
+type trustedProxiesCtxKey struct{}
+
+// TrustProxies configures the proxies trusted by the ServeMux to report the
+// addresses of clients, see IncomingRequest.ClientIP. By default, no proxy is
+// trusted.
+func (s *ServeMuxConfig) TrustProxies(p TrustedProxies) {
+	s.proxies = &p
+}
+
+// ClientIP returns the address of the client which sent the request, taking
+// into account the proxies trusted by the ServeMux, see TrustedProxies. If no
+// proxy is trusted, it's the address of the peer connected to the server.
+//
+// Use it instead of parsing forwarding headers, which can be set to any
+// value by clients.
+func (r *IncomingRequest) ClientIP() net.IP {
+	p, _ := r.req.Context().Value(trustedProxiesCtxKey{}).(*TrustedProxies)
+	if p == nil {
+		p = &TrustedProxies{}
+	}
+	return p.ClientIP(r.req)
+}
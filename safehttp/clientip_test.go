@@ -0,0 +1,147 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package safehttp_test
+
+import (
+	"net"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-safeweb/safehttp"
+)
+
+func mustNetworks(t *testing.T, cidrs ...string) []*net.IPNet {
+	t.Helper()
+	nets, err := safehttp.ParseTrustedNetworks(cidrs...)
+	if err != nil {
+		t.Fatalf("safehttp.ParseTrustedNetworks(%v) got err: %v", cidrs, err)
+	}
+	return nets
+}
+
+func TestTrustedProxiesClientIP(t *testing.T) {
+	lb := mustNetworks(t, "10.0.0.0/8", "2001:db8::1")
+	tests := []struct {
+		name    string
+		proxies safehttp.TrustedProxies
+		remote  string
+		header  map[string][]string
+		want    string
+	}{
+		{
+			name:   "no trusted proxies",
+			remote: "192.0.2.1:1234",
+			header: map[string][]string{"X-Forwarded-For": {"198.51.100.7"}},
+			want:   "192.0.2.1",
+		},
+		{
+			name:    "untrusted peer",
+			proxies: safehttp.TrustedProxies{Networks: lb},
+			remote:  "192.0.2.1:1234",
+			header:  map[string][]string{"X-Forwarded-For": {"198.51.100.7"}},
+			want:    "192.0.2.1",
+		},
+		{
+			name:    "trusted chain",
+			proxies: safehttp.TrustedProxies{Networks: lb},
+			remote:  "10.0.0.1:1234",
+			header:  map[string][]string{"X-Forwarded-For": {"6.6.6.6, 198.51.100.7", "10.1.1.1"}},
+			want:    "198.51.100.7",
+		},
+		{
+			name:    "depth",
+			proxies: safehttp.TrustedProxies{Depth: 1},
+			remote:  "203.0.113.9:1234",
+			header:  map[string][]string{"X-Forwarded-For": {"6.6.6.6, 198.51.100.7"}},
+			want:    "198.51.100.7",
+		},
+		{
+			name:    "missing header",
+			proxies: safehttp.TrustedProxies{Networks: lb},
+			remote:  "10.0.0.1:1234",
+			want:    "10.0.0.1",
+		},
+		{
+			name:    "malformed address",
+			proxies: safehttp.TrustedProxies{Networks: lb},
+			remote:  "10.0.0.1:1234",
+			header:  map[string][]string{"X-Forwarded-For": {"198.51.100.7, garbage"}},
+			want:    "10.0.0.1",
+		},
+		{
+			name:    "forwarded",
+			proxies: safehttp.TrustedProxies{Networks: lb, Forwarded: true},
+			remote:  "[2001:db8::1]:443",
+			header:  map[string][]string{"Forwarded": {`for=6.6.6.6, for="[2001:db8:cafe::17]:4711";proto=https`}},
+			want:    "2001:db8:cafe::17",
+		},
+		{
+			name:    "forwarded ignores X-Forwarded-For",
+			proxies: safehttp.TrustedProxies{Networks: lb, Forwarded: true},
+			remote:  "10.0.0.1:1234",
+			header: map[string][]string{
+				"Forwarded":       {`proto=https;For=198.51.100.7`},
+				"X-Forwarded-For": {"6.6.6.6"},
+			},
+			want: "198.51.100.7",
+		},
+		{
+			name:    "forwarded obfuscated",
+			proxies: safehttp.TrustedProxies{Networks: lb, Forwarded: true},
+			remote:  "10.0.0.1:1234",
+			header:  map[string][]string{"Forwarded": {"for=_hidden"}},
+			want:    "10.0.0.1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(safehttp.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remote
+			for k, v := range tt.header {
+				req.Header[k] = v
+			}
+			if got := tt.proxies.ClientIP(req); got.String() != tt.want {
+				t.Errorf("ClientIP() got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIncomingRequestClientIP(t *testing.T) {
+	mb := safehttp.NewServeMuxConfig(nil)
+	mb.TrustProxies(safehttp.TrustedProxies{Networks: mustNetworks(t, "10.0.0.0/8")})
+	mux := mb.Mux()
+	var got net.IP
+	mux.Handle("/", safehttp.MethodGet, safehttp.HandlerFunc(func(w safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+		got = r.ClientIP()
+		return w.Write(safehttp.NoContentResponse{})
+	}))
+
+	req := httptest.NewRequest(safehttp.MethodGet, "https://foo.com/", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	req.Header.Set("X-Forwarded-For", "198.51.100.7")
+	mux.ServeHTTP(httptest.NewRecorder(), req)
+	if want := "198.51.100.7"; got.String() != want {
+		t.Errorf("r.ClientIP() got %v, want %v", got, want)
+	}
+}
+
+func TestParseTrustedNetworksInvalid(t *testing.T) {
+	for _, c := range []string{"10.0.0.0/33", "not an ip"} {
+		if _, err := safehttp.ParseTrustedNetworks(c); err == nil {
+			t.Errorf("safehttp.ParseTrustedNetworks(%q) got nil err, want error", c)
+		}
+	}
+}
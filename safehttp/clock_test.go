@@ -0,0 +1,51 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package safehttp_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-safeweb/safehttp"
+	"github.com/google/go-safeweb/safehttp/safehttptest"
+)
+
+func TestSystemClock(t *testing.T) {
+	before := time.Now()
+	got := safehttp.SystemClock().Now()
+	after := time.Now()
+	if got.Before(before) || got.After(after) {
+		t.Errorf("SystemClock().Now() = %v, want between %v and %v", got, before, after)
+	}
+}
+
+func TestFakeClock(t *testing.T) {
+	start := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+	var c safehttp.Clock = safehttptest.NewFakeClock(start)
+	if got := c.Now(); !got.Equal(start) {
+		t.Errorf("c.Now() = %v, want %v", got, start)
+	}
+
+	fc := c.(*safehttptest.FakeClock)
+	fc.Advance(time.Hour)
+	if got, want := c.Now(), start.Add(time.Hour); !got.Equal(want) {
+		t.Errorf("c.Now() after Advance(time.Hour) = %v, want %v", got, want)
+	}
+
+	fc.Set(start)
+	if got := c.Now(); !got.Equal(start) {
+		t.Errorf("c.Now() after Set(start) = %v, want %v", got, start)
+	}
+}
@@ -0,0 +1,241 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package safehttp
+
+import (
+	"compress/gzip"
+	"encoding/hex"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/google/go-safeweb/safehttp/internal/randsource"
+)
+
+// defaultCompressionTypes are the media types compressed when
+// CompressionOptions.ContentTypes is empty.
+var defaultCompressionTypes = []string{
+	"application/json",
+	"application/xml",
+	"image/svg+xml",
+	"text/csv",
+	"text/html",
+	"text/plain",
+	"text/xml",
+}
+
+// maxCompressionPadding is the maximum number of random bytes added to
+// compressed responses when CompressionOptions.RandomPadding is set.
+const maxCompressionPadding = 32
+
+// CompressionOptions configures the compression of responses, see
+// ServeMuxConfig.Compress.
+type CompressionOptions struct {
+	// Level is the gzip compression level. If zero, gzip.DefaultCompression
+	// is used.
+	Level int
+	// ContentTypes are the media types of the responses to compress. If
+	// empty, HTML, plain text, CSV, JSON, XML and SVG responses are
+	// compressed.
+	ContentTypes []string
+	// Skip, if set, is called for every response and disables its
+	// compression if it returns true.
+	//
+	// Compressing a response holding a secret, e.g. an XSRF token, along with
+	// data reflected from the request allows attackers observing the length
+	// of responses to guess the secret (the BREACH attack). Responses for
+	// which DisableCompression was called, e.g. by the xsrfhtml plugin
+	// injecting XSRF tokens in templates, are never compressed. Skip must be
+	// used to exclude any other response holding secrets.
+	Skip func(r *IncomingRequest, resp Response) bool
+	// RandomPadding adds a random number of bytes, up to 32, to compressed
+	// responses, which makes BREACH attacks slower by requiring more
+	// requests to average the noise out. It doesn't prevent them.
+	RandomPadding bool
+}
+
+// compressionConfig is the parsed form of CompressionOptions.
+type compressionConfig struct {
+	level   int
+	types   map[string]bool
+	skip    func(*IncomingRequest, Response) bool
+	padding bool
+}
+
+// Compress enables the gzip compression of the responses of clients
+// accepting it.
+//
+// Compression is applied by the framework after the Commit phase, to the
+// bytes written by the Dispatcher, so it doesn't affect the safety checks of
+// the Dispatcher nor the headers set by interceptors. Responses written
+// outside of the Dispatcher, such as FileServer, WebSocket and tarpit
+// responses, are never compressed.
+func (s *ServeMuxConfig) Compress(opts CompressionOptions) {
+	if opts.Level == 0 {
+		opts.Level = gzip.DefaultCompression
+	}
+	if _, err := gzip.NewWriterLevel(nil, opts.Level); err != nil {
+		panic(err)
+	}
+	types := opts.ContentTypes
+	if len(types) == 0 {
+		types = defaultCompressionTypes
+	}
+	c := &compressionConfig{level: opts.Level, types: map[string]bool{}, skip: opts.Skip, padding: opts.RandomPadding}
+	for _, t := range types {
+		c.types[t] = true
+	}
+	s.compression = c
+}
+
+// compressingWriter returns a writer compressing the response, or rw if the
+// response shouldn't be compressed. h must be the Header wrapping the headers
+// of rw.
+func (c *compressionConfig) compressingWriter(rw http.ResponseWriter, h Header, r *IncomingRequest, resp Response) (http.ResponseWriter, func() error) {
+	switch resp.(type) {
+	case FileServerResponse, WebSocketResponse, TarpitResponse, NoContentResponse, RedirectResponse:
+		return rw, func() error { return nil }
+	}
+	if FlightValues(r.Context()).Get(noCompressionKey{}) != nil {
+		return rw, func() error { return nil }
+	}
+	if !acceptsGzip(r.Header.Get("Accept-Encoding")) || (c.skip != nil && c.skip(r, resp)) {
+		return rw, func() error { return nil }
+	}
+	// The response varies even if it ends up not being compressed.
+	h.Vary("Accept-Encoding")
+	crw := &compressingResponseWriter{rw: rw, cfg: c}
+	return crw, crw.close
+}
+
+type noCompressionKey struct{}
+
+// DisableCompression disables the compression of the response to the request,
+// whatever the CompressionOptions. Interceptors adding secrets to responses,
+// such as XSRF tokens, call it to protect them from BREACH attacks. It has to
+// be called before the response is written, e.g. in a Commit phase.
+func DisableCompression(r *IncomingRequest) {
+	FlightValues(r.Context()).Put(noCompressionKey{}, true)
+}
+
+// acceptsGzip reports whether the Accept-Encoding header value allows gzip.
+// An explicit gzip entry takes precedence over the "*" wildcard.
+func acceptsGzip(accept string) bool {
+	var gzipQ, anyQ float64
+	gzipFound, anyFound := false, false
+	for _, e := range strings.Split(accept, ",") {
+		params := strings.Split(e, ";")
+		coding := strings.ToLower(strings.TrimSpace(params[0]))
+		if coding != "gzip" && coding != "*" {
+			continue
+		}
+		q := 1.0
+		for _, p := range params[1:] {
+			p = strings.TrimSpace(p)
+			if strings.HasPrefix(p, "q=") {
+				if v, err := strconv.ParseFloat(p[2:], 64); err == nil {
+					q = v
+				}
+			}
+		}
+		if coding == "gzip" {
+			gzipQ, gzipFound = q, true
+		} else {
+			anyQ, anyFound = q, true
+		}
+	}
+	if gzipFound {
+		return gzipQ > 0
+	}
+	return anyFound && anyQ > 0
+}
+
+// compressingResponseWriter compresses the bytes written to it, once the
+// status code and the Content-Type of the response allow it.
+type compressingResponseWriter struct {
+	rw      http.ResponseWriter
+	cfg     *compressionConfig
+	decided bool
+	gz      *gzip.Writer
+}
+
+func (w *compressingResponseWriter) Header() http.Header {
+	return w.rw.Header()
+}
+
+func (w *compressingResponseWriter) WriteHeader(code int) {
+	w.decide(code)
+	w.rw.WriteHeader(code)
+}
+
+func (w *compressingResponseWriter) Write(b []byte) (int, error) {
+	w.decide(http.StatusOK)
+	if w.gz != nil {
+		return w.gz.Write(b)
+	}
+	return w.rw.Write(b)
+}
+
+// Flush sends the bytes compressed so far to the client.
+func (w *compressingResponseWriter) Flush() {
+	if w.gz != nil {
+		w.gz.Flush()
+	}
+	if f, ok := w.rw.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *compressingResponseWriter) decide(code int) {
+	if w.decided {
+		return
+	}
+	w.decided = true
+	h := w.rw.Header()
+	if code < 200 || code == http.StatusNoContent || code == http.StatusNotModified || h.Get("Content-Encoding") != "" {
+		return
+	}
+	mt, _, err := mime.ParseMediaType(h.Get("Content-Type"))
+	if err != nil || !w.cfg.types[mt] {
+		return
+	}
+	h.Set("Content-Encoding", "gzip")
+	h.Del("Content-Length")
+	// The level was validated by Compress.
+	w.gz, _ = gzip.NewWriterLevel(w.rw, w.cfg.level)
+	if w.cfg.padding {
+		w.gz.Header.Comment = randomPadding()
+	}
+}
+
+func (w *compressingResponseWriter) close() error {
+	if w.gz == nil {
+		return nil
+	}
+	return w.gz.Close()
+}
+
+// randomPadding returns a string of a random length between 0 and
+// maxCompressionPadding, to be stored in the gzip header, which isn't
+// compressed.
+func randomPadding() string {
+	var b [maxCompressionPadding/2 + 1]byte
+	if err := randsource.Read(b[:]); err != nil {
+		panic(err)
+	}
+	n := int(b[0]) % (maxCompressionPadding + 1)
+	return hex.EncodeToString(b[1:])[:n]
+}
@@ -0,0 +1,218 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package safehttp_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-safeweb/safehttp"
+	"github.com/google/go-safeweb/safehttp/random"
+	"github.com/google/safehtml"
+)
+
+func compressionMux(opts safehttp.CompressionOptions, resp safehttp.Response) *safehttp.ServeMux {
+	mc := safehttp.NewServeMuxConfig(nil)
+	mc.Compress(opts)
+	mux := mc.Mux()
+	mux.Handle("/", safehttp.MethodGet, safehttp.HandlerFunc(func(w safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+		return w.Write(resp)
+	}))
+	return mux
+}
+
+func TestCompression(t *testing.T) {
+	body := strings.Repeat("<h1>Hello World!</h1>", 10)
+	mux := compressionMux(safehttp.CompressionOptions{}, safehtml.HTMLEscaped(body))
+
+	req := httptest.NewRequest(safehttp.MethodGet, "/", nil)
+	req.Header.Set("Accept-Encoding", "deflate, gzip;q=0.5")
+	rw := httptest.NewRecorder()
+	mux.ServeHTTP(rw, req)
+
+	if got, want := rw.Header().Get("Content-Encoding"), "gzip"; got != want {
+		t.Errorf("Content-Encoding: got %q, want %q", got, want)
+	}
+	if got, want := rw.Header().Get("Vary"), "Accept-Encoding"; got != want {
+		t.Errorf("Vary: got %q, want %q", got, want)
+	}
+	if got, want := rw.Header().Get("Content-Type"), "text/html; charset=utf-8"; got != want {
+		t.Errorf("Content-Type: got %q, want %q", got, want)
+	}
+	gz, err := gzip.NewReader(rw.Body)
+	if err != nil {
+		t.Fatalf("gzip.NewReader: %v", err)
+	}
+	b, err := ioutil.ReadAll(gz)
+	if err != nil {
+		t.Fatalf("ioutil.ReadAll: %v", err)
+	}
+	if got, want := string(b), safehtml.HTMLEscaped(body).String(); got != want {
+		t.Errorf("body: got %q, want %q", got, want)
+	}
+}
+
+func TestCompressionRandomPadding(t *testing.T) {
+	mux := compressionMux(safehttp.CompressionOptions{RandomPadding: true}, safehtml.HTMLEscaped("hello"))
+
+	lengths := map[int]bool{}
+	for i := 0; i < 20; i++ {
+		req := httptest.NewRequest(safehttp.MethodGet, "/", nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		rw := httptest.NewRecorder()
+		mux.ServeHTTP(rw, req)
+
+		lengths[rw.Body.Len()] = true
+		gz, err := gzip.NewReader(rw.Body)
+		if err != nil {
+			t.Fatalf("gzip.NewReader: %v", err)
+		}
+		if b, _ := ioutil.ReadAll(gz); string(b) != "hello" {
+			t.Errorf("body: got %q, want %q", b, "hello")
+		}
+	}
+	if len(lengths) < 2 {
+		t.Errorf("response lengths: got %v, want them to vary", lengths)
+	}
+}
+
+func TestCompressionRandomPaddingSource(t *testing.T) {
+	defer random.SetSourceForTesting(bytes.NewReader(bytes.Repeat([]byte{5}, 17)))()
+	mux := compressionMux(safehttp.CompressionOptions{RandomPadding: true}, safehtml.HTMLEscaped("hello"))
+
+	req := httptest.NewRequest(safehttp.MethodGet, "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rw := httptest.NewRecorder()
+	mux.ServeHTTP(rw, req)
+
+	gz, err := gzip.NewReader(rw.Body)
+	if err != nil {
+		t.Fatalf("gzip.NewReader: %v", err)
+	}
+	if got, want := gz.Header.Comment, "05050"; got != want {
+		t.Errorf("padding: got %q, want %q", got, want)
+	}
+}
+
+func TestCompressionNotApplied(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     safehttp.CompressionOptions
+		accept   string
+		resp     safehttp.Response
+		wantVary bool
+	}{
+		{
+			name: "No Accept-Encoding",
+			resp: safehtml.HTMLEscaped("hello"),
+		},
+		{
+			name:   "Gzip not acceptable",
+			accept: "gzip;q=0, br",
+			resp:   safehtml.HTMLEscaped("hello"),
+		},
+		{
+			name:   "Gzip refused after a wildcard",
+			accept: "*;q=1, gzip;q=0",
+			resp:   safehtml.HTMLEscaped("hello"),
+		},
+		{
+			name: "Skipped",
+			opts: safehttp.CompressionOptions{
+				Skip: func(*safehttp.IncomingRequest, safehttp.Response) bool { return true },
+			},
+			accept: "gzip",
+			resp:   safehtml.HTMLEscaped("hello"),
+		},
+		{
+			name:     "Content-Type not compressed",
+			opts:     safehttp.CompressionOptions{ContentTypes: []string{"application/json"}},
+			accept:   "*",
+			resp:     safehtml.HTMLEscaped("hello"),
+			wantVary: true,
+		},
+		{
+			name:   "No content",
+			accept: "gzip",
+			resp:   safehttp.NoContentResponse{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mux := compressionMux(tt.opts, tt.resp)
+			req := httptest.NewRequest(safehttp.MethodGet, "/", nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept-Encoding", tt.accept)
+			}
+			rw := httptest.NewRecorder()
+			mux.ServeHTTP(rw, req)
+
+			if got := rw.Header().Get("Content-Encoding"); got != "" {
+				t.Errorf("Content-Encoding: got %q, want none", got)
+			}
+			if got := rw.Header().Get("Vary") != ""; got != tt.wantVary {
+				t.Errorf("Vary set: got %v, want %v", got, tt.wantVary)
+			}
+			if tt.resp != (safehttp.NoContentResponse{}) && rw.Body.String() != "hello" {
+				t.Errorf("body: got %q, want %q", rw.Body.String(), "hello")
+			}
+		})
+	}
+}
+
+func TestDisableCompression(t *testing.T) {
+	mc := safehttp.NewServeMuxConfig(nil)
+	mc.Compress(safehttp.CompressionOptions{})
+	mux := mc.Mux()
+	mux.Handle("/", safehttp.MethodGet, safehttp.HandlerFunc(func(w safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+		safehttp.DisableCompression(r)
+		return w.Write(safehtml.HTMLEscaped("hello"))
+	}))
+	req := httptest.NewRequest(safehttp.MethodGet, "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rw := httptest.NewRecorder()
+	mux.ServeHTTP(rw, req)
+
+	if got := rw.Header().Get("Content-Encoding"); got != "" {
+		t.Errorf("Content-Encoding: got %q, want none", got)
+	}
+	if got, want := rw.Body.String(), "hello"; got != want {
+		t.Errorf("body: got %q, want %q", got, want)
+	}
+}
+
+func TestCompressionConsolidatesVary(t *testing.T) {
+	mc := safehttp.NewServeMuxConfig(nil)
+	mc.Compress(safehttp.CompressionOptions{})
+	mux := mc.Mux()
+	mux.Handle("/", safehttp.MethodGet, safehttp.HandlerFunc(func(w safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+		// The handler picks the language of the page.
+		w.Header().Vary("Accept-Language")
+		return w.Write(safehtml.HTMLEscaped(strings.Repeat("Hello World!", 10)))
+	}))
+
+	req := httptest.NewRequest(safehttp.MethodGet, "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rw := httptest.NewRecorder()
+	mux.ServeHTTP(rw, req)
+
+	if got, want := rw.Header().Values("Vary"), []string{"Accept-Language, Accept-Encoding"}; len(got) != 1 || got[0] != want[0] {
+		t.Errorf("Vary: got %q, want %q", got, want)
+	}
+}
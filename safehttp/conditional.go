@@ -0,0 +1,101 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package safehttp
+
+// When returns an Interceptor running it only for the requests for which
+// appliesTo returns true, e.g. only for authenticated users or only for a
+// given host, without having to disable it with an InterceptorConfig on every
+// other handler.
+//
+// appliesTo is called once per request, before the Before phase of it, and
+// its result applies to all the phases of it. Like for other interceptors,
+// the Commit phase of it runs even if its Before phase didn't, because the
+// request processing ended before reaching it: appliesTo is called in the
+// Commit phase instead.
+//
+// The InterceptorConfigs matched by it are matched by the returned
+// Interceptor, which is a Finisher if it is.
+func When(appliesTo func(r *IncomingRequest) bool, it Interceptor) Interceptor {
+	c := &conditionalInterceptor{appliesTo: appliesTo, it: it}
+	if f, ok := it.(Finisher); ok {
+		return conditionalFinisher{conditionalInterceptor: c, f: f}
+	}
+	return c
+}
+
+// InterceptWhen installs the given interceptors, running them only for the
+// requests for which appliesTo returns true. See When and Intercept.
+func (s *ServeMuxConfig) InterceptWhen(appliesTo func(r *IncomingRequest) bool, is ...Interceptor) {
+	for _, it := range is {
+		s.Intercept(When(appliesTo, it))
+	}
+}
+
+// conditionalInterceptor is a pointer so that it can be used as the key of
+// its decision in the FlightValues of the requests.
+type conditionalInterceptor struct {
+	appliesTo func(r *IncomingRequest) bool
+	it        Interceptor
+}
+
+func (c *conditionalInterceptor) applies(r *IncomingRequest) bool {
+	fv := FlightValues(r.Context())
+	if v, ok := fv.Get(c).(bool); ok {
+		return v
+	}
+	v := c.appliesTo(r)
+	fv.Put(c, v)
+	return v
+}
+
+// Before runs the Before phase of the wrapped interceptor if it applies to
+// the request.
+func (c *conditionalInterceptor) Before(w ResponseWriter, r *IncomingRequest, cfg InterceptorConfig) Result {
+	if !c.applies(r) {
+		return NotWritten()
+	}
+	return c.it.Before(w, r, cfg)
+}
+
+// Commit runs the Commit phase of the wrapped interceptor if it applies to
+// the request.
+func (c *conditionalInterceptor) Commit(w ResponseHeadersWriter, r *IncomingRequest, resp Response, cfg InterceptorConfig) {
+	if !c.applies(r) {
+		return
+	}
+	c.it.Commit(w, r, resp, cfg)
+}
+
+// conditionalFinisher is a conditionalInterceptor wrapping a Finisher. It's a
+// separate type so that the responses of the requests without Finishers don't
+// need to be tracked.
+type conditionalFinisher struct {
+	*conditionalInterceptor
+	f Finisher
+}
+
+// Finish runs the Finish phase of the wrapped interceptor if it applies to the
+// request.
+func (c conditionalFinisher) Finish(r *IncomingRequest, s ResponseSummary, cfg InterceptorConfig) {
+	if !c.applies(r) {
+		return
+	}
+	c.f.Finish(r, s, cfg)
+}
+
+// Match matches the InterceptorConfigs of the wrapped interceptor.
+func (c *conditionalInterceptor) Match(cfg InterceptorConfig) bool {
+	return c.it.Match(cfg)
+}
@@ -0,0 +1,96 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package safehttp_test
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-safeweb/safehttp"
+)
+
+func TestInterceptWhen(t *testing.T) {
+	mb := safehttp.NewServeMuxConfig(nil)
+	mb.InterceptWhen(func(r *safehttp.IncomingRequest) bool {
+		return r.Header.Get("Authorization") != ""
+	}, setHeaderConfigInterceptor{})
+	mux := mb.Mux()
+	mux.Handle("/", safehttp.MethodGet, safehttp.HandlerFunc(func(w safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+		return w.Write(safehttp.NoContentResponse{})
+	}))
+	mux.Handle("/configured", safehttp.MethodGet, safehttp.HandlerFunc(func(w safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+		return w.Write(safehttp.NoContentResponse{})
+	}), setHeaderConfig{name: "Topping", value: "Pineapple"})
+
+	tests := []struct {
+		name       string
+		path       string
+		auth       string
+		wantHeader string
+		wantCommit string
+	}{
+		{name: "applies", path: "/", auth: "Bearer x", wantHeader: "Hawaii", wantCommit: "Hawaii"},
+		{name: "skipped", path: "/"},
+		{name: "config matched", path: "/configured", auth: "Bearer x"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(safehttp.MethodGet, "https://foo.com"+tt.path, nil)
+			if tt.auth != "" {
+				req.Header.Set("Authorization", tt.auth)
+			}
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, req)
+			if got := rr.Header().Get("Pizza"); got != tt.wantHeader {
+				t.Errorf(`Header.Get("Pizza"): got %q, want %q`, got, tt.wantHeader)
+			}
+			if got := rr.Header().Get("Commit-Pizza"); got != tt.wantCommit {
+				t.Errorf(`Header.Get("Commit-Pizza"): got %q, want %q`, got, tt.wantCommit)
+			}
+			if tt.path == "/configured" {
+				if got, want := rr.Header().Get("Topping"), "Pineapple"; got != want {
+					t.Errorf(`Header.Get("Topping"): got %q, want %q`, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestWhenCalledOnce(t *testing.T) {
+	calls := 0
+	mb := safehttp.NewServeMuxConfig(nil)
+	mb.Intercept(safehttp.When(func(*safehttp.IncomingRequest) bool {
+		calls++
+		return true
+	}, setHeaderConfigInterceptor{}))
+	mux := mb.Mux()
+	mux.Handle("/", safehttp.MethodGet, safehttp.HandlerFunc(func(w safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+		return w.Write(safehttp.NoContentResponse{})
+	}))
+	mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(safehttp.MethodGet, "https://foo.com/", nil))
+	if calls != 1 {
+		t.Errorf("appliesTo calls: got %d, want 1", calls)
+	}
+}
+
+func TestWhenFinisher(t *testing.T) {
+	always := func(*safehttp.IncomingRequest) bool { return true }
+	if _, ok := safehttp.When(always, setHeaderConfigInterceptor{}).(safehttp.Finisher); ok {
+		t.Error("When() of an Interceptor which isn't a Finisher is a Finisher")
+	}
+	if _, ok := safehttp.When(always, finishingInterceptor{}).(safehttp.Finisher); !ok {
+		t.Error("When() of a Finisher isn't a Finisher")
+	}
+}
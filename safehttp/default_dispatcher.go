@@ -16,6 +16,7 @@ package safehttp
 
 import (
 	"encoding/json"
+	"encoding/xml"
 	"fmt"
 	"io"
 	"net/http"
@@ -24,32 +25,129 @@ import (
 	"github.com/google/safehtml/template"
 )
 
+// DefaultXSSIPrefix is the prefix written before JSON responses by the
+// DefaultDispatcher when none is configured.
+const DefaultXSSIPrefix = ")]}',\n"
+
 // DefaultDispatcher is responsible for writing safe responses.
-type DefaultDispatcher struct{}
+type DefaultDispatcher struct {
+	// XSSIPrefix is written before JSON responses to break their parsing as
+	// JavaScript, preventing XSSI. Clients must strip it before parsing the
+	// JSON. If empty, DefaultXSSIPrefix is used: the prefix can be changed, but
+	// not removed. Only the vetted prefixes ")]}'", "while(1);" and "for(;;);"
+	// are accepted, optionally followed by a newline, and by a comma for the
+	// first one; JSON responses fail to be written with any other.
+	XSSIPrefix string
+	// MIMETypes holds the Content-Types StreamingResponses and
+	// FileServerResponses can be written with. If nil, the registry returned
+	// by NewMIMETypes is used.
+	MIMETypes *MIMETypes
+}
+
+// xssiPrefixes are the XSSI prefixes known to break the parsing, or the
+// execution, of what follows them as JavaScript.
+var xssiPrefixes = map[string]bool{
+	")]}'":        true,
+	")]}',":       true,
+	")]}'\n":      true,
+	")]}',\n":     true,
+	"while(1);":   true,
+	"while(1);\n": true,
+	"for(;;);":    true,
+	"for(;;);\n":  true,
+}
+
+func (d DefaultDispatcher) xssiPrefix() (string, error) {
+	if d.XSSIPrefix == "" {
+		return DefaultXSSIPrefix, nil
+	}
+	if !xssiPrefixes[d.XSSIPrefix] {
+		return "", fmt.Errorf("XSSIPrefix %q isn't a vetted XSSI prefix", d.XSSIPrefix)
+	}
+	return d.XSSIPrefix, nil
+}
+
+func (d DefaultDispatcher) mimeTypes() *MIMETypes {
+	if d.MIMETypes == nil {
+		return defaultMIMETypes
+	}
+	return d.MIMETypes
+}
 
 // Write writes the response to the http.ResponseWriter if it's deemed safe. It
 // returns a non-nil error if the response is deemed unsafe or if the writing
 // operation fails.
 //
 // For JSONResponses, the underlying object is serialised and written if it's a
-// valid JSON.
+// valid JSON, after the XSSIPrefix.
+//
+// For XMLResponses, the underlying object is serialised following the
+// encoding/xml.Marshal rules and written after the XML header.
+//
+// For NDJSONResponses, the values produced by the response are serialised and
+// written, one per line, as they are produced.
+//
+// For EventStreamResponses, the events are written as Server-Sent Events as
+// they are sent.
+//
+// For WebSocketResponses, the connection is upgraded to the WebSocket protocol
+// and handed to the response.
+//
+// For StreamingResponses, the body is written as it's produced, with a
+// Content-Type registered in the MIMETypes registry which browsers don't
+// render or execute.
+//
+// For FileServerResponses, the Content-Type chosen by the FileServer is
+// written, after being resolved through the MIMETypes registry. Files with
+// unregistered types are served as application/octet-stream.
+//
+// For MultipartResponses, the parts are written as a multipart/mixed body with
+// a boundary that doesn't occur in any of them.
+//
+// For TarpitResponses, newlines are trickled to the client until the response
+// duration elapses or the client goes away.
 //
 // For TemplateResponses, the parsed template is applied to the provided data
 // object. If the funcMap is non-nil, its elements override the  existing names
 // to functions mappings in the template. An attempt to define a new name to
 // function mapping that is not already in the template will result in a panic.
 //
-// Write sets the Content-Type accordingly.
-func (DefaultDispatcher) Write(rw http.ResponseWriter, resp Response) error {
+// Write sets the Content-Type accordingly. The Content-Types of the responses
+// for which handlers choose it are replaced by the value registered for their
+// media type. For StreamingResponses, an error wrapping
+// ErrUnregisteredContentType is returned if there is none.
+func (d DefaultDispatcher) Write(rw http.ResponseWriter, resp Response) error {
 	switch x := resp.(type) {
 	case JSONResponse:
+		prefix, err := d.xssiPrefix()
+		if err != nil {
+			return err
+		}
 		rw.Header().Set("Content-Type", "application/json; charset=utf-8")
-		io.WriteString(rw, ")]}',\n") // Break parsing of JavaScript in order to prevent XSSI.
+		io.WriteString(rw, prefix)
 		return json.NewEncoder(rw).Encode(x.Data)
+	case NDJSONResponse:
+		return writeNDJSON(rw, x)
+	case EventStreamResponse:
+		return writeEventStream(rw, x)
+	case WebSocketResponse:
+		return writeWebSocket(rw, x)
+	case StreamingResponse:
+		prefix, err := d.xssiPrefix()
+		if err != nil {
+			return err
+		}
+		return writeStreaming(rw, x, d.mimeTypes(), prefix)
+	case *MultipartResponse:
+		return writeMultipart(rw, x)
+	case XMLResponse:
+		rw.Header().Set("Content-Type", "application/xml; charset=utf-8")
+		io.WriteString(rw, xml.Header)
+		return xml.NewEncoder(rw).Encode(x.Data)
 	case *TemplateResponse:
 		t, ok := (x.Template).(*template.Template)
 		if !ok {
-			return fmt.Errorf("%T is not a safe template and it cannot be parsed and written", t)
+			return fmt.Errorf("%w: %T is not a safe template and it cannot be parsed and written", ErrUnsupportedResponseType, x.Template)
 		}
 		rw.Header().Set("Content-Type", "text/html; charset=utf-8")
 		if len(x.FuncMap) == 0 {
@@ -72,7 +170,13 @@ func (DefaultDispatcher) Write(rw http.ResponseWriter, resp Response) error {
 		_, err := io.WriteString(rw, x.String())
 		return err
 	case FileServerResponse:
-		rw.Header().Set("Content-Type", x.ContentType())
+		ct, err := d.mimeTypes().ContentType(x.ContentType())
+		if err != nil {
+			// Files are served as downloads rather than refused, so that
+			// unusual types, e.g. text/xml, keep being served.
+			ct = "application/octet-stream"
+		}
+		rw.Header().Set("Content-Type", ct)
 		// The http package will take care of writing the file body.
 		return nil
 	case RedirectResponse:
@@ -81,8 +185,10 @@ func (DefaultDispatcher) Write(rw http.ResponseWriter, resp Response) error {
 	case NoContentResponse:
 		rw.WriteHeader(int(StatusNoContent))
 		return nil
+	case TarpitResponse:
+		return writeTarpit(rw, x)
 	default:
-		return fmt.Errorf("%T is not a safe response type and it cannot be written", resp)
+		return fmt.Errorf("%w: %T is not a safe response type and it cannot be written", ErrUnsupportedResponseType, resp)
 	}
 }
 
@@ -15,11 +15,14 @@
 package safehttp_test
 
 import (
+	"encoding/xml"
+	"errors"
 	"html/template"
 	"math"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-safeweb/safehttp"
@@ -117,6 +120,31 @@ func TestDefaultDispatcherValidResponse(t *testing.T) {
 			},
 			wantBody: ")]}',\n{\"field\":\"myField\"}\n",
 		},
+		{
+			name: "JSON Response with XSSI prefix",
+			write: func(w http.ResponseWriter) error {
+				d := &safehttp.DefaultDispatcher{XSSIPrefix: "while(1);"}
+				w.Header().Set("Content-Type", "text/html")
+				return d.Write(w, safehttp.JSONResponse{[]string{"<b>"}})
+			},
+			wantBody: "while(1);[\"\\u003cb\\u003e\"]\n",
+			wantHeaders: map[string][]string{
+				"Content-Type": {"application/json; charset=utf-8"},
+			},
+		},
+		{
+			name: "Valid XML Response",
+			write: func(w http.ResponseWriter) error {
+				d := &safehttp.DefaultDispatcher{}
+				data := struct {
+					XMLName struct{} `xml:"item"`
+					Field   string   `xml:"field"`
+				}{Field: "<myField>"}
+				return d.Write(w, safehttp.XMLResponse{data})
+			},
+			wantHeaders: map[string][]string{"Content-Type": {"application/xml; charset=utf-8"}},
+			wantBody:    xml.Header + "<item><field>&lt;myField&gt;</field></item>",
+		},
 		{
 			name: "Redirect Response",
 			write: func(w http.ResponseWriter) error {
@@ -206,6 +234,22 @@ func TestDefaultDispatcherInvalidResponse(t *testing.T) {
 			},
 			want: ")]}',\n",
 		},
+		{
+			name: "JSON Response with an unvetted XSSI prefix",
+			write: func(w http.ResponseWriter) error {
+				d := &safehttp.DefaultDispatcher{XSSIPrefix: "// "}
+				return d.Write(w, safehttp.JSONResponse{[]string{"a"}})
+			},
+			want: "",
+		},
+		{
+			name: "Tarpit Response without a Request",
+			write: func(w http.ResponseWriter) error {
+				d := &safehttp.DefaultDispatcher{}
+				return d.Write(w, safehttp.TarpitResponse{Duration: time.Second})
+			},
+			want: "",
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -221,3 +265,16 @@ func TestDefaultDispatcherInvalidResponse(t *testing.T) {
 		})
 	}
 }
+
+func TestDefaultDispatcherUnsupportedResponseType(t *testing.T) {
+	d := &safehttp.DefaultDispatcher{}
+	resps := []safehttp.Response{
+		"<h1>Hello World!</h1>",
+		&safehttp.TemplateResponse{Template: template.Must(template.New("name").Parse("<h1>{{ . }}</h1>"))},
+	}
+	for _, resp := range resps {
+		if err := d.Write(httptest.NewRecorder(), resp); !errors.Is(err, safehttp.ErrUnsupportedResponseType) {
+			t.Errorf("d.Write(%T): got err %v, want %v", resp, err, safehttp.ErrUnsupportedResponseType)
+		}
+	}
+}
@@ -99,6 +99,11 @@
 // It is safe to use defer statements for cleanup tasks (e.g. closing a file
 // that was used in a safehtml/template.Template response).
 //
+// 8. [Finish phase] Interceptors implementing Finisher are passed a
+// ResponseSummary of the written response, e.g. its status code and size, in
+// the same order as the Commit phase. They can only observe the response, e.g.
+// to log it.
+//
 //  Stack trace of the flow:
 //
 //  Mux.ServeHTTP()
@@ -113,11 +118,12 @@
 //  ------+ InterceptorFoo.Commit()
 //  ------+ Dispatcher.Write()
 //  ----+ The result of the Response.Write() call is returned.
+//  --+ Finish() of the Interceptors implementing Finisher, in the Commit order.
 //
 // Error Responses
 //
 // Error responses are written using ResponseWriter.WriteError. They go through
-// the usual Commit and Dispatcher phases.
+// the usual Commit, Dispatcher and Finish phases.
 //
 // Configuring the Mux
 //
@@ -0,0 +1,52 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package safehttp
+
+import "errors"
+
+// The errors below are returned, or used as panic values, by the framework.
+// They might be wrapped with additional context, so compare against them using
+// errors.Is.
+var (
+	// ErrResponseAlreadyWritten is used when a write method of a
+	// ResponseWriter is called after a response has already been written.
+	ErrResponseAlreadyWritten = errors.New("ResponseWriter was already written to")
+
+	// ErrHeaderClaimed is used when a claimed header, or the Set-Cookie
+	// header, is modified through the methods of Header.
+	ErrHeaderClaimed = errors.New("claimed header")
+
+	// ErrCookieClaimed is used when a cookie claimed through
+	// Header.ClaimCookie is added, or claimed again, by someone other than
+	// its claimant.
+	ErrCookieClaimed = errors.New("claimed cookie")
+
+	// ErrUnsupportedResponseType is returned by the DefaultDispatcher when it
+	// doesn't know how to safely write a Response.
+	ErrUnsupportedResponseType = errors.New("unsupported response type")
+
+	// ErrUnregisteredContentType is returned by the DefaultDispatcher when a
+	// response would be written with a Content-Type that isn't in its
+	// MIMETypes registry.
+	ErrUnregisteredContentType = errors.New("unregistered Content-Type")
+
+	// ErrBodyTooLarge is returned when the body of an IncomingRequest exceeds
+	// the limit enforced while reading it.
+	ErrBodyTooLarge = errors.New("request body too large")
+
+	// ErrUploadRejected is returned when an UploadScanner rejects an uploaded
+	// file.
+	ErrUploadRejected = errors.New("uploaded file rejected")
+)
@@ -0,0 +1,97 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package safehttp
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// EventStreamResponse streams Server-Sent Events to the client, with the
+// text/event-stream Content-Type.
+//
+// The response headers, including those set by the Commit phase of the
+// interceptors, are sent once, before Stream is called.
+type EventStreamResponse struct {
+	// Request is the request the response is written for. Sending fails once
+	// its context is done, e.g. because the client went away.
+	Request *IncomingRequest
+	// Stream sends the events of the response. Stream should return when
+	// the context of the stream is done or sending fails, with the error of
+	// the latter.
+	Stream func(s *EventStream) error
+}
+
+// EventStream sends Server-Sent Events.
+type EventStream struct {
+	ctx     context.Context
+	rw      http.ResponseWriter
+	flusher http.Flusher
+}
+
+// Context returns the context of the request the events are sent for.
+func (s *EventStream) Context() context.Context {
+	return s.ctx
+}
+
+// Send sends an event to the client and flushes it. If event is empty, the
+// client dispatches it as a "message" event. Multiline data is sent as
+// multiple data fields, which the client joins back.
+func (s *EventStream) Send(event, data string) error {
+	if err := s.ctx.Err(); err != nil {
+		return err
+	}
+	if strings.ContainsAny(event, "\r\n") {
+		return errors.New("event names can't contain newlines")
+	}
+	var b strings.Builder
+	if event != "" {
+		b.WriteString("event: ")
+		b.WriteString(event)
+		b.WriteByte('\n')
+	}
+	data = strings.ReplaceAll(data, "\r\n", "\n")
+	for _, line := range strings.Split(strings.ReplaceAll(data, "\r", "\n"), "\n") {
+		b.WriteString("data: ")
+		b.WriteString(line)
+		b.WriteByte('\n')
+	}
+	b.WriteByte('\n')
+	if _, err := s.rw.Write([]byte(b.String())); err != nil {
+		return err
+	}
+	if s.flusher != nil {
+		s.flusher.Flush()
+	}
+	return nil
+}
+
+func writeEventStream(rw http.ResponseWriter, resp EventStreamResponse) error {
+	h := rw.Header()
+	h.Set("Content-Type", "text/event-stream")
+	h.Set("Cache-Control", "no-cache")
+	rw.WriteHeader(int(StatusOK))
+	flusher, _ := rw.(http.Flusher)
+	if flusher != nil {
+		flusher.Flush()
+	}
+	s := &EventStream{ctx: resp.Request.Context(), rw: rw, flusher: flusher}
+	if err := resp.Stream(s); err != nil && !errors.Is(err, context.Canceled) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package safehttp_test
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-safeweb/safehttp"
+)
+
+func TestEventStreamResponse(t *testing.T) {
+	mb := safehttp.NewServeMuxConfig(nil)
+	mb.Intercept(committerInterceptor{})
+	mux := mb.Mux()
+	mux.Handle("/", safehttp.MethodGet, safehttp.HandlerFunc(func(w safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+		return w.Write(safehttp.EventStreamResponse{
+			Request: r,
+			Stream: func(s *safehttp.EventStream) error {
+				if err := s.Send("", "hello"); err != nil {
+					return err
+				}
+				return s.Send("update", "line1\nline2")
+			},
+		})
+	}))
+
+	rw := httptest.NewRecorder()
+	mux.ServeHTTP(rw, httptest.NewRequest("GET", "https://foo.com/", nil))
+
+	wantHeaders := map[string][]string{
+		"Content-Type":  {"text/event-stream"},
+		"Cache-Control": {"no-cache"},
+		"Foo":           {"bar"},
+	}
+	if diff := cmp.Diff(wantHeaders, map[string][]string(rw.Header())); diff != "" {
+		t.Errorf("rw.Header() mismatch (-want +got):\n%s", diff)
+	}
+	want := "data: hello\n\nevent: update\ndata: line1\ndata: line2\n\n"
+	if got := rw.Body.String(); got != want {
+		t.Errorf("body: got %q, want %q", got, want)
+	}
+	if !rw.Flushed {
+		t.Error("rw.Flushed = false, want true")
+	}
+}
+
+func TestEventStreamResponseCanceled(t *testing.T) {
+	mux := safehttp.NewServeMuxConfig(nil).Mux()
+	var sendErr error
+	mux.Handle("/", safehttp.MethodGet, safehttp.HandlerFunc(func(w safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+		return w.Write(safehttp.EventStreamResponse{
+			Request: r,
+			Stream: func(s *safehttp.EventStream) error {
+				<-s.Context().Done()
+				sendErr = s.Send("", "too late")
+				return sendErr
+			},
+		})
+	}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	rw := httptest.NewRecorder()
+	mux.ServeHTTP(rw, httptest.NewRequest("GET", "https://foo.com/", nil).WithContext(ctx))
+
+	if !errors.Is(sendErr, context.Canceled) {
+		t.Errorf("Send() got err: %v, want %v", sendErr, context.Canceled)
+	}
+	if got := rw.Body.String(); got != "" {
+		t.Errorf("body: got %q, want empty", got)
+	}
+}
+
+func TestEventStreamInvalidEvent(t *testing.T) {
+	req := httptest.NewRequest("GET", "https://foo.com/", nil)
+	var sendErr error
+	resp := safehttp.EventStreamResponse{
+		Request: safehttp.NewIncomingRequest(req),
+		Stream: func(s *safehttp.EventStream) error {
+			sendErr = s.Send("a\ndata: injected", "x")
+			return nil
+		},
+	}
+	rw := httptest.NewRecorder()
+	if err := (safehttp.DefaultDispatcher{}).Write(rw, resp); err != nil {
+		t.Fatalf("Write() got err: %v", err)
+	}
+	if sendErr == nil {
+		t.Error("Send() with a newline in the event name got nil err, want error")
+	}
+	if got := rw.Body.String(); got != "" {
+		t.Errorf("body: got %q, want empty", got)
+	}
+}
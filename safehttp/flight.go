@@ -16,6 +16,8 @@ package safehttp
 
 import (
 	"context"
+	"fmt"
+	"log"
 	"net/http"
 )
 
@@ -30,6 +32,8 @@ type flight struct {
 	header Header
 
 	written bool
+	// committed reports whether the Commit phases ran.
+	committed bool
 }
 
 // handlerConfig is the safe HTTP handler configuration, including the
@@ -38,9 +42,17 @@ type handlerConfig struct {
 	Handler      Handler
 	Dispatcher   Dispatcher
 	Interceptors []configuredInterceptor
+	NotWritten   notWrittenConfig
+	DoubleWrite  doubleWriteConfig
+	Leaks        func(*IncomingRequest, error)
+	Compression  *compressionConfig
 }
 
 func processRequest(cfg handlerConfig, rw http.ResponseWriter, req *http.Request) {
+	var body *trackedBody
+	if cfg.Leaks != nil {
+		req, body = trackBody(req)
+	}
 	f := &flight{
 		cfg:    cfg,
 		rw:     rw,
@@ -48,6 +60,11 @@ func processRequest(cfg handlerConfig, rw http.ResponseWriter, req *http.Request
 		req:    NewIncomingRequest(req),
 	}
 
+	if body != nil {
+		defer checkLeaks(f.req, body, cfg.Leaks)
+	}
+	defer cancelContexts(f.req)
+
 	// The net/http package handles all panics. In the early days of the
 	// framework we were handling them ourselves and running interceptors after
 	// a panic happened, but this adds lots of complexity to the codebase and
@@ -63,6 +80,22 @@ func processRequest(cfg handlerConfig, rw http.ResponseWriter, req *http.Request
 		}
 	}()
 
+	if sim := simulationFromContext(req.Context()); sim != nil {
+		f.simulate(sim)
+		return
+	}
+	var sw *summaryWriter
+	if f.hasFinishers() {
+		f.rw, sw = newSummaryWriter(rw)
+	}
+	f.serve()
+	if sw != nil {
+		f.finishPhase(sw)
+	}
+}
+
+// serve runs the Before phases of the interceptors and the handler.
+func (f *flight) serve() {
 	for _, it := range f.cfg.Interceptors {
 		it.Before(f, f.req)
 		if f.written {
@@ -71,7 +104,25 @@ func processRequest(cfg handlerConfig, rw http.ResponseWriter, req *http.Request
 	}
 	f.cfg.Handler.ServeHTTP(f, f.req)
 	if !f.written {
-		cfg.Dispatcher.Write(rw, NoContentResponse{})
+		f.handleNotWritten()
+	}
+}
+
+// handleNotWritten applies the NotWrittenPolicy after the handler returned
+// without writing a response.
+func (f *flight) handleNotWritten() {
+	switch f.cfg.NotWritten.policy {
+	case NotWrittenFallback:
+		f.cfg.NotWritten.fallback.ServeHTTP(f, f.req)
+	case NotWrittenFail:
+		msg := fmt.Sprintf("handler for %s %q returned without writing a response", f.req.Method(), f.req.URL().Path())
+		if IsLocalDev() {
+			panic(msg)
+		}
+		log.Println(msg)
+	}
+	if !f.written {
+		f.cfg.Dispatcher.Write(f.rw, NoContentResponse{})
 	}
 }
 
@@ -79,12 +130,19 @@ func processRequest(cfg handlerConfig, rw http.ResponseWriter, req *http.Request
 // underlying http.ResponseWriter if the Dispatcher decides it's safe to do so.
 func (f *flight) Write(resp Response) Result {
 	if f.written {
-		panic("ResponseWriter was already written to")
+		return f.doubleWrite()
 	}
 	f.written = true
 	f.commitPhase(resp)
 
-	if err := f.cfg.Dispatcher.Write(f.rw, resp); err != nil {
+	rw, closeRW := http.ResponseWriter(f.rw), func() error { return nil }
+	if f.cfg.Compression != nil {
+		rw, closeRW = f.cfg.Compression.compressingWriter(f.rw, f.header, f.req, resp)
+	}
+	if err := f.cfg.Dispatcher.Write(rw, resp); err != nil {
+		panic(err)
+	}
+	if err := closeRW(); err != nil {
 		panic(err)
 	}
 	return Result{}
@@ -93,10 +151,11 @@ func (f *flight) Write(resp Response) Result {
 // WriteError writes an error response (400-599) according to the provided
 // status code.
 //
-// If the ResponseWriter has already been written to, then this method will panic.
+// If the ResponseWriter has already been written to, then the DoubleWritePolicy
+// applies.
 func (f *flight) WriteError(resp ErrorResponse) Result {
 	if f.written {
-		panic("ResponseWriter was already written to")
+		return f.doubleWrite()
 	}
 	f.written = true
 	f.commitPhase(resp)
@@ -106,6 +165,23 @@ func (f *flight) WriteError(resp ErrorResponse) Result {
 	return Result{}
 }
 
+// doubleWrite applies the DoubleWritePolicy to a write attempted after the
+// response has already been written.
+func (f *flight) doubleWrite() Result {
+	if report := f.cfg.DoubleWrite.report; report != nil {
+		report(f.req)
+	}
+	switch f.cfg.DoubleWrite.policy {
+	case DoubleWriteError:
+		return Result{err: ErrResponseAlreadyWritten}
+	case DoubleWriteLax:
+		log.Printf("ignoring write for %s %q: %v", f.req.Method(), f.req.URL().Path(), ErrResponseAlreadyWritten)
+		return Result{}
+	default:
+		panic(ErrResponseAlreadyWritten)
+	}
+}
+
 // Header returns the collection of headers that will be set on the response.
 // Headers must be set before writing a response.
 func (f *flight) Header() Header {
@@ -115,6 +191,9 @@ func (f *flight) Header() Header {
 // AddCookie adds a Set-Cookie header to the provided ResponseWriter's headers.
 // The provided cookie must have a valid Name, otherwise an error will be
 // returned.
+//
+// Cookies claimed with Header.ClaimCookie can't be added, and an error
+// wrapping ErrCookieClaimed is returned instead.
 func (f *flight) AddCookie(c *Cookie) error {
 	return f.header.addCookie(c)
 }
@@ -124,22 +203,61 @@ func (f *flight) AddCookie(c *Cookie) error {
 // written to the ResponseWriter in a Commit phase then the Commit phases of the
 // remaining interceptors won'f execute.
 func (f *flight) commitPhase(resp Response) {
+	f.committed = true
 	for i := len(f.cfg.Interceptors) - 1; i >= 0; i-- {
 		f.cfg.Interceptors[i].Commit(f, f.req, resp)
 	}
+	if fns, ok := FlightValues(f.req.Context()).Get(afterCommitKey{}).([]func(ResponseHeadersWriter, Response)); ok {
+		for _, fn := range fns {
+			fn(f, resp)
+		}
+	}
+}
+
+func (f *flight) hasFinishers() bool {
+	for _, it := range f.cfg.Interceptors {
+		if _, ok := it.interceptor.(Finisher); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// finishPhase calls the Finish phases of the interceptors, in the same order
+// as the Commit phases, with the summary of the response written through sw.
+func (f *flight) finishPhase(sw *summaryWriter) {
+	s := ResponseSummary{
+		Status:      sw.status(),
+		Size:        sw.size,
+		ContentType: sw.Header().Get("Content-Type"),
+		Committed:   f.committed,
+	}
+	for i := len(f.cfg.Interceptors) - 1; i >= 0; i-- {
+		f.cfg.Interceptors[i].Finish(f.req, s)
+	}
 }
 
 // Result is the result of writing an HTTP response.
 //
 // Use ResponseWriter methods to obtain it.
-type Result struct{}
+type Result struct {
+	err error
+}
+
+// Err returns the error that prevented the response from being written, if
+// any. Currently, this only happens for writes refused by the DoubleWriteError
+// policy, in which case ErrResponseAlreadyWritten is returned.
+func (r Result) Err() error {
+	return r.err
+}
 
 // NotWritten returns a Result which indicates that nothing has been written yet. It
 // can be used in all functions that return a Result, such as in the ServeHTTP method
 // of a Handler or in the Before method of an Interceptor. When returned, NotWritten
 // indicates that the writing of the response should take place later. When this
 // is returned by the Before method in Interceptors the next Interceptor in line
-// is run. When this is returned by a Handler, a 204 No Content response is written.
+// is run. When this is returned by a Handler, a 204 No Content response is written,
+// unless a different NotWrittenPolicy is set with ServeMuxConfig.HandleNotWritten.
 func NotWritten() Result {
 	return Result{}
 }
@@ -168,6 +286,20 @@ type Map interface {
 
 type flightValuesCtxKey struct{}
 
+type afterCommitKey struct{}
+
+// AfterCommit registers fn to be called once the Commit phases of all the
+// interceptors have run for the request, right before the Dispatcher writes
+// the response. It lets interceptors make decisions depending on the headers
+// set in the Commit phases of other interceptors, e.g. on the cookies they
+// add. The functions are called in the order they were registered, and not at
+// all if the response is written without running the Commit phases.
+func AfterCommit(r *IncomingRequest, fn func(w ResponseHeadersWriter, resp Response)) {
+	fv := FlightValues(r.Context())
+	fns, _ := fv.Get(afterCommitKey{}).([]func(ResponseHeadersWriter, Response))
+	fv.Put(afterCommitKey{}, append(fns, fn))
+}
+
 // FlightValues returns a map associated with the given request processing flight.
 // Use it if your interceptors need state that has the lifetime of the request.
 func FlightValues(ctx context.Context) Map {
@@ -15,6 +15,7 @@
 package safehttp_test
 
 import (
+	"errors"
 	"fmt"
 	"net/http/httptest"
 	"testing"
@@ -150,9 +151,13 @@ func TestFlightDoubleWritePanics(t *testing.T) {
 				req := httptest.NewRequest(safehttp.MethodGet, "http://foo.com/search", nil)
 				rw := httptest.NewRecorder()
 				defer func() {
-					if r := recover(); r == nil {
+					r := recover()
+					if r == nil {
 						t.Fatalf("expected panic")
 					}
+					if err, ok := r.(error); !ok || !errors.Is(err, safehttp.ErrResponseAlreadyWritten) {
+						t.Errorf("panic value: got %v, want %v", r, safehttp.ErrResponseAlreadyWritten)
+					}
 					// Good, the panic got propagated.
 					// Note: we are not testing the response headers here, as the first write might have already succeeded.
 				}()
@@ -163,3 +168,92 @@ func TestFlightDoubleWritePanics(t *testing.T) {
 	}
 
 }
+
+func TestFlightDoubleWritePolicies(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  safehttp.DoubleWritePolicy
+		wantErr error
+	}{
+		{
+			name:    "Error",
+			policy:  safehttp.DoubleWriteError,
+			wantErr: safehttp.ErrResponseAlreadyWritten,
+		},
+		{
+			name:   "Lax",
+			policy: safehttp.DoubleWriteLax,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reported := 0
+			mb := safehttp.NewServeMuxConfig(nil)
+			mb.HandleDoubleWrite(tt.policy, func(*safehttp.IncomingRequest) { reported++ })
+			mux := mb.Mux()
+			var second safehttp.Result
+			mux.Handle("/search", safehttp.MethodGet, safehttp.HandlerFunc(func(w safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+				res := w.Write(safehtml.HTMLEscaped("Hello"))
+				if err := res.Err(); err != nil {
+					t.Errorf("first write: got err %v, want nil", err)
+				}
+				second = w.WriteError(safehttp.StatusPreconditionFailed)
+				return second
+			}))
+
+			req := httptest.NewRequest(safehttp.MethodGet, "http://foo.com/search", nil)
+			rw := httptest.NewRecorder()
+			mux.ServeHTTP(rw, req)
+
+			if got := second.Err(); got != tt.wantErr {
+				t.Errorf("second write: got err %v, want %v", got, tt.wantErr)
+			}
+			if reported != 1 {
+				t.Errorf("reported double writes: got %d, want 1", reported)
+			}
+			if got, want := rw.Code, int(safehttp.StatusOK); got != want {
+				t.Errorf("rw.Code: got %v, want %v", got, want)
+			}
+			if got, want := rw.Body.String(), "Hello"; got != want {
+				t.Errorf("response body: got %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+type committingInterceptor struct {
+	name  string
+	order *[]string
+}
+
+func (it committingInterceptor) Before(w safehttp.ResponseWriter, r *safehttp.IncomingRequest, _ safehttp.InterceptorConfig) safehttp.Result {
+	return safehttp.NotWritten()
+}
+
+func (it committingInterceptor) Commit(w safehttp.ResponseHeadersWriter, r *safehttp.IncomingRequest, resp safehttp.Response, _ safehttp.InterceptorConfig) {
+	*it.order = append(*it.order, "commit "+it.name)
+	safehttp.AfterCommit(r, func(w safehttp.ResponseHeadersWriter, resp safehttp.Response) {
+		*it.order = append(*it.order, "after commit "+it.name)
+	})
+}
+
+func (committingInterceptor) Match(safehttp.InterceptorConfig) bool {
+	return false
+}
+
+func TestAfterCommit(t *testing.T) {
+	var order []string
+	mb := safehttp.NewServeMuxConfig(nil)
+	mb.Intercept(committingInterceptor{name: "first", order: &order})
+	mb.Intercept(committingInterceptor{name: "second", order: &order})
+	mux := mb.Mux()
+	mux.Handle("/", safehttp.MethodGet, safehttp.HandlerFunc(func(w safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+		return w.Write(safehttp.NoContentResponse{})
+	}))
+
+	mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(safehttp.MethodGet, "http://foo.com/", nil))
+	want := []string{"commit second", "commit first", "after commit second", "after commit first"}
+	if fmt.Sprint(order) != fmt.Sprint(want) {
+		t.Errorf("order: got %v, want %v", order, want)
+	}
+}
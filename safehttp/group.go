@@ -0,0 +1,167 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package safehttp
+
+import (
+	"sort"
+	"strings"
+)
+
+// RouteGroup configures the handlers registered under a pattern prefix, e.g.
+// "/admin/", with additional interceptors and InterceptorConfigs. Create one
+// with ServeMuxConfig.Group.
+type RouteGroup struct {
+	prefix       string
+	interceptors []Interceptor
+	cfgs         []InterceptorConfig
+}
+
+// Group returns the RouteGroup of the handlers whose pattern starts with
+// prefix, creating it if needed. The configuration of the group applies to
+// the handlers registered on the ServeMuxes created afterwards with Mux.
+//
+// Patterns are matched on their path, segment by segment: the group "/admin/"
+// (or "/admin") covers "/admin", "/admin/" and the patterns under them, but
+// not "/administrator". A group without a host covers host-qualified patterns
+// too, e.g. "example.com/admin/users", while a group with a host, e.g.
+// "example.com/admin/", only covers the patterns for that host.
+//
+// Groups can be nested, e.g. "/admin/" and "/admin/billing/": the handlers
+// under both get the interceptors of both, the outer ones first.
+//
+// The method not allowed handler doesn't get the configuration of the groups.
+func (s *ServeMuxConfig) Group(prefix string) *RouteGroup {
+	for _, g := range s.groups {
+		if g.prefix == prefix {
+			return g
+		}
+	}
+	g := &RouteGroup{prefix: prefix}
+	s.groups = append(s.groups, g)
+	return g
+}
+
+// Intercept installs the given interceptors for the handlers of the group.
+// They run after the interceptors installed on the ServeMuxConfig, in the
+// order they've been installed.
+func (g *RouteGroup) Intercept(is ...Interceptor) {
+	g.interceptors = append(g.interceptors, is...)
+}
+
+// Configure adds InterceptorConfigs applying to all the handlers of the
+// group, as if passed to ServeMux.Handle. A configuration passed to Handle
+// for the same Interceptor takes precedence, as does one of a nested group.
+// A RouteInfo can be passed as well to document the handlers of the group.
+func (g *RouteGroup) Configure(cfgs ...InterceptorConfig) {
+	g.cfgs = append(g.cfgs, cfgs...)
+}
+
+func (g *RouteGroup) clone() *RouteGroup {
+	return &RouteGroup{
+		prefix:       g.prefix,
+		interceptors: append([]Interceptor(nil), g.interceptors...),
+		cfgs:         append([]InterceptorConfig(nil), g.cfgs...),
+	}
+}
+
+func cloneGroups(groups []*RouteGroup) []*RouteGroup {
+	var clones []*RouteGroup
+	for _, g := range groups {
+		clones = append(clones, g.clone())
+	}
+	return clones
+}
+
+// groupConfig returns the interceptors and InterceptorConfigs of a handler
+// registered for pattern with cfgs, including the ones of its groups.
+func groupConfig(groups []*RouteGroup, interceptors []Interceptor, pattern string, cfgs []InterceptorConfig) ([]Interceptor, []InterceptorConfig) {
+	var matching []*RouteGroup
+	for _, g := range groups {
+		if g.covers(pattern) {
+			matching = append(matching, g)
+		}
+	}
+	if len(matching) == 0 {
+		return interceptors, cfgs
+	}
+	// Outer groups first, and groups without a host before the ones with one.
+	sort.SliceStable(matching, func(i, j int) bool {
+		hi, pi := splitPattern(matching[i].prefix)
+		hj, pj := splitPattern(matching[j].prefix)
+		if len(pi) != len(pj) {
+			return len(pi) < len(pj)
+		}
+		return hi == "" && hj != ""
+	})
+
+	its := append([]Interceptor(nil), interceptors...)
+	for _, g := range matching {
+		its = append(its, g.interceptors...)
+	}
+
+	// The configurations of the handler come first, then the ones of the
+	// innermost groups, and only the first one for each interceptor is kept.
+	candidates := append([]InterceptorConfig(nil), cfgs...)
+	for i := len(matching) - 1; i >= 0; i-- {
+		candidates = append(candidates, matching[i].cfgs...)
+	}
+	merged := append([]InterceptorConfig(nil), cfgs...)
+	for _, c := range candidates[len(cfgs):] {
+		if !configured(its, merged, c) {
+			merged = append(merged, c)
+		}
+	}
+	return its, merged
+}
+
+// covers reports whether the handler registered for pattern belongs to the
+// group.
+func (g *RouteGroup) covers(pattern string) bool {
+	host, path := splitPattern(pattern)
+	ghost, gpath := splitPattern(g.prefix)
+	if ghost != "" && ghost != host {
+		return false
+	}
+	gpath = strings.TrimSuffix(gpath, "/")
+	if !strings.HasPrefix(path, gpath) {
+		return false
+	}
+	return len(path) == len(gpath) || path[len(gpath)] == '/'
+}
+
+// splitPattern splits a pattern into its optional host and its path.
+func splitPattern(pattern string) (host, path string) {
+	i := strings.Index(pattern, "/")
+	if i < 0 {
+		return pattern, ""
+	}
+	return pattern[:i], pattern[i:]
+}
+
+// configured reports whether an interceptor matching c is already matched by
+// one of cfgs.
+func configured(its []Interceptor, cfgs []InterceptorConfig, c InterceptorConfig) bool {
+	for _, it := range its {
+		if !it.Match(c) {
+			continue
+		}
+		for _, existing := range cfgs {
+			if it.Match(existing) {
+				return true
+			}
+		}
+	}
+	return false
+}
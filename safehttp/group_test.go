@@ -0,0 +1,160 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package safehttp_test
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-safeweb/safehttp"
+	"github.com/google/safehtml"
+)
+
+func TestRouteGroup(t *testing.T) {
+	mb := safehttp.NewServeMuxConfig(nil)
+	mb.Intercept(setHeaderConfigInterceptor{})
+	admin := mb.Group("/admin/")
+	admin.Intercept(setHeaderInterceptor{name: "Admin", value: "yes"})
+	admin.Configure(setHeaderConfig{name: "Pizza", value: "Margherita"})
+	billing := mb.Group("/admin/billing/")
+	billing.Intercept(setHeaderInterceptor{name: "Billing", value: "yes"})
+	billing.Configure(setHeaderConfig{name: "Pizza", value: "Diavola"})
+	mux := mb.Mux()
+
+	// Groups changed after Mux don't affect it.
+	mb.Group("/admin/").Intercept(setHeaderInterceptor{name: "Late", value: "yes"})
+
+	h := safehttp.HandlerFunc(func(w safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+		return w.Write(safehtml.HTMLEscaped("ok"))
+	})
+	mux.Handle("/", safehttp.MethodGet, h)
+	mux.Handle("/admin/users", safehttp.MethodGet, h)
+	mux.Handle("/admin/billing/invoices", safehttp.MethodGet, h)
+	mux.Handle("/admin/override", safehttp.MethodGet, h, setHeaderConfig{name: "Pizza", value: "Quattro Formaggi"})
+
+	tests := []struct {
+		target      string
+		wantHeaders map[string][]string
+	}{
+		{
+			target: "/",
+			wantHeaders: map[string][]string{
+				"Content-Type": {"text/html; charset=utf-8"},
+				"Pizza":        {"Hawaii"},
+				"Commit-Pizza": {"Hawaii"},
+			},
+		},
+		{
+			target: "/admin/users",
+			wantHeaders: map[string][]string{
+				"Content-Type": {"text/html; charset=utf-8"},
+				"Admin":        {"yes"},
+				"Pizza":        {"Margherita"},
+				"Commit-Pizza": {"Margherita"},
+			},
+		},
+		{
+			target: "/admin/billing/invoices",
+			wantHeaders: map[string][]string{
+				"Content-Type": {"text/html; charset=utf-8"},
+				"Admin":        {"yes"},
+				"Billing":      {"yes"},
+				"Pizza":        {"Diavola"},
+				"Commit-Pizza": {"Diavola"},
+			},
+		},
+		{
+			target: "/admin/override",
+			wantHeaders: map[string][]string{
+				"Content-Type": {"text/html; charset=utf-8"},
+				"Admin":        {"yes"},
+				"Pizza":        {"Quattro Formaggi"},
+				"Commit-Pizza": {"Quattro Formaggi"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			rw := httptest.NewRecorder()
+			mux.ServeHTTP(rw, httptest.NewRequest(safehttp.MethodGet, "http://foo.com"+tt.target, nil))
+
+			if diff := cmp.Diff(tt.wantHeaders, map[string][]string(rw.Header())); diff != "" {
+				t.Errorf("rw.Header() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestRouteGroupClone(t *testing.T) {
+	mb := safehttp.NewServeMuxConfig(nil)
+	mb.Group("/admin/").Intercept(setHeaderInterceptor{name: "Admin", value: "yes"})
+	clone := mb.Clone()
+	clone.Group("/admin/").Intercept(setHeaderInterceptor{name: "Clone", value: "yes"})
+
+	h := safehttp.HandlerFunc(func(w safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+		return w.Write(safehtml.HTMLEscaped("ok"))
+	})
+	mux := mb.Mux()
+	mux.Handle("/admin/", safehttp.MethodGet, h)
+
+	rw := httptest.NewRecorder()
+	mux.ServeHTTP(rw, httptest.NewRequest(safehttp.MethodGet, "http://foo.com/admin/", nil))
+	if got := rw.Header().Get("Clone"); got != "" {
+		t.Errorf("Clone header: got %q, want none", got)
+	}
+	if got, want := rw.Header().Get("Admin"), "yes"; got != want {
+		t.Errorf("Admin header: got %q, want %q", got, want)
+	}
+}
+
+func TestRouteGroupMatching(t *testing.T) {
+	mb := safehttp.NewServeMuxConfig(nil)
+	mb.Group("/admin/").Intercept(setHeaderInterceptor{name: "Admin", value: "yes"})
+	mb.Group("bar.com/").Intercept(setHeaderInterceptor{name: "Bar", value: "yes"})
+	mux := mb.Mux()
+
+	h := safehttp.HandlerFunc(func(w safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+		return w.Write(safehtml.HTMLEscaped("ok"))
+	})
+	mux.Handle("/admin", safehttp.MethodGet, h)
+	mux.Handle("/administrator", safehttp.MethodGet, h)
+	mux.Handle("foo.com/admin/", safehttp.MethodGet, h)
+	mux.Handle("bar.com/public", safehttp.MethodGet, h)
+
+	tests := []struct {
+		target    string
+		wantAdmin string
+		wantBar   string
+	}{
+		{target: "http://baz.com/admin", wantAdmin: "yes"},
+		{target: "http://baz.com/administrator"},
+		{target: "http://foo.com/admin/", wantAdmin: "yes"},
+		{target: "http://bar.com/public", wantBar: "yes"},
+		{target: "http://bar.com/administrator"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			rw := httptest.NewRecorder()
+			mux.ServeHTTP(rw, httptest.NewRequest(safehttp.MethodGet, tt.target, nil))
+			if got := rw.Header().Get("Admin"); got != tt.wantAdmin {
+				t.Errorf("Admin header: got %q, want %q", got, tt.wantAdmin)
+			}
+			if got := rw.Header().Get("Bar"); got != tt.wantBar {
+				t.Errorf("Bar header: got %q, want %q", got, tt.wantBar)
+			}
+		})
+	}
+}
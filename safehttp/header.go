@@ -17,8 +17,10 @@ package safehttp
 import (
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"net/textproto"
+	"strings"
 )
 
 // Header represents the key-value pairs in an HTTP header.
@@ -27,6 +29,8 @@ import (
 type Header struct {
 	wrapped http.Header
 	claimed map[string]bool
+	// cookies maps the names of claimed cookies to their claimants.
+	cookies map[string]string
 }
 
 // NewHeader creates a new Header.
@@ -37,6 +41,7 @@ func NewHeader(h http.Header) Header {
 	return Header{
 		wrapped: h,
 		claimed: map[string]bool{},
+		cookies: map[string]string{},
 	}
 }
 
@@ -46,7 +51,7 @@ func NewHeader(h http.Header) Header {
 // the struct can't write to, change or delete the header with this
 // name. These methods will instead panic when applied on a claimed
 // header. The only way to modify the header is to use the returned
-// function. The Set-Cookie header can't be claimed.
+// function. The Set-Cookie and Vary headers can't be claimed.
 func (h Header) Claim(name string) (set func([]string)) {
 	name = textproto.CanonicalMIMEHeaderKey(name)
 	if err := h.writableHeader(name); err != nil {
@@ -62,21 +67,61 @@ func (h Header) Claim(name string) (set func([]string)) {
 }
 
 // IsClaimed reports whether the provided header is already claimed. The name is
-// first canonicalized using textproto.CanonicalMIMEHeaderKey. The Set-Cookie header
-// is treated as claimed.
+// first canonicalized using textproto.CanonicalMIMEHeaderKey. The Set-Cookie
+// header is treated as claimed.
 func (h Header) IsClaimed(name string) bool {
 	name = textproto.CanonicalMIMEHeaderKey(name)
+	if name == "Vary" {
+		return false
+	}
 	err := h.writableHeader(name)
 	return err != nil
 }
 
+// ClaimCookie claims the cookie with the given name on behalf of claimant and
+// returns a function which can be used to add that cookie as a Set-Cookie
+// header. Cookie names are case-sensitive and are not canonicalized. Once
+// claimed, the cookie can't be added through ResponseWriter.AddCookie anymore,
+// which returns an error naming the claimant instead. The returned function
+// only accepts cookies with the claimed name.
+//
+// The claimant should identify the component claiming the cookie, e.g. the
+// name of an interceptor, as it is used in diagnostics. ClaimCookie panics if
+// the cookie has already been claimed.
+func (h Header) ClaimCookie(name, claimant string) (add func(*Cookie) error) {
+	if prev, ok := h.cookies[name]; ok {
+		panic(fmt.Errorf("%w: cookie %q can't be claimed by %s, already claimed by %s", ErrCookieClaimed, name, claimant, prev))
+	}
+	h.cookies[name] = claimant
+	return func(c *Cookie) error {
+		if c.Name() != name {
+			return fmt.Errorf("cookie %q can't be added using the claim for cookie %q", c.Name(), name)
+		}
+		return h.writeCookie(c)
+	}
+}
+
+// CookieClaimant returns the claimant of the cookie with the given name and
+// reports whether the cookie is claimed.
+func (h Header) CookieClaimant(name string) (claimant string, ok bool) {
+	claimant, ok = h.cookies[name]
+	return claimant, ok
+}
+
 // Set sets the header with the given name to the given value.
 // The name is first canonicalized using textproto.CanonicalMIMEHeaderKey.
 // This method first removes all other values associated with this
 // header before setting the new value. It panics when applied on claimed headers
 // or on the Set-Cookie header.
+//
+// For the Vary header, the comma-separated names in value are merged into the
+// existing ones, as done by Vary, instead of replacing them.
 func (h Header) Set(name, value string) {
 	name = textproto.CanonicalMIMEHeaderKey(name)
+	if name == "Vary" {
+		h.Vary(strings.Split(value, ",")...)
+		return
+	}
 	if err := h.writableHeader(name); err != nil {
 		panic(err)
 	}
@@ -86,9 +131,14 @@ func (h Header) Set(name, value string) {
 // Add adds a new header with the given name and the given value to
 // the collection of headers. The name is first canonicalized using
 // textproto.CanonicalMIMEHeaderKey. It panics when applied
-// on claimed headers or on the Set-Cookie header.
+// on claimed headers or on the Set-Cookie header. For the Vary header, it
+// behaves like Set.
 func (h Header) Add(name, value string) {
 	name = textproto.CanonicalMIMEHeaderKey(name)
+	if name == "Vary" {
+		h.Vary(strings.Split(value, ",")...)
+		return
+	}
 	if err := h.writableHeader(name); err != nil {
 		panic(err)
 	}
@@ -96,8 +146,9 @@ func (h Header) Add(name, value string) {
 }
 
 // Del deletes all headers with the given name. The name is first canonicalized
-// using textproto.CanonicalMIMEHeaderKey. It panics when applied on claimed headers
-// or on the Set-Cookie header.
+// using textproto.CanonicalMIMEHeaderKey. It panics when applied on claimed headers,
+// or on the Set-Cookie and Vary headers: the Vary names added by other
+// components can't be removed.
 func (h Header) Del(name string) {
 	name = textproto.CanonicalMIMEHeaderKey(name)
 	if err := h.writableHeader(name); err != nil {
@@ -127,12 +178,60 @@ func (h Header) Values(name string) []string {
 	return clone
 }
 
+// Vary records that the response depends on the given request headers, e.g.
+// because content negotiation, compression or the choice of a locale branch
+// on them, so that caches don't serve it for requests with other values. The
+// names are canonicalized using textproto.CanonicalMIMEHeaderKey and merged
+// into a single Vary header without duplicates, together with the values set
+// by lower layers, if any. A name of "*" makes the Vary header "*".
+//
+// Set and Add on the Vary header merge the names in the same way, and Del
+// panics when applied on it, so that names can't be dropped.
+func (h Header) Vary(names ...string) {
+	var vary []string
+	seen := map[string]bool{}
+	add := func(name string) {
+		name = strings.TrimSpace(name)
+		// Header names are case-insensitive.
+		key := strings.ToLower(name)
+		if name == "" || seen[key] {
+			return
+		}
+		seen[key] = true
+		vary = append(vary, name)
+	}
+	for _, v := range h.wrapped.Values("Vary") {
+		for _, name := range strings.Split(v, ",") {
+			add(name)
+		}
+	}
+	for _, name := range names {
+		add(textproto.CanonicalMIMEHeaderKey(strings.TrimSpace(name)))
+	}
+	if len(vary) == 0 {
+		return
+	}
+	if seen["*"] {
+		vary = []string{"*"}
+	}
+	h.wrapped["Vary"] = []string{strings.Join(vary, ", ")}
+}
+
 // addCookie adds the cookie provided as a Set-Cookie header in the header
 // collection. If the cookie is nil or cookie.Name() is invalid, no header is
-// added and an error is returned. This is the only method that can modify the
-// Set-Cookie header. If other methods try to modify the header they will return
-// errors.
+// added and an error is returned. This and the functions returned by
+// ClaimCookie are the only way to modify the Set-Cookie header. If other
+// methods try to modify the header they will return errors.
+//
+// Claimed cookies are refused with an error wrapping ErrCookieClaimed.
 func (h Header) addCookie(c *Cookie) error {
+	if claimant, ok := h.cookies[c.Name()]; ok {
+		return fmt.Errorf("%w: cookie %q is claimed by %s", ErrCookieClaimed, c.Name(), claimant)
+	}
+	return h.writeCookie(c)
+}
+
+func (h Header) writeCookie(c *Cookie) error {
 	v := c.String()
 	if v == "" {
 		return errors.New("invalid cookie name")
@@ -141,7 +240,23 @@ func (h Header) addCookie(c *Cookie) error {
 	return nil
 }
 
-// TODO: Add Write, WriteSubset and Clone when needed.
+// Write writes the headers in wire format. The headers are written in a
+// deterministic, canonical order: sorted by name, with the values of each
+// header in the order they were added. This is also the order in which
+// net/http sends response headers, so the output can be used e.g. in golden
+// tests or to sign responses.
+func (h Header) Write(w io.Writer) error {
+	return h.wrapped.Write(w)
+}
+
+// WriteSubset writes the headers in wire format, like Write. If exclude is not
+// nil, the headers whose canonical names are keys of exclude mapping to true
+// are not written.
+func (h Header) WriteSubset(w io.Writer, exclude map[string]bool) error {
+	return h.wrapped.WriteSubset(w, exclude)
+}
+
+// TODO: Add Clone when needed.
 
 // writableHeader assumes that the given name already has been canonicalized
 // using textproto.CanonicalMIMEHeaderKey.
@@ -149,10 +264,13 @@ func (h Header) writableHeader(name string) error {
 	// TODO(@mattiasgrenfeldt, @kele, @empijei): Think about how this should
 	// work during legacy conversions.
 	if name == "Set-Cookie" {
-		return errors.New("can't write to Set-Cookie header")
+		return fmt.Errorf("%w: can't write to Set-Cookie header", ErrHeaderClaimed)
+	}
+	if name == "Vary" {
+		return fmt.Errorf("%w: can't write to Vary header, use Header.Vary", ErrHeaderClaimed)
 	}
 	if h.claimed[name] {
-		return fmt.Errorf("claimed header: %s", name)
+		return fmt.Errorf("%w: %s", ErrHeaderClaimed, name)
 	}
 	return nil
 }
@@ -15,7 +15,9 @@
 package safehttp
 
 import (
+	"errors"
 	"net/http"
+	"strings"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
@@ -374,3 +376,186 @@ func TestHeaderIsClaimedSetCookie(t *testing.T) {
 		t.Errorf(`h.IsClaimed("Set-Cookie") got: %v want: true`, got)
 	}
 }
+
+func TestClaimedErrors(t *testing.T) {
+	h := NewHeader(http.Header{})
+	h.Claim("Foo-Key")
+	tests := []struct {
+		name  string
+		write func()
+	}{
+		{name: "Set claimed", write: func() { h.Set("Foo-Key", "Bar-Value") }},
+		{name: "Add claimed", write: func() { h.Add("Foo-Key", "Bar-Value") }},
+		{name: "Del claimed", write: func() { h.Del("Foo-Key") }},
+		{name: "Claim claimed", write: func() { h.Claim("Foo-Key") }},
+		{name: "Set Set-Cookie", write: func() { h.Set("Set-Cookie", "x=y") }},
+		{name: "Del Vary", write: func() { h.Del("Vary") }},
+		{name: "Claim Vary", write: func() { h.Claim("vary") }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				r := recover()
+				if err, ok := r.(error); !ok || !errors.Is(err, ErrHeaderClaimed) {
+					t.Errorf("panic value: got %v, want %v", r, ErrHeaderClaimed)
+				}
+			}()
+			tt.write()
+		})
+	}
+}
+
+func TestClaimCookie(t *testing.T) {
+	h := NewHeader(http.Header{})
+	add := h.ClaimCookie("session", "session.Interceptor")
+
+	if err := add(NewCookie("session", "foo")); err != nil {
+		t.Fatalf("add(session cookie) got err: %v", err)
+	}
+	if err := add(NewCookie("other", "foo")); err == nil {
+		t.Error("add(other cookie) got nil err, want error")
+	}
+	if claimant, ok := h.CookieClaimant("session"); !ok || claimant != "session.Interceptor" {
+		t.Errorf(`h.CookieClaimant("session"): got (%q, %v), want ("session.Interceptor", true)`, claimant, ok)
+	}
+	if claimant, ok := h.CookieClaimant("Session"); ok {
+		t.Errorf(`h.CookieClaimant("Session"): got (%q, %v), want ("", false)`, claimant, ok)
+	}
+
+	err := h.addCookie(NewCookie("session", "bar"))
+	if !errors.Is(err, ErrCookieClaimed) {
+		t.Errorf("h.addCookie(claimed cookie): got err %v, want %v", err, ErrCookieClaimed)
+	}
+	if err == nil || !strings.Contains(err.Error(), "session.Interceptor") {
+		t.Errorf("h.addCookie(claimed cookie): got err %v, want it to name the claimant", err)
+	}
+	if err := h.addCookie(NewCookie("other", "bar")); err != nil {
+		t.Errorf("h.addCookie(unclaimed cookie) got err: %v", err)
+	}
+
+	want := []string{
+		"session=foo; HttpOnly; Secure; SameSite=Lax",
+		"other=bar; HttpOnly; Secure; SameSite=Lax",
+	}
+	if diff := cmp.Diff(want, h.Values("Set-Cookie")); diff != "" {
+		t.Errorf("h.Values(\"Set-Cookie\") mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestClaimCookieClaimed(t *testing.T) {
+	h := NewHeader(http.Header{})
+	h.ClaimCookie("session", "first")
+	defer func() {
+		r := recover()
+		err, ok := r.(error)
+		if !ok || !errors.Is(err, ErrCookieClaimed) {
+			t.Fatalf("panic value: got %v, want %v", r, ErrCookieClaimed)
+		}
+		if msg := err.Error(); !strings.Contains(msg, "first") || !strings.Contains(msg, "second") {
+			t.Errorf("panic message: got %q, want it to name both claimants", msg)
+		}
+	}()
+	h.ClaimCookie("session", "second")
+}
+
+func TestHeaderWrite(t *testing.T) {
+	h := NewHeader(http.Header{})
+	h.Add("X-B", "2")
+	h.Add("x-a", "1")
+	h.Add("X-B", "1")
+	h.Claim("X-C")([]string{"3"})
+	if err := h.addCookie(NewCookie("c", "v")); err != nil {
+		t.Fatalf("h.addCookie() got err: %v", err)
+	}
+
+	var b strings.Builder
+	if err := h.Write(&b); err != nil {
+		t.Fatalf("h.Write() got err: %v", err)
+	}
+	want := "Set-Cookie: c=v; HttpOnly; Secure; SameSite=Lax\r\n" +
+		"X-A: 1\r\n" +
+		"X-B: 2\r\n" +
+		"X-B: 1\r\n" +
+		"X-C: 3\r\n"
+	if got := b.String(); got != want {
+		t.Errorf("h.Write() wrote %q, want %q", got, want)
+	}
+
+	b.Reset()
+	if err := h.WriteSubset(&b, map[string]bool{"Set-Cookie": true, "X-B": true}); err != nil {
+		t.Fatalf("h.WriteSubset() got err: %v", err)
+	}
+	if got, want := b.String(), "X-A: 1\r\nX-C: 3\r\n"; got != want {
+		t.Errorf("h.WriteSubset() wrote %q, want %q", got, want)
+	}
+}
+
+func TestVary(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing []string
+		vary     [][]string
+		want     []string
+	}{
+		{
+			name: "consolidated",
+			vary: [][]string{{"accept-encoding"}, {"Origin", "Accept-Language"}},
+			want: []string{"Accept-Encoding, Origin, Accept-Language"},
+		},
+		{
+			name: "duplicates",
+			vary: [][]string{{"Origin"}, {"origin", " Origin "}, {"Accept-Encoding", "Origin"}},
+			want: []string{"Origin, Accept-Encoding"},
+		},
+		{
+			name:     "lower layers",
+			existing: []string{"a", "b, Origin"},
+			vary:     [][]string{{"Origin", "Sec-CH-UA"}},
+			want:     []string{"a, b, Origin, Sec-Ch-Ua"},
+		},
+		{
+			name: "star",
+			vary: [][]string{{"Origin"}, {"*"}, {"Accept-Encoding"}},
+			want: []string{"*"},
+		},
+		{
+			name: "empty",
+			vary: [][]string{{}, {""}},
+			want: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wrapped := http.Header{}
+			for _, v := range tt.existing {
+				wrapped.Add("Vary", v)
+			}
+			h := NewHeader(wrapped)
+			for _, names := range tt.vary {
+				h.Vary(names...)
+			}
+			if diff := cmp.Diff(tt.want, wrapped["Vary"]); diff != "" {
+				t.Errorf("Vary mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestHeaderIsClaimedVary(t *testing.T) {
+	h := NewHeader(http.Header{})
+	if got := h.IsClaimed("Vary"); got != false {
+		t.Errorf(`h.IsClaimed("Vary") got: %v want: false`, got)
+	}
+}
+
+func TestSetAddVary(t *testing.T) {
+	wrapped := http.Header{}
+	h := NewHeader(wrapped)
+	h.Vary("Accept-Encoding")
+	h.Set("Vary", "Origin, accept-encoding")
+	h.Add("vary", "Cookie")
+	want := []string{"Accept-Encoding, Origin, Cookie"}
+	if diff := cmp.Diff(want, wrapped["Vary"]); diff != "" {
+		t.Errorf("Vary mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -21,6 +21,8 @@ import (
 	"io"
 	"net/http"
 	"net/url"
+	"regexp"
+	"strconv"
 	"strings"
 	"sync"
 )
@@ -65,6 +67,22 @@ func (r *IncomingRequest) Body() io.ReadCloser {
 	return r.req.Body
 }
 
+// SetBody replaces the body of the request, for the interceptors and the
+// handler running after the caller, e.g. with a reader limiting its size. The
+// new body is responsible for closing the previous one.
+func (r *IncomingRequest) SetBody(body io.ReadCloser) {
+	req := new(http.Request)
+	*req = *r.req
+	req.Body = body
+	r.req = req
+}
+
+// ContentLength returns the length of the body of the request, from its
+// Content-Length header, or -1 if it's unknown.
+func (r *IncomingRequest) ContentLength() int64 {
+	return r.req.ContentLength
+}
+
 // Host returns the host the request is targeted to. This value comes from the
 // Host header.
 func (r *IncomingRequest) Host() string {
@@ -175,6 +193,32 @@ func (r *IncomingRequest) WithContext(ctx context.Context) *IncomingRequest {
 	return r2
 }
 
+// SetContext replaces the context of the request, for the interceptors and the
+// handler running after the caller, e.g. to give it a deadline. The provided
+// ctx must be derived from the current context of the request.
+//
+// If cancel is non-nil, it's called once the request has been served by the
+// ServeMux, after the response has been written. This releases the resources
+// of ctx without breaking streamed responses.
+func (r *IncomingRequest) SetContext(ctx context.Context, cancel context.CancelFunc) {
+	r.req = r.req.WithContext(ctx)
+	if cancel != nil {
+		fv := FlightValues(ctx)
+		fns, _ := fv.Get(contextCancelsKey{}).([]context.CancelFunc)
+		fv.Put(contextCancelsKey{}, append(fns, cancel))
+	}
+}
+
+type contextCancelsKey struct{}
+
+// cancelContexts calls the cancel functions registered with SetContext.
+func cancelContexts(r *IncomingRequest) {
+	fns, _ := FlightValues(r.Context()).Get(contextCancelsKey{}).([]context.CancelFunc)
+	for _, cancel := range fns {
+		cancel()
+	}
+}
+
 // URL specifies the URL that is parsed from the Request-Line. For most requests,
 // only URL.Path() will return a non-empty result. (See RFC 7230, Section 5.3)
 func (r *IncomingRequest) URL() *URL {
@@ -207,6 +251,49 @@ func (r *IncomingRequest) WithStrippedURLPrefix(prefix string) (*IncomingRequest
 	return r2, nil
 }
 
+// Pattern returns the pattern of the handler the request was matched with,
+// e.g. "/users/{id}", or an empty string if the request wasn't served by a
+// ServeMux.
+func (r *IncomingRequest) Pattern() string {
+	p, _ := r.req.Context().Value(patternCtxKey{}).(string)
+	return p
+}
+
+// PathValue returns the value of the named parameter of the pattern the
+// request was matched with, e.g. the id of "/users/{id}". It returns an empty
+// string if the pattern has no such parameter.
+func (r *IncomingRequest) PathValue(name string) string {
+	values, _ := r.req.Context().Value(pathValuesCtxKey{}).(map[string]string)
+	return values[name]
+}
+
+// PathInt64 returns the value of the named parameter of the pattern the
+// request was matched with, parsed as a base 10 int64. It returns an error if
+// the parameter is missing or isn't a valid int64.
+func (r *IncomingRequest) PathInt64(name string) (int64, error) {
+	v := r.PathValue(name)
+	if v == "" {
+		return 0, fmt.Errorf("missing path parameter %q", name)
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid path parameter %q: %v", name, err)
+	}
+	return n, nil
+}
+
+// PathMatch returns the value of the named parameter of the pattern the
+// request was matched with if it matches re. Otherwise, it returns an error.
+// The regular expression should be anchored, e.g. `^[a-z0-9-]+$`, so that it
+// matches the whole value.
+func (r *IncomingRequest) PathMatch(name string, re *regexp.Regexp) (string, error) {
+	v := r.PathValue(name)
+	if v == "" || !re.MatchString(v) {
+		return "", fmt.Errorf("path parameter %q doesn't match %v", name, re)
+	}
+	return v, nil
+}
+
 func rawRequest(r *IncomingRequest) *http.Request {
 	return r.req
 }
@@ -16,6 +16,7 @@ package safehttp_test
 
 import (
 	"context"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"strings"
@@ -183,6 +184,45 @@ func TestRequestWithContext(t *testing.T) {
 	}
 }
 
+func TestRequestSetContext(t *testing.T) {
+	var ctx context.Context
+	var canceled bool
+	mux := safehttp.NewServeMuxConfig(nil).Mux()
+	mux.Handle("/", safehttp.MethodGet, safehttp.HandlerFunc(func(w safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+		r.SetContext(context.WithValue(r.Context(), pizzaKey("1234"), &pizza{val: "margeritta"}), func() { canceled = true })
+		ctx = r.Context()
+		if canceled {
+			t.Error("cancel called before the response was written")
+		}
+		return w.Write(safehttp.NoContentResponse{})
+	}))
+
+	mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(safehttp.MethodGet, "/", nil))
+	if _, ok := ctx.Value(pizzaKey("1234")).(*pizza); !ok {
+		t.Error("r.Context() after r.SetContext(): value not set")
+	}
+	if !canceled {
+		t.Error("cancel not called after the response was written")
+	}
+}
+
+func TestRequestSetBody(t *testing.T) {
+	req := httptest.NewRequest(safehttp.MethodPost, "/", strings.NewReader("pizza"))
+	ir := safehttp.NewIncomingRequest(req)
+	ir.SetBody(ioutil.NopCloser(strings.NewReader("pasta")))
+
+	b, err := ioutil.ReadAll(ir.Body())
+	if err != nil {
+		t.Fatalf("ioutil.ReadAll(ir.Body()) got err: %v", err)
+	}
+	if got, want := string(b), "pasta"; got != want {
+		t.Errorf("ir.Body(): got %q, want %q", got, want)
+	}
+	if got, want := ir.ContentLength(), int64(len("pizza")); got != want {
+		t.Errorf("ir.ContentLength(): got %d, want %d", got, want)
+	}
+}
+
 func TestRequestSetNilContext(t *testing.T) {
 	req := httptest.NewRequest(safehttp.MethodGet, "/", nil)
 	ir := safehttp.NewIncomingRequest(req)
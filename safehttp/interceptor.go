@@ -38,6 +38,34 @@ type Interceptor interface {
 	Match(InterceptorConfig) bool
 }
 
+// Finisher is implemented by Interceptors which need to observe the response
+// once it has been written, e.g. to log it or to record metrics. This can't be
+// done in Commit, which runs before the Dispatcher writes the response.
+type Finisher interface {
+	// Finish runs after the response, or the error response, has been
+	// written, in the same order as the Commit phases. It runs for all the
+	// installed interceptors, whether or not their Before phase ran, but not
+	// if the processing of the request panicked. The response can't be
+	// modified anymore.
+	Finish(r *IncomingRequest, s ResponseSummary, cfg InterceptorConfig)
+}
+
+// ResponseSummary describes the response written for a request.
+type ResponseSummary struct {
+	// Status is the status code of the response.
+	Status StatusCode
+	// Size is the number of bytes of the response body, as written to the
+	// client, e.g. after compression.
+	Size int64
+	// ContentType is the Content-Type of the response, if any.
+	ContentType string
+	// Committed reports whether the Commit phases ran before the response was
+	// written. They always do, for error responses too, except when the
+	// handler returns without writing a response and the framework writes one
+	// on its behalf, e.g. 204 No Content.
+	Committed bool
+}
+
 // InterceptorConfig is a configuration for an interceptor.
 type InterceptorConfig interface{}
 
@@ -61,3 +89,11 @@ func (ci *configuredInterceptor) Before(w ResponseWriter, r *IncomingRequest) Re
 func (ci *configuredInterceptor) Commit(w ResponseHeadersWriter, r *IncomingRequest, resp Response) {
 	ci.interceptor.Commit(w, r, resp, ci.config)
 }
+
+// Finish runs after the response has been written, if the interceptor is a
+// Finisher.
+func (ci *configuredInterceptor) Finish(r *IncomingRequest, s ResponseSummary) {
+	if f, ok := ci.interceptor.(Finisher); ok {
+		f.Finish(r, s, ci.config)
+	}
+}
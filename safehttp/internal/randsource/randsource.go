@@ -0,0 +1,50 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package randsource holds the source of randomness shared by the random
+// package and safehttp, which can't import random without an import cycle.
+package randsource
+
+import (
+	"crypto/rand"
+	"io"
+	"sync"
+)
+
+var (
+	mu     sync.RWMutex
+	source io.Reader = rand.Reader
+)
+
+// Read fills b with random bytes from the source.
+func Read(b []byte) error {
+	mu.RLock()
+	defer mu.RUnlock()
+	_, err := io.ReadFull(source, b)
+	return err
+}
+
+// Set replaces the source and returns a function which restores the previous
+// one. See random.SetSourceForTesting for the checks callers must do.
+func Set(r io.Reader) (restore func()) {
+	mu.Lock()
+	defer mu.Unlock()
+	prev := source
+	source = r
+	return func() {
+		mu.Lock()
+		defer mu.Unlock()
+		source = prev
+	}
+}
@@ -0,0 +1,128 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package safehttp
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"strings"
+)
+
+const (
+	defaultJSONMaxBytes = 1 << 20
+	defaultJSONMaxDepth = 64
+)
+
+type jsonOptions struct {
+	maxBytes              int64
+	maxDepth              int
+	disallowUnknownFields bool
+}
+
+// JSONOption configures the decoding of JSON request bodies.
+type JSONOption func(*jsonOptions)
+
+// JSONMaxBytes sets the maximum size of the body. By default, 1 MiB is used.
+func JSONMaxBytes(n int64) JSONOption {
+	return func(o *jsonOptions) { o.maxBytes = n }
+}
+
+// JSONMaxDepth sets the maximum nesting depth of arrays and objects. By
+// default, 64 is used.
+func JSONMaxDepth(n int) JSONOption {
+	return func(o *jsonOptions) { o.maxDepth = n }
+}
+
+// JSONDisallowUnknownFields rejects objects with keys that don't match any
+// non-ignored, exported field of the destination struct.
+func JSONDisallowUnknownFields() JSONOption {
+	return func(o *jsonOptions) { o.disallowUnknownFields = true }
+}
+
+// JSONBody decodes the JSON body of a POST, PATCH or PUT request into v, using
+// encoding/json. The Content-Type of the request must be application/json or
+// end in +json, and the body must hold a single JSON value.
+//
+// Bodies larger than the maximum size are rejected with an error wrapping
+// ErrBodyTooLarge, and bodies nesting values deeper than the maximum depth are
+// rejected before being decoded.
+func (r *IncomingRequest) JSONBody(v interface{}, opts ...JSONOption) error {
+	if m := r.req.Method; m != MethodPost && m != MethodPatch && m != MethodPut {
+		return fmt.Errorf("got request method %s, want POST/PATCH/PUT", m)
+	}
+	ct, _, err := mime.ParseMediaType(r.req.Header.Get("Content-Type"))
+	if err != nil || (ct != "application/json" && !strings.HasSuffix(ct, "+json")) {
+		return fmt.Errorf("invalid method called for Content-Type: %s", r.req.Header.Get("Content-Type"))
+	}
+
+	o := jsonOptions{maxBytes: defaultJSONMaxBytes, maxDepth: defaultJSONMaxDepth}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	b, err := ioutil.ReadAll(io.LimitReader(r.req.Body, o.maxBytes+1))
+	if err != nil {
+		return err
+	}
+	if int64(len(b)) > o.maxBytes {
+		return fmt.Errorf("%w: more than %d bytes", ErrBodyTooLarge, o.maxBytes)
+	}
+	if err := checkJSON(b, o.maxDepth); err != nil {
+		return err
+	}
+
+	d := json.NewDecoder(bytes.NewReader(b))
+	if o.disallowUnknownFields {
+		d.DisallowUnknownFields()
+	}
+	return d.Decode(v)
+}
+
+// checkJSON verifies that the body holds a single JSON value that doesn't nest
+// arrays or objects deeper than maxDepth.
+func checkJSON(b []byte, maxDepth int) error {
+	d := json.NewDecoder(bytes.NewReader(b))
+	depth := 0
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			return errors.New("empty JSON body")
+		}
+		if err != nil {
+			return err
+		}
+		switch tok {
+		case json.Delim('{'), json.Delim('['):
+			depth++
+			if depth > maxDepth {
+				return fmt.Errorf("JSON values nested deeper than %d", maxDepth)
+			}
+		case json.Delim('}'), json.Delim(']'):
+			depth--
+		}
+		if depth == 0 {
+			break
+		}
+	}
+	if _, err := d.Token(); err != io.EOF {
+		return errors.New("unexpected data after the JSON value")
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package safehttp_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/google/go-safeweb/safehttp"
+	"github.com/google/go-safeweb/safehttp/safehttptest"
+)
+
+type jsonItem struct {
+	Name  string `json:"name"`
+	Price int    `json:"price"`
+}
+
+func newJSONRequest(body string) *safehttp.IncomingRequest {
+	r := safehttptest.NewRequest(safehttp.MethodPost, "/", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json; charset=utf-8")
+	return r
+}
+
+func TestJSONBody(t *testing.T) {
+	r := newJSONRequest(`{"name": "pizza", "price": 10, "extra": true}`)
+	var got jsonItem
+	if err := r.JSONBody(&got); err != nil {
+		t.Fatalf("r.JSONBody() got err: %v", err)
+	}
+	if want := (jsonItem{Name: "pizza", Price: 10}); got != want {
+		t.Errorf("r.JSONBody() decoded %+v, want %+v", got, want)
+	}
+}
+
+func TestJSONBodyRejected(t *testing.T) {
+	tests := []struct {
+		name string
+		req  func() *safehttp.IncomingRequest
+		opts []safehttp.JSONOption
+	}{
+		{
+			name: "Unknown field",
+			req:  func() *safehttp.IncomingRequest { return newJSONRequest(`{"name": "pizza", "extra": true}`) },
+			opts: []safehttp.JSONOption{safehttp.JSONDisallowUnknownFields()},
+		},
+		{
+			name: "Too deep",
+			req:  func() *safehttp.IncomingRequest { return newJSONRequest(`{"name": [[["pizza"]]]}`) },
+			opts: []safehttp.JSONOption{safehttp.JSONMaxDepth(3)},
+		},
+		{
+			name: "Trailing data",
+			req:  func() *safehttp.IncomingRequest { return newJSONRequest(`{"name": "pizza"} {"name": "pasta"}`) },
+		},
+		{
+			name: "Empty body",
+			req:  func() *safehttp.IncomingRequest { return newJSONRequest("") },
+		},
+		{
+			name: "Wrong Content-Type",
+			req: func() *safehttp.IncomingRequest {
+				r := newJSONRequest(`{"name": "pizza"}`)
+				r.Header.Set("Content-Type", "text/plain")
+				return r
+			},
+		},
+		{
+			name: "Wrong method",
+			req: func() *safehttp.IncomingRequest {
+				r := safehttptest.NewRequest(safehttp.MethodGet, "/", strings.NewReader(`{"name": "pizza"}`))
+				r.Header.Set("Content-Type", "application/json")
+				return r
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got jsonItem
+			if err := tt.req().JSONBody(&got, tt.opts...); err == nil {
+				t.Errorf("r.JSONBody() got nil err, decoded %+v", got)
+			}
+		})
+	}
+}
+
+func TestJSONBodyTooLarge(t *testing.T) {
+	r := newJSONRequest(`{"name": "` + strings.Repeat("a", 100) + `"}`)
+	var got jsonItem
+	err := r.JSONBody(&got, safehttp.JSONMaxBytes(50))
+	if !errors.Is(err, safehttp.ErrBodyTooLarge) {
+		t.Errorf("r.JSONBody() got err: %v, want %v", err, safehttp.ErrBodyTooLarge)
+	}
+}
@@ -0,0 +1,82 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package safehttp
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+)
+
+// trackedBody records whether a request body was consumed or closed.
+type trackedBody struct {
+	io.ReadCloser
+	eof, closed bool
+}
+
+func (b *trackedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err == io.EOF {
+		b.eof = true
+	}
+	return n, err
+}
+
+func (b *trackedBody) Close() error {
+	b.closed = true
+	return b.ReadCloser.Close()
+}
+
+// trackBody returns a shallow copy of req whose body is tracked. The returned
+// trackedBody is nil if the request has no body.
+func trackBody(req *http.Request) (*http.Request, *trackedBody) {
+	if req.Body == nil || req.Body == http.NoBody || req.ContentLength == 0 {
+		return req, nil
+	}
+	b := &trackedBody{ReadCloser: req.Body}
+	req = req.WithContext(req.Context())
+	req.Body = b
+	return req, b
+}
+
+// checkLeaks reports the request body if it was neither consumed nor closed
+// and every multipart temporary file that still exists. Bodies parsed as forms
+// count as consumed, as the multipart reader stops at the final boundary.
+func checkLeaks(r *IncomingRequest, body *trackedBody, report func(*IncomingRequest, error)) {
+	parsed := r.req.PostForm != nil || r.req.MultipartForm != nil
+	if body != nil && !body.eof && !body.closed && !parsed {
+		report(r, errors.New("request body was neither consumed nor closed"))
+	}
+
+	mf := r.req.MultipartForm
+	if mf == nil {
+		return
+	}
+	for param, fhs := range mf.File {
+		for _, fh := range fhs {
+			f, err := fh.Open()
+			if err != nil {
+				// The temporary file was removed.
+				continue
+			}
+			if _, onDisk := f.(*os.File); onDisk {
+				report(r, fmt.Errorf("temporary file of multipart form parameter %q was not removed", param))
+			}
+			f.Close()
+		}
+	}
+}
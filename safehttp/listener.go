@@ -0,0 +1,133 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package safehttp
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+)
+
+// Listener is an additional address served by a Server with its own
+// ServeMux, and therefore its own interceptors. Listeners share the timeouts
+// and the lifecycle of the Server: they are started by its Serve and
+// ListenAndServe methods and stopped by Shutdown and Close. Reload only
+// affects the ServeMux of the Server.
+type Listener struct {
+	// Addr is the TCP address to listen on, e.g. "127.0.0.1:8081". It's
+	// ignored if Listener is set.
+	Addr string
+
+	// Listener, if set, is served instead of listening on Addr, e.g. a Unix
+	// socket for admin endpoints.
+	Listener net.Listener
+
+	// Mux is the ServeMux serving the requests. A nil Mux is invalid.
+	Mux *ServeMux
+
+	// TLSConfig, if set, serves the listener over TLS. The configuration
+	// must provide the certificates, e.g. with ServerTLSConfig. Like the one
+	// of the Server, it's cloned and set to require at least TLS 1.2.
+	TLSConfig *tls.Config
+}
+
+// extraListener is a Listener being served.
+type extraListener struct {
+	cfg Listener
+	srv *http.Server
+}
+
+// buildListeners builds the servers of the Listeners of s, with the settings
+// of main.
+func (s *Server) buildListeners(main *http.Server) ([]*extraListener, error) {
+	var extra []*extraListener
+	for i, l := range s.Listeners {
+		if l.Mux == nil {
+			return nil, fmt.Errorf("listener %d has no mux", i)
+		}
+		if l.Listener == nil && l.Addr == "" {
+			return nil, fmt.Errorf("listener %d has no address", i)
+		}
+		srv := &http.Server{
+			Handler:        l.Mux,
+			ReadTimeout:    main.ReadTimeout,
+			WriteTimeout:   main.WriteTimeout,
+			IdleTimeout:    main.IdleTimeout,
+			MaxHeaderBytes: main.MaxHeaderBytes,
+			TLSConfig:      safeTLSConfig(l.TLSConfig),
+		}
+		if s.DisableKeepAlives {
+			srv.SetKeepAlivesEnabled(false)
+		}
+		extra = append(extra, &extraListener{cfg: l, srv: srv})
+	}
+	return extra, nil
+}
+
+// startListeners starts serving the Listeners of s in the background. The
+// listening errors are returned, after closing the listeners already started,
+// while the ones happening later are logged.
+func (s *Server) startListeners() error {
+	for i, l := range s.extra {
+		nl := l.cfg.Listener
+		if nl == nil {
+			var err error
+			if nl, err = net.Listen("tcp", l.cfg.Addr); err != nil {
+				for _, started := range s.extra[:i] {
+					started.srv.Close()
+				}
+				return err
+			}
+		}
+		go l.serve(nl)
+	}
+	return nil
+}
+
+func (l *extraListener) serve(nl net.Listener) {
+	var err error
+	if l.srv.TLSConfig != nil {
+		err = l.srv.ServeTLS(nl, "", "")
+	} else {
+		err = l.srv.Serve(nl)
+	}
+	if !errors.Is(err, http.ErrServerClosed) {
+		log.Printf("serving listener %s: %v", nl.Addr(), err)
+	}
+}
+
+// shutdownAll shuts down the server and its Listeners concurrently, returning
+// the first error.
+func (s *Server) shutdownAll(ctx context.Context) error {
+	errs := make(chan error, len(s.extra))
+	for _, l := range s.extra {
+		l := l
+		go func() {
+			l.srv.SetKeepAlivesEnabled(false)
+			errs <- l.srv.Shutdown(ctx)
+		}()
+	}
+	err := s.srv.Shutdown(ctx)
+	for range s.extra {
+		if lerr := <-errs; err == nil {
+			err = lerr
+		}
+	}
+	return err
+}
@@ -0,0 +1,155 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package safehttp
+
+import (
+	"fmt"
+	"mime"
+	"strings"
+)
+
+// activeMediaTypes are rendered, executed or applied by browsers. Responses
+// with these types can only be written by the Dispatcher through the safe
+// response types, e.g. TemplateResponse, or by a FileServer, so they can't be
+// registered nor streamed.
+var activeMediaTypes = map[string]bool{
+	"application/ecmascript": true,
+	"application/javascript": true,
+	"application/xhtml+xml":  true,
+	"image/svg+xml":          true,
+	"text/css":               true,
+	"text/ecmascript":        true,
+	"text/html":              true,
+	"text/javascript":        true,
+	"text/xml":               true,
+}
+
+// defaultContentTypes are the Content-Types written by the DefaultDispatcher
+// for the built-in response types and by FileServers for common static
+// assets.
+var defaultContentTypes = []string{
+	// Built-in response types.
+	"application/json; charset=utf-8",
+	"application/octet-stream",
+	"application/x-ndjson",
+	"application/xml; charset=utf-8",
+	"text/csv; charset=utf-8",
+	"text/event-stream",
+	"text/html; charset=utf-8",
+	"text/plain; charset=utf-8",
+	// Static assets.
+	"application/pdf",
+	"application/wasm",
+	"application/zip",
+	"audio/mpeg",
+	"audio/ogg",
+	"font/otf",
+	"font/ttf",
+	"font/woff",
+	"font/woff2",
+	"image/avif",
+	"image/gif",
+	"image/jpeg",
+	"image/png",
+	"image/svg+xml",
+	"image/vnd.microsoft.icon",
+	"image/webp",
+	"image/x-icon",
+	"text/css; charset=utf-8",
+	"text/javascript; charset=utf-8",
+	"video/mp4",
+	"video/webm",
+}
+
+// MIMETypes is a registry of the Content-Types responses can be written with.
+// Each media type maps to the exact Content-Type value written, including its
+// charset, so that a handler can't make browsers interpret a response as a
+// different type or with a different encoding than the vetted one.
+//
+// The DefaultDispatcher resolves the Content-Types chosen by handlers, i.e.
+// the ones of StreamingResponses and FileServerResponses, through its
+// registry. It refuses to stream responses with unregistered ones, and serves
+// files with unregistered ones as application/octet-stream.
+type MIMETypes struct {
+	types map[string]string
+}
+
+// defaultMIMETypes is used by DefaultDispatchers without a registry. It's
+// never modified.
+var defaultMIMETypes = NewMIMETypes()
+
+// NewMIMETypes creates a registry holding the Content-Types of the built-in
+// response types and of common static assets.
+func NewMIMETypes() *MIMETypes {
+	m := &MIMETypes{types: map[string]string{}}
+	for _, ct := range defaultContentTypes {
+		mt, _, err := mime.ParseMediaType(ct)
+		if err != nil {
+			panic(fmt.Sprintf("invalid default Content-Type %q: %v", ct, err))
+		}
+		m.types[mt] = ct
+	}
+	return m
+}
+
+// Register adds a vetted Content-Type to the registry, e.g.
+// "application/vnd.ms-excel" or "text/calendar; charset=utf-8". A charset of
+// utf-8 is added to text types which don't specify one.
+//
+// Register returns an error if the Content-Type can't be parsed, if its media
+// type is rendered or executed by browsers, e.g. text/html, or if the media
+// type is already registered with a different value. Register isn't safe for
+// concurrent use: the registry should be populated before being used by a
+// Dispatcher.
+func (m *MIMETypes) Register(contentType string) error {
+	mt, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return fmt.Errorf("invalid Content-Type %q: %v", contentType, err)
+	}
+	if activeMediaTypes[mt] {
+		return fmt.Errorf("%q is rendered by browsers and can only be written by the framework", mt)
+	}
+	if strings.HasPrefix(mt, "text/") && params["charset"] == "" {
+		params["charset"] = "utf-8"
+	}
+	ct := mime.FormatMediaType(mt, params)
+	if old, ok := m.types[mt]; ok && old != ct {
+		return fmt.Errorf("%q is already registered as %q", mt, old)
+	}
+	m.types[mt] = ct
+	return nil
+}
+
+// ContentType returns the registered Content-Type for the media type of v.
+// The parameters of v are replaced by the registered ones: it's an error for
+// v to specify a charset that differs from the registered one. The returned
+// error wraps ErrUnregisteredContentType if the media type isn't registered.
+func (m *MIMETypes) ContentType(v string) (string, error) {
+	mt, params, err := mime.ParseMediaType(v)
+	if err != nil {
+		return "", fmt.Errorf("%w: %q: %v", ErrUnregisteredContentType, v, err)
+	}
+	ct, ok := m.types[mt]
+	if !ok {
+		return "", fmt.Errorf("%w: %q", ErrUnregisteredContentType, mt)
+	}
+	if cs, ok := params["charset"]; ok {
+		_, regParams, _ := mime.ParseMediaType(ct)
+		if want := regParams["charset"]; want != "" && !strings.EqualFold(cs, want) {
+			return "", fmt.Errorf("%w: %q has charset %q, want %q", ErrUnregisteredContentType, mt, cs, want)
+		}
+	}
+	return ct, nil
+}
@@ -0,0 +1,183 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package safehttp_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-safeweb/safehttp"
+)
+
+func TestMIMETypesContentType(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{in: "text/csv", want: "text/csv; charset=utf-8"},
+		{in: "text/CSV; charset=UTF-8", want: "text/csv; charset=utf-8"},
+		{in: "application/json", want: "application/json; charset=utf-8"},
+		{in: "application/octet-stream; charset=utf-8", want: "application/octet-stream"},
+		{in: "image/png", want: "image/png"},
+	}
+	m := safehttp.NewMIMETypes()
+	for _, tt := range tests {
+		got, err := m.ContentType(tt.in)
+		if err != nil {
+			t.Errorf("ContentType(%q) got err: %v", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ContentType(%q): got %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestMIMETypesContentTypeRejected(t *testing.T) {
+	m := safehttp.NewMIMETypes()
+	for _, ct := range []string{"", "text/x-unknown", "application/x-shockwave-flash", "text/plain; charset=utf-7"} {
+		if got, err := m.ContentType(ct); !errors.Is(err, safehttp.ErrUnregisteredContentType) {
+			t.Errorf("ContentType(%q): got %q, %v, want error %v", ct, got, err, safehttp.ErrUnregisteredContentType)
+		}
+	}
+}
+
+func TestMIMETypesRegister(t *testing.T) {
+	m := safehttp.NewMIMETypes()
+	if err := m.Register("text/calendar"); err != nil {
+		t.Fatalf("Register() got err: %v", err)
+	}
+	if err := m.Register("application/vnd.ms-excel"); err != nil {
+		t.Fatalf("Register() got err: %v", err)
+	}
+	// Registering the same value again is allowed.
+	if err := m.Register("text/calendar; charset=utf-8"); err != nil {
+		t.Errorf("Register() again got err: %v", err)
+	}
+
+	if got, err := m.ContentType("text/calendar"); err != nil || got != "text/calendar; charset=utf-8" {
+		t.Errorf("ContentType(text/calendar): got %q, %v, want %q", got, err, "text/calendar; charset=utf-8")
+	}
+	if got, err := m.ContentType("application/vnd.ms-excel"); err != nil || got != "application/vnd.ms-excel" {
+		t.Errorf("ContentType(application/vnd.ms-excel): got %q, %v, want %q", got, err, "application/vnd.ms-excel")
+	}
+	if _, err := safehttp.NewMIMETypes().ContentType("text/calendar"); err == nil {
+		t.Error("registering a type affected other registries")
+	}
+}
+
+func TestMIMETypesRegisterInvalid(t *testing.T) {
+	for _, ct := range []string{
+		"",
+		"text/html",
+		"text/html; charset=utf-8",
+		"application/javascript",
+		"image/svg+xml",
+		"application/xhtml+xml",
+		"text/css",
+		"text/plain; charset=iso-8859-1",
+	} {
+		if err := safehttp.NewMIMETypes().Register(ct); err == nil {
+			t.Errorf("Register(%q) got nil err, want error", ct)
+		}
+	}
+}
+
+func TestDispatcherUnregisteredContentType(t *testing.T) {
+	d := safehttp.DefaultDispatcher{}
+	called := false
+	err := d.Write(httptest.NewRecorder(), safehttp.StreamingResponse{
+		ContentType: "text/plain; charset=utf-16",
+		Stream: func(sw *safehttp.StreamWriter) error {
+			called = true
+			return nil
+		},
+	})
+	if !errors.Is(err, safehttp.ErrUnregisteredContentType) {
+		t.Errorf("Write() got err: %v, want %v", err, safehttp.ErrUnregisteredContentType)
+	}
+	if called {
+		t.Error("Stream was called for an unregistered Content-Type")
+	}
+}
+
+func TestStreamingRegisteredContentType(t *testing.T) {
+	m := safehttp.NewMIMETypes()
+	if err := m.Register("text/calendar"); err != nil {
+		t.Fatalf("Register() got err: %v", err)
+	}
+	d := safehttp.DefaultDispatcher{MIMETypes: m}
+	rw := httptest.NewRecorder()
+	err := d.Write(rw, safehttp.StreamingResponse{
+		ContentType: "text/calendar",
+		Stream: func(sw *safehttp.StreamWriter) error {
+			_, err := sw.Write([]byte("BEGIN:VCALENDAR"))
+			return err
+		},
+	})
+	if err != nil {
+		t.Fatalf("Write() got err: %v", err)
+	}
+	if got, want := rw.Header().Get("Content-Type"), "text/calendar; charset=utf-8"; got != want {
+		t.Errorf("Content-Type: got %q, want %q", got, want)
+	}
+	if got, want := rw.Body.String(), "BEGIN:VCALENDAR"; got != want {
+		t.Errorf("body: got %q, want %q", got, want)
+	}
+}
+
+func TestFileServerRegisteredContentTypes(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string][]byte{
+		"style.css": []byte("body {}"),
+		"data.bin":  {0, 1, 2},
+		"feed.xml":  []byte("<feed></feed>"),
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		path   string
+		wantCT string
+	}{
+		{path: "/style.css", wantCT: "text/css; charset=utf-8"},
+		// The charset added by the FileServer to sniffed types is dropped.
+		{path: "/data.bin", wantCT: "application/octet-stream"},
+		// Unregistered types are served as downloads.
+		{path: "/feed.xml", wantCT: "application/octet-stream"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			mux := safehttp.NewServeMuxConfig(nil).Mux()
+			mux.Handle("/", safehttp.MethodGet, safehttp.FileServer(dir))
+
+			rw := httptest.NewRecorder()
+			mux.ServeHTTP(rw, httptest.NewRequest(safehttp.MethodGet, "https://example.com"+tt.path, nil))
+			if rw.Code != http.StatusOK {
+				t.Errorf("status: got %d, want %d", rw.Code, http.StatusOK)
+			}
+			if got := rw.Header().Get("Content-Type"); got != tt.wantCT {
+				t.Errorf("Content-Type: got %q, want %q", got, tt.wantCT)
+			}
+		})
+	}
+}
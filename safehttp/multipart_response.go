@@ -0,0 +1,105 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package safehttp
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+
+	"golang.org/x/net/http/httpguts"
+)
+
+// MultipartResponse is a multipart/mixed response, built part by part through
+// AddPart. The boundary is generated when the response is written and is
+// guaranteed not to occur in any of the parts.
+type MultipartResponse struct {
+	parts []multipartPart
+}
+
+type multipartPart struct {
+	header textproto.MIMEHeader
+	body   []byte
+}
+
+// NewMultipartResponse creates an empty multipart/mixed response.
+func NewMultipartResponse() *MultipartResponse {
+	return &MultipartResponse{}
+}
+
+// AddPart appends a part with the given Content-Type, additional headers and
+// body to the response.
+//
+// AddPart returns an error if the Content-Type can't be parsed, if header
+// contains a Content-Type or an invalid header name or value (e.g. one
+// containing a newline), and leaves the response unchanged.
+func (m *MultipartResponse) AddPart(contentType string, header map[string][]string, body []byte) error {
+	if _, _, err := mime.ParseMediaType(contentType); err != nil {
+		return fmt.Errorf("invalid part Content-Type %q: %v", contentType, err)
+	}
+	h := textproto.MIMEHeader{}
+	for name, values := range header {
+		if !httpguts.ValidHeaderFieldName(name) {
+			return fmt.Errorf("invalid part header name %q", name)
+		}
+		name = textproto.CanonicalMIMEHeaderKey(name)
+		if name == "Content-Type" {
+			return errors.New("the part Content-Type must be passed as contentType")
+		}
+		for _, v := range values {
+			if !httpguts.ValidHeaderFieldValue(v) {
+				return fmt.Errorf("invalid value for part header %q", name)
+			}
+			h.Add(name, v)
+		}
+	}
+	h.Set("Content-Type", contentType)
+	m.parts = append(m.parts, multipartPart{header: h, body: body})
+	return nil
+}
+
+func writeMultipart(rw http.ResponseWriter, m *MultipartResponse) error {
+	mw := multipart.NewWriter(rw)
+	// Boundaries are random, so a collision is unlikely, but a part containing
+	// the boundary would allow it to end itself early and inject other parts.
+	for m.containsBoundary(mw.Boundary()) {
+		mw = multipart.NewWriter(rw)
+	}
+	rw.Header().Set("Content-Type", mime.FormatMediaType("multipart/mixed", map[string]string{"boundary": mw.Boundary()}))
+	for _, p := range m.parts {
+		pw, err := mw.CreatePart(p.header)
+		if err != nil {
+			return err
+		}
+		if _, err := pw.Write(p.body); err != nil {
+			return err
+		}
+	}
+	return mw.Close()
+}
+
+func (m *MultipartResponse) containsBoundary(boundary string) bool {
+	delim := []byte("--" + boundary)
+	for _, p := range m.parts {
+		if bytes.Contains(p.body, delim) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,129 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package safehttp_test
+
+import (
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-safeweb/safehttp"
+)
+
+type multipartPart struct {
+	ContentType string
+	Disposition string
+	Body        string
+}
+
+func readMultipart(t *testing.T, rw *httptest.ResponseRecorder) []multipartPart {
+	t.Helper()
+	mt, params, err := mime.ParseMediaType(rw.Header().Get("Content-Type"))
+	if err != nil {
+		t.Fatalf("mime.ParseMediaType() got err: %v", err)
+	}
+	if want := "multipart/mixed"; mt != want {
+		t.Errorf("media type: got %q, want %q", mt, want)
+	}
+	mr := multipart.NewReader(rw.Body, params["boundary"])
+	var parts []multipartPart
+	for {
+		p, err := mr.NextPart()
+		if err != nil {
+			break
+		}
+		b, err := ioutil.ReadAll(p)
+		if err != nil {
+			t.Fatalf("ioutil.ReadAll(part) got err: %v", err)
+		}
+		parts = append(parts, multipartPart{
+			ContentType: p.Header.Get("Content-Type"),
+			Disposition: p.Header.Get("Content-Disposition"),
+			Body:        string(b),
+		})
+	}
+	return parts
+}
+
+func TestMultipartResponse(t *testing.T) {
+	m := safehttp.NewMultipartResponse()
+	if err := m.AddPart("application/json", nil, []byte(`{"a":1}`)); err != nil {
+		t.Fatalf("m.AddPart() got err: %v", err)
+	}
+	h := map[string][]string{"content-disposition": {`attachment; filename="a.csv"`}}
+	if err := m.AddPart("text/csv", h, []byte("a,b\n1,2\n")); err != nil {
+		t.Fatalf("m.AddPart() got err: %v", err)
+	}
+
+	rw := httptest.NewRecorder()
+	if err := (safehttp.DefaultDispatcher{}).Write(rw, m); err != nil {
+		t.Fatalf("Write() got err: %v", err)
+	}
+
+	want := []multipartPart{
+		{ContentType: "application/json", Body: `{"a":1}`},
+		{ContentType: "text/csv", Disposition: `attachment; filename="a.csv"`, Body: "a,b\n1,2\n"},
+	}
+	if diff := cmp.Diff(want, readMultipart(t, rw)); diff != "" {
+		t.Errorf("parts mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestMultipartResponseInvalidPart(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		header      map[string][]string
+	}{
+		{
+			name:        "Invalid Content-Type",
+			contentType: "text/",
+		},
+		{
+			name:        "Content-Type in header",
+			contentType: "text/plain",
+			header:      map[string][]string{"Content-Type": {"text/html"}},
+		},
+		{
+			name:        "Invalid header name",
+			contentType: "text/plain",
+			header:      map[string][]string{"X-Foo:": {"bar"}},
+		},
+		{
+			name:        "Newline in header value",
+			contentType: "text/plain",
+			header:      map[string][]string{"X-Foo": {"bar\r\n\r\n--boundary"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := safehttp.NewMultipartResponse()
+			if err := m.AddPart(tt.contentType, tt.header, nil); err == nil {
+				t.Error("m.AddPart() got nil err, want error")
+			}
+
+			rw := httptest.NewRecorder()
+			if err := (safehttp.DefaultDispatcher{}).Write(rw, m); err != nil {
+				t.Fatalf("Write() got err: %v", err)
+			}
+			if got := readMultipart(t, rw); len(got) != 0 {
+				t.Errorf("parts: got %v, want none", got)
+			}
+		})
+	}
+}
@@ -15,9 +15,13 @@
 package safehttp
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net/http"
+	"runtime/pprof"
+	"sort"
+	"strings"
 )
 
 // The HTTP request methods defined by RFC.
@@ -61,6 +65,13 @@ const (
 // and "codesearch.google.com/" without also taking over requests for
 // "http://www.google.com/".
 //
+// Path segments of patterns can be parameters, written as a name between
+// braces, e.g. "/users/{id}/posts/{postID}". A parameter matches any non-empty
+// segment, and its unescaped value is returned by IncomingRequest.PathValue.
+// Static segments take precedence over parameters, so "/users/me" is matched
+// before "/users/{id}". A pattern with parameters ending in a slash names a
+// rooted subtree, e.g. "/files/{id}/" matches "/files/42/a/b".
+//
 // ServeMux also takes care of sanitizing the URL request path and the Host
 // header, stripping the port number and redirecting any request containing . or
 // .. elements or repeated slashes to an equivalent, cleaner URL.
@@ -70,10 +81,17 @@ const (
 type ServeMux struct {
 	mux      *http.ServeMux
 	handlers map[string]*registeredHandler
+	prefixes map[string]*prefixRoutes
 
 	dispatcher       Dispatcher
 	interceptors     []Interceptor
+	groups           []*RouteGroup
 	methodNotAllowed handlerConfig
+	notWritten       notWrittenConfig
+	doubleWrite      doubleWriteConfig
+	leaks            func(*IncomingRequest, error)
+	compression      *compressionConfig
+	proxies          *TrustedProxies
 }
 
 // ServeHTTP dispatches the request to the handler whose method matches the
@@ -90,13 +108,16 @@ type ServeMux struct {
 //  - [Dispatcher Phase] after the [Commit Phase], the Dispatcher's appropriate
 //    write method is called; the Dispatcher is responsible for determining whether
 //    the response is indeed safe and writing it,
-//  - if the handler attempts to write more than once, it is treated as an
-//    unrecoverable error; the request processing ends abrubptly with a panic and
-//    nothing else happens (note: this will change as soon as [After Phase] is
-//    introduced)
+//  - if the handler attempts to write more than once, by default it is treated
+//    as an unrecoverable error; the request processing ends abrubptly with a
+//    panic and nothing else happens (see ServeMuxConfig.HandleDoubleWrite to
+//    change this behavior)
 //
 // Interceptors should NOT rely on the order they're run.
 func (m *ServeMux) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if m.proxies != nil {
+		r = r.WithContext(context.WithValue(r.Context(), trustedProxiesCtxKey{}, m.proxies))
+	}
 	m.mux.ServeHTTP(w, r)
 }
 
@@ -107,30 +128,120 @@ func (m *ServeMux) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 // interceptors on a registered handler. Passing an InterceptorConfig whose
 // corresponding Interceptor was not installed will produce no effect. If
 // multiple configurations are passed for the same Interceptor, Mux will panic.
+//
+// A RouteInfo can be passed along with the InterceptorConfigs to document the
+// route.
 func (m *ServeMux) Handle(pattern string, method string, h Handler, cfgs ...InterceptorConfig) {
 	if m.handlers[pattern] == nil {
 		m.handlers[pattern] = &registeredHandler{
 			pattern:          pattern,
 			methodNotAllowed: m.methodNotAllowed,
 			methods:          make(map[string]handlerConfig),
+			info:             make(map[string]RouteInfo),
 		}
-		m.mux.Handle(pattern, m.handlers[pattern])
+		m.register(pattern, m.handlers[pattern])
 	}
+	its, merged := groupConfig(m.groups, m.interceptors, pattern, cfgs)
+	info, merged := routeInfo(cfgs, merged)
 	m.handlers[pattern].handleMethod(method,
 		handlerConfig{
 			Dispatcher:   m.dispatcher,
 			Handler:      h,
-			Interceptors: configureInterceptors(m.interceptors, cfgs),
+			Interceptors: configureInterceptors(its, merged),
+			NotWritten:   m.notWritten,
+			DoubleWrite:  m.doubleWrite,
+			Leaks:        m.leaks,
+			Compression:  m.compression,
 		})
+	m.handlers[pattern].info[method] = info
+}
+
+// Route is a handler registered on a ServeMux.
+type Route struct {
+	// Pattern is the pattern the handler was registered for.
+	Pattern string
+	// Method is the method the handler was registered for.
+	Method string
+	// Interceptors are the interceptors run for the handler, including the
+	// ones of its RouteGroups, in order.
+	Interceptors []Interceptor
+	// Configs are the InterceptorConfigs of the handler matched by an
+	// installed interceptor, e.g. policy overrides, in the order the
+	// interceptors are installed.
+	Configs []InterceptorConfig
+	// Info documents the route, if a RouteInfo was passed to Handle or to a
+	// RouteGroup of the route.
+	Info RouteInfo
+}
+
+// Routes returns the handlers registered on the ServeMux, sorted by pattern
+// and method.
+func (m *ServeMux) Routes() []Route {
+	var routes []Route
+	for pattern, rh := range m.handlers {
+		for method, cfg := range rh.methods {
+			r := newRoute(pattern, method, cfg)
+			r.Info = rh.info[method]
+			routes = append(routes, r)
+		}
+	}
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Pattern != routes[j].Pattern {
+			return routes[i].Pattern < routes[j].Pattern
+		}
+		return routes[i].Method < routes[j].Method
+	})
+	return routes
+}
+
+func newRoute(pattern, method string, cfg handlerConfig) Route {
+	r := Route{Pattern: pattern, Method: method}
+	for _, it := range cfg.Interceptors {
+		r.Interceptors = append(r.Interceptors, it.interceptor)
+		if it.config != nil {
+			r.Configs = append(r.Configs, it.config)
+		}
+	}
+	return r
+}
+
+// register registers a new pattern on the underlying http.ServeMux. Patterns
+// with parameters are registered through the static prefix preceding their
+// first parameter, which selects the most specific of them matching the
+// request.
+func (m *ServeMux) register(pattern string, rh *registeredHandler) {
+	p, hasParams := parsePattern(pattern)
+	prefix := pattern
+	if hasParams {
+		prefix = p.prefix
+	}
+	pr, ok := m.prefixes[prefix]
+	if !ok {
+		pr = newPrefixRoutes(prefix)
+		m.prefixes[prefix] = pr
+		m.mux.Handle(prefix, pr)
+	}
+	if hasParams {
+		pr.add(p, rh)
+	} else {
+		pr.static = rh
+	}
 }
 
 // ServeMuxConfig is a builder for ServeMux.
 type ServeMuxConfig struct {
 	dispatcher   Dispatcher
 	interceptors []Interceptor
+	groups       []*RouteGroup
 
 	methodNotAllowed     Handler
 	methodNotAllowedCfgs []InterceptorConfig
+
+	notWritten  notWrittenConfig
+	doubleWrite doubleWriteConfig
+	leaks       func(*IncomingRequest, error)
+	compression *compressionConfig
+	proxies     *TrustedProxies
 }
 
 // NewServeMuxConfig crates a ServeMuxConfig with the provided Dispatcher. If
@@ -156,6 +267,86 @@ var defaultMethotNotAllowed = HandlerFunc(func(w ResponseWriter, req *IncomingRe
 	return w.WriteError(StatusMethodNotAllowed)
 })
 
+// NotWrittenPolicy controls what happens when a Handler returns without
+// writing a response, i.e. by returning NotWritten().
+type NotWrittenPolicy int
+
+const (
+	// NotWrittenNoContent writes a 204 No Content response. This is the
+	// default policy.
+	NotWrittenNoContent NotWrittenPolicy = iota
+	// NotWrittenFallback calls the fallback Handler passed to
+	// HandleNotWritten, using the same ResponseWriter. If the fallback doesn't
+	// write a response either, a 204 No Content response is written.
+	NotWrittenFallback
+	// NotWrittenFail panics in dev mode (see UseLocalDev) to make the missing
+	// write visible during development. Outside of dev mode the event is
+	// logged and a 204 No Content response is written.
+	NotWrittenFail
+)
+
+// notWrittenConfig is the NotWrittenPolicy together with its fallback Handler.
+type notWrittenConfig struct {
+	policy   NotWrittenPolicy
+	fallback Handler
+}
+
+// HandleNotWritten sets the policy applied when a handler returns without
+// writing a response. The fallback Handler is required by, and only allowed
+// with, NotWrittenFallback.
+func (s *ServeMuxConfig) HandleNotWritten(p NotWrittenPolicy, fallback Handler) {
+	if (p == NotWrittenFallback) != (fallback != nil) {
+		panic("a fallback Handler must be provided if and only if the policy is NotWrittenFallback")
+	}
+	s.notWritten = notWrittenConfig{policy: p, fallback: fallback}
+}
+
+// DoubleWritePolicy controls what happens when a write method of a
+// ResponseWriter is called after a response has already been written.
+type DoubleWritePolicy int
+
+const (
+	// DoubleWritePanic panics with ErrResponseAlreadyWritten. This is the
+	// default policy.
+	DoubleWritePanic DoubleWritePolicy = iota
+	// DoubleWriteError ignores the write and returns a Result whose Err method
+	// reports ErrResponseAlreadyWritten, so the handler can deal with it.
+	DoubleWriteError
+	// DoubleWriteLax ignores and logs the write. It is meant to be used while
+	// migrating handlers that are known to write more than once.
+	DoubleWriteLax
+)
+
+// doubleWriteConfig is the DoubleWritePolicy together with its reporting
+// function.
+type doubleWriteConfig struct {
+	policy DoubleWritePolicy
+	report func(*IncomingRequest)
+}
+
+// HandleDoubleWrite sets the policy applied when a response is written more
+// than once. If report is not nil, it is called for every such write, before
+// the policy is applied, e.g. to increment a metric.
+func (s *ServeMuxConfig) HandleDoubleWrite(p DoubleWritePolicy, report func(*IncomingRequest)) {
+	s.doubleWrite = doubleWriteConfig{policy: p, report: report}
+}
+
+// DetectLeaks enables a debug facility which checks, at the end of every
+// request, that the request body was consumed or closed and that the temporary
+// files of multipart forms were removed, using MultipartForm.RemoveFiles. Each
+// leak is reported by calling report, e.g. to fail a test. If report is nil,
+// leaks are logged.
+//
+// Tracking leaks has a cost, so this shouldn't be enabled in production.
+func (s *ServeMuxConfig) DetectLeaks(report func(r *IncomingRequest, leak error)) {
+	if report == nil {
+		report = func(r *IncomingRequest, leak error) {
+			log.Printf("leak detected while serving %s %q: %v", r.Method(), r.URL().Path(), leak)
+		}
+	}
+	s.leaks = report
+}
+
 // Intercept installs the given interceptors.
 //
 // Interceptors order is respected and interceptors are always run in the
@@ -163,6 +354,8 @@ var defaultMethotNotAllowed = HandlerFunc(func(w ResponseWriter, req *IncomingRe
 //
 // Calling Intercept multiple times is valid. Interceptors that are added last
 // will run last.
+//
+// To run interceptors only for some of the requests, use InterceptWhen.
 func (s *ServeMuxConfig) Intercept(is ...Interceptor) {
 	s.interceptors = append(s.interceptors, is...)
 }
@@ -184,14 +377,25 @@ func (s *ServeMuxConfig) Mux() *ServeMux {
 		Dispatcher:   s.dispatcher,
 		Handler:      s.methodNotAllowed,
 		Interceptors: configureInterceptors(s.interceptors, s.methodNotAllowedCfgs),
+		NotWritten:   s.notWritten,
+		DoubleWrite:  s.doubleWrite,
+		Leaks:        s.leaks,
+		Compression:  s.compression,
 	}
 
 	m := &ServeMux{
 		mux:              http.NewServeMux(),
 		handlers:         make(map[string]*registeredHandler),
+		prefixes:         make(map[string]*prefixRoutes),
 		dispatcher:       s.dispatcher,
 		interceptors:     s.interceptors,
+		groups:           cloneGroups(s.groups),
 		methodNotAllowed: methodNotAllowed,
+		notWritten:       s.notWritten,
+		doubleWrite:      s.doubleWrite,
+		leaks:            s.leaks,
+		compression:      s.compression,
+		proxies:          s.proxies,
 	}
 	return m
 }
@@ -203,8 +407,14 @@ func (s *ServeMuxConfig) Clone() *ServeMuxConfig {
 	return &ServeMuxConfig{
 		dispatcher:           s.dispatcher,
 		interceptors:         append([]Interceptor(nil), s.interceptors...),
+		groups:               cloneGroups(s.groups),
 		methodNotAllowed:     s.methodNotAllowed,
 		methodNotAllowedCfgs: append([]InterceptorConfig(nil), s.methodNotAllowedCfgs...),
+		notWritten:           s.notWritten,
+		doubleWrite:          s.doubleWrite,
+		leaks:                s.leaks,
+		compression:          s.compression,
+		proxies:              s.proxies,
 	}
 }
 
@@ -212,21 +422,52 @@ type registeredHandler struct {
 	pattern          string
 	methods          map[string]handlerConfig
 	methodNotAllowed handlerConfig
+	// allow is the value of the Allow header of 405 responses.
+	allow string
+	// info holds the RouteInfo of each method.
+	info map[string]RouteInfo
 }
 
+// ServeHTTP processes the request with the handler registered for its method.
+// Requests for other methods are served by the method not allowed handler,
+// with the Allow header listing the registered methods.
+// The request is served with the "pattern" and "method" pprof labels set, so
+// that profiles can be grouped by route. The method label is "" for methods
+// without a registered handler, to keep its cardinality bounded.
 func (rh *registeredHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	cfg, ok := rh.methods[r.Method]
+	method := r.Method
 	if !ok {
 		cfg = rh.methodNotAllowed
+		method = ""
+		// RFC 7231 requires 405 responses to list the allowed methods.
+		w.Header().Set("Allow", rh.allow)
+	} else if sim := simulationFromContext(r.Context()); sim != nil {
+		route := newRoute(rh.pattern, method, cfg)
+		route.Info = rh.info[method]
+		sim.Route = &route
 	}
-	processRequest(cfg, w, r)
+	labels := pprof.Labels("pattern", rh.pattern, "method", method)
+	pprof.Do(r.Context(), labels, func(ctx context.Context) {
+		ctx = context.WithValue(ctx, patternCtxKey{}, rh.pattern)
+		processRequest(cfg, w, r.WithContext(ctx))
+	})
 }
 
+type patternCtxKey struct{}
+
 func (rh *registeredHandler) handleMethod(method string, cfg handlerConfig) {
 	if _, exists := rh.methods[method]; exists {
 		panic(fmt.Sprintf("double registration of (pattern = %q, method = %q)", rh.pattern, method))
 	}
 	rh.methods[method] = cfg
+
+	methods := make([]string, 0, len(rh.methods))
+	for m := range rh.methods {
+		methods = append(methods, m)
+	}
+	sort.Strings(methods)
+	rh.allow = strings.Join(methods, ", ")
 }
 
 func configureInterceptors(interceptors []Interceptor, cfgs []InterceptorConfig) []configuredInterceptor {
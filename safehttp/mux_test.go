@@ -18,6 +18,9 @@ import (
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"regexp"
+	"runtime/pprof"
+	"strings"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
@@ -47,6 +50,7 @@ func TestMuxOneHandlerOneRequest(t *testing.T) {
 			req:        httptest.NewRequest(safehttp.MethodPost, "http://foo.com/", nil),
 			wantStatus: safehttp.StatusMethodNotAllowed,
 			wantHeader: map[string][]string{
+				"Allow":                  {"GET"},
 				"Content-Type":           {"text/plain; charset=utf-8"},
 				"X-Content-Type-Options": {"nosniff"},
 			},
@@ -651,6 +655,68 @@ func TestMuxHandlerReturnsNotWritten(t *testing.T) {
 	}
 }
 
+func TestMuxNotWrittenFallback(t *testing.T) {
+	mb := safehttp.NewServeMuxConfig(nil)
+	mb.HandleNotWritten(safehttp.NotWrittenFallback, safehttp.HandlerFunc(func(w safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+		return w.Write(safehtml.HTMLEscaped("fallback"))
+	}))
+	mux := mb.Mux()
+	mux.Handle("/bar", safehttp.MethodGet, safehttp.HandlerFunc(func(w safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+		return safehttp.NotWritten()
+	}))
+
+	rw := httptest.NewRecorder()
+	mux.ServeHTTP(rw, httptest.NewRequest(safehttp.MethodGet, "http://foo.com/bar", nil))
+
+	if want := safehttp.StatusOK; rw.Code != int(want) {
+		t.Errorf("rw.Code: got %v want %v", rw.Code, want)
+	}
+	if got, want := rw.Body.String(), "fallback"; got != want {
+		t.Errorf("response body: got %q want %q", got, want)
+	}
+}
+
+func TestMuxNotWrittenFailOutsideDevMode(t *testing.T) {
+	mb := safehttp.NewServeMuxConfig(nil)
+	mb.HandleNotWritten(safehttp.NotWrittenFail, nil)
+	mux := mb.Mux()
+	mux.Handle("/bar", safehttp.MethodGet, safehttp.HandlerFunc(func(w safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+		return safehttp.NotWritten()
+	}))
+
+	rw := httptest.NewRecorder()
+	mux.ServeHTTP(rw, httptest.NewRequest(safehttp.MethodGet, "http://foo.com/bar", nil))
+
+	if want := safehttp.StatusNoContent; rw.Code != int(want) {
+		t.Errorf("rw.Code: got %v want %v", rw.Code, want)
+	}
+}
+
+func TestMuxHandleNotWrittenInvalidFallback(t *testing.T) {
+	h := safehttp.HandlerFunc(func(w safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+		return safehttp.NotWritten()
+	})
+	tests := []struct {
+		name     string
+		policy   safehttp.NotWrittenPolicy
+		fallback safehttp.Handler
+	}{
+		{name: "Fallback without handler", policy: safehttp.NotWrittenFallback},
+		{name: "NoContent with handler", policy: safehttp.NotWrittenNoContent, fallback: h},
+		{name: "Fail with handler", policy: safehttp.NotWrittenFail, fallback: h},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				if r := recover(); r == nil {
+					t.Error("HandleNotWritten: expected panic")
+				}
+			}()
+			safehttp.NewServeMuxConfig(nil).HandleNotWritten(tt.policy, tt.fallback)
+		})
+	}
+}
+
 func TestMuxMethodNotAllowedDefaults(t *testing.T) {
 	mb := safehttp.NewServeMuxConfig(nil)
 	mux := mb.Mux()
@@ -669,6 +735,7 @@ func TestMuxMethodNotAllowedDefaults(t *testing.T) {
 	}
 
 	wantHeader := map[string][]string{
+		"Allow":                  {"GET"},
 		"Content-Type":           {"text/plain; charset=utf-8"},
 		"X-Content-Type-Options": {"nosniff"},
 	}
@@ -748,6 +815,7 @@ func TestMuxMethodNotAllowedCustom(t *testing.T) {
 	}
 
 	wantHeader := map[string][]string{
+		"Allow":              {"GET"},
 		"Content-Type":       {"text/html; charset=utf-8"},
 		"Before-Interceptor": {"foo"},
 		"Commit-Interceptor": {"bar"},
@@ -761,3 +829,280 @@ func TestMuxMethodNotAllowedCustom(t *testing.T) {
 		t.Errorf("response body: got %q want %q", got, wantBody)
 	}
 }
+
+func TestMuxMethodNotAllowedAllowHeader(t *testing.T) {
+	mux := safehttp.NewServeMuxConfig(nil).Mux()
+	h := safehttp.HandlerFunc(func(w safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+		return w.Write(safehtml.HTMLEscaped("ok"))
+	})
+	mux.Handle("/items/{id}", safehttp.MethodPut, h)
+	mux.Handle("/items/{id}", safehttp.MethodGet, h)
+	mux.Handle("/items/{id}", safehttp.MethodDelete, h)
+
+	rw := httptest.NewRecorder()
+	mux.ServeHTTP(rw, httptest.NewRequest(safehttp.MethodPost, "http://foo.com/items/1", nil))
+
+	if got, want := rw.Code, int(safehttp.StatusMethodNotAllowed); got != want {
+		t.Errorf("rw.Code: got %v want %v", got, want)
+	}
+	if got, want := rw.Header().Get("Allow"), "DELETE, GET, PUT"; got != want {
+		t.Errorf("Allow header: got %q want %q", got, want)
+	}
+}
+
+func TestMuxProfilingLabels(t *testing.T) {
+	mux := safehttp.NewServeMuxConfig(nil).Mux()
+	var pattern, method string
+	mux.Handle("/items/", safehttp.MethodGet, safehttp.HandlerFunc(func(w safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+		pattern, _ = pprof.Label(r.Context(), "pattern")
+		method, _ = pprof.Label(r.Context(), "method")
+		return w.Write(safehtml.HTMLEscaped("ok"))
+	}))
+
+	rw := httptest.NewRecorder()
+	mux.ServeHTTP(rw, httptest.NewRequest(safehttp.MethodGet, "http://foo.com/items/42", nil))
+
+	if want := "/items/"; pattern != want {
+		t.Errorf(`pprof.Label("pattern"): got %q want %q`, pattern, want)
+	}
+	if want := safehttp.MethodGet; method != want {
+		t.Errorf(`pprof.Label("method"): got %q want %q`, method, want)
+	}
+}
+
+func TestMuxPattern(t *testing.T) {
+	mux := safehttp.NewServeMuxConfig(nil).Mux()
+	var pattern string
+	mux.Handle("/users/{id}", safehttp.MethodGet, safehttp.HandlerFunc(func(w safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+		pattern = r.Pattern()
+		return w.Write(safehtml.HTMLEscaped("ok"))
+	}))
+
+	rw := httptest.NewRecorder()
+	mux.ServeHTTP(rw, httptest.NewRequest(safehttp.MethodGet, "http://foo.com/users/42", nil))
+
+	if want := "/users/{id}"; pattern != want {
+		t.Errorf("r.Pattern(): got %q want %q", pattern, want)
+	}
+}
+
+func TestMuxRoutes(t *testing.T) {
+	mb := safehttp.NewServeMuxConfig(nil)
+	mb.Intercept(setHeaderConfigInterceptor{})
+	mux := mb.Mux()
+	h := safehttp.HandlerFunc(func(w safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+		return w.Write(safehtml.HTMLEscaped("ok"))
+	})
+	mux.Handle("/b", safehttp.MethodPost, h)
+	mux.Handle("/b", safehttp.MethodGet, h, setHeaderConfig{name: "a", value: "b"})
+	mux.Handle("/a", safehttp.MethodGet, h)
+
+	its := []safehttp.Interceptor{setHeaderConfigInterceptor{}}
+	want := []safehttp.Route{
+		{Pattern: "/a", Method: safehttp.MethodGet, Interceptors: its},
+		{Pattern: "/b", Method: safehttp.MethodGet, Interceptors: its, Configs: []safehttp.InterceptorConfig{setHeaderConfig{name: "a", value: "b"}}},
+		{Pattern: "/b", Method: safehttp.MethodPost, Interceptors: its},
+	}
+	if diff := cmp.Diff(want, mux.Routes(), cmp.AllowUnexported(setHeaderConfig{})); diff != "" {
+		t.Errorf("mux.Routes() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestMuxDetectLeaks(t *testing.T) {
+	fileBody := "--123\r\n" +
+		"Content-Disposition: form-data; name=\"file\"; filename=\"a.txt\"\r\n" +
+		"Content-Type: text/plain\r\n" +
+		"\r\n" +
+		"file content\r\n" +
+		"--123--\r\n"
+
+	tests := []struct {
+		name      string
+		req       func() *http.Request
+		handler   safehttp.HandlerFunc
+		wantLeaks int
+	}{
+		{
+			name: "No body",
+			req: func() *http.Request {
+				return httptest.NewRequest(safehttp.MethodPost, "http://foo.com/", nil)
+			},
+			handler: func(w safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+				return w.Write(safehtml.HTMLEscaped("ok"))
+			},
+		},
+		{
+			name: "Body consumed",
+			req: func() *http.Request {
+				return httptest.NewRequest(safehttp.MethodPost, "http://foo.com/", strings.NewReader("body"))
+			},
+			handler: func(w safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+				io.Copy(io.Discard, r.Body())
+				return w.Write(safehtml.HTMLEscaped("ok"))
+			},
+		},
+		{
+			name: "Body ignored",
+			req: func() *http.Request {
+				return httptest.NewRequest(safehttp.MethodPost, "http://foo.com/", strings.NewReader("body"))
+			},
+			handler: func(w safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+				return w.Write(safehtml.HTMLEscaped("ok"))
+			},
+			wantLeaks: 1,
+		},
+		{
+			name: "Multipart files removed",
+			req: func() *http.Request {
+				req := httptest.NewRequest(safehttp.MethodPost, "http://foo.com/", strings.NewReader(fileBody))
+				req.Header.Set("Content-Type", `multipart/form-data; boundary="123"`)
+				return req
+			},
+			handler: func(w safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+				mf, err := r.MultipartForm(0)
+				if err != nil {
+					return w.WriteError(safehttp.StatusBadRequest)
+				}
+				if err := mf.RemoveFiles(); err != nil {
+					return w.WriteError(safehttp.StatusInternalServerError)
+				}
+				return w.Write(safehtml.HTMLEscaped("ok"))
+			},
+		},
+		{
+			name: "Multipart files not removed",
+			req: func() *http.Request {
+				req := httptest.NewRequest(safehttp.MethodPost, "http://foo.com/", strings.NewReader(fileBody))
+				req.Header.Set("Content-Type", `multipart/form-data; boundary="123"`)
+				return req
+			},
+			handler: func(w safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+				if _, err := r.MultipartForm(0); err != nil {
+					return w.WriteError(safehttp.StatusBadRequest)
+				}
+				return w.Write(safehtml.HTMLEscaped("ok"))
+			},
+			wantLeaks: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var leaks []error
+			mb := safehttp.NewServeMuxConfig(nil)
+			mb.DetectLeaks(func(r *safehttp.IncomingRequest, leak error) {
+				leaks = append(leaks, leak)
+			})
+			mux := mb.Mux()
+			mux.Handle("/", safehttp.MethodPost, tt.handler)
+
+			req := tt.req()
+			mux.ServeHTTP(httptest.NewRecorder(), req)
+			if len(leaks) != tt.wantLeaks {
+				t.Errorf("leaks: got %v, want %d", leaks, tt.wantLeaks)
+			}
+			if req.MultipartForm != nil {
+				req.MultipartForm.RemoveAll()
+			}
+		})
+	}
+}
+
+func TestMuxPathParameters(t *testing.T) {
+	mux := safehttp.NewServeMuxConfig(nil).Mux()
+	handle := func(pattern string, params ...string) {
+		mux.Handle(pattern, safehttp.MethodGet, safehttp.HandlerFunc(func(w safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+			got := pattern
+			for _, p := range params {
+				got += " " + p + "=" + r.PathValue(p)
+			}
+			return w.Write(safehtml.HTMLEscaped(got))
+		}))
+	}
+	handle("/users/{id}", "id")
+	handle("/users/me")
+	handle("/users/{id}/posts/{postID}", "id", "postID")
+	handle("/users/")
+	handle("/files/{id}/", "id")
+
+	tests := []struct {
+		target     string
+		wantStatus safehttp.StatusCode
+		wantBody   string
+	}{
+		{target: "/users/42", wantStatus: safehttp.StatusOK, wantBody: "/users/{id} id=42"},
+		{target: "/users/me", wantStatus: safehttp.StatusOK, wantBody: "/users/me"},
+		{target: "/users/42/posts/a%2Fb", wantStatus: safehttp.StatusOK, wantBody: "/users/{id}/posts/{postID} id=42 postID=a/b"},
+		{target: "/users/42/comments", wantStatus: safehttp.StatusOK, wantBody: "/users/"},
+		{target: "/users/", wantStatus: safehttp.StatusOK, wantBody: "/users/"},
+		{target: "/files/7/a/b", wantStatus: safehttp.StatusOK, wantBody: "/files/{id}/ id=7"},
+		{target: "/files/7", wantStatus: safehttp.StatusNotFound, wantBody: "404 page not found\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			rw := httptest.NewRecorder()
+			mux.ServeHTTP(rw, httptest.NewRequest(safehttp.MethodGet, "http://foo.com"+tt.target, nil))
+
+			if rw.Code != int(tt.wantStatus) {
+				t.Errorf("rw.Code: got %v want %v", rw.Code, tt.wantStatus)
+			}
+			if got := rw.Body.String(); got != tt.wantBody {
+				t.Errorf("response body: got %q want %q", got, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestMuxPathParametersValidation(t *testing.T) {
+	mux := safehttp.NewServeMuxConfig(nil).Mux()
+	var id int64
+	var idErr, slugErr error
+	mux.Handle("/posts/{id}/{slug}", safehttp.MethodGet, safehttp.HandlerFunc(func(w safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+		id, idErr = r.PathInt64("id")
+		_, slugErr = r.PathMatch("slug", regexp.MustCompile(`^[a-z-]+$`))
+		return w.Write(safehtml.HTMLEscaped("ok"))
+	}))
+
+	mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(safehttp.MethodGet, "http://foo.com/posts/12/hello-world", nil))
+	if idErr != nil || id != 12 {
+		t.Errorf(`r.PathInt64("id"): got (%v, %v), want (12, nil)`, id, idErr)
+	}
+	if slugErr != nil {
+		t.Errorf(`r.PathMatch("slug"): got err %v, want nil`, slugErr)
+	}
+
+	mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(safehttp.MethodGet, "http://foo.com/posts/twelve/Hello", nil))
+	if idErr == nil {
+		t.Error(`r.PathInt64("id") for "twelve": got nil err, want error`)
+	}
+	if slugErr == nil {
+		t.Error(`r.PathMatch("slug") for "Hello": got nil err, want error`)
+	}
+}
+
+func TestMuxInvalidPatterns(t *testing.T) {
+	h := safehttp.HandlerFunc(func(w safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+		return w.Write(safehtml.HTMLEscaped("ok"))
+	})
+	tests := []struct {
+		name     string
+		patterns []string
+	}{
+		{name: "Partial segment", patterns: []string{"/users/id-{id}"}},
+		{name: "Empty name", patterns: []string{"/users/{}"}},
+		{name: "Duplicate name", patterns: []string{"/users/{id}/{id}"}},
+		{name: "Equivalent patterns", patterns: []string{"/users/{id}", "/users/{name}"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mux := safehttp.NewServeMuxConfig(nil).Mux()
+			defer func() {
+				if r := recover(); r == nil {
+					t.Errorf("mux.Handle(%v) expected panic", tt.patterns)
+				}
+			}()
+			for _, p := range tt.patterns {
+				mux.Handle(p, safehttp.MethodGet, h)
+			}
+		})
+	}
+}
@@ -0,0 +1,134 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package safehttp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"time"
+)
+
+// NDJSONResponse streams values as newline-delimited JSON, one JSON object
+// per line, with the application/x-ndjson Content-Type.
+//
+// Only JSON objects can be streamed: other values, such as arrays, would be
+// valid JavaScript and could be included cross-origin (XSSI).
+type NDJSONResponse struct {
+	// Stream produces the values of the response, passing each of them to
+	// emit. Stream should stop and return the error if emit fails, which
+	// happens when a value is not a JSON object or the client went away.
+	Stream func(emit func(v interface{}) error) error
+	// FlushInterval is the minimum time between flushes of the written lines
+	// to the client. If zero, every line is flushed as soon as it's written.
+	FlushInterval time.Duration
+}
+
+func writeNDJSON(rw http.ResponseWriter, resp NDJSONResponse) error {
+	rw.Header().Set("Content-Type", "application/x-ndjson")
+	flusher, _ := rw.(http.Flusher)
+	var lastFlush time.Time
+	emit := func(v interface{}) error {
+		b, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		if len(b) == 0 || b[0] != '{' {
+			return fmt.Errorf("%w: NDJSON values must be JSON objects, got %T", ErrUnsupportedResponseType, v)
+		}
+		if _, err := rw.Write(append(b, '\n')); err != nil {
+			return err
+		}
+		if flusher != nil && time.Since(lastFlush) >= resp.FlushInterval {
+			flusher.Flush()
+			lastFlush = time.Now()
+		}
+		return nil
+	}
+	if err := resp.Stream(emit); err != nil {
+		return err
+	}
+	if flusher != nil {
+		flusher.Flush()
+	}
+	return nil
+}
+
+// NDJSONDecoder decodes the lines of a newline-delimited JSON request body.
+type NDJSONDecoder struct {
+	sc  *bufio.Scanner
+	err error
+}
+
+// NDJSONBody returns a decoder for the newline-delimited JSON body of a POST,
+// PATCH or PUT request, whose Content-Type must be application/x-ndjson.
+// Lines longer than maxLineBytes make the decoding fail with an error
+// wrapping ErrBodyTooLarge.
+func (r *IncomingRequest) NDJSONBody(maxLineBytes int) (*NDJSONDecoder, error) {
+	if m := r.req.Method; m != MethodPost && m != MethodPatch && m != MethodPut {
+		return nil, fmt.Errorf("got request method %s, want POST/PATCH/PUT", m)
+	}
+	if ct, _, err := mime.ParseMediaType(r.req.Header.Get("Content-Type")); err != nil || ct != "application/x-ndjson" {
+		return nil, fmt.Errorf("invalid method called for Content-Type: %s", r.req.Header.Get("Content-Type"))
+	}
+	sc := bufio.NewScanner(r.req.Body)
+	// The scanner needs room for the line terminator, and uses the capacity of
+	// the initial buffer as maximum if it's larger.
+	max := maxLineBytes + 2
+	size := 4096
+	if size > max {
+		size = max
+	}
+	sc.Buffer(make([]byte, 0, size), max)
+	return &NDJSONDecoder{sc: sc}, nil
+}
+
+// Next decodes the next line into v, skipping empty lines. It returns false
+// when there are no more lines or an error occurred, which can be retrieved
+// using Err.
+func (d *NDJSONDecoder) Next(v interface{}) bool {
+	if d.err != nil {
+		return false
+	}
+	for d.sc.Scan() {
+		line := bytes.TrimSpace(d.sc.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		if err := json.Unmarshal(line, v); err != nil {
+			d.err = err
+			return false
+		}
+		return true
+	}
+	d.err = d.sc.Err()
+	if errors.Is(d.err, bufio.ErrTooLong) {
+		d.err = fmt.Errorf("%w: NDJSON line too long", ErrBodyTooLarge)
+	}
+	return false
+}
+
+// Err returns the first error that occurred while decoding, if any.
+func (d *NDJSONDecoder) Err() error {
+	if d.err == io.EOF {
+		return nil
+	}
+	return d.err
+}
@@ -0,0 +1,124 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package safehttp_test
+
+import (
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-safeweb/safehttp"
+	"github.com/google/go-safeweb/safehttp/safehttptest"
+)
+
+type logLine struct {
+	Msg string `json:"msg"`
+}
+
+func TestNDJSONResponse(t *testing.T) {
+	rw := httptest.NewRecorder()
+	resp := safehttp.NDJSONResponse{Stream: func(emit func(interface{}) error) error {
+		for _, m := range []string{"a", "b"} {
+			if err := emit(logLine{Msg: m}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}}
+	if err := (safehttp.DefaultDispatcher{}).Write(rw, resp); err != nil {
+		t.Fatalf("Write() got err: %v", err)
+	}
+
+	if got, want := rw.Header().Get("Content-Type"), "application/x-ndjson"; got != want {
+		t.Errorf("Content-Type: got %q, want %q", got, want)
+	}
+	if got, want := rw.Body.String(), "{\"msg\":\"a\"}\n{\"msg\":\"b\"}\n"; got != want {
+		t.Errorf("body: got %q, want %q", got, want)
+	}
+	if !rw.Flushed {
+		t.Error("rw.Flushed = false, want true")
+	}
+}
+
+func TestNDJSONResponseNotObject(t *testing.T) {
+	rw := httptest.NewRecorder()
+	resp := safehttp.NDJSONResponse{Stream: func(emit func(interface{}) error) error {
+		return emit([]string{"secret"})
+	}}
+	err := (safehttp.DefaultDispatcher{}).Write(rw, resp)
+	if !errors.Is(err, safehttp.ErrUnsupportedResponseType) {
+		t.Errorf("Write() got err: %v, want %v", err, safehttp.ErrUnsupportedResponseType)
+	}
+	if got := rw.Body.String(); got != "" {
+		t.Errorf("body: got %q, want empty", got)
+	}
+}
+
+func newNDJSONRequest(body string) *safehttp.IncomingRequest {
+	r := safehttptest.NewRequest(safehttp.MethodPost, "/", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/x-ndjson")
+	return r
+}
+
+func TestNDJSONBody(t *testing.T) {
+	d, err := newNDJSONRequest("{\"msg\":\"a\"}\n\n{\"msg\":\"b\"}").NDJSONBody(100)
+	if err != nil {
+		t.Fatalf("NDJSONBody() got err: %v", err)
+	}
+	var got []logLine
+	var l logLine
+	for d.Next(&l) {
+		got = append(got, l)
+	}
+	if err := d.Err(); err != nil {
+		t.Errorf("d.Err() = %v, want nil", err)
+	}
+	want := []logLine{{Msg: "a"}, {Msg: "b"}}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("decoded lines mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestNDJSONBodyErrors(t *testing.T) {
+	d, err := newNDJSONRequest("{\"msg\":\"" + strings.Repeat("a", 100) + "\"}\n").NDJSONBody(50)
+	if err != nil {
+		t.Fatalf("NDJSONBody() got err: %v", err)
+	}
+	var l logLine
+	if d.Next(&l) {
+		t.Error("d.Next() = true for a line too long, want false")
+	}
+	if err := d.Err(); !errors.Is(err, safehttp.ErrBodyTooLarge) {
+		t.Errorf("d.Err() = %v, want %v", err, safehttp.ErrBodyTooLarge)
+	}
+
+	d, err = newNDJSONRequest("{\"msg\":\"a\"}\nnot json\n").NDJSONBody(100)
+	if err != nil {
+		t.Fatalf("NDJSONBody() got err: %v", err)
+	}
+	for d.Next(&l) {
+	}
+	if d.Err() == nil {
+		t.Error("d.Err() = nil for invalid JSON, want error")
+	}
+
+	r := newNDJSONRequest("{}")
+	r.Header.Set("Content-Type", "application/json")
+	if _, err := r.NDJSONBody(100); err == nil {
+		t.Error("NDJSONBody() with the wrong Content-Type got nil err, want error")
+	}
+}
@@ -0,0 +1,198 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package safehttp
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// routePattern is a pattern whose path contains parameters, e.g.
+// "/users/{id}/posts/{postID}".
+type routePattern struct {
+	// prefix is the part of the pattern before the first parameter, including
+	// the host if any, e.g. "/users/". It's registered on the http.ServeMux.
+	prefix string
+	// segments are the path segments following the prefix. Parameters are
+	// stored as their name, with param set.
+	segments []patternSegment
+	// subtree is true if the pattern ends with a slash, in which case it
+	// matches any path starting with it, like a rooted subtree.
+	subtree bool
+}
+
+type patternSegment struct {
+	value string
+	param bool
+}
+
+// parsePattern parses a pattern with parameters. It returns false if the
+// pattern has no parameters and panics on invalid ones.
+func parsePattern(pattern string) (routePattern, bool) {
+	if !strings.Contains(pattern, "{") {
+		return routePattern{}, false
+	}
+	i := strings.Index(pattern, "/")
+	if i < 0 {
+		panic(fmt.Sprintf("invalid pattern %q: missing path", pattern))
+	}
+	host, path := pattern[:i], pattern[i:]
+
+	var p routePattern
+	path, p.subtree = strings.TrimSuffix(path, "/"), strings.HasSuffix(path, "/")
+	seen := map[string]bool{}
+	static := true
+	prefix := host + "/"
+	for _, seg := range strings.Split(path[1:], "/") {
+		if !strings.HasPrefix(seg, "{") {
+			if strings.ContainsAny(seg, "{}") {
+				panic(fmt.Sprintf("invalid pattern %q: parameters must be whole segments", pattern))
+			}
+			if static {
+				prefix += seg + "/"
+				continue
+			}
+			p.segments = append(p.segments, patternSegment{value: seg})
+			continue
+		}
+		name := strings.TrimSuffix(strings.TrimPrefix(seg, "{"), "}")
+		if !strings.HasSuffix(seg, "}") || name == "" || strings.ContainsAny(name, "{}") {
+			panic(fmt.Sprintf("invalid pattern %q: invalid parameter %q", pattern, seg))
+		}
+		if seen[name] {
+			panic(fmt.Sprintf("invalid pattern %q: duplicate parameter %q", pattern, name))
+		}
+		seen[name] = true
+		static = false
+		p.segments = append(p.segments, patternSegment{value: name, param: true})
+	}
+	p.prefix = prefix
+	return p, true
+}
+
+// match matches the segments of the escaped path following the prefix,
+// returning the unescaped parameter values.
+func (p routePattern) match(rest []string) (map[string]string, bool) {
+	if len(rest) < len(p.segments) || (!p.subtree && len(rest) > len(p.segments)) {
+		return nil, false
+	}
+	if p.subtree && len(rest) == len(p.segments) {
+		// The path must include the trailing slash.
+		return nil, false
+	}
+	values := map[string]string{}
+	for i, seg := range p.segments {
+		v, err := url.PathUnescape(rest[i])
+		if err != nil {
+			return nil, false
+		}
+		if !seg.param {
+			if v != seg.value {
+				return nil, false
+			}
+			continue
+		}
+		if v == "" {
+			return nil, false
+		}
+		values[seg.value] = v
+	}
+	return values, true
+}
+
+// moreSpecific reports whether p takes precedence over o: static segments win
+// over parameters, then longer patterns win over shorter ones.
+func (p routePattern) moreSpecific(o routePattern) bool {
+	for i := 0; i < len(p.segments) && i < len(o.segments); i++ {
+		if p.segments[i].param != o.segments[i].param {
+			return !p.segments[i].param
+		}
+	}
+	if len(p.segments) != len(o.segments) {
+		return len(p.segments) > len(o.segments)
+	}
+	return !p.subtree && o.subtree
+}
+
+// equivalent reports whether p and o match the same paths, i.e. only differ by
+// the names of their parameters.
+func (p routePattern) equivalent(o routePattern) bool {
+	if len(p.segments) != len(o.segments) || p.subtree != o.subtree {
+		return false
+	}
+	for i, seg := range p.segments {
+		if seg.param != o.segments[i].param || (!seg.param && seg.value != o.segments[i].value) {
+			return false
+		}
+	}
+	return true
+}
+
+type paramRoute struct {
+	pattern routePattern
+	handler *registeredHandler
+}
+
+// prefixRoutes is the http.Handler registered on the http.ServeMux for a
+// pattern prefix. It serves the requests with the most specific matching
+// pattern, falling back to the handler registered for the prefix itself.
+type prefixRoutes struct {
+	// path is the path of the prefix, without the host.
+	path   string
+	routes []paramRoute
+	static *registeredHandler
+}
+
+func newPrefixRoutes(prefix string) *prefixRoutes {
+	path := prefix
+	if i := strings.Index(prefix, "/"); i >= 0 {
+		path = prefix[i:]
+	}
+	return &prefixRoutes{path: path}
+}
+
+func (pr *prefixRoutes) add(p routePattern, rh *registeredHandler) {
+	for _, route := range pr.routes {
+		if route.pattern.equivalent(p) {
+			panic(fmt.Sprintf("patterns %q and %q match the same paths", route.handler.pattern, rh.pattern))
+		}
+	}
+	pr.routes = append(pr.routes, paramRoute{pattern: p, handler: rh})
+	sort.SliceStable(pr.routes, func(i, j int) bool {
+		return pr.routes[i].pattern.moreSpecific(pr.routes[j].pattern)
+	})
+}
+
+func (pr *prefixRoutes) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rest := strings.Split(strings.TrimPrefix(r.URL.EscapedPath(), pr.path), "/")
+	for _, route := range pr.routes {
+		if values, ok := route.pattern.match(rest); ok {
+			ctx := context.WithValue(r.Context(), pathValuesCtxKey{}, values)
+			route.handler.ServeHTTP(w, r.WithContext(ctx))
+			return
+		}
+	}
+	if pr.static != nil {
+		pr.static.ServeHTTP(w, r)
+		return
+	}
+	http.NotFound(w, r)
+}
+
+type pathValuesCtxKey struct{}
@@ -0,0 +1,321 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package accesslog provides structured access logs which, unlike the ones
+// produced by wrapping the http.Server handler, know the pattern of the route
+// that served the request and the client IP resolved by the ServeMux.
+//
+// The Logger has two parts: a Handler wrapping the ServeMux, which measures
+// the latency and records the status code and the number of bytes written,
+// and an Interceptor, which adds what is only known inside the ServeMux.
+//
+// # Usage
+//
+//	l := &accesslog.Logger{
+//		Output:     os.Stdout,
+//		Headers:    []string{"Referer", "Authorization"},
+//		ScrubQuery: []string{"token"},
+//	}
+//	cfg := safehttp.NewServeMuxConfig(nil)
+//	cfg.Intercept(l.Interceptor())
+//	mux := cfg.Mux()
+//	// Register handlers on mux, then:
+//	http.ListenAndServe(addr, l.Handler(mux))
+//
+// The values of sensitive headers, e.g. Cookie and Authorization, are
+// redacted even if they are listed in Headers, and so are the values of the
+// query parameters listed in ScrubQuery.
+package accesslog
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-safeweb/safehttp"
+	"github.com/google/go-safeweb/safehttp/plugins/internal/responserecorder"
+)
+
+// Redacted replaces the values of sensitive headers and scrubbed query
+// parameters.
+const Redacted = "REDACTED"
+
+// sensitiveHeaders are always redacted. The names are canonical.
+var sensitiveHeaders = map[string]bool{
+	"Authorization":       true,
+	"Cookie":              true,
+	"Proxy-Authorization": true,
+	"X-Csrf-Token":        true,
+	"X-Xsrf-Token":        true,
+}
+
+// Entry is the access log entry of a single request.
+type Entry struct {
+	// Time is when the request was received.
+	Time time.Time
+	// Method is the HTTP method of the request.
+	Method string
+	// Host is the host the request was sent to.
+	Host string
+	// URI is the path of the request followed by its scrubbed query, if any.
+	URI string
+	// Pattern is the pattern of the route that served the request. It's empty
+	// if the request didn't reach the Interceptor, e.g. because no route
+	// matched it.
+	Pattern string
+	// Status is the status code of the response.
+	Status int
+	// Bytes is the number of bytes of the response body.
+	Bytes int64
+	// Latency is the time spent serving the request.
+	Latency time.Duration
+	// ClientIP is the IP address of the client, resolved according to the
+	// safehttp.TrustedProxies of the ServeMux when the request reached the
+	// Interceptor, or taken from the remote address otherwise.
+	ClientIP string
+	// UserAgent is the value of the User-Agent header.
+	UserAgent string
+	// Headers holds the request headers listed in Logger.Headers which were
+	// present, with sensitive values redacted.
+	Headers map[string]string
+}
+
+// MarshalJSON encodes the entry as a flat JSON object, with the latency in
+// milliseconds.
+func (e Entry) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Time      time.Time         `json:"time"`
+		Method    string            `json:"method"`
+		Host      string            `json:"host"`
+		URI       string            `json:"uri"`
+		Pattern   string            `json:"pattern,omitempty"`
+		Status    int               `json:"status"`
+		Bytes     int64             `json:"bytes"`
+		LatencyMS float64           `json:"latency_ms"`
+		ClientIP  string            `json:"client_ip,omitempty"`
+		UserAgent string            `json:"user_agent,omitempty"`
+		Headers   map[string]string `json:"headers,omitempty"`
+	}{
+		Time:      e.Time,
+		Method:    e.Method,
+		Host:      e.Host,
+		URI:       e.URI,
+		Pattern:   e.Pattern,
+		Status:    e.Status,
+		Bytes:     e.Bytes,
+		LatencyMS: float64(e.Latency) / float64(time.Millisecond),
+		ClientIP:  e.ClientIP,
+		UserAgent: e.UserAgent,
+		Headers:   e.Headers,
+	})
+}
+
+// Logger emits an Entry for each request served by its Handler.
+type Logger struct {
+	// Sink receives the entries. If nil, entries are written to Output as
+	// JSON, one per line.
+	Sink func(Entry)
+	// Output is where entries are written to if Sink is nil. If nil,
+	// os.Stderr is used.
+	Output io.Writer
+	// Headers lists the request headers to include in the entries.
+	Headers []string
+	// Redact lists additional headers whose values are redacted, on top of
+	// Cookie, Authorization, Proxy-Authorization and the XSRF token headers.
+	Redact []string
+	// ScrubQuery lists the query parameters whose values are redacted.
+	ScrubQuery []string
+	// Clock is used to measure latencies. If nil, safehttp.SystemClock is
+	// used.
+	Clock safehttp.Clock
+
+	mu sync.Mutex
+}
+
+type entryCtxKey struct{}
+
+// Handler wraps h, which should be a safehttp.ServeMux with the Interceptor
+// of the Logger installed, and emits an entry for each request once h
+// returns.
+func (l *Logger) Handler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		clock := l.clock()
+		e := &Entry{
+			Time:      clock.Now(),
+			Method:    req.Method,
+			Host:      req.Host,
+			URI:       l.uri(req.URL),
+			UserAgent: req.UserAgent(),
+			Headers:   l.headers(req.Header),
+		}
+		rw, rec := responserecorder.New(rw)
+		// The entry is completed once h returns, so it's emitted even if h
+		// panics and the panic is then handled by net/http.
+		defer func() {
+			e.Latency = clock.Now().Sub(e.Time)
+			e.Status, e.Bytes = rec.Status(), rec.Size()
+			if e.ClientIP == "" {
+				e.ClientIP = remoteIP(req.RemoteAddr)
+			}
+			l.emit(*e)
+		}()
+		h.ServeHTTP(rw, req.WithContext(context.WithValue(req.Context(), entryCtxKey{}, e)))
+	})
+}
+
+// Interceptor returns the interceptor adding the route pattern and the
+// client IP to the entries of the Logger. It has no effect on requests that
+// weren't received through the Handler of the Logger.
+func (l *Logger) Interceptor() Interceptor {
+	return Interceptor{}
+}
+
+func (l *Logger) clock() safehttp.Clock {
+	if l.Clock == nil {
+		return safehttp.SystemClock()
+	}
+	return l.Clock
+}
+
+func (l *Logger) emit(e Entry) {
+	if l.Sink != nil {
+		l.Sink(e)
+		return
+	}
+	b, err := json.Marshal(e)
+	if err != nil {
+		log.Printf("accesslog: encoding entry: %v", err)
+		return
+	}
+	out := l.Output
+	if out == nil {
+		out = os.Stderr
+	}
+	b = append(b, '\n')
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, err := out.Write(b); err != nil {
+		log.Printf("accesslog: writing entry: %v", err)
+	}
+}
+
+// headers returns the values of the logged headers which are present in h,
+// redacting the sensitive ones.
+func (l *Logger) headers(h http.Header) map[string]string {
+	var m map[string]string
+	for _, name := range l.Headers {
+		name = textproto.CanonicalMIMEHeaderKey(name)
+		vs, ok := h[name]
+		if !ok {
+			continue
+		}
+		if m == nil {
+			m = map[string]string{}
+		}
+		if l.redacted(name) {
+			m[name] = Redacted
+			continue
+		}
+		m[name] = strings.Join(vs, ", ")
+	}
+	return m
+}
+
+func (l *Logger) redacted(name string) bool {
+	if sensitiveHeaders[name] {
+		return true
+	}
+	for _, r := range l.Redact {
+		if textproto.CanonicalMIMEHeaderKey(r) == name {
+			return true
+		}
+	}
+	return false
+}
+
+// uri returns the path and the query of u, with the values of the scrubbed
+// query parameters redacted. The order of the parameters is preserved.
+func (l *Logger) uri(u *url.URL) string {
+	p := u.EscapedPath()
+	if u.RawQuery == "" {
+		return p
+	}
+	if len(l.ScrubQuery) == 0 {
+		return p + "?" + u.RawQuery
+	}
+	params := strings.Split(u.RawQuery, "&")
+	for i, kv := range params {
+		k := kv
+		if j := strings.IndexByte(kv, '='); j >= 0 {
+			k = kv[:j]
+		}
+		name, err := url.QueryUnescape(k)
+		if err != nil {
+			name = k
+		}
+		for _, s := range l.ScrubQuery {
+			if name == s {
+				params[i] = k + "=" + Redacted
+				break
+			}
+		}
+	}
+	return p + "?" + strings.Join(params, "&")
+}
+
+func remoteIP(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return host
+}
+
+// Interceptor adds the route pattern and the client IP to the entries of the
+// Logger it was obtained from.
+type Interceptor struct{}
+
+var _ safehttp.Interceptor = Interceptor{}
+
+// Before adds the pattern of the matched route and the client IP to the entry
+// of the request.
+func (Interceptor) Before(w safehttp.ResponseWriter, r *safehttp.IncomingRequest, _ safehttp.InterceptorConfig) safehttp.Result {
+	e, ok := r.Context().Value(entryCtxKey{}).(*Entry)
+	if !ok {
+		return safehttp.NotWritten()
+	}
+	e.Pattern = r.Pattern()
+	if ip := r.ClientIP(); ip != nil {
+		e.ClientIP = ip.String()
+	}
+	return safehttp.NotWritten()
+}
+
+// Commit is a no-op, required to satisfy the safehttp.Interceptor interface.
+func (Interceptor) Commit(w safehttp.ResponseHeadersWriter, r *safehttp.IncomingRequest, resp safehttp.Response, _ safehttp.InterceptorConfig) {
+}
+
+// Match returns false since there are no supported configurations.
+func (Interceptor) Match(safehttp.InterceptorConfig) bool {
+	return false
+}
@@ -0,0 +1,173 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package accesslog_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-safeweb/safehttp"
+	"github.com/google/go-safeweb/safehttp/plugins/accesslog"
+	"github.com/google/go-safeweb/safehttp/safehttptest"
+)
+
+var start = time.Date(2021, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+func newServer(t *testing.T, l *accesslog.Logger, clock *safehttptest.FakeClock) http.Handler {
+	t.Helper()
+	cfg := safehttp.NewServeMuxConfig(nil)
+	cfg.Intercept(l.Interceptor())
+	nets, err := safehttp.ParseTrustedNetworks("10.0.0.0/8")
+	if err != nil {
+		t.Fatalf("ParseTrustedNetworks: %v", err)
+	}
+	cfg.TrustProxies(safehttp.TrustedProxies{Networks: nets})
+	mux := cfg.Mux()
+	mux.Handle("/users/{id}", safehttp.MethodGet, safehttp.HandlerFunc(func(w safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+		clock.Advance(25 * time.Millisecond)
+		return w.Write(safehttp.JSONResponse{Data: map[string]string{"id": r.PathValue("id")}})
+	}))
+	mux.Handle("/fail", safehttp.MethodGet, safehttp.HandlerFunc(func(w safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+		return w.WriteError(safehttp.StatusForbidden)
+	}))
+	return l.Handler(mux)
+}
+
+func TestEntry(t *testing.T) {
+	clock := safehttptest.NewFakeClock(start)
+	var got []accesslog.Entry
+	l := &accesslog.Logger{
+		Sink:       func(e accesslog.Entry) { got = append(got, e) },
+		Headers:    []string{"referer", "Authorization", "Cookie", "X-Api-Key", "X-Missing"},
+		Redact:     []string{"x-api-key"},
+		ScrubQuery: []string{"token", "a b"},
+		Clock:      clock,
+	}
+	h := newServer(t, l, clock)
+
+	req := httptest.NewRequest(safehttp.MethodGet, "https://example.com/users/42?page=2&token=s3cr3t&a+b=c&token", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	req.Header.Set("X-Forwarded-For", "203.0.113.7")
+	req.Header.Set("User-Agent", "test-agent")
+	req.Header.Set("Referer", "https://example.com/")
+	req.Header.Set("Authorization", "Bearer s3cr3t")
+	req.Header.Set("Cookie", "session=s3cr3t")
+	req.Header.Set("X-Api-Key", "s3cr3t")
+	rw := httptest.NewRecorder()
+	h.ServeHTTP(rw, req)
+
+	want := []accesslog.Entry{{
+		Time:      start,
+		Method:    "GET",
+		Host:      "example.com",
+		URI:       "/users/42?page=2&token=REDACTED&a+b=REDACTED&token=REDACTED",
+		Pattern:   "/users/{id}",
+		Status:    http.StatusOK,
+		Bytes:     int64(rw.Body.Len()),
+		Latency:   25 * time.Millisecond,
+		ClientIP:  "203.0.113.7",
+		UserAgent: "test-agent",
+		Headers: map[string]string{
+			"Referer":       "https://example.com/",
+			"Authorization": accesslog.Redacted,
+			"Cookie":        accesslog.Redacted,
+			"X-Api-Key":     accesslog.Redacted,
+		},
+	}}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("entries mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestErrorAndNotFound(t *testing.T) {
+	clock := safehttptest.NewFakeClock(start)
+	var got []accesslog.Entry
+	l := &accesslog.Logger{Sink: func(e accesslog.Entry) { got = append(got, e) }, Clock: clock}
+	h := newServer(t, l, clock)
+
+	for _, path := range []string{"/fail", "/nowhere"} {
+		req := httptest.NewRequest(safehttp.MethodGet, "https://example.com"+path, nil)
+		req.RemoteAddr = "192.0.2.1:1234"
+		h.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	if len(got) != 2 {
+		t.Fatalf("got %d entries, want 2", len(got))
+	}
+	if e := got[0]; e.Status != http.StatusForbidden || e.Pattern != "/fail" || e.ClientIP != "192.0.2.1" || e.Bytes == 0 {
+		t.Errorf("error entry: got %+v, want status 403, pattern /fail, client IP 192.0.2.1 and a body", e)
+	}
+	// No route matched, so the interceptor never ran: the pattern is unknown
+	// and the client IP is the remote address.
+	if e := got[1]; e.Status != http.StatusNotFound || e.Pattern != "" || e.ClientIP != "192.0.2.1" {
+		t.Errorf("not found entry: got %+v, want status 404, no pattern and client IP 192.0.2.1", e)
+	}
+}
+
+func TestJSONOutput(t *testing.T) {
+	clock := safehttptest.NewFakeClock(start)
+	var out bytes.Buffer
+	l := &accesslog.Logger{Output: &out, Clock: clock}
+	h := newServer(t, l, clock)
+
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest(safehttp.MethodGet, "https://example.com/users/7", nil)
+		req.RemoteAddr = "192.0.2.1:1234"
+		h.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	dec := json.NewDecoder(&out)
+	for i := 0; i < 2; i++ {
+		var got map[string]interface{}
+		if err := dec.Decode(&got); err != nil {
+			t.Fatalf("decoding entry %d: %v", i, err)
+		}
+		want := map[string]interface{}{
+			"time":       start.Add(time.Duration(i) * 25 * time.Millisecond).Format(time.RFC3339Nano),
+			"method":     "GET",
+			"host":       "example.com",
+			"uri":        "/users/7",
+			"pattern":    "/users/{id}",
+			"status":     float64(200),
+			"bytes":      got["bytes"],
+			"latency_ms": float64(25),
+			"client_ip":  "192.0.2.1",
+		}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Errorf("entry %d mismatch (-want +got):\n%s", i, diff)
+		}
+	}
+}
+
+func TestInterceptorWithoutHandler(t *testing.T) {
+	l := &accesslog.Logger{Sink: func(e accesslog.Entry) { t.Errorf("unexpected entry %+v", e) }}
+	cfg := safehttp.NewServeMuxConfig(nil)
+	cfg.Intercept(l.Interceptor())
+	mux := cfg.Mux()
+	mux.Handle("/", safehttp.MethodGet, safehttp.HandlerFunc(func(w safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+		return w.Write(safehttp.NoContentResponse{})
+	}))
+
+	rw := httptest.NewRecorder()
+	mux.ServeHTTP(rw, httptest.NewRequest(safehttp.MethodGet, "https://example.com/", nil))
+	if rw.Code != http.StatusNoContent {
+		t.Errorf("status: got %d, want %d", rw.Code, http.StatusNoContent)
+	}
+}
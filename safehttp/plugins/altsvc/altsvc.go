@@ -0,0 +1,137 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package altsvc provides a plugin advertising alternative services, e.g.
+// HTTP/3 endpoints, through the Alt-Svc header.
+//
+// More info:
+//   - MDN: https://developer.mozilla.org/en-US/docs/Web/HTTP/Headers/Alt-Svc
+//   - RFC 7838: https://tools.ietf.org/html/rfc7838
+//
+// # Usage
+//
+// To advertise an HTTP/3 endpoint, use HTTP3. Otherwise, create the
+// Interceptor yourself. Install it using safehttp.ServeMuxConfig.Intercept.
+package altsvc
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/go-safeweb/safehttp"
+)
+
+// Service is an alternative service.
+type Service struct {
+	// Protocol is the ALPN protocol ID of the service, e.g. "h3".
+	Protocol string
+	// Host is the host of the service. If empty, the host of the request is
+	// used.
+	Host string
+	// Port is the port of the service.
+	Port int
+	// MaxAge is how long the advertisement can be cached. It will be rounded
+	// to seconds before use. If zero, clients use a default of 24 hours.
+	MaxAge time.Duration
+	// Persist asks clients to keep the advertisement when their network
+	// configuration changes.
+	Persist bool
+}
+
+func (s Service) serialize() (string, error) {
+	if s.Protocol == "" || strings.ContainsAny(s.Protocol, "\"=;, \t") {
+		return "", fmt.Errorf("invalid protocol ID %q", s.Protocol)
+	}
+	if strings.ContainsAny(s.Host, "\"\\:;, \t") {
+		return "", fmt.Errorf("invalid host %q", s.Host)
+	}
+	if s.Port < 1 || s.Port > 65535 {
+		return "", fmt.Errorf("invalid port %d", s.Port)
+	}
+	if s.MaxAge < 0 {
+		return "", errors.New("negative MaxAge")
+	}
+
+	var b strings.Builder
+	b.WriteString(s.Protocol)
+	b.WriteString(`="`)
+	b.WriteString(s.Host)
+	b.WriteByte(':')
+	b.WriteString(strconv.Itoa(s.Port))
+	b.WriteByte('"')
+	if s.MaxAge != 0 {
+		b.WriteString("; ma=")
+		b.WriteString(strconv.FormatInt(int64(s.MaxAge.Seconds()), 10))
+	}
+	if s.Persist {
+		b.WriteString("; persist=1")
+	}
+	return b.String(), nil
+}
+
+// Interceptor sets the Alt-Svc header.
+type Interceptor struct {
+	// Services lists the alternative services, by decreasing preference.
+	Services []Service
+	// Clear invalidates all the alternative services previously advertised.
+	// It can't be used together with Services.
+	Clear bool
+}
+
+var _ safehttp.Interceptor = Interceptor{}
+
+// HTTP3 creates an Interceptor advertising an HTTP/3 endpoint on the given
+// port of the requested host, cacheable for maxAge.
+func HTTP3(port int, maxAge time.Duration) Interceptor {
+	return Interceptor{Services: []Service{{Protocol: "h3", Port: port, MaxAge: maxAge}}}
+}
+
+// Before claims and sets the Alt-Svc header. If the Interceptor is
+// misconfigured, a 500 Internal Server Error response is written.
+func (it Interceptor) Before(w safehttp.ResponseWriter, _ *safehttp.IncomingRequest, _ safehttp.InterceptorConfig) safehttp.Result {
+	set := w.Header().Claim("Alt-Svc")
+	if it.Clear {
+		if len(it.Services) != 0 {
+			return w.WriteError(safehttp.StatusInternalServerError)
+		}
+		set([]string{"clear"})
+		return safehttp.NotWritten()
+	}
+	if len(it.Services) == 0 {
+		return safehttp.NotWritten()
+	}
+
+	values := make([]string, 0, len(it.Services))
+	for _, s := range it.Services {
+		v, err := s.serialize()
+		if err != nil {
+			return w.WriteError(safehttp.StatusInternalServerError)
+		}
+		values = append(values, v)
+	}
+	set([]string{strings.Join(values, ", ")})
+	return safehttp.NotWritten()
+}
+
+// Commit is a no-op, required to satisfy the safehttp.Interceptor interface.
+func (Interceptor) Commit(w safehttp.ResponseHeadersWriter, r *safehttp.IncomingRequest, resp safehttp.Response, _ safehttp.InterceptorConfig) {
+}
+
+// Match returns false since there are no supported configurations.
+func (Interceptor) Match(safehttp.InterceptorConfig) bool {
+	return false
+}
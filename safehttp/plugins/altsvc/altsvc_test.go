@@ -0,0 +1,104 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package altsvc_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-safeweb/safehttp"
+	"github.com/google/go-safeweb/safehttp/plugins/altsvc"
+	"github.com/google/go-safeweb/safehttp/safehttptest"
+)
+
+func TestAltSvc(t *testing.T) {
+	tests := []struct {
+		name        string
+		interceptor altsvc.Interceptor
+		wantHeaders map[string][]string
+	}{
+		{
+			name:        "HTTP3",
+			interceptor: altsvc.HTTP3(443, 24*time.Hour),
+			wantHeaders: map[string][]string{
+				"Alt-Svc": {`h3=":443"; ma=86400`},
+			},
+		},
+		{
+			name: "Multiple services",
+			interceptor: altsvc.Interceptor{Services: []altsvc.Service{
+				{Protocol: "h3", Host: "alt.example.com", Port: 8443, Persist: true},
+				{Protocol: "h2", Port: 443},
+			}},
+			wantHeaders: map[string][]string{
+				"Alt-Svc": {`h3="alt.example.com:8443"; persist=1, h2=":443"`},
+			},
+		},
+		{
+			name:        "Clear",
+			interceptor: altsvc.Interceptor{Clear: true},
+			wantHeaders: map[string][]string{
+				"Alt-Svc": {"clear"},
+			},
+		},
+		{
+			name:        "No services",
+			interceptor: altsvc.Interceptor{},
+			wantHeaders: map[string][]string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := safehttptest.NewRequest(safehttp.MethodGet, "https://foo.com/", nil)
+			fakeRW, rr := safehttptest.NewFakeResponseWriter()
+			tt.interceptor.Before(fakeRW, req, nil)
+
+			if got, want := rr.Code, safehttp.StatusOK; got != int(want) {
+				t.Errorf("rr.Code got: %v want: %v", got, want)
+			}
+			if diff := cmp.Diff(tt.wantHeaders, map[string][]string(rr.Header())); diff != "" {
+				t.Errorf("rr.Header() mismatch (-want +got):\n%s", diff)
+			}
+			if !fakeRW.Header().IsClaimed("Alt-Svc") {
+				t.Error(`fakeRW.Header().IsClaimed("Alt-Svc") = false, want true`)
+			}
+		})
+	}
+}
+
+func TestAltSvcInvalid(t *testing.T) {
+	tests := []struct {
+		name        string
+		interceptor altsvc.Interceptor
+	}{
+		{name: "Clear with services", interceptor: altsvc.Interceptor{Clear: true, Services: []altsvc.Service{{Protocol: "h3", Port: 443}}}},
+		{name: "Missing protocol", interceptor: altsvc.Interceptor{Services: []altsvc.Service{{Port: 443}}}},
+		{name: "Invalid host", interceptor: altsvc.Interceptor{Services: []altsvc.Service{{Protocol: "h3", Host: `a"b`, Port: 443}}}},
+		{name: "Invalid port", interceptor: altsvc.Interceptor{Services: []altsvc.Service{{Protocol: "h3", Port: 0}}}},
+		{name: "Negative MaxAge", interceptor: altsvc.HTTP3(443, -time.Second)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := safehttptest.NewRequest(safehttp.MethodGet, "https://foo.com/", nil)
+			fakeRW, rr := safehttptest.NewFakeResponseWriter()
+			tt.interceptor.Before(fakeRW, req, nil)
+
+			if got, want := rr.Code, safehttp.StatusInternalServerError; got != int(want) {
+				t.Errorf("rr.Code got: %v want: %v", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,171 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package batch provides a handler for batch endpoints, which accept several
+// operations in a single request.
+//
+// Every operation is dispatched through a safehttp.ServeMux as a separate
+// request, so that the interceptors configured for its target run exactly as
+// if it had been sent on its own. Batching can't be used to bypass security
+// checks.
+package batch
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/google/go-safeweb/safehttp"
+	"github.com/google/go-safeweb/safehttp/restricted"
+)
+
+// Operation is a single request of a batch.
+type Operation struct {
+	// Method is the HTTP method of the request.
+	Method string `json:"method"`
+	// Path is the path, and optionally the query, of the request. It must be
+	// absolute and can't contain a scheme or a host.
+	Path string `json:"path"`
+	// Headers of the request. The headers of the batch request are inherited
+	// by all operations and can't be overridden, with the exception of
+	// Content-Type and Content-Length which describe the batch body.
+	Headers map[string]string `json:"headers,omitempty"`
+	// Body of the request.
+	Body string `json:"body,omitempty"`
+}
+
+// Result is the response to an Operation.
+type Result struct {
+	// Status is the status code of the response.
+	Status int `json:"status"`
+	// Headers are the headers of the response, except Set-Cookie: cookies,
+	// e.g. HttpOnly session ones, would be exposed to the scripts reading the
+	// batch response, so they are dropped.
+	Headers map[string][]string `json:"headers,omitempty"`
+	// Body is the body of the response.
+	Body string `json:"body,omitempty"`
+}
+
+type nestedKey struct{}
+
+// Handler returns a safehttp.Handler serving batch requests. The body of these
+// requests must be a JSON array of at most maxOps Operations, sent as
+// application/json. Bodies larger than the default limit of
+// IncomingRequest.JSONBody get a 413 Request Entity Too Large. The operations
+// are dispatched to mux sequentially, in order, and their Results are written
+// as a JSON array in the same order.
+//
+// Batch requests can't be nested: operations targeting a batch endpoint
+// result in a 400 Bad Request.
+func Handler(mux *safehttp.ServeMux, maxOps int) safehttp.Handler {
+	if maxOps < 1 {
+		panic("batch: maxOps must be positive")
+	}
+	return safehttp.HandlerFunc(func(w safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+		if r.Method() != safehttp.MethodPost {
+			return w.WriteError(safehttp.StatusMethodNotAllowed)
+		}
+		if r.Context().Value(nestedKey{}) != nil {
+			return w.WriteError(safehttp.StatusBadRequest)
+		}
+
+		var ops []Operation
+		if err := r.JSONBody(&ops); errors.Is(err, safehttp.ErrBodyTooLarge) {
+			return w.WriteError(safehttp.StatusRequestEntityTooLarge)
+		} else if err != nil {
+			return w.WriteError(safehttp.StatusBadRequest)
+		}
+		if len(ops) > maxOps {
+			return w.WriteError(safehttp.StatusRequestEntityTooLarge)
+		}
+
+		parent := restricted.RawRequest(r)
+		results := make([]Result, 0, len(ops))
+		for _, op := range ops {
+			req, ok := subRequest(parent, op)
+			if !ok {
+				results = append(results, Result{Status: int(safehttp.StatusBadRequest)})
+				continue
+			}
+			rec := newRecorder()
+			mux.ServeHTTP(rec, req)
+			rec.header.Del("Set-Cookie")
+			results = append(results, Result{
+				Status:  rec.status,
+				Headers: map[string][]string(rec.header),
+				Body:    rec.body.String(),
+			})
+		}
+		return w.Write(safehttp.JSONResponse{Data: results})
+	})
+}
+
+// subRequest builds the request for op, inheriting the connection details and
+// headers of parent.
+func subRequest(parent *http.Request, op Operation) (*http.Request, bool) {
+	if !strings.HasPrefix(op.Path, "/") || strings.HasPrefix(op.Path, "//") {
+		return nil, false
+	}
+	ctx := context.WithValue(parent.Context(), nestedKey{}, true)
+	req, err := http.NewRequestWithContext(ctx, op.Method, op.Path, strings.NewReader(op.Body))
+	if err != nil {
+		return nil, false
+	}
+	req.Host = parent.Host
+	req.TLS = parent.TLS
+	req.RemoteAddr = parent.RemoteAddr
+	req.Proto, req.ProtoMajor, req.ProtoMinor = parent.Proto, parent.ProtoMajor, parent.ProtoMinor
+
+	for k, v := range op.Headers {
+		req.Header.Set(k, v)
+	}
+	for k, v := range parent.Header {
+		if k == "Content-Type" || k == "Content-Length" {
+			continue
+		}
+		req.Header[k] = append([]string(nil), v...)
+	}
+	return req, true
+}
+
+// recorder is a minimal http.ResponseWriter keeping the response in memory.
+type recorder struct {
+	header      http.Header
+	body        bytes.Buffer
+	status      int
+	wroteHeader bool
+}
+
+func newRecorder() *recorder {
+	return &recorder{header: http.Header{}, status: http.StatusOK}
+}
+
+func (r *recorder) Header() http.Header {
+	return r.header
+}
+
+func (r *recorder) WriteHeader(status int) {
+	if r.wroteHeader {
+		return
+	}
+	r.wroteHeader = true
+	r.status = status
+}
+
+func (r *recorder) Write(b []byte) (int, error) {
+	r.WriteHeader(http.StatusOK)
+	return r.body.Write(b)
+}
@@ -0,0 +1,174 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package batch_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-safeweb/safehttp"
+	"github.com/google/go-safeweb/safehttp/plugins/batch"
+	"github.com/google/safehtml"
+)
+
+// authInterceptor rejects requests without the right Authorization header.
+type authInterceptor struct{}
+
+func (authInterceptor) Before(w safehttp.ResponseWriter, r *safehttp.IncomingRequest, _ safehttp.InterceptorConfig) safehttp.Result {
+	if r.Header.Get("Authorization") != "secret" {
+		return w.WriteError(safehttp.StatusUnauthorized)
+	}
+	return safehttp.NotWritten()
+}
+
+func (authInterceptor) Commit(safehttp.ResponseHeadersWriter, *safehttp.IncomingRequest, safehttp.Response, safehttp.InterceptorConfig) {
+}
+
+func (authInterceptor) Match(safehttp.InterceptorConfig) bool {
+	return false
+}
+
+func newMux() *safehttp.ServeMux {
+	mc := safehttp.NewServeMuxConfig(nil)
+	mc.Intercept(authInterceptor{})
+	mux := mc.Mux()
+	mux.Handle("/batch", safehttp.MethodPost, batch.Handler(mux, 10))
+	mux.Handle("/item", safehttp.MethodGet, safehttp.HandlerFunc(func(w safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+		q, err := r.URL().Query()
+		if err != nil {
+			return w.WriteError(safehttp.StatusBadRequest)
+		}
+		return w.Write(safehtml.HTMLEscaped("item " + q.String("id", "")))
+	}))
+	mux.Handle("/login", safehttp.MethodPost, safehttp.HandlerFunc(func(w safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+		if err := w.AddCookie(safehttp.NewCookie("session", "s3cr3t")); err != nil {
+			return w.WriteError(safehttp.StatusInternalServerError)
+		}
+		return w.Write(safehttp.NoContentResponse{})
+	}))
+	mux.Handle("/echo", safehttp.MethodPost, safehttp.HandlerFunc(func(w safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+		b, err := ioutil.ReadAll(r.Body())
+		if err != nil {
+			return w.WriteError(safehttp.StatusBadRequest)
+		}
+		return w.Write(safehtml.HTMLEscaped(r.Header.Get("Content-Type") + " " + string(b)))
+	}))
+	return mux
+}
+
+func serveBatch(t *testing.T, auth string, body string) (int, []batch.Result) {
+	t.Helper()
+	req := httptest.NewRequest(safehttp.MethodPost, "/batch", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if auth != "" {
+		req.Header.Set("Authorization", auth)
+	}
+	rr := httptest.NewRecorder()
+	newMux().ServeHTTP(rr, req)
+	if rr.Code != int(safehttp.StatusOK) {
+		return rr.Code, nil
+	}
+
+	var results []batch.Result
+	b := strings.TrimPrefix(rr.Body.String(), ")]}',\n")
+	if err := json.Unmarshal([]byte(b), &results); err != nil {
+		t.Fatalf("json.Unmarshal(%q) got err: %v", b, err)
+	}
+	return rr.Code, results
+}
+
+func TestBatch(t *testing.T) {
+	body := `[
+		{"method": "GET", "path": "/item?id=1"},
+		{"method": "POST", "path": "/echo", "headers": {"Content-Type": "text/plain"}, "body": "hello"},
+		{"method": "GET", "path": "/missing"},
+		{"method": "GET", "path": "https://example.com/item"}
+	]`
+	code, results := serveBatch(t, "secret", body)
+	if code != int(safehttp.StatusOK) {
+		t.Fatalf("status code: got %d, want %d", code, safehttp.StatusOK)
+	}
+
+	type summary struct {
+		Status int
+		Body   string
+	}
+	var got []summary
+	for _, r := range results {
+		got = append(got, summary{Status: r.Status, Body: r.Body})
+	}
+	want := []summary{
+		{Status: 200, Body: "item 1"},
+		{Status: 200, Body: "text/plain hello"},
+		{Status: 404, Body: "404 page not found\n"},
+		{Status: 400},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("results mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestBatchDropsCookies(t *testing.T) {
+	code, results := serveBatch(t, "secret", `[{"method": "POST", "path": "/login"}]`)
+	if code != int(safehttp.StatusOK) || len(results) != 1 {
+		t.Fatalf("serveBatch(): got %d, %v", code, results)
+	}
+	if got := results[0].Status; got != int(safehttp.StatusNoContent) {
+		t.Errorf("status: got %d, want %d", got, safehttp.StatusNoContent)
+	}
+	if got, ok := results[0].Headers["Set-Cookie"]; ok {
+		t.Errorf("Set-Cookie: got %q, want none", got)
+	}
+}
+
+func TestBatchInterceptorsRunForOperations(t *testing.T) {
+	// The header of the operation can't override the one of the batch request.
+	body := `[{"method": "GET", "path": "/item", "headers": {"Authorization": "secret"}}]`
+	code, _ := serveBatch(t, "", body)
+	if want := int(safehttp.StatusUnauthorized); code != want {
+		t.Errorf("status code: got %d, want %d", code, want)
+	}
+}
+
+func TestBatchNested(t *testing.T) {
+	body := `[{"method": "POST", "path": "/batch", "body": "[]"}]`
+	_, results := serveBatch(t, "secret", body)
+	if len(results) != 1 || results[0].Status != int(safehttp.StatusBadRequest) {
+		t.Errorf("results: got %+v, want a single 400 Bad Request", results)
+	}
+}
+
+func TestBatchInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want safehttp.StatusCode
+	}{
+		{name: "Not JSON", body: "foo", want: safehttp.StatusBadRequest},
+		{name: "Too large", body: `[{"method":"POST","path":"/echo","body":"` + strings.Repeat("a", 2<<20) + `"}]`, want: safehttp.StatusRequestEntityTooLarge},
+		{name: "Too many operations", body: "[" + strings.Repeat(`{"method":"GET","path":"/item"},`, 10) + `{"method":"GET","path":"/item"}]`, want: safehttp.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code, _ := serveBatch(t, "secret", tt.body); code != int(tt.want) {
+				t.Errorf("status code: got %d, want %d", code, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,141 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package beacon injects a telemetry script, e.g. for real user monitoring,
+// and a per-user watermark into HTML pages, without changing their templates.
+//
+// The beacon is rendered through safehtml: the script is loaded from a
+// TrustedResourceURL and gets the CSP nonce of the request, if the csp
+// Interceptor is installed, so that it's allowed by strict policies.
+//
+// # Usage
+//
+// Load the templates with beacons enabled, which adds a call to the Beacon
+// function at the beginning of their body, and install an Interceptor using
+// safehttp.ServeMuxConfig.Intercept to provide it:
+//
+//	tpl, err := htmlinject.LoadGlob(nil, htmlinject.LoadConfig{Beacons: true}, pattern)
+//	cfg.Intercept(beacon.Interceptor{
+//		Script:    safehtml.TrustedResourceURLFromConstant("/static/rum.js"),
+//		Watermark: opaqueUserID,
+//	})
+//
+// The Interceptor must be installed on the ServeMuxes serving templates loaded
+// this way, otherwise executing them fails.
+package beacon
+
+import (
+	"log"
+	"regexp"
+
+	"github.com/google/go-safeweb/safehttp"
+	"github.com/google/go-safeweb/safehttp/plugins/csp"
+	"github.com/google/go-safeweb/safehttp/plugins/htmlinject"
+	"github.com/google/safehtml"
+	"github.com/google/safehtml/template"
+	"github.com/google/safehtml/uncheckedconversions"
+)
+
+var scriptTemplate = template.Must(template.New("beacon").Parse(
+	`<script{{if .Nonce}} nonce="{{.Nonce}}"{{end}} src="{{.Src}}" async></script>`))
+
+// watermarkChars are the characters allowed in watermarks. They can't end an
+// HTML comment.
+var watermarkChars = regexp.MustCompile(`^[A-Za-z0-9_.:]{1,128}$`)
+
+// Interceptor provides the Beacon function to safehttp.TemplateResponses.
+type Interceptor struct {
+	// Script is the URL of the script loaded by pages, or an empty
+	// TrustedResourceURL for none.
+	Script safehtml.TrustedResourceURL
+	// Watermark returns the identifier to embed in an HTML comment of the
+	// page served to r, e.g. an opaque identifier of the user, or an empty
+	// string for none; it shouldn't reveal anything about the user to those
+	// the page is leaked to. Only letters, digits, '_', '.' and ':' are
+	// allowed, other watermarks are skipped.
+	Watermark func(r *safehttp.IncomingRequest) string
+}
+
+var _ safehttp.Interceptor = Interceptor{}
+
+// Before is a no-op, required to satisfy the safehttp.Interceptor interface.
+func (Interceptor) Before(w safehttp.ResponseWriter, _ *safehttp.IncomingRequest, _ safehttp.InterceptorConfig) safehttp.Result {
+	return safehttp.NotWritten()
+}
+
+// Commit adds the Beacon function to safehttp.TemplateResponses. For
+// handlers configured with Disable, the function renders nothing.
+func (it Interceptor) Commit(w safehttp.ResponseHeadersWriter, r *safehttp.IncomingRequest, resp safehttp.Response, cfg safehttp.InterceptorConfig) {
+	tmplResp, ok := resp.(*safehttp.TemplateResponse)
+	if !ok {
+		return
+	}
+	b := safehtml.HTML{}
+	if _, disabled := cfg.(Overrider); !disabled {
+		var err error
+		b, err = it.render(r)
+		if err != nil {
+			// The page is still served, without the beacon.
+			log.Printf("beacon: rendering: %v", err)
+		}
+	}
+	if tmplResp.FuncMap == nil {
+		tmplResp.FuncMap = map[string]interface{}{}
+	}
+	tmplResp.FuncMap[htmlinject.BeaconsDefaultFuncName] = func() safehtml.HTML { return b }
+}
+
+func (it Interceptor) render(r *safehttp.IncomingRequest) (safehtml.HTML, error) {
+	var parts []safehtml.HTML
+	if it.Script.String() != "" {
+		// There is no nonce if the csp Interceptor isn't installed.
+		nonce, _ := csp.Nonce(r.Context())
+		s, err := scriptTemplate.ExecuteToHTML(struct {
+			Nonce string
+			Src   safehtml.TrustedResourceURL
+		}{nonce, it.Script})
+		if err != nil {
+			return safehtml.HTML{}, err
+		}
+		parts = append(parts, s)
+	}
+	if it.Watermark != nil {
+		if wm := it.Watermark(r); wm != "" {
+			if !watermarkChars.MatchString(wm) {
+				log.Printf("beacon: skipping invalid watermark %q", wm)
+			} else {
+				// The watermark only contains characters which can't end
+				// the comment, nor be interpreted as markup.
+				parts = append(parts, uncheckedconversions.HTMLFromStringKnownToSatisfyTypeContract("<!-- "+wm+" -->"))
+			}
+		}
+	}
+	return safehtml.HTMLConcat(parts...), nil
+}
+
+// Match recognizes Overriders as beacon configurations.
+func (Interceptor) Match(cfg safehttp.InterceptorConfig) bool {
+	_, ok := cfg.(Overrider)
+	return ok
+}
+
+// Overrider is a safehttp.InterceptorConfig disabling the beacon of a specific
+// handler.
+type Overrider struct{}
+
+// Disable creates an Overrider disabling the beacon, e.g. for pages rendering
+// sensitive content which shouldn't be monitored.
+func Disable(reason string) Overrider {
+	return Overrider{}
+}
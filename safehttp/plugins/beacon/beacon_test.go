@@ -0,0 +1,107 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package beacon_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/google/go-safeweb/safehttp"
+	"github.com/google/go-safeweb/safehttp/plugins/beacon"
+	"github.com/google/go-safeweb/safehttp/plugins/csp"
+	"github.com/google/go-safeweb/safehttp/plugins/htmlinject"
+	"github.com/google/safehtml"
+	"github.com/google/safehtml/template"
+)
+
+func TestBeacon(t *testing.T) {
+	tpl, err := htmlinject.LoadTrustedTemplate(nil, htmlinject.LoadConfig{DisableXSRF: true, Beacons: true},
+		template.MakeTrustedTemplate(`<html><body><p>Hi</p></body></html>`))
+	if err != nil {
+		t.Fatalf("htmlinject.LoadTrustedTemplate() got err: %v", err)
+	}
+
+	mc := safehttp.NewServeMuxConfig(nil)
+	mc.Intercept(csp.Default(""))
+	mc.Intercept(beacon.Interceptor{
+		Script:    safehtml.TrustedResourceURLFromConstant("/static/rum.js"),
+		Watermark: func(r *safehttp.IncomingRequest) string { return r.Header.Get("X-User") },
+	})
+	mux := mc.Mux()
+	h := safehttp.HandlerFunc(func(w safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+		return safehttp.ExecuteTemplate(w, tpl, nil)
+	})
+	mux.Handle("/", safehttp.MethodGet, h)
+	mux.Handle("/private", safehttp.MethodGet, h, beacon.Disable("sensitive page"))
+
+	tests := []struct {
+		name string
+		path string
+		user string
+		want string
+	}{
+		{
+			name: "script and watermark",
+			path: "/",
+			user: "u.1234",
+			want: `^<html><body><script nonce="[^"]+" src="/static/rum.js" async></script><!-- u.1234 --><p>Hi</p></body></html>$`,
+		},
+		{
+			name: "invalid watermark",
+			path: "/",
+			user: "--><script>alert(1)</script>",
+			want: `^<html><body><script nonce="[^"]+" src="/static/rum.js" async></script><p>Hi</p></body></html>$`,
+		},
+		{
+			name: "disabled",
+			path: "/private",
+			user: "u.1234",
+			want: `^<html><body><p>Hi</p></body></html>$`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "https://foo.com"+tt.path, nil)
+			req.Header.Set("X-User", tt.user)
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, req)
+			if got := rr.Body.String(); !regexp.MustCompile(tt.want).MatchString(got) {
+				t.Errorf("body: got %q, want match for %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBeaconWithoutCSP(t *testing.T) {
+	tpl, err := htmlinject.LoadTrustedTemplate(nil, htmlinject.LoadConfig{DisableCSP: true, DisableXSRF: true, Beacons: true},
+		template.MakeTrustedTemplate(`<body></body>`))
+	if err != nil {
+		t.Fatalf("htmlinject.LoadTrustedTemplate() got err: %v", err)
+	}
+	mc := safehttp.NewServeMuxConfig(nil)
+	mc.Intercept(beacon.Interceptor{Script: safehtml.TrustedResourceURLFromConstant("/static/rum.js")})
+	mux := mc.Mux()
+	mux.Handle("/", safehttp.MethodGet, safehttp.HandlerFunc(func(w safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+		return safehttp.ExecuteTemplate(w, tpl, nil)
+	}))
+
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "https://foo.com/", nil))
+	if got, want := rr.Body.String(), `<body><script src="/static/rum.js" async></script></body>`; got != want {
+		t.Errorf("body: got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,161 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package blobstore stores blobs, such as uploaded files, by the hash of their
+// content, so identical uploads are stored once and blob keys can't be guessed
+// or chosen by clients.
+//
+// Stores are provided for a local directory (Dir), for main memory (Memory)
+// and for object storage services such as S3 or GCS (BucketStore), through a
+// small Bucket interface implemented on top of their client libraries.
+//
+// # Usage
+//
+//	store, err := blobstore.NewDir("/var/lib/app/blobs")
+//	// ...
+//	key, err := blobstore.PutUpload(r.Context(), store, form.Files("photo")[0])
+//	// ...
+//	mux.Handle("/blobs/", safehttp.MethodGet, blobstore.Handler(store))
+package blobstore
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"io"
+	"mime"
+	"regexp"
+	"strings"
+
+	"github.com/google/go-safeweb/safehttp"
+)
+
+// ErrNotFound is returned when a blob doesn't exist.
+var ErrNotFound = errors.New("blob not found")
+
+// Key identifies a blob. It's the hex-encoded SHA-256 hash of its content.
+type Key string
+
+var keyPattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// ParseKey parses a key, as returned by Key.String.
+func ParseKey(s string) (Key, error) {
+	if !keyPattern.MatchString(s) {
+		return "", errors.New("invalid blob key")
+	}
+	return Key(s), nil
+}
+
+// String returns the hex-encoded key.
+func (k Key) String() string {
+	return string(k)
+}
+
+// Metadata is the metadata stored together with a blob.
+type Metadata struct {
+	// ContentType is the Content-Type of the blob.
+	ContentType string `json:"content_type,omitempty"`
+	// Filename is the name of the blob, e.g. the name of the uploaded file. It
+	// shouldn't be trusted.
+	Filename string `json:"filename,omitempty"`
+	// Size is the size of the blob in bytes. It's set by the Store.
+	Size int64 `json:"size"`
+}
+
+// Store stores blobs by the hash of their content.
+type Store interface {
+	// Put stores the content and returns its key. If a blob with the same
+	// content already exists, it's kept together with its metadata, and md
+	// is discarded.
+	Put(ctx context.Context, content io.Reader, md Metadata) (Key, error)
+	// Open returns the content of the blob with the given key, which must be
+	// closed by the caller, and its metadata. It returns an error wrapping
+	// ErrNotFound if there is no such blob.
+	Open(ctx context.Context, key Key) (io.ReadCloser, Metadata, error)
+	// Delete deletes the blob with the given key. Deleting a blob that
+	// doesn't exist is not an error.
+	Delete(ctx context.Context, key Key) error
+}
+
+// PutUpload stores an uploaded file, with its sniffed Content-Type.
+func PutUpload(ctx context.Context, s Store, f *safehttp.UploadedFile) (Key, error) {
+	content, err := f.Open()
+	if err != nil {
+		return "", err
+	}
+	defer content.Close()
+	return s.Put(ctx, content, Metadata{ContentType: f.ContentType, Filename: f.Filename})
+}
+
+// hashingReader computes the key and the size of the content read through it.
+type hashingReader struct {
+	r    io.Reader
+	h    hash.Hash
+	size int64
+}
+
+func newHashingReader(r io.Reader) *hashingReader {
+	return &hashingReader{r: r, h: sha256.New()}
+}
+
+func (hr *hashingReader) Read(p []byte) (int, error) {
+	n, err := hr.r.Read(p)
+	hr.h.Write(p[:n])
+	hr.size += int64(n)
+	return n, err
+}
+
+func (hr *hashingReader) key() Key {
+	return Key(hex.EncodeToString(hr.h.Sum(nil)))
+}
+
+// Handler returns a handler serving the blob whose key is the last segment of
+// the URL path, e.g. "/blobs/<key>".
+//
+// Blobs are served as downloads, with an application/octet-stream
+// Content-Type and an attachment Content-Disposition, as their content is not
+// trusted and mustn't be rendered by browsers on the origin of the
+// application.
+func Handler(s Store) safehttp.Handler {
+	return safehttp.HandlerFunc(func(w safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+		path := r.URL().Path()
+		key, err := ParseKey(path[strings.LastIndexByte(path, '/')+1:])
+		if err != nil {
+			return w.WriteError(safehttp.StatusNotFound)
+		}
+		content, md, err := s.Open(r.Context(), key)
+		if errors.Is(err, ErrNotFound) {
+			return w.WriteError(safehttp.StatusNotFound)
+		}
+		if err != nil {
+			return w.WriteError(safehttp.StatusInternalServerError)
+		}
+		defer content.Close()
+
+		filename := md.Filename
+		if filename == "" {
+			filename = key.String()
+		}
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+		return w.Write(safehttp.StreamingResponse{
+			ContentType: "application/octet-stream",
+			Stream: func(sw *safehttp.StreamWriter) error {
+				_, err := io.Copy(sw, content)
+				return err
+			},
+		})
+	})
+}
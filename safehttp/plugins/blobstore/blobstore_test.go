@@ -0,0 +1,206 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blobstore_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-safeweb/safehttp"
+	"github.com/google/go-safeweb/safehttp/plugins/blobstore"
+)
+
+type fakeBucket struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	attrs   map[string]map[string]string
+	uploads int
+}
+
+func newFakeBucket() *fakeBucket {
+	return &fakeBucket{objects: map[string][]byte{}, attrs: map[string]map[string]string{}}
+}
+
+func (b *fakeBucket) Upload(ctx context.Context, name string, content io.Reader, attrs map[string]string) error {
+	c, err := ioutil.ReadAll(content)
+	if err != nil {
+		return err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.uploads++
+	b.objects[name] = c
+	b.attrs[name] = attrs
+	return nil
+}
+
+func (b *fakeBucket) Download(ctx context.Context, name string) (io.ReadCloser, map[string]string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	c, ok := b.objects[name]
+	if !ok {
+		return nil, nil, fmt.Errorf("%w: %s", blobstore.ErrNotFound, name)
+	}
+	return ioutil.NopCloser(bytes.NewReader(c)), b.attrs[name], nil
+}
+
+func (b *fakeBucket) Exists(ctx context.Context, name string) (bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	_, ok := b.objects[name]
+	return ok, nil
+}
+
+func (b *fakeBucket) Remove(ctx context.Context, name string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.objects, name)
+	delete(b.attrs, name)
+	return nil
+}
+
+func stores(t *testing.T) map[string]blobstore.Store {
+	t.Helper()
+	dir, err := blobstore.NewDir(t.TempDir())
+	if err != nil {
+		t.Fatalf("blobstore.NewDir() got err: %v", err)
+	}
+	return map[string]blobstore.Store{
+		"Dir":    dir,
+		"Memory": blobstore.NewMemory(),
+		"Bucket": blobstore.NewBucketStore(newFakeBucket(), "blobs/"),
+	}
+}
+
+// helloKey is the SHA-256 hash of "hello".
+const helloKey = blobstore.Key("2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824")
+
+func TestStores(t *testing.T) {
+	ctx := context.Background()
+	for name, s := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			key, err := s.Put(ctx, bytes.NewReader([]byte("hello")), blobstore.Metadata{ContentType: "text/plain", Filename: "a.txt"})
+			if err != nil {
+				t.Fatalf("Put() got err: %v", err)
+			}
+			if key != helloKey {
+				t.Errorf("Put() got key %s, want %s", key, helloKey)
+			}
+			// Identical content is deduplicated, keeping the first metadata.
+			key2, err := s.Put(ctx, bytes.NewReader([]byte("hello")), blobstore.Metadata{Filename: "b.txt"})
+			if err != nil || key2 != key {
+				t.Errorf("second Put() got key %s, err %v, want %s", key2, err, key)
+			}
+
+			rc, md, err := s.Open(ctx, key)
+			if err != nil {
+				t.Fatalf("Open() got err: %v", err)
+			}
+			b, _ := ioutil.ReadAll(rc)
+			rc.Close()
+			if string(b) != "hello" {
+				t.Errorf("Open() got content %q, want %q", b, "hello")
+			}
+			want := blobstore.Metadata{ContentType: "text/plain", Filename: "a.txt", Size: 5}
+			if diff := cmp.Diff(want, md); diff != "" {
+				t.Errorf("Open() metadata -want +got:\n%s", diff)
+			}
+
+			if err := s.Delete(ctx, key); err != nil {
+				t.Fatalf("Delete() got err: %v", err)
+			}
+			if _, _, err := s.Open(ctx, key); !errors.Is(err, blobstore.ErrNotFound) {
+				t.Errorf("Open() after Delete() got err: %v, want %v", err, blobstore.ErrNotFound)
+			}
+			if err := s.Delete(ctx, key); err != nil {
+				t.Errorf("Delete() of deleted blob got err: %v", err)
+			}
+		})
+	}
+}
+
+func TestBucketStoreDedupe(t *testing.T) {
+	b := newFakeBucket()
+	s := blobstore.NewBucketStore(b, "")
+	for i := 0; i < 3; i++ {
+		if _, err := s.Put(context.Background(), bytes.NewReader([]byte("hello")), blobstore.Metadata{}); err != nil {
+			t.Fatalf("Put() got err: %v", err)
+		}
+	}
+	if b.uploads != 1 {
+		t.Errorf("uploads: got %d, want 1", b.uploads)
+	}
+}
+
+func TestParseKey(t *testing.T) {
+	if _, err := blobstore.ParseKey(helloKey.String()); err != nil {
+		t.Errorf("ParseKey(%q) got err: %v", helloKey, err)
+	}
+	for _, s := range []string{"", "../../etc/passwd", "2CF24DBA5FB0A30E26E83B2AC5B9E29E1B161E5C1FA7425E73043362938B9824", "abc"} {
+		if _, err := blobstore.ParseKey(s); err == nil {
+			t.Errorf("ParseKey(%q) got nil err, want error", s)
+		}
+	}
+}
+
+func TestHandler(t *testing.T) {
+	s := blobstore.NewMemory()
+	key, err := s.Put(context.Background(), bytes.NewReader([]byte("hello")), blobstore.Metadata{ContentType: "text/html", Filename: "a b.html"})
+	if err != nil {
+		t.Fatalf("Put() got err: %v", err)
+	}
+	mux := safehttp.NewServeMuxConfig(nil).Mux()
+	mux.Handle("/blobs/", safehttp.MethodGet, blobstore.Handler(s))
+
+	tests := []struct {
+		name, path string
+		wantStatus int
+	}{
+		{name: "Found", path: "/blobs/" + key.String(), wantStatus: http.StatusOK},
+		{name: "Missing", path: "/blobs/" + strings.Repeat("0", 64), wantStatus: http.StatusNotFound},
+		{name: "Invalid key", path: "/blobs/foo", wantStatus: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "https://foo.com"+tt.path, nil))
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("status: got %d, want %d", rr.Code, tt.wantStatus)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			if got, want := rr.Header().Get("Content-Type"), "application/octet-stream"; got != want {
+				t.Errorf("Content-Type: got %q, want %q", got, want)
+			}
+			if got, want := rr.Header().Get("Content-Disposition"), `attachment; filename="a b.html"`; got != want {
+				t.Errorf("Content-Disposition: got %q, want %q", got, want)
+			}
+			if got := rr.Body.String(); got != "hello" {
+				t.Errorf("body: got %q, want %q", got, "hello")
+			}
+		})
+	}
+}
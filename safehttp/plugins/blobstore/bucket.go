@@ -0,0 +1,124 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blobstore
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+)
+
+// Bucket is the subset of the operations of object storage services, such as
+// S3 or GCS, needed by BucketStore. It's meant to be implemented on top of
+// their client libraries.
+type Bucket interface {
+	// Upload stores the object with the given name, content and attributes.
+	Upload(ctx context.Context, name string, content io.Reader, attrs map[string]string) error
+	// Download returns the content and the attributes of the object. It
+	// returns an error wrapping ErrNotFound if there is no such object.
+	Download(ctx context.Context, name string) (io.ReadCloser, map[string]string, error)
+	// Exists reports whether the object exists.
+	Exists(ctx context.Context, name string) (bool, error)
+	// Remove removes the object. Removing an object that doesn't exist is not
+	// an error.
+	Remove(ctx context.Context, name string) error
+}
+
+// The attributes the metadata of blobs is stored in.
+const (
+	attrContentType = "content-type"
+	attrFilename    = "filename"
+	attrSize        = "size"
+)
+
+// BucketStore is a Store keeping blobs as objects of a Bucket.
+type BucketStore struct {
+	bucket Bucket
+	prefix string
+}
+
+var _ Store = BucketStore{}
+
+// NewBucketStore creates a Store keeping blobs in the bucket, as objects named
+// after their key, with the given prefix, e.g. "blobs/".
+func NewBucketStore(b Bucket, prefix string) BucketStore {
+	return BucketStore{bucket: b, prefix: prefix}
+}
+
+// Put stores the content in the bucket. As the key must be known before the
+// upload starts, the content is first spooled to a temporary file.
+func (s BucketStore) Put(ctx context.Context, content io.Reader, md Metadata) (Key, error) {
+	tmp, err := ioutil.TempFile("", "blobstore-")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+	hr := newHashingReader(content)
+	if _, err := io.Copy(tmp, hr); err != nil {
+		return "", err
+	}
+	key := hr.key()
+
+	name := s.prefix + string(key)
+	exists, err := s.bucket.Exists(ctx, name)
+	if err != nil {
+		return "", err
+	}
+	if exists {
+		// Deduplicated.
+		return key, nil
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	attrs := map[string]string{
+		attrContentType: md.ContentType,
+		attrFilename:    md.Filename,
+		attrSize:        strconv.FormatInt(hr.size, 10),
+	}
+	if err := s.bucket.Upload(ctx, name, tmp, attrs); err != nil {
+		return "", fmt.Errorf("uploading blob %s: %v", key, err)
+	}
+	return key, nil
+}
+
+// Open downloads the blob from the bucket.
+func (s BucketStore) Open(ctx context.Context, key Key) (io.ReadCloser, Metadata, error) {
+	if _, err := ParseKey(string(key)); err != nil {
+		return nil, Metadata{}, err
+	}
+	rc, attrs, err := s.bucket.Download(ctx, s.prefix+string(key))
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	size, _ := strconv.ParseInt(attrs[attrSize], 10, 64)
+	return rc, Metadata{
+		ContentType: attrs[attrContentType],
+		Filename:    attrs[attrFilename],
+		Size:        size,
+	}, nil
+}
+
+// Delete removes the blob from the bucket.
+func (s BucketStore) Delete(ctx context.Context, key Key) error {
+	if _, err := ParseKey(string(key)); err != nil {
+		return err
+	}
+	return s.bucket.Remove(ctx, s.prefix+string(key))
+}
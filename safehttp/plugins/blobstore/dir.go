@@ -0,0 +1,129 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blobstore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// Dir is a Store keeping blobs in a local directory. Each blob is stored in a
+// file named after its key, in a subdirectory named after the first two
+// characters of the key, next to a JSON file holding its metadata.
+type Dir struct {
+	root string
+}
+
+var _ Store = (*Dir)(nil)
+
+// NewDir creates a Store keeping blobs in the root directory, which is created
+// if needed.
+func NewDir(root string) (*Dir, error) {
+	if err := os.MkdirAll(root, 0o700); err != nil {
+		return nil, err
+	}
+	return &Dir{root: root}, nil
+}
+
+func (d *Dir) path(key Key) string {
+	return filepath.Join(d.root, string(key[:2]), string(key))
+}
+
+// Put stores the content in the directory.
+func (d *Dir) Put(ctx context.Context, content io.Reader, md Metadata) (Key, error) {
+	tmp, err := ioutil.TempFile(d.root, ".upload-")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	hr := newHashingReader(content)
+	_, err = io.Copy(tmp, hr)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return "", err
+	}
+	key := hr.key()
+	md.Size = hr.size
+
+	p := d.path(key)
+	if _, err := os.Stat(p); err == nil {
+		// Deduplicated.
+		return key, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0o700); err != nil {
+		return "", err
+	}
+	b, err := json.Marshal(md)
+	if err != nil {
+		return "", err
+	}
+	// The metadata is written first, so that a blob is never visible without
+	// its metadata.
+	if err := ioutil.WriteFile(p+".json", b, 0o600); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp.Name(), p); err != nil {
+		return "", err
+	}
+	return key, nil
+}
+
+// Open opens the blob from the directory.
+func (d *Dir) Open(ctx context.Context, key Key) (io.ReadCloser, Metadata, error) {
+	if _, err := ParseKey(string(key)); err != nil {
+		return nil, Metadata{}, err
+	}
+	p := d.path(key)
+	f, err := os.Open(p)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, Metadata{}, fmt.Errorf("%w: %s", ErrNotFound, key)
+	}
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	var md Metadata
+	b, err := ioutil.ReadFile(p + ".json")
+	if err == nil {
+		err = json.Unmarshal(b, &md)
+	}
+	if err != nil {
+		f.Close()
+		return nil, Metadata{}, err
+	}
+	return f, md, nil
+}
+
+// Delete removes the blob from the directory.
+func (d *Dir) Delete(ctx context.Context, key Key) error {
+	if _, err := ParseKey(string(key)); err != nil {
+		return err
+	}
+	p := d.path(key)
+	if err := os.Remove(p); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if err := os.Remove(p + ".json"); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
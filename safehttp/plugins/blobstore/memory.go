@@ -0,0 +1,78 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blobstore
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sync"
+)
+
+// Memory is a Store keeping blobs in main memory, e.g. for tests.
+type Memory struct {
+	mu    sync.Mutex
+	blobs map[Key]memoryBlob
+}
+
+type memoryBlob struct {
+	content []byte
+	md      Metadata
+}
+
+var _ Store = (*Memory)(nil)
+
+// NewMemory creates an empty Memory store.
+func NewMemory() *Memory {
+	return &Memory{blobs: map[Key]memoryBlob{}}
+}
+
+// Put stores the content in memory.
+func (m *Memory) Put(ctx context.Context, content io.Reader, md Metadata) (Key, error) {
+	hr := newHashingReader(content)
+	b, err := ioutil.ReadAll(hr)
+	if err != nil {
+		return "", err
+	}
+	key := hr.key()
+	md.Size = hr.size
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.blobs[key]; !ok {
+		m.blobs[key] = memoryBlob{content: b, md: md}
+	}
+	return key, nil
+}
+
+// Open returns the blob from memory.
+func (m *Memory) Open(ctx context.Context, key Key) (io.ReadCloser, Metadata, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	b, ok := m.blobs[key]
+	if !ok {
+		return nil, Metadata{}, fmt.Errorf("%w: %s", ErrNotFound, key)
+	}
+	return ioutil.NopCloser(bytes.NewReader(b.content)), b.md, nil
+}
+
+// Delete removes the blob from memory.
+func (m *Memory) Delete(ctx context.Context, key Key) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.blobs, key)
+	return nil
+}
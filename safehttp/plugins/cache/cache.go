@@ -0,0 +1,161 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package cache provides a safehttp.Interceptor setting the Cache-Control
+// header of responses, and helpers for conditional requests.
+//
+// Responses are not stored by browsers or shared caches unless their handler
+// explicitly opts into caching with a Policy: caching a page holding private
+// data, e.g. on a shared proxy, is a common vulnerability.
+//
+// # Usage
+//
+//	cfg.Intercept(cache.Interceptor{})
+//	mux.Handle("/logo.png", safehttp.MethodGet, logoHandler, cache.Policy{Public: true, MaxAge: 24 * time.Hour})
+//
+// Handlers serving cacheable content can answer conditional requests:
+//
+//	if res, ok := cache.Check(w, r, cache.ETag(content)); !ok {
+//		return res
+//	}
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/go-safeweb/safehttp"
+)
+
+// Policy is a safehttp.InterceptorConfig controlling the Cache-Control
+// header of the responses of a handler.
+//
+// The zero value forbids storing responses, which is the policy of
+// handlers registered without a Policy.
+type Policy struct {
+	// Public allows shared caches, e.g. proxies or CDNs, to store the
+	// responses. Only set it for handlers serving the same response to all
+	// users.
+	Public bool
+	// MaxAge is how long the response is fresh, rounded to seconds. If zero
+	// and NoCache is false, the response is not stored.
+	MaxAge time.Duration
+	// NoCache allows storing the response, but it must be revalidated before
+	// each use, e.g. with Check.
+	NoCache bool
+	// Immutable tells browsers the response won't change while fresh, e.g.
+	// for versioned static files.
+	Immutable bool
+}
+
+// String serializes the policy. The returned value can be used as a header
+// value.
+func (p Policy) String() string {
+	maxAge := int64(p.MaxAge / time.Second)
+	if maxAge <= 0 && !p.NoCache {
+		return "no-store"
+	}
+	directives := []string{"private"}
+	if p.Public {
+		directives[0] = "public"
+	}
+	if p.NoCache {
+		directives = append(directives, "no-cache")
+	}
+	if maxAge > 0 {
+		directives = append(directives, "max-age="+strconv.FormatInt(maxAge, 10))
+		if p.Immutable {
+			directives = append(directives, "immutable")
+		}
+	}
+	return strings.Join(directives, ", ")
+}
+
+// Interceptor sets the Cache-Control header according to the Policy of the
+// handler, forbidding storage by default.
+type Interceptor struct{}
+
+var _ safehttp.Interceptor = Interceptor{}
+
+type setterKey struct{}
+
+// Before claims the Cache-Control header and sets it according to cfg.
+func (Interceptor) Before(w safehttp.ResponseWriter, r *safehttp.IncomingRequest, cfg safehttp.InterceptorConfig) safehttp.Result {
+	var p Policy
+	if cfg != nil {
+		p = cfg.(Policy)
+	}
+	set := w.Header().Claim("Cache-Control")
+	set([]string{p.String()})
+	safehttp.FlightValues(r.Context()).Put(setterKey{}, set)
+	return safehttp.NotWritten()
+}
+
+// Commit forbids storing error responses, as they can be transient and can
+// reveal why a request failed.
+func (Interceptor) Commit(w safehttp.ResponseHeadersWriter, r *safehttp.IncomingRequest, resp safehttp.Response, cfg safehttp.InterceptorConfig) {
+	er, ok := resp.(safehttp.ErrorResponse)
+	if !ok || er.Code() < 400 {
+		return
+	}
+	if set, ok := safehttp.FlightValues(r.Context()).Get(setterKey{}).(func([]string)); ok {
+		set([]string{"no-store"})
+	}
+}
+
+// Match recognizes Policies as cache configurations.
+func (Interceptor) Match(cfg safehttp.InterceptorConfig) bool {
+	_, ok := cfg.(Policy)
+	return ok
+}
+
+// ETag returns a strong entity tag for the given content.
+func ETag(content []byte) string {
+	sum := sha256.Sum256(content)
+	return `"` + base64.RawURLEncoding.EncodeToString(sum[:16]) + `"`
+}
+
+// Check sets the ETag header of the response to etag and evaluates the
+// If-None-Match header of GET and HEAD requests against it. If the client
+// has the current version, a 304 Not Modified response is written and the
+// returned Result should be returned by the handler. Otherwise, ok is true
+// and the handler can proceed.
+func Check(w safehttp.ResponseWriter, r *safehttp.IncomingRequest, etag string) (res safehttp.Result, ok bool) {
+	w.Header().Set("ETag", etag)
+	if m := r.Method(); m != safehttp.MethodGet && m != safehttp.MethodHead {
+		return safehttp.NotWritten(), true
+	}
+	if inm := r.Header.Get("If-None-Match"); inm != "" && noneMatchFails(inm, etag) {
+		return w.WriteError(safehttp.StatusNotModified), false
+	}
+	return safehttp.NotWritten(), true
+}
+
+// noneMatchFails implements the weak comparison of the If-None-Match header
+// value against the entity tag of the resource.
+func noneMatchFails(ifNoneMatch, etag string) bool {
+	if strings.TrimSpace(ifNoneMatch) == "*" {
+		return true
+	}
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, tag := range strings.Split(ifNoneMatch, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(tag), "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
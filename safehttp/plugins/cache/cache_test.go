@@ -0,0 +1,120 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/go-safeweb/safehttp"
+	"github.com/google/go-safeweb/safehttp/plugins/cache"
+)
+
+func TestPolicyString(t *testing.T) {
+	tests := []struct {
+		policy cache.Policy
+		want   string
+	}{
+		{policy: cache.Policy{}, want: "no-store"},
+		{policy: cache.Policy{Public: true}, want: "no-store"},
+		{policy: cache.Policy{MaxAge: time.Minute}, want: "private, max-age=60"},
+		{policy: cache.Policy{Public: true, MaxAge: 365 * 24 * time.Hour, Immutable: true}, want: "public, max-age=31536000, immutable"},
+		{policy: cache.Policy{NoCache: true}, want: "private, no-cache"},
+		{policy: cache.Policy{Public: true, NoCache: true, MaxAge: time.Hour}, want: "public, no-cache, max-age=3600"},
+	}
+	for _, tt := range tests {
+		if got := tt.policy.String(); got != tt.want {
+			t.Errorf("%+v.String(): got %q, want %q", tt.policy, got, tt.want)
+		}
+	}
+}
+
+const content = "hello"
+
+func newMux() *safehttp.ServeMux {
+	cfg := safehttp.NewServeMuxConfig(nil)
+	cfg.Intercept(cache.Interceptor{})
+	mux := cfg.Mux()
+	handler := safehttp.HandlerFunc(func(w safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+		if res, ok := cache.Check(w, r, cache.ETag([]byte(content))); !ok {
+			return res
+		}
+		return w.Write(safehttp.JSONResponse{Data: content})
+	})
+	mux.Handle("/private", safehttp.MethodGet, handler)
+	mux.Handle("/public", safehttp.MethodGet, handler, cache.Policy{Public: true, MaxAge: time.Hour})
+	mux.Handle("/error", safehttp.MethodGet, safehttp.HandlerFunc(func(w safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+		return w.WriteError(safehttp.StatusNotFound)
+	}), cache.Policy{Public: true, MaxAge: time.Hour})
+	return mux
+}
+
+func TestInterceptor(t *testing.T) {
+	tests := []struct {
+		name, path string
+		want       string
+	}{
+		{name: "Default", path: "/private", want: "no-store"},
+		{name: "Override", path: "/public", want: "public, max-age=3600"},
+		{name: "Error", path: "/error", want: "no-store"},
+	}
+	mux := newMux()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "https://foo.com"+tt.path, nil))
+			if got := rr.Header().Values("Cache-Control"); len(got) != 1 || got[0] != tt.want {
+				t.Errorf("Cache-Control: got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheck(t *testing.T) {
+	etag := cache.ETag([]byte(content))
+	tests := []struct {
+		name        string
+		ifNoneMatch string
+		wantStatus  int
+	}{
+		{name: "No header", wantStatus: http.StatusOK},
+		{name: "Match", ifNoneMatch: etag, wantStatus: http.StatusNotModified},
+		{name: "Weak match", ifNoneMatch: `"other", W/` + etag, wantStatus: http.StatusNotModified},
+		{name: "Star", ifNoneMatch: "*", wantStatus: http.StatusNotModified},
+		{name: "No match", ifNoneMatch: `"other"`, wantStatus: http.StatusOK},
+	}
+	mux := newMux()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "https://foo.com/public", nil)
+			if tt.ifNoneMatch != "" {
+				req.Header.Set("If-None-Match", tt.ifNoneMatch)
+			}
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, req)
+			if rr.Code != tt.wantStatus {
+				t.Errorf("status: got %d, want %d", rr.Code, tt.wantStatus)
+			}
+			if got := rr.Header().Get("ETag"); got != etag {
+				t.Errorf("ETag: got %q, want %q", got, etag)
+			}
+			if got, want := rr.Header().Get("Cache-Control"), "public, max-age=3600"; got != want {
+				t.Errorf("Cache-Control: got %q, want %q", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdn
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/go-safeweb/safehttp"
+)
+
+// CachePolicy is a safehttp.InterceptorConfig controlling how the CDN caches
+// the responses of a handler. It's set in the CDN-Cache-Control and
+// Surrogate-Control headers, which CDNs use instead of Cache-Control and don't
+// forward to browsers.
+//
+// The zero value tells the CDN not to store the responses, which is the
+// policy of handlers registered without a CachePolicy. Only use a
+// CachePolicy for handlers serving the same public response to all users.
+//
+// More info:
+//   - CDN-Cache-Control: https://datatracker.ietf.org/doc/html/rfc9213
+//   - Surrogate-Control: https://www.w3.org/TR/edge-arch/
+type CachePolicy struct {
+	// MaxAge is how long the CDN can serve the response from its cache,
+	// rounded to seconds. If zero, the response is not stored.
+	MaxAge time.Duration
+	// StaleWhileRevalidate is how long the CDN can serve the response after
+	// it expired, while fetching a fresh one.
+	StaleWhileRevalidate time.Duration
+	// StaleIfError is how long the CDN can serve the response after it
+	// expired, when fetching a fresh one fails.
+	StaleIfError time.Duration
+}
+
+func (p CachePolicy) String() string {
+	maxAge := int64(p.MaxAge / time.Second)
+	if maxAge <= 0 {
+		return "no-store"
+	}
+	directives := []string{"max-age=" + strconv.FormatInt(maxAge, 10)}
+	if swr := int64(p.StaleWhileRevalidate / time.Second); swr > 0 {
+		directives = append(directives, "stale-while-revalidate="+strconv.FormatInt(swr, 10))
+	}
+	if sie := int64(p.StaleIfError / time.Second); sie > 0 {
+		directives = append(directives, "stale-if-error="+strconv.FormatInt(sie, 10))
+	}
+	return strings.Join(directives, ", ")
+}
+
+func claimCacheHeaders(h safehttp.Header) func(CachePolicy) {
+	setCDNCacheControl := h.Claim("CDN-Cache-Control")
+	setSurrogateControl := h.Claim("Surrogate-Control")
+	return func(p CachePolicy) {
+		v := []string{p.String()}
+		setCDNCacheControl(v)
+		setSurrogateControl(v)
+	}
+}
@@ -0,0 +1,135 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdn_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/go-safeweb/safehttp"
+	"github.com/google/go-safeweb/safehttp/plugins/cdn"
+)
+
+func TestCachePolicy(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy safehttp.InterceptorConfig
+		write  func(w safehttp.ResponseWriter) safehttp.Result
+		want   string
+	}{
+		{
+			name: "No policy",
+			want: "no-store",
+		},
+		{
+			name:   "Max age",
+			policy: cdn.CachePolicy{MaxAge: time.Hour},
+			want:   "max-age=3600",
+		},
+		{
+			name: "Stale",
+			policy: cdn.CachePolicy{
+				MaxAge:               time.Minute,
+				StaleWhileRevalidate: 30 * time.Second,
+				StaleIfError:         time.Hour,
+			},
+			want: "max-age=60, stale-while-revalidate=30, stale-if-error=3600",
+		},
+		{
+			name:   "Error response",
+			policy: cdn.CachePolicy{MaxAge: time.Hour},
+			write: func(w safehttp.ResponseWriter) safehttp.Result {
+				return w.WriteError(safehttp.StatusNotFound)
+			},
+			want: "no-store",
+		},
+		{
+			name:   "Setting cookies",
+			policy: cdn.CachePolicy{MaxAge: time.Hour},
+			write: func(w safehttp.ResponseWriter) safehttp.Result {
+				w.AddCookie(safehttp.NewCookie("session", "secret"))
+				return w.Write(safehttp.NoContentResponse{})
+			},
+			want: "no-store",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mc := safehttp.NewServeMuxConfig(nil)
+			mc.Intercept(cdn.Interceptor{})
+			mux := mc.Mux()
+			h := safehttp.HandlerFunc(func(w safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+				if tt.write != nil {
+					return tt.write(w)
+				}
+				return w.Write(safehttp.NoContentResponse{})
+			})
+			if tt.policy != nil {
+				mux.Handle("/", safehttp.MethodGet, h, tt.policy)
+			} else {
+				mux.Handle("/", safehttp.MethodGet, h)
+			}
+
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "https://foo.com/", nil))
+			for _, name := range []string{"CDN-Cache-Control", "Surrogate-Control"} {
+				if got := rr.Header().Get(name); got != tt.want {
+					t.Errorf("%s: got %q, want %q", name, got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+// cookieInterceptor adds a cookie in its Commit phase, like xsrfhtml or
+// session do.
+type cookieInterceptor struct{}
+
+func (cookieInterceptor) Before(w safehttp.ResponseWriter, r *safehttp.IncomingRequest, _ safehttp.InterceptorConfig) safehttp.Result {
+	return safehttp.NotWritten()
+}
+
+func (cookieInterceptor) Commit(w safehttp.ResponseHeadersWriter, r *safehttp.IncomingRequest, resp safehttp.Response, _ safehttp.InterceptorConfig) {
+	w.AddCookie(safehttp.NewCookie("xsrf-cookie", "secret"))
+}
+
+func (cookieInterceptor) Match(safehttp.InterceptorConfig) bool {
+	return false
+}
+
+func TestCachePolicyCookieSetInCommit(t *testing.T) {
+	// The Commit phases run in the reverse order, so cookieInterceptor's runs
+	// after cdn.Interceptor's.
+	mc := safehttp.NewServeMuxConfig(nil)
+	mc.Intercept(cookieInterceptor{})
+	mc.Intercept(cdn.Interceptor{})
+	mux := mc.Mux()
+	mux.Handle("/", safehttp.MethodGet, safehttp.HandlerFunc(func(w safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+		return w.Write(safehttp.NoContentResponse{})
+	}), cdn.CachePolicy{MaxAge: time.Hour})
+
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "https://foo.com/", nil))
+	if rr.Header().Get("Set-Cookie") == "" {
+		t.Fatal("Set-Cookie: got none, want the cookie added in Commit")
+	}
+	for _, name := range []string{"CDN-Cache-Control", "Surrogate-Control"} {
+		if got, want := rr.Header().Get(name), "no-store"; got != want {
+			t.Errorf("%s: got %q, want %q", name, got, want)
+		}
+	}
+}
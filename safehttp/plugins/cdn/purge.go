@@ -0,0 +1,226 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package cdn provides plugins for applications served through a CDN: managing
+// the caching of responses by the CDN, tagging them with surrogate keys and
+// purging cached resources when handlers modify them.
+//
+// # Usage
+//
+// Install an Interceptor using safehttp.ServeMuxConfig.Intercept, passing it a
+// Purger for the CDN in use. Handlers serving cacheable resources tag them
+// with AddSurrogateKeys, and handlers modifying them call SchedulePurge:
+//
+//	cfg.Intercept(cdn.Interceptor{Purger: purger})
+//
+// Responses are not cached by the CDN unless their handler is registered with
+// a CachePolicy:
+//
+//	mux.Handle("/items/", safehttp.MethodGet, items, cdn.CachePolicy{MaxAge: time.Hour})
+//
+//	// In the handler serving an item:
+//	cdn.AddSurrogateKeys(r.Context(), "item-"+id)
+//	// In the handler updating it:
+//	cdn.SchedulePurge(r.Context(), cdn.Purge{SurrogateKeys: []string{"item-" + id}})
+package cdn
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/google/go-safeweb/safehttp"
+)
+
+// Purge identifies cached resources to evict from the CDN.
+type Purge struct {
+	// URLs are the absolute URLs of the resources.
+	URLs []string
+	// SurrogateKeys are the surrogate keys the resources were tagged with.
+	SurrogateKeys []string
+}
+
+// Purger issues purges to a CDN.
+type Purger interface {
+	// Purge evicts the resources identified by p from the CDN cache.
+	Purge(ctx context.Context, p Purge) error
+}
+
+// Interceptor claims and sets the CDN cache headers and the Surrogate-Key
+// header, and issues the purges scheduled by handlers.
+type Interceptor struct {
+	// Purger issues the purges scheduled with SchedulePurge. If nil,
+	// scheduling a purge fails.
+	Purger Purger
+	// PurgeTimeout bounds the time spent issuing a purge. Defaults to
+	// DefaultPurgeTimeout.
+	PurgeTimeout time.Duration
+}
+
+// DefaultPurgeTimeout is the PurgeTimeout used if none is set.
+const DefaultPurgeTimeout = 30 * time.Second
+
+var (
+	_ safehttp.Interceptor = Interceptor{}
+	_ safehttp.Finisher    = Interceptor{}
+)
+
+type stateKey struct{}
+
+type state struct {
+	setKeys  func([]string)
+	setCache func(CachePolicy)
+	policy   CachePolicy
+	keys     []string
+	purger   Purger
+	purge    Purge
+}
+
+func stateFrom(ctx context.Context) (*state, error) {
+	s, ok := safehttp.FlightValues(ctx).Get(stateKey{}).(*state)
+	if !ok {
+		return nil, errors.New("cdn: Interceptor not installed")
+	}
+	return s, nil
+}
+
+// AddSurrogateKeys tags the response to the request with the given surrogate
+// keys, which are set in the Surrogate-Key header. Keys can't contain
+// whitespace or control characters.
+func AddSurrogateKeys(ctx context.Context, keys ...string) error {
+	s, err := stateFrom(ctx)
+	if err != nil {
+		return err
+	}
+	for _, k := range keys {
+		if err := validateKey(k); err != nil {
+			return err
+		}
+	}
+	s.keys = append(s.keys, keys...)
+	return nil
+}
+
+func validateKey(k string) error {
+	if k == "" {
+		return errors.New("cdn: empty surrogate key")
+	}
+	for _, c := range k {
+		if c <= ' ' || c == 0x7f {
+			return fmt.Errorf("cdn: invalid surrogate key %q", k)
+		}
+	}
+	return nil
+}
+
+// SchedulePurge schedules a purge, issued in the background once the response
+// to the request is written, unless it's an error response. Errors returned by
+// the Purger are logged, as the resource has already been modified.
+func SchedulePurge(ctx context.Context, p Purge) error {
+	s, err := stateFrom(ctx)
+	if err != nil {
+		return err
+	}
+	if s.purger == nil {
+		return errors.New("cdn: no Purger configured")
+	}
+	for _, k := range p.SurrogateKeys {
+		if err := validateKey(k); err != nil {
+			return err
+		}
+	}
+	s.purge.URLs = append(s.purge.URLs, p.URLs...)
+	s.purge.SurrogateKeys = append(s.purge.SurrogateKeys, p.SurrogateKeys...)
+	return nil
+}
+
+// Before claims the CDN-Cache-Control, Surrogate-Control and Surrogate-Key
+// headers.
+func (it Interceptor) Before(w safehttp.ResponseWriter, r *safehttp.IncomingRequest, cfg safehttp.InterceptorConfig) safehttp.Result {
+	s := &state{
+		setKeys:  w.Header().Claim("Surrogate-Key"),
+		setCache: claimCacheHeaders(w.Header()),
+		purger:   it.Purger,
+	}
+	if p, ok := cfg.(CachePolicy); ok {
+		s.policy = p
+	}
+	safehttp.FlightValues(r.Context()).Put(stateKey{}, s)
+	return safehttp.NotWritten()
+}
+
+// Commit sets the CDN cache headers, then, if the response isn't an error
+// response, sets the Surrogate-Key header.
+//
+// The CDN is told not to cache error responses and responses setting
+// cookies, whatever the CachePolicy. Cookies added by the Commit phases of
+// other interceptors are taken into account too.
+func (it Interceptor) Commit(w safehttp.ResponseHeadersWriter, r *safehttp.IncomingRequest, resp safehttp.Response, _ safehttp.InterceptorConfig) {
+	s, err := stateFrom(r.Context())
+	if err != nil {
+		// Before didn't run, e.g. because an earlier interceptor wrote the
+		// response.
+		return
+	}
+	if _, ok := resp.(safehttp.ErrorResponse); ok {
+		s.setCache(CachePolicy{})
+		return
+	}
+	// Cookies can still be added by the Commit phases of the interceptors
+	// installed before this one, so the decision is made once they all ran.
+	safehttp.AfterCommit(r, func(w safehttp.ResponseHeadersWriter, _ safehttp.Response) {
+		if len(w.Header().Values("Set-Cookie")) > 0 {
+			s.setCache(CachePolicy{})
+		} else {
+			s.setCache(s.policy)
+		}
+	})
+	if len(s.keys) > 0 {
+		s.setKeys([]string{strings.Join(s.keys, " ")})
+	}
+}
+
+// Finish issues the purge scheduled by the handler, unless the response is an
+// error response. The purge runs in its own goroutine, bounded by
+// PurgeTimeout, so that neither the client nor its disconnection affects it.
+func (it Interceptor) Finish(r *safehttp.IncomingRequest, sum safehttp.ResponseSummary, _ safehttp.InterceptorConfig) {
+	s, err := stateFrom(r.Context())
+	if err != nil {
+		return
+	}
+	if sum.Status >= 400 || (len(s.purge.URLs) == 0 && len(s.purge.SurrogateKeys) == 0) {
+		return
+	}
+	timeout := it.PurgeTimeout
+	if timeout == 0 {
+		timeout = DefaultPurgeTimeout
+	}
+	method, path, p := r.Method(), r.URL().Path(), s.purge
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		if err := s.purger.Purge(ctx, p); err != nil {
+			log.Printf("cdn: purging %v for %s %q: %v", p, method, path, err)
+		}
+	}()
+}
+
+// Match recognizes CachePolicies as CDN configurations.
+func (Interceptor) Match(cfg safehttp.InterceptorConfig) bool {
+	_, ok := cfg.(CachePolicy)
+	return ok
+}
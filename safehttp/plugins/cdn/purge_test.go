@@ -0,0 +1,131 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdn_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-safeweb/safehttp"
+	"github.com/google/go-safeweb/safehttp/plugins/cdn"
+)
+
+type fakePurger struct {
+	purges chan cdn.Purge
+}
+
+func (p *fakePurger) Purge(ctx context.Context, purge cdn.Purge) error {
+	if _, ok := ctx.Deadline(); !ok {
+		return errors.New("no deadline")
+	}
+	p.purges <- purge
+	return nil
+}
+
+func TestSurrogateKeys(t *testing.T) {
+	mc := safehttp.NewServeMuxConfig(nil)
+	mc.Intercept(cdn.Interceptor{})
+	mux := mc.Mux()
+	mux.Handle("/", safehttp.MethodGet, safehttp.HandlerFunc(func(w safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+		if err := cdn.AddSurrogateKeys(r.Context(), "items", "item-1"); err != nil {
+			t.Errorf("cdn.AddSurrogateKeys() got err: %v", err)
+		}
+		if err := cdn.AddSurrogateKeys(r.Context(), "item 2"); err == nil {
+			t.Error("cdn.AddSurrogateKeys() with whitespace got nil err, want error")
+		}
+		if !w.Header().IsClaimed("Surrogate-Key") {
+			t.Error(`w.Header().IsClaimed("Surrogate-Key") = false, want true`)
+		}
+		return w.Write(safehttp.NoContentResponse{})
+	}))
+
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "https://foo.com/", nil))
+	if got, want := rr.Header().Get("Surrogate-Key"), "items item-1"; got != want {
+		t.Errorf("Surrogate-Key: got %q, want %q", got, want)
+	}
+}
+
+func TestSchedulePurge(t *testing.T) {
+	tests := []struct {
+		name      string
+		fail      bool
+		wantPurge *cdn.Purge
+	}{
+		{
+			name: "Success",
+			wantPurge: &cdn.Purge{
+				URLs:          []string{"https://foo.com/items/1"},
+				SurrogateKeys: []string{"items", "item-1"},
+			},
+		},
+		{
+			name: "Error response",
+			fail: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &fakePurger{purges: make(chan cdn.Purge, 1)}
+			mc := safehttp.NewServeMuxConfig(nil)
+			mc.Intercept(cdn.Interceptor{Purger: p})
+			mux := mc.Mux()
+			mux.Handle("/", safehttp.MethodPost, safehttp.HandlerFunc(func(w safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+				cdn.SchedulePurge(r.Context(), cdn.Purge{URLs: []string{"https://foo.com/items/1"}, SurrogateKeys: []string{"items"}})
+				cdn.SchedulePurge(r.Context(), cdn.Purge{SurrogateKeys: []string{"item-1"}})
+				if tt.fail {
+					return w.WriteError(safehttp.StatusInternalServerError)
+				}
+				return w.Write(safehttp.NoContentResponse{})
+			}))
+
+			mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "https://foo.com/", nil))
+			if tt.wantPurge == nil {
+				select {
+				case got := <-p.purges:
+					t.Errorf("got purge %v, want none", got)
+				case <-time.After(10 * time.Millisecond):
+				}
+				return
+			}
+			select {
+			case got := <-p.purges:
+				if diff := cmp.Diff(*tt.wantPurge, got); diff != "" {
+					t.Errorf("purge mismatch (-want +got):\n%s", diff)
+				}
+			case <-time.After(time.Second):
+				t.Error("purge not issued")
+			}
+		})
+	}
+}
+
+func TestSchedulePurgeNoPurger(t *testing.T) {
+	mc := safehttp.NewServeMuxConfig(nil)
+	mc.Intercept(cdn.Interceptor{})
+	mux := mc.Mux()
+	mux.Handle("/", safehttp.MethodPost, safehttp.HandlerFunc(func(w safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+		if err := cdn.SchedulePurge(r.Context(), cdn.Purge{URLs: []string{"https://foo.com/"}}); err == nil {
+			t.Error("cdn.SchedulePurge() without a Purger got nil err, want error")
+		}
+		return w.Write(safehttp.NoContentResponse{})
+	}))
+	mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "https://foo.com/", nil))
+}
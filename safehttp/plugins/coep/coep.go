@@ -0,0 +1,114 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package coep provides Cross-Origin-Embedder-Policy protection. Specification: https://html.spec.whatwg.org/#coep
+//
+// COEP, together with a same-origin COOP (see the coop package), makes a
+// document cross-origin isolated.
+package coep
+
+import (
+	"github.com/google/go-safeweb/safehttp"
+)
+
+var _ safehttp.Interceptor = Interceptor{}
+
+// Mode represents a COEP mode.
+type Mode string
+
+const (
+	// RequireCorp only allows loading cross-origin resources that explicitly grant permission, using CORS or a Cross-Origin-Resource-Policy.
+	RequireCorp Mode = "require-corp"
+	// Credentialless allows loading cross-origin no-cors resources, but without credentials.
+	Credentialless Mode = "credentialless"
+	// UnsafeNone disables COEP: this is the default value in browsers.
+	UnsafeNone Mode = "unsafe-none"
+)
+
+// Policy represents a Cross-Origin-Embedder-Policy value.
+type Policy struct {
+	// Mode is the mode for the policy.
+	Mode Mode
+	// ReportingGroup is an optional reporting group that needs to be defined with the Reporting API.
+	ReportingGroup string
+	// ReportOnly makes the policy report-only if set.
+	ReportOnly bool
+}
+
+// String serializes the policy. The returned value can be used as a header value.
+func (p Policy) String() string {
+	if p.ReportingGroup == "" {
+		return string(p.Mode)
+	}
+	return string(p.Mode) + `; report-to="` + p.ReportingGroup + `"`
+}
+
+type serializedPolicies struct {
+	rep []string
+	enf []string
+}
+
+func serializePolicies(policies ...Policy) serializedPolicies {
+	var s serializedPolicies
+	for _, p := range policies {
+		if p.ReportOnly {
+			s.rep = append(s.rep, p.String())
+		} else {
+			s.enf = append(s.enf, p.String())
+		}
+	}
+	return s
+}
+
+// NewInterceptor constructs an interceptor that applies the given policies.
+func NewInterceptor(policies ...Policy) Interceptor {
+	return Interceptor(serializePolicies(policies...))
+}
+
+// Default returns a require-corp enforcing interceptor with the given (potentially empty) report group.
+func Default(reportGroup string) Interceptor {
+	return NewInterceptor(Policy{Mode: RequireCorp, ReportingGroup: reportGroup})
+}
+
+// Interceptor is the interceptor for COEP.
+type Interceptor serializedPolicies
+
+// Before claims and sets the Report-Only and Enforcement headers for COEP.
+func (it Interceptor) Before(w safehttp.ResponseWriter, r *safehttp.IncomingRequest, cfg safehttp.InterceptorConfig) safehttp.Result {
+	if cfg != nil {
+		// We got an override, run its Before phase instead.
+		return Interceptor(cfg.(Overrider)).Before(w, r, nil)
+	}
+	w.Header().Claim("Cross-Origin-Embedder-Policy")(it.enf)
+	w.Header().Claim("Cross-Origin-Embedder-Policy-Report-Only")(it.rep)
+	return safehttp.NotWritten()
+}
+
+// Commit is a no-op, required to satisfy the safehttp.Interceptor interface.
+func (it Interceptor) Commit(w safehttp.ResponseHeadersWriter, r *safehttp.IncomingRequest, resp safehttp.Response, _ safehttp.InterceptorConfig) {
+}
+
+// Match recognizes Overriders as COEP configurations.
+func (it Interceptor) Match(cfg safehttp.InterceptorConfig) bool {
+	_, ok := cfg.(Overrider)
+	return ok
+}
+
+// Overrider is a safehttp.InterceptorConfig that allows to override COEP for a specific handler.
+type Overrider serializedPolicies
+
+// Override creates an Overrider with the given policies.
+func Override(reason string, policies ...Policy) Overrider {
+	return Overrider(serializePolicies(policies...))
+}
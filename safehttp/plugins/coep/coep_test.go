@@ -0,0 +1,124 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package coep
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-safeweb/safehttp"
+	"github.com/google/go-safeweb/safehttp/safehttptest"
+)
+
+func TestBefore(t *testing.T) {
+	type want struct {
+		enf, rep []string
+	}
+	var tests = []struct {
+		name                 string
+		interceptor          Interceptor
+		overrider            Overrider
+		want, wantOverridden want
+	}{
+		{
+			name:           "No policies, override on header",
+			interceptor:    NewInterceptor(),
+			overrider:      Override("testing", Policy{Mode: RequireCorp}),
+			wantOverridden: want{enf: []string{"require-corp"}},
+		},
+		{
+			name:        "Default",
+			interceptor: Default("coep"),
+			want:        want{enf: []string{`require-corp; report-to="coep"`}},
+		},
+		{
+			name: "policies, override disables enf",
+			interceptor: NewInterceptor(Policy{
+				Mode:           Credentialless,
+				ReportingGroup: "coep-cl",
+			}, Policy{
+				Mode:           RequireCorp,
+				ReportingGroup: "coep-rc",
+				ReportOnly:     true,
+			}),
+			overrider: Override("testing", Policy{
+				Mode:           RequireCorp,
+				ReportingGroup: "coep-rc",
+				ReportOnly:     true,
+			}),
+			want: want{
+				enf: []string{`credentialless; report-to="coep-cl"`},
+				rep: []string{`require-corp; report-to="coep-rc"`},
+			},
+			wantOverridden: want{
+				rep: []string{`require-corp; report-to="coep-rc"`},
+			},
+		},
+		{
+			name: "multiple RO",
+			interceptor: NewInterceptor(Policy{
+				Mode: UnsafeNone,
+			}, Policy{
+				Mode:           RequireCorp,
+				ReportingGroup: "coep-rc",
+				ReportOnly:     true,
+			}, Policy{
+				Mode:           Credentialless,
+				ReportingGroup: "coep-cl",
+				ReportOnly:     true,
+			}),
+			want: want{
+				enf: []string{"unsafe-none"},
+				rep: []string{`require-corp; report-to="coep-rc"`, `credentialless; report-to="coep-cl"`},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			check := func(rr *httptest.ResponseRecorder, w want) {
+				t.Helper()
+				h := rr.Header()
+				enf, rep := h.Values("Cross-Origin-Embedder-Policy"), h.Values("Cross-Origin-Embedder-Policy-Report-Only")
+				if diff := cmp.Diff(w.enf, enf); diff != "" {
+					t.Errorf("Enforced COEP -want +got:\n%s", diff)
+				}
+				if diff := cmp.Diff(w.rep, rep); diff != "" {
+					t.Errorf("Report Only COEP -want +got:\n%s", diff)
+				}
+				if rr.Code != int(safehttp.StatusOK) {
+					t.Errorf("Status: got %v want: %v", rr.Code, safehttp.StatusOK)
+				}
+				if rr.Body.String() != "" {
+					t.Errorf("Got body: %q, didn't want one", rr.Body.String())
+				}
+			}
+			// Non overridden
+			{
+				fakeRW, rr := safehttptest.NewFakeResponseWriter()
+				req := safehttptest.NewRequest(safehttp.MethodGet, "/", nil)
+				tt.interceptor.Before(fakeRW, req, nil)
+				check(rr, tt.want)
+			}
+			// Overridden
+			{
+				fakeRW, rr := safehttptest.NewFakeResponseWriter()
+				req := safehttptest.NewRequest(safehttp.MethodGet, "/", nil)
+				tt.interceptor.Before(fakeRW, req, tt.overrider)
+				check(rr, tt.wantOverridden)
+			}
+		})
+	}
+}
@@ -14,8 +14,10 @@
 
 // Package collector provides a function for creating violation report handlers.
 // The created safehttp.Handler will be able to parse generic violation reports
-// as specified by https://w3c.github.io/reporting/ and CSP violation reports as
-// specified by https://www.w3.org/TR/CSP3/#deprecated-serialize-violation.
+// as specified by https://w3c.github.io/reporting/, CSP violation reports as
+// specified by https://www.w3.org/TR/CSP3/#deprecated-serialize-violation and
+// COOP violation reports as specified by
+// https://html.spec.whatwg.org/multipage/origin.html#reporting.
 package collector
 
 import (
@@ -40,9 +42,9 @@ type Report struct {
 	// which the report was generated.
 	UserAgent string
 	// Body contains the body of the report. This will be different for every Type.
-	// If Type is csp-violation then Body will be a CSPReport. Otherwise Body will
-	// be a map[string]interface{} containing the object that was passed, as unmarshalled
-	// using encoding/json.
+	// If Type is csp-violation then Body will be a CSPReport and if Type is coop
+	// then Body will be a COOPReport. Otherwise Body will be a map[string]interface{}
+	// containing the object that was passed, as unmarshalled using encoding/json.
 	Body interface{}
 }
 
@@ -84,6 +86,42 @@ type CSPReport struct {
 	ColumnNumber uint
 }
 
+// COOPReport represents a COOP violation report as specified by https://html.spec.whatwg.org/multipage/origin.html#reporting
+type COOPReport struct {
+	// Type is the kind of violation, e.g. "navigation-to-response" or
+	// "access-from-coop-page-to-opener".
+	Type string
+	// Disposition is either "enforce" or "reporting" depending on whether the
+	// Cross-Origin-Opener-Policy header or the Cross-Origin-Opener-Policy-Report-Only
+	// header is used.
+	Disposition string
+	// EffectivePolicy is the COOP mode of the document that was violated.
+	EffectivePolicy string
+	// PreviousResponseURL is the URL of the previous document of the browsing
+	// context, for navigation reports.
+	PreviousResponseURL string
+	// NextResponseURL is the URL of the next document of the browsing context,
+	// for navigation reports.
+	NextResponseURL string
+	// Referrer is the referrer of the navigation.
+	Referrer string
+	// Property is the window property that was accessed, for access reports.
+	Property string
+	// OpenerURL, OpenedWindowURL, OtherDocumentURL and InitialPopupURL are the
+	// URLs of the windows involved in an access report.
+	OpenerURL        string
+	OpenedWindowURL  string
+	OtherDocumentURL string
+	InitialPopupURL  string
+	// SourceFile represents the URL of the script in which the access
+	// occurred.
+	SourceFile string
+	// LineNumber is the line number at which the access occurred.
+	LineNumber uint
+	// ColumnNumber is the column number at which the access occurred.
+	ColumnNumber uint
+}
+
 // Handler builds a safehttp.Handler which calls the given handler or cspHandler when
 // a violation report is received. Make sure to register the handler to receive POST
 // requests. If the handler recieves anything other than POST requests it will
@@ -185,6 +223,7 @@ func handleDeprecatedCSPReports(h func(CSPReport), w safehttp.ResponseWriter, b
 
 var reportHandlers = map[string]func(json.RawMessage) (body interface{}, ok bool){
 	"csp-violation": cspViolationHandler,
+	"coop":          coopHandler,
 }
 
 func handleReport(h func(Report), w safehttp.ResponseWriter, b []byte) safehttp.Result {
@@ -271,3 +310,27 @@ func cspViolationHandler(m json.RawMessage) (body interface{}, ok bool) {
 		ColumnNumber:      r.ColumnNumber,
 	}, true
 }
+
+// coopHandler parses reports of type coop and returns a COOPReport.
+func coopHandler(m json.RawMessage) (body interface{}, ok bool) {
+	r := struct {
+		Type                string `json:"type"`
+		Disposition         string `json:"disposition"`
+		EffectivePolicy     string `json:"effectivePolicy"`
+		PreviousResponseURL string `json:"previousResponseURL"`
+		NextResponseURL     string `json:"nextResponseURL"`
+		Referrer            string `json:"referrer"`
+		Property            string `json:"property"`
+		OpenerURL           string `json:"openerURL"`
+		OpenedWindowURL     string `json:"openedWindowURL"`
+		OtherDocumentURL    string `json:"otherDocumentURL"`
+		InitialPopupURL     string `json:"initialPopupURL"`
+		SourceFile          string `json:"sourceFile"`
+		LineNumber          uint   `json:"lineNumber"`
+		ColumnNumber        uint   `json:"columnNumber"`
+	}{}
+	if err := json.Unmarshal(m, &r); err != nil {
+		return nil, false
+	}
+	return COOPReport(r), true
+}
@@ -150,6 +150,43 @@ func TestValidReport(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "coop",
+			report: `[{
+				"type": "coop",
+				"age": 5,
+				"url": "https://example.com/",
+				"userAgent": "chrome",
+				"body": {
+					"type": "access-from-coop-page-to-opener",
+					"disposition": "reporting",
+					"effectivePolicy": "same-origin",
+					"property": "postMessage",
+					"openerURL": "https://evil.com/",
+					"sourceFile": "https://example.com/app.js",
+					"lineNumber": 3,
+					"columnNumber": 14
+				}
+			}]`,
+			want: []collector.Report{
+				{
+					Type:      "coop",
+					Age:       5,
+					URL:       "https://example.com/",
+					UserAgent: "chrome",
+					Body: collector.COOPReport{
+						Type:            "access-from-coop-page-to-opener",
+						Disposition:     "reporting",
+						EffectivePolicy: "same-origin",
+						Property:        "postMessage",
+						OpenerURL:       "https://evil.com/",
+						SourceFile:      "https://example.com/app.js",
+						LineNumber:      3,
+						ColumnNumber:    14,
+					},
+				},
+			},
+		},
 	}
 
 	for _, tt := range tests {
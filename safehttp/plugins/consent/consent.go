@@ -0,0 +1,213 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package consent provides a plugin exposing the cookie consent of users to
+// handlers and templates, and gating non-essential cookies on it, to help
+// with GDPR and ePrivacy compliance.
+//
+// Consent is read from a cookie listing the granted categories, separated by
+// dots, e.g. "analytics.marketing". Essential cookies don't require consent.
+// Optionally, the Global Privacy Control (Sec-GPC: 1) header withdraws the
+// consent to all the non-essential categories.
+//
+// # Usage
+//
+// Install an Interceptor using safehttp.ServeMuxConfig.Intercept. Set
+// non-essential cookies with AddCookie:
+//
+//	consent.AddCookie(w, r, "analytics", safehttp.NewCookie("_ga", id))
+//
+// The consent cookie is claimed by the Interceptor: handlers store the
+// categories the user consented to with Record.
+//
+// Templates get the consentGranted function, to only include third-party
+// assets when allowed:
+//
+//	{{if consentGranted "marketing"}}<script src="https://ads.example.com/tag.js"></script>{{end}}
+//
+// The function must be declared when parsing the templates, e.g. with
+// consent.FuncMap, and is replaced for each response.
+package consent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/google/go-safeweb/safehttp"
+)
+
+// Essential is the category of the cookies strictly necessary to provide the
+// service, e.g. session cookies, which don't require consent.
+const Essential = "essential"
+
+// DefaultCookieName is the name of the consent cookie used when none is
+// configured.
+const DefaultCookieName = "consent"
+
+// TemplateFuncName is the name of the template function reporting whether a
+// category is granted.
+const TemplateFuncName = "consentGranted"
+
+// FuncMap returns a placeholder for the template function of the plugin, to
+// be passed to the Funcs method of templates before parsing them.
+func FuncMap() map[string]interface{} {
+	return map[string]interface{}{TemplateFuncName: func(string) bool { return false }}
+}
+
+// ErrNoConsent is returned when setting a cookie of a category the user
+// didn't consent to.
+var ErrNoConsent = errors.New("no consent for cookie category")
+
+// State is the consent of a user.
+type State struct {
+	granted map[string]bool
+}
+
+// Granted reports whether the user consented to the given category.
+func (s State) Granted(category string) bool {
+	return category == Essential || s.granted[category]
+}
+
+// Categories returns the non-essential categories the user consented to, in
+// lexicographical order.
+func (s State) Categories() []string {
+	var cats []string
+	for c := range s.granted {
+		cats = append(cats, c)
+	}
+	sort.Strings(cats)
+	return cats
+}
+
+type stateKey struct{}
+
+// flight is the consent of the user making a request.
+type flight struct {
+	state State
+	// consulted reports whether the consent was read, in which case the
+	// response can depend on it.
+	consulted bool
+	// cookieName is the name of the consent cookie, added with addCookie.
+	cookieName string
+	addCookie  func(*safehttp.Cookie) error
+}
+
+// FromContext returns the consent of the user making the request. Without an
+// installed Interceptor, only the Essential category is granted.
+func FromContext(ctx context.Context) State {
+	f, ok := safehttp.FlightValues(ctx).Get(stateKey{}).(*flight)
+	if !ok {
+		return State{}
+	}
+	f.consulted = true
+	return f.state
+}
+
+// AddCookie adds a cookie of the given category to the response if the user
+// consented to it. Otherwise, it returns ErrNoConsent.
+func AddCookie(w safehttp.ResponseWriter, r *safehttp.IncomingRequest, category string, c *safehttp.Cookie) error {
+	if !FromContext(r.Context()).Granted(category) {
+		return fmt.Errorf("%w: cookie %q of category %q", ErrNoConsent, c.Name(), category)
+	}
+	return w.AddCookie(c)
+}
+
+// Interceptor reads the consent of users.
+type Interceptor struct {
+	// CookieName is the name of the consent cookie. If empty,
+	// DefaultCookieName is used.
+	CookieName string
+	// HonorGPC withdraws the consent to all the non-essential categories of
+	// requests with the Sec-GPC: 1 header.
+	HonorGPC bool
+}
+
+var _ safehttp.Interceptor = Interceptor{}
+
+func (it Interceptor) cookieName() string {
+	if it.CookieName == "" {
+		return DefaultCookieName
+	}
+	return it.CookieName
+}
+
+// Before claims the consent cookie, reads the consent of the user and stores
+// it in the request context.
+func (it Interceptor) Before(w safehttp.ResponseWriter, r *safehttp.IncomingRequest, _ safehttp.InterceptorConfig) safehttp.Result {
+	name := it.cookieName()
+	add := w.Header().ClaimCookie(name, "consent.Interceptor")
+	s := State{granted: map[string]bool{}}
+	if c, err := r.Cookie(name); err == nil && !(it.HonorGPC && r.Header.Get("Sec-GPC") == "1") {
+		for _, cat := range strings.Split(c.Value(), ".") {
+			if cat != "" && cat != Essential {
+				s.granted[cat] = true
+			}
+		}
+	}
+	safehttp.FlightValues(r.Context()).Put(stateKey{}, &flight{state: s, cookieName: name, addCookie: add})
+	return safehttp.NotWritten()
+}
+
+// Commit adds the consentGranted function to safehttp.TemplateResponses. The
+// Cookie header, and the Sec-GPC one if HonorGPC is set, are added to the
+// Vary header of these responses, and of the ones whose handler read the
+// consent, so that shared caches don't serve them to users with another
+// consent.
+func (it Interceptor) Commit(w safehttp.ResponseHeadersWriter, r *safehttp.IncomingRequest, resp safehttp.Response, _ safehttp.InterceptorConfig) {
+	f, ok := safehttp.FlightValues(r.Context()).Get(stateKey{}).(*flight)
+	if !ok {
+		return
+	}
+	tmplResp, isTmpl := resp.(*safehttp.TemplateResponse)
+	if isTmpl || f.consulted {
+		w.Header().Vary("Cookie")
+		if it.HonorGPC {
+			w.Header().Vary("Sec-GPC")
+		}
+	}
+	if !isTmpl {
+		return
+	}
+	s := f.state
+	if tmplResp.FuncMap == nil {
+		tmplResp.FuncMap = map[string]interface{}{}
+	}
+	tmplResp.FuncMap[TemplateFuncName] = s.Granted
+}
+
+// Match returns false since there are no supported configurations.
+func (Interceptor) Match(safehttp.InterceptorConfig) bool {
+	return false
+}
+
+// Record stores the categories the user consented to in the consent cookie,
+// which expires after a year. The cookie is claimed by the Interceptor, which
+// must be installed.
+func Record(r *safehttp.IncomingRequest, categories ...string) error {
+	f, ok := safehttp.FlightValues(r.Context()).Get(stateKey{}).(*flight)
+	if !ok {
+		return errors.New("consent: Interceptor not installed")
+	}
+	for _, cat := range categories {
+		if cat == "" || strings.ContainsAny(cat, ". ,;\"\\") {
+			return fmt.Errorf("invalid consent category %q", cat)
+		}
+	}
+	c := safehttp.NewCookie(f.cookieName, strings.Join(categories, "."))
+	c.SetMaxAge(365 * 24 * 60 * 60)
+	return f.addCookie(c)
+}
@@ -0,0 +1,142 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package consent_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-safeweb/safehttp"
+	"github.com/google/go-safeweb/safehttp/plugins/consent"
+	"github.com/google/safehtml/template"
+)
+
+func TestConsent(t *testing.T) {
+	tests := []struct {
+		name           string
+		cookie         string
+		gpc            bool
+		wantCategories []string
+		wantCookies    []string
+		wantBody       string
+	}{
+		{
+			name:        "No consent",
+			wantCookies: []string{"session=s; HttpOnly; Secure; SameSite=Lax"},
+			wantBody:    "<p>essential</p>",
+		},
+		{
+			name:           "Consent",
+			cookie:         "marketing.analytics",
+			wantCategories: []string{"analytics", "marketing"},
+			wantCookies: []string{
+				"session=s; HttpOnly; Secure; SameSite=Lax",
+				"_ga=1; HttpOnly; Secure; SameSite=Lax",
+			},
+			wantBody: "<p>essential</p><script>ads</script>",
+		},
+		{
+			name:        "Global Privacy Control",
+			cookie:      "marketing.analytics",
+			gpc:         true,
+			wantCookies: []string{"session=s; HttpOnly; Secure; SameSite=Lax"},
+			wantBody:    "<p>essential</p>",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mc := safehttp.NewServeMuxConfig(nil)
+			mc.Intercept(consent.Interceptor{HonorGPC: true})
+			mux := mc.Mux()
+
+			tmpl := template.Must(template.New("").Funcs(consent.FuncMap()).Parse(
+				`<p>essential</p>{{if consentGranted "marketing"}}<script>ads</script>{{end}}`))
+			var gotCategories []string
+			mux.Handle("/", safehttp.MethodGet, safehttp.HandlerFunc(func(w safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+				gotCategories = consent.FromContext(r.Context()).Categories()
+				if err := consent.AddCookie(w, r, consent.Essential, safehttp.NewCookie("session", "s")); err != nil {
+					t.Errorf("consent.AddCookie(essential) got err: %v", err)
+				}
+				err := consent.AddCookie(w, r, "analytics", safehttp.NewCookie("_ga", "1"))
+				if granted := tt.wantCategories != nil; granted != (err == nil) || (!granted && !errors.Is(err, consent.ErrNoConsent)) {
+					t.Errorf("consent.AddCookie(analytics) got err: %v", err)
+				}
+				return safehttp.ExecuteTemplate(w, tmpl, nil)
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "https://foo.com/", nil)
+			if tt.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: consent.DefaultCookieName, Value: tt.cookie})
+			}
+			if tt.gpc {
+				req.Header.Set("Sec-GPC", "1")
+			}
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, req)
+
+			if diff := cmp.Diff(tt.wantCategories, gotCategories); diff != "" {
+				t.Errorf("categories mismatch (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tt.wantCookies, rr.Header()["Set-Cookie"]); diff != "" {
+				t.Errorf("Set-Cookie mismatch (-want +got):\n%s", diff)
+			}
+			if got := rr.Body.String(); got != tt.wantBody {
+				t.Errorf("rr.Body: got %q, want %q", got, tt.wantBody)
+			}
+			if got, want := rr.Header().Get("Vary"), "Cookie, Sec-Gpc"; got != want {
+				t.Errorf("Vary: got %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestRecord(t *testing.T) {
+	mc := safehttp.NewServeMuxConfig(nil)
+	mc.Intercept(consent.Interceptor{})
+	mux := mc.Mux()
+	mux.Handle("/", safehttp.MethodPost, safehttp.HandlerFunc(func(w safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+		if err := consent.Record(r, "analytics.x"); err == nil {
+			t.Error("consent.Record() with an invalid category got nil err, want error")
+		}
+		if err := w.AddCookie(safehttp.NewCookie(consent.DefaultCookieName, "marketing")); !errors.Is(err, safehttp.ErrCookieClaimed) {
+			t.Errorf("w.AddCookie(consent cookie): got err %v, want %v", err, safehttp.ErrCookieClaimed)
+		}
+		if err := consent.Record(r, "analytics", "marketing"); err != nil {
+			t.Errorf("consent.Record() got err: %v", err)
+		}
+		return w.Write(safehttp.NoContentResponse{})
+	}))
+
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "https://foo.com/", nil))
+	want := []string{"consent=analytics.marketing; Max-Age=31536000; HttpOnly; Secure; SameSite=Lax"}
+	if diff := cmp.Diff(want, rr.Header()["Set-Cookie"]); diff != "" {
+		t.Errorf("Set-Cookie mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestRecordNoInterceptor(t *testing.T) {
+	mux := safehttp.NewServeMuxConfig(nil).Mux()
+	mux.Handle("/", safehttp.MethodPost, safehttp.HandlerFunc(func(w safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+		if err := consent.Record(r, "analytics"); err == nil {
+			t.Error("consent.Record() without an Interceptor got nil err, want error")
+		}
+		return w.Write(safehttp.NoContentResponse{})
+	}))
+	mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "https://foo.com/", nil))
+}
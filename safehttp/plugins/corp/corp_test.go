@@ -0,0 +1,82 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package corp
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-safeweb/safehttp"
+	"github.com/google/go-safeweb/safehttp/safehttptest"
+)
+
+func TestBefore(t *testing.T) {
+	var tests = []struct {
+		name        string
+		interceptor Interceptor
+		overrider   safehttp.InterceptorConfig
+		want        []string
+	}{
+		{
+			name:        "Default",
+			interceptor: Default(),
+			want:        []string{"same-origin"},
+		},
+		{
+			name:        "Same site",
+			interceptor: Interceptor{Policy: SameSite},
+			want:        []string{"same-site"},
+		},
+		{
+			name:        "Empty",
+			interceptor: Interceptor{},
+		},
+		{
+			name:        "Override",
+			interceptor: Default(),
+			overrider:   Override("CDN images", CrossOrigin),
+			want:        []string{"cross-origin"},
+		},
+		{
+			name:        "Override disables",
+			interceptor: Default(),
+			overrider:   Override("testing", ""),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fakeRW, rr := safehttptest.NewFakeResponseWriter()
+			req := safehttptest.NewRequest(safehttp.MethodGet, "/", nil)
+			tt.interceptor.Before(fakeRW, req, tt.overrider)
+
+			if diff := cmp.Diff(tt.want, rr.Header().Values("Cross-Origin-Resource-Policy")); diff != "" {
+				t.Errorf("CORP -want +got:\n%s", diff)
+			}
+			if rr.Code != int(safehttp.StatusOK) {
+				t.Errorf("Status: got %v want: %v", rr.Code, safehttp.StatusOK)
+			}
+		})
+	}
+}
+
+func TestMatch(t *testing.T) {
+	it := Default()
+	if !it.Match(Override("testing", SameSite)) {
+		t.Error("Match(Overrider) got false, want true")
+	}
+	if it.Match(Default()) {
+		t.Error("Match(Interceptor) got true, want false")
+	}
+}
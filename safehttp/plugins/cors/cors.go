@@ -118,9 +118,6 @@ func (it *Interceptor) Before(w safehttp.ResponseWriter, r *safehttp.IncomingReq
 	}
 	h := w.Header()
 	allowOrigin := h.Claim("Access-Control-Allow-Origin")
-	if h.IsClaimed("Vary") {
-		return w.WriteError(safehttp.StatusInternalServerError)
-	}
 
 	allowCredentials := h.Claim("Access-Control-Allow-Credentials")
 
@@ -140,7 +137,7 @@ func (it *Interceptor) Before(w safehttp.ResponseWriter, r *safehttp.IncomingReq
 
 	if origin != "" {
 		allowOrigin([]string{origin})
-		appendToVary(w, "Origin")
+		h.Vary("Origin")
 	}
 	if r.Header.Get("Cookie") != "" && it.AllowCredentials {
 		// TODO: handle other credentials than cookies:
@@ -163,15 +160,6 @@ func (*Interceptor) Match(safehttp.InterceptorConfig) bool {
 	return false
 }
 
-func appendToVary(w safehttp.ResponseWriter, val string) {
-	h := w.Header()
-	if curr := h.Get("Vary"); curr != "" {
-		h.Set("Vary", curr+", "+val)
-	} else {
-		h.Set("Vary", val)
-	}
-}
-
 // preflight handles requests that have the method OPTIONS.
 func (it *Interceptor) preflight(w safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.StatusCode {
 	rh := r.Header
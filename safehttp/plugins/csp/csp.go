@@ -16,15 +16,13 @@
 // to responses.
 //
 // Three default policies are provided:
-//  - A strict nonce based CSP
+//  - A strict nonce based CSP, or a strict hash based CSP using HashBased
 //  - A framing policy which sets frame-ancestors to 'self'
 //  - A Trusted Types policy which makes usage of dangerous web API functions secure by default
 package csp
 
 import (
 	"context"
-	"crypto/rand"
-	"encoding/base64"
 	"errors"
 	"fmt"
 	"strings"
@@ -32,22 +30,20 @@ import (
 	"github.com/google/go-safeweb/safehttp/plugins/htmlinject"
 
 	"github.com/google/go-safeweb/safehttp"
+	"github.com/google/go-safeweb/safehttp/random"
 )
 
-var randReader = rand.Reader
-
 // nonceSize is the size of the nonces in bytes. According to the CSP3 spec it should
 // be larger than 16 bytes. 20 bytes was picked to be future proof.
 // https://www.w3.org/TR/CSP3/#security-nonces
 const nonceSize = 20
 
 func generateNonce() string {
-	b := make([]byte, nonceSize)
-	_, err := randReader.Read(b)
+	n, err := random.Token(nonceSize)
 	if err != nil {
-		panic(fmt.Errorf("failed to generate entropy using crypto/rand/RandReader: %v", err))
+		panic(fmt.Errorf("failed to generate CSP nonce: %v", err))
 	}
-	return base64.StdEncoding.EncodeToString(b)
+	return n
 }
 
 // Policy defines a CSP policy.
@@ -217,11 +213,9 @@ func (t TrustedTypesPolicy) Serialize(nonce string) string {
 	return b.String()
 }
 
-// Interceptor intercepts requests and applies CSP policies.
+// Interceptor intercepts requests and applies CSP policies. The policies can
+// be overridden for specific handlers using an Overrider.
 type Interceptor struct {
-	// TODO: move it to a safehttp.InterceptorConfig implementation to enable
-	// per-handler configuration.
-
 	// Enforce specifies which policies will be set as the Content-Security-Policy
 	// header.
 	Enforce []Policy
@@ -244,9 +238,26 @@ func Default(reportURI string) Interceptor {
 	}
 }
 
+// HashBased creates a new CSP interceptor with a strict hash-based policy
+// allowing the given hashes, a framing policy and a TrustedTypes policy. All in
+// enforcement mode.
+func HashBased(reportURI string, hashes ...string) Interceptor {
+	return Interceptor{
+		Enforce: []Policy{
+			HashPolicy{Hashes: hashes, ReportURI: reportURI},
+			FramingPolicy{ReportURI: reportURI},
+			TrustedTypesPolicy{ReportURI: reportURI},
+		},
+	}
+}
+
 // Before claims and sets the Content-Security-Policy header and the
 // Content-Security-Policy-Report-Only header.
-func (it Interceptor) Before(w safehttp.ResponseWriter, r *safehttp.IncomingRequest, _ safehttp.InterceptorConfig) safehttp.Result {
+func (it Interceptor) Before(w safehttp.ResponseWriter, r *safehttp.IncomingRequest, cfg safehttp.InterceptorConfig) safehttp.Result {
+	if cfg != nil {
+		// We got an override, run its Before phase instead.
+		return Interceptor(cfg.(Overrider)).Before(w, r, nil)
+	}
 	nonce := generateNonce()
 	safehttp.FlightValues(r.Context()).Put(nonceKey{}, nonce)
 
@@ -291,7 +302,19 @@ func (it Interceptor) Commit(w safehttp.ResponseHeadersWriter, r *safehttp.Incom
 	tmplResp.FuncMap[htmlinject.CSPNoncesDefaultFuncName] = func() string { return nonce }
 }
 
-// Match returns false since there are no supported configurations.
-func (Interceptor) Match(safehttp.InterceptorConfig) bool {
-	return false
+// Match recognizes Overriders as CSP configurations.
+func (Interceptor) Match(cfg safehttp.InterceptorConfig) bool {
+	_, ok := cfg.(Overrider)
+	return ok
+}
+
+// Overrider is a safehttp.InterceptorConfig that allows to override the CSP
+// policies for a specific handler, e.g. to use a HashPolicy for a static file
+// in which nonces can't be injected.
+type Overrider Interceptor
+
+// Override creates an Overrider applying the given policies instead of the
+// ones of the Interceptor.
+func Override(reason string, enforce []Policy, reportOnly []Policy) Overrider {
+	return Overrider{Enforce: enforce, ReportOnly: reportOnly}
 }
@@ -22,6 +22,7 @@ import (
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
 	"github.com/google/go-safeweb/safehttp"
+	"github.com/google/go-safeweb/safehttp/random"
 	"github.com/google/go-safeweb/safehttp/safehttptest"
 )
 
@@ -35,7 +36,7 @@ func (endlessAReader) Read(b []byte) (int, error) {
 }
 
 func TestMain(m *testing.M) {
-	randReader = endlessAReader{}
+	random.SetSourceForTesting(endlessAReader{})
 	os.Exit(m.Run())
 }
 
@@ -85,6 +86,30 @@ func TestSerialize(t *testing.T) {
 			}},
 			wantString: "object-src 'none'; script-src 'unsafe-inline' 'nonce-super-secret' 'strict-dynamic' https: http: 'sha256-CihokcEcBW4atb/CW/XWsvWwbTjqwQlE9nj9ii5ww5M=' 'sha256-CihokcEcBW4atb/CW/XWsvWwbTjqwQlE9nj9ii5ww5M='; base-uri 'none'",
 		},
+		{
+			name:       "HashCSP",
+			policy:     HashPolicy{Hashes: []string{"sha256-CihokcEcBW4atb/CW/XWsvWwbTjqwQlE9nj9ii5ww5M="}},
+			wantString: "object-src 'none'; script-src 'unsafe-inline' 'sha256-CihokcEcBW4atb/CW/XWsvWwbTjqwQlE9nj9ii5ww5M=' 'strict-dynamic' https: http:; base-uri 'none'",
+		},
+		{
+			name: "HashCSP with no strict-dynamic and report-uri",
+			policy: HashPolicy{
+				Hashes:          []string{"sha256-CihokcEcBW4atb/CW/XWsvWwbTjqwQlE9nj9ii5ww5M="},
+				NoStrictDynamic: true,
+				ReportURI:       "https://example.com/collector",
+			},
+			wantString: "object-src 'none'; script-src 'unsafe-inline' 'sha256-CihokcEcBW4atb/CW/XWsvWwbTjqwQlE9nj9ii5ww5M='; base-uri 'none'; report-uri https://example.com/collector",
+		},
+		{
+			name:       "HashCSP without hashes",
+			policy:     HashPolicy{},
+			wantString: "object-src 'none'; script-src 'strict-dynamic' https: http:; base-uri 'none'",
+		},
+		{
+			name:       "HashCSP without hashes and strict-dynamic",
+			policy:     HashPolicy{NoStrictDynamic: true},
+			wantString: "object-src 'none'; script-src 'none'; base-uri 'none'",
+		},
 		{
 			name:       "FramingCSP",
 			policy:     FramingPolicy{},
@@ -217,6 +242,26 @@ func TestBefore(t *testing.T) {
 	}
 }
 
+func TestBeforeOverride(t *testing.T) {
+	it := Default("")
+	cfg := Override("static file without nonces", []Policy{HashPolicy{Hashes: []string{"sha256-a"}}}, nil)
+	if !it.Match(cfg) {
+		t.Fatal("it.Match(Overrider) got false, want true")
+	}
+
+	fakeRW, rr := safehttptest.NewFakeResponseWriter()
+	req := safehttptest.NewRequest(safehttp.MethodGet, "/", nil)
+	it.Before(fakeRW, req, cfg)
+
+	want := []string{"object-src 'none'; script-src 'unsafe-inline' 'sha256-a' 'strict-dynamic' https: http:; base-uri 'none'"}
+	if diff := cmp.Diff(want, rr.Header().Values("Content-Security-Policy")); diff != "" {
+		t.Errorf("h.Values(\"Content-Security-Policy\") mismatch (-want +got):\n%s", diff)
+	}
+	if got := rr.Header().Values("Content-Security-Policy-Report-Only"); len(got) != 0 {
+		t.Errorf("h.Values(\"Content-Security-Policy-Report-Only\") got: %v want: none", got)
+	}
+}
+
 type errorReader struct{}
 
 func (errorReader) Read(b []byte) (int, error) {
@@ -224,11 +269,7 @@ func (errorReader) Read(b []byte) (int, error) {
 }
 
 func TestPanicWhileGeneratingNonce(t *testing.T) {
-	randReader = errorReader{}
-	defer func() {
-		// TODO: avoid replacing the randReader per individual test cases
-		randReader = endlessAReader{}
-	}()
+	defer random.SetSourceForTesting(errorReader{})()
 	defer func() {
 		if r := recover(); r != nil {
 			return
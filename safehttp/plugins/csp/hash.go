@@ -0,0 +1,170 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package csp
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/google/safehtml/template"
+	"golang.org/x/net/html"
+)
+
+// Hash returns the CSP hash of an inline script, e.g.
+// "sha256-CihokcEcBW4atb/CW/XWsvWwbTjqwQlE9nj9ii5ww5M=" for "console.log(1)",
+// to be allowed through the Hashes of a HashPolicy or a StrictPolicy.
+func Hash(script string) string {
+	sum := sha256.Sum256([]byte(script))
+	return "sha256-" + base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// TemplateHashes returns the CSP hashes of the inline scripts of the given
+// templates. Scripts containing template actions can't be hashed since their
+// contents are only known when the template is executed, and make
+// TemplateHashes fail: load them from a file or use a nonce-based policy.
+func TemplateHashes(tts ...template.TrustedTemplate) ([]string, error) {
+	var hashes []string
+	seen := map[string]bool{}
+	for _, tt := range tts {
+		scripts, err := inlineScripts(tt.String())
+		if err != nil {
+			return nil, err
+		}
+		for _, script := range scripts {
+			if strings.Contains(script, "{{") {
+				return nil, fmt.Errorf("inline script with template actions can't be hashed: %q", script)
+			}
+			if h := Hash(script); !seen[h] {
+				seen[h] = true
+				hashes = append(hashes, h)
+			}
+		}
+	}
+	return hashes, nil
+}
+
+// inlineScripts returns the contents of the <script> elements of an HTML
+// document which don't have a src attribute.
+func inlineScripts(doc string) ([]string, error) {
+	var scripts []string
+	z := html.NewTokenizer(strings.NewReader(doc))
+	inScript := false
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			if err := z.Err(); err != io.EOF {
+				return nil, err
+			}
+			return scripts, nil
+		case html.StartTagToken:
+			name, hasAttr := z.TagName()
+			inScript = string(name) == "script" && !hasSrc(z, hasAttr)
+		case html.TextToken:
+			if inScript {
+				scripts = append(scripts, string(z.Raw()))
+			}
+			inScript = false
+		default:
+			inScript = false
+		}
+	}
+}
+
+func hasSrc(z *html.Tokenizer, hasAttr bool) bool {
+	for hasAttr {
+		var key []byte
+		key, _, hasAttr = z.TagAttr()
+		if string(key) == "src" {
+			return true
+		}
+	}
+	return false
+}
+
+// HashPolicy can be used to build a strict, hash-based CSP, for responses
+// whose inline scripts are known in advance, e.g. static files, in which
+// nonces can't be injected.
+//
+// To allow both nonces and hashes, e.g. for templates loading inline scripts
+// computed with TemplateHashes, use the Hashes of a StrictPolicy instead.
+//
+// See https://csp.withgoogle.com/docs/strict-csp.html for more info.
+type HashPolicy struct {
+	// Hashes are the hashes of the allowed inline scripts, e.g. as returned
+	// by Hash or TemplateHashes.
+	Hashes []string
+	// NoStrictDynamic controls whether script-src should contain the
+	// 'strict-dynamic' value.
+	NoStrictDynamic bool
+	// UnsafeEval controls whether script-src should contain the 'unsafe-eval' value.
+	UnsafeEval bool
+	// BaseURI controls the base-uri directive. If BaseURI is an empty string the
+	// directive will be set to 'none'.
+	BaseURI string
+	// ReportURI controls the report-uri directive. If ReportUri is empty, no report-uri
+	// directive will be set.
+	ReportURI string
+}
+
+// Serialize serializes this policy for use in a Content-Security-Policy header
+// or in a Content-Security-Policy-Report-Only header. The nonce is not used.
+func (h HashPolicy) Serialize(nonce string) string {
+	var b strings.Builder
+
+	b.WriteString("object-src 'none'; script-src")
+	empty := true
+	if len(h.Hashes) > 0 {
+		// 'unsafe-inline' is ignored by browsers supporting hashes. Without
+		// any hash, it would allow all inline scripts.
+		b.WriteString(" 'unsafe-inline'")
+		empty = false
+	}
+	for _, h := range h.Hashes {
+		b.WriteString(" '")
+		b.WriteString(h)
+		b.WriteByte('\'')
+	}
+
+	if !h.NoStrictDynamic {
+		b.WriteString(" 'strict-dynamic' https: http:")
+		empty = false
+	}
+
+	if h.UnsafeEval {
+		b.WriteString(" 'unsafe-eval'")
+		empty = false
+	}
+
+	if empty {
+		b.WriteString(" 'none'")
+	}
+
+	b.WriteString("; base-uri ")
+	if h.BaseURI == "" {
+		b.WriteString("'none'")
+	} else {
+		b.WriteString(h.BaseURI)
+	}
+
+	if h.ReportURI != "" {
+		b.WriteString("; report-uri ")
+		b.WriteString(h.ReportURI)
+	}
+
+	return b.String()
+}
@@ -0,0 +1,48 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package csp
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/safehtml/template"
+)
+
+func TestHash(t *testing.T) {
+	if got, want := Hash("console.log(1)"), "sha256-CihokcEcBW4atb/CW/XWsvWwbTjqwQlE9nj9ii5ww5M="; got != want {
+		t.Errorf("Hash() got: %q want: %q", got, want)
+	}
+}
+
+func TestTemplateHashes(t *testing.T) {
+	got, err := TemplateHashes(
+		template.MakeTrustedTemplate(`<h1>{{.}}</h1><script>console.log(1)</script><script src="/app.js"></script>`),
+		template.MakeTrustedTemplate(`<script nonce="{{nonce}}">console.log(1)</script>`),
+	)
+	if err != nil {
+		t.Fatalf("TemplateHashes() got err: %v", err)
+	}
+	want := []string{"sha256-CihokcEcBW4atb/CW/XWsvWwbTjqwQlE9nj9ii5ww5M="}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("TemplateHashes() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestTemplateHashesDynamicScript(t *testing.T) {
+	if _, err := TemplateHashes(template.MakeTrustedTemplate(`<script>var x = {{.}};</script>`)); err == nil {
+		t.Error("TemplateHashes() got nil err, want error")
+	}
+}
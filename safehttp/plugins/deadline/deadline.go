@@ -0,0 +1,180 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package deadline propagates request deadlines between services through a
+// request header carrying the remaining time, in the format of the
+// grpc-timeout header (e.g. "250m" for 250 milliseconds).
+//
+// A relative timeout is used instead of an absolute deadline so that services
+// don't depend on their clocks being synchronized.
+//
+// # Usage
+//
+// On the receiving side, wrap the handlers with Handler: the context of the
+// requests gets the deadline specified by the caller. On the calling side, use
+// Transport for the http.Client making the downstream calls, passing it the
+// context of the incoming request:
+//
+//	client := &http.Client{Transport: deadline.Transport(nil, deadline.DefaultHeader)}
+//	req, err := http.NewRequestWithContext(r.Context(), http.MethodGet, url, nil)
+package deadline
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/go-safeweb/safehttp"
+)
+
+// DefaultHeader is the header used when none is configured.
+const DefaultHeader = "X-Request-Timeout"
+
+// maxDigits is the maximum number of digits of a timeout value, as in the
+// gRPC specification.
+const maxDigits = 8
+
+var units = []struct {
+	suffix byte
+	d      time.Duration
+}{
+	{'H', time.Hour},
+	{'M', time.Minute},
+	{'S', time.Second},
+	{'m', time.Millisecond},
+	{'u', time.Microsecond},
+	{'n', time.Nanosecond},
+}
+
+// Format formats a timeout in the finest unit which keeps the value within 8
+// digits, truncating it to that unit. Negative timeouts are formatted as zero.
+func Format(d time.Duration) string {
+	if d < 0 {
+		d = 0
+	}
+	for i := len(units) - 1; i >= 0; i-- {
+		u := units[i]
+		// Truncate so that the callee doesn't get more time than available.
+		n := d / u.d
+		if n < 1e8 || i == 0 {
+			return strconv.FormatInt(int64(n), 10) + string(u.suffix)
+		}
+	}
+	panic("unreachable")
+}
+
+// Parse parses a timeout formatted like the grpc-timeout header.
+func Parse(s string) (time.Duration, error) {
+	if len(s) < 2 || len(s) > maxDigits+1 {
+		return 0, fmt.Errorf("invalid timeout %q", s)
+	}
+	n, err := strconv.ParseUint(s[:len(s)-1], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid timeout %q", s)
+	}
+	for _, u := range units {
+		if u.suffix == s[len(s)-1] {
+			return time.Duration(n) * u.d, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid timeout unit in %q", s)
+}
+
+// Options configures Handler.
+type Options struct {
+	// Header is the header carrying the timeout. If empty, DefaultHeader is
+	// used.
+	Header string
+	// Max is the longest timeout accepted from callers, longer ones are
+	// capped to it. If zero, timeouts are not capped.
+	Max time.Duration
+}
+
+// Handler wraps h so that the context of the requests it serves gets the
+// deadline specified by the timeout header, if present. Requests with an
+// invalid timeout are responded to with 400 Bad Request.
+//
+// The deadline can only shorten the one the context already has.
+func Handler(h safehttp.Handler, opts Options) safehttp.Handler {
+	if opts.Header == "" {
+		opts.Header = DefaultHeader
+	}
+	return safehttp.HandlerFunc(func(w safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+		v := r.Header.Get(opts.Header)
+		if v == "" {
+			return h.ServeHTTP(w, r)
+		}
+		d, err := Parse(v)
+		if err != nil {
+			return w.WriteError(safehttp.StatusBadRequest)
+		}
+		if opts.Max > 0 && d > opts.Max {
+			d = opts.Max
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), d)
+		defer cancel()
+		return h.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// SetHeader sets the given header of an outgoing request to the time left
+// before the deadline of ctx. If ctx has no deadline the header is left
+// untouched. If the deadline has already passed, an error is returned.
+func SetHeader(ctx context.Context, h http.Header, name string) error {
+	dl, ok := ctx.Deadline()
+	if !ok {
+		return nil
+	}
+	left := time.Until(dl)
+	if left <= 0 {
+		return context.DeadlineExceeded
+	}
+	h.Set(name, Format(left))
+	return nil
+}
+
+type transport struct {
+	base   http.RoundTripper
+	header string
+}
+
+// Transport returns an http.RoundTripper setting the given timeout header on
+// the requests it sends, based on their context, before sending them with
+// base. If base is nil, http.DefaultTransport is used.
+func Transport(base http.RoundTripper, header string) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	if header == "" {
+		header = DefaultHeader
+	}
+	return &transport{base: base, header: header}
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if _, ok := req.Context().Deadline(); !ok {
+		return t.base.RoundTrip(req)
+	}
+	// RoundTrippers must not modify the request they are given.
+	req2 := req.Clone(req.Context())
+	if err := SetHeader(req.Context(), req2.Header, t.header); err != nil {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, fmt.Errorf("deadline: %w", err)
+	}
+	return t.base.RoundTrip(req2)
+}
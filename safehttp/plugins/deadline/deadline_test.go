@@ -0,0 +1,147 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package deadline_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/go-safeweb/safehttp"
+	"github.com/google/go-safeweb/safehttp/plugins/deadline"
+)
+
+func TestFormatParse(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		want string
+	}{
+		{d: 0, want: "0n"},
+		{d: 250 * time.Millisecond, want: "250000u"},
+		{d: 2 * time.Second, want: "2000000u"},
+		{d: 3 * time.Hour, want: "10800000m"},
+		{d: 100*time.Second + 999*time.Microsecond, want: "100000m"},
+	}
+	for _, tt := range tests {
+		got := deadline.Format(tt.d)
+		if got != tt.want {
+			t.Errorf("deadline.Format(%v) = %q, want %q", tt.d, got, tt.want)
+		}
+		d, err := deadline.Parse(got)
+		if err != nil {
+			t.Errorf("deadline.Parse(%q) got err: %v", got, err)
+		}
+		if d > tt.d {
+			t.Errorf("deadline.Parse(%q) = %v, want at most %v", got, d, tt.d)
+		}
+	}
+
+	for _, s := range []string{"", "1", "m", "-1m", "1x", "123456789m"} {
+		if _, err := deadline.Parse(s); err == nil {
+			t.Errorf("deadline.Parse(%q) got nil err, want error", s)
+		}
+	}
+}
+
+func TestHandler(t *testing.T) {
+	var got time.Duration
+	var hasDeadline bool
+	h := safehttp.HandlerFunc(func(w safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+		var dl time.Time
+		dl, hasDeadline = r.Context().Deadline()
+		got = time.Until(dl)
+		return w.Write(safehttp.NoContentResponse{})
+	})
+	mux := safehttp.NewServeMuxConfig(nil).Mux()
+	mux.Handle("/", safehttp.MethodGet, deadline.Handler(h, deadline.Options{Max: time.Minute}))
+
+	tests := []struct {
+		name         string
+		timeout      string
+		wantCode     int
+		wantDeadline bool
+		wantMax      time.Duration
+	}{
+		{name: "No header", wantCode: http.StatusNoContent},
+		{name: "Timeout", timeout: "2S", wantCode: http.StatusNoContent, wantDeadline: true, wantMax: 2 * time.Second},
+		{name: "Capped", timeout: "5H", wantCode: http.StatusNoContent, wantDeadline: true, wantMax: time.Minute},
+		{name: "Invalid", timeout: "soon", wantCode: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hasDeadline = false
+			req := httptest.NewRequest(http.MethodGet, "https://foo.com/", nil)
+			if tt.timeout != "" {
+				req.Header.Set(deadline.DefaultHeader, tt.timeout)
+			}
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, req)
+
+			if rr.Code != tt.wantCode {
+				t.Errorf("rr.Code: got %v, want %v", rr.Code, tt.wantCode)
+			}
+			if hasDeadline != tt.wantDeadline {
+				t.Errorf("context has deadline: got %v, want %v", hasDeadline, tt.wantDeadline)
+			}
+			if tt.wantDeadline && (got > tt.wantMax || got < tt.wantMax-time.Second) {
+				t.Errorf("time until deadline: got %v, want about %v", got, tt.wantMax)
+			}
+		})
+	}
+}
+
+func TestTransport(t *testing.T) {
+	var got string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Get(deadline.DefaultHeader)
+	}))
+	defer srv.Close()
+	client := &http.Client{Transport: deadline.Transport(nil, "")}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+	if err != nil {
+		t.Fatalf("http.NewRequestWithContext() got err: %v", err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("client.Do() got err: %v", err)
+	}
+	resp.Body.Close()
+	d, err := deadline.Parse(got)
+	if err != nil {
+		t.Fatalf("deadline.Parse(%q) got err: %v", got, err)
+	}
+	if d > time.Minute || d < 59*time.Second {
+		t.Errorf("propagated timeout: got %v, want about 1m", d)
+	}
+	if req.Header.Get(deadline.DefaultHeader) != "" {
+		t.Error("Transport modified the original request")
+	}
+
+	expired, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	req, err = http.NewRequestWithContext(expired, http.MethodGet, srv.URL, nil)
+	if err != nil {
+		t.Fatalf("http.NewRequestWithContext() got err: %v", err)
+	}
+	if _, err := client.Do(req); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("client.Do() with an expired deadline got err: %v, want %v", err, context.DeadlineExceeded)
+	}
+}
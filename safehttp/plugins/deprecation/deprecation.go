@@ -0,0 +1,152 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package deprecation provides a plugin announcing the deprecation and the
+// retirement of routes through the Deprecation, Sunset and Link headers.
+//
+// More info:
+//   - Deprecation: https://datatracker.ietf.org/doc/html/rfc9745
+//   - Sunset: https://tools.ietf.org/html/rfc8594
+//
+// # Usage
+//
+// Install an Interceptor using safehttp.ServeMuxConfig.Intercept and mark the
+// deprecated routes by passing a Config when registering their handlers:
+//
+//	c := &deprecation.Counter{}
+//	cfg.Intercept(deprecation.Interceptor{OnCall: c.Record})
+//	mux.Handle("/v1/items", safehttp.MethodGet, itemsV1, deprecation.Config{
+//		Route:      "items-v1",
+//		Deprecated: time.Date(2021, time.January, 1, 0, 0, 0, 0, time.UTC),
+//		Sunset:     time.Date(2022, time.January, 1, 0, 0, 0, 0, time.UTC),
+//		Link:       "https://example.com/docs/items-v2",
+//	})
+package deprecation
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-safeweb/safehttp"
+)
+
+// Config is a safehttp.InterceptorConfig marking a route as deprecated.
+type Config struct {
+	// Route is the name of the route, used when counting calls.
+	Route string
+	// Deprecated is when the route was, or will be, deprecated. It's required.
+	Deprecated time.Time
+	// Sunset is when the route is expected to become unresponsive. If zero,
+	// no Sunset header is set.
+	Sunset time.Time
+	// Link is the URL of the documentation about the deprecation, e.g. a
+	// migration guide. If empty, no Link header is set.
+	Link string
+}
+
+// Interceptor sets the deprecation headers for the routes configured with a
+// Config. The zero value is valid and ready to use.
+type Interceptor struct {
+	// OnCall, if non-nil, is called for every request to a deprecated route,
+	// e.g. to count them with a Counter.
+	OnCall func(r *safehttp.IncomingRequest, cfg Config)
+}
+
+var _ safehttp.Interceptor = Interceptor{}
+
+// Before claims the Deprecation and Sunset headers and, if the route has a
+// Config, sets them and adds a Link header with rel="deprecation".
+//
+// If the Config is invalid, an error response is written.
+func (it Interceptor) Before(w safehttp.ResponseWriter, r *safehttp.IncomingRequest, cfg safehttp.InterceptorConfig) safehttp.Result {
+	h := w.Header()
+	setDeprecation := h.Claim("Deprecation")
+	setSunset := h.Claim("Sunset")
+
+	c, ok := cfg.(Config)
+	if !ok {
+		return safehttp.NotWritten()
+	}
+	if err := c.validate(); err != nil {
+		return w.WriteError(safehttp.StatusInternalServerError)
+	}
+
+	setDeprecation([]string{"@" + strconv.FormatInt(c.Deprecated.Unix(), 10)})
+	if !c.Sunset.IsZero() {
+		setSunset([]string{c.Sunset.UTC().Format(http.TimeFormat)})
+	}
+	if c.Link != "" {
+		h.Add("Link", "<"+c.Link+`>; rel="deprecation"; type="text/html"`)
+	}
+	if it.OnCall != nil {
+		it.OnCall(r, c)
+	}
+	return safehttp.NotWritten()
+}
+
+func (c Config) validate() error {
+	if c.Deprecated.IsZero() {
+		return errors.New("missing deprecation date")
+	}
+	if !c.Sunset.IsZero() && c.Sunset.Before(c.Deprecated) {
+		return errors.New("sunset before deprecation")
+	}
+	if strings.ContainsAny(c.Link, "<>\r\n") {
+		return errors.New("invalid link")
+	}
+	return nil
+}
+
+// Commit is a no-op, required to satisfy the safehttp.Interceptor interface.
+func (Interceptor) Commit(w safehttp.ResponseHeadersWriter, r *safehttp.IncomingRequest, resp safehttp.Response, _ safehttp.InterceptorConfig) {
+}
+
+// Match recognizes Configs as deprecation configurations.
+func (Interceptor) Match(cfg safehttp.InterceptorConfig) bool {
+	_, ok := cfg.(Config)
+	return ok
+}
+
+// Counter counts the calls to deprecated routes. The zero value is valid and
+// ready to use. It's safe for concurrent use.
+type Counter struct {
+	mu    sync.Mutex
+	calls map[string]int64
+}
+
+// Record counts a call to the route of cfg. It can be used as
+// Interceptor.OnCall.
+func (c *Counter) Record(_ *safehttp.IncomingRequest, cfg Config) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.calls == nil {
+		c.calls = map[string]int64{}
+	}
+	c.calls[cfg.Route]++
+}
+
+// Calls returns the number of calls to each deprecated route, by name.
+func (c *Counter) Calls() map[string]int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	calls := make(map[string]int64, len(c.calls))
+	for route, n := range c.calls {
+		calls[route] = n
+	}
+	return calls
+}
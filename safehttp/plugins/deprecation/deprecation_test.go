@@ -0,0 +1,96 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package deprecation_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-safeweb/safehttp"
+	"github.com/google/go-safeweb/safehttp/plugins/deprecation"
+)
+
+func TestDeprecation(t *testing.T) {
+	c := &deprecation.Counter{}
+	mc := safehttp.NewServeMuxConfig(nil)
+	mc.Intercept(deprecation.Interceptor{OnCall: c.Record})
+	mux := mc.Mux()
+
+	h := safehttp.HandlerFunc(func(w safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+		return w.Write(safehttp.NoContentResponse{})
+	})
+	mux.Handle("/v1", safehttp.MethodGet, h, deprecation.Config{
+		Route:      "v1",
+		Deprecated: time.Date(2021, time.January, 1, 0, 0, 0, 0, time.UTC),
+		Sunset:     time.Date(2022, time.January, 1, 0, 0, 0, 0, time.UTC),
+		Link:       "https://example.com/migrate",
+	})
+	mux.Handle("/v2", safehttp.MethodGet, h)
+
+	tests := []struct {
+		target      string
+		wantHeaders map[string][]string
+	}{
+		{
+			target: "/v1",
+			wantHeaders: map[string][]string{
+				"Deprecation": {"@1609459200"},
+				"Sunset":      {"Sat, 01 Jan 2022 00:00:00 GMT"},
+				"Link":        {`<https://example.com/migrate>; rel="deprecation"; type="text/html"`},
+			},
+		},
+		{
+			target:      "/v2",
+			wantHeaders: map[string][]string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "https://foo.com"+tt.target, nil))
+
+			if got, want := rr.Code, http.StatusNoContent; got != want {
+				t.Errorf("rr.Code: got %v, want %v", got, want)
+			}
+			if diff := cmp.Diff(tt.wantHeaders, map[string][]string(rr.Header())); diff != "" {
+				t.Errorf("rr.Header() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+
+	mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "https://foo.com/v1", nil))
+	if diff := cmp.Diff(map[string]int64{"v1": 2}, c.Calls()); diff != "" {
+		t.Errorf("c.Calls() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestDeprecationInvalidConfig(t *testing.T) {
+	mc := safehttp.NewServeMuxConfig(nil)
+	mc.Intercept(deprecation.Interceptor{})
+	mux := mc.Mux()
+	h := safehttp.HandlerFunc(func(w safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+		return w.Write(safehttp.NoContentResponse{})
+	})
+	mux.Handle("/", safehttp.MethodGet, h, deprecation.Config{Route: "missing-date"})
+
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "https://foo.com/", nil))
+	if got, want := rr.Code, http.StatusInternalServerError; got != want {
+		t.Errorf("rr.Code: got %v, want %v", got, want)
+	}
+}
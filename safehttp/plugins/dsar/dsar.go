@@ -0,0 +1,383 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package dsar provides the plumbing of data subject access request (DSAR)
+// endpoints: export jobs producing archives downloadable through signed URLs,
+// deletion jobs, audit logging of both and rate limiting of the requests.
+//
+// The Manager doesn't authenticate users: the endpoints creating jobs must
+// only do so for the subject of the authenticated user. Download URLs are
+// bearer credentials, valid until they expire, and should only be sent to the
+// subject, e.g. by email.
+//
+// Jobs and archives are kept in memory, so they are lost on restart and not
+// shared between replicas.
+package dsar
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/go-safeweb/safehttp"
+	"github.com/google/go-safeweb/safehttp/random"
+)
+
+var (
+	// ErrTooManyRequests is returned when a subject requests a job of the
+	// same Kind again before the MinInterval elapses.
+	ErrTooManyRequests = errors.New("dsar: too many requests")
+	// ErrUnknownJob is returned for jobs that don't exist or don't belong to
+	// the subject.
+	ErrUnknownJob = errors.New("dsar: unknown job")
+	// ErrNotReady is returned when creating a download URL for an export job
+	// that didn't complete successfully.
+	ErrNotReady = errors.New("dsar: export not ready")
+)
+
+// Kind is the kind of a job.
+type Kind int
+
+const (
+	// Export jobs collect the data of a subject into an archive.
+	Export Kind = iota + 1
+	// Deletion jobs delete the data of a subject.
+	Deletion
+)
+
+func (k Kind) String() string {
+	switch k {
+	case Export:
+		return "export"
+	case Deletion:
+		return "deletion"
+	default:
+		return fmt.Sprintf("Kind(%d)", int(k))
+	}
+}
+
+// Status is the status of a job.
+type Status int
+
+const (
+	// Running jobs haven't completed yet.
+	Running Status = iota
+	// Succeeded jobs completed successfully.
+	Succeeded
+	// Failed jobs completed with an error.
+	Failed
+)
+
+// Job is a data subject access request.
+type Job struct {
+	ID       string
+	Subject  string
+	Kind     Kind
+	Status   Status
+	Created  time.Time
+	Finished time.Time
+	// Err is the error the job failed with.
+	Err error
+}
+
+// Audit actions.
+const (
+	ActionRequested  = "requested"
+	ActionRejected   = "rejected"
+	ActionSucceeded  = "succeeded"
+	ActionFailed     = "failed"
+	ActionDownloaded = "downloaded"
+)
+
+// AuditEvent records an action on a job, for the audit log.
+type AuditEvent struct {
+	Time    time.Time
+	JobID   string
+	Subject string
+	Kind    Kind
+	// Action is one of the Action constants.
+	Action string
+}
+
+// Options configure a Manager.
+type Options struct {
+	// Key is the secret used to sign download URLs. It should have high
+	// entropy and must be at least 32 bytes long.
+	Key []byte
+	// Export returns the data of the subject, as archive file names to
+	// contents. It's required for Export jobs.
+	Export func(ctx context.Context, subject string) (map[string][]byte, error)
+	// Delete deletes the data of the subject. It's required for Deletion
+	// jobs.
+	Delete func(ctx context.Context, subject string) error
+	// Audit is called for every action on a job. If nil, events are dropped.
+	Audit func(AuditEvent)
+	// MinInterval is the minimum time between two requests of the same Kind
+	// by a subject. If zero, 24 hours are used.
+	MinInterval time.Duration
+	// URLTTL is how long download URLs are valid for. If zero, one hour is
+	// used.
+	URLTTL time.Duration
+	// Clock is used to timestamp jobs and expire URLs. If nil, the
+	// safehttp.SystemClock is used.
+	Clock safehttp.Clock
+}
+
+type lastRequestKey struct {
+	subject string
+	kind    Kind
+}
+
+// Manager runs data subject access request jobs.
+type Manager struct {
+	opts Options
+
+	mu       sync.Mutex
+	jobs     map[string]*Job
+	archives map[string][]byte
+	last     map[lastRequestKey]time.Time
+	wg       sync.WaitGroup
+}
+
+// NewManager creates a Manager. It panics if the Key is shorter than 32
+// bytes.
+func NewManager(opts Options) *Manager {
+	if len(opts.Key) < 32 {
+		panic("dsar: Options.Key must be at least 32 bytes long")
+	}
+	if opts.MinInterval == 0 {
+		opts.MinInterval = 24 * time.Hour
+	}
+	if opts.URLTTL == 0 {
+		opts.URLTTL = time.Hour
+	}
+	if opts.Clock == nil {
+		opts.Clock = safehttp.SystemClock()
+	}
+	return &Manager{
+		opts:     opts,
+		jobs:     map[string]*Job{},
+		archives: map[string][]byte{},
+		last:     map[lastRequestKey]time.Time{},
+	}
+}
+
+func (m *Manager) audit(j *Job, action string) {
+	if m.opts.Audit == nil {
+		return
+	}
+	m.opts.Audit(AuditEvent{
+		Time:    m.opts.Clock.Now(),
+		JobID:   j.ID,
+		Subject: j.Subject,
+		Kind:    j.Kind,
+		Action:  action,
+	})
+}
+
+// Request starts a job of the given Kind for the subject, in the background.
+// It returns ErrTooManyRequests if the subject already requested one less than
+// MinInterval ago.
+func (m *Manager) Request(subject string, k Kind) (Job, error) {
+	if (k == Export && m.opts.Export == nil) || (k == Deletion && m.opts.Delete == nil) {
+		return Job{}, fmt.Errorf("dsar: %v jobs are not configured", k)
+	}
+	now := m.opts.Clock.Now()
+	j := &Job{ID: random.MustToken(16), Subject: subject, Kind: k, Status: Running, Created: now}
+
+	m.mu.Lock()
+	key := lastRequestKey{subject: subject, kind: k}
+	if last, ok := m.last[key]; ok && now.Sub(last) < m.opts.MinInterval {
+		m.mu.Unlock()
+		m.audit(&Job{Subject: subject, Kind: k}, ActionRejected)
+		return Job{}, ErrTooManyRequests
+	}
+	m.last[key] = now
+	m.jobs[j.ID] = j
+	started := *j
+	m.mu.Unlock()
+	m.audit(&started, ActionRequested)
+
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		m.run(j)
+	}()
+	return started, nil
+}
+
+func (m *Manager) run(j *Job) {
+	// Jobs outlive the requests creating them, so they don't inherit their
+	// context.
+	ctx := context.Background()
+	var archive []byte
+	var err error
+	switch j.Kind {
+	case Export:
+		var files map[string][]byte
+		if files, err = m.opts.Export(ctx, j.Subject); err == nil {
+			archive, err = zipFiles(files)
+		}
+	case Deletion:
+		err = m.opts.Delete(ctx, j.Subject)
+	}
+
+	m.mu.Lock()
+	j.Finished = m.opts.Clock.Now()
+	if err != nil {
+		j.Status, j.Err = Failed, err
+	} else {
+		j.Status = Succeeded
+	}
+	if archive != nil {
+		m.archives[j.ID] = archive
+	}
+	if j.Kind == Deletion && err == nil {
+		// Exported archives hold the deleted data.
+		for id, other := range m.jobs {
+			if other.Subject == j.Subject && other.Kind == Export {
+				delete(m.archives, id)
+			}
+		}
+	}
+	m.mu.Unlock()
+
+	if err != nil {
+		m.audit(j, ActionFailed)
+	} else {
+		m.audit(j, ActionSucceeded)
+	}
+}
+
+func zipFiles(files map[string][]byte) ([]byte, error) {
+	names := make([]string, 0, len(files))
+	for n := range files {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, n := range names {
+		f, err := zw.Create(n)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := f.Write(files[n]); err != nil {
+			return nil, err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Wait blocks until all the running jobs complete.
+func (m *Manager) Wait() {
+	m.wg.Wait()
+}
+
+// Job returns the job with the given ID, if it belongs to the subject.
+func (m *Manager) Job(subject, id string) (Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	j, ok := m.jobs[id]
+	if !ok || j.Subject != subject {
+		return Job{}, ErrUnknownJob
+	}
+	return *j, nil
+}
+
+func (m *Manager) sign(id string, expires int64) string {
+	mac := hmac.New(sha256.New, m.opts.Key)
+	mac.Write([]byte(id + "." + strconv.FormatInt(expires, 10)))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// DownloadURL returns a signed URL, relative to base, from which the archive
+// of a successful export job of the subject can be downloaded until the
+// URLTTL elapses. base should point to the DownloadHandler.
+func (m *Manager) DownloadURL(subject, id, base string) (string, error) {
+	j, err := m.Job(subject, id)
+	if err != nil {
+		return "", err
+	}
+	if j.Kind != Export || j.Status != Succeeded {
+		return "", ErrNotReady
+	}
+	expires := m.opts.Clock.Now().Add(m.opts.URLTTL).Unix()
+	q := url.Values{}
+	q.Set("job", id)
+	q.Set("expires", strconv.FormatInt(expires, 10))
+	q.Set("sig", m.sign(id, expires))
+	return base + "?" + q.Encode(), nil
+}
+
+// DownloadHandler returns a handler serving the archives of export jobs to
+// the holders of a valid download URL. It responds with 403 Forbidden to
+// tampered with or expired URLs, and with 404 Not Found if the archive is
+// gone, e.g. because the subject's data was deleted since.
+//
+// Archives must not be stored by caches: if the cache plugin is installed,
+// register the handler without a cache.Policy.
+func (m *Manager) DownloadHandler() safehttp.Handler {
+	return safehttp.HandlerFunc(func(w safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+		q, err := r.URL().Query()
+		if err != nil {
+			return w.WriteError(safehttp.StatusBadRequest)
+		}
+		id := q.String("job", "")
+		expires := q.Int64("expires", 0)
+		sig := q.String("sig", "")
+		if q.Err() != nil || !hmac.Equal([]byte(sig), []byte(m.sign(id, expires))) ||
+			m.opts.Clock.Now().Unix() > expires {
+			return w.WriteError(safehttp.StatusForbidden)
+		}
+
+		m.mu.Lock()
+		j, jok := m.jobs[id]
+		archive, aok := m.archives[id]
+		m.mu.Unlock()
+		if !jok || !aok {
+			return w.WriteError(safehttp.StatusNotFound)
+		}
+		m.audit(j, ActionDownloaded)
+
+		h := w.Header()
+		h.Set("Content-Disposition", `attachment; filename="export.zip"`)
+		// The cache plugin, if installed, owns the header and forbids
+		// storing responses unless the handler is registered with a Policy.
+		if !h.IsClaimed("Cache-Control") {
+			h.Set("Cache-Control", "no-store")
+		}
+		return w.Write(safehttp.StreamingResponse{
+			ContentType: "application/octet-stream",
+			Stream: func(sw *safehttp.StreamWriter) error {
+				_, err := sw.Write(archive)
+				return err
+			},
+		})
+	})
+}
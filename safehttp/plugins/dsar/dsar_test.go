@@ -0,0 +1,230 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dsar_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-safeweb/safehttp"
+	"github.com/google/go-safeweb/safehttp/plugins/cache"
+	"github.com/google/go-safeweb/safehttp/plugins/dsar"
+	"github.com/google/go-safeweb/safehttp/safehttptest"
+)
+
+var key = []byte("0123456789abcdef0123456789abcdef")
+
+type auditLog struct {
+	mu      sync.Mutex
+	actions []string
+}
+
+func (l *auditLog) record(e dsar.AuditEvent) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.actions = append(l.actions, e.Kind.String()+" "+e.Action)
+}
+
+func newManager(t *testing.T, clock safehttp.Clock, log *auditLog) *dsar.Manager {
+	t.Helper()
+	data := map[string]map[string][]byte{
+		"alice": {"profile.json": []byte(`{"name":"alice"}`)},
+	}
+	var mu sync.Mutex
+	return dsar.NewManager(dsar.Options{
+		Key: key,
+		Export: func(_ context.Context, subject string) (map[string][]byte, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			return data[subject], nil
+		},
+		Delete: func(_ context.Context, subject string) error {
+			mu.Lock()
+			defer mu.Unlock()
+			delete(data, subject)
+			return nil
+		},
+		Audit: log.record,
+		Clock: clock,
+	})
+}
+
+func download(m *dsar.Manager, url string, is ...safehttp.Interceptor) *httptest.ResponseRecorder {
+	mc := safehttp.NewServeMuxConfig(nil)
+	mc.Intercept(is...)
+	mux := mc.Mux()
+	mux.Handle("/download", safehttp.MethodGet, m.DownloadHandler())
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "https://foo.com"+url, nil))
+	return rr
+}
+
+func TestExport(t *testing.T) {
+	clock := safehttptest.NewFakeClock(time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC))
+	log := &auditLog{}
+	m := newManager(t, clock, log)
+
+	j, err := m.Request("alice", dsar.Export)
+	if err != nil {
+		t.Fatalf("m.Request() got err: %v", err)
+	}
+	m.Wait()
+	if j, err = m.Job("alice", j.ID); err != nil || j.Status != dsar.Succeeded {
+		t.Fatalf("m.Job() got (%+v, %v), want a succeeded job", j, err)
+	}
+	if _, err := m.Job("bob", j.ID); !errors.Is(err, dsar.ErrUnknownJob) {
+		t.Errorf("m.Job() of another subject got err: %v, want %v", err, dsar.ErrUnknownJob)
+	}
+
+	url, err := m.DownloadURL("alice", j.ID, "/download")
+	if err != nil {
+		t.Fatalf("m.DownloadURL() got err: %v", err)
+	}
+	rr := download(m, url)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status: got %d, want %d", rr.Code, http.StatusOK)
+	}
+	if got, want := rr.Header().Get("Content-Disposition"), `attachment; filename="export.zip"`; got != want {
+		t.Errorf("Content-Disposition: got %q, want %q", got, want)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(rr.Body.Bytes()), int64(rr.Body.Len()))
+	if err != nil || len(zr.File) != 1 || zr.File[0].Name != "profile.json" {
+		t.Fatalf("archive: got err %v, want a single profile.json file", err)
+	}
+	f, _ := zr.File[0].Open()
+	b, _ := ioutil.ReadAll(f)
+	if got, want := string(b), `{"name":"alice"}`; got != want {
+		t.Errorf("profile.json: got %q, want %q", got, want)
+	}
+
+	want := []string{"export requested", "export succeeded", "export downloaded"}
+	if diff := cmp.Diff(want, log.actions); diff != "" {
+		t.Errorf("audit log mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestDownloadCacheInterceptor(t *testing.T) {
+	clock := safehttptest.NewFakeClock(time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC))
+	m := newManager(t, clock, &auditLog{})
+	j, err := m.Request("alice", dsar.Export)
+	if err != nil {
+		t.Fatalf("m.Request() got err: %v", err)
+	}
+	m.Wait()
+	url, err := m.DownloadURL("alice", j.ID, "/download")
+	if err != nil {
+		t.Fatalf("m.DownloadURL() got err: %v", err)
+	}
+
+	for _, tt := range []struct {
+		name string
+		is   []safehttp.Interceptor
+	}{
+		{name: "Without cache.Interceptor"},
+		{name: "With cache.Interceptor", is: []safehttp.Interceptor{cache.Interceptor{}}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := download(m, url, tt.is...)
+			if rr.Code != http.StatusOK {
+				t.Fatalf("status: got %d, want %d", rr.Code, http.StatusOK)
+			}
+			if got, want := rr.Header().Values("Cache-Control"), []string{"no-store"}; !cmp.Equal(got, want) {
+				t.Errorf("Cache-Control: got %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestDownloadURLInvalid(t *testing.T) {
+	clock := safehttptest.NewFakeClock(time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC))
+	m := newManager(t, clock, &auditLog{})
+	j, err := m.Request("alice", dsar.Export)
+	if err != nil {
+		t.Fatalf("m.Request() got err: %v", err)
+	}
+	m.Wait()
+	url, err := m.DownloadURL("alice", j.ID, "/download")
+	if err != nil {
+		t.Fatalf("m.DownloadURL() got err: %v", err)
+	}
+
+	if rr := download(m, strings.Replace(url, "expires=", "expires=9", 1)); rr.Code != http.StatusForbidden {
+		t.Errorf("tampered with URL: got status %d, want %d", rr.Code, http.StatusForbidden)
+	}
+	clock.Advance(2 * time.Hour)
+	if rr := download(m, url); rr.Code != http.StatusForbidden {
+		t.Errorf("expired URL: got status %d, want %d", rr.Code, http.StatusForbidden)
+	}
+}
+
+func TestDeletion(t *testing.T) {
+	clock := safehttptest.NewFakeClock(time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC))
+	log := &auditLog{}
+	m := newManager(t, clock, log)
+	export, err := m.Request("alice", dsar.Export)
+	if err != nil {
+		t.Fatalf("m.Request(Export) got err: %v", err)
+	}
+	m.Wait()
+	url, err := m.DownloadURL("alice", export.ID, "/download")
+	if err != nil {
+		t.Fatalf("m.DownloadURL() got err: %v", err)
+	}
+
+	if _, err := m.Request("alice", dsar.Deletion); err != nil {
+		t.Fatalf("m.Request(Deletion) got err: %v", err)
+	}
+	m.Wait()
+	if rr := download(m, url); rr.Code != http.StatusNotFound {
+		t.Errorf("archive after deletion: got status %d, want %d", rr.Code, http.StatusNotFound)
+	}
+
+	want := []string{"export requested", "export succeeded", "deletion requested", "deletion succeeded"}
+	if diff := cmp.Diff(want, log.actions); diff != "" {
+		t.Errorf("audit log mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	clock := safehttptest.NewFakeClock(time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC))
+	log := &auditLog{}
+	m := newManager(t, clock, log)
+	if _, err := m.Request("alice", dsar.Export); err != nil {
+		t.Fatalf("m.Request() got err: %v", err)
+	}
+	m.Wait()
+	if _, err := m.Request("alice", dsar.Export); !errors.Is(err, dsar.ErrTooManyRequests) {
+		t.Errorf("second m.Request() got err: %v, want %v", err, dsar.ErrTooManyRequests)
+	}
+	if _, err := m.Request("bob", dsar.Export); err != nil {
+		t.Errorf("m.Request() of another subject got err: %v", err)
+	}
+	m.Wait()
+	clock.Advance(25 * time.Hour)
+	if _, err := m.Request("alice", dsar.Export); err != nil {
+		t.Errorf("m.Request() after MinInterval got err: %v", err)
+	}
+	m.Wait()
+}
@@ -0,0 +1,235 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package email
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// rule is a CSS rule with a single, supported, selector.
+type rule struct {
+	sel   selector
+	decls string
+	// order is the position of the rule in the style sheets, which breaks
+	// specificity ties.
+	order int
+}
+
+// selector is a compound selector made of an optional type selector and any
+// number of class and ID selectors.
+type selector struct {
+	tag     string
+	ids     []string
+	classes []string
+}
+
+var (
+	compoundSelector = regexp.MustCompile(`^([A-Za-z][A-Za-z0-9]*)?((?:[.#][A-Za-z_-][A-Za-z0-9_-]*)*)$`)
+	simpleSelector   = regexp.MustCompile(`[.#][A-Za-z_-][A-Za-z0-9_-]*`)
+	cssComment       = regexp.MustCompile(`(?s)/\*.*?\*/`)
+	cssFunction      = regexp.MustCompile(`([A-Za-z0-9_-]*)\s*\(`)
+)
+
+// safeFunctions are the CSS functions allowed in declarations, which compute
+// values without loading resources. Others, e.g. url, image-set or
+// cross-fade, can load remote images.
+var safeFunctions = map[string]bool{
+	"rgb":                       true,
+	"rgba":                      true,
+	"hsl":                       true,
+	"hsla":                      true,
+	"calc":                      true,
+	"min":                       true,
+	"max":                       true,
+	"clamp":                     true,
+	"linear-gradient":           true,
+	"radial-gradient":           true,
+	"repeating-linear-gradient": true,
+	"repeating-radial-gradient": true,
+}
+
+func parseSelector(s string) (selector, bool) {
+	m := compoundSelector.FindStringSubmatch(strings.TrimSpace(s))
+	if m == nil || (m[1] == "" && m[2] == "") {
+		return selector{}, false
+	}
+	sel := selector{tag: strings.ToLower(m[1])}
+	for _, p := range simpleSelector.FindAllString(m[2], -1) {
+		if p[0] == '#' {
+			sel.ids = append(sel.ids, p[1:])
+		} else {
+			sel.classes = append(sel.classes, p[1:])
+		}
+	}
+	return sel, true
+}
+
+func (s selector) specificity() [3]int {
+	tags := 0
+	if s.tag != "" {
+		tags = 1
+	}
+	return [3]int{len(s.ids), len(s.classes), tags}
+}
+
+func (s selector) matches(n *html.Node) bool {
+	if s.tag != "" && s.tag != n.Data {
+		return false
+	}
+	for _, id := range s.ids {
+		if attr(n, "id") != id {
+			return false
+		}
+	}
+	classes := strings.Fields(attr(n, "class"))
+	for _, want := range s.classes {
+		found := false
+		for _, c := range classes {
+			if c == want {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// parseStyleSheet returns the rules of the style sheet which can be inlined.
+// Rules are numbered starting from order.
+func parseStyleSheet(css string, order int) []rule {
+	css = cssComment.ReplaceAllString(css, "")
+	var rules []rule
+	for len(css) > 0 {
+		open := strings.IndexByte(css, '{')
+		if open < 0 {
+			break
+		}
+		prelude := strings.TrimSpace(css[:open])
+		// Find the matching closing brace, skipping nested blocks of at-rules.
+		depth, end := 0, -1
+		for i := open; i < len(css) && end < 0; i++ {
+			switch css[i] {
+			case '{':
+				depth++
+			case '}':
+				depth--
+				if depth == 0 {
+					end = i
+				}
+			}
+		}
+		if end < 0 {
+			break
+		}
+		body := css[open+1 : end]
+		css = css[end+1:]
+		if strings.HasPrefix(prelude, "@") || strings.ContainsAny(body, "{}") {
+			continue
+		}
+		decls := sanitizeDeclarations(body)
+		if decls == "" {
+			continue
+		}
+		var sels []selector
+		for _, s := range strings.Split(prelude, ",") {
+			sel, ok := parseSelector(s)
+			if !ok {
+				sels = nil
+				break
+			}
+			sels = append(sels, sel)
+		}
+		for _, sel := range sels {
+			rules = append(rules, rule{sel: sel, decls: decls, order: order})
+			order++
+		}
+	}
+	return rules
+}
+
+func sortRules(rules []rule) {
+	sort.SliceStable(rules, func(i, j int) bool {
+		si, sj := rules[i].sel.specificity(), rules[j].sel.specificity()
+		if si != sj {
+			for k := range si {
+				if si[k] != sj[k] {
+					return si[k] < sj[k]
+				}
+			}
+		}
+		return rules[i].order < rules[j].order
+	})
+}
+
+// sanitizeDeclarations removes the declarations which could load resources or
+// run code in older clients: the ones calling functions other than
+// safeFunctions, and the ones containing at-rules, escapes or the behavior
+// and -moz-binding properties.
+func sanitizeDeclarations(decls string) string {
+	var kept []string
+	for _, d := range strings.Split(decls, ";") {
+		d = strings.TrimSpace(d)
+		l := strings.ToLower(d)
+		if d == "" || !strings.Contains(d, ":") ||
+			strings.Contains(l, "@import") || strings.Contains(l, "behavior") ||
+			strings.Contains(l, "-moz-binding") || strings.Contains(l, "\\") || !safeCalls(l) {
+			continue
+		}
+		kept = append(kept, d)
+	}
+	return strings.Join(kept, "; ")
+}
+
+// safeCalls reports whether all the functions called in the lowercased
+// declaration are safeFunctions.
+func safeCalls(decl string) bool {
+	for _, m := range cssFunction.FindAllStringSubmatch(decl, -1) {
+		if !safeFunctions[m[1]] {
+			return false
+		}
+	}
+	return true
+}
+
+// inlineStyle prepends the declarations of the matching rules, which must be
+// sorted, to the style attribute of n.
+func inlineStyle(n *html.Node, rules []rule) {
+	var decls []string
+	for _, r := range rules {
+		if r.sel.matches(n) {
+			decls = append(decls, r.decls)
+		}
+	}
+	if len(decls) == 0 {
+		return
+	}
+	for i, a := range n.Attr {
+		if a.Namespace == "" && a.Key == "style" {
+			if s := strings.TrimSpace(a.Val); s != "" {
+				decls = append(decls, s)
+			}
+			n.Attr[i].Val = strings.Join(decls, "; ")
+			return
+		}
+	}
+	n.Attr = append(n.Attr, html.Attribute{Key: "style", Val: strings.Join(decls, "; ")})
+}
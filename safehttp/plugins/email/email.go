@@ -0,0 +1,346 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package email renders safehtml templates into the HTML and plaintext
+// alternatives of an email.
+//
+// Email clients are a hostile rendering environment: they don't support
+// <style> elements consistently, don't run any content security policy, and
+// loading remote resources leaks when, and whether, a message was read. The
+// rendered HTML is therefore post-processed:
+//   - <style> elements are inlined into the style attributes of the matching
+//     elements, see Render for the supported selectors;
+//   - scripts, forms, frames, embedded objects and event handlers are removed;
+//   - resources are only loaded from Options.ResourceHosts, other images are
+//     removed;
+//   - links are restricted to http, https and mailto URLs and can be rewritten
+//     through Options.RewriteLink, e.g. to route them through a signed
+//     redirect endpoint.
+//
+// # Usage
+//
+//	msg, err := email.Render(tmpl, data, email.Options{
+//		ResourceHosts: []string{"static.example.com"},
+//	})
+//	if err != nil {
+//		// ...
+//	}
+//	// Send msg.HTML.String() and msg.Text as multipart/alternative parts.
+package email
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/google/go-safeweb/safehttp"
+	"github.com/google/safehtml"
+	"github.com/google/safehtml/uncheckedconversions"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// Options configures the rendering of emails.
+type Options struct {
+	// ResourceHosts are the hosts images and other resources can be loaded
+	// from, over https. If empty, no remote resources are allowed.
+	ResourceHosts []string
+	// RewriteLink, if set, is called with the URL of every http and https
+	// link and returns the URL to use instead.
+	RewriteLink func(*url.URL) (string, error)
+}
+
+// Message is a rendered email.
+type Message struct {
+	// HTML is the sanitized HTML alternative, a complete document.
+	HTML safehtml.HTML
+	// Text is the plaintext alternative.
+	Text string
+}
+
+// removedElements are removed from emails together with their content.
+var removedElements = map[atom.Atom]bool{
+	atom.Script:   true,
+	atom.Noscript: true,
+	atom.Iframe:   true,
+	atom.Frame:    true,
+	atom.Frameset: true,
+	atom.Object:   true,
+	atom.Embed:    true,
+	atom.Applet:   true,
+	atom.Form:     true,
+	atom.Input:    true,
+	atom.Button:   true,
+	atom.Textarea: true,
+	atom.Select:   true,
+	atom.Link:     true,
+	atom.Meta:     true,
+	atom.Base:     true,
+	atom.Template: true,
+	atom.Svg:      true,
+	atom.Math:     true,
+	atom.Video:    true,
+	atom.Audio:    true,
+}
+
+// resourceAttributes are the attributes which load a resource when rendered.
+var resourceAttributes = map[string]bool{
+	"src":        true,
+	"srcset":     true,
+	"background": true,
+	"poster":     true,
+	"lowsrc":     true,
+	"dynsrc":     true,
+}
+
+// Render executes the template with the given data, as done by
+// safehttp.ExecuteTemplate, and returns the sanitized email.
+//
+// The rules of <style> elements are inlined if all of their selectors are
+// supported: type, class and ID selectors, optionally combined without
+// whitespace (e.g. "td.header"). Other rules, including at-rules such as
+// @media, are dropped. Declarations are applied by specificity and then in
+// document order, before the ones already in the style attribute.
+func Render(t safehttp.Template, data interface{}, opts Options) (Message, error) {
+	var b bytes.Buffer
+	if err := t.Execute(&b, data); err != nil {
+		return Message{}, err
+	}
+	doc, err := html.Parse(&b)
+	if err != nil {
+		return Message{}, err
+	}
+
+	var sheet []rule
+	var removed []*html.Node
+	walk(doc, func(n *html.Node) bool {
+		if n.Type != html.ElementNode {
+			return true
+		}
+		if n.DataAtom == atom.Style {
+			if n.FirstChild != nil {
+				sheet = append(sheet, parseStyleSheet(n.FirstChild.Data, len(sheet))...)
+			}
+			removed = append(removed, n)
+			return false
+		}
+		if removedElements[n.DataAtom] || n.Namespace != "" {
+			removed = append(removed, n)
+			return false
+		}
+		return true
+	})
+	for _, n := range removed {
+		n.Parent.RemoveChild(n)
+	}
+	sortRules(sheet)
+
+	var sanitizeErr error
+	removed = nil
+	walk(doc, func(n *html.Node) bool {
+		if n.Type != html.ElementNode || sanitizeErr != nil {
+			return sanitizeErr == nil
+		}
+		inlineStyle(n, sheet)
+		if err := opts.sanitizeAttrs(n); err != nil {
+			sanitizeErr = err
+			return false
+		}
+		if n.DataAtom == atom.Img && attr(n, "src") == "" {
+			removed = append(removed, n)
+			return false
+		}
+		return true
+	})
+	if sanitizeErr != nil {
+		return Message{}, sanitizeErr
+	}
+	for _, n := range removed {
+		n.Parent.RemoveChild(n)
+	}
+
+	b.Reset()
+	if err := html.Render(&b, doc); err != nil {
+		return Message{}, err
+	}
+	return Message{
+		HTML: uncheckedconversions.HTMLFromStringKnownToSatisfyTypeContract(b.String()),
+		Text: plaintext(doc),
+	}, nil
+}
+
+// walk calls f for n and its descendants, in document order. Children of a
+// node are skipped if f returns false for it.
+func walk(n *html.Node, f func(*html.Node) bool) {
+	if !f(n) {
+		return
+	}
+	for c := n.FirstChild; c != nil; {
+		// f may remove c from the tree.
+		next := c.NextSibling
+		walk(c, f)
+		c = next
+	}
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Namespace == "" && a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func (o Options) sanitizeAttrs(n *html.Node) error {
+	attrs := n.Attr[:0]
+	for _, a := range n.Attr {
+		key := strings.ToLower(a.Key)
+		switch {
+		case a.Namespace != "" || strings.HasPrefix(key, "on") || key == "formaction":
+			continue
+		case key == "style":
+			a.Val = sanitizeDeclarations(a.Val)
+			if a.Val == "" {
+				continue
+			}
+		case key == "srcset":
+			// Image candidates can't be checked individually without
+			// parsing, and src is enough for emails.
+			continue
+		case resourceAttributes[key]:
+			if !o.allowedResource(a.Val) {
+				continue
+			}
+		case key == "href":
+			if n.DataAtom != atom.A && n.DataAtom != atom.Area {
+				continue
+			}
+			href, err := o.link(a.Val)
+			if err != nil {
+				return err
+			}
+			if href == "" {
+				continue
+			}
+			a.Val = href
+		}
+		attrs = append(attrs, a)
+	}
+	n.Attr = attrs
+	return nil
+}
+
+func (o Options) allowedResource(v string) bool {
+	u, err := url.Parse(strings.TrimSpace(v))
+	if err != nil || u.Scheme != "https" {
+		return false
+	}
+	for _, h := range o.ResourceHosts {
+		if strings.EqualFold(u.Host, h) {
+			return true
+		}
+	}
+	return false
+}
+
+// link returns the sanitized, and possibly rewritten, value of a link, or an
+// empty string if the link is not allowed.
+func (o Options) link(v string) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(v))
+	if err != nil {
+		return "", nil
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "mailto":
+		return u.String(), nil
+	case "http", "https":
+		if o.RewriteLink == nil {
+			return u.String(), nil
+		}
+		href, err := o.RewriteLink(u)
+		if err != nil {
+			return "", fmt.Errorf("rewriting link %q: %v", u, err)
+		}
+		return href, nil
+	default:
+		// Relative links don't work in emails, and other schemes, such as
+		// javascript:, are dangerous.
+		return "", nil
+	}
+}
+
+// blockElements are rendered on their own lines in the plaintext alternative.
+var blockElements = map[atom.Atom]bool{
+	atom.P: true, atom.Div: true, atom.Table: true, atom.Tr: true,
+	atom.H1: true, atom.H2: true, atom.H3: true, atom.H4: true, atom.H5: true, atom.H6: true,
+	atom.Ul: true, atom.Ol: true, atom.Li: true, atom.Blockquote: true, atom.Pre: true,
+	atom.Hr: true, atom.Header: true, atom.Footer: true, atom.Section: true,
+}
+
+func plaintext(doc *html.Node) string {
+	var b strings.Builder
+	newline := func() {
+		if s := b.String(); s != "" && !strings.HasSuffix(s, "\n") {
+			b.WriteByte('\n')
+		}
+	}
+	var text func(n *html.Node)
+	text = func(n *html.Node) {
+		switch n.Type {
+		case html.TextNode:
+			if f := strings.Fields(n.Data); len(f) > 0 {
+				s := b.String()
+				if s != "" && !strings.HasSuffix(s, "\n") && !strings.HasSuffix(s, " ") {
+					b.WriteByte(' ')
+				}
+				b.WriteString(strings.Join(f, " "))
+			}
+			return
+		case html.ElementNode:
+			switch n.DataAtom {
+			case atom.Head:
+				return
+			case atom.Br:
+				b.WriteByte('\n')
+				return
+			case atom.Img:
+				if alt := attr(n, "alt"); alt != "" {
+					b.WriteString(alt)
+				}
+				return
+			}
+		}
+		if blockElements[n.DataAtom] {
+			newline()
+		}
+		if n.DataAtom == atom.Li {
+			b.WriteString("- ")
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			text(c)
+		}
+		if n.DataAtom == atom.A {
+			if href := attr(n, "href"); href != "" {
+				b.WriteString(" (" + strings.TrimPrefix(href, "mailto:") + ")")
+			}
+		}
+		if blockElements[n.DataAtom] {
+			newline()
+		}
+	}
+	text(doc)
+	return strings.TrimSpace(b.String())
+}
@@ -0,0 +1,148 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package email_test
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/google/go-safeweb/safehttp/plugins/email"
+	"github.com/google/safehtml/template"
+	"github.com/google/safehtml/template/uncheckedconversions"
+)
+
+func parse(src string) *template.Template {
+	return template.Must(template.New("email").ParseFromTrustedTemplate(uncheckedconversions.TrustedTemplateFromStringKnownToSatisfyTypeContract(src)))
+}
+
+func render(t *testing.T, src string, data interface{}, opts email.Options) email.Message {
+	t.Helper()
+	tmpl := parse(src)
+	msg, err := email.Render(tmpl, data, opts)
+	if err != nil {
+		t.Fatalf("email.Render() got err: %v", err)
+	}
+	return msg
+}
+
+func TestRenderHTML(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		data interface{}
+		opts email.Options
+		want string
+	}{
+		{
+			name: "Escaping",
+			src:  `<p>Hello {{.}}</p>`,
+			data: "<b>Alice</b>",
+			want: `<html><head></head><body><p>Hello &lt;b&gt;Alice&lt;/b&gt;</p></body></html>`,
+		},
+		{
+			name: "Inline CSS",
+			src: `<style>p { color: red } .big, #title { font-size: 20px } td.x { padding: 0 } div p { color: blue }</style>` +
+				`<p class="big" style="margin: 0">a</p><h1 id="title">b</h1><td class="x">c</td>`,
+			want: `<html><head></head><body><p class="big" style="color: red; font-size: 20px; margin: 0">a</p>` +
+				`<h1 id="title" style="font-size: 20px">b</h1>c</body></html>`,
+		},
+		{
+			name: "Specificity",
+			src:  `<style>#a { color: red } .b { color: green } p { color: blue }</style><p id="a" class="b">x</p>`,
+			want: `<html><head></head><body><p id="a" class="b" style="color: blue; color: green; color: red">x</p></body></html>`,
+		},
+		{
+			name: "At-rules and URLs",
+			src:  `<style>@media (max-width: 600px) { p { color: red } } p { background: url(https://tracker.com/p.gif); color: blue }</style><p>x</p>`,
+			want: `<html><head></head><body><p style="color: blue">x</p></body></html>`,
+		},
+		{
+			name: "Functions loading images",
+			src: `<style>p { background-image: image-set("https://tracker.com/p.gif" 1x); color: blue }` +
+				` td { background: -webkit-image-set("https://tracker.com/p.gif" 1x) } h1 { background: cross-fade("https://tracker.com/p.gif", red) }</style>` +
+				`<p>x</p><h1 style="background: image-set('https://tracker.com/q.gif' 1x); color: red">y</h1>`,
+			want: `<html><head></head><body><p style="color: blue">x</p><h1 style="color: red">y</h1></body></html>`,
+		},
+		{
+			name: "Safe functions",
+			src:  `<style>p { color: rgb(0, 0, 255); width: calc(100% - 10px); background: linear-gradient(red, blue) }</style><p>x</p>`,
+			want: `<html><head></head><body><p style="color: rgb(0, 0, 255); width: calc(100% - 10px); background: linear-gradient(red, blue)">x</p></body></html>`,
+		},
+		{
+			name: "Removed elements",
+			src:  `<p>a</p><form action="/x"><input name="q"></form><iframe src="https://example.com"></iframe><script>alert(1)</script>`,
+			want: `<html><head></head><body><p>a</p></body></html>`,
+		},
+		{
+			name: "Remote images",
+			src:  `<img src="https://static.example.com/logo.png" alt="logo"><img src="https://tracker.com/pixel.gif"><img src="http://static.example.com/logo.png">`,
+			opts: email.Options{ResourceHosts: []string{"static.example.com"}},
+			want: `<html><head></head><body><img src="https://static.example.com/logo.png" alt="logo"/></body></html>`,
+		},
+		{
+			name: "Links",
+			src:  `<a href="https://example.com/a">a</a><a href="mailto:help@example.com">b</a><a href="/relative">c</a><a href="{{.}}">d</a>`,
+			data: "javascript:alert(1)",
+			want: `<html><head></head><body><a href="https://example.com/a">a</a><a href="mailto:help@example.com">b</a><a>c</a><a>d</a></body></html>`,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			msg := render(t, tc.src, tc.data, tc.opts)
+			if got := msg.HTML.String(); got != tc.want {
+				t.Errorf("msg.HTML:\ngot:  %s\nwant: %s", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestRenderRewriteLink(t *testing.T) {
+	opts := email.Options{
+		RewriteLink: func(u *url.URL) (string, error) {
+			return "https://example.com/r?to=" + url.QueryEscape(u.String()), nil
+		},
+	}
+	msg := render(t, `<a href="https://other.com/x">x</a><a href="mailto:a@example.com">a</a>`, nil, opts)
+	want := `<a href="https://example.com/r?to=https%3A%2F%2Fother.com%2Fx">x</a><a href="mailto:a@example.com">a</a>`
+	if got := msg.HTML.String(); !strings.Contains(got, want) {
+		t.Errorf("msg.HTML: got %s, want it to contain %s", got, want)
+	}
+
+	opts.RewriteLink = func(*url.URL) (string, error) { return "", errors.New("no") }
+	tmpl := template.Must(template.New("email").Parse(`<a href="https://other.com/x">x</a>`))
+	if _, err := email.Render(tmpl, nil, opts); err == nil {
+		t.Error("email.Render() got nil err, want error from RewriteLink")
+	}
+}
+
+func TestRenderText(t *testing.T) {
+	src := `<html><head><title>Welcome</title></head><body>` +
+		`<h1>Hello {{.}}</h1><p>Thanks for   signing up.<br>See <a href="https://example.com/docs">the docs</a>.</p>` +
+		`<ul><li>One</li><li>Two</li></ul><img src="https://example.com/x.png" alt="logo"></body></html>`
+	msg := render(t, src, "Alice", email.Options{ResourceHosts: []string{"example.com"}})
+	want := "Hello Alice\nThanks for signing up.\nSee the docs (https://example.com/docs) .\n- One\n- Two\nlogo"
+	if msg.Text != want {
+		t.Errorf("msg.Text:\ngot:  %q\nwant: %q", msg.Text, want)
+	}
+}
+
+func TestRenderExecuteError(t *testing.T) {
+	tmpl := template.Must(template.New("email").Parse(`{{.Missing}}`))
+	if _, err := email.Render(tmpl, struct{}{}, email.Options{}); err == nil {
+		t.Error("email.Render() got nil err, want error")
+	}
+}
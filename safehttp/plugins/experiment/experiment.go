@@ -0,0 +1,228 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package experiment provides a plugin assigning requests to the arms of A/B
+// experiments.
+//
+// Assignments are deterministic: an identity, e.g. the ID of the logged in
+// user, is always assigned to the same arm of an experiment. Anonymous users
+// are identified by a random ID stored in a cookie with secure defaults.
+//
+// # Usage
+//
+// Install an Interceptor using safehttp.ServeMuxConfig.Intercept. Handlers
+// read the assigned arms with Assigned, templates with the experimentArm function:
+//
+//	{{if eq (experimentArm "checkout") "one-page"}}...{{end}}
+//
+// The function must be declared when parsing the templates, e.g. with
+// experiment.FuncMap, and is replaced for each response.
+//
+// Exposures, i.e. the first read of the arm of an experiment while handling a
+// request, are reported to the OnExposure hook, so analyses only include the
+// users who actually saw the experiment.
+package experiment
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/google/go-safeweb/safehttp"
+	"github.com/google/go-safeweb/safehttp/random"
+)
+
+// DefaultCookieName is the name of the cookie identifying anonymous users
+// used when none is configured.
+const DefaultCookieName = "exp_id"
+
+// TemplateFuncName is the name of the template function returning the arm of
+// an experiment.
+const TemplateFuncName = "experimentArm"
+
+// FuncMap returns a placeholder for the template function of the plugin, to
+// be passed to the Funcs method of templates before parsing them.
+func FuncMap() map[string]interface{} {
+	return map[string]interface{}{TemplateFuncName: func(string) string { return "" }}
+}
+
+// Arm is an arm of an experiment.
+type Arm struct {
+	Name string
+	// Weight is the share of identities assigned to the arm, relative to the
+	// weights of the other arms.
+	Weight int
+}
+
+// Experiment is an A/B experiment.
+type Experiment struct {
+	// Name identifies the experiment. Changing it reshuffles the
+	// assignments.
+	Name string
+	Arms []Arm
+}
+
+// assign returns the arm of the identity, hashing it along with the name of
+// the experiment so that assignments to different experiments are
+// independent.
+func (e Experiment) assign(identity string) string {
+	total := 0
+	for _, a := range e.Arms {
+		total += a.Weight
+	}
+	if total <= 0 {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(e.Name + "\x00" + identity))
+	bucket := int(binary.BigEndian.Uint64(sum[:8]) % uint64(total))
+	for _, a := range e.Arms {
+		if bucket < a.Weight {
+			return a.Name
+		}
+		bucket -= a.Weight
+	}
+	// Unreachable, the buckets cover all the arms.
+	return ""
+}
+
+// Exposure is the first read of the assigned arm of an experiment while
+// handling a request.
+type Exposure struct {
+	Experiment string
+	Arm        string
+	Identity   string
+}
+
+type assignments struct {
+	identity    string
+	experiments map[string]Experiment
+	exposed     map[string]bool
+	onExposure  func(*safehttp.IncomingRequest, Exposure)
+	req         *safehttp.IncomingRequest
+}
+
+func (a *assignments) arm(experiment string) string {
+	e, ok := a.experiments[experiment]
+	if !ok {
+		return ""
+	}
+	arm := e.assign(a.identity)
+	if !a.exposed[experiment] {
+		a.exposed[experiment] = true
+		if a.onExposure != nil {
+			a.onExposure(a.req, Exposure{Experiment: experiment, Arm: arm, Identity: a.identity})
+		}
+	}
+	return arm
+}
+
+type assignmentsKey struct{}
+
+// Assigned returns the arm of the experiment the request is assigned to, reporting
+// the exposure the first time it's called for the experiment. It returns an
+// empty string for unknown experiments or without an installed Interceptor.
+func Assigned(ctx context.Context, experiment string) string {
+	a, ok := safehttp.FlightValues(ctx).Get(assignmentsKey{}).(*assignments)
+	if !ok {
+		return ""
+	}
+	return a.arm(experiment)
+}
+
+// Interceptor assigns requests to the arms of experiments.
+type Interceptor struct {
+	// Experiments are the running experiments.
+	Experiments []Experiment
+	// Identify returns the identity of the user making the request, e.g. the
+	// ID of the logged in user. If nil, or if it returns an empty string, the
+	// ID stored in the cookie is used, setting a new one if needed.
+	Identify func(*safehttp.IncomingRequest) string
+	// CookieName is the name of the cookie identifying anonymous users. If
+	// empty, DefaultCookieName is used.
+	CookieName string
+	// OnExposure is called for every exposure.
+	OnExposure func(*safehttp.IncomingRequest, Exposure)
+}
+
+var _ safehttp.Interceptor = Interceptor{}
+
+func (it Interceptor) identity(w safehttp.ResponseWriter, r *safehttp.IncomingRequest) (string, error) {
+	name := it.CookieName
+	if name == "" {
+		name = DefaultCookieName
+	}
+	add := w.Header().ClaimCookie(name, "experiment.Interceptor")
+	if it.Identify != nil {
+		if id := it.Identify(r); id != "" {
+			return id, nil
+		}
+	}
+	// The assignments depend on the cookie, so must the cached responses.
+	w.Header().Vary("Cookie")
+	if c, err := r.Cookie(name); err == nil && c.Value() != "" {
+		return c.Value(), nil
+	}
+	id, err := random.Token(16)
+	if err != nil {
+		return "", err
+	}
+	c := safehttp.NewCookie(name, id)
+	c.SetMaxAge(365 * 24 * 60 * 60)
+	if err := add(c); err != nil {
+		return "", fmt.Errorf("setting the experiment cookie: %v", err)
+	}
+	return id, nil
+}
+
+// Before claims the experiment cookie, identifies the user making the request,
+// setting the cookie of anonymous users if needed, and stores the assignments
+// in the request context. Cookie is added to the Vary header when the cookie
+// identifies the user.
+func (it Interceptor) Before(w safehttp.ResponseWriter, r *safehttp.IncomingRequest, _ safehttp.InterceptorConfig) safehttp.Result {
+	id, err := it.identity(w, r)
+	if err != nil {
+		return w.WriteError(safehttp.StatusInternalServerError)
+	}
+	experiments := make(map[string]Experiment, len(it.Experiments))
+	for _, e := range it.Experiments {
+		experiments[e.Name] = e
+	}
+	safehttp.FlightValues(r.Context()).Put(assignmentsKey{}, &assignments{
+		identity:    id,
+		experiments: experiments,
+		exposed:     map[string]bool{},
+		onExposure:  it.OnExposure,
+		req:         r,
+	})
+	return safehttp.NotWritten()
+}
+
+// Commit adds the experimentArm function to safehttp.TemplateResponses.
+func (it Interceptor) Commit(w safehttp.ResponseHeadersWriter, r *safehttp.IncomingRequest, resp safehttp.Response, _ safehttp.InterceptorConfig) {
+	tmplResp, ok := resp.(*safehttp.TemplateResponse)
+	if !ok {
+		return
+	}
+	ctx := r.Context()
+	if tmplResp.FuncMap == nil {
+		tmplResp.FuncMap = map[string]interface{}{}
+	}
+	tmplResp.FuncMap[TemplateFuncName] = func(experiment string) string { return Assigned(ctx, experiment) }
+}
+
+// Match returns false since there are no supported configurations.
+func (Interceptor) Match(safehttp.InterceptorConfig) bool {
+	return false
+}
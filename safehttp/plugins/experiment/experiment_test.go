@@ -0,0 +1,143 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package experiment_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-safeweb/safehttp"
+	"github.com/google/go-safeweb/safehttp/plugins/experiment"
+	"github.com/google/safehtml/template"
+)
+
+var checkout = experiment.Experiment{
+	Name: "checkout",
+	Arms: []experiment.Arm{{Name: "control", Weight: 1}, {Name: "one-page", Weight: 1}},
+}
+
+func newMux(it experiment.Interceptor, handler safehttp.Handler) *safehttp.ServeMux {
+	mc := safehttp.NewServeMuxConfig(nil)
+	mc.Intercept(it)
+	mux := mc.Mux()
+	mux.Handle("/", safehttp.MethodGet, handler)
+	return mux
+}
+
+func TestDeterministicAssignment(t *testing.T) {
+	arms := map[string]int{}
+	var got string
+	mux := newMux(experiment.Interceptor{
+		Experiments: []experiment.Experiment{checkout},
+		Identify:    func(r *safehttp.IncomingRequest) string { return r.Header.Get("User") },
+	}, safehttp.HandlerFunc(func(w safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+		got = experiment.Assigned(r.Context(), "checkout")
+		return w.Write(safehttp.NoContentResponse{})
+	}))
+
+	for _, user := range []string{"a", "b", "c", "d", "e", "f", "g", "h"} {
+		var first string
+		for i := 0; i < 3; i++ {
+			req := httptest.NewRequest(http.MethodGet, "https://foo.com/", nil)
+			req.Header.Set("User", user)
+			mux.ServeHTTP(httptest.NewRecorder(), req)
+			if i == 0 {
+				first = got
+			} else if got != first {
+				t.Errorf("user %q assigned to %q, then %q", user, first, got)
+			}
+		}
+		arms[first]++
+	}
+	if len(arms) != 2 || arms["control"] == 0 || arms["one-page"] == 0 {
+		t.Errorf("assignments: got %v, want both arms", arms)
+	}
+}
+
+func TestAnonymousCookie(t *testing.T) {
+	mux := newMux(experiment.Interceptor{Experiments: []experiment.Experiment{checkout}},
+		safehttp.HandlerFunc(func(w safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+			return w.Write(safehttp.NoContentResponse{})
+		}))
+
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "https://foo.com/", nil))
+	cookie := rr.Header().Get("Set-Cookie")
+	if !strings.HasPrefix(cookie, experiment.DefaultCookieName+"=") || !strings.Contains(cookie, "; HttpOnly; Secure; SameSite=Lax") {
+		t.Errorf("Set-Cookie: got %q, want a secure experiment cookie", cookie)
+	}
+	if got := rr.Header().Get("Vary"); got != "Cookie" {
+		t.Errorf("Vary: got %q, want %q", got, "Cookie")
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "https://foo.com/", nil)
+	req.Header.Set("Cookie", strings.Split(cookie, ";")[0])
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	if got := rr.Header().Get("Set-Cookie"); got != "" {
+		t.Errorf("Set-Cookie with an existing cookie: got %q, want none", got)
+	}
+	if got := rr.Header().Get("Vary"); got != "Cookie" {
+		t.Errorf("Vary with an existing cookie: got %q, want %q", got, "Cookie")
+	}
+}
+
+func TestClaimedCookie(t *testing.T) {
+	var err error
+	mux := newMux(experiment.Interceptor{Experiments: []experiment.Experiment{checkout}},
+		safehttp.HandlerFunc(func(w safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+			err = w.AddCookie(safehttp.NewCookie(experiment.DefaultCookieName, "clobbered"))
+			return w.Write(safehttp.NoContentResponse{})
+		}))
+
+	mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "https://foo.com/", nil))
+	if !errors.Is(err, safehttp.ErrCookieClaimed) {
+		t.Errorf("w.AddCookie(experiment cookie): got err %v, want %v", err, safehttp.ErrCookieClaimed)
+	}
+}
+
+func TestExposureAndTemplate(t *testing.T) {
+	var exposures []experiment.Exposure
+	tmpl := template.Must(template.New("").Funcs(experiment.FuncMap()).Parse(
+		`{{experimentArm "checkout"}} {{experimentArm "checkout"}} {{experimentArm "unknown"}}`))
+	mux := newMux(experiment.Interceptor{
+		Experiments: []experiment.Experiment{checkout},
+		Identify:    func(*safehttp.IncomingRequest) string { return "user" },
+		OnExposure: func(_ *safehttp.IncomingRequest, e experiment.Exposure) {
+			exposures = append(exposures, e)
+		},
+	}, safehttp.HandlerFunc(func(w safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+		return safehttp.ExecuteTemplate(w, tmpl, nil)
+	}))
+
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "https://foo.com/", nil))
+
+	if len(exposures) != 1 {
+		t.Fatalf("exposures: got %v, want one", exposures)
+	}
+	arm := exposures[0].Arm
+	want := experiment.Exposure{Experiment: "checkout", Arm: arm, Identity: "user"}
+	if diff := cmp.Diff(want, exposures[0]); diff != "" || arm == "" {
+		t.Errorf("exposure mismatch (-want +got):\n%s", diff)
+	}
+	if got, want := rr.Body.String(), arm+" "+arm+" "; got != want {
+		t.Errorf("rr.Body: got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,294 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package fragments provides server-side includes for safehtml templates:
+// templates call the include function with the path of a fragment, which is
+// rendered by an internal handler and inlined into the page.
+//
+// Fragment handlers are registered on their own safehttp.ServeMux which is
+// never served to clients, so composite pages can be assembled from
+// independently implemented parts without exposing them as endpoints.
+//
+// # Usage
+//
+//	internal := safehttp.NewServeMuxConfig(nil)
+//	// Install the same interceptors as the public mux, e.g. for escaping.
+//	fmux := internal.Mux()
+//	fmux.Handle("/fragments/header", safehttp.MethodGet, headerHandler)
+//
+//	cfg.Intercept(fragments.NewInterceptor(fragments.Options{
+//		Handler:  fmux,
+//		CacheTTL: time.Minute,
+//	}))
+//
+//	// Parse the templates with fragments.FuncMap(), then:
+//	// {{include "/fragments/header"}}
+//
+// Fragments are fetched without the cookies and headers of the original
+// request, nor its host, so they can be shared, and cached, across users and
+// can't be used to render data of the user they're not meant for.
+package fragments
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-safeweb/safehttp"
+	"github.com/google/safehtml"
+	"github.com/google/safehtml/uncheckedconversions"
+)
+
+// TemplateFuncName is the name of the template function including a fragment.
+const TemplateFuncName = "include"
+
+// FuncMap returns a placeholder for the template function of the plugin, to
+// be passed to the Funcs method of templates before parsing them.
+func FuncMap() map[string]interface{} {
+	return map[string]interface{}{TemplateFuncName: func(string) (safehtml.HTML, error) { return safehtml.HTML{}, nil }}
+}
+
+const (
+	defaultTimeout = 2 * time.Second
+	defaultHost    = "localhost"
+	// maxCacheEntries bounds the number of cached fragments, as their paths
+	// can depend on the request.
+	maxCacheEntries = 1024
+)
+
+// Options configures the fetching of fragments.
+type Options struct {
+	// Handler renders the fragments. It should be a safehttp.ServeMux only
+	// used for fragments, and its handlers must respond with HTML, e.g. using
+	// safehttp.ExecuteTemplate.
+	Handler http.Handler
+	// Host is the host the fragments are rendered for. If empty, "localhost"
+	// is used. The host of the original request isn't used, as it's chosen
+	// by the client.
+	Host string
+	// Timeout bounds the rendering of a fragment. If zero, 2 seconds is used.
+	Timeout time.Duration
+	// CacheTTL is how long rendered fragments are cached for. If zero,
+	// fragments are not cached. At most 1024 fragments are cached, expired
+	// ones being evicted to make room. Concurrent includes of the same
+	// fragment share a single rendering either way.
+	CacheTTL time.Duration
+	// Clock is used to expire cached fragments. If nil, the system clock is
+	// used.
+	Clock safehttp.Clock
+}
+
+// Interceptor adds the include function to safehttp.TemplateResponses.
+type Interceptor struct {
+	f *fetcher
+}
+
+var _ safehttp.Interceptor = Interceptor{}
+
+// NewInterceptor creates an Interceptor fetching fragments from
+// opts.Handler.
+func NewInterceptor(opts Options) Interceptor {
+	if opts.Timeout == 0 {
+		opts.Timeout = defaultTimeout
+	}
+	if opts.Host == "" {
+		opts.Host = defaultHost
+	}
+	if opts.Clock == nil {
+		opts.Clock = safehttp.SystemClock()
+	}
+	return Interceptor{f: &fetcher{
+		opts:     opts,
+		cache:    map[string]cached{},
+		inFlight: map[string]*call{},
+	}}
+}
+
+// Before is a no-op, required to satisfy the safehttp.Interceptor interface.
+func (Interceptor) Before(w safehttp.ResponseWriter, _ *safehttp.IncomingRequest, _ safehttp.InterceptorConfig) safehttp.Result {
+	return safehttp.NotWritten()
+}
+
+// Commit adds the include function to safehttp.TemplateResponses. The
+// rendering of fragments is canceled if the request is.
+func (it Interceptor) Commit(w safehttp.ResponseHeadersWriter, r *safehttp.IncomingRequest, resp safehttp.Response, _ safehttp.InterceptorConfig) {
+	tmplResp, ok := resp.(*safehttp.TemplateResponse)
+	if !ok {
+		return
+	}
+	ctx := r.Context()
+	if tmplResp.FuncMap == nil {
+		tmplResp.FuncMap = map[string]interface{}{}
+	}
+	tmplResp.FuncMap[TemplateFuncName] = func(path string) (safehtml.HTML, error) {
+		return it.f.fetch(ctx, path)
+	}
+}
+
+// Match returns false since there are no supported configurations.
+func (Interceptor) Match(safehttp.InterceptorConfig) bool {
+	return false
+}
+
+type cached struct {
+	html    safehtml.HTML
+	expires time.Time
+}
+
+type call struct {
+	done chan struct{}
+	html safehtml.HTML
+	err  error
+}
+
+type fetcher struct {
+	opts Options
+
+	mu       sync.Mutex
+	cache    map[string]cached
+	inFlight map[string]*call
+}
+
+func (f *fetcher) fetch(ctx context.Context, path string) (safehtml.HTML, error) {
+	u, err := url.Parse(path)
+	if err != nil || !strings.HasPrefix(path, "/") || strings.HasPrefix(path, "//") || u.Host != "" {
+		return safehtml.HTML{}, fmt.Errorf("invalid fragment path %q", path)
+	}
+
+	f.mu.Lock()
+	if c, ok := f.cache[path]; ok && f.opts.Clock.Now().Before(c.expires) {
+		f.mu.Unlock()
+		return c.html, nil
+	}
+	c, ok := f.inFlight[path]
+	if !ok {
+		c = &call{done: make(chan struct{})}
+		f.inFlight[path] = c
+		go f.render(c, path)
+	}
+	f.mu.Unlock()
+
+	select {
+	case <-c.done:
+		return c.html, c.err
+	case <-ctx.Done():
+		return safehtml.HTML{}, fmt.Errorf("including fragment %q: %v", path, ctx.Err())
+	}
+}
+
+// render renders the fragment in the background, so that a canceled include
+// doesn't fail the concurrent ones sharing the call.
+func (f *fetcher) render(c *call, path string) {
+	ctx, cancel := context.WithTimeout(context.Background(), f.opts.Timeout)
+	defer cancel()
+	type result struct {
+		html safehtml.HTML
+		err  error
+	}
+	// Buffered, so that a handler outliving the timeout doesn't leak.
+	results := make(chan result, 1)
+	go func() {
+		html, err := f.serve(ctx, path)
+		results <- result{html, err}
+	}()
+	var html safehtml.HTML
+	var err error
+	select {
+	case r := <-results:
+		html, err = r.html, r.err
+	case <-ctx.Done():
+		err = fmt.Errorf("including fragment %q: %v", path, ctx.Err())
+	}
+
+	f.mu.Lock()
+	delete(f.inFlight, path)
+	if err == nil && f.opts.CacheTTL > 0 {
+		f.store(path, html)
+	}
+	f.mu.Unlock()
+	c.html, c.err = html, err
+	close(c.done)
+}
+
+// store caches the rendered fragment, evicting the expired ones if the cache
+// is full. The fragment isn't cached if there's still no room. f.mu must be
+// held.
+func (f *fetcher) store(path string, html safehtml.HTML) {
+	now := f.opts.Clock.Now()
+	if _, ok := f.cache[path]; !ok && len(f.cache) >= maxCacheEntries {
+		for p, c := range f.cache {
+			if !now.Before(c.expires) {
+				delete(f.cache, p)
+			}
+		}
+		if len(f.cache) >= maxCacheEntries {
+			return
+		}
+	}
+	f.cache[path] = cached{html: html, expires: now.Add(f.opts.CacheTTL)}
+}
+
+func (f *fetcher) serve(ctx context.Context, path string) (html safehtml.HTML, err error) {
+	defer func() {
+		// The framework panics when a response can't be written.
+		if p := recover(); p != nil {
+			err = fmt.Errorf("including fragment %q: handler panicked: %v", path, p)
+		}
+	}()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://"+f.opts.Host+path, nil)
+	if err != nil {
+		return safehtml.HTML{}, err
+	}
+	rw := &bufferedResponseWriter{header: http.Header{}}
+	f.opts.Handler.ServeHTTP(rw, req)
+	if rw.code != 0 && rw.code != http.StatusOK {
+		return safehtml.HTML{}, fmt.Errorf("including fragment %q: got status %d", path, rw.code)
+	}
+	if mt, _, err := mime.ParseMediaType(rw.header.Get("Content-Type")); err != nil || mt != "text/html" {
+		// Only HTML responses are written by the framework in a way that
+		// makes them safe to inline.
+		return safehtml.HTML{}, fmt.Errorf("including fragment %q: got Content-Type %q, want text/html", path, rw.header.Get("Content-Type"))
+	}
+	return uncheckedconversions.HTMLFromStringKnownToSatisfyTypeContract(rw.body.String()), nil
+}
+
+// bufferedResponseWriter records the response of a fragment handler.
+type bufferedResponseWriter struct {
+	header http.Header
+	code   int
+	body   bytes.Buffer
+}
+
+func (rw *bufferedResponseWriter) Header() http.Header {
+	return rw.header
+}
+
+func (rw *bufferedResponseWriter) WriteHeader(code int) {
+	if rw.code == 0 {
+		rw.code = code
+	}
+}
+
+func (rw *bufferedResponseWriter) Write(b []byte) (int, error) {
+	if rw.code == 0 {
+		rw.code = http.StatusOK
+	}
+	return rw.body.Write(b)
+}
@@ -0,0 +1,177 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fragments_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/go-safeweb/safehttp"
+	"github.com/google/go-safeweb/safehttp/plugins/fragments"
+	"github.com/google/go-safeweb/safehttp/safehttptest"
+	"github.com/google/safehtml/template"
+)
+
+var fragmentTmpl = template.Must(template.New("fragment").Parse(`<nav>{{.}}</nav>`))
+
+type env struct {
+	rendered int32
+	public   *safehttp.ServeMux
+}
+
+func newEnv(t *testing.T, opts fragments.Options, page string) *env {
+	t.Helper()
+	e := &env{}
+	fmux := safehttp.NewServeMuxConfig(nil).Mux()
+	fmux.Handle("/fragments/nav", safehttp.MethodGet, safehttp.HandlerFunc(func(w safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+		atomic.AddInt32(&e.rendered, 1)
+		return safehttp.ExecuteTemplate(w, fragmentTmpl, "<home> on "+r.Host())
+	}))
+	fmux.Handle("/fragments/json", safehttp.MethodGet, safehttp.HandlerFunc(func(w safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+		return w.Write(safehttp.JSONResponse{Data: "<script>"})
+	}))
+	fmux.Handle("/fragments/slow", safehttp.MethodGet, safehttp.HandlerFunc(func(w safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+		<-r.Context().Done()
+		return safehttp.ExecuteTemplate(w, fragmentTmpl, "late")
+	}))
+	opts.Handler = fmux
+
+	cfg := safehttp.NewServeMuxConfig(nil)
+	cfg.Intercept(fragments.NewInterceptor(opts))
+	e.public = cfg.Mux()
+	tmpl, err := template.New("page").Funcs(fragments.FuncMap()).Parse(`{{include .}}<p>body</p>`)
+	if err != nil {
+		t.Fatalf("template.Parse() got err: %v", err)
+	}
+	e.public.Handle("/page", safehttp.MethodGet, safehttp.HandlerFunc(func(w safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+		return safehttp.ExecuteTemplate(w, tmpl, page)
+	}))
+	return e
+}
+
+// get requests the page and returns its body, or ok set to false if it failed
+// to render.
+func (e *env) get() (body string, ok bool) {
+	defer func() {
+		// The framework panics when the template fails to execute, which
+		// net/http turns into an aborted response.
+		if recover() != nil {
+			body, ok = "", false
+		}
+	}()
+	rr := httptest.NewRecorder()
+	e.public.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "https://foo.com/page", nil))
+	return rr.Body.String(), rr.Code == http.StatusOK
+}
+
+func TestInclude(t *testing.T) {
+	e := newEnv(t, fragments.Options{}, "/fragments/nav")
+	body, ok := e.get()
+	if !ok {
+		t.Fatal("page failed to render")
+	}
+	if want := `<nav>&lt;home&gt; on localhost</nav><p>body</p>`; body != want {
+		t.Errorf("body: got %q, want %q", body, want)
+	}
+	e.get()
+	if got := atomic.LoadInt32(&e.rendered); got != 2 {
+		t.Errorf("fragment rendered %d times without cache, want 2", got)
+	}
+}
+
+func TestIncludeCache(t *testing.T) {
+	clock := safehttptest.NewFakeClock(time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC))
+	e := newEnv(t, fragments.Options{CacheTTL: time.Minute, Clock: clock}, "/fragments/nav")
+	for i := 0; i < 3; i++ {
+		if _, ok := e.get(); !ok {
+			t.Fatal("page failed to render")
+		}
+	}
+	if got := atomic.LoadInt32(&e.rendered); got != 1 {
+		t.Errorf("fragment rendered %d times, want 1", got)
+	}
+	clock.Set(clock.Now().Add(2 * time.Minute))
+	e.get()
+	if got := atomic.LoadInt32(&e.rendered); got != 2 {
+		t.Errorf("fragment rendered %d times after expiration, want 2", got)
+	}
+}
+
+func TestIncludeHost(t *testing.T) {
+	e := newEnv(t, fragments.Options{Host: "internal.foo.com"}, "/fragments/nav")
+	body, ok := e.get()
+	if !ok {
+		t.Fatal("page failed to render")
+	}
+	if want := `<nav>&lt;home&gt; on internal.foo.com</nav><p>body</p>`; body != want {
+		t.Errorf("body: got %q, want %q", body, want)
+	}
+}
+
+func TestIncludeCacheIgnoresHost(t *testing.T) {
+	clock := safehttptest.NewFakeClock(time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC))
+	e := newEnv(t, fragments.Options{CacheTTL: time.Minute, Clock: clock}, "/fragments/nav")
+	for _, host := range []string{"a.com", "b.com", "c.com"} {
+		rr := httptest.NewRecorder()
+		e.public.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "https://"+host+"/page", nil))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("rr.Code: got %d, want %d", rr.Code, http.StatusOK)
+		}
+	}
+	if got := atomic.LoadInt32(&e.rendered); got != 1 {
+		t.Errorf("fragment rendered %d times for different hosts, want 1", got)
+	}
+}
+
+func TestIncludeConcurrent(t *testing.T) {
+	e := newEnv(t, fragments.Options{}, "/fragments/nav")
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if body, ok := e.get(); !ok || !strings.Contains(body, "<nav>") {
+				t.Errorf("got body %q, ok %v", body, ok)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestIncludeErrors(t *testing.T) {
+	tests := []struct {
+		name, path string
+		opts       fragments.Options
+	}{
+		{name: "Not HTML", path: "/fragments/json"},
+		{name: "Not found", path: "/fragments/missing"},
+		{name: "Timeout", path: "/fragments/slow", opts: fragments.Options{Timeout: 10 * time.Millisecond}},
+		{name: "Absolute URL", path: "https://evil.com/fragments/nav"},
+		{name: "Protocol relative", path: "//evil.com/fragments/nav"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newEnv(t, tt.opts, tt.path)
+			if body, ok := e.get(); ok {
+				t.Errorf("page rendered with body %q, want error", body)
+			}
+		})
+	}
+}
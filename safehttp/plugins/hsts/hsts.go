@@ -20,6 +20,10 @@
 // Strict-Transport-Security header on all HTTPS responses. Please note that this
 // only applies if the framework is not run in dev mode.
 //
+// When the application terminates TLS itself, plaintext requests arrive on a
+// separate port and never reach the Interceptor: serve that port with
+// safehttp.RedirectServer so that first-time visitors are redirected too.
+//
 // More info:
 //  - MDN: https://developer.mozilla.org/en-US/docs/Web/HTTP/Headers/Strict-Transport-Security
 //  - Wikipedia: https://en.wikipedia.org/wiki/HTTP_Strict_Transport_Security
@@ -99,6 +99,24 @@ func XSRFTokens(inputTag string) TransformConfig {
 		AddNodes: []string{inputTag}}}
 }
 
+// BeaconsDefaultFuncName is the default func name for the func that generates
+// beacons.
+const BeaconsDefaultFuncName = "Beacon"
+
+// BeaconsDefault is the default config to add beacons, e.g. telemetry scripts
+// or watermarks, at the beginning of the body of pages. The rewritten template
+// expects the Beacon Func to be available in the template to provide them.
+var BeaconsDefault = Beacons(`{{` + BeaconsDefaultFuncName + `}}`)
+
+// Beacons constructs a Config to add the given string as the first child node
+// of the body.
+func Beacons(node string) TransformConfig {
+	return TransformConfig{Rule{
+		Name:     "Beacons in body",
+		OnTag:    "body",
+		AddNodes: []string{node}}}
+}
+
 // Transform rewrites the given template according to the given configs.
 // If the passed io.Rewriter has a `Size() int64` method it will be used to pre-allocate buffers.
 func Transform(src io.Reader, cfg ...TransformConfig) (string, error) {
@@ -127,6 +145,9 @@ type LoadConfig struct {
 	DisableCSP bool
 	// DisableXSRF disables XSRF token injection
 	DisableXSRF bool
+	// Beacons enables beacon injection. It's disabled by default as the
+	// templates then need the Beacon Func, e.g. from the beacon plugin.
+	Beacons bool
 }
 
 // LoadTrustedTemplate processes the given TrustedTemplate with the specified default configurations and
@@ -146,6 +167,10 @@ func LoadTrustedTemplate(tpl *template.Template, lcfg LoadConfig, src template.T
 		cfg = append(cfg, XSRFTokensDefault)
 		funcMap[XSRFTokensDefaultFuncName] = noop
 	}
+	if lcfg.Beacons {
+		cfg = append(cfg, BeaconsDefault)
+		funcMap[BeaconsDefaultFuncName] = noop
+	}
 	got, err := Transform(strings.NewReader(src.String()), cfg...)
 	if err != nil {
 		return nil, err
@@ -23,6 +23,7 @@ import (
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
+	"github.com/google/safehtml"
 	safetemplate "github.com/google/safehtml/template"
 	"github.com/google/safehtml/template/uncheckedconversions"
 )
@@ -325,3 +326,23 @@ func TestLoadGlob(t *testing.T) {
 		})
 	}
 }
+
+func TestLoadTrustedTemplateWithBeacons(t *testing.T) {
+	in := `<html><head><title>Hi</title></head><body class="main"><p>Content</p></body></html>`
+	want := `<html><head><title>Hi</title></head><body class="main">&lt;beacon&gt;<p>Content</p></body></html>`
+
+	tpl, err := LoadTrustedTemplate(nil, LoadConfig{DisableCSP: true, DisableXSRF: true, Beacons: true}, uncheckedconversions.TrustedTemplateFromStringKnownToSatisfyTypeContract(in))
+	if err != nil {
+		t.Fatalf("LoadTrustedTemplate: got err %q", err)
+	}
+	var sb strings.Builder
+	err = tpl.Funcs(map[string]interface{}{
+		BeaconsDefaultFuncName: func() safehtml.HTML { return safehtml.HTMLEscaped("<beacon>") },
+	}).Execute(&sb, nil)
+	if err != nil {
+		t.Fatalf("Execute: got err %q", err)
+	}
+	if diff := cmp.Diff(want, sb.String()); diff != "" {
+		t.Errorf("-want +got %s", diff)
+	}
+}
@@ -0,0 +1,149 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package inspect gives security interceptors, such as in-process WAFs,
+// bounded access to request bodies before handlers run.
+//
+// Reading the body from an interceptor would otherwise consume it: the
+// Inspector buffers the part it reads and replays it to the handler, which
+// reads the full body as usual.
+//
+// Access to the bodies is granted through the Inspector value itself: only
+// the interceptors it's passed to can read them.
+//
+// # Usage
+//
+// Create an Inspector and pass it to the interceptors needing it:
+//
+//	in := inspect.NewInspector(inspect.Options{ContentTypes: []string{"application/json"}})
+//	cfg.Intercept(myWAF{inspector: in})
+//
+// In the Before phase of the interceptor, call Body:
+//
+//	body, ok, err := it.inspector.Body(r)
+package inspect
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"mime"
+
+	"github.com/google/go-safeweb/safehttp"
+	"github.com/google/go-safeweb/safehttp/restricted"
+)
+
+// DefaultMaxBytes is the inspection limit used when none is configured.
+const DefaultMaxBytes = 64 << 10
+
+// Options configures an Inspector.
+type Options struct {
+	// MaxBytes is the maximum number of bytes of a body that are buffered for
+	// inspection. Longer bodies are inspected partially. If zero,
+	// DefaultMaxBytes is used.
+	MaxBytes int64
+	// ContentTypes are the media types, e.g. "application/json", of the
+	// bodies to inspect. If empty, bodies of all types are inspected.
+	ContentTypes []string
+}
+
+// Inspector buffers request bodies for inspection.
+type Inspector struct {
+	maxBytes     int64
+	contentTypes map[string]bool
+}
+
+// NewInspector creates an Inspector with the given options.
+func NewInspector(opts Options) *Inspector {
+	in := &Inspector{maxBytes: opts.MaxBytes}
+	if in.maxBytes <= 0 {
+		in.maxBytes = DefaultMaxBytes
+	}
+	if len(opts.ContentTypes) > 0 {
+		in.contentTypes = map[string]bool{}
+		for _, ct := range opts.ContentTypes {
+			in.contentTypes[ct] = true
+		}
+	}
+	return in
+}
+
+type captureKey struct {
+	in *Inspector
+}
+
+type capture struct {
+	body     []byte
+	complete bool
+	err      error
+}
+
+// Body returns up to the configured MaxBytes bytes of the body of the request.
+// complete reports whether that's the whole body. The returned slice must not
+// be modified.
+//
+// Body returns nil and false if the request has a Content-Type that is not
+// inspected. The body is only read once per request, so all the interceptors
+// sharing an Inspector get the same result.
+//
+// Body must be called before the handler reads the body, i.e. in the Before
+// phase of interceptors.
+func (in *Inspector) Body(r *safehttp.IncomingRequest) (body []byte, complete bool, err error) {
+	if !in.inspected(r) {
+		return nil, false, nil
+	}
+	fv := safehttp.FlightValues(r.Context())
+	c, ok := fv.Get(captureKey{in}).(*capture)
+	if !ok {
+		c = &capture{}
+		c.body, c.complete, c.err = in.read(r)
+		fv.Put(captureKey{in}, c)
+	}
+	return c.body, c.complete, c.err
+}
+
+func (in *Inspector) inspected(r *safehttp.IncomingRequest) bool {
+	if in.contentTypes == nil {
+		return true
+	}
+	mt, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && in.contentTypes[mt]
+}
+
+func (in *Inspector) read(r *safehttp.IncomingRequest) ([]byte, bool, error) {
+	req := restricted.RawRequest(r)
+	if req.Body == nil {
+		return nil, true, nil
+	}
+	// Read one more byte than needed to know whether the body is complete.
+	b, err := ioutil.ReadAll(io.LimitReader(req.Body, in.maxBytes+1))
+	// Replay what was read, followed by the rest, even on errors, so that
+	// the handler sees the same body as without inspection.
+	req.Body = &replayedBody{
+		Reader: io.MultiReader(bytes.NewReader(b), req.Body),
+		Closer: req.Body,
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	if int64(len(b)) > in.maxBytes {
+		return b[:in.maxBytes], false, nil
+	}
+	return b, true, nil
+}
+
+type replayedBody struct {
+	io.Reader
+	io.Closer
+}
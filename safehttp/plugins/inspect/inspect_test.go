@@ -0,0 +1,126 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package inspect_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-safeweb/safehttp"
+	"github.com/google/go-safeweb/safehttp/plugins/inspect"
+)
+
+type inspection struct {
+	body     string
+	complete bool
+	called   bool
+}
+
+type interceptor struct {
+	in   *inspect.Inspector
+	got  *inspection
+	fail func(string, ...interface{})
+}
+
+func (it interceptor) Before(w safehttp.ResponseWriter, r *safehttp.IncomingRequest, _ safehttp.InterceptorConfig) safehttp.Result {
+	b, complete, err := it.in.Body(r)
+	if err != nil {
+		it.fail("it.in.Body() got err: %v", err)
+	}
+	*it.got = inspection{body: string(b), complete: complete, called: true}
+	return safehttp.NotWritten()
+}
+
+func (interceptor) Commit(w safehttp.ResponseHeadersWriter, r *safehttp.IncomingRequest, resp safehttp.Response, _ safehttp.InterceptorConfig) {
+}
+
+func (interceptor) Match(safehttp.InterceptorConfig) bool {
+	return false
+}
+
+func TestInspectorBody(t *testing.T) {
+	tests := []struct {
+		name        string
+		opts        inspect.Options
+		contentType string
+		body        string
+		want        inspection
+	}{
+		{
+			name:        "Complete",
+			contentType: "application/json",
+			body:        `{"a":1}`,
+			want:        inspection{body: `{"a":1}`, complete: true, called: true},
+		},
+		{
+			name:        "Truncated",
+			opts:        inspect.Options{MaxBytes: 4},
+			contentType: "application/json",
+			body:        `{"a":1}`,
+			want:        inspection{body: `{"a"`, complete: false, called: true},
+		},
+		{
+			name:        "Filtered Content-Type",
+			opts:        inspect.Options{ContentTypes: []string{"application/json"}},
+			contentType: "text/plain",
+			body:        "hello",
+			want:        inspection{called: true},
+		},
+		{
+			name:        "Matching Content-Type",
+			opts:        inspect.Options{ContentTypes: []string{"application/json"}},
+			contentType: "application/json; charset=utf-8",
+			body:        "{}",
+			want:        inspection{body: "{}", complete: true, called: true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			in := inspect.NewInspector(tt.opts)
+			var first, second inspection
+			mc := safehttp.NewServeMuxConfig(nil)
+			mc.Intercept(interceptor{in: in, got: &first, fail: t.Errorf})
+			mc.Intercept(interceptor{in: in, got: &second, fail: t.Errorf})
+			mux := mc.Mux()
+
+			var handlerBody string
+			mux.Handle("/", safehttp.MethodPost, safehttp.HandlerFunc(func(w safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+				b, err := ioutil.ReadAll(r.Body())
+				if err != nil {
+					t.Errorf("ioutil.ReadAll(r.Body()) got err: %v", err)
+				}
+				handlerBody = string(b)
+				return w.Write(safehttp.NoContentResponse{})
+			}))
+
+			req := httptest.NewRequest(http.MethodPost, "https://foo.com/", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+			mux.ServeHTTP(httptest.NewRecorder(), req)
+
+			if first != tt.want {
+				t.Errorf("first inspection: got %+v, want %+v", first, tt.want)
+			}
+			if second != tt.want {
+				t.Errorf("second inspection: got %+v, want %+v", second, tt.want)
+			}
+			if handlerBody != tt.body {
+				t.Errorf("handler body: got %q, want %q", handlerBody, tt.body)
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package ratelimitheaders sets the RateLimit headers on behalf of the
+// Interceptors limiting requests, e.g. ratelimit and quota, so that they can
+// be installed together. The headers report the most restrictive of the
+// limits applied to the request.
+package ratelimitheaders
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/google/go-safeweb/safehttp"
+)
+
+// Limit is the state of a limit applied to a request.
+type Limit struct {
+	// Limit is the number of requests allowed in a window.
+	Limit int64
+	// Remaining is the number of requests left in the current window.
+	Remaining int64
+	// Reset is the number of seconds until the window resets.
+	Reset int64
+	// Rejected reports whether the limit rejects the request.
+	Rejected bool
+	// RetryAfter is the number of seconds after which a rejected request can
+	// be retried.
+	RetryAfter int64
+	// Legacy sets the X-RateLimit- equivalents of the headers as well.
+	Legacy bool
+}
+
+// names are all the headers set, claimed on first use.
+var names = []string{
+	"RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset",
+	"X-RateLimit-Limit", "X-RateLimit-Remaining", "X-RateLimit-Reset",
+	"Retry-After",
+}
+
+type reporterKey struct{}
+
+type reporter struct {
+	set    map[string]func([]string)
+	limit  *Limit
+	legacy bool
+	// retry is the Retry-After delay, or -1 if no limit rejected the
+	// request.
+	retry int64
+}
+
+// Claim claims the headers for the request, unless an Interceptor already
+// did. It must be called in the Before phase, before Report.
+func Claim(w safehttp.ResponseWriter, r *safehttp.IncomingRequest) {
+	fv := safehttp.FlightValues(r.Context())
+	if _, ok := fv.Get(reporterKey{}).(*reporter); ok {
+		return
+	}
+	rep := &reporter{set: map[string]func([]string){}, retry: -1}
+	for _, name := range names {
+		rep.set[name] = w.Header().Claim(name)
+	}
+	fv.Put(reporterKey{}, rep)
+}
+
+// Report sets the headers according to l if it's more restrictive than the
+// limits reported before for the request, i.e. if it has fewer remaining
+// requests, or as many but resets later. Retry-After is set to the longest
+// delay of the rejecting limits. Report does nothing if Claim wasn't called.
+func Report(ctx context.Context, l Limit) {
+	rep, ok := safehttp.FlightValues(ctx).Get(reporterKey{}).(*reporter)
+	if !ok {
+		return
+	}
+	rep.legacy = rep.legacy || l.Legacy
+	if l.Rejected && l.RetryAfter > rep.retry {
+		rep.retry = l.RetryAfter
+		rep.set["Retry-After"]([]string{strconv.FormatInt(rep.retry, 10)})
+	}
+	if rep.limit == nil || l.Remaining < rep.limit.Remaining ||
+		(l.Remaining == rep.limit.Remaining && l.Reset > rep.limit.Reset) {
+		rep.limit = &l
+	}
+	values := map[string][]string{
+		"Limit":     {strconv.FormatInt(rep.limit.Limit, 10)},
+		"Remaining": {strconv.FormatInt(rep.limit.Remaining, 10)},
+		"Reset":     {strconv.FormatInt(rep.limit.Reset, 10)},
+	}
+	for suffix, v := range values {
+		rep.set["RateLimit-"+suffix](v)
+		if rep.legacy {
+			rep.set["X-RateLimit-"+suffix](v)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package responserecorder records the status code and the size of the
+// responses written through it, for the plugins wrapping a safehttp.ServeMux
+// in an http.Handler, e.g. to observe the requests which don't reach its
+// interceptors.
+package responserecorder
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+)
+
+// New returns the writer to use instead of rw, and the Recorder recording
+// what's written to it. The returned writer supports hijacking, e.g. for
+// WebSockets, if rw does.
+func New(rw http.ResponseWriter) (http.ResponseWriter, *Recorder) {
+	r := &Recorder{rw: rw}
+	if h, ok := rw.(http.Hijacker); ok {
+		return hijackableRecorder{Recorder: r, hijacker: h}, r
+	}
+	return r, r
+}
+
+// Recorder records the status code and the size of a response.
+type Recorder struct {
+	rw   http.ResponseWriter
+	code int
+	size int64
+}
+
+// Header returns the headers of the response.
+func (r *Recorder) Header() http.Header {
+	return r.rw.Header()
+}
+
+// WriteHeader records and writes the status code of the response.
+func (r *Recorder) WriteHeader(code int) {
+	if r.code == 0 {
+		r.code = code
+	}
+	r.rw.WriteHeader(code)
+}
+
+// Write writes b to the body of the response, recording its size.
+func (r *Recorder) Write(b []byte) (int, error) {
+	if r.code == 0 {
+		r.code = http.StatusOK
+	}
+	n, err := r.rw.Write(b)
+	r.size += int64(n)
+	return n, err
+}
+
+// Flush sends the bytes written so far to the client, if the underlying
+// http.ResponseWriter supports it.
+func (r *Recorder) Flush() {
+	if f, ok := r.rw.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Status returns the status code of the response.
+func (r *Recorder) Status() int {
+	if r.code == 0 {
+		// net/http writes 200 OK if nothing was written.
+		return http.StatusOK
+	}
+	return r.code
+}
+
+// Size returns the number of bytes of the response body written so far.
+func (r *Recorder) Size() int64 {
+	return r.size
+}
+
+// hijackableRecorder is a Recorder wrapping an http.Hijacker.
+type hijackableRecorder struct {
+	*Recorder
+	hijacker http.Hijacker
+}
+
+// Hijack lets handlers take over the connection.
+func (r hijackableRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if r.code == 0 {
+		r.code = http.StatusSwitchingProtocols
+	}
+	return r.hijacker.Hijack()
+}
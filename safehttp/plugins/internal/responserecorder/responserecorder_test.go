@@ -0,0 +1,61 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package responserecorder
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type hijacker struct {
+	*httptest.ResponseRecorder
+}
+
+func (hijacker) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return nil, nil, nil
+}
+
+func TestRecorder(t *testing.T) {
+	rw, rec := New(httptest.NewRecorder())
+	if _, ok := rw.(http.Hijacker); ok {
+		t.Error("New() of a writer which isn't an http.Hijacker is one")
+	}
+	if got, want := rec.Status(), http.StatusOK; got != want {
+		t.Errorf("Status() before writing: got %d, want %d", got, want)
+	}
+	rw.WriteHeader(http.StatusNotFound)
+	rw.Write([]byte("Not Found"))
+	if got, want := rec.Status(), http.StatusNotFound; got != want {
+		t.Errorf("Status(): got %d, want %d", got, want)
+	}
+	if got, want := rec.Size(), int64(len("Not Found")); got != want {
+		t.Errorf("Size(): got %d, want %d", got, want)
+	}
+}
+
+func TestRecorderHijack(t *testing.T) {
+	rw, rec := New(hijacker{httptest.NewRecorder()})
+	h, ok := rw.(http.Hijacker)
+	if !ok {
+		t.Fatal("New() of an http.Hijacker isn't one")
+	}
+	h.Hijack()
+	if got, want := rec.Status(), http.StatusSwitchingProtocols; got != want {
+		t.Errorf("Status() after Hijack: got %d, want %d", got, want)
+	}
+}
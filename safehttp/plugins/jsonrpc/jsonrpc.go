@@ -0,0 +1,228 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package jsonrpc provides a JSON-RPC 2.0 server which can be registered as
+// a safehttp.Handler, so that RPC endpoints are covered by the interceptors of
+// the safehttp.ServeMux.
+//
+// See https://www.jsonrpc.org/specification.
+//
+// Responses are written as safehttp.JSONResponse and are therefore subject to
+// the same XSSI protection as all other JSON responses.
+package jsonrpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"strings"
+
+	"github.com/google/go-safeweb/safehttp"
+)
+
+// The error codes defined by the specification.
+const (
+	CodeParseError     = -32700
+	CodeInvalidRequest = -32600
+	CodeMethodNotFound = -32601
+	CodeInvalidParams  = -32602
+	CodeInternalError  = -32603
+)
+
+// Error is a JSON-RPC error. Methods can return an *Error to control the error
+// sent to the client. Any other error results in an internal error, without
+// details.
+type Error struct {
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("jsonrpc: error %d: %s", e.Code, e.Message)
+}
+
+// InvalidParams returns an *Error reporting invalid method parameters.
+func InvalidParams(msg string) *Error {
+	return &Error{Code: CodeInvalidParams, Message: msg}
+}
+
+// Method is a JSON-RPC method. It receives the raw parameters of the call,
+// which are nil if the call has none.
+type Method func(ctx context.Context, params json.RawMessage) (result interface{}, err error)
+
+// Server dispatches JSON-RPC calls, received in the body of POST requests, to
+// the registered methods.
+type Server struct {
+	methods  map[string]Method
+	maxBatch int
+}
+
+var _ safehttp.Handler = (*Server)(nil)
+
+// NewServer creates a Server accepting batches of at most maxBatch calls.
+func NewServer(maxBatch int) *Server {
+	if maxBatch < 1 {
+		panic("jsonrpc: maxBatch must be positive")
+	}
+	return &Server{methods: map[string]Method{}, maxBatch: maxBatch}
+}
+
+// Register registers m as the method with the given name. It panics if a
+// method is registered twice with the same name, or if the name starts with
+// "rpc.", which is reserved by the specification.
+func (s *Server) Register(name string, m Method) {
+	if _, ok := s.methods[name]; ok {
+		panic(fmt.Sprintf("jsonrpc: double registration of method %q", name))
+	}
+	if strings.HasPrefix(name, "rpc.") {
+		panic(fmt.Sprintf("jsonrpc: reserved method name %q", name))
+	}
+	s.methods[name] = m
+}
+
+type request struct {
+	Version string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params"`
+	ID      json.RawMessage `json:"id"`
+}
+
+type response struct {
+	Version string          `json:"jsonrpc"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+	ID      json.RawMessage `json:"id"`
+}
+
+var null = json.RawMessage("null")
+
+func errorResponse(id json.RawMessage, code int, msg string) *response {
+	if id == nil {
+		id = null
+	}
+	return &response{Version: "2.0", Error: &Error{Code: code, Message: msg}, ID: id}
+}
+
+// maxBodyBytes is the maximum size of the body of a request, the default limit
+// of IncomingRequest.JSONBody.
+const maxBodyBytes = 1 << 20
+
+// ServeHTTP serves a single JSON-RPC call or a batch of calls. Requests which
+// are not POST requests with a JSON body of at most 1 MiB are rejected with the
+// corresponding HTTP error; all other failures are reported as JSON-RPC
+// errors. If the request only contains notifications, a 204 No Content
+// response is written.
+func (s *Server) ServeHTTP(w safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+	if r.Method() != safehttp.MethodPost {
+		return w.WriteError(safehttp.StatusMethodNotAllowed)
+	}
+	if ct, _, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err != nil || ct != "application/json" {
+		return w.WriteError(safehttp.StatusUnsupportedMediaType)
+	}
+	b, err := ioutil.ReadAll(io.LimitReader(r.Body(), maxBodyBytes+1))
+	if err != nil {
+		return w.WriteError(safehttp.StatusBadRequest)
+	}
+	if len(b) > maxBodyBytes {
+		return w.WriteError(safehttp.StatusRequestEntityTooLarge)
+	}
+
+	b = bytes.TrimSpace(b)
+	if len(b) == 0 || b[0] != '[' {
+		resp := s.call(r.Context(), b)
+		if resp == nil {
+			return w.Write(safehttp.NoContentResponse{})
+		}
+		return w.Write(safehttp.JSONResponse{Data: resp})
+	}
+
+	var batch []json.RawMessage
+	if err := json.Unmarshal(b, &batch); err != nil {
+		return w.Write(safehttp.JSONResponse{Data: errorResponse(nil, CodeParseError, "parse error")})
+	}
+	if len(batch) == 0 {
+		return w.Write(safehttp.JSONResponse{Data: errorResponse(nil, CodeInvalidRequest, "empty batch")})
+	}
+	if len(batch) > s.maxBatch {
+		return w.Write(safehttp.JSONResponse{Data: errorResponse(nil, CodeInvalidRequest, fmt.Sprintf("batch larger than %d calls", s.maxBatch))})
+	}
+	var resps []*response
+	for _, c := range batch {
+		if resp := s.call(r.Context(), c); resp != nil {
+			resps = append(resps, resp)
+		}
+	}
+	if len(resps) == 0 {
+		return w.Write(safehttp.NoContentResponse{})
+	}
+	return w.Write(safehttp.JSONResponse{Data: resps})
+}
+
+// call executes a single call and returns its response, or nil for
+// notifications.
+func (s *Server) call(ctx context.Context, b []byte) *response {
+	var req request
+	if err := json.Unmarshal(b, &req); err != nil {
+		var syntaxErr *json.SyntaxError
+		if errors.As(err, &syntaxErr) {
+			return errorResponse(nil, CodeParseError, "parse error")
+		}
+		return errorResponse(nil, CodeInvalidRequest, "invalid request")
+	}
+	if req.Version != "2.0" || req.Method == "" || !validID(req.ID) {
+		return errorResponse(req.ID, CodeInvalidRequest, "invalid request")
+	}
+
+	m, ok := s.methods[req.Method]
+	if !ok {
+		if req.ID == nil {
+			return nil
+		}
+		return errorResponse(req.ID, CodeMethodNotFound, "method not found")
+	}
+	result, err := m(ctx, req.Params)
+	if req.ID == nil {
+		// Notifications are never answered, not even with errors.
+		return nil
+	}
+	if err != nil {
+		var rpcErr *Error
+		if errors.As(err, &rpcErr) {
+			return &response{Version: "2.0", Error: rpcErr, ID: req.ID}
+		}
+		return errorResponse(req.ID, CodeInternalError, "internal error")
+	}
+	if result == nil {
+		result = null
+	}
+	return &response{Version: "2.0", Result: result, ID: req.ID}
+}
+
+// validID reports whether id is absent, or a string, a number or null.
+func validID(id json.RawMessage) bool {
+	if id == nil {
+		return true
+	}
+	switch c := id[0]; {
+	case c == '"', c == 'n', c == '-', c >= '0' && c <= '9':
+		return true
+	}
+	return false
+}
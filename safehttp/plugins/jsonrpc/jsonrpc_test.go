@@ -0,0 +1,179 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jsonrpc_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-safeweb/safehttp"
+	"github.com/google/go-safeweb/safehttp/plugins/jsonrpc"
+)
+
+func newServer() *jsonrpc.Server {
+	s := jsonrpc.NewServer(3)
+	s.Register("add", func(_ context.Context, params json.RawMessage) (interface{}, error) {
+		var ns []int
+		if err := json.Unmarshal(params, &ns); err != nil {
+			return nil, jsonrpc.InvalidParams("want an array of numbers")
+		}
+		sum := 0
+		for _, n := range ns {
+			sum += n
+		}
+		return sum, nil
+	})
+	s.Register("fail", func(context.Context, json.RawMessage) (interface{}, error) {
+		return nil, errors.New("secret details")
+	})
+	return s
+}
+
+func serve(t *testing.T, body string) (int, string) {
+	t.Helper()
+	mux := safehttp.NewServeMuxConfig(nil).Mux()
+	mux.Handle("/rpc", safehttp.MethodPost, newServer())
+
+	req := httptest.NewRequest(safehttp.MethodPost, "/rpc", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	return rr.Code, strings.TrimSuffix(strings.TrimPrefix(rr.Body.String(), ")]}',\n"), "\n")
+}
+
+func TestServer(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		wantCode safehttp.StatusCode
+		wantBody string
+	}{
+		{
+			name:     "Call",
+			body:     `{"jsonrpc": "2.0", "method": "add", "params": [1, 2], "id": 1}`,
+			wantCode: safehttp.StatusOK,
+			wantBody: `{"jsonrpc":"2.0","result":3,"id":1}`,
+		},
+		{
+			name:     "Invalid params",
+			body:     `{"jsonrpc": "2.0", "method": "add", "params": {}, "id": "a"}`,
+			wantCode: safehttp.StatusOK,
+			wantBody: `{"jsonrpc":"2.0","error":{"code":-32602,"message":"want an array of numbers"},"id":"a"}`,
+		},
+		{
+			name:     "Internal error",
+			body:     `{"jsonrpc": "2.0", "method": "fail", "id": 1}`,
+			wantCode: safehttp.StatusOK,
+			wantBody: `{"jsonrpc":"2.0","error":{"code":-32603,"message":"internal error"},"id":1}`,
+		},
+		{
+			name:     "Method not found",
+			body:     `{"jsonrpc": "2.0", "method": "missing", "id": 1}`,
+			wantCode: safehttp.StatusOK,
+			wantBody: `{"jsonrpc":"2.0","error":{"code":-32601,"message":"method not found"},"id":1}`,
+		},
+		{
+			name:     "Parse error",
+			body:     `{"jsonrpc": "2.0", "method"`,
+			wantCode: safehttp.StatusOK,
+			wantBody: `{"jsonrpc":"2.0","error":{"code":-32700,"message":"parse error"},"id":null}`,
+		},
+		{
+			name:     "Invalid request",
+			body:     `{"jsonrpc": "1.0", "method": "add", "id": 1}`,
+			wantCode: safehttp.StatusOK,
+			wantBody: `{"jsonrpc":"2.0","error":{"code":-32600,"message":"invalid request"},"id":1}`,
+		},
+		{
+			name:     "Notification",
+			body:     `{"jsonrpc": "2.0", "method": "add", "params": [1]}`,
+			wantCode: safehttp.StatusNoContent,
+		},
+		{
+			name: "Batch",
+			body: `[
+				{"jsonrpc": "2.0", "method": "add", "params": [1, 2], "id": 1},
+				{"jsonrpc": "2.0", "method": "add", "params": [3]},
+				{"jsonrpc": "2.0", "method": "missing", "id": 2}
+			]`,
+			wantCode: safehttp.StatusOK,
+			wantBody: `[{"jsonrpc":"2.0","result":3,"id":1},{"jsonrpc":"2.0","error":{"code":-32601,"message":"method not found"},"id":2}]`,
+		},
+		{
+			name:     "Empty batch",
+			body:     `[]`,
+			wantCode: safehttp.StatusOK,
+			wantBody: `{"jsonrpc":"2.0","error":{"code":-32600,"message":"empty batch"},"id":null}`,
+		},
+		{
+			name:     "Batch too large",
+			body:     `[1, 2, 3, 4]`,
+			wantCode: safehttp.StatusOK,
+			wantBody: `{"jsonrpc":"2.0","error":{"code":-32600,"message":"batch larger than 3 calls"},"id":null}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, body := serve(t, tt.body)
+			if code != int(tt.wantCode) {
+				t.Errorf("status code: got %d, want %d", code, tt.wantCode)
+			}
+			if body != tt.wantBody {
+				t.Errorf("body: got %s, want %s", body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestServerNotJSON(t *testing.T) {
+	mux := safehttp.NewServeMuxConfig(nil).Mux()
+	mux.Handle("/rpc", safehttp.MethodPost, newServer())
+
+	req := httptest.NewRequest(safehttp.MethodPost, "/rpc", strings.NewReader("{}"))
+	req.Header.Set("Content-Type", "text/plain")
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	if want := int(safehttp.StatusUnsupportedMediaType); rr.Code != want {
+		t.Errorf("status code: got %d, want %d", rr.Code, want)
+	}
+}
+
+func TestServerBodyTooLarge(t *testing.T) {
+	mux := safehttp.NewServeMuxConfig(nil).Mux()
+	mux.Handle("/rpc", safehttp.MethodPost, newServer())
+
+	body := `{"jsonrpc":"2.0","method":"echo","params":"` + strings.Repeat("a", 1<<20) + `","id":1}`
+	req := httptest.NewRequest(safehttp.MethodPost, "/rpc", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	if want := int(safehttp.StatusRequestEntityTooLarge); rr.Code != want {
+		t.Errorf("status code: got %d, want %d", rr.Code, want)
+	}
+}
+
+func TestRegisterTwice(t *testing.T) {
+	s := newServer()
+	defer func() {
+		if r := recover(); r == nil {
+			t.Error(`s.Register("add") twice expected panic`)
+		}
+	}()
+	s.Register("add", nil)
+}
@@ -0,0 +1,298 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package killswitch allows disabling interceptors at runtime, e.g. when a
+// protection breaks production traffic during an incident, without a code
+// change and a redeploy.
+//
+// Disabling an interceptor requires a reason and an expiry, after which it's
+// enforced again, and every change is recorded in an audit trail.
+//
+// # Usage
+//
+// Wrap the interceptors that may need to be disabled:
+//
+//	ks := killswitch.New(killswitch.Options{Audit: auditLog})
+//	cfg.Intercept(ks.Wrap("fetchmetadata", &fetchmetadata.Interceptor{}))
+//
+// From an admin endpoint, protected accordingly:
+//
+//	err := ks.Disable("fetchmetadata", "/api/", "b/1234: breaks the mobile app", time.Hour)
+package killswitch
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-safeweb/safehttp"
+)
+
+// DefaultMaxDuration is the longest an interceptor can be disabled for when
+// Options.MaxDuration is zero.
+const DefaultMaxDuration = 24 * time.Hour
+
+// Action is the kind of an audit Event.
+type Action string
+
+const (
+	// Disabled is recorded when an interceptor is disabled.
+	Disabled Action = "disabled"
+	// Enabled is recorded when an interceptor is enabled again by Enable.
+	Enabled Action = "enabled"
+	// Expired is recorded when an interceptor is enforced again because its
+	// kill switch expired.
+	Expired Action = "expired"
+)
+
+// Event is an entry of the audit trail.
+type Event struct {
+	Time   time.Time
+	Action Action
+	// Name is the name the interceptor was wrapped with.
+	Name string
+	// Scope is the pattern prefix of the routes affected, matched on path
+	// segment boundaries, e.g. the prefix of a RouteGroup, or an empty string
+	// for all routes.
+	Scope string
+	// Reason is the justification given for the change.
+	Reason string
+	// Expires is the time the interceptor is enforced again.
+	Expires time.Time
+}
+
+// String formats the event for logs.
+func (e Event) String() string {
+	scope := e.Scope
+	if scope == "" {
+		scope = "all routes"
+	}
+	return fmt.Sprintf("%s: interceptor %q %s for %s (expires %s): %s",
+		e.Time.Format(time.RFC3339), e.Name, e.Action, scope, e.Expires.Format(time.RFC3339), e.Reason)
+}
+
+// Options configures a Switch.
+type Options struct {
+	// Clock is the source of time for expiries. If nil, the system clock is
+	// used.
+	Clock safehttp.Clock
+	// Audit is called for every Event. If nil, events are logged.
+	Audit func(Event)
+	// MaxDuration is the longest an interceptor can be disabled for. If zero,
+	// DefaultMaxDuration is used.
+	MaxDuration time.Duration
+}
+
+// Switch tracks which interceptors are disabled. It's safe for concurrent
+// use.
+type Switch struct {
+	opts Options
+
+	mu       sync.Mutex
+	disabled map[killKey]Event
+}
+
+type killKey struct {
+	name, scope string
+}
+
+// New creates a Switch.
+func New(opts Options) *Switch {
+	if opts.Clock == nil {
+		opts.Clock = safehttp.SystemClock()
+	}
+	if opts.Audit == nil {
+		opts.Audit = func(e Event) { log.Printf("killswitch: %v", e) }
+	}
+	if opts.MaxDuration <= 0 {
+		opts.MaxDuration = DefaultMaxDuration
+	}
+	return &Switch{opts: opts, disabled: map[killKey]Event{}}
+}
+
+// Disable disables the interceptor wrapped with name, for the routes whose
+// pattern is scope or starts with scope followed by a "/", or all routes if
+// scope is empty, for the given duration. A reason is mandatory and the duration can't exceed the maximum
+// configured.
+//
+// Disabling an interceptor that is already disabled for the scope replaces
+// the previous reason and expiry.
+func (s *Switch) Disable(name, scope, reason string, d time.Duration) error {
+	if strings.TrimSpace(reason) == "" {
+		return errors.New("killswitch: a reason is required")
+	}
+	if d <= 0 || d > s.opts.MaxDuration {
+		return fmt.Errorf("killswitch: duration %v not in (0, %v]", d, s.opts.MaxDuration)
+	}
+	now := s.opts.Clock.Now()
+	e := Event{Time: now, Action: Disabled, Name: name, Scope: scope, Reason: reason, Expires: now.Add(d)}
+	s.mu.Lock()
+	s.disabled[killKey{name, scope}] = e
+	s.mu.Unlock()
+	s.opts.Audit(e)
+	return nil
+}
+
+// Enable enforces again the interceptor wrapped with name for scope, before
+// its kill switch expires. A reason is mandatory.
+func (s *Switch) Enable(name, scope, reason string) error {
+	if strings.TrimSpace(reason) == "" {
+		return errors.New("killswitch: a reason is required")
+	}
+	s.mu.Lock()
+	prev, ok := s.disabled[killKey{name, scope}]
+	delete(s.disabled, killKey{name, scope})
+	s.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("killswitch: interceptor %q is not disabled for %q", name, scope)
+	}
+	s.opts.Audit(Event{Time: s.opts.Clock.Now(), Action: Enabled, Name: name, Scope: scope, Reason: reason, Expires: prev.Expires})
+	return nil
+}
+
+// Active returns the kill switches currently in effect, as the events that
+// disabled the interceptors, sorted by name and scope.
+func (s *Switch) Active() []Event {
+	now := s.opts.Clock.Now()
+	s.mu.Lock()
+	expired := s.expireLocked(now)
+	var active []Event
+	for _, e := range s.disabled {
+		active = append(active, e)
+	}
+	s.mu.Unlock()
+	s.audit(expired)
+	sort.Slice(active, func(i, j int) bool {
+		if active[i].Name != active[j].Name {
+			return active[i].Name < active[j].Name
+		}
+		return active[i].Scope < active[j].Scope
+	})
+	return active
+}
+
+// isDisabled reports whether the interceptor wrapped with name is disabled
+// for pattern.
+func (s *Switch) isDisabled(name, pattern string) bool {
+	now := s.opts.Clock.Now()
+	s.mu.Lock()
+	var expired []Event
+	if len(s.disabled) > 0 {
+		expired = s.expireLocked(now)
+	}
+	disabled := false
+	for k := range s.disabled {
+		if k.name == name && inScope(pattern, k.scope) {
+			disabled = true
+			break
+		}
+	}
+	s.mu.Unlock()
+	s.audit(expired)
+	return disabled
+}
+
+// inScope reports whether pattern is scope or below it, on a path segment
+// boundary: "/api" contains "/api" and "/api/items", but not "/apix".
+func inScope(pattern, scope string) bool {
+	if scope == "" || pattern == scope {
+		return true
+	}
+	if !strings.HasSuffix(scope, "/") {
+		scope += "/"
+	}
+	return strings.HasPrefix(pattern, scope)
+}
+
+// expireLocked removes the expired kill switches, returning the events to
+// audit. s.mu must be held.
+func (s *Switch) expireLocked(now time.Time) []Event {
+	var expired []Event
+	for k, e := range s.disabled {
+		if !now.Before(e.Expires) {
+			delete(s.disabled, k)
+			expired = append(expired, Event{Time: now, Action: Expired, Name: e.Name, Scope: e.Scope, Reason: e.Reason, Expires: e.Expires})
+		}
+	}
+	return expired
+}
+
+func (s *Switch) audit(events []Event) {
+	for _, e := range events {
+		s.opts.Audit(e)
+	}
+}
+
+// Wrap returns an interceptor running it unless it's disabled through the
+// Switch under name. If it's a safehttp.Finisher, the returned interceptor is
+// one too.
+func (s *Switch) Wrap(name string, it safehttp.Interceptor) safehttp.Interceptor {
+	i := interceptor{s: s, name: name, it: it, key: &skippedKey{}}
+	if f, ok := it.(safehttp.Finisher); ok {
+		return finisher{interceptor: i, f: f}
+	}
+	return i
+}
+
+type interceptor struct {
+	s    *Switch
+	name string
+	it   safehttp.Interceptor
+	// key identifies the interceptor in the flight values, as the wrapped
+	// interceptor might not be comparable.
+	key *skippedKey
+}
+
+type skippedKey struct {
+	_ byte
+}
+
+func (i interceptor) Before(w safehttp.ResponseWriter, r *safehttp.IncomingRequest, cfg safehttp.InterceptorConfig) safehttp.Result {
+	if i.s.isDisabled(i.name, r.Pattern()) {
+		// Commit must be skipped as well, as Before didn't run.
+		safehttp.FlightValues(r.Context()).Put(i.key, true)
+		return safehttp.NotWritten()
+	}
+	return i.it.Before(w, r, cfg)
+}
+
+func (i interceptor) Commit(w safehttp.ResponseHeadersWriter, r *safehttp.IncomingRequest, resp safehttp.Response, cfg safehttp.InterceptorConfig) {
+	if safehttp.FlightValues(r.Context()).Get(i.key) != nil {
+		return
+	}
+	i.it.Commit(w, r, resp, cfg)
+}
+
+func (i interceptor) Match(cfg safehttp.InterceptorConfig) bool {
+	return i.it.Match(cfg)
+}
+
+// finisher is an interceptor wrapping a safehttp.Finisher.
+type finisher struct {
+	interceptor
+	f safehttp.Finisher
+}
+
+// Finish is skipped, like Commit, if the interceptor was disabled when the
+// request reached it.
+func (i finisher) Finish(r *safehttp.IncomingRequest, s safehttp.ResponseSummary, cfg safehttp.InterceptorConfig) {
+	if safehttp.FlightValues(r.Context()).Get(i.key) != nil {
+		return
+	}
+	i.f.Finish(r, s, cfg)
+}
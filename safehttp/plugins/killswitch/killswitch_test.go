@@ -0,0 +1,186 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package killswitch_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-safeweb/safehttp"
+	"github.com/google/go-safeweb/safehttp/plugins/hostcheck"
+	"github.com/google/go-safeweb/safehttp/plugins/killswitch"
+	"github.com/google/go-safeweb/safehttp/safehttptest"
+)
+
+var start = time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+func newMux(ks *killswitch.Switch) *safehttp.ServeMux {
+	cfg := safehttp.NewServeMuxConfig(nil)
+	cfg.Intercept(ks.Wrap("hostcheck", hostcheck.New("foo.com")))
+	mux := cfg.Mux()
+	ok := safehttp.HandlerFunc(func(w safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+		return w.Write(safehttp.NoContentResponse{})
+	})
+	mux.Handle("/api/items", safehttp.MethodGet, ok)
+	mux.Handle("/admin", safehttp.MethodGet, ok)
+	mux.Handle("/apix", safehttp.MethodGet, ok)
+	return mux
+}
+
+func status(mux *safehttp.ServeMux, path string) int {
+	rw := httptest.NewRecorder()
+	mux.ServeHTTP(rw, httptest.NewRequest(safehttp.MethodGet, "http://evil.com"+path, nil))
+	return rw.Code
+}
+
+func TestScopeSegments(t *testing.T) {
+	ks := killswitch.New(killswitch.Options{Clock: safehttptest.NewFakeClock(start)})
+	mux := newMux(ks)
+	if err := ks.Disable("hostcheck", "/api", "incident 42", time.Hour); err != nil {
+		t.Fatalf("ks.Disable: %v", err)
+	}
+	tests := []struct {
+		path string
+		want int
+	}{
+		{path: "/api/items", want: http.StatusNoContent},
+		{path: "/apix", want: http.StatusNotFound},
+		{path: "/admin", want: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		if got := status(mux, tt.path); got != tt.want {
+			t.Errorf("status(%q): got %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestSwitch(t *testing.T) {
+	clock := safehttptest.NewFakeClock(start)
+	var events []killswitch.Event
+	ks := killswitch.New(killswitch.Options{Clock: clock, Audit: func(e killswitch.Event) { events = append(events, e) }})
+	mux := newMux(ks)
+
+	if got, want := status(mux, "/api/items"), http.StatusNotFound; got != want {
+		t.Errorf("enforced: got %v, want %v", got, want)
+	}
+
+	if err := ks.Disable("hostcheck", "/api/", "incident 42", time.Hour); err != nil {
+		t.Fatalf("ks.Disable: %v", err)
+	}
+	if got, want := status(mux, "/api/items"), http.StatusNoContent; got != want {
+		t.Errorf("disabled in scope: got %v, want %v", got, want)
+	}
+	if got, want := status(mux, "/admin"), http.StatusNotFound; got != want {
+		t.Errorf("disabled out of scope: got %v, want %v", got, want)
+	}
+	if got := ks.Active(); len(got) != 1 || got[0].Scope != "/api/" {
+		t.Errorf("ks.Active(): got %v, want the /api/ kill switch", got)
+	}
+
+	clock.Set(start.Add(time.Hour))
+	if got, want := status(mux, "/api/items"), http.StatusNotFound; got != want {
+		t.Errorf("expired: got %v, want %v", got, want)
+	}
+	if got := ks.Active(); len(got) != 0 {
+		t.Errorf("ks.Active() after expiry: got %v, want none", got)
+	}
+
+	if err := ks.Disable("hostcheck", "", "incident 43", time.Hour); err != nil {
+		t.Fatalf("ks.Disable: %v", err)
+	}
+	if got, want := status(mux, "/admin"), http.StatusNoContent; got != want {
+		t.Errorf("disabled globally: got %v, want %v", got, want)
+	}
+	if err := ks.Enable("hostcheck", "", "incident 43 mitigated"); err != nil {
+		t.Fatalf("ks.Enable: %v", err)
+	}
+	if got, want := status(mux, "/admin"), http.StatusNotFound; got != want {
+		t.Errorf("enabled: got %v, want %v", got, want)
+	}
+
+	var actions []string
+	for _, e := range events {
+		actions = append(actions, string(e.Action)+" "+e.Reason)
+	}
+	want := "disabled incident 42,expired incident 42,disabled incident 43,enabled incident 43 mitigated"
+	if got := strings.Join(actions, ","); got != want {
+		t.Errorf("audit trail: got %q, want %q", got, want)
+	}
+}
+
+func TestSwitchInvalid(t *testing.T) {
+	ks := killswitch.New(killswitch.Options{Audit: func(killswitch.Event) {}})
+	if err := ks.Disable("hostcheck", "", " ", time.Hour); err == nil {
+		t.Error("ks.Disable without reason: got nil, want error")
+	}
+	if err := ks.Disable("hostcheck", "", "reason", 0); err == nil {
+		t.Error("ks.Disable without expiry: got nil, want error")
+	}
+	if err := ks.Disable("hostcheck", "", "reason", 48*time.Hour); err == nil {
+		t.Error("ks.Disable for too long: got nil, want error")
+	}
+	if err := ks.Enable("hostcheck", "", "reason"); err == nil {
+		t.Error("ks.Enable when not disabled: got nil, want error")
+	}
+}
+
+type finisher struct {
+	finished *int
+}
+
+func (finisher) Before(safehttp.ResponseWriter, *safehttp.IncomingRequest, safehttp.InterceptorConfig) safehttp.Result {
+	return safehttp.NotWritten()
+}
+
+func (finisher) Commit(safehttp.ResponseHeadersWriter, *safehttp.IncomingRequest, safehttp.Response, safehttp.InterceptorConfig) {
+}
+
+func (finisher) Match(safehttp.InterceptorConfig) bool {
+	return false
+}
+
+func (f finisher) Finish(*safehttp.IncomingRequest, safehttp.ResponseSummary, safehttp.InterceptorConfig) {
+	*f.finished++
+}
+
+func TestSwitchFinisher(t *testing.T) {
+	ks := killswitch.New(killswitch.Options{Audit: func(killswitch.Event) {}})
+	if _, ok := ks.Wrap("hostcheck", hostcheck.New("foo.com")).(safehttp.Finisher); ok {
+		t.Error("ks.Wrap() of an Interceptor which isn't a Finisher is a Finisher")
+	}
+
+	var finished int
+	cfg := safehttp.NewServeMuxConfig(nil)
+	cfg.Intercept(ks.Wrap("finisher", finisher{finished: &finished}))
+	mux := cfg.Mux()
+	mux.Handle("/", safehttp.MethodGet, safehttp.HandlerFunc(func(w safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+		return w.Write(safehttp.NoContentResponse{})
+	}))
+
+	status(mux, "/")
+	if finished != 1 {
+		t.Errorf("enforced: got %d Finish calls, want 1", finished)
+	}
+	if err := ks.Disable("finisher", "", "incident 44", time.Hour); err != nil {
+		t.Fatalf("ks.Disable: %v", err)
+	}
+	status(mux, "/")
+	if finished != 1 {
+		t.Errorf("disabled: got %d Finish calls, want 1", finished)
+	}
+}
@@ -0,0 +1,154 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package longpoll provides a handler for long-polling endpoints.
+//
+// Clients poll the endpoint with the resume token returned by their previous
+// poll in the "after" query parameter. The request is held until new events
+// are published, the maximum wait expires or the client goes away, and the
+// events published after the resume token are returned as JSON.
+package longpoll
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/go-safeweb/safehttp"
+)
+
+// Event is a notification published to long-polling clients.
+type Event struct {
+	// ID identifies the event. It's also the resume token to obtain the events
+	// published after this one.
+	ID string `json:"id"`
+	// Data is the payload of the event. It is serialized as JSON.
+	Data interface{} `json:"data"`
+}
+
+// Response is the body of the responses to long-polling requests.
+type Response struct {
+	// Events lists the events published after the resume token, oldest first.
+	// It's empty if the maximum wait expired.
+	Events []Event `json:"events"`
+	// Next is the resume token to send with the next poll.
+	Next string `json:"next"`
+	// Missed reports whether some of the events published after the resume
+	// token were no longer retained and are missing from Events.
+	Missed bool `json:"missed,omitempty"`
+}
+
+// Broker publishes events to long-polling clients, retaining the most recent
+// ones so that clients can resume after a missed poll. It is safe for
+// concurrent use.
+type Broker struct {
+	mu      sync.Mutex
+	history int
+	// events holds the retained events, the last one having sequence number
+	// seq.
+	events []Event
+	seq    uint64
+	// notify is closed, and replaced, whenever an event is published.
+	notify chan struct{}
+}
+
+// NewBroker creates a Broker retaining the last history events.
+func NewBroker(history int) *Broker {
+	if history < 1 {
+		panic("longpoll: history must be positive")
+	}
+	return &Broker{history: history, notify: make(chan struct{})}
+}
+
+// Publish publishes an event with the given data and wakes up all the waiting
+// clients.
+func (b *Broker) Publish(data interface{}) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.seq++
+	b.events = append(b.events, Event{ID: strconv.FormatUint(b.seq, 10), Data: data})
+	if len(b.events) > b.history {
+		b.events = b.events[len(b.events)-b.history:]
+	}
+	close(b.notify)
+	b.notify = make(chan struct{})
+}
+
+// since returns the events newer than after, whether some were missed and a
+// channel notifying about the next published event.
+func (b *Broker) since(after uint64) (events []Event, missed bool, next uint64, notify <-chan struct{}) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if after > b.seq {
+		// Resume tokens from the future, e.g. issued before a restart, are
+		// treated as if everything was missed.
+		after = 0
+	}
+	n := int(b.seq - after)
+	if n > len(b.events) {
+		missed = after < b.seq-uint64(len(b.events))
+		n = len(b.events)
+	}
+	events = append([]Event(nil), b.events[len(b.events)-n:]...)
+	return events, missed, b.seq, b.notify
+}
+
+// Handler returns a safehttp.Handler serving long-polling requests, holding
+// them for at most maxWait when there are no new events.
+//
+// Requests without a resume token only receive the events published after
+// they arrived. Resume tokens which are not valid result in a 400 Bad Request.
+func (b *Broker) Handler(maxWait time.Duration) safehttp.Handler {
+	return safehttp.HandlerFunc(func(w safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+		q, err := r.URL().Query()
+		if err != nil {
+			return w.WriteError(safehttp.StatusBadRequest)
+		}
+
+		var after uint64
+		if tok := q.String("after", ""); tok != "" {
+			after, err = strconv.ParseUint(tok, 10, 64)
+			if err != nil {
+				return w.WriteError(safehttp.StatusBadRequest)
+			}
+		} else {
+			_, _, after, _ = b.since(0)
+		}
+
+		timer := time.NewTimer(maxWait)
+		defer timer.Stop()
+		for {
+			events, missed, next, notify := b.since(after)
+			if len(events) > 0 || missed {
+				return w.Write(safehttp.JSONResponse{Data: Response{
+					Events: events,
+					Next:   strconv.FormatUint(next, 10),
+					Missed: missed,
+				}})
+			}
+
+			select {
+			case <-notify:
+			case <-timer.C:
+				return w.Write(safehttp.JSONResponse{Data: Response{
+					Events: []Event{},
+					Next:   strconv.FormatUint(next, 10),
+				}})
+			case <-r.Context().Done():
+				// The client is gone, nobody will read the response.
+				return w.Write(safehttp.NoContentResponse{})
+			}
+		}
+	})
+}
@@ -0,0 +1,128 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package longpoll_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-safeweb/safehttp"
+	"github.com/google/go-safeweb/safehttp/plugins/longpoll"
+)
+
+func poll(ctx context.Context, t *testing.T, b *longpoll.Broker, target string, maxWait time.Duration) (int, longpoll.Response) {
+	t.Helper()
+	mux := safehttp.NewServeMuxConfig(nil).Mux()
+	mux.Handle("/poll", safehttp.MethodGet, b.Handler(maxWait))
+
+	req := httptest.NewRequest(safehttp.MethodGet, target, nil).WithContext(ctx)
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+
+	var resp longpoll.Response
+	if rr.Code == int(safehttp.StatusOK) {
+		body := strings.TrimPrefix(rr.Body.String(), ")]}',\n")
+		if err := json.Unmarshal([]byte(body), &resp); err != nil {
+			t.Fatalf("json.Unmarshal(%q) got err: %v", body, err)
+		}
+	}
+	return rr.Code, resp
+}
+
+func TestRetainedEvents(t *testing.T) {
+	b := longpoll.NewBroker(10)
+	b.Publish("a")
+	b.Publish("b")
+
+	_, got := poll(context.Background(), t, b, "/poll?after=1", time.Second)
+	want := longpoll.Response{
+		Events: []longpoll.Event{{ID: "2", Data: "b"}},
+		Next:   "2",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("response mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestWaitForEvent(t *testing.T) {
+	b := longpoll.NewBroker(10)
+	b.Publish("old")
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		b.Publish("new")
+	}()
+	// Without a resume token, only events published later are returned.
+	_, got := poll(context.Background(), t, b, "/poll", time.Minute)
+	want := longpoll.Response{
+		Events: []longpoll.Event{{ID: "2", Data: "new"}},
+		Next:   "2",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("response mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestMaxWait(t *testing.T) {
+	b := longpoll.NewBroker(10)
+	b.Publish("a")
+
+	code, got := poll(context.Background(), t, b, "/poll?after=1", time.Millisecond)
+	if code != int(safehttp.StatusOK) {
+		t.Fatalf("status code: got %d, want %d", code, safehttp.StatusOK)
+	}
+	want := longpoll.Response{Events: []longpoll.Event{}, Next: "1"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("response mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestMissedEvents(t *testing.T) {
+	b := longpoll.NewBroker(2)
+	b.Publish("a")
+	b.Publish("b")
+	b.Publish("c")
+
+	_, got := poll(context.Background(), t, b, "/poll?after=0", time.Second)
+	want := longpoll.Response{
+		Events: []longpoll.Event{{ID: "2", Data: "b"}, {ID: "3", Data: "c"}},
+		Next:   "3",
+		Missed: true,
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("response mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestInvalidResumeToken(t *testing.T) {
+	b := longpoll.NewBroker(2)
+	if code, _ := poll(context.Background(), t, b, "/poll?after=abc", time.Second); code != int(safehttp.StatusBadRequest) {
+		t.Errorf("status code: got %d, want %d", code, safehttp.StatusBadRequest)
+	}
+}
+
+func TestClientGone(t *testing.T) {
+	b := longpoll.NewBroker(2)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if code, _ := poll(ctx, t, b, "/poll", time.Minute); code != int(safehttp.StatusNoContent) {
+		t.Errorf("status code: got %d, want %d", code, safehttp.StatusNoContent)
+	}
+}
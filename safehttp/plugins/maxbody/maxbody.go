@@ -0,0 +1,117 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package maxbody limits the size of request bodies.
+//
+// Requests declaring a Content-Length larger than the limit are rejected with
+// 413 Request Entity Too Large before the handler runs. Other bodies, e.g.
+// chunked ones, are cut at the limit: reading past it fails with an error
+// wrapping safehttp.ErrBodyTooLarge, which handlers should report as a 413.
+package maxbody
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/google/go-safeweb/safehttp"
+)
+
+var _ safehttp.Interceptor = Interceptor{}
+
+// DefaultMaxBytes is the limit used by Default.
+const DefaultMaxBytes = 1 << 20
+
+// Interceptor limits the size of request bodies. The limit can be overridden
+// for specific handlers, e.g. upload endpoints, using an Overrider.
+type Interceptor struct {
+	// MaxBytes is the maximum number of bytes of a request body. If negative,
+	// bodies aren't limited.
+	MaxBytes int64
+}
+
+// Default returns an Interceptor limiting bodies to DefaultMaxBytes.
+func Default() Interceptor {
+	return Interceptor{MaxBytes: DefaultMaxBytes}
+}
+
+// Before rejects the requests whose Content-Length exceeds the limit and
+// limits the body of the other ones.
+func (it Interceptor) Before(w safehttp.ResponseWriter, r *safehttp.IncomingRequest, cfg safehttp.InterceptorConfig) safehttp.Result {
+	if cfg != nil {
+		// We got an override, run its Before phase instead.
+		return Interceptor(cfg.(Overrider)).Before(w, r, nil)
+	}
+	if it.MaxBytes < 0 {
+		return safehttp.NotWritten()
+	}
+	if r.ContentLength() > it.MaxBytes {
+		return w.WriteError(safehttp.StatusRequestEntityTooLarge)
+	}
+	if body := r.Body(); body != nil && body != http.NoBody {
+		r.SetBody(&limitedBody{rc: body, max: it.MaxBytes, left: it.MaxBytes})
+	}
+	return safehttp.NotWritten()
+}
+
+// Commit is a no-op, required to satisfy the safehttp.Interceptor interface.
+func (it Interceptor) Commit(w safehttp.ResponseHeadersWriter, r *safehttp.IncomingRequest, resp safehttp.Response, cfg safehttp.InterceptorConfig) {
+}
+
+// Match recognizes Overriders as maxbody configurations.
+func (it Interceptor) Match(cfg safehttp.InterceptorConfig) bool {
+	_, ok := cfg.(Overrider)
+	return ok
+}
+
+// Overrider is a safehttp.InterceptorConfig that allows to override the body
+// size limit for a specific handler.
+type Overrider Interceptor
+
+// Override creates an Overrider with the given limit, e.g. a larger one for an
+// upload endpoint. A negative maxBytes disables the limit.
+func Override(reason string, maxBytes int64) Overrider {
+	return Overrider{MaxBytes: maxBytes}
+}
+
+// limitedBody fails reads past the limit.
+type limitedBody struct {
+	rc   io.ReadCloser
+	max  int64
+	left int64
+	err  error
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.err != nil {
+		return 0, b.err
+	}
+	// Read one more byte than allowed to tell a body of exactly the maximum
+	// size from a longer one.
+	if int64(len(p)) > b.left+1 {
+		p = p[:b.left+1]
+	}
+	n, err := b.rc.Read(p)
+	if int64(n) > b.left {
+		n = int(b.left)
+		b.err = fmt.Errorf("%w: more than %d bytes", safehttp.ErrBodyTooLarge, b.max)
+		err = b.err
+	}
+	b.left -= int64(n)
+	return n, err
+}
+
+func (b *limitedBody) Close() error {
+	return b.rc.Close()
+}
@@ -0,0 +1,115 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package maxbody_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-safeweb/safehttp"
+	"github.com/google/go-safeweb/safehttp/plugins/maxbody"
+)
+
+func TestMaxBody(t *testing.T) {
+	tests := []struct {
+		name      string
+		cfgs      []safehttp.InterceptorConfig
+		body      string
+		chunked   bool
+		wantCode  int
+		wantRead  string
+		wantError bool
+	}{
+		{
+			name:     "Within limit",
+			body:     "0123456789",
+			wantCode: http.StatusNoContent,
+			wantRead: "0123456789",
+		},
+		{
+			name:     "Content-Length too large",
+			body:     "0123456789a",
+			wantCode: http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:     "Chunked within limit",
+			body:     "0123456789",
+			chunked:  true,
+			wantCode: http.StatusNoContent,
+			wantRead: "0123456789",
+		},
+		{
+			name:      "Chunked too large",
+			body:      "0123456789a",
+			chunked:   true,
+			wantCode:  http.StatusRequestEntityTooLarge,
+			wantRead:  "0123456789",
+			wantError: true,
+		},
+		{
+			name:     "Override",
+			cfgs:     []safehttp.InterceptorConfig{maxbody.Override("uploads", 20)},
+			body:     "0123456789a",
+			wantCode: http.StatusNoContent,
+			wantRead: "0123456789a",
+		},
+		{
+			name:     "Override unlimited",
+			cfgs:     []safehttp.InterceptorConfig{maxbody.Override("uploads", -1)},
+			body:     strings.Repeat("a", 100),
+			chunked:  true,
+			wantCode: http.StatusNoContent,
+			wantRead: strings.Repeat("a", 100),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mb := safehttp.NewServeMuxConfig(nil)
+			mb.Intercept(maxbody.Interceptor{MaxBytes: 10})
+			mux := mb.Mux()
+			var read string
+			var readErr error
+			mux.Handle("/", safehttp.MethodPost, safehttp.HandlerFunc(func(w safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+				b, err := ioutil.ReadAll(r.Body())
+				read, readErr = string(b), err
+				if errors.Is(err, safehttp.ErrBodyTooLarge) {
+					return w.WriteError(safehttp.StatusRequestEntityTooLarge)
+				}
+				return w.Write(safehttp.NoContentResponse{})
+			}), tt.cfgs...)
+
+			req := httptest.NewRequest(safehttp.MethodPost, "/", strings.NewReader(tt.body))
+			if tt.chunked {
+				req.ContentLength = -1
+			}
+			rw := httptest.NewRecorder()
+			mux.ServeHTTP(rw, req)
+
+			if rw.Code != tt.wantCode {
+				t.Errorf("rw.Code: got %v, want %v", rw.Code, tt.wantCode)
+			}
+			if read != tt.wantRead {
+				t.Errorf("read body: got %q, want %q", read, tt.wantRead)
+			}
+			if got := readErr != nil; got != tt.wantError {
+				t.Errorf("read error: got %v, want error %v", readErr, tt.wantError)
+			}
+		})
+	}
+}
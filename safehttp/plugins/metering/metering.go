@@ -0,0 +1,178 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package metering lets handlers report the cost of requests, e.g. the rows
+// they scanned or the bytes they sent, aggregated per identity for
+// usage-based billing.
+//
+// # Usage
+//
+// Install an Interceptor using safehttp.ServeMuxConfig.Intercept with the
+// Sinks receiving the costs, and report them from handlers with AddCost:
+//
+//	agg := metering.NewAggregator()
+//	cfg.Intercept(metering.Interceptor{
+//		Identify: func(r *safehttp.IncomingRequest) string { return r.Header.Get("X-Api-Key") },
+//		Sinks:    []metering.Sink{agg, metering.QuotaSink{Tracker: tr, Dimension: "rows", Quota: rowsQuota}},
+//	})
+//
+//	// In a handler:
+//	metering.AddCost(r.Context(), "rows", int64(len(rows)))
+package metering
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+
+	"github.com/google/go-safeweb/safehttp"
+	"github.com/google/go-safeweb/safehttp/plugins/quota"
+)
+
+// Cost is the cost of a request, by dimension, e.g. "rows" or "egress_bytes".
+type Cost map[string]int64
+
+// Sink receives the costs of requests.
+type Sink interface {
+	// Record records the cost of a request made by the identity id.
+	Record(ctx context.Context, id string, c Cost) error
+}
+
+type costKey struct{}
+
+// AddCost adds n to the given dimension of the cost of the request. It returns
+// an error if the Interceptor is not installed.
+func AddCost(ctx context.Context, dimension string, n int64) error {
+	c, ok := safehttp.FlightValues(ctx).Get(costKey{}).(Cost)
+	if !ok {
+		return errors.New("metering: Interceptor not installed")
+	}
+	c[dimension] += n
+	return nil
+}
+
+// Interceptor collects the costs reported by handlers and records them in the
+// Sinks once the response is written.
+type Interceptor struct {
+	// Identify returns the identity the cost of the request is billed to.
+	// Requests with an empty identity are not metered.
+	Identify func(r *safehttp.IncomingRequest) string
+	// Sinks receive the costs of the requests. Errors are logged, as the
+	// request has already been served.
+	Sinks []Sink
+}
+
+var _ safehttp.Interceptor = Interceptor{}
+
+// Before sets up the collection of the costs of the request.
+func (it Interceptor) Before(w safehttp.ResponseWriter, r *safehttp.IncomingRequest, _ safehttp.InterceptorConfig) safehttp.Result {
+	safehttp.FlightValues(r.Context()).Put(costKey{}, Cost{})
+	return safehttp.NotWritten()
+}
+
+// Commit records the costs reported for the request in the Sinks.
+func (it Interceptor) Commit(w safehttp.ResponseHeadersWriter, r *safehttp.IncomingRequest, resp safehttp.Response, _ safehttp.InterceptorConfig) {
+	c, ok := safehttp.FlightValues(r.Context()).Get(costKey{}).(Cost)
+	if !ok || len(c) == 0 {
+		return
+	}
+	id := it.Identify(r)
+	if id == "" {
+		return
+	}
+	for _, s := range it.Sinks {
+		if err := s.Record(r.Context(), id, c); err != nil {
+			log.Printf("metering: recording cost %v of %q: %v", c, id, err)
+		}
+	}
+}
+
+// Match returns false since there are no supported configurations.
+func (Interceptor) Match(safehttp.InterceptorConfig) bool {
+	return false
+}
+
+// Aggregator is a Sink summing the costs per identity in memory. It's safe for
+// concurrent use.
+type Aggregator struct {
+	mu     sync.Mutex
+	totals map[string]Cost
+}
+
+var _ Sink = (*Aggregator)(nil)
+
+// NewAggregator creates an empty Aggregator.
+func NewAggregator() *Aggregator {
+	return &Aggregator{totals: map[string]Cost{}}
+}
+
+// Record adds c to the total of id.
+func (a *Aggregator) Record(_ context.Context, id string, c Cost) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	t, ok := a.totals[id]
+	if !ok {
+		t = Cost{}
+		a.totals[id] = t
+	}
+	for dim, n := range c {
+		t[dim] += n
+	}
+	return nil
+}
+
+// Total returns the total cost recorded for id.
+func (a *Aggregator) Total(id string) Cost {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	t := Cost{}
+	for dim, n := range a.totals[id] {
+		t[dim] = n
+	}
+	return t
+}
+
+// Reset returns the totals of all identities and resets them, e.g. to export
+// them periodically to a billing system.
+func (a *Aggregator) Reset() map[string]Cost {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	totals := a.totals
+	a.totals = map[string]Cost{}
+	return totals
+}
+
+// QuotaSink is a Sink consuming a dimension of the costs from quotas, so that
+// e.g. the rows scanned by an API key are limited per day.
+type QuotaSink struct {
+	// Tracker tracks the usage of the quotas.
+	Tracker *quota.Tracker
+	// Dimension is the dimension of the costs consumed from the quotas.
+	Dimension string
+	// Quota returns the quota of an identity.
+	Quota func(id string) quota.Quota
+}
+
+var _ Sink = QuotaSink{}
+
+// Record consumes the Dimension of c from the quota of id.
+func (s QuotaSink) Record(ctx context.Context, id string, c Cost) error {
+	n, ok := c[s.Dimension]
+	if !ok {
+		return nil
+	}
+	_, err := s.Tracker.Consume(ctx, id, s.Quota(id), n)
+	return err
+}
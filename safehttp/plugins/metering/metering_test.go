@@ -0,0 +1,85 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metering_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-safeweb/safehttp"
+	"github.com/google/go-safeweb/safehttp/plugins/metering"
+	"github.com/google/go-safeweb/safehttp/plugins/quota"
+)
+
+func TestInterceptor(t *testing.T) {
+	agg := metering.NewAggregator()
+	tr := quota.NewTracker(quota.NewMemoryStore(nil), nil)
+	rowsQuota := func(string) quota.Quota { return quota.Quota{Limit: 100, Period: quota.Daily} }
+
+	mc := safehttp.NewServeMuxConfig(nil)
+	mc.Intercept(metering.Interceptor{
+		Identify: func(r *safehttp.IncomingRequest) string { return r.Header.Get("X-Api-Key") },
+		Sinks:    []metering.Sink{agg, metering.QuotaSink{Tracker: tr, Dimension: "rows", Quota: rowsQuota}},
+	})
+	mux := mc.Mux()
+	mux.Handle("/", safehttp.MethodGet, safehttp.HandlerFunc(func(w safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+		metering.AddCost(r.Context(), "rows", 30)
+		metering.AddCost(r.Context(), "rows", 5)
+		metering.AddCost(r.Context(), "egress_bytes", 512)
+		return w.Write(safehttp.NoContentResponse{})
+	}))
+
+	for _, key := range []string{"alice", "alice", "bob", ""} {
+		req := httptest.NewRequest(http.MethodGet, "https://foo.com/", nil)
+		req.Header.Set("X-Api-Key", key)
+		mux.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	if diff := cmp.Diff(metering.Cost{"rows": 70, "egress_bytes": 1024}, agg.Total("alice")); diff != "" {
+		t.Errorf(`agg.Total("alice") mismatch (-want +got):\n%s`, diff)
+	}
+	u, err := tr.Usage(context.Background(), "alice", rowsQuota("alice"))
+	if err != nil {
+		t.Fatalf("tr.Usage() got err: %v", err)
+	}
+	if got, want := u.Used, int64(70); got != want {
+		t.Errorf("used rows quota: got %d, want %d", got, want)
+	}
+
+	want := map[string]metering.Cost{
+		"alice": {"rows": 70, "egress_bytes": 1024},
+		"bob":   {"rows": 35, "egress_bytes": 512},
+	}
+	if diff := cmp.Diff(want, agg.Reset()); diff != "" {
+		t.Errorf("agg.Reset() mismatch (-want +got):\n%s", diff)
+	}
+	if got := agg.Total("alice"); len(got) != 0 {
+		t.Errorf(`agg.Total("alice") after reset: got %v, want empty`, got)
+	}
+}
+
+func TestAddCostWithoutInterceptor(t *testing.T) {
+	mux := safehttp.NewServeMuxConfig(nil).Mux()
+	mux.Handle("/", safehttp.MethodGet, safehttp.HandlerFunc(func(w safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+		if err := metering.AddCost(r.Context(), "rows", 1); err == nil {
+			t.Error("metering.AddCost() got nil err, want error")
+		}
+		return w.Write(safehttp.NoContentResponse{})
+	}))
+	mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "https://foo.com/", nil))
+}
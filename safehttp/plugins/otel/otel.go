@@ -0,0 +1,330 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package otel traces the requests served by a safehttp.ServeMux and records
+// their rate, errors and duration (RED metrics), following the OpenTelemetry
+// semantic conventions for HTTP servers.
+//
+// The package doesn't depend on an OpenTelemetry SDK: finished spans and
+// request measurements are passed to callbacks, which can forward them to any
+// exporter. The W3C Trace Context of incoming requests is honored, and
+// Inject propagates it to outgoing ones.
+//
+// # Usage
+//
+//	t := &otel.Tracer{
+//		ExportSpan: func(s otel.SpanData) { /* forward to an exporter */ },
+//		Record:     func(m otel.Request) { /* update counters and histograms */ },
+//	}
+//	cfg := safehttp.NewServeMuxConfig(nil)
+//	cfg.Intercept(t.Interceptor())
+//	mux := cfg.Mux()
+//	// Register handlers on mux, then:
+//	http.ListenAndServe(addr, t.Handler(mux))
+//
+// Like with accesslog, the Handler measures the whole request and records the
+// status code, and the Interceptor adds the route pattern, which is only
+// known inside the ServeMux.
+package otel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/go-safeweb/safehttp"
+	"github.com/google/go-safeweb/safehttp/plugins/internal/responserecorder"
+	"github.com/google/go-safeweb/safehttp/random"
+)
+
+// The attributes set on server spans, as named by the OpenTelemetry semantic
+// conventions.
+const (
+	AttrMethod     = "http.request.method"
+	AttrRoute      = "http.route"
+	AttrStatusCode = "http.response.status_code"
+	AttrPath       = "url.path"
+	AttrScheme     = "url.scheme"
+	AttrHost       = "server.address"
+	AttrClientIP   = "client.address"
+	AttrUserAgent  = "user_agent.original"
+	AttrErrorType  = "error.type"
+)
+
+// SpanData is a finished span.
+type SpanData struct {
+	// Name is the method followed by the route pattern, e.g. "GET /users/{id}",
+	// or just the method if no route matched.
+	Name string
+	// SpanContext identifies the span.
+	SpanContext SpanContext
+	// Parent is the span context propagated by the caller, if any.
+	Parent SpanContext
+	Start  time.Time
+	End    time.Time
+	// Attributes holds the attributes of the span, see the Attr constants.
+	Attributes map[string]interface{}
+	// Error describes why the request failed, if it did. Following the
+	// semantic conventions, only 5xx responses mark server spans as failed.
+	Error string
+}
+
+// Span is the span of a request being served.
+type Span struct {
+	mu   sync.Mutex
+	data SpanData
+	// recording is false for spans which are not sampled.
+	recording bool
+}
+
+// SpanContext returns the span context of the span, to be propagated to
+// outgoing requests using Inject.
+func (s *Span) SpanContext() SpanContext {
+	return s.data.SpanContext
+}
+
+// IsRecording reports whether the span will be exported.
+func (s *Span) IsRecording() bool {
+	return s.recording
+}
+
+// SetAttribute sets an attribute of the span.
+func (s *Span) SetAttribute(key string, value interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Attributes[key] = value
+}
+
+// RecordError marks the span as failed.
+func (s *Span) RecordError(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Error = err.Error()
+}
+
+type spanCtxKey struct{}
+
+// SpanFromContext returns the span of the request the context belongs to, or
+// nil if the request isn't traced.
+func SpanFromContext(ctx context.Context) *Span {
+	s, _ := ctx.Value(spanCtxKey{}).(*Span)
+	return s
+}
+
+// Request is the measurement of a served request, from which the RED
+// metrics are computed.
+type Request struct {
+	Method string
+	// Route is the pattern of the route that served the request, or empty if
+	// no route matched. Unlike the path, it has a bounded cardinality and can
+	// be used as a metric label.
+	Route    string
+	Status   int
+	Duration time.Duration
+}
+
+// Tracer traces the requests served by its Handler.
+type Tracer struct {
+	// ExportSpan receives the finished spans which are sampled. If nil, spans
+	// are not exported.
+	ExportSpan func(SpanData)
+	// Record receives the measurement of every request. If nil, no metrics
+	// are recorded.
+	Record func(Request)
+	// Sample decides whether requests without a propagated trace context are
+	// sampled. If nil, all of them are. Requests with a propagated trace
+	// context follow the decision of the caller.
+	Sample func(*http.Request) bool
+	// IgnoreRemote makes the tracer start a new trace for every request,
+	// ignoring the propagated trace context, e.g. for services exposed to
+	// untrusted clients.
+	IgnoreRemote bool
+	// Clock is used to timestamp spans. If nil, safehttp.SystemClock is used.
+	Clock safehttp.Clock
+}
+
+// Handler wraps h, which should be a safehttp.ServeMux with the Interceptor
+// of the Tracer installed, and starts a span for each request.
+func (t *Tracer) Handler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		clock := t.Clock
+		if clock == nil {
+			clock = safehttp.SystemClock()
+		}
+		s, err := t.start(req, clock.Now())
+		if err != nil {
+			// Without IDs there is nothing to trace, but the request can
+			// still be served.
+			h.ServeHTTP(rw, req)
+			return
+		}
+		rw, rec := responserecorder.New(rw)
+		defer func() {
+			t.end(s, rec.Status(), clock.Now())
+		}()
+		h.ServeHTTP(rw, req.WithContext(context.WithValue(req.Context(), spanCtxKey{}, s)))
+	})
+}
+
+// Interceptor returns the interceptor naming spans after the route pattern
+// and recording error responses. It has no effect on requests that weren't
+// received through the Handler of the Tracer.
+func (t *Tracer) Interceptor() Interceptor {
+	return Interceptor{}
+}
+
+func (t *Tracer) start(req *http.Request, now time.Time) (*Span, error) {
+	var parent SpanContext
+	if !t.IgnoreRemote {
+		parent, _ = Extract(req.Header)
+	}
+	sc := parent
+	sc.Remote = false
+	if !parent.IsValid() {
+		sc = SpanContext{}
+		if t.Sample == nil || t.Sample(req) {
+			sc.Flags = FlagsSampled
+		}
+		if err := randomID(sc.TraceID[:]); err != nil {
+			return nil, err
+		}
+	}
+	if err := randomID(sc.SpanID[:]); err != nil {
+		return nil, err
+	}
+	scheme := "http"
+	if req.TLS != nil {
+		scheme = "https"
+	}
+	return &Span{
+		data: SpanData{
+			Name:        req.Method,
+			SpanContext: sc,
+			Parent:      parent,
+			Start:       now,
+			Attributes: map[string]interface{}{
+				AttrMethod:    req.Method,
+				AttrPath:      req.URL.Path,
+				AttrScheme:    scheme,
+				AttrHost:      req.Host,
+				AttrClientIP:  remoteIP(req.RemoteAddr),
+				AttrUserAgent: req.UserAgent(),
+			},
+		},
+		recording: sc.IsSampled(),
+	}, nil
+}
+
+func (t *Tracer) end(s *Span, status int, now time.Time) {
+	s.mu.Lock()
+	s.data.End = now
+	s.data.Attributes[AttrStatusCode] = status
+	if _, ok := s.data.Attributes[AttrErrorType]; !ok {
+		switch {
+		case status >= 500:
+			s.data.Attributes[AttrErrorType] = fmt.Sprint(status)
+		case s.data.Error != "":
+			// The fallback value of the semantic conventions.
+			s.data.Attributes[AttrErrorType] = "_OTHER"
+		}
+	}
+	if status >= 500 && s.data.Error == "" {
+		s.data.Error = http.StatusText(status)
+	}
+	data := s.data
+	route, _ := data.Attributes[AttrRoute].(string)
+	s.mu.Unlock()
+
+	if t.Record != nil {
+		t.Record(Request{
+			Method:   data.Attributes[AttrMethod].(string),
+			Route:    route,
+			Status:   status,
+			Duration: data.End.Sub(data.Start),
+		})
+	}
+	if t.ExportSpan != nil && s.recording {
+		t.ExportSpan(data)
+	}
+}
+
+func randomID(b []byte) error {
+	for {
+		r, err := random.Bytes(len(b))
+		if err != nil {
+			return err
+		}
+		copy(b, r)
+		for _, c := range b {
+			if c != 0 {
+				return nil
+			}
+		}
+		// All-zero IDs are invalid, which is astronomically unlikely.
+	}
+}
+
+func remoteIP(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return host
+}
+
+// Interceptor names the spans of the Tracer it was obtained from after the
+// route pattern, and records error responses on them.
+type Interceptor struct{}
+
+var _ safehttp.Interceptor = Interceptor{}
+
+// Before names the span of the request after the matched route and sets the
+// client IP resolved by the ServeMux.
+func (Interceptor) Before(w safehttp.ResponseWriter, r *safehttp.IncomingRequest, _ safehttp.InterceptorConfig) safehttp.Result {
+	s := SpanFromContext(r.Context())
+	if s == nil {
+		return safehttp.NotWritten()
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if p := r.Pattern(); p != "" {
+		s.data.Name = r.Method() + " " + p
+		s.data.Attributes[AttrRoute] = p
+	}
+	if ip := r.ClientIP(); ip != nil {
+		s.data.Attributes[AttrClientIP] = ip.String()
+	}
+	return safehttp.NotWritten()
+}
+
+// Commit records server errors written by handlers or interceptors on the
+// span of the request.
+func (Interceptor) Commit(w safehttp.ResponseHeadersWriter, r *safehttp.IncomingRequest, resp safehttp.Response, _ safehttp.InterceptorConfig) {
+	er, ok := resp.(safehttp.ErrorResponse)
+	if !ok || er.Code() < 500 {
+		return
+	}
+	if s := SpanFromContext(r.Context()); s != nil {
+		s.RecordError(errors.New(er.Code().String()))
+	}
+}
+
+// Match returns false since there are no supported configurations.
+func (Interceptor) Match(safehttp.InterceptorConfig) bool {
+	return false
+}
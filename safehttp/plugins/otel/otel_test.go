@@ -0,0 +1,224 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package otel_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-safeweb/safehttp"
+	"github.com/google/go-safeweb/safehttp/plugins/otel"
+	"github.com/google/go-safeweb/safehttp/safehttptest"
+)
+
+var start = time.Date(2021, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+type recorded struct {
+	spans    []otel.SpanData
+	requests []otel.Request
+}
+
+func newServer(tr *otel.Tracer, clock *safehttptest.FakeClock) http.Handler {
+	cfg := safehttp.NewServeMuxConfig(nil)
+	cfg.Intercept(tr.Interceptor())
+	mux := cfg.Mux()
+	mux.Handle("/users/{id}", safehttp.MethodGet, safehttp.HandlerFunc(func(w safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+		clock.Advance(10 * time.Millisecond)
+		s := otel.SpanFromContext(r.Context())
+		s.SetAttribute("app.user", r.PathValue("id"))
+		// Outgoing requests carry the span context of the request.
+		out := http.Header{}
+		otel.Inject(out, s.SpanContext())
+		return w.Write(safehttp.JSONResponse{Data: out.Get("Traceparent")})
+	}))
+	mux.Handle("/fail", safehttp.MethodGet, safehttp.HandlerFunc(func(w safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+		return w.WriteError(safehttp.StatusServiceUnavailable)
+	}))
+	mux.Handle("/forbidden", safehttp.MethodGet, safehttp.HandlerFunc(func(w safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+		return w.WriteError(safehttp.StatusForbidden)
+	}))
+	return tr.Handler(mux)
+}
+
+func newTracer(rec *recorded, clock safehttp.Clock) *otel.Tracer {
+	return &otel.Tracer{
+		ExportSpan: func(s otel.SpanData) { rec.spans = append(rec.spans, s) },
+		Record:     func(r otel.Request) { rec.requests = append(rec.requests, r) },
+		Clock:      clock,
+	}
+}
+
+func TestSpan(t *testing.T) {
+	clock := safehttptest.NewFakeClock(start)
+	var rec recorded
+	h := newServer(newTracer(&rec, clock), clock)
+
+	req := httptest.NewRequest(safehttp.MethodGet, "https://example.com/users/42", nil)
+	req.RemoteAddr = "192.0.2.1:1234"
+	req.Header.Set("User-Agent", "test-agent")
+	req.Header.Set("Traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	req.Header.Set("Tracestate", "congo=t61rcWkgMzE")
+	rw := httptest.NewRecorder()
+	h.ServeHTTP(rw, req)
+
+	if len(rec.spans) != 1 {
+		t.Fatalf("got %d spans, want 1", len(rec.spans))
+	}
+	s := rec.spans[0]
+	if got, want := s.Name, "GET /users/{id}"; got != want {
+		t.Errorf("Name: got %q, want %q", got, want)
+	}
+	if got, want := s.SpanContext.TraceID, s.Parent.TraceID; got != want {
+		t.Errorf("TraceID: got %v, want the one of the parent %v", got, want)
+	}
+	if s.SpanContext.SpanID == s.Parent.SpanID || !s.SpanContext.SpanID.IsValid() {
+		t.Errorf("SpanID: got %v, want a new valid ID", s.SpanContext.SpanID)
+	}
+	if got, want := s.SpanContext.TraceState, "congo=t61rcWkgMzE"; got != want {
+		t.Errorf("TraceState: got %q, want %q", got, want)
+	}
+	if !s.Parent.Remote || s.SpanContext.Remote {
+		t.Errorf("Remote: got parent %v, span %v, want true, false", s.Parent.Remote, s.SpanContext.Remote)
+	}
+	if got, want := s.End.Sub(s.Start), 10*time.Millisecond; got != want {
+		t.Errorf("duration: got %v, want %v", got, want)
+	}
+	if s.Error != "" {
+		t.Errorf("Error: got %q, want none", s.Error)
+	}
+	wantAttrs := map[string]interface{}{
+		otel.AttrMethod:     "GET",
+		otel.AttrRoute:      "/users/{id}",
+		otel.AttrStatusCode: 200,
+		otel.AttrPath:       "/users/42",
+		otel.AttrScheme:     "https",
+		otel.AttrHost:       "example.com",
+		otel.AttrClientIP:   "192.0.2.1",
+		otel.AttrUserAgent:  "test-agent",
+		"app.user":          "42",
+	}
+	if diff := cmp.Diff(wantAttrs, s.Attributes); diff != "" {
+		t.Errorf("Attributes mismatch (-want +got):\n%s", diff)
+	}
+	if body, want := rw.Body.String(), s.SpanContext.Traceparent(); !strings.Contains(body, want) {
+		t.Errorf("propagated traceparent: got body %q, want it to contain %q", body, want)
+	}
+
+	wantReqs := []otel.Request{{Method: "GET", Route: "/users/{id}", Status: 200, Duration: 10 * time.Millisecond}}
+	if diff := cmp.Diff(wantReqs, rec.requests); diff != "" {
+		t.Errorf("requests mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	clock := safehttptest.NewFakeClock(start)
+	var rec recorded
+	h := newServer(newTracer(&rec, clock), clock)
+
+	for _, path := range []string{"/fail", "/forbidden", "/nowhere"} {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(safehttp.MethodGet, "https://example.com"+path, nil))
+	}
+
+	if len(rec.spans) != 3 {
+		t.Fatalf("got %d spans, want 3", len(rec.spans))
+	}
+	if s := rec.spans[0]; s.Error != "Service Unavailable" || s.Attributes[otel.AttrErrorType] != "503" {
+		t.Errorf("5xx span: got error %q and error type %v, want Service Unavailable and 503", s.Error, s.Attributes[otel.AttrErrorType])
+	}
+	// Client errors don't mark server spans as failed.
+	if s := rec.spans[1]; s.Error != "" || s.Attributes[otel.AttrErrorType] != nil {
+		t.Errorf("4xx span: got error %q and error type %v, want none", s.Error, s.Attributes[otel.AttrErrorType])
+	}
+	if s := rec.spans[2]; s.Name != "GET" || s.Attributes[otel.AttrRoute] != nil || s.Attributes[otel.AttrStatusCode] != 404 {
+		t.Errorf("unmatched span: got name %q and attributes %v, want GET, no route and status 404", s.Name, s.Attributes)
+	}
+
+	wantReqs := []otel.Request{
+		{Method: "GET", Route: "/fail", Status: 503},
+		{Method: "GET", Route: "/forbidden", Status: 403},
+		{Method: "GET", Status: 404},
+	}
+	if diff := cmp.Diff(wantReqs, rec.requests); diff != "" {
+		t.Errorf("requests mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestSampling(t *testing.T) {
+	clock := safehttptest.NewFakeClock(start)
+	var rec recorded
+	tr := newTracer(&rec, clock)
+	tr.Sample = func(*http.Request) bool { return false }
+	h := newServer(tr, clock)
+
+	// Not sampled by the tracer.
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(safehttp.MethodGet, "https://example.com/users/1", nil))
+	// Sampled by the caller.
+	req := httptest.NewRequest(safehttp.MethodGet, "https://example.com/users/2", nil)
+	req.Header.Set("Traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	// Not sampled by the caller.
+	req = httptest.NewRequest(safehttp.MethodGet, "https://example.com/users/3", nil)
+	req.Header.Set("Traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	if len(rec.spans) != 1 || rec.spans[0].Attributes["app.user"] != "2" {
+		t.Errorf("got spans %+v, want only the one of user 2", rec.spans)
+	}
+	if len(rec.requests) != 3 {
+		t.Errorf("got %d requests, want metrics for all 3", len(rec.requests))
+	}
+}
+
+func TestIgnoreRemote(t *testing.T) {
+	clock := safehttptest.NewFakeClock(start)
+	var rec recorded
+	tr := newTracer(&rec, clock)
+	tr.IgnoreRemote = true
+	h := newServer(tr, clock)
+
+	req := httptest.NewRequest(safehttp.MethodGet, "https://example.com/users/1", nil)
+	req.Header.Set("Traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	if len(rec.spans) != 1 {
+		t.Fatalf("got %d spans, want 1", len(rec.spans))
+	}
+	if s := rec.spans[0]; s.Parent.IsValid() || s.SpanContext.TraceID.String() == "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("got span context %+v with parent %+v, want a new trace", s.SpanContext, s.Parent)
+	}
+}
+
+func TestInterceptorWithoutHandler(t *testing.T) {
+	var tr otel.Tracer
+	cfg := safehttp.NewServeMuxConfig(nil)
+	cfg.Intercept(tr.Interceptor())
+	mux := cfg.Mux()
+	mux.Handle("/", safehttp.MethodGet, safehttp.HandlerFunc(func(w safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+		if s := otel.SpanFromContext(r.Context()); s != nil {
+			t.Errorf("SpanFromContext: got %v, want nil", s)
+		}
+		return w.WriteError(safehttp.StatusInternalServerError)
+	}))
+
+	rw := httptest.NewRecorder()
+	mux.ServeHTTP(rw, httptest.NewRequest(safehttp.MethodGet, "https://example.com/", nil))
+	if rw.Code != http.StatusInternalServerError {
+		t.Errorf("status: got %d, want %d", rw.Code, http.StatusInternalServerError)
+	}
+}
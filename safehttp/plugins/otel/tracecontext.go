@@ -0,0 +1,171 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package otel
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// The headers of the W3C Trace Context propagation format, as specified by
+// https://www.w3.org/TR/trace-context/.
+const (
+	TraceparentHeader = "Traceparent"
+	TracestateHeader  = "Tracestate"
+)
+
+// TraceID identifies a trace.
+type TraceID [16]byte
+
+// String returns the lowercase hex encoding of the ID.
+func (id TraceID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+// IsValid reports whether the ID is not all zeroes.
+func (id TraceID) IsValid() bool {
+	return id != TraceID{}
+}
+
+// SpanID identifies a span within a trace.
+type SpanID [8]byte
+
+// String returns the lowercase hex encoding of the ID.
+func (id SpanID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+// IsValid reports whether the ID is not all zeroes.
+func (id SpanID) IsValid() bool {
+	return id != SpanID{}
+}
+
+// FlagsSampled is the trace flag recording that the caller may have recorded
+// the trace.
+const FlagsSampled = 0x01
+
+// SpanContext is the part of a span which is propagated across services.
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	// Flags are the trace flags, e.g. FlagsSampled.
+	Flags byte
+	// TraceState carries vendor-specific trace data. It is propagated
+	// unchanged.
+	TraceState string
+	// Remote reports whether the span context was received from another
+	// service.
+	Remote bool
+}
+
+// IsValid reports whether both the trace and the span IDs are valid.
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID.IsValid() && sc.SpanID.IsValid()
+}
+
+// IsSampled reports whether the sampled flag is set.
+func (sc SpanContext) IsSampled() bool {
+	return sc.Flags&FlagsSampled != 0
+}
+
+// Traceparent returns the value of the traceparent header for sc.
+func (sc SpanContext) Traceparent() string {
+	return fmt.Sprintf("00-%s-%s-%02x", sc.TraceID, sc.SpanID, sc.Flags)
+}
+
+// ParseTraceparent parses the value of a traceparent header. Versions other
+// than 00 are parsed as version 00, as required by the specification, but
+// the invalid version ff is rejected.
+func ParseTraceparent(v string) (SpanContext, error) {
+	v = strings.TrimSpace(v)
+	// version "-" trace-id "-" parent-id "-" trace-flags
+	if len(v) < 55 || v[2] != '-' || v[35] != '-' || v[52] != '-' {
+		return SpanContext{}, fmt.Errorf("malformed traceparent %q", v)
+	}
+	version, err := decodeHex(v[0:2])
+	if err != nil || version[0] == 0xff {
+		return SpanContext{}, fmt.Errorf("invalid traceparent version %q", v[0:2])
+	}
+	if version[0] == 0 && len(v) != 55 {
+		return SpanContext{}, fmt.Errorf("malformed traceparent %q", v)
+	}
+	if len(v) > 55 && v[55] != '-' {
+		// Future versions can only append fields.
+		return SpanContext{}, fmt.Errorf("malformed traceparent %q", v)
+	}
+	var sc SpanContext
+	tid, err := decodeHex(v[3:35])
+	if err != nil {
+		return SpanContext{}, fmt.Errorf("invalid trace ID: %v", err)
+	}
+	copy(sc.TraceID[:], tid)
+	sid, err := decodeHex(v[36:52])
+	if err != nil {
+		return SpanContext{}, fmt.Errorf("invalid parent ID: %v", err)
+	}
+	copy(sc.SpanID[:], sid)
+	flags, err := decodeHex(v[53:55])
+	if err != nil {
+		return SpanContext{}, fmt.Errorf("invalid trace flags: %v", err)
+	}
+	sc.Flags = flags[0]
+	if !sc.IsValid() {
+		return SpanContext{}, errors.New("all-zero trace or parent ID")
+	}
+	return sc, nil
+}
+
+// decodeHex decodes lowercase hex only, as uppercase digits are not allowed
+// in the traceparent header.
+func decodeHex(s string) ([]byte, error) {
+	if strings.ToLower(s) != s {
+		return nil, fmt.Errorf("uppercase hex in %q", s)
+	}
+	return hex.DecodeString(s)
+}
+
+// Extract returns the span context propagated in the headers, if a valid one
+// is present.
+func Extract(h http.Header) (SpanContext, bool) {
+	vs := h.Values(TraceparentHeader)
+	if len(vs) != 1 {
+		// Multiple traceparent headers are invalid.
+		return SpanContext{}, false
+	}
+	sc, err := ParseTraceparent(vs[0])
+	if err != nil {
+		return SpanContext{}, false
+	}
+	sc.Remote = true
+	sc.TraceState = strings.Join(h.Values(TracestateHeader), ",")
+	return sc, true
+}
+
+// Inject sets the headers propagating sc, e.g. on an outgoing request. It does
+// nothing if sc is not valid.
+func Inject(h http.Header, sc SpanContext) {
+	if !sc.IsValid() {
+		return
+	}
+	h.Set(TraceparentHeader, sc.Traceparent())
+	if sc.TraceState != "" {
+		h.Set(TracestateHeader, sc.TraceState)
+	} else {
+		h.Del(TracestateHeader)
+	}
+}
@@ -0,0 +1,111 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package otel_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/google/go-safeweb/safehttp/plugins/otel"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	sc, err := otel.ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	if err != nil {
+		t.Fatalf("ParseTraceparent: %v", err)
+	}
+	if got, want := sc.TraceID.String(), "4bf92f3577b34da6a3ce929d0e0e4736"; got != want {
+		t.Errorf("TraceID: got %q, want %q", got, want)
+	}
+	if got, want := sc.SpanID.String(), "00f067aa0ba902b7"; got != want {
+		t.Errorf("SpanID: got %q, want %q", got, want)
+	}
+	if !sc.IsSampled() {
+		t.Error("IsSampled: got false, want true")
+	}
+	if got, want := sc.Traceparent(), "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"; got != want {
+		t.Errorf("Traceparent: got %q, want %q", got, want)
+	}
+}
+
+func TestParseTraceparentFutureVersion(t *testing.T) {
+	sc, err := otel.ParseTraceparent("cc-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00-extra")
+	if err != nil {
+		t.Fatalf("ParseTraceparent: %v", err)
+	}
+	if sc.IsSampled() {
+		t.Error("IsSampled: got true, want false")
+	}
+}
+
+func TestParseTraceparentInvalid(t *testing.T) {
+	tests := []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e473z-00f067aa0ba902b7-01",
+		"00_4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"cc-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01extra",
+	}
+	for _, v := range tests {
+		if sc, err := otel.ParseTraceparent(v); err == nil {
+			t.Errorf("ParseTraceparent(%q): got %+v, want error", v, sc)
+		}
+	}
+}
+
+func TestExtractInject(t *testing.T) {
+	in := http.Header{}
+	in.Set("Traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	in.Add("Tracestate", "congo=t61rcWkgMzE")
+	in.Add("Tracestate", "rojo=00f067aa0ba902b7")
+	sc, ok := otel.Extract(in)
+	if !ok {
+		t.Fatal("Extract: got false, want true")
+	}
+	if !sc.Remote {
+		t.Error("Remote: got false, want true")
+	}
+
+	out := http.Header{}
+	otel.Inject(out, sc)
+	if got, want := out.Get("Traceparent"), in.Get("Traceparent"); got != want {
+		t.Errorf("traceparent: got %q, want %q", got, want)
+	}
+	if got, want := out.Get("Tracestate"), "congo=t61rcWkgMzE,rojo=00f067aa0ba902b7"; got != want {
+		t.Errorf("tracestate: got %q, want %q", got, want)
+	}
+}
+
+func TestExtractMultipleTraceparents(t *testing.T) {
+	h := http.Header{}
+	h.Add("Traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	h.Add("Traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b8-01")
+	if sc, ok := otel.Extract(h); ok {
+		t.Errorf("Extract: got %+v, want false", sc)
+	}
+}
+
+func TestInjectInvalid(t *testing.T) {
+	h := http.Header{}
+	otel.Inject(h, otel.SpanContext{})
+	if len(h) != 0 {
+		t.Errorf("Inject(invalid): got headers %v, want none", h)
+	}
+}
@@ -0,0 +1,124 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package outbox ties the publication of domain events to the outcome of the
+// response.
+//
+// Handlers wrapped with Handler enqueue events using Enqueue. The events are
+// only handed to the Publisher after the handler wrote a successful response,
+// and are dropped if it wrote an error response or panicked. This prevents
+// e.g. sending a notification email for an operation that failed.
+package outbox
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"github.com/google/go-safeweb/safehttp"
+)
+
+// Event is a domain event.
+type Event struct {
+	// Type identifies the kind of the event, e.g. "order.created".
+	Type string
+	// Data is the payload of the event.
+	Data interface{}
+}
+
+// Publisher publishes events, e.g. to a message broker.
+type Publisher interface {
+	// Publish publishes the events enqueued while handling a request, in
+	// order.
+	Publish(ctx context.Context, events []Event) error
+}
+
+type outboxKey struct{}
+
+type outbox struct {
+	events []Event
+}
+
+// Enqueue enqueues an event to be published once the response to the request
+// is successfully written. It returns an error if the handler serving the
+// request wasn't wrapped with Handler.
+func Enqueue(ctx context.Context, e Event) error {
+	o, ok := safehttp.FlightValues(ctx).Get(outboxKey{}).(*outbox)
+	if !ok {
+		return errors.New("outbox: handler not wrapped with outbox.Handler")
+	}
+	o.events = append(o.events, e)
+	return nil
+}
+
+// Handler wraps h so that the events it enqueues are published with p after it
+// returns, if it wrote a response other than an error response. Errors
+// returned by the Publisher are logged, as the response has already been
+// sent.
+//
+// The ResponseWriter passed to h is wrapped, so h can't be a handler requiring
+// the ResponseWriter of the framework, such as the one returned by
+// safehttp.FileServer.
+func Handler(p Publisher, h safehttp.Handler) safehttp.Handler {
+	return safehttp.HandlerFunc(func(w safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+		o := &outbox{}
+		safehttp.FlightValues(r.Context()).Put(outboxKey{}, o)
+
+		rw := &responseWriter{ResponseWriter: w}
+		res := h.ServeHTTP(rw, r)
+		if rw.state != succeeded || len(o.events) == 0 {
+			return res
+		}
+		if err := p.Publish(r.Context(), o.events); err != nil {
+			log.Printf("outbox: publishing %d events for %s %q: %v", len(o.events), r.Method(), r.URL().Path(), err)
+		}
+		return res
+	})
+}
+
+type writeState int
+
+const (
+	notWritten writeState = iota
+	succeeded
+	failed
+)
+
+// responseWriter records the outcome of the first write.
+type responseWriter struct {
+	safehttp.ResponseWriter
+	state writeState
+}
+
+func (w *responseWriter) Write(resp safehttp.Response) safehttp.Result {
+	res := w.ResponseWriter.Write(resp)
+	s := succeeded
+	if _, ok := resp.(safehttp.ErrorResponse); ok {
+		s = failed
+	}
+	w.record(res, s)
+	return res
+}
+
+func (w *responseWriter) WriteError(resp safehttp.ErrorResponse) safehttp.Result {
+	res := w.ResponseWriter.WriteError(resp)
+	w.record(res, failed)
+	return res
+}
+
+func (w *responseWriter) record(res safehttp.Result, s writeState) {
+	if w.state == notWritten && res.Err() == nil {
+		w.state = s
+	}
+}
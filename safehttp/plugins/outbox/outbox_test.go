@@ -0,0 +1,138 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package outbox_test
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-safeweb/safehttp"
+	"github.com/google/go-safeweb/safehttp/plugins/outbox"
+	"github.com/google/go-safeweb/safehttp/safehttptest"
+	"github.com/google/safehtml"
+)
+
+type fakePublisher struct {
+	published []outbox.Event
+	err       error
+}
+
+func (p *fakePublisher) Publish(_ context.Context, events []outbox.Event) error {
+	p.published = append(p.published, events...)
+	return p.err
+}
+
+// serve serves a request with h and returns the status code, or 0 if h
+// panicked.
+func serve(t *testing.T, p outbox.Publisher, h safehttp.HandlerFunc) (code int) {
+	t.Helper()
+	mux := safehttp.NewServeMuxConfig(nil).Mux()
+	mux.Handle("/", safehttp.MethodPost, outbox.Handler(p, h))
+
+	rr := httptest.NewRecorder()
+	defer func() {
+		if r := recover(); r != nil {
+			code = 0
+		}
+	}()
+	mux.ServeHTTP(rr, httptest.NewRequest(safehttp.MethodPost, "/", nil))
+	return rr.Code
+}
+
+func enqueue(t *testing.T, r *safehttp.IncomingRequest, types ...string) {
+	t.Helper()
+	for _, typ := range types {
+		if err := outbox.Enqueue(r.Context(), outbox.Event{Type: typ}); err != nil {
+			t.Fatalf("outbox.Enqueue() got err: %v", err)
+		}
+	}
+}
+
+func TestPublishedAfterSuccess(t *testing.T) {
+	p := &fakePublisher{}
+	var publishedBeforeWrite int
+	serve(t, p, func(w safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+		enqueue(t, r, "a", "b")
+		publishedBeforeWrite = len(p.published)
+		return w.Write(safehtml.HTMLEscaped("ok"))
+	})
+
+	if publishedBeforeWrite != 0 {
+		t.Errorf("%d events published before the response was written, want 0", publishedBeforeWrite)
+	}
+	want := []outbox.Event{{Type: "a"}, {Type: "b"}}
+	if diff := cmp.Diff(want, p.published); diff != "" {
+		t.Errorf("published events mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestDroppedOnError(t *testing.T) {
+	tests := []struct {
+		name string
+		h    safehttp.HandlerFunc
+	}{
+		{
+			name: "Error response",
+			h: func(w safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+				enqueue(t, r, "a")
+				return w.WriteError(safehttp.StatusInternalServerError)
+			},
+		},
+		{
+			name: "Panic",
+			h: func(w safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+				enqueue(t, r, "a")
+				panic("oops")
+			},
+		},
+		{
+			name: "Not written",
+			h: func(w safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+				enqueue(t, r, "a")
+				return safehttp.NotWritten()
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &fakePublisher{}
+			serve(t, p, tt.h)
+			if len(p.published) != 0 {
+				t.Errorf("published events: got %v, want none", p.published)
+			}
+		})
+	}
+}
+
+func TestPublishError(t *testing.T) {
+	p := &fakePublisher{err: errors.New("broker down")}
+	code := serve(t, p, func(w safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+		enqueue(t, r, "a")
+		return w.Write(safehtml.HTMLEscaped("ok"))
+	})
+	if code != int(safehttp.StatusOK) {
+		t.Errorf("status code: got %d, want %d", code, safehttp.StatusOK)
+	}
+}
+
+func TestEnqueueNotWrapped(t *testing.T) {
+	req := safehttptest.NewRequest(safehttp.MethodGet, "/", nil)
+	if err := outbox.Enqueue(req.Context(), outbox.Event{Type: "a"}); err == nil {
+		t.Error("outbox.Enqueue() got nil err, want error")
+	}
+}
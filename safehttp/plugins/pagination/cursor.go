@@ -0,0 +1,126 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pagination
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/google/go-safeweb/safehttp"
+	"github.com/google/go-safeweb/safehttp/random"
+)
+
+var (
+	// ErrInvalidCursor is returned when decoding a malformed or tampered with
+	// cursor.
+	ErrInvalidCursor = errors.New("invalid cursor")
+	// ErrExpiredCursor is returned when decoding a cursor older than the TTL
+	// of the CursorCodec.
+	ErrExpiredCursor = errors.New("expired cursor")
+)
+
+// CursorCodec encodes values, e.g. the sort key of the last item of a page,
+// into opaque cursors that clients can't read or tamper with, and decodes them
+// back.
+//
+// Cursors are encrypted and authenticated with AES-256-GCM, using a key
+// derived from Key, so they don't expose the offsets or IDs they hold.
+type CursorCodec struct {
+	// Key is the secret the encryption key is derived from. It should have
+	// high entropy and must be at least 32 bytes long.
+	Key []byte
+	// TTL is the maximum age of the cursors accepted by Decode. If zero,
+	// cursors don't expire.
+	TTL time.Duration
+	// Clock is used to timestamp cursors and check their age. If nil, the
+	// safehttp.SystemClock is used.
+	Clock safehttp.Clock
+}
+
+func (c CursorCodec) now() time.Time {
+	if c.Clock == nil {
+		return safehttp.SystemClock().Now()
+	}
+	return c.Clock.Now()
+}
+
+// aead returns the AES-GCM cipher keyed with a key derived from c.Key, so
+// that the secret isn't used as is for encryption.
+func (c CursorCodec) aead() cipher.AEAD {
+	if len(c.Key) < 32 {
+		panic("pagination: CursorCodec.Key must be at least 32 bytes long")
+	}
+	m := hmac.New(sha256.New, c.Key)
+	m.Write([]byte("go-safeweb pagination cursor"))
+	block, err := aes.NewCipher(m.Sum(nil))
+	if err != nil {
+		panic(err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		panic(err)
+	}
+	return aead
+}
+
+// Encode encodes v, marshalled as JSON, into a cursor.
+func (c CursorCodec) Encode(v interface{}) (string, error) {
+	aead := c.aead()
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	payload := make([]byte, 8, 8+len(b))
+	binary.BigEndian.PutUint64(payload, uint64(c.now().Unix()))
+	payload = append(payload, b...)
+
+	nonce, err := random.Bytes(aead.NonceSize())
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(aead.Seal(nonce, nonce, payload, nil)), nil
+}
+
+// Decode decrypts the cursor and unmarshals the value it holds into v. It
+// returns ErrInvalidCursor if the cursor was not produced by a CursorCodec
+// with the same Key, or ErrExpiredCursor if it's older than TTL.
+func (c CursorCodec) Decode(cursor string, v interface{}) error {
+	aead := c.aead()
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil || len(b) < aead.NonceSize() {
+		return ErrInvalidCursor
+	}
+	nonce, sealed := b[:aead.NonceSize()], b[aead.NonceSize():]
+	payload, err := aead.Open(nil, nonce, sealed, nil)
+	if err != nil || len(payload) < 8 {
+		return ErrInvalidCursor
+	}
+
+	issued := time.Unix(int64(binary.BigEndian.Uint64(payload)), 0)
+	if c.TTL != 0 && c.now().Sub(issued) > c.TTL {
+		return ErrExpiredCursor
+	}
+	if err := json.Unmarshal(payload[8:], v); err != nil {
+		return ErrInvalidCursor
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pagination
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/go-safeweb/safehttp/safehttptest"
+)
+
+type position struct {
+	LastID string
+	Offset int
+}
+
+var testKey = []byte("0123456789abcdef0123456789abcdef")
+
+func TestCursorRoundTrip(t *testing.T) {
+	c := CursorCodec{Key: testKey}
+	want := position{LastID: "item-42", Offset: 7}
+	cursor, err := c.Encode(want)
+	if err != nil {
+		t.Fatalf("c.Encode() got err: %v", err)
+	}
+	if b, err := base64.RawURLEncoding.DecodeString(cursor); err != nil || bytes.Contains(b, []byte("item-42")) {
+		t.Errorf("cursor %q exposes the raw ID", cursor)
+	}
+
+	var got position
+	if err := c.Decode(cursor, &got); err != nil {
+		t.Fatalf("c.Decode() got err: %v", err)
+	}
+	if got != want {
+		t.Errorf("c.Decode() = %+v, want %+v", got, want)
+	}
+}
+
+func TestCursorInvalid(t *testing.T) {
+	c := CursorCodec{Key: testKey}
+	cursor, err := c.Encode(position{LastID: "a"})
+	if err != nil {
+		t.Fatalf("c.Encode() got err: %v", err)
+	}
+	tampered := cursor[:20] + "A" + cursor[21:]
+	if cursor[20] == 'A' {
+		tampered = cursor[:20] + "B" + cursor[21:]
+	}
+	other := CursorCodec{Key: []byte("fedcba9876543210fedcba9876543210")}
+
+	tests := []struct {
+		name   string
+		codec  CursorCodec
+		cursor string
+	}{
+		{name: "Empty", codec: c, cursor: ""},
+		{name: "Truncated", codec: c, cursor: cursor[:10]},
+		{name: "Not base64", codec: c, cursor: cursor + "."},
+		{name: "Tampered", codec: c, cursor: tampered},
+		{name: "Different key", codec: other, cursor: cursor},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var p position
+			if err := tt.codec.Decode(tt.cursor, &p); !errors.Is(err, ErrInvalidCursor) {
+				t.Errorf("Decode() got err: %v, want %v", err, ErrInvalidCursor)
+			}
+		})
+	}
+}
+
+func TestCursorExpiry(t *testing.T) {
+	clock := safehttptest.NewFakeClock(time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC))
+	c := CursorCodec{Key: testKey, TTL: time.Hour, Clock: clock}
+	cursor, err := c.Encode(position{LastID: "a"})
+	if err != nil {
+		t.Fatalf("c.Encode() got err: %v", err)
+	}
+
+	var p position
+	clock.Advance(time.Hour)
+	if err := c.Decode(cursor, &p); err != nil {
+		t.Errorf("c.Decode() after TTL got err: %v", err)
+	}
+	clock.Advance(time.Second)
+	if err := c.Decode(cursor, &p); !errors.Is(err, ErrExpiredCursor) {
+		t.Errorf("c.Decode() past TTL got err: %v, want %v", err, ErrExpiredCursor)
+	}
+}
+
+func TestCursorShortKey(t *testing.T) {
+	defer func() {
+		if r := recover(); r == nil {
+			t.Error("Encode() with a short key expected panic")
+		}
+	}()
+	CursorCodec{Key: []byte("short")}.Encode(position{})
+}
@@ -0,0 +1,228 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package pagination provides helpers for list endpoints: parsing pagination,
+// sorting and filtering query parameters and linking to adjacent pages.
+//
+// The recognized query parameters are:
+//   - page and limit, for page based pagination, or cursor and limit for cursor
+//     based pagination
+//   - sort, a comma separated list of fields, each one optionally prefixed by
+//     "-" for a descending order, e.g. sort=name,-created
+//   - filter, which can be repeated, in the form field:operator:value, e.g.
+//     filter=status:eq:active
+//
+// Sort and filter fields are checked against allowlists.
+package pagination
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/google/go-safeweb/safehttp"
+)
+
+const (
+	defaultLimit = 20
+	maxLimit     = 100
+	maxInt       = int64(^uint(0) >> 1)
+)
+
+// Options configures the parsing of list parameters.
+type Options struct {
+	// DefaultLimit is the limit used when the request has none. If zero, 20 is
+	// used.
+	DefaultLimit int
+	// MaxLimit is the largest limit accepted. Larger limits are lowered to
+	// MaxLimit. If zero, 100 is used.
+	MaxLimit int
+	// SortFields lists the fields that results can be sorted on.
+	SortFields []string
+	// FilterFields lists the fields that results can be filtered on.
+	FilterFields []string
+}
+
+// Params are the parsed list parameters of a request.
+type Params struct {
+	// Page is the 1-based number of the requested page. It is 1 when Cursor is
+	// set.
+	Page int
+	// Limit is the maximum number of items to return.
+	Limit int
+	// Cursor is the opaque cursor of the requested page, if any.
+	Cursor string
+	// Sort lists the requested sort orders, by decreasing priority.
+	Sort []Sort
+	// Filters lists the requested filters.
+	Filters []Filter
+}
+
+// Offset returns the number of items preceding the requested page, for page
+// based pagination.
+func (p *Params) Offset() int {
+	return (p.Page - 1) * p.Limit
+}
+
+// Sort is a requested sort order.
+type Sort struct {
+	Field      string
+	Descending bool
+}
+
+// Operator is a comparison operator of a Filter.
+type Operator string
+
+// The supported operators.
+const (
+	Equal          Operator = "eq"
+	NotEqual       Operator = "ne"
+	Less           Operator = "lt"
+	LessOrEqual    Operator = "le"
+	Greater        Operator = "gt"
+	GreaterOrEqual Operator = "ge"
+)
+
+// Filter is a requested filter, selecting the items whose Field compares to
+// Value as specified by Op.
+type Filter struct {
+	Field string
+	Op    Operator
+	Value string
+}
+
+// Parse parses the list parameters of the request. The returned error
+// describes the first invalid parameter, and should usually result in a
+// 400 Bad Request response.
+func Parse(r *safehttp.IncomingRequest, opts Options) (*Params, error) {
+	q, err := r.URL().Query()
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.DefaultLimit == 0 {
+		opts.DefaultLimit = defaultLimit
+	}
+	if opts.MaxLimit == 0 {
+		opts.MaxLimit = maxLimit
+	}
+
+	page := q.Int64("page", 1)
+	limit := q.Int64("limit", int64(opts.DefaultLimit))
+	p := &Params{Cursor: q.String("cursor", "")}
+	// Form.Slice resets the error for missing parameters, so this has to be
+	// checked first.
+	if err := q.Err(); err != nil {
+		return nil, err
+	}
+	var sort, filters []string
+	q.Slice("sort", &sort)
+	q.Slice("filter", &filters)
+
+	if p.Cursor != "" && q.String("page", "") != "" {
+		return nil, errors.New("page and cursor can't be used together")
+	}
+	if limit < 1 {
+		return nil, fmt.Errorf("invalid limit %d", limit)
+	}
+	if limit > int64(opts.MaxLimit) {
+		limit = int64(opts.MaxLimit)
+	}
+	// The page is bounded so that the offsets of this page and the next one
+	// don't overflow.
+	if page < 1 || page >= maxInt/limit {
+		return nil, fmt.Errorf("invalid page %d", page)
+	}
+	p.Page, p.Limit = int(page), int(limit)
+
+	for _, s := range sort {
+		for _, f := range strings.Split(s, ",") {
+			desc := strings.HasPrefix(f, "-")
+			f = strings.TrimPrefix(f, "-")
+			if !contains(opts.SortFields, f) {
+				return nil, fmt.Errorf("can't sort on %q", f)
+			}
+			p.Sort = append(p.Sort, Sort{Field: f, Descending: desc})
+		}
+	}
+
+	for _, f := range filters {
+		parts := strings.SplitN(f, ":", 3)
+		if len(parts) != 3 {
+			return nil, fmt.Errorf("invalid filter %q, want field:operator:value", f)
+		}
+		if !contains(opts.FilterFields, parts[0]) {
+			return nil, fmt.Errorf("can't filter on %q", parts[0])
+		}
+		op := Operator(parts[1])
+		switch op {
+		case Equal, NotEqual, Less, LessOrEqual, Greater, GreaterOrEqual:
+		default:
+			return nil, fmt.Errorf("invalid filter operator %q", parts[1])
+		}
+		p.Filters = append(p.Filters, Filter{Field: parts[0], Op: op, Value: parts[2]})
+	}
+	return p, nil
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// SetPageLinks adds a Link header to the response, with the "prev" relation
+// pointing to the previous page unless p is the first one, and the "next"
+// relation pointing to the next page if hasNext is true. The links keep all the
+// other query parameters of the request.
+func SetPageLinks(w safehttp.ResponseHeadersWriter, r *safehttp.IncomingRequest, p *Params, hasNext bool) error {
+	u, err := url.Parse(r.URL().String())
+	if err != nil {
+		return err
+	}
+	if p.Page > 1 {
+		addLink(w, u, "prev", "page", strconv.Itoa(p.Page-1))
+	}
+	if hasNext {
+		addLink(w, u, "next", "page", strconv.Itoa(p.Page+1))
+	}
+	return nil
+}
+
+// SetCursorLink adds a Link header to the response, with the "next" relation
+// pointing to the page at the next cursor. No header is added if next is
+// empty. The link keeps all the other query parameters of the request.
+func SetCursorLink(w safehttp.ResponseHeadersWriter, r *safehttp.IncomingRequest, next string) error {
+	if next == "" {
+		return nil
+	}
+	u, err := url.Parse(r.URL().String())
+	if err != nil {
+		return err
+	}
+	addLink(w, u, "next", "cursor", next)
+	return nil
+}
+
+func addLink(w safehttp.ResponseHeadersWriter, u *url.URL, rel, param, value string) {
+	q := u.Query()
+	q.Set(param, value)
+	ref := url.URL{Path: u.Path, RawPath: u.RawPath, RawQuery: q.Encode()}
+	w.Header().Add("Link", fmt.Sprintf("<%s>; rel=%q", ref.String(), rel))
+}
@@ -0,0 +1,179 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pagination
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-safeweb/safehttp"
+	"github.com/google/go-safeweb/safehttp/safehttptest"
+)
+
+var opts = Options{
+	SortFields:   []string{"name", "created"},
+	FilterFields: []string{"status"},
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  *Params
+	}{
+		{
+			name:  "Defaults",
+			query: "",
+			want:  &Params{Page: 1, Limit: 20},
+		},
+		{
+			name:  "Page and limit",
+			query: "page=3&limit=10",
+			want:  &Params{Page: 3, Limit: 10},
+		},
+		{
+			name:  "Limit above maximum",
+			query: "limit=1000",
+			want:  &Params{Page: 1, Limit: 100},
+		},
+		{
+			name:  "Cursor",
+			query: "cursor=abc",
+			want:  &Params{Page: 1, Limit: 20, Cursor: "abc"},
+		},
+		{
+			name:  "Sort",
+			query: "sort=name,-created",
+			want: &Params{Page: 1, Limit: 20, Sort: []Sort{
+				{Field: "name"},
+				{Field: "created", Descending: true},
+			}},
+		},
+		{
+			name:  "Filters",
+			query: "filter=status:eq:active&filter=status:ne:a:b",
+			want: &Params{Page: 1, Limit: 20, Filters: []Filter{
+				{Field: "status", Op: Equal, Value: "active"},
+				{Field: "status", Op: NotEqual, Value: "a:b"},
+			}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := safehttptest.NewRequest(safehttp.MethodGet, "/items?"+tt.query, nil)
+			got, err := Parse(req, opts)
+			if err != nil {
+				t.Fatalf("Parse() got err: %v", err)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("Parse() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+	}{
+		{name: "Page not a number", query: "page=abc"},
+		{name: "Page zero", query: "page=0"},
+		{name: "Page overflowing the offset", query: "page=9223372036854775807&limit=10"},
+		{name: "Negative limit", query: "limit=-1"},
+		{name: "Page and cursor", query: "page=2&cursor=abc"},
+		{name: "Sort not allowed", query: "sort=password"},
+		{name: "Filter not allowed", query: "filter=password:eq:x"},
+		{name: "Filter missing value", query: "filter=status:eq"},
+		{name: "Filter invalid operator", query: "filter=status:like:x"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := safehttptest.NewRequest(safehttp.MethodGet, "/items?"+tt.query, nil)
+			if p, err := Parse(req, opts); err == nil {
+				t.Errorf("Parse() = %+v, want error", p)
+			}
+		})
+	}
+}
+
+func TestOffset(t *testing.T) {
+	p := &Params{Page: 3, Limit: 10}
+	if got, want := p.Offset(), 20; got != want {
+		t.Errorf("p.Offset() = %d, want %d", got, want)
+	}
+}
+
+func TestSetPageLinks(t *testing.T) {
+	tests := []struct {
+		name    string
+		page    int
+		hasNext bool
+		want    []string
+	}{
+		{
+			name:    "First page",
+			page:    1,
+			hasNext: true,
+			want:    []string{`</items?limit=10&page=2&sort=name>; rel="next"`},
+		},
+		{
+			name:    "Middle page",
+			page:    2,
+			hasNext: true,
+			want: []string{
+				`</items?limit=10&page=1&sort=name>; rel="prev"`,
+				`</items?limit=10&page=3&sort=name>; rel="next"`,
+			},
+		},
+		{
+			name: "Last page",
+			page: 2,
+			want: []string{`</items?limit=10&page=1&sort=name>; rel="prev"`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := safehttptest.NewRequest(safehttp.MethodGet, "/items?limit=10&sort=name", nil)
+			fakeRW, rr := safehttptest.NewFakeResponseWriter()
+			if err := SetPageLinks(fakeRW, req, &Params{Page: tt.page, Limit: 10}, tt.hasNext); err != nil {
+				t.Fatalf("SetPageLinks() got err: %v", err)
+			}
+			if diff := cmp.Diff(tt.want, rr.Header().Values("Link")); diff != "" {
+				t.Errorf("Link header mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestSetCursorLink(t *testing.T) {
+	req := safehttptest.NewRequest(safehttp.MethodGet, "/items?cursor=abc", nil)
+	fakeRW, rr := safehttptest.NewFakeResponseWriter()
+	if err := SetCursorLink(fakeRW, req, "def"); err != nil {
+		t.Fatalf("SetCursorLink() got err: %v", err)
+	}
+	want := []string{`</items?cursor=def>; rel="next"`}
+	if diff := cmp.Diff(want, rr.Header().Values("Link")); diff != "" {
+		t.Errorf("Link header mismatch (-want +got):\n%s", diff)
+	}
+
+	fakeRW, rr = safehttptest.NewFakeResponseWriter()
+	if err := SetCursorLink(fakeRW, req, ""); err != nil {
+		t.Fatalf("SetCursorLink() got err: %v", err)
+	}
+	if got := rr.Header().Values("Link"); len(got) != 0 {
+		t.Errorf("Link header: got %v, want none", got)
+	}
+}
@@ -0,0 +1,208 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package permissionspolicy provides a safehttp.Interceptor setting the
+// Permissions-Policy header, which controls the browser features a document,
+// and the frames it embeds, can use.
+//
+// Specification: https://w3c.github.io/webappsec-permissions-policy/
+package permissionspolicy
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/google/go-safeweb/safehttp"
+)
+
+var _ safehttp.Interceptor = Interceptor{}
+
+// Feature is a policy-controlled browser feature.
+type Feature string
+
+// Common policy-controlled features. See
+// https://github.com/w3c/webappsec-permissions-policy/blob/main/features.md
+// for the full list.
+const (
+	Accelerometer     Feature = "accelerometer"
+	Autoplay          Feature = "autoplay"
+	Camera            Feature = "camera"
+	ClipboardRead     Feature = "clipboard-read"
+	ClipboardWrite    Feature = "clipboard-write"
+	DisplayCapture    Feature = "display-capture"
+	EncryptedMedia    Feature = "encrypted-media"
+	Fullscreen        Feature = "fullscreen"
+	Geolocation       Feature = "geolocation"
+	Gyroscope         Feature = "gyroscope"
+	InterestCohort    Feature = "interest-cohort"
+	Magnetometer      Feature = "magnetometer"
+	Microphone        Feature = "microphone"
+	MIDI              Feature = "midi"
+	Payment           Feature = "payment"
+	PictureInPicture  Feature = "picture-in-picture"
+	PublicKeyCreate   Feature = "publickey-credentials-create"
+	PublicKeyGet      Feature = "publickey-credentials-get"
+	ScreenWakeLock    Feature = "screen-wake-lock"
+	SerialPort        Feature = "serial"
+	SyncXHR           Feature = "sync-xhr"
+	USB               Feature = "usb"
+	WebShare          Feature = "web-share"
+	XRSpatialTracking Feature = "xr-spatial-tracking"
+)
+
+// Allowlist is the set of origins allowed to use a feature. Construct it with
+// None, Self, All or Origins.
+type Allowlist struct {
+	all     bool
+	self    bool
+	origins []string
+}
+
+// None disallows the feature everywhere, including in the document itself.
+func None() Allowlist {
+	return Allowlist{}
+}
+
+// Self allows the feature in the document and in same-origin frames.
+func Self() Allowlist {
+	return Allowlist{self: true}
+}
+
+// All allows the feature in the document and in all frames.
+func All() Allowlist {
+	return Allowlist{all: true}
+}
+
+var hostPattern = regexp.MustCompile(`^[A-Za-z0-9.-]+(:[0-9]+)?$`)
+
+// Origins allows the feature in frames of the given origins, e.g.
+// "https://maps.example.com", and, if self is true, in the document and in
+// same-origin frames. It panics if an origin is invalid.
+func Origins(self bool, origins ...string) Allowlist {
+	for _, o := range origins {
+		u, err := url.Parse(o)
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http") || !hostPattern.MatchString(u.Host) || u.User != nil || (u.Path != "" && u.Path != "/") || u.RawQuery != "" || u.Fragment != "" {
+			panic(fmt.Sprintf("permissionspolicy: invalid origin %q", o))
+		}
+	}
+	return Allowlist{self: self, origins: origins}
+}
+
+// String serializes the allowlist as a structured header value.
+func (a Allowlist) String() string {
+	if a.all {
+		return "*"
+	}
+	var members []string
+	if a.self {
+		members = append(members, "self")
+	}
+	for _, o := range a.origins {
+		members = append(members, strconv.Quote(strings.TrimSuffix(o, "/")))
+	}
+	return "(" + strings.Join(members, " ") + ")"
+}
+
+// Directive associates a feature with its allowlist.
+type Directive struct {
+	Feature   Feature
+	Allowlist Allowlist
+}
+
+// Allow creates a directive allowing the feature for the given allowlist.
+func Allow(f Feature, a Allowlist) Directive {
+	return Directive{Feature: f, Allowlist: a}
+}
+
+// Disable creates a directive disabling the feature, an alias for
+// Allow(f, None()).
+func Disable(f Feature) Directive {
+	return Allow(f, None())
+}
+
+// String serializes the directive.
+func (d Directive) String() string {
+	return string(d.Feature) + "=" + d.Allowlist.String()
+}
+
+func serialize(directives []Directive) string {
+	var s []string
+	for _, d := range directives {
+		s = append(s, d.String())
+	}
+	return strings.Join(s, ", ")
+}
+
+// Interceptor sets the Permissions-Policy header.
+type Interceptor struct {
+	policy string
+}
+
+// NewInterceptor constructs an interceptor that applies the given directives.
+func NewInterceptor(directives ...Directive) Interceptor {
+	return Interceptor{policy: serialize(directives)}
+}
+
+// Default returns an interceptor disabling the features giving access to
+// sensitive devices and data: camera, microphone, geolocation, display
+// capture, payment, USB and serial ports, as well as FLoC's interest-cohort.
+func Default() Interceptor {
+	return NewInterceptor(
+		Disable(Camera),
+		Disable(Microphone),
+		Disable(Geolocation),
+		Disable(DisplayCapture),
+		Disable(Payment),
+		Disable(USB),
+		Disable(SerialPort),
+		Disable(InterestCohort),
+	)
+}
+
+// Before claims and sets the Permissions-Policy header.
+func (it Interceptor) Before(w safehttp.ResponseWriter, r *safehttp.IncomingRequest, cfg safehttp.InterceptorConfig) safehttp.Result {
+	if cfg != nil {
+		// We got an override, run its Before phase instead.
+		return Interceptor(cfg.(Overrider)).Before(w, r, nil)
+	}
+	set := w.Header().Claim("Permissions-Policy")
+	if it.policy != "" {
+		set([]string{it.policy})
+	}
+	return safehttp.NotWritten()
+}
+
+// Commit is a no-op, required to satisfy the safehttp.Interceptor interface.
+func (it Interceptor) Commit(w safehttp.ResponseHeadersWriter, r *safehttp.IncomingRequest, resp safehttp.Response, _ safehttp.InterceptorConfig) {
+}
+
+// Match recognizes Overriders as Permissions-Policy configurations.
+func (it Interceptor) Match(cfg safehttp.InterceptorConfig) bool {
+	_, ok := cfg.(Overrider)
+	return ok
+}
+
+// Overrider is a safehttp.InterceptorConfig that allows to override the
+// Permissions-Policy for a specific handler, e.g. to allow the camera on a
+// video call page.
+type Overrider Interceptor
+
+// Override creates an Overrider applying the given directives instead of the
+// ones of the Interceptor.
+func Override(reason string, directives ...Directive) Overrider {
+	return Overrider{policy: serialize(directives)}
+}
@@ -0,0 +1,85 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package permissionspolicy
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-safeweb/safehttp"
+	"github.com/google/go-safeweb/safehttp/safehttptest"
+)
+
+func TestBefore(t *testing.T) {
+	var tests = []struct {
+		name        string
+		interceptor Interceptor
+		overrider   safehttp.InterceptorConfig
+		want        []string
+	}{
+		{
+			name:        "Default",
+			interceptor: Default(),
+			want:        []string{"camera=(), microphone=(), geolocation=(), display-capture=(), payment=(), usb=(), serial=(), interest-cohort=()"},
+		},
+		{
+			name: "Allowlists",
+			interceptor: NewInterceptor(
+				Allow(Fullscreen, Self()),
+				Allow(Autoplay, All()),
+				Allow(Geolocation, Origins(true, "https://maps.example.com/", "https://b.example.com:8443")),
+				Allow(Payment, Origins(false, "https://pay.example.com")),
+				Disable(Camera),
+			),
+			want: []string{`fullscreen=(self), autoplay=*, geolocation=(self "https://maps.example.com" "https://b.example.com:8443"), payment=("https://pay.example.com"), camera=()`},
+		},
+		{
+			name:        "No directives",
+			interceptor: NewInterceptor(),
+		},
+		{
+			name:        "Override",
+			interceptor: Default(),
+			overrider:   Override("video calls", Allow(Camera, Self()), Allow(Microphone, Self())),
+			want:        []string{"camera=(self), microphone=(self)"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fakeRW, rr := safehttptest.NewFakeResponseWriter()
+			req := safehttptest.NewRequest(safehttp.MethodGet, "/", nil)
+			tt.interceptor.Before(fakeRW, req, tt.overrider)
+			if diff := cmp.Diff(tt.want, rr.Header().Values("Permissions-Policy")); diff != "" {
+				t.Errorf("Permissions-Policy -want +got:\n%s", diff)
+			}
+			if !fakeRW.Header().IsClaimed("Permissions-Policy") {
+				t.Error("Permissions-Policy header not claimed")
+			}
+		})
+	}
+}
+
+func TestOriginsInvalid(t *testing.T) {
+	for _, o := range []string{"maps.example.com", "javascript:alert(1)", "https://a.com/path", "https://a.com?x", `https://a.com"`} {
+		t.Run(o, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Origins(%q) didn't panic", o)
+				}
+			}()
+			Origins(false, o)
+		})
+	}
+}
@@ -0,0 +1,373 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package policydrift detects changes to the security configuration of an
+// application by comparing it with a reviewed baseline.
+//
+// A Snapshot is a canonical, line-oriented description of the interceptors
+// and InterceptorConfigs of every route of a ServeMux and, optionally, of the
+// settings of the Server. Committing the snapshot next to the code and
+// checking it in a test, in CI or at startup makes every relaxation, such as
+// a new policy override, show up as a diff to be reviewed.
+//
+// Interceptors and configs are described by their exported fields only, so
+// that their internal state doesn't end up in the snapshot. The values of
+// fields whose name suggests a secret, e.g. SecretAppKey, are redacted.
+// Types can provide their own description by implementing Describer.
+//
+// # Usage
+//
+// In a test of the application:
+//
+//	func TestPolicyDrift(t *testing.T) {
+//		f, err := os.Open("testdata/policy.snapshot")
+//		if err != nil {
+//			t.Fatal(err)
+//		}
+//		defer f.Close()
+//		if err := policydrift.Check(f, policydrift.FromMux(newMux())); err != nil {
+//			t.Error(err)
+//		}
+//	}
+//
+// The baseline is created, and updated after a review, by writing the
+// current snapshot with Snapshot.WriteTo. The policydrift command compares two
+// snapshot files.
+package policydrift
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/go-safeweb/safehttp"
+)
+
+// ErrDrift is returned by Check when the snapshot differs from the baseline.
+var ErrDrift = errors.New("security configuration differs from the baseline")
+
+// maxDepth bounds the nesting of the values described in a snapshot.
+const maxDepth = 8
+
+// Describer is implemented by interceptors and InterceptorConfigs which
+// describe their configuration themselves, e.g. to leave out settings which
+// can't be compared across runs. The description must be on a single line and
+// must not contain secrets.
+type Describer interface {
+	// PolicyDescription returns the description of the configuration.
+	PolicyDescription() string
+}
+
+// Snapshot is a canonical description of a security configuration.
+type Snapshot struct {
+	lines []string
+}
+
+// FromMux takes a snapshot of the routes of a ServeMux.
+func FromMux(m *safehttp.ServeMux) Snapshot {
+	var lines []string
+	for _, r := range m.Routes() {
+		prefix := fmt.Sprintf("route %s %s", r.Method, r.Pattern)
+		if len(r.Interceptors) == 0 && len(r.Configs) == 0 {
+			lines = append(lines, prefix)
+		}
+		for _, it := range r.Interceptors {
+			lines = append(lines, prefix+" interceptor "+describe(it))
+		}
+		for _, c := range r.Configs {
+			lines = append(lines, prefix+" config "+describe(c))
+		}
+	}
+	return newSnapshot(lines)
+}
+
+// FromServer takes a snapshot of the settings of a Server and of the routes
+// of its ServeMux and of the ServeMuxes of its Listeners.
+func FromServer(s *safehttp.Server) Snapshot {
+	var lines []string
+	if s.Mux != nil {
+		lines = FromMux(s.Mux).lines
+	}
+	for _, l := range s.Listeners {
+		addr := l.Addr
+		if l.Listener != nil {
+			addr = l.Listener.Addr().String()
+		}
+		prefix := "listener " + addr + " "
+		if l.Mux != nil {
+			for _, line := range FromMux(l.Mux).lines {
+				lines = append(lines, prefix+line)
+			}
+		}
+		lines = append(lines, prefix+"tls "+strconv.FormatBool(l.TLSConfig != nil))
+	}
+	lines = append(lines,
+		"server ReadTimeout "+s.ReadTimeout.String(),
+		"server WriteTimeout "+s.WriteTimeout.String(),
+		"server IdleTimeout "+s.IdleTimeout.String(),
+		"server MaxHeaderBytes "+strconv.Itoa(s.MaxHeaderBytes),
+		"server DisableKeepAlives "+strconv.FormatBool(s.DisableKeepAlives),
+	)
+	if c := s.TLSConfig; c != nil {
+		lines = append(lines,
+			fmt.Sprintf("server TLSConfig.MinVersion %#04x", c.MinVersion),
+			fmt.Sprintf("server TLSConfig.CipherSuites %#04x", c.CipherSuites),
+			"server TLSConfig.ClientAuth "+c.ClientAuth.String(),
+		)
+	}
+	return newSnapshot(lines)
+}
+
+// Parse reads a snapshot written by WriteTo. Empty lines and lines starting
+// with # are ignored.
+func Parse(r io.Reader) (Snapshot, error) {
+	var lines []string
+	sc := bufio.NewScanner(r)
+	sc.Buffer(nil, 1<<20)
+	for sc.Scan() {
+		l := strings.TrimSpace(sc.Text())
+		if l == "" || strings.HasPrefix(l, "#") {
+			continue
+		}
+		lines = append(lines, l)
+	}
+	if err := sc.Err(); err != nil {
+		return Snapshot{}, err
+	}
+	return newSnapshot(lines), nil
+}
+
+func newSnapshot(lines []string) Snapshot {
+	sort.Strings(lines)
+	// Identical lines, e.g. two instances of the same interceptor, describe
+	// the same configuration.
+	var dedup []string
+	for i, l := range lines {
+		if i == 0 || l != lines[i-1] {
+			dedup = append(dedup, l)
+		}
+	}
+	return Snapshot{lines: dedup}
+}
+
+// WriteTo writes the snapshot, one line per setting.
+func (s Snapshot) WriteTo(w io.Writer) (int64, error) {
+	var n int64
+	for _, l := range s.lines {
+		m, err := io.WriteString(w, l+"\n")
+		n += int64(m)
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// String returns the snapshot as written by WriteTo.
+func (s Snapshot) String() string {
+	var b strings.Builder
+	s.WriteTo(&b)
+	return b.String()
+}
+
+// Change is a line of a snapshot which was added or removed.
+type Change struct {
+	Line  string
+	Added bool
+}
+
+// String formats the change as a line of a diff.
+func (c Change) String() string {
+	if c.Added {
+		return "+ " + c.Line
+	}
+	return "- " + c.Line
+}
+
+// Diff returns the lines which were removed from, or added to, baseline in
+// current, sorted.
+func Diff(baseline, current Snapshot) []Change {
+	var changes []Change
+	b, c := baseline.lines, current.lines
+	for len(b) > 0 || len(c) > 0 {
+		switch {
+		case len(c) == 0 || (len(b) > 0 && b[0] < c[0]):
+			changes = append(changes, Change{Line: b[0]})
+			b = b[1:]
+		case len(b) == 0 || c[0] < b[0]:
+			changes = append(changes, Change{Line: c[0], Added: true})
+			c = c[1:]
+		default:
+			b, c = b[1:], c[1:]
+		}
+	}
+	return changes
+}
+
+// Check compares current with the baseline read from r. If they differ, it
+// returns an error wrapping ErrDrift and listing the changes.
+//
+// Whether a change relaxes or tightens the configuration can't be told in
+// general, so every change has to be reviewed and the baseline updated.
+func Check(r io.Reader, current Snapshot) error {
+	baseline, err := Parse(r)
+	if err != nil {
+		return err
+	}
+	changes := Diff(baseline, current)
+	if len(changes) == 0 {
+		return nil
+	}
+	var b strings.Builder
+	for _, c := range changes {
+		b.WriteString("\n")
+		b.WriteString(c.String())
+	}
+	return fmt.Errorf("%w:%s", ErrDrift, b.String())
+}
+
+// describe returns a canonical description of v, made of its exported fields.
+// Functions and channels are described only by their type, as their values
+// aren't comparable across runs.
+func describe(v interface{}) string {
+	var b strings.Builder
+	describeValue(&b, reflect.ValueOf(v), 0)
+	return b.String()
+}
+
+var (
+	durationType  = reflect.TypeOf(time.Duration(0))
+	describerType = reflect.TypeOf((*Describer)(nil)).Elem()
+)
+
+// secretWords are the words which, in the name of a field, suggest it holds a
+// secret, as do names ending with "key".
+var secretWords = []string{"secret", "password", "passwd", "token", "credential"}
+
+func isSecret(field string) bool {
+	f := strings.ToLower(field)
+	for _, w := range secretWords {
+		if strings.Contains(f, w) {
+			return true
+		}
+	}
+	return strings.HasSuffix(f, "key")
+}
+
+func describeValue(b *strings.Builder, v reflect.Value, depth int) {
+	if !v.IsValid() {
+		b.WriteString("nil")
+		return
+	}
+	if depth > maxDepth {
+		b.WriteString("...")
+		return
+	}
+	t := v.Type()
+	if t.Implements(describerType) && !(v.Kind() == reflect.Ptr && v.IsNil()) {
+		b.WriteString(t.String())
+		b.WriteString("(")
+		b.WriteString(strconv.Quote(v.Interface().(Describer).PolicyDescription()))
+		b.WriteString(")")
+		return
+	}
+	switch v.Kind() {
+	case reflect.Interface:
+		if v.IsNil() {
+			b.WriteString("nil")
+			return
+		}
+		describeValue(b, v.Elem(), depth)
+	case reflect.Ptr:
+		if v.IsNil() {
+			b.WriteString("nil")
+			return
+		}
+		b.WriteString("&")
+		describeValue(b, v.Elem(), depth+1)
+	case reflect.Struct:
+		b.WriteString(t.String())
+		b.WriteString("{")
+		first := true
+		for i := 0; i < v.NumField(); i++ {
+			f := t.Field(i)
+			if f.PkgPath != "" {
+				// Unexported fields hold internal, possibly mutable, state.
+				continue
+			}
+			if !first {
+				b.WriteString(" ")
+			}
+			first = false
+			b.WriteString(f.Name)
+			b.WriteString(":")
+			if isSecret(f.Name) && !v.Field(i).IsZero() {
+				b.WriteString("<redacted>")
+				continue
+			}
+			describeValue(b, v.Field(i), depth+1)
+		}
+		b.WriteString("}")
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			b.WriteString("[]")
+			return
+		}
+		b.WriteString("[")
+		for i := 0; i < v.Len(); i++ {
+			if i > 0 {
+				b.WriteString(" ")
+			}
+			describeValue(b, v.Index(i), depth+1)
+		}
+		b.WriteString("]")
+	case reflect.Map:
+		entries := make([]string, 0, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			var e strings.Builder
+			describeValue(&e, iter.Key(), depth+1)
+			e.WriteString(":")
+			describeValue(&e, iter.Value(), depth+1)
+			entries = append(entries, e.String())
+		}
+		sort.Strings(entries)
+		b.WriteString("map[")
+		b.WriteString(strings.Join(entries, " "))
+		b.WriteString("]")
+	case reflect.String:
+		b.WriteString(strconv.Quote(v.String()))
+	case reflect.Bool:
+		b.WriteString(strconv.FormatBool(v.Bool()))
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if t == durationType {
+			b.WriteString(time.Duration(v.Int()).String())
+			return
+		}
+		b.WriteString(strconv.FormatInt(v.Int(), 10))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		b.WriteString(strconv.FormatUint(v.Uint(), 10))
+	case reflect.Float32, reflect.Float64:
+		b.WriteString(strconv.FormatFloat(v.Float(), 'g', -1, 64))
+	default:
+		// Functions, channels and unsafe pointers.
+		b.WriteString(t.String())
+	}
+}
@@ -0,0 +1,152 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package policydrift_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-safeweb/safehttp"
+	"github.com/google/go-safeweb/safehttp/plugins/corp"
+	"github.com/google/go-safeweb/safehttp/plugins/policydrift"
+	"github.com/google/go-safeweb/safehttp/plugins/xsrf/xsrfhtml"
+)
+
+var ok = safehttp.HandlerFunc(func(w safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+	return w.Write(safehttp.NoContentResponse{})
+})
+
+func newMux(relaxed bool) *safehttp.ServeMux {
+	cfg := safehttp.NewServeMuxConfig(nil)
+	cfg.Intercept(corp.Default())
+	mux := cfg.Mux()
+	mux.Handle("/", safehttp.MethodGet, ok)
+	if relaxed {
+		mux.Handle("/embed", safehttp.MethodGet, ok, corp.Override("embedded by partners", corp.CrossOrigin))
+	}
+	return mux
+}
+
+func TestFromMux(t *testing.T) {
+	want := `route GET / interceptor corp.Interceptor{Policy:"same-origin"}
+`
+	if got := policydrift.FromMux(newMux(false)).String(); got != want {
+		t.Errorf("FromMux().String(): got %q, want %q", got, want)
+	}
+}
+
+type counter struct {
+	Limit int
+	hits  map[string]int
+}
+
+func (counter) Before(w safehttp.ResponseWriter, r *safehttp.IncomingRequest, _ safehttp.InterceptorConfig) safehttp.Result {
+	return safehttp.NotWritten()
+}
+
+func (counter) Commit(w safehttp.ResponseHeadersWriter, r *safehttp.IncomingRequest, resp safehttp.Response, _ safehttp.InterceptorConfig) {
+}
+
+func (counter) Match(safehttp.InterceptorConfig) bool { return false }
+
+type described struct {
+	counter
+}
+
+func (described) PolicyDescription() string { return "custom" }
+
+func TestFromMuxDescriptions(t *testing.T) {
+	cfg := safehttp.NewServeMuxConfig(nil)
+	cfg.Intercept(&xsrfhtml.Interceptor{SecretAppKey: "topsecret"})
+	cfg.Intercept(counter{Limit: 3, hits: map[string]int{"a": 1}})
+	cfg.Intercept(described{})
+	mux := cfg.Mux()
+	mux.Handle("/", safehttp.MethodGet, ok)
+
+	want := `route GET / interceptor &xsrfhtml.Interceptor{SecretAppKey:<redacted>}
+route GET / interceptor policydrift_test.counter{Limit:3}
+route GET / interceptor policydrift_test.described("custom")
+`
+	got := policydrift.FromMux(mux).String()
+	if got != want {
+		t.Errorf("FromMux().String(): got %q, want %q", got, want)
+	}
+	if strings.Contains(got, "topsecret") {
+		t.Error("FromMux().String() contains the secret")
+	}
+}
+
+func TestFromServer(t *testing.T) {
+	s := &safehttp.Server{
+		Mux:         newMux(false),
+		ReadTimeout: 5 * time.Second,
+		Listeners:   []safehttp.Listener{{Addr: "127.0.0.1:8081", Mux: newMux(true)}},
+	}
+	got := policydrift.FromServer(s).String()
+	for _, want := range []string{
+		`route GET / interceptor corp.Interceptor{Policy:"same-origin"}`,
+		`listener 127.0.0.1:8081 route GET /embed config corp.Overrider{Policy:"cross-origin"}`,
+		"listener 127.0.0.1:8081 tls false",
+		"server ReadTimeout 5s",
+		"server WriteTimeout 0s",
+	} {
+		if !strings.Contains(got, want+"\n") {
+			t.Errorf("FromServer().String(): got %q, want it to contain %q", got, want)
+		}
+	}
+}
+
+func TestParseRoundTrip(t *testing.T) {
+	s := policydrift.FromMux(newMux(true))
+	parsed, err := policydrift.Parse(strings.NewReader("# baseline\n\n" + s.String()))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if diff := policydrift.Diff(s, parsed); len(diff) != 0 {
+		t.Errorf("Diff(snapshot, parsed): got %v, want none", diff)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	baseline := policydrift.FromMux(newMux(false)).String()
+
+	if err := policydrift.Check(strings.NewReader(baseline), policydrift.FromMux(newMux(false))); err != nil {
+		t.Errorf("Check(unchanged): got %v, want nil", err)
+	}
+
+	current := policydrift.FromMux(newMux(true))
+	want := []policydrift.Change{
+		{Line: `route GET /embed config corp.Overrider{Policy:"cross-origin"}`, Added: true},
+		{Line: `route GET /embed interceptor corp.Interceptor{Policy:"same-origin"}`, Added: true},
+	}
+	b, _ := policydrift.Parse(strings.NewReader(baseline))
+	if diff := cmp.Diff(want, policydrift.Diff(b, current)); diff != "" {
+		t.Errorf("Diff() mismatch (-want +got):\n%s", diff)
+	}
+
+	err := policydrift.Check(strings.NewReader(baseline), current)
+	if !errors.Is(err, policydrift.ErrDrift) {
+		t.Fatalf("Check(relaxed): got %v, want ErrDrift", err)
+	}
+	if !strings.Contains(err.Error(), `+ route GET /embed config corp.Overrider{Policy:"cross-origin"}`) {
+		t.Errorf("Check(relaxed): got %q, want it to list the override", err)
+	}
+	if err := policydrift.Check(strings.NewReader(current.String()), policydrift.FromMux(newMux(false))); !errors.Is(err, policydrift.ErrDrift) {
+		t.Errorf("Check(removed routes): got %v, want ErrDrift", err)
+	}
+}
@@ -0,0 +1,131 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package precondition provides helpers for evaluating the If-Match and
+// If-Unmodified-Since preconditions of requests modifying a resource, enabling
+// optimistic concurrency control.
+//
+// More info:
+//   - RFC 7232: https://tools.ietf.org/html/rfc7232
+//   - RFC 6585: https://tools.ietf.org/html/rfc6585#section-3
+//
+// # Usage
+//
+// In a handler modifying a resource, load its current version and call Check
+// before applying the change:
+//
+//	if res, ok := precondition.Check(w, r, precondition.Version{ETag: etag}, true); !ok {
+//		return res
+//	}
+package precondition
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/go-safeweb/safehttp"
+)
+
+// Version identifies the current version of a resource.
+type Version struct {
+	// ETag is the strong entity tag of the resource, including the double
+	// quotes, e.g. `"v42"`. Weak entity tags never match If-Match.
+	ETag string
+	// LastModified is the time of the last modification of the resource,
+	// which is compared against If-Unmodified-Since with a second precision.
+	LastModified time.Time
+}
+
+// exists reports whether v describes an existing resource.
+func (v Version) exists() bool {
+	return v.ETag != "" || !v.LastModified.IsZero()
+}
+
+// Evaluate evaluates the preconditions of r against the current version of
+// the resource, returning the status to respond with if they fail, or
+// safehttp.StatusOK if the request can proceed.
+//
+// If-Unmodified-Since is only evaluated when If-Match is absent. A missing or
+// zero Version means the resource doesn't exist: only If-Match: * will then
+// fail. If required is true and r has no precondition,
+// safehttp.StatusPreconditionRequired is returned.
+func Evaluate(r *safehttp.IncomingRequest, v Version, required bool) safehttp.StatusCode {
+	if im := r.Header.Get("If-Match"); im != "" {
+		if !matches(im, v) {
+			return safehttp.StatusPreconditionFailed
+		}
+		return safehttp.StatusOK
+	}
+	if ius := r.Header.Get("If-Unmodified-Since"); ius != "" {
+		t, err := http.ParseTime(ius)
+		if err == nil {
+			// Dates without a modification time can't be evaluated and are
+			// ignored, as mandated by RFC 7232.
+			if !v.LastModified.IsZero() && v.LastModified.Truncate(time.Second).After(t) {
+				return safehttp.StatusPreconditionFailed
+			}
+			return safehttp.StatusOK
+		}
+	}
+	if required {
+		return safehttp.StatusPreconditionRequired
+	}
+	return safehttp.StatusOK
+}
+
+// Check evaluates the preconditions of r like Evaluate. If they fail, the
+// error response is written and the returned Result should be returned by
+// the handler. Otherwise, ok is true and the handler can proceed.
+func Check(w safehttp.ResponseWriter, r *safehttp.IncomingRequest, v Version, required bool) (res safehttp.Result, ok bool) {
+	if code := Evaluate(r, v, required); code != safehttp.StatusOK {
+		return w.WriteError(code), false
+	}
+	return safehttp.NotWritten(), true
+}
+
+// matches implements the strong comparison of the If-Match header value
+// against the entity tag of the resource.
+func matches(ifMatch string, v Version) bool {
+	if strings.TrimSpace(ifMatch) == "*" {
+		return v.exists()
+	}
+	if v.ETag == "" || strings.HasPrefix(v.ETag, "W/") {
+		return false
+	}
+	// Entity tags can contain commas, so the list has to be scanned tag by tag.
+	s := ifMatch
+	for {
+		s = strings.TrimLeft(s, " \t,")
+		if s == "" {
+			return false
+		}
+		weak := strings.HasPrefix(s, "W/")
+		if weak {
+			s = s[2:]
+		}
+		if len(s) < 2 || s[0] != '"' {
+			return false
+		}
+		end := strings.IndexByte(s[1:], '"')
+		if end < 0 {
+			return false
+		}
+		tag := s[:end+2]
+		if !weak && tag == v.ETag {
+			return true
+		}
+		s = s[end+2:]
+	}
+}
@@ -0,0 +1,135 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package precondition_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-safeweb/safehttp"
+	"github.com/google/go-safeweb/safehttp/plugins/precondition"
+	"github.com/google/go-safeweb/safehttp/safehttptest"
+)
+
+func TestEvaluate(t *testing.T) {
+	modified := time.Date(2020, time.June, 1, 10, 0, 0, 500, time.UTC)
+	current := precondition.Version{ETag: `"v2"`, LastModified: modified}
+
+	tests := []struct {
+		name     string
+		header   map[string]string
+		version  precondition.Version
+		required bool
+		want     safehttp.StatusCode
+	}{
+		{
+			name: "No preconditions",
+			want: safehttp.StatusOK,
+		},
+		{
+			name:     "No preconditions, required",
+			required: true,
+			want:     safehttp.StatusPreconditionRequired,
+		},
+		{
+			name:    "If-Match matching",
+			header:  map[string]string{"If-Match": `"v1", "v2"`},
+			version: current,
+			want:    safehttp.StatusOK,
+		},
+		{
+			name:    "If-Match with comma in entity tag",
+			header:  map[string]string{"If-Match": `"v2,v3"`},
+			version: current,
+			want:    safehttp.StatusPreconditionFailed,
+		},
+		{
+			name:    "If-Match not matching",
+			header:  map[string]string{"If-Match": `"v1"`},
+			version: current,
+			want:    safehttp.StatusPreconditionFailed,
+		},
+		{
+			name:    "If-Match weak",
+			header:  map[string]string{"If-Match": `W/"v2"`},
+			version: current,
+			want:    safehttp.StatusPreconditionFailed,
+		},
+		{
+			name:    "If-Match star",
+			header:  map[string]string{"If-Match": "*"},
+			version: current,
+			want:    safehttp.StatusOK,
+		},
+		{
+			name:   "If-Match star, missing resource",
+			header: map[string]string{"If-Match": "*"},
+			want:   safehttp.StatusPreconditionFailed,
+		},
+		{
+			name: "If-Match takes precedence",
+			header: map[string]string{
+				"If-Match":            `"v2"`,
+				"If-Unmodified-Since": "Mon, 01 Jan 2018 00:00:00 GMT",
+			},
+			version: current,
+			want:    safehttp.StatusOK,
+		},
+		{
+			name:    "If-Unmodified-Since, not modified",
+			header:  map[string]string{"If-Unmodified-Since": "Mon, 01 Jun 2020 10:00:00 GMT"},
+			version: current,
+			want:    safehttp.StatusOK,
+		},
+		{
+			name:    "If-Unmodified-Since, modified",
+			header:  map[string]string{"If-Unmodified-Since": "Mon, 01 Jun 2020 09:59:59 GMT"},
+			version: current,
+			want:    safehttp.StatusPreconditionFailed,
+		},
+		{
+			name:     "Invalid If-Unmodified-Since, required",
+			header:   map[string]string{"If-Unmodified-Since": "yesterday"},
+			version:  current,
+			required: true,
+			want:     safehttp.StatusPreconditionRequired,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := safehttptest.NewRequest(safehttp.MethodPut, "/", nil)
+			for k, v := range tt.header {
+				r.Header.Set(k, v)
+			}
+			if got := precondition.Evaluate(r, tt.version, tt.required); got != tt.want {
+				t.Errorf("precondition.Evaluate() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheck(t *testing.T) {
+	r := safehttptest.NewRequest(safehttp.MethodPut, "/", nil)
+	r.Header.Set("If-Match", `"v1"`)
+	fakeRW, rr := safehttptest.NewFakeResponseWriter()
+
+	if _, ok := precondition.Check(fakeRW, r, precondition.Version{ETag: `"v2"`}, true); ok {
+		t.Error("precondition.Check() ok = true, want false")
+	}
+	if got, want := rr.Code, int(safehttp.StatusPreconditionFailed); got != want {
+		t.Errorf("rr.Code = %v, want %v", got, want)
+	}
+}
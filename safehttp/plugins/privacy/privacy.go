@@ -0,0 +1,186 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package privacy provides a plugin parsing the Global Privacy Control
+// (Sec-GPC) and Do-Not-Track (DNT) signals of requests, and a policy hook
+// deciding whether analytics are allowed for them.
+//
+// # Usage
+//
+// Install an Interceptor using safehttp.ServeMuxConfig.Intercept. Handlers and
+// loggers can then check TrackingAllowed, or drop their analytics fields with
+// RedactFields:
+//
+//	log.Print(privacy.RedactFields(r.Context(), fields, "client_id", "referrer"))
+//
+// Templates get the trackingAllowed function, to only include analytics
+// scripts when allowed:
+//
+//	{{if trackingAllowed}}<script src="https://analytics.example.com/a.js"></script>{{end}}
+//
+// The function must be declared when parsing the templates, e.g. with
+// privacy.FuncMap, and is replaced for each response.
+package privacy
+
+import (
+	"context"
+
+	"github.com/google/go-safeweb/safehttp"
+)
+
+// TemplateFuncName is the name of the template function reporting whether
+// analytics are allowed for the request.
+const TemplateFuncName = "trackingAllowed"
+
+// FuncMap returns a placeholder for the template function of the plugin, to
+// be passed to the Funcs method of templates before parsing them.
+func FuncMap() map[string]interface{} {
+	return map[string]interface{}{TemplateFuncName: func() bool { return false }}
+}
+
+// Signals are the privacy preferences sent by the user agent.
+type Signals struct {
+	// GlobalPrivacyControl reports whether the request has the Sec-GPC: 1
+	// header.
+	GlobalPrivacyControl bool
+	// DoNotTrack reports whether the request has the DNT: 1 header.
+	DoNotTrack bool
+}
+
+// ParseSignals reads the privacy signals of the request.
+func ParseSignals(r *safehttp.IncomingRequest) Signals {
+	return Signals{
+		GlobalPrivacyControl: r.Header.Get("Sec-GPC") == "1",
+		DoNotTrack:           r.Header.Get("DNT") == "1",
+	}
+}
+
+// Policy decides whether analytics are allowed for requests with the given
+// signals.
+type Policy func(Signals) bool
+
+// DefaultPolicy disallows analytics when either signal is present.
+func DefaultPolicy(s Signals) bool {
+	return !s.GlobalPrivacyControl && !s.DoNotTrack
+}
+
+// GPCOnlyPolicy disallows analytics when the Global Privacy Control signal is
+// present, ignoring the deprecated Do-Not-Track signal.
+func GPCOnlyPolicy(s Signals) bool {
+	return !s.GlobalPrivacyControl
+}
+
+type decision struct {
+	signals Signals
+	allowed bool
+	// consulted reports whether the signals or the decision were read, in
+	// which case the response can depend on them.
+	consulted bool
+}
+
+type decisionKey struct{}
+
+func fromContext(ctx context.Context) (*decision, bool) {
+	d, ok := safehttp.FlightValues(ctx).Get(decisionKey{}).(*decision)
+	if ok {
+		d.consulted = true
+	}
+	return d, ok
+}
+
+// FromContext returns the privacy signals of the request.
+func FromContext(ctx context.Context) Signals {
+	d, ok := fromContext(ctx)
+	if !ok {
+		return Signals{}
+	}
+	return d.signals
+}
+
+// TrackingAllowed reports whether the policy allows analytics for the request.
+// Without an installed Interceptor, it returns true.
+func TrackingAllowed(ctx context.Context) bool {
+	d, ok := fromContext(ctx)
+	return !ok || d.allowed
+}
+
+// RedactFields returns the given logging fields without the named analytics
+// ones if the policy disallows analytics for the request. The fields map is
+// not modified.
+func RedactFields(ctx context.Context, fields map[string]interface{}, analytics ...string) map[string]interface{} {
+	if TrackingAllowed(ctx) {
+		return fields
+	}
+	drop := map[string]bool{}
+	for _, f := range analytics {
+		drop[f] = true
+	}
+	redacted := make(map[string]interface{}, len(fields))
+	for k, v := range fields {
+		if !drop[k] {
+			redacted[k] = v
+		}
+	}
+	return redacted
+}
+
+// Interceptor parses the privacy signals of requests and applies the policy to
+// them.
+type Interceptor struct {
+	// Policy decides whether analytics are allowed. If nil, DefaultPolicy is
+	// used.
+	Policy Policy
+}
+
+var _ safehttp.Interceptor = Interceptor{}
+
+// Before parses the privacy signals of the request and stores them, along with
+// the decision of the policy, in the request context.
+func (it Interceptor) Before(w safehttp.ResponseWriter, r *safehttp.IncomingRequest, _ safehttp.InterceptorConfig) safehttp.Result {
+	p := it.Policy
+	if p == nil {
+		p = DefaultPolicy
+	}
+	s := ParseSignals(r)
+	safehttp.FlightValues(r.Context()).Put(decisionKey{}, &decision{signals: s, allowed: p(s)})
+	return safehttp.NotWritten()
+}
+
+// Commit adds the trackingAllowed function to safehttp.TemplateResponses. The
+// signals are added to the Vary header of these responses, and of the ones
+// whose handler read the signals or the decision of the policy, so that
+// shared caches don't serve them to users with other signals.
+func (it Interceptor) Commit(w safehttp.ResponseHeadersWriter, r *safehttp.IncomingRequest, resp safehttp.Response, _ safehttp.InterceptorConfig) {
+	d, ok := safehttp.FlightValues(r.Context()).Get(decisionKey{}).(*decision)
+	if !ok {
+		return
+	}
+	tmplResp, isTmpl := resp.(*safehttp.TemplateResponse)
+	if isTmpl || d.consulted {
+		w.Header().Vary("Sec-GPC", "DNT")
+	}
+	if !isTmpl {
+		return
+	}
+	allowed := d.allowed
+	if tmplResp.FuncMap == nil {
+		tmplResp.FuncMap = map[string]interface{}{}
+	}
+	tmplResp.FuncMap[TemplateFuncName] = func() bool { return allowed }
+}
+
+// Match returns false since there are no supported configurations.
+func (Interceptor) Match(safehttp.InterceptorConfig) bool {
+	return false
+}
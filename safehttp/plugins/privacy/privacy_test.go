@@ -0,0 +1,149 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package privacy_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-safeweb/safehttp"
+	"github.com/google/go-safeweb/safehttp/plugins/privacy"
+	"github.com/google/safehtml/template"
+)
+
+func TestInterceptor(t *testing.T) {
+	tests := []struct {
+		name        string
+		policy      privacy.Policy
+		headers     map[string]string
+		wantSignals privacy.Signals
+		wantFields  map[string]interface{}
+		wantBody    string
+	}{
+		{
+			name:       "No signals",
+			wantFields: map[string]interface{}{"path": "/", "client_id": "c"},
+			wantBody:   "<p>page</p><script>analytics</script>",
+		},
+		{
+			name:        "Global Privacy Control",
+			headers:     map[string]string{"Sec-GPC": "1"},
+			wantSignals: privacy.Signals{GlobalPrivacyControl: true},
+			wantFields:  map[string]interface{}{"path": "/"},
+			wantBody:    "<p>page</p>",
+		},
+		{
+			name:        "Do Not Track",
+			headers:     map[string]string{"DNT": "1"},
+			wantSignals: privacy.Signals{DoNotTrack: true},
+			wantFields:  map[string]interface{}{"path": "/"},
+			wantBody:    "<p>page</p>",
+		},
+		{
+			name:        "Do Not Track ignored by policy",
+			policy:      privacy.GPCOnlyPolicy,
+			headers:     map[string]string{"DNT": "1"},
+			wantSignals: privacy.Signals{DoNotTrack: true},
+			wantFields:  map[string]interface{}{"path": "/", "client_id": "c"},
+			wantBody:    "<p>page</p><script>analytics</script>",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mc := safehttp.NewServeMuxConfig(nil)
+			mc.Intercept(privacy.Interceptor{Policy: tt.policy})
+			mux := mc.Mux()
+
+			tmpl := template.Must(template.New("").Funcs(privacy.FuncMap()).Parse(
+				`<p>page</p>{{if trackingAllowed}}<script>analytics</script>{{end}}`))
+			var gotSignals privacy.Signals
+			var gotFields map[string]interface{}
+			mux.Handle("/", safehttp.MethodGet, safehttp.HandlerFunc(func(w safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+				gotSignals = privacy.FromContext(r.Context())
+				fields := map[string]interface{}{"path": "/", "client_id": "c"}
+				gotFields = privacy.RedactFields(r.Context(), fields, "client_id")
+				return safehttp.ExecuteTemplate(w, tmpl, nil)
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "https://foo.com/", nil)
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, req)
+
+			if gotSignals != tt.wantSignals {
+				t.Errorf("privacy.FromContext(): got %+v, want %+v", gotSignals, tt.wantSignals)
+			}
+			if diff := cmp.Diff(tt.wantFields, gotFields); diff != "" {
+				t.Errorf("privacy.RedactFields() mismatch (-want +got):\n%s", diff)
+			}
+			if got := rr.Body.String(); got != tt.wantBody {
+				t.Errorf("rr.Body: got %q, want %q", got, tt.wantBody)
+			}
+			if got, want := rr.Header().Get("Vary"), "Sec-Gpc, Dnt"; got != want {
+				t.Errorf("Vary: got %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestInterceptorVary(t *testing.T) {
+	tests := []struct {
+		name     string
+		consult  bool
+		wantVary string
+	}{
+		{name: "Signals not read"},
+		{name: "Signals read", consult: true, wantVary: "Sec-Gpc, Dnt"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mc := safehttp.NewServeMuxConfig(nil)
+			mc.Intercept(privacy.Interceptor{})
+			mux := mc.Mux()
+			mux.Handle("/", safehttp.MethodGet, safehttp.HandlerFunc(func(w safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+				if tt.consult && privacy.TrackingAllowed(r.Context()) {
+					w.Header().Set("Analytics-Id", "a")
+				}
+				return w.Write(safehttp.NoContentResponse{})
+			}))
+
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "https://foo.com/", nil))
+			if got := rr.Header().Get("Vary"); got != tt.wantVary {
+				t.Errorf("Vary: got %q, want %q", got, tt.wantVary)
+			}
+		})
+	}
+}
+
+func TestTrackingAllowedWithoutInterceptor(t *testing.T) {
+	mux := safehttp.NewServeMuxConfig(nil).Mux()
+	var allowed bool
+	mux.Handle("/", safehttp.MethodGet, safehttp.HandlerFunc(func(w safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+		allowed = privacy.TrackingAllowed(r.Context())
+		return w.Write(safehttp.NoContentResponse{})
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "https://foo.com/", nil)
+	req.Header.Set("Sec-GPC", "1")
+	mux.ServeHTTP(httptest.NewRecorder(), req)
+	if !allowed {
+		t.Error("privacy.TrackingAllowed() without an Interceptor: got false, want true")
+	}
+}
@@ -0,0 +1,280 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package quota provides per-identity quota accounting, e.g. daily or monthly
+// request budgets per API key, distinct from burst rate limiting.
+//
+// Usage is reported to clients with the RateLimit-Limit, RateLimit-Remaining
+// and RateLimit-Reset headers, and their X-RateLimit- equivalents. The
+// ratelimit package sets the same headers: if both Interceptors are
+// installed, the headers report the most restrictive of their limits.
+//
+// More info:
+//   - https://datatracker.ietf.org/doc/draft-ietf-httpapi-ratelimit-headers/
+//
+// # Usage
+//
+// Create a Tracker on a Store shared by the servers and install an
+// Interceptor using safehttp.ServeMuxConfig.Intercept:
+//
+//	tr := quota.NewTracker(quota.NewMemoryStore(nil), nil)
+//	cfg.Intercept(quota.Interceptor{
+//		Tracker:  tr,
+//		Identify: func(r *safehttp.IncomingRequest) string { return r.Header.Get("X-Api-Key") },
+//		Quota:    func(id string) quota.Quota { return quota.Quota{Limit: 1000, Period: quota.Daily} },
+//	})
+//
+// The remaining quota of an identity can be queried with Tracker.Usage.
+package quota
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/go-safeweb/safehttp"
+	"github.com/google/go-safeweb/safehttp/plugins/internal/ratelimitheaders"
+)
+
+// Period is the duration of the windows a quota applies to. Windows are
+// aligned on UTC calendar days or months.
+type Period int
+
+const (
+	// Daily quotas reset at midnight UTC.
+	Daily Period = iota
+	// Monthly quotas reset on the first day of the month, at midnight UTC.
+	Monthly
+)
+
+// window returns the start of the window containing t and of the next one.
+func (p Period) window(t time.Time) (start, end time.Time) {
+	t = t.UTC()
+	switch p {
+	case Daily:
+		start = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+		return start, start.AddDate(0, 0, 1)
+	case Monthly:
+		start = time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+		return start, start.AddDate(0, 1, 0)
+	default:
+		panic(fmt.Sprintf("unknown quota period %d", p))
+	}
+}
+
+// Quota is a budget of units, e.g. requests, per period.
+type Quota struct {
+	// Limit is the number of units available per period.
+	Limit int64
+	// Period is the period of the quota.
+	Period Period
+}
+
+// Store stores the units consumed by identities. Implementations must be safe
+// for concurrent use. To share quotas between servers, use a Store backed by
+// a shared database.
+type Store interface {
+	// Add atomically adds n to the counter identified by key and returns its
+	// new value. The counter can be dropped after expires.
+	Add(ctx context.Context, key string, n int64, expires time.Time) (int64, error)
+	// Get returns the value of the counter identified by key, or zero if it
+	// doesn't exist.
+	Get(ctx context.Context, key string) (int64, error)
+}
+
+// Usage is the state of the quota of an identity in the current window.
+type Usage struct {
+	// Limit is the limit of the quota.
+	Limit int64
+	// Used is the number of units consumed in the current window.
+	Used int64
+	// Reset is when the current window ends.
+	Reset time.Time
+}
+
+// Remaining returns the number of units left in the current window.
+func (u Usage) Remaining() int64 {
+	if u.Used >= u.Limit {
+		return 0
+	}
+	return u.Limit - u.Used
+}
+
+// Exceeded reports whether more units than the limit were consumed.
+func (u Usage) Exceeded() bool {
+	return u.Used > u.Limit
+}
+
+// Tracker tracks the usage of quotas. It's safe for concurrent use.
+type Tracker struct {
+	store Store
+	clock safehttp.Clock
+}
+
+// NewTracker creates a Tracker storing usage in store. If clock is nil, the
+// system clock is used.
+func NewTracker(store Store, clock safehttp.Clock) *Tracker {
+	if clock == nil {
+		clock = safehttp.SystemClock()
+	}
+	return &Tracker{store: store, clock: clock}
+}
+
+func key(id string, start time.Time) string {
+	return id + "|" + strconv.FormatInt(start.Unix(), 10)
+}
+
+// Consume consumes n units of the quota q of the identity id and returns the
+// resulting usage. Units are consumed even if the quota is exceeded.
+func (t *Tracker) Consume(ctx context.Context, id string, q Quota, n int64) (Usage, error) {
+	start, end := q.Period.window(t.clock.Now())
+	used, err := t.store.Add(ctx, key(id, start), n, end)
+	if err != nil {
+		return Usage{}, err
+	}
+	return Usage{Limit: q.Limit, Used: used, Reset: end}, nil
+}
+
+// Usage returns the usage of the quota q of the identity id.
+func (t *Tracker) Usage(ctx context.Context, id string, q Quota) (Usage, error) {
+	start, end := q.Period.window(t.clock.Now())
+	used, err := t.store.Get(ctx, key(id, start))
+	if err != nil {
+		return Usage{}, err
+	}
+	return Usage{Limit: q.Limit, Used: used, Reset: end}, nil
+}
+
+type memoryCounter struct {
+	value   int64
+	expires time.Time
+}
+
+// MemoryStore is a Store keeping the counters in memory, for servers running
+// as a single instance.
+type MemoryStore struct {
+	clock safehttp.Clock
+
+	mu        sync.Mutex
+	counters  map[string]*memoryCounter
+	nextSweep time.Time
+}
+
+var _ Store = (*MemoryStore)(nil)
+
+// NewMemoryStore creates an empty MemoryStore. If clock is nil, the system
+// clock is used.
+func NewMemoryStore(clock safehttp.Clock) *MemoryStore {
+	if clock == nil {
+		clock = safehttp.SystemClock()
+	}
+	return &MemoryStore{clock: clock, counters: map[string]*memoryCounter{}}
+}
+
+// Add adds n to the counter identified by key and returns its new value.
+func (s *MemoryStore) Add(_ context.Context, key string, n int64, expires time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sweep()
+	c, ok := s.counters[key]
+	if !ok {
+		c = &memoryCounter{expires: expires}
+		s.counters[key] = c
+	}
+	c.value += n
+	return c.value, nil
+}
+
+// Get returns the value of the counter identified by key.
+func (s *MemoryStore) Get(_ context.Context, key string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if c, ok := s.counters[key]; ok {
+		return c.value, nil
+	}
+	return 0, nil
+}
+
+// sweep drops the expired counters, at most once a minute.
+func (s *MemoryStore) sweep() {
+	now := s.clock.Now()
+	if now.Before(s.nextSweep) {
+		return
+	}
+	s.nextSweep = now.Add(time.Minute)
+	for k, c := range s.counters {
+		if now.After(c.expires) {
+			delete(s.counters, k)
+		}
+	}
+}
+
+// Interceptor consumes one unit of the quota of the identity of every request
+// and rejects the requests exceeding it with 429 Too Many Requests.
+type Interceptor struct {
+	// Tracker tracks the usage of the quotas.
+	Tracker *Tracker
+	// Identify returns the identity of the request, e.g. its API key.
+	// Requests with an empty identity are not accounted.
+	Identify func(r *safehttp.IncomingRequest) string
+	// Quota returns the quota of an identity, e.g. depending on its plan.
+	Quota func(id string) Quota
+}
+
+var _ safehttp.Interceptor = Interceptor{}
+
+// Before claims the quota headers, consumes a unit of the quota of the
+// identity of the request and sets the headers. If the quota is exceeded, a
+// 429 Too Many Requests is written. If the usage can't be tracked, a 503
+// Service Unavailable is written.
+func (it Interceptor) Before(w safehttp.ResponseWriter, r *safehttp.IncomingRequest, _ safehttp.InterceptorConfig) safehttp.Result {
+	ratelimitheaders.Claim(w, r)
+
+	id := it.Identify(r)
+	if id == "" {
+		return safehttp.NotWritten()
+	}
+	u, err := it.Tracker.Consume(r.Context(), id, it.Quota(id), 1)
+	if err != nil {
+		log.Printf("quota: tracking usage of %q: %v", id, err)
+		return w.WriteError(safehttp.StatusServiceUnavailable)
+	}
+
+	l := ratelimitheaders.Limit{
+		Limit:     u.Limit,
+		Remaining: u.Remaining(),
+		Reset:     int64(u.Reset.Sub(it.Tracker.clock.Now()).Seconds() + 0.5),
+		Legacy:    true,
+	}
+	if u.Exceeded() {
+		l.Rejected, l.RetryAfter = true, l.Reset
+	}
+	ratelimitheaders.Report(r.Context(), l)
+	if u.Exceeded() {
+		return w.WriteError(safehttp.StatusTooManyRequests)
+	}
+	return safehttp.NotWritten()
+}
+
+// Commit is a no-op, required to satisfy the safehttp.Interceptor interface.
+func (Interceptor) Commit(w safehttp.ResponseHeadersWriter, r *safehttp.IncomingRequest, resp safehttp.Response, _ safehttp.InterceptorConfig) {
+}
+
+// Match returns false since there are no supported configurations.
+func (Interceptor) Match(safehttp.InterceptorConfig) bool {
+	return false
+}
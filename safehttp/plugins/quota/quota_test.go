@@ -0,0 +1,116 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package quota_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-safeweb/safehttp"
+	"github.com/google/go-safeweb/safehttp/plugins/quota"
+	"github.com/google/go-safeweb/safehttp/safehttptest"
+)
+
+func TestTracker(t *testing.T) {
+	clock := safehttptest.NewFakeClock(time.Date(2021, time.January, 31, 12, 0, 0, 0, time.UTC))
+	tr := quota.NewTracker(quota.NewMemoryStore(clock), clock)
+	ctx := context.Background()
+	daily := quota.Quota{Limit: 10, Period: quota.Daily}
+	monthly := quota.Quota{Limit: 100, Period: quota.Monthly}
+
+	if _, err := tr.Consume(ctx, "alice", daily, 4); err != nil {
+		t.Fatalf("tr.Consume() got err: %v", err)
+	}
+	if _, err := tr.Consume(ctx, "alice", monthly, 7); err != nil {
+		t.Fatalf("tr.Consume() got err: %v", err)
+	}
+
+	u, err := tr.Usage(ctx, "alice", daily)
+	if err != nil {
+		t.Fatalf("tr.Usage() got err: %v", err)
+	}
+	want := quota.Usage{Limit: 10, Used: 4, Reset: time.Date(2021, time.February, 1, 0, 0, 0, 0, time.UTC)}
+	if diff := cmp.Diff(want, u); diff != "" {
+		t.Errorf("tr.Usage() mismatch (-want +got):\n%s", diff)
+	}
+	if got, want := u.Remaining(), int64(6); got != want {
+		t.Errorf("u.Remaining() = %d, want %d", got, want)
+	}
+
+	if u, _ := tr.Usage(ctx, "bob", daily); u.Used != 0 {
+		t.Errorf("tr.Usage() for another identity: got %d used, want 0", u.Used)
+	}
+
+	// Both windows reset on the next day, which starts a new month.
+	clock.Advance(12 * time.Hour)
+	for _, q := range []quota.Quota{daily, monthly} {
+		if u, _ := tr.Usage(ctx, "alice", q); u.Used != 0 {
+			t.Errorf("tr.Usage() after reset: got %d used, want 0", u.Used)
+		}
+	}
+}
+
+func TestInterceptor(t *testing.T) {
+	clock := safehttptest.NewFakeClock(time.Date(2021, time.January, 1, 23, 0, 0, 0, time.UTC))
+	mc := safehttp.NewServeMuxConfig(nil)
+	mc.Intercept(quota.Interceptor{
+		Tracker:  quota.NewTracker(quota.NewMemoryStore(clock), clock),
+		Identify: func(r *safehttp.IncomingRequest) string { return r.Header.Get("X-Api-Key") },
+		Quota:    func(string) quota.Quota { return quota.Quota{Limit: 2, Period: quota.Daily} },
+	})
+	mux := mc.Mux()
+	mux.Handle("/", safehttp.MethodGet, safehttp.HandlerFunc(func(w safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+		return w.Write(safehttp.NoContentResponse{})
+	}))
+
+	tests := []struct {
+		name          string
+		key           string
+		wantCode      int
+		wantRemaining string
+		wantRetry     string
+	}{
+		{name: "First", key: "k", wantCode: http.StatusNoContent, wantRemaining: "1"},
+		{name: "Second", key: "k", wantCode: http.StatusNoContent, wantRemaining: "0"},
+		{name: "Exceeded", key: "k", wantCode: http.StatusTooManyRequests, wantRemaining: "0", wantRetry: "3600"},
+		{name: "Anonymous", wantCode: http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "https://foo.com/", nil)
+			if tt.key != "" {
+				req.Header.Set("X-Api-Key", tt.key)
+			}
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, req)
+
+			if rr.Code != tt.wantCode {
+				t.Errorf("rr.Code: got %v, want %v", rr.Code, tt.wantCode)
+			}
+			for _, name := range []string{"RateLimit-Remaining", "X-RateLimit-Remaining"} {
+				if got := rr.Header().Get(name); got != tt.wantRemaining {
+					t.Errorf("%s: got %q, want %q", name, got, tt.wantRemaining)
+				}
+			}
+			if got := rr.Header().Get("Retry-After"); got != tt.wantRetry {
+				t.Errorf("Retry-After: got %q, want %q", got, tt.wantRetry)
+			}
+		})
+	}
+}
@@ -0,0 +1,135 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MemcacheClient runs the Memcached commands needed by a MemcacheStore. It can
+// be implemented on top of any Memcached client library, e.g. with gomemcache:
+//
+//	func (c client) Add(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error) {
+//		exp := int32((ttl + time.Second - 1) / time.Second)
+//		err := c.mc.Add(&memcache.Item{Key: key, Value: value, Expiration: exp})
+//		if err == memcache.ErrNotStored {
+//			return false, nil
+//		}
+//		return err == nil, err
+//	}
+//
+// As Memcached expirations are in seconds, implementations should round the
+// TTLs up.
+type MemcacheClient interface {
+	// Get returns the value of key and its CAS token, as the gets command,
+	// and whether it exists.
+	Get(ctx context.Context, key string) (value []byte, cas uint64, ok bool, err error)
+	// Add sets the value of key, expiring after ttl, if it doesn't exist, as
+	// the add command. It reports whether the value was stored.
+	Add(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error)
+	// CompareAndSwap sets the value of key, expiring after ttl, if it wasn't
+	// modified since the CAS token was returned, as the cas command. It
+	// reports whether the value was stored.
+	CompareAndSwap(ctx context.Context, key string, value []byte, cas uint64, ttl time.Duration) (bool, error)
+}
+
+// maxCASAttempts is the number of times a MemcacheStore tries to update a
+// bucket modified concurrently by other servers.
+const maxCASAttempts = 10
+
+// errContention is returned when a bucket couldn't be updated within
+// maxCASAttempts.
+var errContention = errors.New("ratelimit: too many concurrent updates of the Memcached bucket")
+
+// MemcacheStore is a Store keeping the buckets in Memcached, to share them
+// between servers. The buckets are updated with compare-and-swap operations
+// and expire once they are full again. Memcached may evict buckets before,
+// which refills them.
+//
+// The current time is given by the servers, so their clocks should be
+// synchronized.
+type MemcacheStore struct {
+	client MemcacheClient
+	prefix string
+}
+
+var _ Store = (*MemcacheStore)(nil)
+
+// NewMemcacheStore creates a MemcacheStore storing the buckets under keys
+// starting with prefix, e.g. "ratelimit:".
+func NewMemcacheStore(client MemcacheClient, prefix string) *MemcacheStore {
+	return &MemcacheStore{client: client, prefix: prefix}
+}
+
+// Take takes a token from the bucket identified by key.
+func (s *MemcacheStore) Take(ctx context.Context, key string, l Limit, now time.Time) (Status, error) {
+	key = s.prefix + key
+	for i := 0; i < maxCASAttempts; i++ {
+		v, cas, ok, err := s.client.Get(ctx, key)
+		if err != nil {
+			return Status{}, err
+		}
+		tokens := l.burst()
+		if ok {
+			stored, updated, err := parseMemcacheBucket(v)
+			if err != nil {
+				return Status{}, err
+			}
+			tokens = l.refill(stored, now.Sub(updated))
+		}
+		allowed := tokens >= 1
+		if allowed {
+			tokens--
+		}
+		b := []byte(strconv.FormatFloat(tokens, 'g', -1, 64) + " " + strconv.FormatInt(now.UnixNano(), 10))
+		ttl := l.after(l.burst()-tokens) + time.Millisecond
+		var stored bool
+		if ok {
+			stored, err = s.client.CompareAndSwap(ctx, key, b, cas, ttl)
+		} else {
+			stored, err = s.client.Add(ctx, key, b, ttl)
+		}
+		if err != nil {
+			return Status{}, err
+		}
+		if stored {
+			return newStatus(l, tokens, allowed), nil
+		}
+	}
+	return Status{}, errContention
+}
+
+// parseMemcacheBucket parses a bucket stored as its number of tokens and the
+// time of its last update in nanoseconds, separated by a space.
+func parseMemcacheBucket(v []byte) (tokens float64, updated time.Time, err error) {
+	f := strings.Fields(string(v))
+	if len(f) != 2 {
+		return 0, time.Time{}, fmt.Errorf("ratelimit: unexpected Memcached value %q", v)
+	}
+	tokens, err = strconv.ParseFloat(f[0], 64)
+	if err != nil {
+		return 0, time.Time{}, fmt.Errorf("ratelimit: unexpected Memcached value %q: %v", v, err)
+	}
+	ns, err := strconv.ParseInt(f[1], 10, 64)
+	if err != nil {
+		return 0, time.Time{}, fmt.Errorf("ratelimit: unexpected Memcached value %q: %v", v, err)
+	}
+	return tokens, time.Unix(0, ns), nil
+}
@@ -0,0 +1,144 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ratelimit_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-safeweb/safehttp/plugins/ratelimit"
+)
+
+type memcacheItem struct {
+	value []byte
+	cas   uint64
+	ttl   time.Duration
+}
+
+type fakeMemcache struct {
+	items map[string]*memcacheItem
+	cas   uint64
+	// conflicts is the number of compare-and-swap operations to fail, as if
+	// another server updated the item.
+	conflicts int
+}
+
+func (f *fakeMemcache) Get(ctx context.Context, key string) ([]byte, uint64, bool, error) {
+	it, ok := f.items[key]
+	if !ok {
+		return nil, 0, false, nil
+	}
+	return it.value, it.cas, true, nil
+}
+
+func (f *fakeMemcache) Add(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error) {
+	if _, ok := f.items[key]; ok {
+		return false, nil
+	}
+	f.cas++
+	f.items[key] = &memcacheItem{value: value, cas: f.cas, ttl: ttl}
+	return true, nil
+}
+
+func (f *fakeMemcache) CompareAndSwap(ctx context.Context, key string, value []byte, cas uint64, ttl time.Duration) (bool, error) {
+	it, ok := f.items[key]
+	if f.conflicts > 0 {
+		f.conflicts--
+		return false, nil
+	}
+	if !ok || it.cas != cas {
+		return false, nil
+	}
+	f.cas++
+	f.items[key] = &memcacheItem{value: value, cas: f.cas, ttl: ttl}
+	return true, nil
+}
+
+func TestMemcacheStore(t *testing.T) {
+	c := &fakeMemcache{items: map[string]*memcacheItem{}}
+	s := ratelimit.NewMemcacheStore(c, "ratelimit:")
+	l := ratelimit.Limit{Rate: 1, Per: time.Second, Burst: 2}
+	now := time.Unix(1600000000, 0)
+	ctx := context.Background()
+
+	var got []ratelimit.Status
+	for i := 0; i < 3; i++ {
+		st, err := s.Take(ctx, "ip:192.0.2.1", l, now)
+		if err != nil {
+			t.Fatalf("s.Take() got err: %v", err)
+		}
+		got = append(got, st)
+	}
+	want := []ratelimit.Status{
+		{Allowed: true, Limit: 2, Remaining: 1, Reset: time.Second},
+		{Allowed: true, Limit: 2, Remaining: 0, Reset: 2 * time.Second},
+		{Allowed: false, Limit: 2, Remaining: 0, Reset: 2 * time.Second, RetryAfter: time.Second},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("s.Take() mismatch (-want +got):\n%s", diff)
+	}
+	it, ok := c.items["ratelimit:ip:192.0.2.1"]
+	if !ok {
+		t.Fatal("bucket not stored under the prefixed key")
+	}
+	if want := 2*time.Second + time.Millisecond; it.ttl != want {
+		t.Errorf("TTL: got %v, want %v", it.ttl, want)
+	}
+
+	st, err := s.Take(ctx, "ip:192.0.2.1", l, now.Add(time.Second))
+	if err != nil {
+		t.Fatalf("s.Take() got err: %v", err)
+	}
+	if !st.Allowed {
+		t.Error("s.Take() after the refill: got not allowed, want allowed")
+	}
+}
+
+func TestMemcacheStoreConflicts(t *testing.T) {
+	c := &fakeMemcache{items: map[string]*memcacheItem{}}
+	s := ratelimit.NewMemcacheStore(c, "")
+	l := ratelimit.Limit{Rate: 1, Per: time.Second, Burst: 5}
+	now := time.Unix(1600000000, 0)
+	ctx := context.Background()
+	if _, err := s.Take(ctx, "k", l, now); err != nil {
+		t.Fatalf("s.Take() got err: %v", err)
+	}
+
+	c.conflicts = 3
+	st, err := s.Take(ctx, "k", l, now)
+	if err != nil {
+		t.Fatalf("s.Take() with conflicts got err: %v", err)
+	}
+	if st.Remaining != 3 {
+		t.Errorf("s.Take() with conflicts: got %d remaining, want 3", st.Remaining)
+	}
+
+	c.conflicts = 100
+	if _, err := s.Take(ctx, "k", l, now); err == nil {
+		t.Error("s.Take() with persistent conflicts got nil err, want error")
+	}
+}
+
+func TestMemcacheStoreUnexpectedValue(t *testing.T) {
+	for _, v := range []string{"", "1", "x 1", "1 x", "1 2 3"} {
+		c := &fakeMemcache{items: map[string]*memcacheItem{"k": {value: []byte(v)}}}
+		s := ratelimit.NewMemcacheStore(c, "")
+		if _, err := s.Take(context.Background(), "k", ratelimit.Limit{Rate: 1, Per: time.Second}, time.Now()); err == nil {
+			t.Errorf("s.Take() with value %q got nil err, want error", v)
+		}
+	}
+}
@@ -0,0 +1,319 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package ratelimit provides a safehttp.Interceptor limiting the rate of
+// requests with token buckets, keyed by client IP, session or any other
+// property of the requests.
+//
+// The state of the limits is reported to clients with the RateLimit-Limit,
+// RateLimit-Remaining and RateLimit-Reset headers, and rejected requests get
+// a Retry-After header. The quota package sets the same headers: if both
+// Interceptors are installed, the headers report the most restrictive of
+// their limits.
+//
+// More info:
+//   - https://datatracker.ietf.org/doc/draft-ietf-httpapi-ratelimit-headers/
+//
+// # Usage
+//
+// Install an Interceptor using safehttp.ServeMuxConfig.Intercept with a Store
+// keeping the buckets. Use a RedisStore or a MemcacheStore to share them
+// between servers:
+//
+//	cfg.TrustProxies(safehttp.TrustedProxies{Networks: lb})
+//	cfg.Intercept(ratelimit.Interceptor{
+//		Store: ratelimit.NewMemoryStore(nil),
+//		Key:   ratelimit.ByClientIP,
+//		Limit: ratelimit.Limit{Rate: 10, Per: time.Second, Burst: 50},
+//	})
+//
+// Handlers needing another limit, e.g. a login form, can be configured with an
+// Overrider. They get buckets of their own:
+//
+//	mux.Handle("/login", safehttp.MethodPost, login, ratelimit.Override("brute forcing", ratelimit.Limit{Rate: 5, Per: time.Minute}))
+package ratelimit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/google/go-safeweb/safehttp"
+	"github.com/google/go-safeweb/safehttp/plugins/internal/ratelimitheaders"
+)
+
+// Limit is a token bucket: requests take a token from the bucket, which is
+// refilled with Rate tokens every Per, up to Burst tokens.
+type Limit struct {
+	// Rate is the number of tokens added to the bucket every Per.
+	Rate int64
+	// Per is the period of Rate, e.g. time.Second.
+	Per time.Duration
+	// Burst is the capacity of the bucket, i.e. the number of requests which
+	// can be made at once. If zero, it's Rate.
+	Burst int64
+}
+
+func (l Limit) burst() float64 {
+	if l.Burst <= 0 {
+		return float64(l.Rate)
+	}
+	return float64(l.Burst)
+}
+
+// refill returns the number of tokens of a bucket which had the given number
+// of tokens elapsed ago.
+func (l Limit) refill(tokens float64, elapsed time.Duration) float64 {
+	if elapsed > 0 {
+		tokens += float64(l.Rate) * float64(elapsed) / float64(l.Per)
+	}
+	return math.Min(tokens, l.burst())
+}
+
+// after returns the time it takes to add n tokens to a bucket.
+func (l Limit) after(n float64) time.Duration {
+	if n <= 0 {
+		return 0
+	}
+	return time.Duration(math.Ceil(n * float64(l.Per) / float64(l.Rate)))
+}
+
+// Status is the state of a bucket after a request.
+type Status struct {
+	// Allowed reports whether the request got a token.
+	Allowed bool
+	// Limit is the capacity of the bucket.
+	Limit int64
+	// Remaining is the number of whole tokens left in the bucket.
+	Remaining int64
+	// Reset is the time it takes for the bucket to be full again.
+	Reset time.Duration
+	// RetryAfter is the time it takes for the next token to be available,
+	// if the request wasn't allowed.
+	RetryAfter time.Duration
+}
+
+func newStatus(l Limit, tokens float64, allowed bool) Status {
+	s := Status{
+		Allowed:   allowed,
+		Limit:     int64(l.burst()),
+		Remaining: int64(tokens),
+		Reset:     l.after(l.burst() - tokens),
+	}
+	if !allowed {
+		s.RetryAfter = l.after(1 - tokens)
+	}
+	return s
+}
+
+// Store stores the token buckets. Implementations must be safe for concurrent
+// use. To share limits between servers, use a Store backed by a shared
+// database, like RedisStore or MemcacheStore.
+type Store interface {
+	// Take atomically refills the bucket identified by key according to l, as
+	// of now, and takes a token from it if one is available. Buckets which
+	// don't exist are full.
+	Take(ctx context.Context, key string, l Limit, now time.Time) (Status, error)
+}
+
+type memoryBucket struct {
+	tokens  float64
+	updated time.Time
+	full    time.Time
+}
+
+// MemoryStore is a Store keeping the buckets in memory, for servers running
+// as a single instance.
+type MemoryStore struct {
+	clock safehttp.Clock
+
+	mu        sync.Mutex
+	buckets   map[string]*memoryBucket
+	nextSweep time.Time
+}
+
+var _ Store = (*MemoryStore)(nil)
+
+// NewMemoryStore creates an empty MemoryStore. If clock is nil, the system
+// clock is used.
+func NewMemoryStore(clock safehttp.Clock) *MemoryStore {
+	if clock == nil {
+		clock = safehttp.SystemClock()
+	}
+	return &MemoryStore{clock: clock, buckets: map[string]*memoryBucket{}}
+}
+
+// Take takes a token from the bucket identified by key.
+func (s *MemoryStore) Take(_ context.Context, key string, l Limit, now time.Time) (Status, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sweep()
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &memoryBucket{tokens: l.burst(), updated: now}
+		s.buckets[key] = b
+	}
+	b.tokens = l.refill(b.tokens, now.Sub(b.updated))
+	b.updated = now
+	allowed := b.tokens >= 1
+	if allowed {
+		b.tokens--
+	}
+	b.full = now.Add(l.after(l.burst() - b.tokens))
+	return newStatus(l, b.tokens, allowed), nil
+}
+
+// sweep drops the buckets which are full again, at most once a minute, as
+// they are equivalent to missing ones.
+func (s *MemoryStore) sweep() {
+	now := s.clock.Now()
+	if now.Before(s.nextSweep) {
+		return
+	}
+	s.nextSweep = now.Add(time.Minute)
+	for k, b := range s.buckets {
+		if now.After(b.full) {
+			delete(s.buckets, k)
+		}
+	}
+}
+
+// ByClientIP keys requests by the address of their client, see
+// safehttp.IncomingRequest.ClientIP. Configure the trusted proxies of the
+// ServeMux if the server is behind a load balancer, otherwise all the
+// requests are keyed by the address of the load balancer.
+func ByClientIP(r *safehttp.IncomingRequest) string {
+	ip := r.ClientIP()
+	if ip == nil {
+		return ""
+	}
+	return "ip:" + ip.String()
+}
+
+// ByCookie returns a key function keying requests by the value of the named
+// cookie, e.g. a session cookie. Requests without the cookie are not limited,
+// so combine it with another Interceptor limiting them, e.g. by client IP.
+//
+// The value is hashed, so that credentials aren't stored in the Store.
+func ByCookie(name string) func(r *safehttp.IncomingRequest) string {
+	return func(r *safehttp.IncomingRequest) string {
+		c, err := r.Cookie(name)
+		if err != nil || c.Value() == "" {
+			return ""
+		}
+		sum := sha256.Sum256([]byte(c.Value()))
+		return "cookie:" + name + ":" + hex.EncodeToString(sum[:])
+	}
+}
+
+// Interceptor takes a token from the bucket of every request and rejects the
+// requests finding their bucket empty with 429 Too Many Requests.
+type Interceptor struct {
+	// Store keeps the buckets.
+	Store Store
+	// Key returns the key of the bucket of the request, e.g. ByClientIP.
+	// Requests with an empty key are not limited.
+	Key func(r *safehttp.IncomingRequest) string
+	// Limit is the limit applied to every bucket.
+	Limit Limit
+	// Clock is used to refill the buckets. If nil, the system clock is used.
+	Clock safehttp.Clock
+}
+
+var _ safehttp.Interceptor = Interceptor{}
+
+// Before claims the rate limit headers, takes a token from the bucket of the
+// request and sets the headers. If the bucket is empty, a 429 Too Many
+// Requests is written. If the bucket can't be accessed, a 503 Service
+// Unavailable is written.
+func (it Interceptor) Before(w safehttp.ResponseWriter, r *safehttp.IncomingRequest, cfg safehttp.InterceptorConfig) safehttp.Result {
+	ratelimitheaders.Claim(w, r)
+
+	limit, prefix := it.Limit, ""
+	if o, ok := cfg.(Overrider); ok {
+		if o.skip {
+			return safehttp.NotWritten()
+		}
+		// Overridden handlers get buckets of their own, so that their
+		// requests aren't taken into account by the other handlers.
+		limit, prefix = o.limit, r.Pattern()+"|"
+	}
+
+	key := it.Key(r)
+	if key == "" {
+		return safehttp.NotWritten()
+	}
+	clock := it.Clock
+	if clock == nil {
+		clock = safehttp.SystemClock()
+	}
+	s, err := it.Store.Take(r.Context(), prefix+key, limit, clock.Now())
+	if err != nil {
+		log.Printf("ratelimit: taking a token for %q: %v", key, err)
+		return w.WriteError(safehttp.StatusServiceUnavailable)
+	}
+
+	l := ratelimitheaders.Limit{
+		Limit:     s.Limit,
+		Remaining: s.Remaining,
+		Reset:     seconds(s.Reset),
+	}
+	if !s.Allowed {
+		l.Rejected, l.RetryAfter = true, seconds(s.RetryAfter)
+	}
+	ratelimitheaders.Report(r.Context(), l)
+	if !s.Allowed {
+		return w.WriteError(safehttp.StatusTooManyRequests)
+	}
+	return safehttp.NotWritten()
+}
+
+// seconds returns d as a number of seconds, rounded up.
+func seconds(d time.Duration) int64 {
+	return int64((d + time.Second - 1) / time.Second)
+}
+
+// Commit is a no-op, required to satisfy the safehttp.Interceptor interface.
+func (Interceptor) Commit(w safehttp.ResponseHeadersWriter, r *safehttp.IncomingRequest, resp safehttp.Response, _ safehttp.InterceptorConfig) {
+}
+
+// Match recognizes Overriders as rate limit configurations.
+func (Interceptor) Match(cfg safehttp.InterceptorConfig) bool {
+	_, ok := cfg.(Overrider)
+	return ok
+}
+
+// Overrider is a safehttp.InterceptorConfig changing the limit of a specific
+// handler, or disabling it.
+type Overrider struct {
+	limit Limit
+	skip  bool
+}
+
+// Override creates an Overrider applying the given limit instead of the one
+// of the Interceptor. The requests of the handler are counted in buckets of
+// their own.
+func Override(reason string, l Limit) Overrider {
+	return Overrider{limit: l}
+}
+
+// Disable creates an Overrider disabling the rate limiting of a handler, e.g. a
+// health check polled by a load balancer.
+func Disable(reason string) Overrider {
+	return Overrider{skip: true}
+}
@@ -0,0 +1,217 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ratelimit_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-safeweb/safehttp"
+	"github.com/google/go-safeweb/safehttp/plugins/quota"
+	"github.com/google/go-safeweb/safehttp/plugins/ratelimit"
+	"github.com/google/go-safeweb/safehttp/safehttptest"
+)
+
+func TestMemoryStore(t *testing.T) {
+	clock := safehttptest.NewFakeClock(time.Date(2021, time.January, 1, 0, 0, 0, 0, time.UTC))
+	s := ratelimit.NewMemoryStore(clock)
+	ctx := context.Background()
+	l := ratelimit.Limit{Rate: 1, Per: time.Second, Burst: 2}
+
+	var got []ratelimit.Status
+	for i := 0; i < 3; i++ {
+		st, err := s.Take(ctx, "alice", l, clock.Now())
+		if err != nil {
+			t.Fatalf("s.Take() got err: %v", err)
+		}
+		got = append(got, st)
+	}
+	clock.Advance(1500 * time.Millisecond)
+	st, err := s.Take(ctx, "alice", l, clock.Now())
+	if err != nil {
+		t.Fatalf("s.Take() got err: %v", err)
+	}
+	got = append(got, st)
+
+	want := []ratelimit.Status{
+		{Allowed: true, Limit: 2, Remaining: 1, Reset: time.Second},
+		{Allowed: true, Limit: 2, Remaining: 0, Reset: 2 * time.Second},
+		{Allowed: false, Limit: 2, Remaining: 0, Reset: 2 * time.Second, RetryAfter: time.Second},
+		{Allowed: true, Limit: 2, Remaining: 0, Reset: 1500 * time.Millisecond},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("s.Take() mismatch (-want +got):\n%s", diff)
+	}
+
+	if st, _ := s.Take(ctx, "bob", l, clock.Now()); !st.Allowed {
+		t.Error("s.Take() for another key not allowed")
+	}
+}
+
+func newMux(it ratelimit.Interceptor) *safehttp.ServeMux {
+	mc := safehttp.NewServeMuxConfig(nil)
+	mc.Intercept(it)
+	mux := mc.Mux()
+	h := safehttp.HandlerFunc(func(w safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+		return w.Write(safehttp.NoContentResponse{})
+	})
+	mux.Handle("/", safehttp.MethodGet, h)
+	mux.Handle("/login", safehttp.MethodGet, h, ratelimit.Override("brute forcing", ratelimit.Limit{Rate: 1, Per: time.Minute}))
+	mux.Handle("/health", safehttp.MethodGet, h, ratelimit.Disable("polled by the load balancer"))
+	return mux
+}
+
+func get(mux *safehttp.ServeMux, path, remote string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "https://foo.com"+path, nil)
+	req.RemoteAddr = remote
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestInterceptor(t *testing.T) {
+	clock := safehttptest.NewFakeClock(time.Date(2021, time.January, 1, 0, 0, 0, 0, time.UTC))
+	mux := newMux(ratelimit.Interceptor{
+		Store: ratelimit.NewMemoryStore(clock),
+		Key:   ratelimit.ByClientIP,
+		Limit: ratelimit.Limit{Rate: 2, Per: time.Second},
+		Clock: clock,
+	})
+
+	for i := 0; i < 2; i++ {
+		if rr := get(mux, "/", "192.0.2.1:1234"); rr.Code != http.StatusNoContent {
+			t.Fatalf("request %d: got status %d, want %d", i, rr.Code, http.StatusNoContent)
+		}
+	}
+	rr := get(mux, "/", "192.0.2.1:1234")
+	if rr.Code != http.StatusTooManyRequests {
+		t.Errorf("limited request: got status %d, want %d", rr.Code, http.StatusTooManyRequests)
+	}
+	wantHeaders := map[string][]string{
+		"Ratelimit-Limit":     {"2"},
+		"Ratelimit-Remaining": {"0"},
+		"Ratelimit-Reset":     {"1"},
+		"Retry-After":         {"1"},
+	}
+	for k, want := range wantHeaders {
+		if diff := cmp.Diff(want, rr.Header()[k]); diff != "" {
+			t.Errorf("rr.Header()[%q] mismatch (-want +got):\n%s", k, diff)
+		}
+	}
+
+	if rr := get(mux, "/", "192.0.2.2:1234"); rr.Code != http.StatusNoContent {
+		t.Errorf("other client: got status %d, want %d", rr.Code, http.StatusNoContent)
+	}
+	if rr := get(mux, "/health", "192.0.2.1:1234"); rr.Code != http.StatusNoContent {
+		t.Errorf("disabled handler: got status %d, want %d", rr.Code, http.StatusNoContent)
+	}
+
+	// The overridden handler has its own buckets.
+	if rr := get(mux, "/login", "192.0.2.1:1234"); rr.Code != http.StatusNoContent {
+		t.Errorf("first login: got status %d, want %d", rr.Code, http.StatusNoContent)
+	}
+	rr = get(mux, "/login", "192.0.2.1:1234")
+	if rr.Code != http.StatusTooManyRequests {
+		t.Errorf("second login: got status %d, want %d", rr.Code, http.StatusTooManyRequests)
+	}
+	if got, want := rr.Header().Get("Retry-After"), "60"; got != want {
+		t.Errorf("second login Retry-After: got %q, want %q", got, want)
+	}
+
+	clock.Advance(time.Second)
+	if rr := get(mux, "/", "192.0.2.1:1234"); rr.Code != http.StatusNoContent {
+		t.Errorf("after refill: got status %d, want %d", rr.Code, http.StatusNoContent)
+	}
+}
+
+type failingStore struct{}
+
+func (failingStore) Take(context.Context, string, ratelimit.Limit, time.Time) (ratelimit.Status, error) {
+	return ratelimit.Status{}, errors.New("unavailable")
+}
+
+func TestInterceptorStoreError(t *testing.T) {
+	mux := newMux(ratelimit.Interceptor{
+		Store: failingStore{},
+		Key:   ratelimit.ByClientIP,
+		Limit: ratelimit.Limit{Rate: 2, Per: time.Second},
+	})
+	if rr := get(mux, "/", "192.0.2.1:1234"); rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("got status %d, want %d", rr.Code, http.StatusServiceUnavailable)
+	}
+}
+
+func TestByCookie(t *testing.T) {
+	key := ratelimit.ByCookie("SESSION")
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	if got := key(safehttp.NewIncomingRequest(req)); got != "" {
+		t.Errorf("key without cookie: got %q, want empty", got)
+	}
+	req.AddCookie(&http.Cookie{Name: "SESSION", Value: "secret"})
+	got := key(safehttp.NewIncomingRequest(req))
+	if got == "" || got == "cookie:SESSION:secret" {
+		t.Errorf("key with cookie: got %q, want the hash of the value", got)
+	}
+}
+
+func TestInterceptorWithQuota(t *testing.T) {
+	clock := safehttptest.NewFakeClock(time.Date(2021, time.January, 1, 23, 0, 0, 0, time.UTC))
+	mc := safehttp.NewServeMuxConfig(nil)
+	mc.Intercept(quota.Interceptor{
+		Tracker:  quota.NewTracker(quota.NewMemoryStore(clock), clock),
+		Identify: func(r *safehttp.IncomingRequest) string { return "alice" },
+		Quota:    func(string) quota.Quota { return quota.Quota{Limit: 100, Period: quota.Daily} },
+	})
+	mc.Intercept(ratelimit.Interceptor{
+		Store: ratelimit.NewMemoryStore(clock),
+		Key:   ratelimit.ByClientIP,
+		Limit: ratelimit.Limit{Rate: 2, Per: time.Second},
+		Clock: clock,
+	})
+	mux := mc.Mux()
+	mux.Handle("/", safehttp.MethodGet, safehttp.HandlerFunc(func(w safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+		return w.Write(safehttp.NoContentResponse{})
+	}))
+
+	// The quota has more requests left, the burst limit is reported.
+	rr := get(mux, "/", "192.0.2.1:1234")
+	if rr.Code != http.StatusNoContent {
+		t.Fatalf("first request: got status %d, want %d", rr.Code, http.StatusNoContent)
+	}
+	wantHeaders := map[string][]string{
+		"Ratelimit-Limit":       {"2"},
+		"Ratelimit-Remaining":   {"1"},
+		"Ratelimit-Reset":       {"1"},
+		"X-Ratelimit-Remaining": {"1"},
+		"Retry-After":           nil,
+	}
+	for k, want := range wantHeaders {
+		if diff := cmp.Diff(want, rr.Header()[k]); diff != "" {
+			t.Errorf("rr.Header()[%q] mismatch (-want +got):\n%s", k, diff)
+		}
+	}
+
+	get(mux, "/", "192.0.2.1:1234")
+	if rr := get(mux, "/", "192.0.2.1:1234"); rr.Code != http.StatusTooManyRequests {
+		t.Errorf("limited request: got status %d, want %d", rr.Code, http.StatusTooManyRequests)
+	} else if got, want := rr.Header().Get("Retry-After"), "1"; got != want {
+		t.Errorf("limited request Retry-After: got %q, want %q", got, want)
+	}
+}
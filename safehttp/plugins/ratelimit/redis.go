@@ -0,0 +1,104 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// RedisClient runs Lua scripts on a Redis server. It can be implemented on top
+// of any Redis client library, e.g. with go-redis:
+//
+//	func (c client) Eval(ctx context.Context, script string, keys []string, args ...interface{}) (interface{}, error) {
+//		return c.rdb.Eval(ctx, script, keys, args...).Result()
+//	}
+type RedisClient interface {
+	// Eval runs the script with the given keys and arguments, as the EVAL
+	// command, and returns its result.
+	Eval(ctx context.Context, script string, keys []string, args ...interface{}) (interface{}, error)
+}
+
+// takeScript refills the bucket stored as a hash at KEYS[1] and takes a token
+// from it. The arguments are the rate in tokens per millisecond, the burst and
+// the current time in milliseconds. It returns whether a token was taken and
+// the number of tokens left, as a string not to lose its fractional part.
+const takeScript = `
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local b = redis.call('HMGET', KEYS[1], 'tokens', 'updated')
+local tokens = tonumber(b[1]) or burst
+local updated = tonumber(b[2]) or now
+if now > updated then
+	tokens = math.min(burst, tokens + (now - updated) * rate)
+end
+local allowed = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+end
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'updated', now)
+redis.call('PEXPIRE', KEYS[1], math.ceil((burst - tokens) / rate) + 1)
+return {allowed, tostring(tokens)}
+`
+
+// RedisStore is a Store keeping the buckets in Redis, to share them between
+// servers. The buckets expire once they are full again.
+//
+// The current time is given by the servers, so their clocks should be
+// synchronized.
+type RedisStore struct {
+	client RedisClient
+	prefix string
+}
+
+var _ Store = (*RedisStore)(nil)
+
+// NewRedisStore creates a RedisStore storing the buckets under keys starting
+// with prefix, e.g. "ratelimit:".
+func NewRedisStore(client RedisClient, prefix string) *RedisStore {
+	return &RedisStore{client: client, prefix: prefix}
+}
+
+// Take takes a token from the bucket identified by key.
+func (s *RedisStore) Take(ctx context.Context, key string, l Limit, now time.Time) (Status, error) {
+	rate := float64(l.Rate) / (float64(l.Per) / float64(time.Millisecond))
+	ms := now.UnixNano() / int64(time.Millisecond)
+	res, err := s.client.Eval(ctx, takeScript, []string{s.prefix + key},
+		strconv.FormatFloat(rate, 'g', -1, 64), strconv.FormatFloat(l.burst(), 'g', -1, 64), ms)
+	if err != nil {
+		return Status{}, err
+	}
+	vals, ok := res.([]interface{})
+	if !ok || len(vals) != 2 {
+		return Status{}, fmt.Errorf("ratelimit: unexpected Redis result %v", res)
+	}
+	allowed, ok := vals[0].(int64)
+	if !ok {
+		return Status{}, fmt.Errorf("ratelimit: unexpected Redis result %v", res)
+	}
+	str, ok := vals[1].(string)
+	if !ok {
+		return Status{}, fmt.Errorf("ratelimit: unexpected Redis result %v", res)
+	}
+	tokens, err := strconv.ParseFloat(str, 64)
+	if err != nil {
+		return Status{}, fmt.Errorf("ratelimit: unexpected Redis result %v: %v", res, err)
+	}
+	return newStatus(l, tokens, allowed == 1), nil
+}
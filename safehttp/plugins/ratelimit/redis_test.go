@@ -0,0 +1,66 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ratelimit_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-safeweb/safehttp/plugins/ratelimit"
+)
+
+type fakeRedis struct {
+	keys   []string
+	args   []interface{}
+	result interface{}
+}
+
+func (f *fakeRedis) Eval(ctx context.Context, script string, keys []string, args ...interface{}) (interface{}, error) {
+	f.keys, f.args = keys, args
+	return f.result, nil
+}
+
+func TestRedisStore(t *testing.T) {
+	c := &fakeRedis{result: []interface{}{int64(1), "2.5"}}
+	s := ratelimit.NewRedisStore(c, "ratelimit:")
+	l := ratelimit.Limit{Rate: 5, Per: time.Second, Burst: 10}
+	now := time.Unix(1600000000, 0)
+
+	got, err := s.Take(context.Background(), "ip:192.0.2.1", l, now)
+	if err != nil {
+		t.Fatalf("s.Take() got err: %v", err)
+	}
+	want := ratelimit.Status{Allowed: true, Limit: 10, Remaining: 2, Reset: 1500 * time.Millisecond}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("s.Take() mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"ratelimit:ip:192.0.2.1"}, c.keys); diff != "" {
+		t.Errorf("keys mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]interface{}{"0.005", "10", int64(1600000000000)}, c.args); diff != "" {
+		t.Errorf("args mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestRedisStoreUnexpectedResult(t *testing.T) {
+	for _, res := range []interface{}{nil, []interface{}{int64(1)}, []interface{}{"1", "2"}, []interface{}{int64(1), "nan?"}} {
+		s := ratelimit.NewRedisStore(&fakeRedis{result: res}, "")
+		if _, err := s.Take(context.Background(), "k", ratelimit.Limit{Rate: 1, Per: time.Second}, time.Now()); err == nil {
+			t.Errorf("s.Take() with result %v got nil err, want error", res)
+		}
+	}
+}
@@ -13,7 +13,9 @@
 // limitations under the License.
 
 // Package reportingapi is an implementation of the Report-To header described
-// in https://www.w3.org/TR/reporting/#header.
+// in https://www.w3.org/TR/reporting/#header, and of its successor, the
+// Reporting-Endpoints header described in
+// https://w3c.github.io/reporting/#header.
 //
 // It allows for setting reporting groups to use in conjuction with COOP and CSP.
 package reportingapi
@@ -21,6 +23,7 @@ package reportingapi
 import (
 	"encoding/json"
 	"fmt"
+	"strings"
 
 	"github.com/google/go-safeweb/safehttp"
 )
@@ -33,6 +36,9 @@ const DefaultMaxAge = 7 * 24 * 60 * 60
 // ReportToHeaderKey is the HTTP header key for the Reporting API.
 const ReportToHeaderKey = "Report-To"
 
+// ReportingEndpointsHeaderKey is the HTTP header key for the Reporting API v1.
+const ReportingEndpointsHeaderKey = "Reporting-Endpoints"
+
 // Endpoint is the Go representation of the endpoints values as specified
 // in https://www.w3.org/TR/reporting/#endpoints-member
 type Endpoint struct {
@@ -75,14 +81,25 @@ func NewGroup(name string, url string, otherUrls ...string) Group {
 	}
 }
 
-// Interceptor is the interceptor for the Report-To header.
+// Interceptor is the interceptor for the Report-To and Reporting-Endpoints
+// headers.
 type Interceptor struct {
-	values []string
+	values    []string
+	endpoints string
 }
 
 // NewInterceptor instantiates a new Interceptor for the given groups.
+//
+// Browsers only supporting the Reporting API v1 get the groups through the
+// Reporting-Endpoints header, which allows a single endpoint per group: the
+// first endpoint of each group is used. As the header is a structured field,
+// groups whose name isn't a valid key, i.e. lowercase letters, digits, "_",
+// "-", "." and "*", starting with a lowercase letter or "*", or whose first
+// endpoint URL contains characters other than printable ASCII, are left out
+// of it. They're still sent in the Report-To header.
 func NewInterceptor(groups ...Group) Interceptor {
 	var i Interceptor
+	var endpoints []string
 	for _, r := range groups {
 		buf, err := json.Marshal(r)
 		if err != nil {
@@ -90,15 +107,64 @@ func NewInterceptor(groups ...Group) Interceptor {
 			panic(fmt.Sprintf("marshalling report: %#v, %v", r, err))
 		}
 		i.values = append(i.values, string(buf))
+		if len(r.Endpoints) > 0 {
+			name := r.Name
+			if name == "" {
+				name = "default"
+			}
+			if u, ok := sfString(r.Endpoints[0].URL); ok && isKey(name) {
+				endpoints = append(endpoints, name+"="+u)
+			}
+		}
 	}
+	i.endpoints = strings.Join(endpoints, ", ")
 	return i
 }
 
-// Before adds all the configured Report-To header values as separate headers.
+// isKey reports whether s is a valid structured field key, as defined in
+// https://www.rfc-editor.org/rfc/rfc8941#section-3.1.2.
+func isKey(s string) bool {
+	if s == "" || !(s[0] == '*' || 'a' <= s[0] && s[0] <= 'z') {
+		return false
+	}
+	for i := 1; i < len(s); i++ {
+		c := s[i]
+		if !('a' <= c && c <= 'z' || '0' <= c && c <= '9' || strings.IndexByte("_-.*", c) >= 0) {
+			return false
+		}
+	}
+	return true
+}
+
+// sfString serializes s as a structured field string, as defined in
+// https://www.rfc-editor.org/rfc/rfc8941#section-3.3.3. It reports false if s
+// contains characters other than printable ASCII, which can't be serialized.
+func sfString(s string) (string, bool) {
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c < 0x20 || c > 0x7e {
+			return "", false
+		}
+		if c == '"' || c == '\\' {
+			b.WriteByte('\\')
+		}
+		b.WriteByte(c)
+	}
+	b.WriteByte('"')
+	return b.String(), true
+}
+
+// Before adds all the configured Report-To header values as separate headers,
+// and the Reporting-Endpoints header.
 func (i Interceptor) Before(w safehttp.ResponseWriter, r *safehttp.IncomingRequest, cfg safehttp.InterceptorConfig) safehttp.Result {
 	for _, v := range i.values {
 		w.Header().Add(ReportToHeaderKey, v)
 	}
+	if i.endpoints != "" {
+		w.Header().Add(ReportingEndpointsHeaderKey, i.endpoints)
+	}
 	return safehttp.NotWritten()
 }
 
@@ -73,19 +73,51 @@ func TestJSONTags(t *testing.T) {
 
 func TestBefore(t *testing.T) {
 	var tests = []struct {
-		name string
-		cfg  []reportingapi.Group
-		want []string
+		name          string
+		cfg           []reportingapi.Group
+		want          []string
+		wantEndpoints []string
 	}{
 		{
-			name: "single",
-			cfg:  []reportingapi.Group{reportingapi.NewGroup("test", "https://fuffa.buffa/reporting")},
-			want: []string{`{"group":"test","max_age":604800,"endpoints":[{"url":"https://fuffa.buffa/reporting"}]}`},
+			name:          "single",
+			cfg:           []reportingapi.Group{reportingapi.NewGroup("test", "https://fuffa.buffa/reporting")},
+			want:          []string{`{"group":"test","max_age":604800,"endpoints":[{"url":"https://fuffa.buffa/reporting"}]}`},
+			wantEndpoints: []string{`test="https://fuffa.buffa/reporting"`},
+		},
+		{
+			name:          "multiple endpoints",
+			cfg:           []reportingapi.Group{reportingapi.NewGroup("test", "https://fuffa.buffa/reporting1", "https://fuffa.buffa/reporting2")},
+			want:          []string{`{"group":"test","max_age":604800,"endpoints":[{"url":"https://fuffa.buffa/reporting1"},{"url":"https://fuffa.buffa/reporting2"}]}`},
+			wantEndpoints: []string{`test="https://fuffa.buffa/reporting1"`},
+		},
+		{
+			name:          "default group",
+			cfg:           []reportingapi.Group{reportingapi.NewGroup("", "https://fuffa.buffa/reporting")},
+			want:          []string{`{"max_age":604800,"endpoints":[{"url":"https://fuffa.buffa/reporting"}]}`},
+			wantEndpoints: []string{`default="https://fuffa.buffa/reporting"`},
+		},
+		{
+			name:          "escaped URL",
+			cfg:           []reportingapi.Group{reportingapi.NewGroup("test", `https://fuffa.buffa/"report\ing"`)},
+			want:          []string{`{"group":"test","max_age":604800,"endpoints":[{"url":"https://fuffa.buffa/\"report\\ing\""}]}`},
+			wantEndpoints: []string{`test="https://fuffa.buffa/\"report\\ing\""`},
 		},
 		{
-			name: "multiple endpoints",
-			cfg:  []reportingapi.Group{reportingapi.NewGroup("test", "https://fuffa.buffa/reporting1", "https://fuffa.buffa/reporting2")},
-			want: []string{`{"group":"test","max_age":604800,"endpoints":[{"url":"https://fuffa.buffa/reporting1"},{"url":"https://fuffa.buffa/reporting2"}]}`},
+			name: "invalid for Reporting-Endpoints",
+			cfg: []reportingapi.Group{
+				reportingapi.NewGroup("Test", "https://fuffa.buffa/reporting1"),
+				reportingapi.NewGroup("test", "https://fuffa.buffa/réporting2"),
+				reportingapi.NewGroup("valid", "https://fuffa.buffa/reporting3"),
+			},
+			want: []string{
+				`{"group":"Test","max_age":604800,"endpoints":[{"url":"https://fuffa.buffa/reporting1"}]}`,
+				`{"group":"test","max_age":604800,"endpoints":[{"url":"https://fuffa.buffa/réporting2"}]}`,
+				`{"group":"valid","max_age":604800,"endpoints":[{"url":"https://fuffa.buffa/reporting3"}]}`,
+			},
+			wantEndpoints: []string{`valid="https://fuffa.buffa/reporting3"`},
+		},
+		{
+			name: "none",
 		},
 		{
 			name: "multiple headers",
@@ -97,6 +129,7 @@ func TestBefore(t *testing.T) {
 				`{"group":"test1","max_age":604800,"endpoints":[{"url":"https://fuffa.buffa/reporting1"}]}`,
 				`{"group":"test2","max_age":604800,"endpoints":[{"url":"https://fuffa.buffa/reporting2"}]}`,
 			},
+			wantEndpoints: []string{`test1="https://fuffa.buffa/reporting1", test2="https://fuffa.buffa/reporting2"`},
 		},
 	}
 
@@ -110,6 +143,9 @@ func TestBefore(t *testing.T) {
 			if diff := cmp.Diff(tt.want, got, sortStringSlices); diff != "" {
 				t.Errorf("Report-To headers: -want +got %s", diff)
 			}
+			if diff := cmp.Diff(tt.wantEndpoints, rr.Header().Values("Reporting-Endpoints")); diff != "" {
+				t.Errorf("Reporting-Endpoints headers: -want +got %s", diff)
+			}
 		})
 	}
 }
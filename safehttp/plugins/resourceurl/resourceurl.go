@@ -0,0 +1,126 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package resourceurl provides vetted constructors of safehtml.TrustedResourceURL
+// values, e.g. for the src of scripts and the href of stylesheets, from
+// compile-time constants and validated dynamic segments.
+//
+// Values coming from configuration, like the version of a deployed bundle or
+// the CDN serving it, otherwise push developers to unchecked conversions.
+//
+// # Usage
+//
+//	var cdns = resourceurl.NewHosts("cdn1.example.com", "cdn2.example.com")
+//
+//	func bundleURL(cfg Config) (safehtml.TrustedResourceURL, error) {
+//		return cdns.URL(cfg.CDN, "/app/%{version}/main.js", map[string]string{"version": cfg.Version})
+//	}
+package resourceurl
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/google/safehtml"
+	"github.com/google/safehtml/uncheckedconversions"
+)
+
+// stringConstant is an unexported string type. Users of this package can only
+// pass untyped string constants where it's expected.
+type stringConstant string
+
+// hostPattern matches DNS names, optionally followed by a port.
+var hostPattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]*[a-z0-9])?(\.[a-z0-9]([a-z0-9-]*[a-z0-9])?)*(:[0-9]{1,5})?$`)
+
+// segmentPattern matches the dynamic segments accepted in paths: they can't
+// contain separators or be relative references like "..".
+var segmentPattern = regexp.MustCompile(`^[A-Za-z0-9_-][A-Za-z0-9._-]*$`)
+
+// labelPattern matches the %{label} markers of path formats.
+var labelPattern = regexp.MustCompile(`%\{([A-Za-z0-9_]+)\}`)
+
+// Hosts is an allowlist of the hosts resources can be loaded from, over
+// HTTPS.
+type Hosts struct {
+	hosts map[string]bool
+}
+
+// NewHosts builds an allowlist of hosts, e.g. "cdn.example.com" or
+// "static.example.com:8443". It panics if a host is not a valid DNS name.
+func NewHosts(hosts ...stringConstant) Hosts {
+	h := Hosts{hosts: map[string]bool{}}
+	for _, host := range hosts {
+		s := strings.ToLower(string(host))
+		if !hostPattern.MatchString(s) {
+			panic(fmt.Sprintf("resourceurl: invalid host %q", host))
+		}
+		h.hosts[s] = true
+	}
+	return h
+}
+
+// URL builds the https://host/path URL of a resource. The host, e.g. read
+// from a flag or a configuration file, must be in the allowlist. The path
+// format must start with a '/' and can contain %{label} markers, replaced by
+// the matching args, which can't contain path separators or be "." or "..".
+func (h Hosts) URL(host string, format stringConstant, args map[string]string) (safehtml.TrustedResourceURL, error) {
+	host = strings.ToLower(host)
+	if !h.hosts[host] {
+		return safehtml.TrustedResourceURL{}, fmt.Errorf("resourceurl: host %q is not allowed", host)
+	}
+	path, err := expand(string(format), args)
+	if err != nil {
+		return safehtml.TrustedResourceURL{}, err
+	}
+	return uncheckedconversions.TrustedResourceURLFromStringKnownToSatisfyTypeContract("https://" + host + path), nil
+}
+
+// Path builds a same-origin URL of a resource, like Hosts.URL does.
+func Path(format stringConstant, args map[string]string) (safehtml.TrustedResourceURL, error) {
+	path, err := expand(string(format), args)
+	if err != nil {
+		return safehtml.TrustedResourceURL{}, err
+	}
+	return uncheckedconversions.TrustedResourceURLFromStringKnownToSatisfyTypeContract(path), nil
+}
+
+func expand(format string, args map[string]string) (string, error) {
+	if !strings.HasPrefix(format, "/") || strings.HasPrefix(format, "//") || strings.HasPrefix(format, `/\`) {
+		return "", fmt.Errorf("resourceurl: path %q must start with a single '/'", format)
+	}
+	var err error
+	path := labelPattern.ReplaceAllStringFunc(format, func(m string) string {
+		label := m[2 : len(m)-1]
+		v, ok := args[label]
+		if !ok {
+			err = fmt.Errorf("resourceurl: missing argument %q", label)
+			return ""
+		}
+		if !segmentPattern.MatchString(v) {
+			err = fmt.Errorf("resourceurl: invalid argument %s=%q", label, v)
+			return ""
+		}
+		return url.PathEscape(v)
+	})
+	if err != nil {
+		return "", err
+	}
+	if strings.Contains(path, "%{") {
+		return "", errors.New("resourceurl: malformed %{label} marker")
+	}
+	return path, nil
+}
@@ -0,0 +1,107 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resourceurl_test
+
+import (
+	"testing"
+
+	"github.com/google/go-safeweb/safehttp/plugins/resourceurl"
+)
+
+var cdns = resourceurl.NewHosts("cdn.example.com", "Static.example.com:8443")
+
+func TestHostsURL(t *testing.T) {
+	tests := []struct {
+		name    string
+		host    string
+		version string
+		want    string
+	}{
+		{
+			name:    "Allowed host",
+			host:    "cdn.example.com",
+			version: "1.2.3",
+			want:    "https://cdn.example.com/app/1.2.3/main.js",
+		},
+		{
+			name:    "Allowed host with port",
+			host:    "STATIC.example.com:8443",
+			version: "v2_rc-1",
+			want:    "https://static.example.com:8443/app/v2_rc-1/main.js",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := cdns.URL(tt.host, "/app/%{version}/main.js", map[string]string{"version": tt.version})
+			if err != nil {
+				t.Fatalf("cdns.URL() got err: %v", err)
+			}
+			if got.String() != tt.want {
+				t.Errorf("cdns.URL(): got %q, want %q", got.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestHostsURLRejected(t *testing.T) {
+	tests := []struct {
+		name    string
+		host    string
+		version string
+	}{
+		{name: "Host not allowed", host: "evil.com", version: "1"},
+		{name: "Host with userinfo", host: "evil.com@cdn.example.com", version: "1"},
+		{name: "Path traversal", host: "cdn.example.com", version: ".."},
+		{name: "Path separator", host: "cdn.example.com", version: "1/../../evil"},
+		{name: "Query", host: "cdn.example.com", version: "1?x=y"},
+		{name: "Empty segment", host: "cdn.example.com", version: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, err := cdns.URL(tt.host, "/app/%{version}/main.js", map[string]string{"version": tt.version}); err == nil {
+				t.Errorf("cdns.URL() got %q, want error", got.String())
+			}
+		})
+	}
+}
+
+func TestPath(t *testing.T) {
+	got, err := resourceurl.Path("/static/%{version}/style.css", map[string]string{"version": "42"})
+	if err != nil {
+		t.Fatalf("resourceurl.Path() got err: %v", err)
+	}
+	if want := "/static/42/style.css"; got.String() != want {
+		t.Errorf("resourceurl.Path(): got %q, want %q", got.String(), want)
+	}
+
+	if _, err := resourceurl.Path("//evil.com/x.js", nil); err == nil {
+		t.Error("resourceurl.Path() with a protocol-relative URL got nil err, want error")
+	}
+	if _, err := resourceurl.Path("static/x.js", nil); err == nil {
+		t.Error("resourceurl.Path() with a relative path got nil err, want error")
+	}
+	if _, err := resourceurl.Path("/static/%{version}/style.css", nil); err == nil {
+		t.Error("resourceurl.Path() with a missing argument got nil err, want error")
+	}
+}
+
+func TestNewHostsInvalid(t *testing.T) {
+	defer func() {
+		if r := recover(); r == nil {
+			t.Error("resourceurl.NewHosts() with an invalid host: expected panic")
+		}
+	}()
+	resourceurl.NewHosts("cdn.example.com/path")
+}
@@ -0,0 +1,159 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package routecatalog provides a handler rendering a searchable catalog of
+// the routes of a safehttp.ServeMux, with their documentation and security
+// configuration, to help audits and onboarding.
+//
+// Routes are documented by passing a safehttp.RouteInfo to ServeMux.Handle or
+// to RouteGroup.Configure.
+//
+// # Usage
+//
+//	mux.Handle("/internal/routes", safehttp.MethodGet, routecatalog.Handler(mux),
+//		safehttp.RouteInfo{Owner: "security-team", Description: "Catalog of the routes."})
+//
+// The catalog is searched with the q query parameter, which matches routes
+// containing all of its words, and is returned as JSON with format=json.
+//
+// The catalog reveals the security configuration of the application, so it
+// must only be reachable by its developers, e.g. behind authentication or on
+// an internal port.
+package routecatalog
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/google/go-safeweb/safehttp"
+	"github.com/google/safehtml/template"
+)
+
+// Entry describes a route in the catalog.
+type Entry struct {
+	Method             string   `json:"method"`
+	Pattern            string   `json:"pattern"`
+	Owner              string   `json:"owner,omitempty"`
+	Description        string   `json:"description,omitempty"`
+	DataClassification string   `json:"dataClassification,omitempty"`
+	Interceptors       []string `json:"interceptors,omitempty"`
+	Configs            []string `json:"configs,omitempty"`
+}
+
+// Entries describes the given routes, e.g. the ones returned by
+// safehttp.ServeMux.Routes.
+func Entries(routes []safehttp.Route) []Entry {
+	var entries []Entry
+	for _, r := range routes {
+		e := Entry{
+			Method:             r.Method,
+			Pattern:            r.Pattern,
+			Owner:              r.Info.Owner,
+			Description:        r.Info.Description,
+			DataClassification: r.Info.DataClassification,
+		}
+		for _, it := range r.Interceptors {
+			e.Interceptors = append(e.Interceptors, fmt.Sprintf("%T", it))
+		}
+		for _, c := range r.Configs {
+			e.Configs = append(e.Configs, fmt.Sprintf("%T %+v", c, c))
+		}
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+// Search returns the entries containing all the words of query, ignoring
+// case, in any of their fields. All entries are returned for an empty query.
+func Search(entries []Entry, query string) []Entry {
+	words := strings.Fields(strings.ToLower(query))
+	if len(words) == 0 {
+		return entries
+	}
+	var found []Entry
+	for _, e := range entries {
+		fields := []string{e.Method, e.Pattern, e.Owner, e.Description, e.DataClassification}
+		fields = append(fields, e.Interceptors...)
+		fields = append(fields, e.Configs...)
+		text := strings.ToLower(strings.Join(fields, "\n"))
+		matches := true
+		for _, w := range words {
+			if !strings.Contains(text, w) {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			found = append(found, e)
+		}
+	}
+	return found
+}
+
+var catalogTemplate = template.Must(template.New("catalog").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Route catalog</title>
+<style>
+body { font-family: sans-serif; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; vertical-align: top; }
+ul { margin: 0; padding-left: 16px; }
+</style>
+</head>
+<body>
+<h1>Route catalog</h1>
+<form method="get">
+<input type="search" name="q" value="{{.Query}}" placeholder="Search routes">
+<button type="submit">Search</button>
+</form>
+<p>{{len .Entries}} of {{.Total}} routes</p>
+<table>
+<tr><th>Method</th><th>Pattern</th><th>Owner</th><th>Description</th><th>Data classification</th><th>Interceptors</th><th>Configs</th></tr>
+{{range .Entries}}<tr>
+<td>{{.Method}}</td>
+<td><code>{{.Pattern}}</code></td>
+<td>{{.Owner}}</td>
+<td>{{.Description}}</td>
+<td>{{.DataClassification}}</td>
+<td><ul>{{range .Interceptors}}<li><code>{{.}}</code></li>{{end}}</ul></td>
+<td><ul>{{range .Configs}}<li><code>{{.}}</code></li>{{end}}</ul></td>
+</tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+// Handler returns a handler rendering the catalog of the routes of m, as of
+// the time of each request.
+func Handler(m *safehttp.ServeMux) safehttp.Handler {
+	return safehttp.HandlerFunc(func(w safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+		q, err := r.URL().Query()
+		if err != nil {
+			return w.WriteError(safehttp.StatusBadRequest)
+		}
+		query := q.String("q", "")
+		all := Entries(m.Routes())
+		entries := Search(all, query)
+		if q.String("format", "") == "json" {
+			return w.Write(safehttp.JSONResponse{Data: entries})
+		}
+		return safehttp.ExecuteTemplate(w, catalogTemplate, struct {
+			Query   string
+			Entries []Entry
+			Total   int
+		}{Query: query, Entries: entries, Total: len(all)})
+	})
+}
@@ -0,0 +1,119 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package routecatalog_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-safeweb/safehttp"
+	"github.com/google/go-safeweb/safehttp/plugins/coop"
+	"github.com/google/go-safeweb/safehttp/plugins/routecatalog"
+)
+
+func newMux() *safehttp.ServeMux {
+	cfg := safehttp.NewServeMuxConfig(nil)
+	cfg.Intercept(coop.Default(""))
+	cfg.Group("/admin/").Configure(safehttp.RouteInfo{Owner: "admin-team", DataClassification: "confidential"})
+	mux := cfg.Mux()
+	h := safehttp.HandlerFunc(func(w safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+		return w.Write(safehttp.NoContentResponse{})
+	})
+	mux.Handle("/items", safehttp.MethodGet, h, safehttp.RouteInfo{Owner: "items-team", Description: "Lists the <items>."})
+	mux.Handle("/admin/users", safehttp.MethodPost, h, coop.Override("legacy popups", coop.Policy{Mode: coop.SameOriginAllowPopups}))
+	mux.Handle("/internal/routes", safehttp.MethodGet, routecatalog.Handler(mux))
+	return mux
+}
+
+func TestEntries(t *testing.T) {
+	got := routecatalog.Entries(newMux().Routes())
+	its := []string{"coop.Interceptor"}
+	want := []routecatalog.Entry{
+		{Method: "POST", Pattern: "/admin/users", Owner: "admin-team", DataClassification: "confidential", Interceptors: its,
+			Configs: []string{"coop.Overrider {rep:[] enf:[same-origin-allow-popups]}"}},
+		{Method: "GET", Pattern: "/internal/routes", Interceptors: its},
+		{Method: "GET", Pattern: "/items", Owner: "items-team", Description: "Lists the <items>.", Interceptors: its},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Entries() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestSearch(t *testing.T) {
+	entries := routecatalog.Entries(newMux().Routes())
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{query: "", want: []string{"/admin/users", "/internal/routes", "/items"}},
+		{query: "ADMIN-team", want: []string{"/admin/users"}},
+		{query: "coop popups", want: []string{"/admin/users"}},
+		{query: "get items", want: []string{"/items"}},
+		{query: "items confidential", want: nil},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, e := range routecatalog.Search(entries, tt.query) {
+			got = append(got, e.Pattern)
+		}
+		if diff := cmp.Diff(tt.want, got); diff != "" {
+			t.Errorf("Search(%q) mismatch (-want +got):\n%s", tt.query, diff)
+		}
+	}
+}
+
+func TestHandlerHTML(t *testing.T) {
+	rw := httptest.NewRecorder()
+	newMux().ServeHTTP(rw, httptest.NewRequest(safehttp.MethodGet, "https://example.com/internal/routes?q=%22%3E%3Cscript%3E+items", nil))
+
+	if rw.Code != http.StatusOK {
+		t.Fatalf("status: got %d, want %d", rw.Code, http.StatusOK)
+	}
+	body := rw.Body.String()
+	for _, want := range []string{`value="&#34;&gt;&lt;script&gt; items"`, "0 of 3 routes"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("body doesn't contain %q:\n%s", want, body)
+		}
+	}
+
+	rw = httptest.NewRecorder()
+	newMux().ServeHTTP(rw, httptest.NewRequest(safehttp.MethodGet, "https://example.com/internal/routes?q=items", nil))
+	body = rw.Body.String()
+	for _, want := range []string{"1 of 3 routes", "<code>/items</code>", "Lists the &lt;items&gt;.", "items-team"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("body doesn't contain %q:\n%s", want, body)
+		}
+	}
+}
+
+func TestHandlerJSON(t *testing.T) {
+	rw := httptest.NewRecorder()
+	newMux().ServeHTTP(rw, httptest.NewRequest(safehttp.MethodGet, "https://example.com/internal/routes?q=admin&format=json", nil))
+
+	if rw.Code != http.StatusOK {
+		t.Fatalf("status: got %d, want %d", rw.Code, http.StatusOK)
+	}
+	var got []routecatalog.Entry
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(rw.Body.String(), safehttp.DefaultXSSIPrefix)), &got); err != nil {
+		t.Fatalf("json.Unmarshal: %v", err)
+	}
+	if len(got) != 1 || got[0].Pattern != "/admin/users" || got[0].Owner != "admin-team" {
+		t.Errorf("got %+v, want the entry of /admin/users", got)
+	}
+}
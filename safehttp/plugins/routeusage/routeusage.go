@@ -0,0 +1,255 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package routeusage finds the routes of an application which receive no
+// traffic, so that forgotten, and often risky, endpoints can be retired.
+//
+// Traffic is recorded per route by the Recorder interceptor and can be
+// exported in CSV, e.g. periodically from each instance, to be aggregated
+// over a window of time. Report cross-references the registered routes with
+// the recorded usage, listing the unused routes along with their policy
+// overrides, which deserve the most attention.
+//
+// # Usage
+//
+//	rec := routeusage.NewRecorder(nil)
+//	cfg.Intercept(rec)
+//	// ... later, e.g. from an admin endpoint or a test:
+//	for _, d := range routeusage.Report(mux.Routes(), rec.Usage(), time.Now().Add(-30*24*time.Hour)) {
+//		fmt.Println(d)
+//	}
+package routeusage
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-safeweb/safehttp"
+)
+
+// Usage is the traffic received by a route.
+type Usage struct {
+	Pattern string
+	Method  string
+	// Hits is the number of requests served.
+	Hits int64
+	// LastSeen is the time of the last request.
+	LastSeen time.Time
+}
+
+type routeKey struct {
+	pattern, method string
+}
+
+// Recorder is an interceptor recording the traffic received by each route.
+type Recorder struct {
+	clock safehttp.Clock
+
+	mu    sync.Mutex
+	usage map[routeKey]*Usage
+}
+
+var _ safehttp.Interceptor = (*Recorder)(nil)
+
+// NewRecorder creates a Recorder. If clock is nil, the system clock is used.
+func NewRecorder(clock safehttp.Clock) *Recorder {
+	if clock == nil {
+		clock = safehttp.SystemClock()
+	}
+	return &Recorder{clock: clock, usage: map[routeKey]*Usage{}}
+}
+
+// Before records the request.
+func (rec *Recorder) Before(w safehttp.ResponseWriter, r *safehttp.IncomingRequest, _ safehttp.InterceptorConfig) safehttp.Result {
+	p := r.Pattern()
+	if p == "" {
+		return safehttp.NotWritten()
+	}
+	k := routeKey{pattern: p, method: r.Method()}
+	now := rec.clock.Now()
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	u, ok := rec.usage[k]
+	if !ok {
+		u = &Usage{Pattern: k.pattern, Method: k.method}
+		rec.usage[k] = u
+	}
+	u.Hits++
+	u.LastSeen = now
+	return safehttp.NotWritten()
+}
+
+// Commit is a no-op, required to satisfy the safehttp.Interceptor interface.
+func (*Recorder) Commit(w safehttp.ResponseHeadersWriter, r *safehttp.IncomingRequest, resp safehttp.Response, _ safehttp.InterceptorConfig) {
+}
+
+// Match returns false since there are no supported configurations.
+func (*Recorder) Match(safehttp.InterceptorConfig) bool {
+	return false
+}
+
+// Usage returns the recorded usage, sorted by pattern and method.
+func (rec *Recorder) Usage() []Usage {
+	rec.mu.Lock()
+	var usage []Usage
+	for _, u := range rec.usage {
+		usage = append(usage, *u)
+	}
+	rec.mu.Unlock()
+	sortUsage(usage)
+	return usage
+}
+
+func sortUsage(usage []Usage) {
+	sort.Slice(usage, func(i, j int) bool {
+		if usage[i].Pattern != usage[j].Pattern {
+			return usage[i].Pattern < usage[j].Pattern
+		}
+		return usage[i].Method < usage[j].Method
+	})
+}
+
+// WriteCSV writes the usage as CSV records of pattern, method, hits and last
+// seen time in RFC 3339 format.
+func WriteCSV(w io.Writer, usage []Usage) error {
+	cw := csv.NewWriter(w)
+	for _, u := range usage {
+		cw.Write([]string{u.Pattern, u.Method, strconv.FormatInt(u.Hits, 10), u.LastSeen.UTC().Format(time.RFC3339)})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// ReadCSV reads usage written by WriteCSV. Records for the same route, e.g.
+// from several instances or periods, are merged.
+func ReadCSV(r io.Reader) ([]Usage, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = 4
+	merged := map[routeKey]*Usage{}
+	for {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		hits, err := strconv.ParseInt(rec[2], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid hits %q: %v", rec[2], err)
+		}
+		lastSeen, err := time.Parse(time.RFC3339, rec[3])
+		if err != nil {
+			return nil, fmt.Errorf("invalid last seen time %q: %v", rec[3], err)
+		}
+		k := routeKey{pattern: rec[0], method: rec[1]}
+		u, ok := merged[k]
+		if !ok {
+			u = &Usage{Pattern: k.pattern, Method: k.method}
+			merged[k] = u
+		}
+		u.Hits += hits
+		if lastSeen.After(u.LastSeen) {
+			u.LastSeen = lastSeen
+		}
+	}
+	var usage []Usage
+	for _, u := range merged {
+		usage = append(usage, *u)
+	}
+	sortUsage(usage)
+	return usage, nil
+}
+
+// DeadRoute is a route which received no traffic since the start of the
+// window of a Report.
+type DeadRoute struct {
+	safehttp.Route
+	// LastSeen is the time of the last request received by the route, before
+	// the window, or the zero time if none was recorded.
+	LastSeen time.Time
+}
+
+// String describes the route, its overrides and when it was last used.
+func (d DeadRoute) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %s", d.Method, d.Pattern)
+	if len(d.Configs) > 0 {
+		var cfgs []string
+		for _, c := range d.Configs {
+			cfgs = append(cfgs, fmt.Sprintf("%T", c))
+		}
+		fmt.Fprintf(&b, " [overrides: %s]", strings.Join(cfgs, ", "))
+	}
+	if d.LastSeen.IsZero() {
+		b.WriteString(": never used")
+	} else {
+		fmt.Fprintf(&b, ": last used %s", d.LastSeen.UTC().Format(time.RFC3339))
+	}
+	return b.String()
+}
+
+// ErrNoUsage is returned by Check when no usage was recorded at all, which
+// usually means the usage data is missing rather than that all routes are
+// dead.
+var ErrNoUsage = errors.New("no usage recorded")
+
+// Report returns the routes which weren't used since the given time, sorted
+// by pattern and method, with the routes having overrides first.
+func Report(routes []safehttp.Route, usage []Usage, since time.Time) []DeadRoute {
+	lastSeen := map[routeKey]time.Time{}
+	for _, u := range usage {
+		k := routeKey{pattern: u.Pattern, method: u.Method}
+		if u.Hits > 0 && u.LastSeen.After(lastSeen[k]) {
+			lastSeen[k] = u.LastSeen
+		}
+	}
+	var dead []DeadRoute
+	for _, r := range routes {
+		ls := lastSeen[routeKey{pattern: r.Pattern, method: r.Method}]
+		if !ls.Before(since) {
+			continue
+		}
+		dead = append(dead, DeadRoute{Route: r, LastSeen: ls})
+	}
+	sort.SliceStable(dead, func(i, j int) bool {
+		return len(dead[i].Configs) > 0 && len(dead[j].Configs) == 0
+	})
+	return dead
+}
+
+// Check is like Report, but returns ErrNoUsage if usage is empty, and an
+// error listing the dead routes if any, so that it can be used in tests or
+// release checks.
+func Check(routes []safehttp.Route, usage []Usage, since time.Time) error {
+	if len(usage) == 0 {
+		return ErrNoUsage
+	}
+	dead := Report(routes, usage, since)
+	if len(dead) == 0 {
+		return nil
+	}
+	lines := make([]string, len(dead))
+	for i, d := range dead {
+		lines[i] = "  " + d.String()
+	}
+	return fmt.Errorf("%d routes unused since %s:\n%s", len(dead), since.UTC().Format(time.RFC3339), strings.Join(lines, "\n"))
+}
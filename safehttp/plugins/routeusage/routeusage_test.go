@@ -0,0 +1,119 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package routeusage_test
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-safeweb/safehttp"
+	"github.com/google/go-safeweb/safehttp/plugins/cache"
+	"github.com/google/go-safeweb/safehttp/plugins/routeusage"
+	"github.com/google/go-safeweb/safehttp/safehttptest"
+)
+
+var (
+	start = time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+	ok    = safehttp.HandlerFunc(func(w safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+		return w.Write(safehttp.NoContentResponse{})
+	})
+)
+
+func TestRecorder(t *testing.T) {
+	clock := safehttptest.NewFakeClock(start)
+	rec := routeusage.NewRecorder(clock)
+	cfg := safehttp.NewServeMuxConfig(nil)
+	cfg.Intercept(rec, cache.Interceptor{})
+	mux := cfg.Mux()
+	mux.Handle("/users/{id}", safehttp.MethodGet, ok)
+	mux.Handle("/users/{id}", safehttp.MethodDelete, ok)
+	mux.Handle("/legacy/export", safehttp.MethodGet, ok, cache.Policy{Public: true, MaxAge: time.Hour})
+	mux.Handle("/unused", safehttp.MethodPost, ok)
+
+	for _, path := range []string{"/users/1", "/users/2", "/legacy/export"} {
+		mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "https://foo.com"+path, nil))
+	}
+	clock.Set(start.Add(time.Hour))
+	mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "https://foo.com/users/3", nil))
+
+	wantUsage := []routeusage.Usage{
+		{Pattern: "/legacy/export", Method: "GET", Hits: 1, LastSeen: start},
+		{Pattern: "/users/{id}", Method: "GET", Hits: 3, LastSeen: start.Add(time.Hour)},
+	}
+	usage := rec.Usage()
+	if diff := cmp.Diff(wantUsage, usage); diff != "" {
+		t.Fatalf("rec.Usage() mismatch (-want +got):\n%s", diff)
+	}
+
+	got := routeusage.Report(mux.Routes(), usage, start.Add(time.Minute))
+	var lines []string
+	for _, d := range got {
+		lines = append(lines, d.String())
+	}
+	want := []string{
+		"GET /legacy/export [overrides: cache.Policy]: last used 2020-01-01T00:00:00Z",
+		"POST /unused: never used",
+		"DELETE /users/{id}: never used",
+	}
+	if diff := cmp.Diff(want, lines); diff != "" {
+		t.Errorf("routeusage.Report() mismatch (-want +got):\n%s", diff)
+	}
+
+	err := routeusage.Check(mux.Routes(), usage, start.Add(time.Minute))
+	if err == nil || !strings.Contains(err.Error(), "3 routes unused") {
+		t.Errorf("routeusage.Check() got err: %v, want 3 unused routes", err)
+	}
+	if err := routeusage.Check(mux.Routes(), nil, start); !errors.Is(err, routeusage.ErrNoUsage) {
+		t.Errorf("routeusage.Check() without usage got err: %v, want %v", err, routeusage.ErrNoUsage)
+	}
+}
+
+func TestCSV(t *testing.T) {
+	a := []routeusage.Usage{
+		{Pattern: "/a", Method: "GET", Hits: 2, LastSeen: start},
+		{Pattern: "/b,c", Method: "POST", Hits: 1, LastSeen: start},
+	}
+	b := []routeusage.Usage{
+		{Pattern: "/a", Method: "GET", Hits: 3, LastSeen: start.Add(time.Hour)},
+	}
+	var buf bytes.Buffer
+	if err := routeusage.WriteCSV(&buf, a); err != nil {
+		t.Fatalf("WriteCSV() got err: %v", err)
+	}
+	if err := routeusage.WriteCSV(&buf, b); err != nil {
+		t.Fatalf("WriteCSV() got err: %v", err)
+	}
+	got, err := routeusage.ReadCSV(&buf)
+	if err != nil {
+		t.Fatalf("ReadCSV() got err: %v", err)
+	}
+	want := []routeusage.Usage{
+		{Pattern: "/a", Method: "GET", Hits: 5, LastSeen: start.Add(time.Hour)},
+		{Pattern: "/b,c", Method: "POST", Hits: 1, LastSeen: start},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("ReadCSV() mismatch (-want +got):\n%s", diff)
+	}
+
+	if _, err := routeusage.ReadCSV(strings.NewReader("/a,GET,many,2020-01-01T00:00:00Z\n")); err == nil {
+		t.Error("ReadCSV() with invalid hits got nil err")
+	}
+}
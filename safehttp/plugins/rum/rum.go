@@ -0,0 +1,257 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package rum provides a handler collecting Real User Monitoring beacons, e.g.
+// the Core Web Vitals measured in browsers with the web-vitals library and
+// sent with navigator.sendBeacon.
+//
+// Beacons are JSON objects, or arrays of them, with the fields of the metric
+// objects of web-vitals, the path or URL of the page they were measured on
+// and, optionally, an identifier of the page view generated once per page
+// load:
+//
+//	{"name": "LCP", "value": 2500.5, "rating": "good", "id": "v3-1-2", "navigationType": "navigate", "page": "/home", "pageView": "1f3a9c"}
+//
+// sendBeacon sends strings as text/plain, so both application/json and
+// text/plain bodies are accepted.
+//
+// # Usage
+//
+// Register the handler to receive POST requests, and export the metrics from
+// the sink, e.g. to the histograms of a monitoring system:
+//
+//	mux.Handle("/rum", safehttp.MethodPost, rum.Handler(rum.Options{
+//		SampleRate: 0.1,
+//		Sink: func(r *safehttp.IncomingRequest, m rum.Metric) {
+//			vitals.WithLabelValues(m.Name, m.Page).Observe(m.Value)
+//		},
+//	}))
+//
+// Metrics are sampled by their pageView, so that all the metrics of a sampled
+// page view are collected. The ids of web-vitals identify single metrics:
+// beacons without a pageView are sampled by their id, independently of the
+// other metrics of the page view.
+package rum
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"math"
+	"mime"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/google/go-safeweb/safehttp"
+)
+
+// maxBeaconSize is the maximum size of a beacon, as browsers limit the data
+// sent with sendBeacon to 64KiB.
+const maxBeaconSize = 64 << 10
+
+// Metric is a measurement sent by a browser.
+type Metric struct {
+	// Name is the name of the metric, e.g. "LCP".
+	Name string
+	// Value is the value of the metric, in milliseconds for timings, or
+	// unitless for CLS.
+	Value float64
+	// Rating is "good", "needs-improvement" or "poor", if sent.
+	Rating string
+	// ID identifies the metric, as set by web-vitals. It's unique to the
+	// page view, but differs between its metrics.
+	ID string
+	// PageView identifies the page view the metric was measured in, if sent.
+	PageView string
+	// NavigationType is the type of navigation to the page, e.g. "navigate"
+	// or "back-forward", if sent.
+	NavigationType string
+	// Page is the path of the page the metric was measured on, without its
+	// query and fragment, which could contain personal data.
+	Page string
+}
+
+// DefaultMetrics are the metrics collected when none are configured.
+var DefaultMetrics = []string{"CLS", "FCP", "FID", "INP", "LCP", "TTFB"}
+
+var ratings = map[string]bool{"": true, "good": true, "needs-improvement": true, "poor": true}
+
+// maxFieldLen is the maximum length of the string fields of a Metric.
+const maxFieldLen = 256
+
+// defaultBots matches the user agents of common crawlers and headless
+// browsers.
+var defaultBots = regexp.MustCompile(`(?i)bot|crawl|spider|slurp|headless|lighthouse|phantomjs|puppeteer|playwright|selenium`)
+
+// Options configures the collection of beacons.
+type Options struct {
+	// Sink receives the collected metrics.
+	Sink func(r *safehttp.IncomingRequest, m Metric)
+	// Metrics are the names of the metrics collected, other metrics are
+	// dropped. If empty, DefaultMetrics are collected.
+	Metrics []string
+	// SampleRate is the fraction of page views whose metrics are
+	// collected, between 0 and 1. If zero, all of them are.
+	SampleRate float64
+	// IsBot reports whether a beacon was sent by a bot, whose metrics would
+	// skew the measurements. If nil, the user agent is matched against a list
+	// of common crawlers and headless browsers.
+	IsBot func(r *safehttp.IncomingRequest) bool
+}
+
+type beacon struct {
+	Name           string   `json:"name"`
+	Value          *float64 `json:"value"`
+	Rating         string   `json:"rating"`
+	ID             string   `json:"id"`
+	NavigationType string   `json:"navigationType"`
+	Page           string   `json:"page"`
+	PageView       string   `json:"pageView"`
+}
+
+// Handler builds a safehttp.Handler collecting beacons. Make sure to register
+// it to receive POST requests, other requests are rejected with 405 Method
+// Not Allowed.
+//
+// Malformed beacons are rejected with 400 Bad Request. Otherwise, including
+// when metrics are dropped, 204 No Content is written.
+func Handler(opts Options) safehttp.Handler {
+	names := map[string]bool{}
+	metrics := opts.Metrics
+	if len(metrics) == 0 {
+		metrics = DefaultMetrics
+	}
+	for _, n := range metrics {
+		names[n] = true
+	}
+	isBot := opts.IsBot
+	if isBot == nil {
+		isBot = func(r *safehttp.IncomingRequest) bool {
+			ua := r.Header.Get("User-Agent")
+			return ua == "" || defaultBots.MatchString(ua)
+		}
+	}
+
+	return safehttp.HandlerFunc(func(w safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+		if r.Method() != safehttp.MethodPost {
+			return w.WriteError(safehttp.StatusMethodNotAllowed)
+		}
+		ct, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if err != nil || (ct != "application/json" && ct != "text/plain") {
+			return w.WriteError(safehttp.StatusUnsupportedMediaType)
+		}
+		b, err := ioutil.ReadAll(io.LimitReader(r.Body(), maxBeaconSize+1))
+		if err != nil {
+			return w.WriteError(safehttp.StatusBadRequest)
+		}
+		if len(b) > maxBeaconSize {
+			return w.WriteError(safehttp.StatusRequestEntityTooLarge)
+		}
+
+		beacons, ok := parse(b)
+		if !ok {
+			return w.WriteError(safehttp.StatusBadRequest)
+		}
+		var valid []Metric
+		for _, bc := range beacons {
+			m, ok := validate(bc)
+			if !ok {
+				return w.WriteError(safehttp.StatusBadRequest)
+			}
+			valid = append(valid, m)
+		}
+
+		if isBot(r) {
+			return w.Write(safehttp.NoContentResponse{})
+		}
+		for _, m := range valid {
+			key := m.PageView
+			if key == "" {
+				key = m.ID
+			}
+			if names[m.Name] && sampled(key, opts.SampleRate) {
+				opts.Sink(r, m)
+			}
+		}
+		return w.Write(safehttp.NoContentResponse{})
+	})
+}
+
+// parse parses a beacon or an array of beacons.
+func parse(b []byte) ([]beacon, bool) {
+	b = bytes.TrimSpace(b)
+	if len(b) > 0 && b[0] == '[' {
+		var bs []beacon
+		if err := json.Unmarshal(b, &bs); err != nil {
+			return nil, false
+		}
+		return bs, true
+	}
+	var bc beacon
+	if err := json.Unmarshal(b, &bc); err != nil {
+		return nil, false
+	}
+	return []beacon{bc}, true
+}
+
+func validate(b beacon) (Metric, bool) {
+	if b.Name == "" || b.Value == nil || b.ID == "" {
+		return Metric{}, false
+	}
+	v := *b.Value
+	if math.IsNaN(v) || math.IsInf(v, 0) || v < 0 {
+		return Metric{}, false
+	}
+	for _, s := range []string{b.Name, b.ID, b.NavigationType, b.Page, b.PageView} {
+		if len(s) > maxFieldLen {
+			return Metric{}, false
+		}
+	}
+	if !ratings[b.Rating] {
+		return Metric{}, false
+	}
+	page := ""
+	if b.Page != "" {
+		u, err := url.Parse(b.Page)
+		if err != nil || !strings.HasPrefix(u.Path, "/") {
+			return Metric{}, false
+		}
+		page = u.Path
+	}
+	return Metric{
+		Name:           b.Name,
+		Value:          v,
+		Rating:         b.Rating,
+		ID:             b.ID,
+		NavigationType: b.NavigationType,
+		Page:           page,
+		PageView:       b.PageView,
+	}, true
+}
+
+// sampled reports whether the page view or metric identified by id is
+// sampled.
+func sampled(id string, rate float64) bool {
+	if rate <= 0 || rate >= 1 {
+		return true
+	}
+	// The ids are hashed with SHA-256 so that similar ones, e.g. sequential
+	// ones, are sampled independently.
+	sum := sha256.Sum256([]byte(id))
+	return float64(binary.BigEndian.Uint64(sum[:8]))/math.MaxUint64 < rate
+}
@@ -0,0 +1,169 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rum_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-safeweb/safehttp"
+	"github.com/google/go-safeweb/safehttp/plugins/rum"
+	"github.com/google/go-safeweb/safehttp/safehttptest"
+)
+
+const chrome = "Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/90.0.4430.93 Safari/537.36"
+
+func post(h safehttp.Handler, contentType, userAgent, body string) int {
+	req := safehttptest.NewRequest(safehttp.MethodPost, "/rum", strings.NewReader(body))
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("User-Agent", userAgent)
+	fakeRW, rr := safehttptest.NewFakeResponseWriter()
+	h.ServeHTTP(fakeRW, req)
+	return rr.Code
+}
+
+func TestHandler(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		userAgent   string
+		body        string
+		wantCode    safehttp.StatusCode
+		want        []rum.Metric
+	}{
+		{
+			name:        "single beacon",
+			contentType: "text/plain;charset=UTF-8",
+			userAgent:   chrome,
+			body:        `{"name":"LCP","value":2500.5,"rating":"good","id":"v3-1","navigationType":"navigate","page":"/home?email=a@b.c"}`,
+			wantCode:    safehttp.StatusNoContent,
+			want: []rum.Metric{
+				{Name: "LCP", Value: 2500.5, Rating: "good", ID: "v3-1", NavigationType: "navigate", Page: "/home"},
+			},
+		},
+		{
+			name:        "array with unknown metric",
+			contentType: "application/json",
+			userAgent:   chrome,
+			body:        `[{"name":"CLS","value":0.1,"id":"v3-2"},{"name":"custom","value":1,"id":"v3-2"}]`,
+			wantCode:    safehttp.StatusNoContent,
+			want:        []rum.Metric{{Name: "CLS", Value: 0.1, ID: "v3-2"}},
+		},
+		{
+			name:        "bot",
+			contentType: "application/json",
+			userAgent:   "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)",
+			body:        `{"name":"LCP","value":1,"id":"v3-3"}`,
+			wantCode:    safehttp.StatusNoContent,
+		},
+		{
+			name:        "missing value",
+			contentType: "application/json",
+			userAgent:   chrome,
+			body:        `{"name":"LCP","id":"v3-4"}`,
+			wantCode:    safehttp.StatusBadRequest,
+		},
+		{
+			name:        "negative value",
+			contentType: "application/json",
+			userAgent:   chrome,
+			body:        `{"name":"LCP","value":-1,"id":"v3-4"}`,
+			wantCode:    safehttp.StatusBadRequest,
+		},
+		{
+			name:        "invalid rating",
+			contentType: "application/json",
+			userAgent:   chrome,
+			body:        `{"name":"LCP","value":1,"id":"v3-4","rating":"<script>"}`,
+			wantCode:    safehttp.StatusBadRequest,
+		},
+		{
+			name:        "absolute page",
+			contentType: "application/json",
+			userAgent:   chrome,
+			body:        `{"name":"LCP","value":1,"id":"v3-4","page":"https://foo.com/x?q=1#top"}`,
+			wantCode:    safehttp.StatusNoContent,
+			want:        []rum.Metric{{Name: "LCP", Value: 1, ID: "v3-4", Page: "/x"}},
+		},
+		{
+			name:        "malformed JSON",
+			contentType: "application/json",
+			userAgent:   chrome,
+			body:        `{"name":`,
+			wantCode:    safehttp.StatusBadRequest,
+		},
+		{
+			name:        "unsupported content type",
+			contentType: "application/x-www-form-urlencoded",
+			userAgent:   chrome,
+			body:        `name=LCP`,
+			wantCode:    safehttp.StatusUnsupportedMediaType,
+		},
+		{
+			name:        "too large",
+			contentType: "application/json",
+			userAgent:   chrome,
+			body:        `[` + strings.Repeat(`{"name":"LCP","value":1,"id":"x"},`, 3000) + `]`,
+			wantCode:    safehttp.StatusRequestEntityTooLarge,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []rum.Metric
+			h := rum.Handler(rum.Options{Sink: func(r *safehttp.IncomingRequest, m rum.Metric) {
+				got = append(got, m)
+			}})
+			if code := post(h, tt.contentType, tt.userAgent, tt.body); code != int(tt.wantCode) {
+				t.Errorf("status: got %d, want %d", code, tt.wantCode)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("metrics mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestHandlerMethodNotAllowed(t *testing.T) {
+	h := rum.Handler(rum.Options{Sink: func(*safehttp.IncomingRequest, rum.Metric) {}})
+	fakeRW, rr := safehttptest.NewFakeResponseWriter()
+	h.ServeHTTP(fakeRW, safehttptest.NewRequest(safehttp.MethodGet, "/rum", nil))
+	if got, want := rr.Code, int(safehttp.StatusMethodNotAllowed); got != want {
+		t.Errorf("status: got %d, want %d", got, want)
+	}
+}
+
+func TestHandlerSampling(t *testing.T) {
+	perID := map[string]int{}
+	h := rum.Handler(rum.Options{
+		SampleRate: 0.5,
+		Sink:       func(r *safehttp.IncomingRequest, m rum.Metric) { perID[m.PageView]++ },
+	})
+	for i := 0; i < 200; i++ {
+		body := fmt.Sprintf(`[{"name":"LCP","value":1,"id":"v3-%d-1","pageView":"pv-%d"},{"name":"CLS","value":0,"id":"v3-%d-2","pageView":"pv-%d"}]`, i, i, i, i)
+		if code := post(h, "application/json", chrome, body); code != int(safehttp.StatusNoContent) {
+			t.Fatalf("status: got %d, want %d", code, safehttp.StatusNoContent)
+		}
+	}
+	if n := len(perID); n < 60 || n > 140 {
+		t.Errorf("sampled page views: got %d of 200, want about 100", n)
+	}
+	for id, n := range perID {
+		if n != 2 {
+			t.Errorf("metrics of sampled page view %q: got %d, want 2", id, n)
+		}
+	}
+}
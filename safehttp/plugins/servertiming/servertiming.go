@@ -0,0 +1,265 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package servertiming records how long requests spend in database queries,
+// template renders and other named steps, so that slow steps can be
+// attributed to the routes performing them.
+//
+// The durations are reported with the pattern of the route to a callback and,
+// optionally, to the client in a Server-Timing header as specified by
+// https://www.w3.org/TR/server-timing/.
+//
+// # Usage
+//
+// Install an Interceptor using safehttp.ServeMuxConfig.Intercept and run the
+// queries and renders of the handlers through the helpers of this package.
+// They use the context of the IncomingRequest, so they are bound by its
+// deadline, and they record their durations under the given names:
+//
+//	cfg.Intercept(servertiming.Interceptor{
+//		Report: func(r *safehttp.IncomingRequest, ms []servertiming.Metric) {
+//			for _, m := range ms {
+//				latency.WithLabelValues(r.Pattern(), m.Name).Observe(m.Duration.Seconds())
+//			}
+//		},
+//	})
+//
+//	// In a handler:
+//	rows, err := servertiming.Query(r, db, "db", safesql.New("SELECT ..."), id)
+//
+// Only the work done before the response is committed can be recorded. In
+// particular, the rendering of TemplateResponses by the Dispatcher happens
+// afterwards: use ExecuteTemplate to time renders done in handlers.
+package servertiming
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-safeweb/safehttp"
+	"github.com/google/go-safeweb/safesql"
+)
+
+// TotalMetric is the name of the Metric measuring the time spent in the
+// request from the Before phase of the Interceptor until the response is
+// committed.
+const TotalMetric = "total"
+
+// Metric is the time spent in a named step of a request.
+type Metric struct {
+	// Name identifies the step, e.g. "db". It must be an HTTP token to be
+	// included in the Server-Timing header.
+	Name string
+	// Duration is the total time spent in the step.
+	Duration time.Duration
+	// Count is the number of times the step was recorded.
+	Count int
+}
+
+type (
+	timingsKey struct{}
+	headerKey  struct{}
+)
+
+type timings struct {
+	clock safehttp.Clock
+	start time.Time
+
+	mu      sync.Mutex
+	metrics []Metric
+}
+
+func (t *timings) add(name string, d time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for i := range t.metrics {
+		if t.metrics[i].Name == name {
+			t.metrics[i].Duration += d
+			t.metrics[i].Count++
+			return
+		}
+	}
+	t.metrics = append(t.metrics, Metric{Name: name, Duration: d, Count: 1})
+}
+
+func (t *timings) snapshot() []Metric {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]Metric(nil), t.metrics...)
+}
+
+// Record adds d to the time spent in the named step of the request. It
+// returns an error if the Interceptor is not installed.
+func Record(ctx context.Context, name string, d time.Duration) error {
+	t, ok := safehttp.FlightValues(ctx).Get(timingsKey{}).(*timings)
+	if !ok {
+		return errors.New("servertiming: Interceptor not installed")
+	}
+	t.add(name, d)
+	return nil
+}
+
+// Start starts timing the named step of the request. The returned function
+// stops the timer and records the elapsed time. It's a no-op if the
+// Interceptor is not installed.
+func Start(ctx context.Context, name string) (stop func()) {
+	t, ok := safehttp.FlightValues(ctx).Get(timingsKey{}).(*timings)
+	if !ok {
+		return func() {}
+	}
+	start := t.clock.Now()
+	return func() {
+		t.add(name, t.clock.Now().Sub(start))
+	}
+}
+
+// Queryer is implemented by safesql.DB, safesql.Conn and safesql.Tx.
+type Queryer interface {
+	QueryContext(ctx context.Context, query safesql.TrustedSQLString, args ...interface{}) (*safesql.Rows, error)
+	QueryRowContext(ctx context.Context, query safesql.TrustedSQLString, args ...interface{}) *safesql.Row
+	ExecContext(ctx context.Context, query safesql.TrustedSQLString, args ...interface{}) (safesql.Result, error)
+}
+
+// Query executes a query returning rows using the context of the request,
+// and records the time spent under name. The time spent iterating over the
+// returned rows is not recorded.
+func Query(r *safehttp.IncomingRequest, q Queryer, name string, query safesql.TrustedSQLString, args ...interface{}) (*safesql.Rows, error) {
+	defer Start(r.Context(), name)()
+	return q.QueryContext(r.Context(), query, args...)
+}
+
+// QueryRow executes a query returning at most one row using the context of
+// the request, and records the time spent under name.
+func QueryRow(r *safehttp.IncomingRequest, q Queryer, name string, query safesql.TrustedSQLString, args ...interface{}) *safesql.Row {
+	defer Start(r.Context(), name)()
+	return q.QueryRowContext(r.Context(), query, args...)
+}
+
+// Exec executes a query without returning any rows using the context of the
+// request, and records the time spent under name.
+func Exec(r *safehttp.IncomingRequest, q Queryer, name string, query safesql.TrustedSQLString, args ...interface{}) (safesql.Result, error) {
+	defer Start(r.Context(), name)()
+	return q.ExecContext(r.Context(), query, args...)
+}
+
+// ExecuteTemplate applies the template associated with t that has the given
+// name, or t itself if the name is empty, to data and writes the output to
+// wr. The time spent is recorded under name.
+//
+// The template isn't rendered if the request context is already done, in
+// which case its error is returned.
+func ExecuteTemplate(r *safehttp.IncomingRequest, wr io.Writer, t safehttp.Template, name string, data interface{}) error {
+	if err := r.Context().Err(); err != nil {
+		return err
+	}
+	metric := name
+	if metric == "" {
+		metric = "template"
+	}
+	defer Start(r.Context(), metric)()
+	if name == "" {
+		return t.Execute(wr, data)
+	}
+	return t.ExecuteTemplate(wr, name, data)
+}
+
+// Interceptor collects the durations recorded while handling requests.
+type Interceptor struct {
+	// Report receives the Metrics of each request, including the TotalMetric,
+	// once its response is committed. r.Pattern() can be used to attribute
+	// them to the route.
+	Report func(r *safehttp.IncomingRequest, metrics []Metric)
+	// Header controls whether the Metrics are sent to the client in the
+	// Server-Timing header. As it discloses how requests are processed, this
+	// is best limited to development environments or trusted clients.
+	Header func(r *safehttp.IncomingRequest) bool
+	// Clock is used to measure the durations of requests and of the steps
+	// timed with Start. If nil, the safehttp.SystemClock is used.
+	Clock safehttp.Clock
+}
+
+var _ safehttp.Interceptor = Interceptor{}
+
+func (it Interceptor) clock() safehttp.Clock {
+	if it.Clock == nil {
+		return safehttp.SystemClock()
+	}
+	return it.Clock
+}
+
+// Before starts timing the request and sets up the collection of its
+// Metrics. If the Server-Timing header is enabled, it gets claimed.
+func (it Interceptor) Before(w safehttp.ResponseWriter, r *safehttp.IncomingRequest, _ safehttp.InterceptorConfig) safehttp.Result {
+	clock := it.clock()
+	t := &timings{clock: clock, start: clock.Now()}
+	if it.Header != nil && it.Header(r) {
+		safehttp.FlightValues(r.Context()).Put(headerKey{}, w.Header().Claim("Server-Timing"))
+	}
+	safehttp.FlightValues(r.Context()).Put(timingsKey{}, t)
+	return safehttp.NotWritten()
+}
+
+// Commit reports the Metrics of the request and sets the Server-Timing header
+// if it's enabled.
+func (it Interceptor) Commit(w safehttp.ResponseHeadersWriter, r *safehttp.IncomingRequest, resp safehttp.Response, _ safehttp.InterceptorConfig) {
+	fv := safehttp.FlightValues(r.Context())
+	t, ok := fv.Get(timingsKey{}).(*timings)
+	if !ok {
+		return
+	}
+	metrics := append(t.snapshot(), Metric{Name: TotalMetric, Duration: t.clock.Now().Sub(t.start), Count: 1})
+	if set, ok := fv.Get(headerKey{}).(func([]string)); ok {
+		set([]string{Header(metrics)})
+	}
+	if it.Report != nil {
+		it.Report(r, metrics)
+	}
+}
+
+// Match returns false since there are no supported configurations.
+func (Interceptor) Match(safehttp.InterceptorConfig) bool {
+	return false
+}
+
+// Header serializes metrics as the value of a Server-Timing header, with the
+// durations in milliseconds. Metrics whose names aren't HTTP tokens are
+// skipped.
+func Header(metrics []Metric) string {
+	var parts []string
+	for _, m := range metrics {
+		if !isToken(m.Name) {
+			continue
+		}
+		ms := float64(m.Duration.Round(time.Microsecond)) / float64(time.Millisecond)
+		parts = append(parts, m.Name+";dur="+strconv.FormatFloat(ms, 'f', -1, 64))
+	}
+	return strings.Join(parts, ", ")
+}
+
+func isToken(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if c >= 0x7f || c <= ' ' || strings.ContainsRune("\"(),/:;<=>?@[\\]{}", c) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,177 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package servertiming_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"text/template"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-safeweb/safehttp"
+	"github.com/google/go-safeweb/safehttp/plugins/servertiming"
+	"github.com/google/go-safeweb/safehttp/safehttptest"
+	"github.com/google/go-safeweb/safesql"
+)
+
+type fakeDB struct {
+	ctx context.Context
+}
+
+func (db *fakeDB) QueryContext(ctx context.Context, query safesql.TrustedSQLString, args ...interface{}) (*safesql.Rows, error) {
+	db.ctx = ctx
+	return nil, nil
+}
+
+func (db *fakeDB) QueryRowContext(ctx context.Context, query safesql.TrustedSQLString, args ...interface{}) *safesql.Row {
+	db.ctx = ctx
+	return nil
+}
+
+func (db *fakeDB) ExecContext(ctx context.Context, query safesql.TrustedSQLString, args ...interface{}) (safesql.Result, error) {
+	db.ctx = ctx
+	return nil, nil
+}
+
+func TestInterceptor(t *testing.T) {
+	var (
+		gotPattern string
+		gotMetrics []servertiming.Metric
+	)
+	mc := safehttp.NewServeMuxConfig(nil)
+	mc.Intercept(servertiming.Interceptor{
+		Report: func(r *safehttp.IncomingRequest, ms []servertiming.Metric) {
+			gotPattern = r.Pattern()
+			gotMetrics = ms
+		},
+		Header: func(r *safehttp.IncomingRequest) bool { return r.Header.Get("X-Debug") == "1" },
+	})
+	mux := mc.Mux()
+	db := &fakeDB{}
+	tmpl := template.Must(template.New("page").Parse("hello {{.}}"))
+	mux.Handle("/users/", safehttp.MethodGet, safehttp.HandlerFunc(func(w safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+		servertiming.Query(r, db, "db", safesql.New("SELECT 1"))
+		servertiming.Exec(r, db, "db", safesql.New("SELECT 2"))
+		if db.ctx != r.Context() {
+			t.Error("query not run with the request context")
+		}
+		servertiming.Record(r.Context(), "cache", 1500*time.Microsecond)
+		var b strings.Builder
+		if err := servertiming.ExecuteTemplate(r, &b, tmpl, "", "world"); err != nil {
+			t.Errorf("ExecuteTemplate() got err: %v", err)
+		}
+		if got, want := b.String(), "hello world"; got != want {
+			t.Errorf("rendered template: got %q, want %q", got, want)
+		}
+		return w.Write(safehttp.NoContentResponse{})
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "https://foo.com/users/1", nil)
+	req.Header.Set("X-Debug", "1")
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+
+	if want := "/users/"; gotPattern != want {
+		t.Errorf("reported pattern: got %q, want %q", gotPattern, want)
+	}
+	var names []string
+	for _, m := range gotMetrics {
+		names = append(names, m.Name)
+		if m.Name == "db" && m.Count != 2 {
+			t.Errorf("db count: got %d, want 2", m.Count)
+		}
+	}
+	if got, want := strings.Join(names, ","), "db,cache,template,total"; got != want {
+		t.Errorf("reported metrics: got %q, want %q", got, want)
+	}
+	h := rr.Header().Get("Server-Timing")
+	if !strings.Contains(h, "cache;dur=1.5") || !strings.Contains(h, "total;dur=") {
+		t.Errorf("Server-Timing: got %q, want cache and total metrics", h)
+	}
+
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "https://foo.com/users/1", nil))
+	if h := rr.Header().Get("Server-Timing"); h != "" {
+		t.Errorf("Server-Timing without debug: got %q, want none", h)
+	}
+}
+
+func TestInterceptorClock(t *testing.T) {
+	clock := safehttptest.NewFakeClock(time.Date(2021, time.January, 1, 0, 0, 0, 0, time.UTC))
+	var got []servertiming.Metric
+	mc := safehttp.NewServeMuxConfig(nil)
+	mc.Intercept(servertiming.Interceptor{
+		Report: func(r *safehttp.IncomingRequest, ms []servertiming.Metric) { got = ms },
+		Clock:  clock,
+	})
+	mux := mc.Mux()
+	mux.Handle("/", safehttp.MethodGet, safehttp.HandlerFunc(func(w safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+		clock.Advance(time.Millisecond)
+		stop := servertiming.Start(r.Context(), "db")
+		clock.Advance(5 * time.Millisecond)
+		stop()
+		return w.Write(safehttp.NoContentResponse{})
+	}))
+	mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "https://foo.com/", nil))
+
+	want := []servertiming.Metric{
+		{Name: "db", Duration: 5 * time.Millisecond, Count: 1},
+		{Name: servertiming.TotalMetric, Duration: 6 * time.Millisecond, Count: 1},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("reported metrics mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestExecuteTemplateContextDone(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	r := safehttp.NewIncomingRequest(httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx))
+	tmpl := template.Must(template.New("page").Parse("hello"))
+	var b strings.Builder
+	if err := servertiming.ExecuteTemplate(r, &b, tmpl, "", nil); err != context.Canceled {
+		t.Errorf("ExecuteTemplate() got err: %v, want %v", err, context.Canceled)
+	}
+	if b.Len() != 0 {
+		t.Errorf("rendered %q, want nothing", b.String())
+	}
+}
+
+func TestHeader(t *testing.T) {
+	got := servertiming.Header([]servertiming.Metric{
+		{Name: "db", Duration: 12345678 * time.Nanosecond},
+		{Name: "bad name", Duration: time.Millisecond},
+		{Name: "total", Duration: 20 * time.Millisecond},
+	})
+	if want := "db;dur=12.346, total;dur=20"; got != want {
+		t.Errorf("Header() got %q, want %q", got, want)
+	}
+}
+
+func TestRecordWithoutInterceptor(t *testing.T) {
+	mux := safehttp.NewServeMuxConfig(nil).Mux()
+	mux.Handle("/", safehttp.MethodGet, safehttp.HandlerFunc(func(w safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+		if err := servertiming.Record(r.Context(), "db", time.Second); err == nil {
+			t.Error("servertiming.Record() got nil err, want error")
+		}
+		servertiming.Start(r.Context(), "db")()
+		return w.Write(safehttp.NoContentResponse{})
+	}))
+	mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "https://foo.com/", nil))
+}
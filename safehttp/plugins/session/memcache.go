@@ -0,0 +1,97 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/go-safeweb/safehttp"
+)
+
+// MemcacheClient runs the Memcached commands needed by a MemcacheStore. It can
+// be implemented on top of any Memcached client library, e.g. with gomemcache:
+//
+//	func (c client) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+//		exp := int32((ttl + time.Second - 1) / time.Second)
+//		return c.mc.Set(&memcache.Item{Key: key, Value: value, Expiration: exp})
+//	}
+type MemcacheClient interface {
+	// Get returns the value of key, as the get command, and whether it
+	// exists.
+	Get(ctx context.Context, key string) (value []byte, ok bool, err error)
+	// Set sets the value of key, expiring after ttl, as the set command. As
+	// Memcached expirations are in seconds, ttl should be rounded up.
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	// Delete deletes key, as the delete command. Deleting a missing key
+	// isn't an error.
+	Delete(ctx context.Context, key string) error
+}
+
+// maxMemcacheTTL is the longest relative expiration Memcached supports, longer
+// ones are interpreted as Unix timestamps.
+const maxMemcacheTTL = 30 * 24 * time.Hour
+
+// MemcacheStore is a Store keeping the sessions in Memcached, to share them
+// between servers. Memcached may evict sessions before they expire when it
+// runs out of memory, which logs their users out.
+type MemcacheStore struct {
+	client MemcacheClient
+	prefix string
+	clock  safehttp.Clock
+}
+
+var _ Store = (*MemcacheStore)(nil)
+
+// NewMemcacheStore creates a MemcacheStore storing the sessions under keys
+// starting with prefix, e.g. "session:". If clock is nil, the system clock is
+// used.
+func NewMemcacheStore(client MemcacheClient, prefix string, clock safehttp.Clock) *MemcacheStore {
+	if clock == nil {
+		clock = safehttp.SystemClock()
+	}
+	return &MemcacheStore{client: client, prefix: prefix, clock: clock}
+}
+
+// Load returns the data of the session identified by key.
+func (s *MemcacheStore) Load(ctx context.Context, key string) ([]byte, error) {
+	b, ok, err := s.client.Get(ctx, s.prefix+key)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return b, nil
+}
+
+// Save stores the data of the session identified by key. Sessions expiring
+// in more than 30 days are stored for 30 days, the longest relative
+// expiration supported by Memcached.
+func (s *MemcacheStore) Save(ctx context.Context, key string, data []byte, expires time.Time) error {
+	ttl := expires.Sub(s.clock.Now())
+	if ttl <= 0 {
+		return s.client.Delete(ctx, s.prefix+key)
+	}
+	if ttl > maxMemcacheTTL {
+		ttl = maxMemcacheTTL
+	}
+	return s.client.Set(ctx, s.prefix+key, data, ttl)
+}
+
+// Delete deletes the session identified by key.
+func (s *MemcacheStore) Delete(ctx context.Context, key string) error {
+	return s.client.Delete(ctx, s.prefix+key)
+}
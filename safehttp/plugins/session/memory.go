@@ -0,0 +1,91 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/google/go-safeweb/safehttp"
+)
+
+type memorySession struct {
+	data    []byte
+	expires time.Time
+}
+
+// MemoryStore is a Store keeping the sessions in memory, for servers running
+// as a single instance. Sessions are lost when the server restarts.
+type MemoryStore struct {
+	clock safehttp.Clock
+
+	mu        sync.Mutex
+	sessions  map[string]memorySession
+	nextSweep time.Time
+}
+
+var _ Store = (*MemoryStore)(nil)
+
+// NewMemoryStore creates an empty MemoryStore. If clock is nil, the system
+// clock is used.
+func NewMemoryStore(clock safehttp.Clock) *MemoryStore {
+	if clock == nil {
+		clock = safehttp.SystemClock()
+	}
+	return &MemoryStore{clock: clock, sessions: map[string]memorySession{}}
+}
+
+// Load returns the data of the session identified by key.
+func (s *MemoryStore) Load(_ context.Context, key string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ms, ok := s.sessions[key]
+	if !ok || s.clock.Now().After(ms.expires) {
+		return nil, ErrNotFound
+	}
+	return append([]byte(nil), ms.data...), nil
+}
+
+// Save stores the data of the session identified by key.
+func (s *MemoryStore) Save(_ context.Context, key string, data []byte, expires time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sweep()
+	s.sessions[key] = memorySession{data: append([]byte(nil), data...), expires: expires}
+	return nil
+}
+
+// Delete deletes the session identified by key.
+func (s *MemoryStore) Delete(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.sessions, key)
+	return nil
+}
+
+// sweep drops the expired sessions, at most once a minute.
+func (s *MemoryStore) sweep() {
+	now := s.clock.Now()
+	if now.Before(s.nextSweep) {
+		return
+	}
+	s.nextSweep = now.Add(time.Minute)
+	for k, ms := range s.sessions {
+		if now.After(ms.expires) {
+			delete(s.sessions, k)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/go-safeweb/safehttp"
+)
+
+// RedisClient runs the Redis commands needed by a RedisStore. It can be
+// implemented on top of any Redis client library, e.g. with go-redis:
+//
+//	func (c client) Get(ctx context.Context, key string) ([]byte, bool, error) {
+//		b, err := c.rdb.Get(ctx, key).Bytes()
+//		if err == redis.Nil {
+//			return nil, false, nil
+//		}
+//		return b, err == nil, err
+//	}
+type RedisClient interface {
+	// Get returns the value of key, as the GET command, and whether it
+	// exists.
+	Get(ctx context.Context, key string) (value []byte, ok bool, err error)
+	// Set sets the value of key, expiring after ttl, as the SET command with
+	// the PX option.
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	// Del deletes key, as the DEL command.
+	Del(ctx context.Context, key string) error
+}
+
+// RedisStore is a Store keeping the sessions in Redis, to share them between
+// servers. Redis expires the sessions itself.
+type RedisStore struct {
+	client RedisClient
+	prefix string
+	clock  safehttp.Clock
+}
+
+var _ Store = (*RedisStore)(nil)
+
+// NewRedisStore creates a RedisStore storing the sessions under keys starting
+// with prefix, e.g. "session:". If clock is nil, the system clock is used.
+func NewRedisStore(client RedisClient, prefix string, clock safehttp.Clock) *RedisStore {
+	if clock == nil {
+		clock = safehttp.SystemClock()
+	}
+	return &RedisStore{client: client, prefix: prefix, clock: clock}
+}
+
+// Load returns the data of the session identified by key.
+func (s *RedisStore) Load(ctx context.Context, key string) ([]byte, error) {
+	b, ok, err := s.client.Get(ctx, s.prefix+key)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return b, nil
+}
+
+// Save stores the data of the session identified by key.
+func (s *RedisStore) Save(ctx context.Context, key string, data []byte, expires time.Time) error {
+	ttl := expires.Sub(s.clock.Now())
+	if ttl <= 0 {
+		return s.client.Del(ctx, s.prefix+key)
+	}
+	return s.client.Set(ctx, s.prefix+key, data, ttl)
+}
+
+// Delete deletes the session identified by key.
+func (s *RedisStore) Delete(ctx context.Context, key string) error {
+	return s.client.Del(ctx, s.prefix+key)
+}
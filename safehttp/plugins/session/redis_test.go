@@ -0,0 +1,82 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/go-safeweb/safehttp/plugins/session"
+	"github.com/google/go-safeweb/safehttp/safehttptest"
+)
+
+type fakeRedis struct {
+	values map[string][]byte
+	ttls   map[string]time.Duration
+}
+
+func (f *fakeRedis) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	v, ok := f.values[key]
+	return v, ok, nil
+}
+
+func (f *fakeRedis) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	f.values[key], f.ttls[key] = value, ttl
+	return nil
+}
+
+func (f *fakeRedis) Del(ctx context.Context, key string) error {
+	delete(f.values, key)
+	return nil
+}
+
+func TestRedisStore(t *testing.T) {
+	clock := safehttptest.NewFakeClock(time.Date(2021, time.January, 1, 0, 0, 0, 0, time.UTC))
+	c := &fakeRedis{values: map[string][]byte{}, ttls: map[string]time.Duration{}}
+	s := session.NewRedisStore(c, "session:", clock)
+	ctx := context.Background()
+
+	if err := s.Save(ctx, "k", []byte("v"), clock.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("s.Save() got err: %v", err)
+	}
+	if got, want := c.ttls["session:k"], time.Hour; got != want {
+		t.Errorf("TTL: got %v, want %v", got, want)
+	}
+	got, err := s.Load(ctx, "k")
+	if err != nil {
+		t.Fatalf("s.Load() got err: %v", err)
+	}
+	if string(got) != "v" {
+		t.Errorf("s.Load() got %q, want v", got)
+	}
+
+	if err := s.Delete(ctx, "k"); err != nil {
+		t.Fatalf("s.Delete() got err: %v", err)
+	}
+	if _, err := s.Load(ctx, "k"); !errors.Is(err, session.ErrNotFound) {
+		t.Errorf("s.Load() of a deleted session got err: %v, want ErrNotFound", err)
+	}
+
+	// Sessions saved already expired are deleted.
+	c.values["session:old"] = []byte("v")
+	if err := s.Save(ctx, "old", []byte("v2"), clock.Now().Add(-time.Second)); err != nil {
+		t.Fatalf("s.Save() got err: %v", err)
+	}
+	if _, ok := c.values["session:old"]; ok {
+		t.Error("expired session still stored")
+	}
+}
@@ -0,0 +1,460 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package session provides server-side sessions identified by a cookie.
+//
+// The cookie only holds a random session ID: the values of the sessions are
+// kept in a Store, e.g. a MemoryStore, a SQLStore, a RedisStore or a
+// MemcacheStore. Stores never see the IDs themselves, only their SHA-256
+// hashes, so that the content of a Store can't be used to hijack sessions.
+//
+// Sessions expire after being idle for IdleTimeout and, regardless of their
+// activity, AbsoluteTimeout after being created.
+//
+// # Usage
+//
+// Install an Interceptor using safehttp.ServeMuxConfig.Intercept and access the
+// session of the requests from handlers with Get. Rotate the session ID when
+// the privileges of the user change, e.g. on login, to prevent session
+// fixation:
+//
+//	cfg.Intercept(session.Interceptor{Store: session.NewMemoryStore(nil)})
+//
+//	// In the login handler:
+//	s, err := session.Get(r)
+//	if err != nil {
+//		return w.WriteError(safehttp.StatusInternalServerError)
+//	}
+//	s.Rotate()
+//	s.Set("user", user)
+//	if err := s.Save(r.Context()); err != nil {
+//		return w.WriteError(safehttp.StatusInternalServerError)
+//	}
+//
+// Changes to sessions are otherwise saved when the response is committed,
+// and errors are logged as the response can't be changed anymore.
+//
+// Other plugins can key their state by the session with Identity.
+package session
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/go-safeweb/safehttp"
+	"github.com/google/go-safeweb/safehttp/random"
+)
+
+// ErrNotFound is returned by Stores when a session doesn't exist.
+var ErrNotFound = errors.New("session not found")
+
+// Store stores the sessions. Implementations must be safe for concurrent use.
+// To share sessions between servers, use a Store backed by a shared database.
+type Store interface {
+	// Load returns the data of the session identified by key, or an error
+	// wrapping ErrNotFound if it doesn't exist or has expired.
+	Load(ctx context.Context, key string) ([]byte, error)
+	// Save stores the data of the session identified by key, replacing any
+	// previous data. The session can be dropped after expires.
+	Save(ctx context.Context, key string, data []byte, expires time.Time) error
+	// Delete deletes the session identified by key, if it exists.
+	Delete(ctx context.Context, key string) error
+}
+
+const (
+	// DefaultCookieName is the name of the session cookie used when none is
+	// configured. The __Host- prefix makes browsers reject it unless it's
+	// secure, host-only and valid for all paths.
+	DefaultCookieName = "__Host-SESSION"
+	// DefaultIdleTimeout is the idle timeout used when none is configured.
+	DefaultIdleTimeout = 30 * time.Minute
+	// DefaultAbsoluteTimeout is the absolute timeout used when none is
+	// configured.
+	DefaultAbsoluteTimeout = 12 * time.Hour
+)
+
+// idSize is the size of session IDs in bytes.
+const idSize = 32
+
+// touchInterval is how often the last activity time of sessions whose values
+// didn't change is saved, to bound the number of writes to the Store.
+const touchInterval = time.Minute
+
+// Interceptor manages the sessions of the requests.
+type Interceptor struct {
+	// Store stores the sessions.
+	Store Store
+	// CookieName is the name of the session cookie. If empty,
+	// DefaultCookieName is used.
+	CookieName string
+	// IdleTimeout is how long sessions last without being used. If zero,
+	// DefaultIdleTimeout is used.
+	IdleTimeout time.Duration
+	// AbsoluteTimeout is how long sessions last after being created. If zero,
+	// DefaultAbsoluteTimeout is used.
+	AbsoluteTimeout time.Duration
+	// Clock is used to expire sessions. If nil, the system clock is used.
+	Clock safehttp.Clock
+}
+
+var _ safehttp.Interceptor = Interceptor{}
+
+func (it Interceptor) cookieName() string {
+	if it.CookieName == "" {
+		return DefaultCookieName
+	}
+	return it.CookieName
+}
+
+func (it Interceptor) timeouts() (idle, absolute time.Duration) {
+	idle, absolute = it.IdleTimeout, it.AbsoluteTimeout
+	if idle == 0 {
+		idle = DefaultIdleTimeout
+	}
+	if absolute == 0 {
+		absolute = DefaultAbsoluteTimeout
+	}
+	return idle, absolute
+}
+
+func (it Interceptor) now() time.Time {
+	if it.Clock == nil {
+		return safehttp.SystemClock().Now()
+	}
+	return it.Clock.Now()
+}
+
+type flightKey struct{}
+
+type flight struct {
+	it        Interceptor
+	r         *safehttp.IncomingRequest
+	addCookie func(*safehttp.Cookie) error
+
+	mu      sync.Mutex
+	session *Session
+}
+
+// Before claims the session cookie and sets up the lazy loading of the
+// session of the request.
+func (it Interceptor) Before(w safehttp.ResponseWriter, r *safehttp.IncomingRequest, _ safehttp.InterceptorConfig) safehttp.Result {
+	f := &flight{
+		it:        it,
+		r:         r,
+		addCookie: w.Header().ClaimCookie(it.cookieName(), "session.Interceptor"),
+	}
+	safehttp.FlightValues(r.Context()).Put(flightKey{}, f)
+	return safehttp.NotWritten()
+}
+
+// Commit saves the changes made to the session of the request, if it was
+// accessed, and sets the session cookie if needed.
+func (it Interceptor) Commit(w safehttp.ResponseHeadersWriter, r *safehttp.IncomingRequest, resp safehttp.Response, _ safehttp.InterceptorConfig) {
+	f, ok := safehttp.FlightValues(r.Context()).Get(flightKey{}).(*flight)
+	if !ok {
+		return
+	}
+	f.mu.Lock()
+	s := f.session
+	f.mu.Unlock()
+	if s == nil {
+		return
+	}
+	if err := s.Save(r.Context()); err != nil {
+		log.Printf("session: saving: %v", err)
+	}
+}
+
+// Match returns false since there are no supported configurations.
+func (Interceptor) Match(safehttp.InterceptorConfig) bool {
+	return false
+}
+
+// record is the data of a session kept in the Store.
+type record struct {
+	Values   map[string]string `json:"values"`
+	Created  time.Time         `json:"created"`
+	LastSeen time.Time         `json:"last_seen"`
+}
+
+// Session is the session of a request. It's safe for concurrent use.
+type Session struct {
+	f *flight
+
+	mu  sync.Mutex
+	id  string
+	rec record
+	// stored reports whether the session is in the Store under id.
+	stored bool
+	// clientID is the session ID known by the client, from its cookie or
+	// from the cookie set in the response.
+	clientID string
+	isNew    bool
+	// oldID is the ID of the session before it was rotated or destroyed, if
+	// it was stored.
+	oldID     string
+	dirty     bool
+	destroyed bool
+}
+
+// Get returns the session of the request, loading it from the Store the
+// first time. If the request has no valid session, a new one is returned: it
+// is only stored once a value is set.
+//
+// It returns an error if the Interceptor isn't installed or if the Store
+// fails.
+func Get(r *safehttp.IncomingRequest) (*Session, error) {
+	f, ok := safehttp.FlightValues(r.Context()).Get(flightKey{}).(*flight)
+	if !ok {
+		return nil, errors.New("session: Interceptor not installed")
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.session != nil {
+		return f.session, nil
+	}
+	s, err := f.load()
+	if err != nil {
+		return nil, err
+	}
+	f.session = s
+	return s, nil
+}
+
+func (f *flight) load() (*Session, error) {
+	now := f.it.now()
+	c, err := f.r.Cookie(f.it.cookieName())
+	if err != nil || c.Value() == "" {
+		return f.newSession(now)
+	}
+	data, err := f.it.Store.Load(f.r.Context(), storeKey(c.Value()))
+	if errors.Is(err, ErrNotFound) {
+		return f.newSession(now)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("session: loading: %w", err)
+	}
+	var rec record
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return nil, fmt.Errorf("session: decoding: %v", err)
+	}
+	idle, absolute := f.it.timeouts()
+	if now.Sub(rec.LastSeen) > idle || now.Sub(rec.Created) > absolute {
+		// The Store might keep expired sessions for a while.
+		if err := f.it.Store.Delete(f.r.Context(), storeKey(c.Value())); err != nil {
+			return nil, fmt.Errorf("session: deleting expired session: %w", err)
+		}
+		return f.newSession(now)
+	}
+	if rec.Values == nil {
+		rec.Values = map[string]string{}
+	}
+	return &Session{f: f, id: c.Value(), rec: rec, stored: true, clientID: c.Value()}, nil
+}
+
+func (f *flight) newSession(now time.Time) (*Session, error) {
+	id, err := newID()
+	if err != nil {
+		return nil, err
+	}
+	s := &Session{f: f, id: id, rec: record{Values: map[string]string{}, Created: now, LastSeen: now}, isNew: true}
+	if c, err := f.r.Cookie(f.it.cookieName()); err == nil {
+		// The cookie of an unknown or expired session, to be replaced or
+		// removed.
+		s.clientID = c.Value()
+	}
+	return s, nil
+}
+
+func newID() (string, error) {
+	b, err := random.Bytes(idSize)
+	if err != nil {
+		return "", fmt.Errorf("session: generating ID: %v", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// storeKey returns the key of the session with the given ID in the Store.
+func storeKey(id string) string {
+	sum := sha256.Sum256([]byte(id))
+	return hex.EncodeToString(sum[:])
+}
+
+// IsNew reports whether the session was created by this request.
+func (s *Session) IsNew() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.isNew
+}
+
+// Value returns the value associated with key, or an empty string.
+func (s *Session) Value(key string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.rec.Values[key]
+}
+
+// Set associates value with key.
+func (s *Session) Set(key, value string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rec.Values[key] = value
+	s.dirty = true
+	s.destroyed = false
+}
+
+// Delete deletes the value associated with key.
+func (s *Session) Delete(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.rec.Values[key]; ok {
+		delete(s.rec.Values, key)
+		s.dirty = true
+	}
+}
+
+// Rotate gives the session a new ID, keeping its values, and invalidates the
+// previous one. Call it whenever the privileges of the session change, e.g.
+// on login or logout, so that an ID known by an attacker before the change,
+// e.g. set by them in the browser of the victim, can't be used after it.
+func (s *Session) Rotate() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id, err := newID()
+	if err != nil {
+		return err
+	}
+	if s.stored {
+		s.oldID = s.id
+	}
+	s.id, s.stored, s.dirty = id, false, true
+	return nil
+}
+
+// Destroy deletes the session and its values, e.g. on logout. Setting a value
+// afterwards creates a new session.
+func (s *Session) Destroy() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id, err := newID()
+	if err != nil {
+		return err
+	}
+	if s.stored {
+		s.oldID = s.id
+	}
+	now := s.f.it.now()
+	s.id, s.stored, s.dirty, s.destroyed = id, false, false, true
+	s.rec = record{Values: map[string]string{}, Created: now, LastSeen: now}
+	return nil
+}
+
+// Identity returns an identifier of the session, e.g. to key rate limits or
+// audit logs by session. It isn't the session ID, which it can't be used to
+// recover, and it changes when the session is rotated.
+func (s *Session) Identity() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return storeKey(s.id)
+}
+
+// Identity returns the identifier of the session of the request, see
+// Session.Identity, or an empty string if the request has no stored session
+// or if its session can't be loaded. It can be used as a key function, e.g.
+// for the ratelimit plugin.
+func Identity(r *safehttp.IncomingRequest) string {
+	s, err := Get(r)
+	if err != nil {
+		return ""
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.stored && !s.dirty {
+		return ""
+	}
+	return storeKey(s.id)
+}
+
+// Save saves the changes made to the session and sets the session cookie if
+// needed. It's called when the response is committed: call it explicitly to
+// handle the errors, e.g. after a login.
+func (s *Session) Save(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	store := s.f.it.Store
+	if s.oldID != "" {
+		if err := store.Delete(ctx, storeKey(s.oldID)); err != nil {
+			return fmt.Errorf("session: deleting previous session: %w", err)
+		}
+		s.oldID = ""
+	}
+
+	if s.destroyed && !s.dirty {
+		if s.clientID != "" {
+			// Remove the cookie of the deleted session.
+			c := s.cookie("")
+			c.SetMaxAge(-1)
+			if err := s.f.addCookie(c); err != nil {
+				return fmt.Errorf("session: removing cookie: %v", err)
+			}
+			s.clientID = ""
+		}
+		return nil
+	}
+
+	now := s.f.it.now()
+	if !s.dirty && now.Sub(s.rec.LastSeen) < touchInterval {
+		return nil
+	}
+	if !s.dirty && !s.stored {
+		// New sessions without values aren't stored.
+		return nil
+	}
+	s.rec.LastSeen = now
+	data, err := json.Marshal(s.rec)
+	if err != nil {
+		return fmt.Errorf("session: encoding: %v", err)
+	}
+	idle, absolute := s.f.it.timeouts()
+	expires := now.Add(idle)
+	if end := s.rec.Created.Add(absolute); end.Before(expires) {
+		expires = end
+	}
+	if err := store.Save(ctx, storeKey(s.id), data, expires); err != nil {
+		return fmt.Errorf("session: saving: %w", err)
+	}
+	s.stored, s.dirty = true, false
+
+	if s.clientID != s.id {
+		if err := s.f.addCookie(s.cookie(s.id)); err != nil {
+			return fmt.Errorf("session: setting cookie: %v", err)
+		}
+		s.clientID = s.id
+	}
+	return nil
+}
+
+func (s *Session) cookie(value string) *safehttp.Cookie {
+	c := safehttp.NewCookie(s.f.it.cookieName(), value)
+	c.Path("/")
+	return c
+}
@@ -0,0 +1,198 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-safeweb/safehttp"
+	"github.com/google/go-safeweb/safehttp/plugins/session"
+	"github.com/google/go-safeweb/safehttp/safehttptest"
+)
+
+type testServer struct {
+	t     *testing.T
+	clock *safehttptest.FakeClock
+	store *session.MemoryStore
+	mux   *safehttp.ServeMux
+	// identity is the session.Identity of the last request.
+	identity string
+}
+
+func newTestServer(t *testing.T) *testServer {
+	clock := safehttptest.NewFakeClock(time.Date(2021, time.January, 1, 0, 0, 0, 0, time.UTC))
+	ts := &testServer{t: t, clock: clock, store: session.NewMemoryStore(clock)}
+	mc := safehttp.NewServeMuxConfig(nil)
+	mc.Intercept(session.Interceptor{Store: ts.store, Clock: clock})
+	ts.mux = mc.Mux()
+	ts.mux.Handle("/", safehttp.MethodGet, safehttp.HandlerFunc(func(w safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+		s, err := session.Get(r)
+		if err != nil {
+			t.Fatalf("session.Get() got err: %v", err)
+		}
+		switch r.URL().Path() {
+		case "/login":
+			if err := s.Rotate(); err != nil {
+				t.Fatalf("s.Rotate() got err: %v", err)
+			}
+			q, err := r.URL().Query()
+			if err != nil {
+				t.Fatalf("r.URL().Query() got err: %v", err)
+			}
+			s.Set("user", q.String("user", ""))
+		case "/logout":
+			if err := s.Destroy(); err != nil {
+				t.Fatalf("s.Destroy() got err: %v", err)
+			}
+		}
+		ts.identity = session.Identity(r)
+		return w.Write(safehttp.NoContentResponse{})
+	}))
+	ts.mux.Handle("/whoami", safehttp.MethodGet, safehttp.HandlerFunc(func(w safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+		s, err := session.Get(r)
+		if err != nil {
+			t.Fatalf("session.Get() got err: %v", err)
+		}
+		ts.identity = session.Identity(r)
+		w.Header().Set("User", s.Value("user"))
+		return w.Write(safehttp.NoContentResponse{})
+	}))
+	return ts
+}
+
+// get sends a request with the given session cookie and returns the response
+// and the value of the session cookie it sets, if any.
+func (ts *testServer) get(path, cookie string) (*httptest.ResponseRecorder, *http.Cookie) {
+	req := httptest.NewRequest(http.MethodGet, "https://foo.com"+path, nil)
+	if cookie != "" {
+		req.AddCookie(&http.Cookie{Name: session.DefaultCookieName, Value: cookie})
+	}
+	rr := httptest.NewRecorder()
+	ts.mux.ServeHTTP(rr, req)
+	for _, c := range rr.Result().Cookies() {
+		if c.Name == session.DefaultCookieName {
+			return rr, c
+		}
+	}
+	return rr, nil
+}
+
+func (ts *testServer) whoami(cookie string) string {
+	rr, _ := ts.get("/whoami", cookie)
+	return rr.Header().Get("User")
+}
+
+func TestSessionLifecycle(t *testing.T) {
+	ts := newTestServer(t)
+
+	// Anonymous requests don't get a session cookie.
+	if _, c := ts.get("/", ""); c != nil {
+		t.Fatalf("anonymous request got session cookie %v", c)
+	}
+	if ts.identity != "" {
+		t.Errorf("anonymous identity: got %q, want empty", ts.identity)
+	}
+
+	_, c := ts.get("/login?user=alice", "")
+	if c == nil {
+		t.Fatal("login got no session cookie")
+	}
+	if !c.HttpOnly || c.Path != "/" {
+		t.Errorf("session cookie: got %v, want HttpOnly with path /", c)
+	}
+	id := c.Value
+	loginIdentity := ts.identity
+	if loginIdentity == "" || strings.Contains(loginIdentity, id) {
+		t.Errorf("login identity: got %q, want a value not revealing the session ID", loginIdentity)
+	}
+	if got := ts.whoami(id); got != "alice" {
+		t.Errorf("user: got %q, want alice", got)
+	}
+	if ts.identity != loginIdentity {
+		t.Errorf("identity: got %q, want %q", ts.identity, loginIdentity)
+	}
+
+	// Logging in again rotates the session ID.
+	_, c = ts.get("/login?user=bob", id)
+	if c == nil || c.Value == id {
+		t.Fatalf("second login got cookie %v, want a new session ID", c)
+	}
+	if got := ts.whoami(id); got != "" {
+		t.Errorf("user with the previous session ID: got %q, want none", got)
+	}
+	id = c.Value
+	if got := ts.whoami(id); got != "bob" {
+		t.Errorf("user: got %q, want bob", got)
+	}
+
+	_, c = ts.get("/logout", id)
+	if c == nil || c.MaxAge >= 0 {
+		t.Fatalf("logout got cookie %v, want its removal", c)
+	}
+	if got := ts.whoami(id); got != "" {
+		t.Errorf("user after logout: got %q, want none", got)
+	}
+}
+
+func TestSessionTimeouts(t *testing.T) {
+	ts := newTestServer(t)
+	_, c := ts.get("/login?user=alice", "")
+	id := c.Value
+
+	ts.clock.Advance(session.DefaultIdleTimeout - time.Minute)
+	if got := ts.whoami(id); got != "alice" {
+		t.Fatalf("user before idle timeout: got %q, want alice", got)
+	}
+	// The previous request kept the session alive.
+	ts.clock.Advance(session.DefaultIdleTimeout - time.Minute)
+	if got := ts.whoami(id); got != "alice" {
+		t.Fatalf("user after activity: got %q, want alice", got)
+	}
+	ts.clock.Advance(session.DefaultIdleTimeout + time.Minute)
+	if got := ts.whoami(id); got != "" {
+		t.Errorf("user after idle timeout: got %q, want none", got)
+	}
+
+	_, c = ts.get("/login?user=alice", "")
+	id = c.Value
+	for elapsed := time.Duration(0); elapsed < session.DefaultAbsoluteTimeout-20*time.Minute; elapsed += 20 * time.Minute {
+		ts.clock.Advance(20 * time.Minute)
+		if got := ts.whoami(id); got != "alice" {
+			t.Fatalf("user after %v: got %q, want alice", elapsed, got)
+		}
+	}
+	ts.clock.Advance(21 * time.Minute)
+	if got := ts.whoami(id); got != "" {
+		t.Errorf("user after absolute timeout: got %q, want none", got)
+	}
+}
+
+func TestGetWithoutInterceptor(t *testing.T) {
+	mux := safehttp.NewServeMuxConfig(nil).Mux()
+	mux.Handle("/", safehttp.MethodGet, safehttp.HandlerFunc(func(w safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+		if _, err := session.Get(r); err == nil {
+			t.Error("session.Get() got nil err, want error")
+		}
+		if got := session.Identity(r); got != "" {
+			t.Errorf("session.Identity() got %q, want empty", got)
+		}
+		return w.Write(safehttp.NoContentResponse{})
+	}))
+	mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "https://foo.com/", nil))
+}
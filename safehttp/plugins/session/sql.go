@@ -0,0 +1,138 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/go-safeweb/safehttp"
+	"github.com/google/go-safeweb/safesql"
+)
+
+// Dialect is the SQL dialect of a database.
+type Dialect int
+
+const (
+	// MySQL is the dialect of MySQL and MariaDB.
+	MySQL Dialect = iota
+	// PostgreSQL is the dialect of PostgreSQL.
+	PostgreSQL
+	// SQLite is the dialect of SQLite, version 3.24 or later.
+	SQLite
+)
+
+func (d Dialect) param(i uint64) safesql.TrustedSQLString {
+	if d == PostgreSQL {
+		return safesql.TrustedSQLStringConcat(safesql.New("$"), safesql.NewFromUint64(i))
+	}
+	return safesql.New("?")
+}
+
+// upsert returns the clause turning an insert of the data and expires
+// columns into an update of the existing row.
+func (d Dialect) upsert() safesql.TrustedSQLString {
+	if d == MySQL {
+		return safesql.New(" ON DUPLICATE KEY UPDATE data = VALUES(data), expires = VALUES(expires)")
+	}
+	return safesql.New(" ON CONFLICT (id) DO UPDATE SET data = excluded.data, expires = excluded.expires")
+}
+
+// SQLStore is a Store keeping the sessions in a SQL database, to share them
+// between servers. The table must have the following columns:
+//
+//	id VARCHAR(64) PRIMARY KEY,
+//	data BLOB NOT NULL,      -- BYTEA for PostgreSQL
+//	expires BIGINT NOT NULL  -- Unix time in milliseconds
+//
+// Expired sessions are kept until DeleteExpired is called, e.g. periodically.
+type SQLStore struct {
+	db    safesql.DB
+	clock safehttp.Clock
+
+	load, save, delete, deleteExpired safesql.TrustedSQLString
+}
+
+var _ Store = (*SQLStore)(nil)
+
+// NewSQLStore creates a SQLStore storing the sessions in the given table,
+// using the given SQL dialect. If clock is nil, the system clock is used.
+func NewSQLStore(db safesql.DB, table safesql.TrustedSQLString, d Dialect, clock safehttp.Clock) *SQLStore {
+	if clock == nil {
+		clock = safehttp.SystemClock()
+	}
+	q := safesql.TrustedSQLStringConcat
+	return &SQLStore{
+		db:    db,
+		clock: clock,
+		load: q(safesql.New("SELECT data, expires FROM "), table,
+			safesql.New(" WHERE id = "), d.param(1)),
+		save: q(safesql.New("INSERT INTO "), table,
+			safesql.New(" (data, expires, id) VALUES ("), d.param(1), safesql.New(", "), d.param(2), safesql.New(", "), d.param(3), safesql.New(")"),
+			d.upsert()),
+		delete: q(safesql.New("DELETE FROM "), table,
+			safesql.New(" WHERE id = "), d.param(1)),
+		deleteExpired: q(safesql.New("DELETE FROM "), table,
+			safesql.New(" WHERE expires < "), d.param(1)),
+	}
+}
+
+func unixMilli(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
+
+// Load returns the data of the session identified by key.
+func (s *SQLStore) Load(ctx context.Context, key string) ([]byte, error) {
+	var (
+		data    []byte
+		expires int64
+	)
+	err := s.db.QueryRowContext(ctx, s.load, key).Scan(&data, &expires)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if unixMilli(s.clock.Now()) > expires {
+		return nil, ErrNotFound
+	}
+	return data, nil
+}
+
+// Save stores the data of the session identified by key, inserting it or
+// updating it in a single statement.
+func (s *SQLStore) Save(ctx context.Context, key string, data []byte, expires time.Time) error {
+	_, err := s.db.ExecContext(ctx, s.save, data, unixMilli(expires), key)
+	return err
+}
+
+// Delete deletes the session identified by key.
+func (s *SQLStore) Delete(ctx context.Context, key string) error {
+	_, err := s.db.ExecContext(ctx, s.delete, key)
+	return err
+}
+
+// DeleteExpired deletes the expired sessions and returns how many were
+// deleted.
+func (s *SQLStore) DeleteExpired(ctx context.Context) (int64, error) {
+	res, err := s.db.ExecContext(ctx, s.deleteExpired, unixMilli(s.clock.Now()))
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,219 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session_test
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-safeweb/safehttp/plugins/session"
+	"github.com/google/go-safeweb/safehttp/safehttptest"
+	"github.com/google/go-safeweb/safesql"
+)
+
+// fakeDriver is a database/sql driver understanding the queries of a
+// SQLStore.
+type fakeDriver struct {
+	mu      sync.Mutex
+	rows    map[string]fakeRow
+	queries []string
+}
+
+type fakeRow struct {
+	data    []byte
+	expires int64
+}
+
+func (d *fakeDriver) Open(string) (driver.Conn, error) { return fakeConn{d}, nil }
+
+type fakeConn struct{ d *fakeDriver }
+
+func (c fakeConn) Prepare(query string) (driver.Stmt, error) { return fakeStmt{c.d, query}, nil }
+func (fakeConn) Close() error                                { return nil }
+func (fakeConn) Begin() (driver.Tx, error)                   { return nil, errors.New("not supported") }
+
+type fakeStmt struct {
+	d     *fakeDriver
+	query string
+}
+
+func (fakeStmt) Close() error  { return nil }
+func (fakeStmt) NumInput() int { return -1 }
+
+type fakeResult int64
+
+func (fakeResult) LastInsertId() (int64, error)   { return 0, errors.New("not supported") }
+func (r fakeResult) RowsAffected() (int64, error) { return int64(r), nil }
+
+func (s fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	d := s.d
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.queries = append(d.queries, s.query)
+	switch {
+	case strings.HasPrefix(s.query, "INSERT"):
+		d.rows[args[2].(string)] = fakeRow{args[0].([]byte), args[1].(int64)}
+		return fakeResult(1), nil
+	case strings.Contains(s.query, "WHERE expires"):
+		n := 0
+		for id, r := range d.rows {
+			if r.expires < args[0].(int64) {
+				delete(d.rows, id)
+				n++
+			}
+		}
+		return fakeResult(n), nil
+	case strings.HasPrefix(s.query, "DELETE"):
+		delete(d.rows, args[0].(string))
+		return fakeResult(1), nil
+	}
+	return nil, errors.New("unexpected query " + s.query)
+}
+
+func (s fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	d := s.d
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.queries = append(d.queries, s.query)
+	r, ok := d.rows[args[0].(string)]
+	if !ok {
+		return &fakeRows{}, nil
+	}
+	return &fakeRows{row: []driver.Value{r.data, r.expires}}, nil
+}
+
+type fakeRows struct {
+	row []driver.Value
+}
+
+func (*fakeRows) Columns() []string { return []string{"data", "expires"} }
+func (*fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.row == nil {
+		return io.EOF
+	}
+	copy(dest, r.row)
+	r.row = nil
+	return nil
+}
+
+var fakeDrivers = struct {
+	sync.Mutex
+	n int
+}{}
+
+func openFakeDB(t *testing.T) (safesql.DB, *fakeDriver) {
+	fakeDrivers.Lock()
+	defer fakeDrivers.Unlock()
+	fakeDrivers.n++
+	d := &fakeDriver{rows: map[string]fakeRow{}}
+	name := fmt.Sprintf("sessiontest%d", fakeDrivers.n)
+	safesql.Register(name, d)
+	db, err := safesql.Open(name, "")
+	if err != nil {
+		t.Fatalf("safesql.Open() got err: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db, d
+}
+
+func TestSQLStore(t *testing.T) {
+	clock := safehttptest.NewFakeClock(time.Date(2021, time.January, 1, 0, 0, 0, 0, time.UTC))
+	db, d := openFakeDB(t)
+	s := session.NewSQLStore(db, safesql.New("sessions"), session.PostgreSQL, clock)
+	ctx := context.Background()
+
+	if _, err := s.Load(ctx, "k"); !errors.Is(err, session.ErrNotFound) {
+		t.Errorf("s.Load() of a missing session got err: %v, want ErrNotFound", err)
+	}
+	if err := s.Save(ctx, "k", []byte("v1"), clock.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("s.Save() got err: %v", err)
+	}
+	if err := s.Save(ctx, "k", []byte("v2"), clock.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("s.Save() got err: %v", err)
+	}
+	got, err := s.Load(ctx, "k")
+	if err != nil {
+		t.Fatalf("s.Load() got err: %v", err)
+	}
+	if string(got) != "v2" {
+		t.Errorf("s.Load() got %q, want v2", got)
+	}
+
+	if err := s.Save(ctx, "expiring", []byte("v"), clock.Now().Add(time.Minute)); err != nil {
+		t.Fatalf("s.Save() got err: %v", err)
+	}
+	clock.Advance(2 * time.Minute)
+	if _, err := s.Load(ctx, "expiring"); !errors.Is(err, session.ErrNotFound) {
+		t.Errorf("s.Load() of an expired session got err: %v, want ErrNotFound", err)
+	}
+	if n, err := s.DeleteExpired(ctx); err != nil || n != 1 {
+		t.Errorf("s.DeleteExpired() got %d, %v, want 1, nil", n, err)
+	}
+
+	if err := s.Delete(ctx, "k"); err != nil {
+		t.Fatalf("s.Delete() got err: %v", err)
+	}
+	if _, err := s.Load(ctx, "k"); !errors.Is(err, session.ErrNotFound) {
+		t.Errorf("s.Load() of a deleted session got err: %v, want ErrNotFound", err)
+	}
+
+	wantQueries := []string{
+		"SELECT data, expires FROM sessions WHERE id = $1",
+		"INSERT INTO sessions (data, expires, id) VALUES ($1, $2, $3) ON CONFLICT (id) DO UPDATE SET data = excluded.data, expires = excluded.expires",
+	}
+	if diff := cmp.Diff(wantQueries, d.queries[:2]); diff != "" {
+		t.Errorf("queries mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestSQLStoreDialects(t *testing.T) {
+	tests := []struct {
+		dialect  session.Dialect
+		wantSave string
+	}{
+		{
+			dialect:  session.MySQL,
+			wantSave: "INSERT INTO sessions (data, expires, id) VALUES (?, ?, ?) ON DUPLICATE KEY UPDATE data = VALUES(data), expires = VALUES(expires)",
+		},
+		{
+			dialect:  session.PostgreSQL,
+			wantSave: "INSERT INTO sessions (data, expires, id) VALUES ($1, $2, $3) ON CONFLICT (id) DO UPDATE SET data = excluded.data, expires = excluded.expires",
+		},
+		{
+			dialect:  session.SQLite,
+			wantSave: "INSERT INTO sessions (data, expires, id) VALUES (?, ?, ?) ON CONFLICT (id) DO UPDATE SET data = excluded.data, expires = excluded.expires",
+		},
+	}
+	for _, tt := range tests {
+		db, d := openFakeDB(t)
+		s := session.NewSQLStore(db, safesql.New("sessions"), tt.dialect, nil)
+		if err := s.Save(context.Background(), "k", []byte("v"), time.Now().Add(time.Hour)); err != nil {
+			t.Fatalf("s.Save() got err: %v", err)
+		}
+		if diff := cmp.Diff([]string{tt.wantSave}, d.queries); diff != "" {
+			t.Errorf("dialect %v: queries mismatch (-want +got):\n%s", tt.dialect, diff)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package shadow runs interceptors in shadow mode: their decisions to block
+// requests are reported but not enforced. This allows rolling out new
+// protections, e.g. hostcheck, fetchmetadata or WAF rules, by first measuring
+// which legitimate traffic they would break.
+//
+// # Usage
+//
+//	cfg.Intercept(shadow.New(hostcheck.New("example.com"), func(d shadow.Decision) {
+//		wouldBlock.Inc()
+//		log.Printf("shadow: %v", d)
+//	}))
+package shadow
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/google/go-safeweb/safehttp"
+)
+
+var (
+	_ safehttp.Interceptor = interceptor{}
+	_ safehttp.Finisher    = finisher{}
+)
+
+// Decision is a response an interceptor would have written in its Before
+// phase, which would have blocked the request.
+type Decision struct {
+	// Interceptor is the shadowed interceptor.
+	Interceptor safehttp.Interceptor
+	// Request is the request that would have been blocked.
+	Request *safehttp.IncomingRequest
+	// Response is the response that would have been written: either a
+	// safehttp.ErrorResponse or a response passed to
+	// safehttp.ResponseWriter.Write, e.g. a redirect.
+	Response safehttp.Response
+}
+
+// String describes the decision, e.g.
+// "hostcheck.Interceptor would block GET /admin with 404 Not Found".
+func (d Decision) String() string {
+	r := d.Request
+	if e, ok := d.Response.(safehttp.ErrorResponse); ok {
+		return fmt.Sprintf("%T would block %s %s with %d %s", d.Interceptor, r.Method(), r.URL().Path(), e.Code(), e.Code())
+	}
+	return fmt.Sprintf("%T would block %s %s with %T", d.Interceptor, r.Method(), r.URL().Path(), d.Response)
+}
+
+// interceptor runs another interceptor in shadow mode.
+type interceptor struct {
+	it     safehttp.Interceptor
+	report func(Decision)
+	// key identifies the Interceptor in the flight values, as the shadowed
+	// interceptor might not be comparable.
+	key *blockedKey
+}
+
+type blockedKey struct {
+	_ byte
+}
+
+// New returns an Interceptor running it in shadow mode and calling report for
+// every request it would block. If report is nil, the decisions are logged.
+//
+// The headers set by it, even when it would block a request, are applied to
+// the response. If it's a safehttp.Finisher, the returned Interceptor is one
+// too.
+func New(it safehttp.Interceptor, report func(Decision)) safehttp.Interceptor {
+	if report == nil {
+		report = func(d Decision) { log.Printf("shadow: %v", d) }
+	}
+	s := interceptor{it: it, report: report, key: &blockedKey{}}
+	if f, ok := it.(safehttp.Finisher); ok {
+		return finisher{interceptor: s, f: f}
+	}
+	return s
+}
+
+// Before runs the Before phase of the shadowed interceptor, reporting the
+// response it writes, if any, instead of writing it.
+func (s interceptor) Before(w safehttp.ResponseWriter, r *safehttp.IncomingRequest, cfg safehttp.InterceptorConfig) safehttp.Result {
+	sw := &shadowWriter{ResponseHeadersWriter: w}
+	s.it.Before(sw, r, cfg)
+	if sw.resp != nil {
+		safehttp.FlightValues(r.Context()).Put(s.key, true)
+		s.report(Decision{Interceptor: s.it, Request: r, Response: sw.resp})
+	}
+	return safehttp.NotWritten()
+}
+
+// Commit runs the Commit phase of the shadowed interceptor, unless it would
+// have blocked the request: it never ran in that case.
+func (s interceptor) Commit(w safehttp.ResponseHeadersWriter, r *safehttp.IncomingRequest, resp safehttp.Response, cfg safehttp.InterceptorConfig) {
+	if safehttp.FlightValues(r.Context()).Get(s.key) != nil {
+		return
+	}
+	s.it.Commit(w, r, resp, cfg)
+}
+
+// Match delegates to the shadowed interceptor, so that it gets its
+// configurations.
+func (s interceptor) Match(cfg safehttp.InterceptorConfig) bool {
+	return s.it.Match(cfg)
+}
+
+// finisher runs a safehttp.Finisher in shadow mode.
+type finisher struct {
+	interceptor
+	f safehttp.Finisher
+}
+
+// Finish runs the Finish phase of the shadowed interceptor, unless it would
+// have blocked the request, like Commit.
+func (s finisher) Finish(r *safehttp.IncomingRequest, sum safehttp.ResponseSummary, cfg safehttp.InterceptorConfig) {
+	if safehttp.FlightValues(r.Context()).Get(s.key) != nil {
+		return
+	}
+	s.f.Finish(r, sum, cfg)
+}
+
+// shadowWriter records the first response written instead of writing it.
+type shadowWriter struct {
+	safehttp.ResponseHeadersWriter
+	resp safehttp.Response
+}
+
+func (w *shadowWriter) Write(resp safehttp.Response) safehttp.Result {
+	if w.resp == nil {
+		w.resp = resp
+	}
+	return safehttp.Result{}
+}
+
+func (w *shadowWriter) WriteError(resp safehttp.ErrorResponse) safehttp.Result {
+	if w.resp == nil {
+		w.resp = resp
+	}
+	return safehttp.Result{}
+}
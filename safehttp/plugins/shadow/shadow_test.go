@@ -0,0 +1,125 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package shadow_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-safeweb/safehttp"
+	"github.com/google/go-safeweb/safehttp/plugins/hostcheck"
+	"github.com/google/go-safeweb/safehttp/plugins/shadow"
+)
+
+func TestShadow(t *testing.T) {
+	tests := []struct {
+		name          string
+		host          string
+		wantDecisions []string
+	}{
+		{
+			name: "Allowed",
+			host: "foo.com",
+		},
+		{
+			name:          "Would block",
+			host:          "evil.com",
+			wantDecisions: []string{"hostcheck.Interceptor would block GET / with 404 Not Found"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var decisions []string
+			mb := safehttp.NewServeMuxConfig(nil)
+			mb.Intercept(shadow.New(hostcheck.New("foo.com"), func(d shadow.Decision) {
+				decisions = append(decisions, d.String())
+			}))
+			mux := mb.Mux()
+			mux.Handle("/", safehttp.MethodGet, safehttp.HandlerFunc(func(w safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+				return w.Write(safehttp.NoContentResponse{})
+			}))
+
+			rw := httptest.NewRecorder()
+			mux.ServeHTTP(rw, httptest.NewRequest(safehttp.MethodGet, "http://"+tt.host+"/", nil))
+
+			if want := http.StatusNoContent; rw.Code != want {
+				t.Errorf("rw.Code: got %v, want %v", rw.Code, want)
+			}
+			if len(decisions) != len(tt.wantDecisions) || (len(decisions) > 0 && decisions[0] != tt.wantDecisions[0]) {
+				t.Errorf("decisions: got %q, want %q", decisions, tt.wantDecisions)
+			}
+		})
+	}
+}
+
+// blockingFinisher blocks the requests with a Block header and records the
+// responses it finishes.
+type blockingFinisher struct {
+	finished *[]safehttp.StatusCode
+}
+
+func (blockingFinisher) Before(w safehttp.ResponseWriter, r *safehttp.IncomingRequest, _ safehttp.InterceptorConfig) safehttp.Result {
+	if r.Header.Get("Block") != "" {
+		return w.WriteError(safehttp.StatusForbidden)
+	}
+	return safehttp.NotWritten()
+}
+
+func (blockingFinisher) Commit(safehttp.ResponseHeadersWriter, *safehttp.IncomingRequest, safehttp.Response, safehttp.InterceptorConfig) {
+}
+
+func (blockingFinisher) Match(safehttp.InterceptorConfig) bool {
+	return false
+}
+
+func (f blockingFinisher) Finish(_ *safehttp.IncomingRequest, s safehttp.ResponseSummary, _ safehttp.InterceptorConfig) {
+	*f.finished = append(*f.finished, s.Status)
+}
+
+func TestShadowFinisher(t *testing.T) {
+	if _, ok := shadow.New(hostcheck.New("foo.com"), nil).(safehttp.Finisher); ok {
+		t.Error("shadow.New() of an Interceptor which isn't a Finisher is a Finisher")
+	}
+
+	tests := []struct {
+		name         string
+		block        bool
+		wantFinished []safehttp.StatusCode
+	}{
+		{name: "Allowed", wantFinished: []safehttp.StatusCode{safehttp.StatusNoContent}},
+		{name: "Would block", block: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var finished []safehttp.StatusCode
+			mb := safehttp.NewServeMuxConfig(nil)
+			mb.Intercept(shadow.New(blockingFinisher{finished: &finished}, func(shadow.Decision) {}))
+			mux := mb.Mux()
+			mux.Handle("/", safehttp.MethodGet, safehttp.HandlerFunc(func(w safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+				return w.Write(safehttp.NoContentResponse{})
+			}))
+
+			req := httptest.NewRequest(safehttp.MethodGet, "http://foo.com/", nil)
+			if tt.block {
+				req.Header.Set("Block", "1")
+			}
+			mux.ServeHTTP(httptest.NewRecorder(), req)
+			if len(finished) != len(tt.wantFinished) || (len(finished) > 0 && finished[0] != tt.wantFinished[0]) {
+				t.Errorf("finished: got %v, want %v", finished, tt.wantFinished)
+			}
+		})
+	}
+}
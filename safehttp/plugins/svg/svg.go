@@ -0,0 +1,200 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package svg sanitizes SVG images so they can be inlined into HTML
+// documents, e.g. user-provided icons.
+//
+// Sanitization is allowlist-based: only drawing elements and presentation
+// attributes are kept. Scripts, event handlers, <foreignObject>, <style> and
+// references to other documents are stripped, and documents with a DTD are
+// rejected.
+//
+// # Usage
+//
+//	icon, err := svg.Sanitize(upload, svg.Options{})
+//	if err != nil {
+//		return w.WriteError(safehttp.StatusBadRequest)
+//	}
+//	return safehttp.ExecuteTemplate(w, tmpl, map[string]interface{}{"Icon": icon})
+package svg
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/google/safehtml"
+	"github.com/google/safehtml/uncheckedconversions"
+)
+
+const (
+	defaultMaxBytes    = 256 << 10
+	defaultMaxElements = 10000
+)
+
+// Options configures the sanitization of SVG images.
+type Options struct {
+	// MaxBytes is the maximum size of the image. If zero, 256 KiB is used.
+	MaxBytes int
+	// MaxElements is the maximum number of elements of the image. If zero,
+	// 10000 is used.
+	MaxElements int
+}
+
+var allowedElements = map[string]bool{
+	"svg": true, "g": true, "defs": true, "symbol": true, "use": true,
+	"title": true, "desc": true,
+	"path": true, "circle": true, "ellipse": true, "line": true,
+	"polyline": true, "polygon": true, "rect": true,
+	"text": true, "tspan": true,
+	"linearGradient": true, "radialGradient": true, "stop": true,
+	"clipPath": true, "mask": true, "pattern": true,
+}
+
+var allowedAttributes = map[string]bool{
+	"id": true, "class": true, "viewBox": true, "preserveAspectRatio": true,
+	"width": true, "height": true, "x": true, "y": true,
+	"x1": true, "y1": true, "x2": true, "y2": true,
+	"cx": true, "cy": true, "r": true, "rx": true, "ry": true,
+	"fx": true, "fy": true, "d": true, "points": true, "transform": true,
+	"fill": true, "fill-opacity": true, "fill-rule": true,
+	"stroke": true, "stroke-width": true, "stroke-opacity": true,
+	"stroke-linecap": true, "stroke-linejoin": true, "stroke-dasharray": true,
+	"stroke-dashoffset": true, "stroke-miterlimit": true,
+	"opacity": true, "clip-path": true, "clip-rule": true, "mask": true,
+	"offset": true, "stop-color": true, "stop-opacity": true,
+	"gradientUnits": true, "gradientTransform": true, "spreadMethod": true,
+	"patternUnits": true, "patternTransform": true,
+	"clipPathUnits": true, "maskUnits": true,
+	"font-family": true, "font-size": true, "font-weight": true,
+	"font-style": true, "text-anchor": true, "dominant-baseline": true,
+	"dx": true, "dy": true, "visibility": true, "display": true,
+}
+
+// localURL matches the references to elements of the same image, which are
+// the only URLs allowed in attributes.
+var localURL = regexp.MustCompile(`^url\(\s*#[A-Za-z0-9_.:-]+\s*\)$`)
+
+// localFragment matches the href of <use> elements referring to elements of
+// the same image.
+var localFragment = regexp.MustCompile(`^#[A-Za-z0-9_.:-]+$`)
+
+// Sanitize sanitizes an SVG image, whose root element must be <svg>, and
+// returns it as HTML which can be inlined into documents.
+func Sanitize(src []byte, opts Options) (safehtml.HTML, error) {
+	if opts.MaxBytes == 0 {
+		opts.MaxBytes = defaultMaxBytes
+	}
+	if opts.MaxElements == 0 {
+		opts.MaxElements = defaultMaxElements
+	}
+	if len(src) > opts.MaxBytes {
+		return safehtml.HTML{}, fmt.Errorf("SVG image larger than %d bytes", opts.MaxBytes)
+	}
+
+	var b strings.Builder
+	d := xml.NewDecoder(bytes.NewReader(src))
+	d.Strict = true
+	// Element names of the stack of open elements, with an empty name for
+	// the elements being stripped.
+	var stack []string
+	skipped := 0
+	elements := 0
+	for {
+		tok, err := d.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return safehtml.HTML{}, err
+		}
+		switch tok := tok.(type) {
+		case xml.Directive:
+			return safehtml.HTML{}, errors.New("SVG images with directives, such as DTDs, are not allowed")
+		case xml.StartElement:
+			elements++
+			if elements > opts.MaxElements {
+				return safehtml.HTML{}, fmt.Errorf("SVG image with more than %d elements", opts.MaxElements)
+			}
+			name := tok.Name.Local
+			if len(stack) == 0 && name != "svg" {
+				return safehtml.HTML{}, fmt.Errorf("root element must be <svg>, got <%s>", name)
+			}
+			if len(stack) == 0 && elements > 1 {
+				return safehtml.HTML{}, errors.New("SVG image with multiple root elements")
+			}
+			if skipped > 0 || tok.Name.Space != "" || !allowedElements[name] {
+				skipped++
+				stack = append(stack, "")
+				continue
+			}
+			stack = append(stack, name)
+			writeStartElement(&b, name, tok.Attr)
+		case xml.EndElement:
+			if len(stack) == 0 {
+				return safehtml.HTML{}, errors.New("unbalanced SVG image")
+			}
+			name := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			if name == "" {
+				skipped--
+				continue
+			}
+			b.WriteString("</" + name + ">")
+		case xml.CharData:
+			if skipped == 0 && len(stack) > 0 {
+				b.WriteString(html.EscapeString(string(tok)))
+			}
+		}
+	}
+	if elements == 0 || len(stack) != 0 {
+		return safehtml.HTML{}, errors.New("incomplete SVG image")
+	}
+	return uncheckedconversions.HTMLFromStringKnownToSatisfyTypeContract(b.String()), nil
+}
+
+func writeStartElement(b *strings.Builder, name string, attrs []xml.Attr) {
+	b.WriteString("<" + name)
+	for _, a := range attrs {
+		key, ok := sanitizeAttr(name, a)
+		if !ok {
+			continue
+		}
+		b.WriteString(" " + key + `="` + html.EscapeString(strings.TrimSpace(a.Value)) + `"`)
+	}
+	b.WriteByte('>')
+}
+
+// sanitizeAttr returns the name the attribute should be written with, and
+// whether it's allowed.
+func sanitizeAttr(elem string, a xml.Attr) (string, bool) {
+	v := strings.TrimSpace(a.Value)
+	if a.Name.Local == "href" && (a.Name.Space == "" || a.Name.Space == "xlink") {
+		// Only local references are allowed, so that images can't load
+		// other documents.
+		return "href", elem == "use" && localFragment.MatchString(v)
+	}
+	if a.Name.Space != "" || !allowedAttributes[a.Name.Local] {
+		return "", false
+	}
+	if strings.Contains(strings.ToLower(v), "url(") && !localURL.MatchString(v) {
+		return "", false
+	}
+	return a.Name.Local, true
+}
@@ -0,0 +1,116 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package svg_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-safeweb/safehttp/plugins/svg"
+)
+
+func TestSanitize(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{
+			name: "Allowed",
+			src:  `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 10 10"><circle cx="5" cy="5" r="4" fill="red"/></svg>`,
+			want: `<svg viewBox="0 0 10 10"><circle cx="5" cy="5" r="4" fill="red"></circle></svg>`,
+		},
+		{
+			name: "Script",
+			src:  `<svg><script>alert(1)</script><rect width="1"/></svg>`,
+			want: `<svg><rect width="1"></rect></svg>`,
+		},
+		{
+			name: "ForeignObject",
+			src:  `<svg><foreignObject><div xmlns="http://www.w3.org/1999/xhtml"><img src="x"/></div></foreignObject></svg>`,
+			want: `<svg></svg>`,
+		},
+		{
+			name: "Event handler",
+			src:  `<svg onload="alert(1)"><path d="M0 0" onclick="alert(1)"/></svg>`,
+			want: `<svg><path d="M0 0"></path></svg>`,
+		},
+		{
+			name: "Local use",
+			src:  `<svg xmlns:xlink="http://www.w3.org/1999/xlink"><use xlink:href="#icon"/></svg>`,
+			want: `<svg><use href="#icon"></use></svg>`,
+		},
+		{
+			name: "Remote use",
+			src:  `<svg><use href="https://evil.com/a.svg#icon"/></svg>`,
+			want: `<svg><use></use></svg>`,
+		},
+		{
+			name: "Links",
+			src:  `<svg><a href="javascript:alert(1)"><text>click</text></a></svg>`,
+			want: `<svg></svg>`,
+		},
+		{
+			name: "Local url",
+			src:  `<svg><rect fill="url(#grad)" mask="url(https://evil.com/m)"/></svg>`,
+			want: `<svg><rect fill="url(#grad)"></rect></svg>`,
+		},
+		{
+			name: "Escaping",
+			src:  `<svg><text>&lt;script&gt;</text><title>a &amp; "b"</title></svg>`,
+			want: `<svg><text>&lt;script&gt;</text><title>a &amp; &#34;b&#34;</title></svg>`,
+		},
+		{
+			name: "Style",
+			src:  `<svg><style>rect { fill: url(https://evil.com) }</style></svg>`,
+			want: `<svg></svg>`,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := svg.Sanitize([]byte(tc.src), svg.Options{})
+			if err != nil {
+				t.Fatalf("svg.Sanitize() got err: %v", err)
+			}
+			if got.String() != tc.want {
+				t.Errorf("svg.Sanitize():\ngot:  %s\nwant: %s", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestSanitizeErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		opts svg.Options
+	}{
+		{name: "Not SVG", src: `<html></html>`},
+		{name: "Empty", src: ``},
+		{name: "Malformed", src: `<svg><g></svg>`},
+		{name: "Unclosed", src: `<svg><g>`},
+		{name: "Multiple roots", src: `<svg></svg><svg></svg>`},
+		{name: "DTD", src: `<!DOCTYPE svg [<!ENTITY a "aaaa">]><svg>&a;</svg>`},
+		{name: "Too large", src: `<svg>` + strings.Repeat(" ", 100) + `</svg>`, opts: svg.Options{MaxBytes: 100}},
+		{name: "Too many elements", src: `<svg><g/><g/><g/></svg>`, opts: svg.Options{MaxElements: 3}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got, err := svg.Sanitize([]byte(tc.src), tc.opts); err == nil {
+				t.Errorf("svg.Sanitize() got: %s, want error", got)
+			}
+		})
+	}
+}
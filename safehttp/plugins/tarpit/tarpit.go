@@ -0,0 +1,89 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package tarpit provides a way for rate limiting and bot detection plugins to
+// slow down flagged clients by trickling them a minimal response, instead of
+// rejecting them with an easily detected 429 Too Many Requests.
+//
+// # Usage
+//
+// Create a Pit shared by the plugins and handlers tarpitting clients and write
+// the responses to flagged clients with it:
+//
+//	pit := tarpit.NewPit(tarpit.Options{MaxConcurrent: 100})
+//	if flagged {
+//		return pit.Write(w, r)
+//	}
+package tarpit
+
+import (
+	"time"
+
+	"github.com/google/go-safeweb/safehttp"
+)
+
+// Options configures a Pit.
+type Options struct {
+	// MaxConcurrent is the maximum number of clients tarpitted at the same
+	// time. Once reached, clients get an immediate 429 Too Many Requests, so
+	// that tarpitting can't exhaust the server. If zero, 100 is used.
+	MaxConcurrent int
+	// Interval is the time between two bytes of the response. If zero, 5
+	// seconds are used.
+	Interval time.Duration
+	// Duration is how long each response is trickled for. If zero, one
+	// minute is used.
+	Duration time.Duration
+}
+
+// Pit tarpits clients. It's safe for concurrent use.
+type Pit struct {
+	slots    chan struct{}
+	interval time.Duration
+	duration time.Duration
+}
+
+// NewPit creates a Pit with the given options.
+func NewPit(opts Options) *Pit {
+	if opts.MaxConcurrent <= 0 {
+		opts.MaxConcurrent = 100
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = 5 * time.Second
+	}
+	if opts.Duration <= 0 {
+		opts.Duration = time.Minute
+	}
+	return &Pit{
+		slots:    make(chan struct{}, opts.MaxConcurrent),
+		interval: opts.Interval,
+		duration: opts.Duration,
+	}
+}
+
+// Write writes a safehttp.TarpitResponse for r, blocking until it's done, or
+// a 429 Too Many Requests if too many clients are already tarpitted.
+func (p *Pit) Write(w safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+	select {
+	case p.slots <- struct{}{}:
+	default:
+		return w.WriteError(safehttp.StatusTooManyRequests)
+	}
+	defer func() { <-p.slots }()
+	return w.Write(safehttp.TarpitResponse{
+		Request:  r,
+		Interval: p.interval,
+		Duration: p.duration,
+	})
+}
@@ -0,0 +1,98 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tarpit_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-safeweb/safehttp"
+	"github.com/google/go-safeweb/safehttp/plugins/tarpit"
+)
+
+func newMux(pit *tarpit.Pit, entered chan<- struct{}) *safehttp.ServeMux {
+	mux := safehttp.NewServeMuxConfig(nil).Mux()
+	mux.Handle("/", safehttp.MethodGet, safehttp.HandlerFunc(func(w safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+		if entered != nil {
+			entered <- struct{}{}
+		}
+		return pit.Write(w, r)
+	}))
+	return mux
+}
+
+func TestPitTrickles(t *testing.T) {
+	pit := tarpit.NewPit(tarpit.Options{Interval: time.Millisecond, Duration: 50 * time.Millisecond})
+	rr := httptest.NewRecorder()
+	start := time.Now()
+	newMux(pit, nil).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "https://foo.com/", nil))
+
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("response written in %v, want at least 50ms", elapsed)
+	}
+	if got, want := rr.Code, http.StatusOK; got != want {
+		t.Errorf("rr.Code: got %v, want %v", got, want)
+	}
+	if rr.Body.Len() == 0 {
+		t.Error("rr.Body is empty, want trickled bytes")
+	}
+}
+
+func TestPitClientGone(t *testing.T) {
+	pit := tarpit.NewPit(tarpit.Options{Interval: time.Millisecond, Duration: time.Hour})
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	req := httptest.NewRequest(http.MethodGet, "https://foo.com/", nil).WithContext(ctx)
+
+	done := make(chan struct{})
+	go func() {
+		newMux(pit, nil).ServeHTTP(httptest.NewRecorder(), req)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("tarpit didn't stop when the client went away")
+	}
+}
+
+func TestPitMaxConcurrent(t *testing.T) {
+	pit := tarpit.NewPit(tarpit.Options{MaxConcurrent: 1, Interval: time.Millisecond, Duration: time.Hour})
+	entered := make(chan struct{}, 2)
+	mux := newMux(pit, entered)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "https://foo.com/", nil).WithContext(ctx))
+	}()
+	<-entered
+	// Give the first request time to take the only slot.
+	time.Sleep(10 * time.Millisecond)
+
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "https://foo.com/", nil))
+	if got, want := rr.Code, http.StatusTooManyRequests; got != want {
+		t.Errorf("rr.Code: got %v, want %v", got, want)
+	}
+	cancel()
+	wg.Wait()
+}
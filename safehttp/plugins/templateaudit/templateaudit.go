@@ -0,0 +1,218 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package templateaudit reports the escaping contexts of the actions of
+// safehtml templates, to help audit where safe types, and the unchecked
+// conversions producing them, are needed.
+//
+// # Usage
+//
+// Audit the templates at startup, or from a test, before they are executed:
+//
+//	for _, r := range templateaudit.Audit(tmpl) {
+//		fmt.Print(r)
+//	}
+package templateaudit
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"text/template/parse"
+
+	"github.com/google/safehtml/template"
+)
+
+// sanitizerContexts maps the sanitizers inserted by the safehtml/template
+// escaper to the escaping context they are inserted for and the safe types
+// they accept. Sanitizers marked as strict reject values of any other type.
+var sanitizerContexts = map[string]struct {
+	context   string
+	safeTypes []string
+	strict    bool
+}{
+	"_sanitizeAsyncEnum":               {"AsyncEnum", nil, false},
+	"_sanitizeDirEnum":                 {"DirEnum", nil, false},
+	"_sanitizeHTML":                    {"HTML", []string{"safehtml.HTML"}, false},
+	"_sanitizeHTMLComment":             {"HTMLComment", nil, false},
+	"_sanitizeHTMLValOnly":             {"HTMLValOnly", []string{"safehtml.HTML"}, true},
+	"_sanitizeIdentifier":              {"Identifier", []string{"safehtml.Identifier"}, true},
+	"_sanitizeLoadingEnum":             {"LoadingEnum", nil, false},
+	"_sanitizeRCDATA":                  {"RCDATA", nil, false},
+	"_sanitizeScript":                  {"Script", []string{"safehtml.Script"}, true},
+	"_sanitizeStyle":                   {"Style", []string{"safehtml.Style"}, true},
+	"_sanitizeStyleSheet":              {"StyleSheet", []string{"safehtml.StyleSheet"}, true},
+	"_sanitizeTargetEnum":              {"TargetEnum", nil, false},
+	"_sanitizeTrustedResourceURL":      {"TrustedResourceURL", []string{"safehtml.TrustedResourceURL"}, true},
+	"_sanitizeTrustedResourceURLOrURL": {"TrustedResourceURLOrURL", []string{"safehtml.TrustedResourceURL", "safehtml.URL"}, false},
+	"_sanitizeURL":                     {"URL", []string{"safehtml.URL"}, false},
+	"_sanitizeURLSet":                  {"URLSet", []string{"safehtml.URL"}, false},
+}
+
+// Action is an action of a template producing output.
+type Action struct {
+	// Location is the position of the action, as template:line:column.
+	Location string
+	// Pipeline is the source of the action, without the sanitizers added by
+	// the escaper.
+	Pipeline string
+	// Context is the escaping context of the action, e.g. "HTML" or "URL".
+	Context string
+	// SafeTypes are the safehtml types whose values are output as is in the
+	// Context.
+	SafeTypes []string
+	// RequiresSafeType reports whether values of other types are rejected,
+	// i.e. whether the action only works with values of SafeTypes, which
+	// often come from unchecked conversions.
+	RequiresSafeType bool
+}
+
+// Report describes the escaping of a template.
+type Report struct {
+	// Template is the name of the template. The escaper derives templates
+	// called in non-text contexts, which are reported separately.
+	Template string
+	Actions  []Action
+	// Err is the error escaping the template failed with, if any.
+	Err error
+}
+
+// String formats the report, one action per line.
+func (r Report) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s:\n", r.Template)
+	if r.Err != nil {
+		fmt.Fprintf(&b, "\terror: %v\n", r.Err)
+	}
+	for _, a := range r.Actions {
+		fmt.Fprintf(&b, "\t%s\t%s\t%s", a.Location, a.Context, a.Pipeline)
+		if a.RequiresSafeType {
+			fmt.Fprintf(&b, "\trequires %s", strings.Join(a.SafeTypes, " or "))
+		}
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+type errWriter struct{}
+
+var errAuditing = errors.New("templates are not written while they are audited")
+
+func (errWriter) Write([]byte) (int, error) {
+	return 0, errAuditing
+}
+
+// Audit escapes a clone of t and its associated templates, and reports the
+// escaping contexts of their actions, sorted by template name.
+//
+// The escaper only runs when templates are executed, so the templates are
+// executed with nil data, writing to a writer failing on the first write.
+// Functions called before any output is produced are called. Audit must be
+// called before t is executed, as executed templates can't be cloned.
+func Audit(t *template.Template) []Report {
+	clone, err := t.Clone()
+	if err != nil {
+		return []Report{{Template: t.Name(), Err: err}}
+	}
+
+	escapeErrs := map[string]error{}
+	for _, tmpl := range clone.Templates() {
+		if tmpl.Tree == nil {
+			continue
+		}
+		var tErr *template.Error
+		if err := tmpl.Execute(errWriter{}, nil); errors.As(err, &tErr) {
+			escapeErrs[tmpl.Name()] = err
+		}
+	}
+
+	var reports []Report
+	for _, tmpl := range clone.Templates() {
+		r := Report{Template: tmpl.Name(), Err: escapeErrs[tmpl.Name()]}
+		if tmpl.Tree != nil {
+			r.Actions = actions(tmpl.Tree, tmpl.Tree.Root)
+		}
+		if r.Err == nil && tmpl.Tree == nil {
+			// Empty templates, e.g. the one created by New, are not
+			// interesting.
+			continue
+		}
+		reports = append(reports, r)
+	}
+	sort.Slice(reports, func(i, j int) bool { return reports[i].Template < reports[j].Template })
+	return reports
+}
+
+func actions(tree *parse.Tree, n parse.Node) []Action {
+	switch n := n.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return nil
+		}
+		var as []Action
+		for _, c := range n.Nodes {
+			as = append(as, actions(tree, c)...)
+		}
+		return as
+	case *parse.IfNode:
+		return append(actions(tree, n.List), actions(tree, n.ElseList)...)
+	case *parse.RangeNode:
+		return append(actions(tree, n.List), actions(tree, n.ElseList)...)
+	case *parse.WithNode:
+		return append(actions(tree, n.List), actions(tree, n.ElseList)...)
+	case *parse.ActionNode:
+		if a, ok := action(tree, n); ok {
+			return []Action{a}
+		}
+	}
+	return nil
+}
+
+func action(tree *parse.Tree, n *parse.ActionNode) (Action, bool) {
+	// Actions declaring variables don't produce output.
+	if len(n.Pipe.Decl) > 0 {
+		return Action{}, false
+	}
+	var a Action
+	var cmds []string
+	found := false
+	for _, cmd := range n.Pipe.Cmds {
+		if id, ok := cmd.Args[0].(*parse.IdentifierNode); ok && strings.HasPrefix(id.Ident, "_") {
+			// Values in attributes are sanitized for the attribute, then
+			// HTML-escaped: the first sanitizer determines the context.
+			if sc, ok := sanitizerContexts[id.Ident]; ok && !found {
+				a.Context, a.SafeTypes, a.RequiresSafeType = sc.context, sc.safeTypes, sc.strict
+				found = true
+			}
+			if id.Ident == "_evalArgs" {
+				// The escaper wraps multiple arguments, e.g. {{.A .B}}, in
+				// _evalArgs.
+				var args []string
+				for _, arg := range cmd.Args[1:] {
+					args = append(args, arg.String())
+				}
+				cmds = append(cmds, strings.Join(args, " "))
+			}
+			continue
+		}
+		cmds = append(cmds, cmd.String())
+	}
+	if !found {
+		return Action{}, false
+	}
+	a.Location, _ = tree.ErrorContext(n)
+	a.Pipeline = "{{" + strings.Join(cmds, " | ") + "}}"
+	return a, true
+}
@@ -0,0 +1,79 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package templateaudit_test
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-safeweb/safehttp/plugins/templateaudit"
+	"github.com/google/safehtml"
+	"github.com/google/safehtml/template"
+)
+
+func TestAudit(t *testing.T) {
+	tmpl := template.Must(template.New("page").Parse(
+		`<a href="{{.URL}}">{{.Name}}</a>` + "\n" +
+			`<script src="{{.Src}}"></script>{{$x := .Name}}` +
+			`{{if .Show}}<p title="{{.Title | printf "%s!"}}">{{template "sub" .}}</p>{{end}}` +
+			`{{define "sub"}}<b>{{.Name}}</b>{{end}}`))
+
+	got := templateaudit.Audit(tmpl)
+	want := []templateaudit.Report{
+		{
+			Template: "page",
+			Actions: []templateaudit.Action{
+				{
+					Location:  "page:1:11",
+					Pipeline:  "{{.URL}}",
+					Context:   "TrustedResourceURLOrURL",
+					SafeTypes: []string{"safehtml.TrustedResourceURL", "safehtml.URL"},
+				},
+				{Location: "page:1:21", Pipeline: "{{.Name}}", Context: "HTML", SafeTypes: []string{"safehtml.HTML"}},
+				{
+					Location:         "page:2:15",
+					Pipeline:         "{{.Src}}",
+					Context:          "TrustedResourceURL",
+					SafeTypes:        []string{"safehtml.TrustedResourceURL"},
+					RequiresSafeType: true,
+				},
+				{Location: "page:2:71", Pipeline: `{{.Title | printf "%s!"}}`, Context: "HTML", SafeTypes: []string{"safehtml.HTML"}},
+			},
+		},
+		{
+			Template: "sub",
+			Actions: []templateaudit.Action{
+				{Location: "page:2:148", Pipeline: "{{.Name}}", Context: "HTML", SafeTypes: []string{"safehtml.HTML"}},
+			},
+		},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Audit() mismatch (-want +got):\n%s", diff)
+	}
+
+	// The original template can still be executed.
+	data := map[string]interface{}{"Src": safehtml.TrustedResourceURLFromConstant("/app.js")}
+	if _, err := tmpl.ExecuteToHTML(data); err != nil {
+		t.Errorf("tmpl.ExecuteToHTML() after Audit() got err: %v", err)
+	}
+}
+
+func TestAuditEscapingError(t *testing.T) {
+	tmpl := template.Must(template.New("bad").Parse(`<a href="{{.URL}}`))
+	got := templateaudit.Audit(tmpl)
+	if len(got) != 1 || got[0].Template != "bad" || got[0].Err == nil {
+		t.Errorf("Audit(): got %+v, want an escaping error for the bad template", got)
+	}
+}
@@ -0,0 +1,166 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package timeout bounds the time spent serving requests.
+//
+// The Interceptor gives the context of the requests a deadline, which is
+// canceled when it's exceeded, so that the handler and the calls it makes
+// stop working on them. It doesn't wrap the ResponseWriter, as
+// http.TimeoutHandler does, so handlers can't be preempted: they should
+// return Error when they fail because of the context, making the responses to
+// timed out requests consistent.
+//
+// # Usage
+//
+//	cfg.Intercept(timeout.Interceptor{Timeout: 10 * time.Second, ReadTimeout: 5 * time.Second})
+//	mux.Handle("/export", safehttp.MethodGet, exportHandler, timeout.Override("slow export", time.Minute, 0))
+//
+// In the handlers:
+//
+//	rows, err := db.QueryContext(r.Context(), q)
+//	if err != nil {
+//		if r.Context().Err() != nil {
+//			return timeout.Error(w, r)
+//		}
+//		return w.WriteError(safehttp.StatusInternalServerError)
+//	}
+//
+// Write deadlines can't be set per request: use Server.WriteTimeout to bound
+// them.
+package timeout
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/google/go-safeweb/safehttp"
+)
+
+var _ safehttp.Interceptor = Interceptor{}
+
+// ErrReadTimeout is returned when reading the body of a request after its
+// ReadTimeout elapsed.
+var ErrReadTimeout = errors.New("request body read timeout")
+
+// Interceptor sets deadlines on requests. The deadlines can be overridden for
+// specific handlers using an Overrider.
+type Interceptor struct {
+	// Timeout is the time allowed to serve a request, after which its context
+	// is canceled. If zero, the context isn't given a deadline.
+	Timeout time.Duration
+	// ReadTimeout is the time allowed to read the body of a request, after
+	// which reads fail with an error wrapping ErrReadTimeout. A read in
+	// progress isn't interrupted: Server.ReadTimeout bounds those. If zero,
+	// reads are only bounded by Timeout.
+	ReadTimeout time.Duration
+	// Clock is used to check the ReadTimeout. If nil, the
+	// safehttp.SystemClock is used. Timeout relies on the timers of the
+	// runtime instead.
+	Clock safehttp.Clock
+}
+
+func (it Interceptor) clock() safehttp.Clock {
+	if it.Clock == nil {
+		return safehttp.SystemClock()
+	}
+	return it.Clock
+}
+
+// Before sets the deadline of the context of the request and limits the time
+// allowed to read its body. If the context is already done, e.g. because the
+// caller's deadline was exceeded, the request is rejected through Error.
+func (it Interceptor) Before(w safehttp.ResponseWriter, r *safehttp.IncomingRequest, cfg safehttp.InterceptorConfig) safehttp.Result {
+	if cfg != nil {
+		// We got an override, run its Before phase instead.
+		o := Interceptor(cfg.(Overrider))
+		if o.Clock == nil {
+			o.Clock = it.Clock
+		}
+		return o.Before(w, r, nil)
+	}
+	if it.Timeout > 0 {
+		// The context is canceled once the response is written, releasing
+		// its timer.
+		ctx, cancel := context.WithTimeout(r.Context(), it.Timeout)
+		r.SetContext(ctx, cancel)
+	}
+	if err := r.Context().Err(); err != nil {
+		return Error(w, r)
+	}
+	if body := r.Body(); body != nil && body != http.NoBody {
+		b := &deadlineBody{rc: body, ctx: r.Context(), clock: it.clock()}
+		if it.ReadTimeout > 0 {
+			b.readDeadline = b.clock.Now().Add(it.ReadTimeout)
+		}
+		r.SetBody(b)
+	}
+	return safehttp.NotWritten()
+}
+
+// Commit is a no-op, required to satisfy the safehttp.Interceptor interface.
+func (it Interceptor) Commit(w safehttp.ResponseHeadersWriter, r *safehttp.IncomingRequest, resp safehttp.Response, cfg safehttp.InterceptorConfig) {
+}
+
+// Match recognizes Overriders as timeout configurations.
+func (it Interceptor) Match(cfg safehttp.InterceptorConfig) bool {
+	_, ok := cfg.(Overrider)
+	return ok
+}
+
+// Overrider is a safehttp.InterceptorConfig that allows to override the
+// deadlines for a specific handler.
+type Overrider Interceptor
+
+// Override creates an Overrider with the given timeouts, e.g. longer ones for
+// a slow export endpoint. Zero values disable the respective timeout.
+func Override(reason string, timeout, readTimeout time.Duration) Overrider {
+	return Overrider{Timeout: timeout, ReadTimeout: readTimeout}
+}
+
+// Error responds to a request whose context is done: with 504 Gateway Timeout
+// if its deadline was exceeded and with 503 Service Unavailable otherwise,
+// e.g. if the client went away.
+func Error(w safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+	if errors.Is(r.Context().Err(), context.DeadlineExceeded) {
+		return w.WriteError(safehttp.StatusGatewayTimeout)
+	}
+	return w.WriteError(safehttp.StatusServiceUnavailable)
+}
+
+// deadlineBody fails reads once the context of the request is done or its
+// read deadline elapsed.
+type deadlineBody struct {
+	rc           io.ReadCloser
+	ctx          context.Context
+	clock        safehttp.Clock
+	readDeadline time.Time
+}
+
+func (b *deadlineBody) Read(p []byte) (int, error) {
+	if err := b.ctx.Err(); err != nil {
+		return 0, err
+	}
+	if !b.readDeadline.IsZero() && b.clock.Now().After(b.readDeadline) {
+		return 0, fmt.Errorf("%w: deadline exceeded", ErrReadTimeout)
+	}
+	return b.rc.Read(p)
+}
+
+func (b *deadlineBody) Close() error {
+	return b.rc.Close()
+}
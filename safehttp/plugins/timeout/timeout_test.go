@@ -0,0 +1,129 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package timeout_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-safeweb/safehttp"
+	"github.com/google/go-safeweb/safehttp/plugins/timeout"
+	"github.com/google/go-safeweb/safehttp/safehttptest"
+)
+
+// waitHandler waits for the context of the request to be done, or for
+// 100ms, and responds through timeout.Error.
+var waitHandler = safehttp.HandlerFunc(func(w safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+	select {
+	case <-r.Context().Done():
+		return timeout.Error(w, r)
+	case <-time.After(100 * time.Millisecond):
+		return w.Write(safehttp.NoContentResponse{})
+	}
+})
+
+func TestTimeout(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfgs     []safehttp.InterceptorConfig
+		wantCode int
+	}{
+		{
+			name:     "Exceeded",
+			wantCode: http.StatusGatewayTimeout,
+		},
+		{
+			name:     "Overridden",
+			cfgs:     []safehttp.InterceptorConfig{timeout.Override("slow", 0, 0)},
+			wantCode: http.StatusNoContent,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mb := safehttp.NewServeMuxConfig(nil)
+			mb.Intercept(timeout.Interceptor{Timeout: 10 * time.Millisecond})
+			mux := mb.Mux()
+			mux.Handle("/", safehttp.MethodGet, waitHandler, tt.cfgs...)
+
+			rw := httptest.NewRecorder()
+			mux.ServeHTTP(rw, httptest.NewRequest(safehttp.MethodGet, "/", nil))
+
+			if rw.Code != tt.wantCode {
+				t.Errorf("rw.Code: got %v, want %v", rw.Code, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestTimeoutCanceledAfterResponse(t *testing.T) {
+	mb := safehttp.NewServeMuxConfig(nil)
+	mb.Intercept(timeout.Interceptor{Timeout: time.Hour})
+	mux := mb.Mux()
+	var ctx context.Context
+	mux.Handle("/", safehttp.MethodGet, safehttp.HandlerFunc(func(w safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+		ctx = r.Context()
+		return w.Write(safehttp.NoContentResponse{})
+	}))
+
+	mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(safehttp.MethodGet, "/", nil))
+	if !errors.Is(ctx.Err(), context.Canceled) {
+		t.Errorf("ctx.Err() after the response: got %v, want %v", ctx.Err(), context.Canceled)
+	}
+}
+
+func TestTimeoutContextDone(t *testing.T) {
+	mb := safehttp.NewServeMuxConfig(nil)
+	mb.Intercept(timeout.Interceptor{Timeout: time.Minute})
+	mux := mb.Mux()
+	mux.Handle("/", safehttp.MethodGet, safehttp.HandlerFunc(func(w safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+		t.Error("handler called with a canceled context")
+		return w.Write(safehttp.NoContentResponse{})
+	}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	rw := httptest.NewRecorder()
+	mux.ServeHTTP(rw, httptest.NewRequest(safehttp.MethodGet, "/", nil).WithContext(ctx))
+
+	if want := http.StatusServiceUnavailable; rw.Code != want {
+		t.Errorf("rw.Code: got %v, want %v", rw.Code, want)
+	}
+}
+
+func TestReadTimeout(t *testing.T) {
+	mb := safehttp.NewServeMuxConfig(nil)
+	clock := safehttptest.NewFakeClock(time.Now())
+	mb.Intercept(timeout.Interceptor{ReadTimeout: 10 * time.Millisecond, Clock: clock})
+	mux := mb.Mux()
+	var readErr error
+	mux.Handle("/", safehttp.MethodPost, safehttp.HandlerFunc(func(w safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+		clock.Advance(20 * time.Millisecond)
+		_, readErr = ioutil.ReadAll(r.Body())
+		return w.Write(safehttp.NoContentResponse{})
+	}))
+
+	rw := httptest.NewRecorder()
+	mux.ServeHTTP(rw, httptest.NewRequest(safehttp.MethodPost, "/", strings.NewReader("body")))
+
+	if !errors.Is(readErr, timeout.ErrReadTimeout) {
+		t.Errorf("reading the body: got %v, want ErrReadTimeout", readErr)
+	}
+}
@@ -0,0 +1,92 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package uploadscan
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/google/go-safeweb/safehttp"
+)
+
+// clamAVChunkSize is the size of the chunks the content is streamed in.
+const clamAVChunkSize = 64 << 10
+
+// ClamAV scans uploaded files with a clamd daemon.
+type ClamAV struct {
+	// Network is the network of the daemon, "tcp" or "unix". If empty, "tcp"
+	// is used.
+	Network string
+	// Address is the address of the daemon, e.g. "localhost:3310".
+	Address string
+}
+
+var _ safehttp.UploadScanner = ClamAV{}
+
+// Scan streams the content of the file to clamd and returns an error wrapping
+// safehttp.ErrUploadRejected, and naming the signature, if it's infected.
+func (c ClamAV) Scan(ctx context.Context, f *safehttp.UploadedFile, content io.Reader) error {
+	conn, err := dial(ctx, c.Network, c.Address)
+	if err != nil {
+		return fmt.Errorf("connecting to clamd: %v", err)
+	}
+	defer conn.Close()
+
+	w := bufio.NewWriter(conn)
+	w.WriteString("zINSTREAM\x00")
+	buf := make([]byte, clamAVChunkSize)
+	size := make([]byte, 4)
+	for {
+		n, err := content.Read(buf)
+		if n > 0 {
+			binary.BigEndian.PutUint32(size, uint32(n))
+			w.Write(size)
+			w.Write(buf[:n])
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	binary.BigEndian.PutUint32(size, 0)
+	w.Write(size)
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("streaming to clamd: %v", err)
+	}
+
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil && err != io.EOF {
+		return fmt.Errorf("reading clamd reply: %v", err)
+	}
+	reply = string(bytes.TrimRight([]byte(reply), "\x00\n"))
+	// Replies look like "stream: OK", "stream: <signature> FOUND" or
+	// "<message> ERROR".
+	switch {
+	case strings.HasSuffix(reply, " OK"):
+		return nil
+	case strings.HasSuffix(reply, " FOUND"):
+		sig := strings.TrimSuffix(strings.TrimPrefix(reply, "stream: "), " FOUND")
+		return fmt.Errorf("%w: %s", safehttp.ErrUploadRejected, sig)
+	default:
+		return fmt.Errorf("clamd: %s", reply)
+	}
+}
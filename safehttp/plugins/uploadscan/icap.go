@@ -0,0 +1,113 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package uploadscan
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/google/go-safeweb/safehttp"
+)
+
+// ICAP scans uploaded files with an ICAP server (RFC 3507), by sending them as
+// the body of an HTTP request in a REQMOD request.
+type ICAP struct {
+	// Address is the address of the server, e.g. "localhost:1344".
+	Address string
+	// Service is the name of the scanning service, e.g. "avscan".
+	Service string
+}
+
+var _ safehttp.UploadScanner = ICAP{}
+
+// Scan sends the content of the file to the ICAP server. The file is clean if
+// the server doesn't need to modify the request (204 No Content), and an error
+// wrapping safehttp.ErrUploadRejected is returned if it's modified or blocked.
+func (c ICAP) Scan(ctx context.Context, f *safehttp.UploadedFile, content io.Reader) error {
+	conn, err := dial(ctx, "tcp", c.Address)
+	if err != nil {
+		return fmt.Errorf("connecting to ICAP server: %v", err)
+	}
+	defer conn.Close()
+
+	host := c.Address
+	if i := strings.LastIndexByte(host, ':'); i >= 0 {
+		host = host[:i]
+	}
+	reqHdr := "POST /" + url.PathEscape(f.Filename) + " HTTP/1.1\r\n" +
+		"Host: " + host + "\r\n" +
+		"Content-Type: " + f.ContentType + "\r\n" +
+		"Content-Length: " + strconv.FormatInt(f.Size, 10) + "\r\n\r\n"
+	w := bufio.NewWriter(conn)
+	fmt.Fprintf(w, "REQMOD icap://%s/%s ICAP/1.0\r\n", c.Address, c.Service)
+	fmt.Fprintf(w, "Host: %s\r\n", host)
+	w.WriteString("Allow: 204\r\n")
+	fmt.Fprintf(w, "Encapsulated: req-hdr=0, req-body=%d\r\n\r\n", len(reqHdr))
+	w.WriteString(reqHdr)
+	buf := make([]byte, 64<<10)
+	for {
+		n, err := content.Read(buf)
+		if n > 0 {
+			fmt.Fprintf(w, "%x\r\n", n)
+			w.Write(buf[:n])
+			w.WriteString("\r\n")
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	w.WriteString("0\r\n\r\n")
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("sending to ICAP server: %v", err)
+	}
+
+	tr := textproto.NewReader(bufio.NewReader(conn))
+	status, err := tr.ReadLine()
+	if err != nil {
+		return fmt.Errorf("reading ICAP response: %v", err)
+	}
+	h, err := tr.ReadMIMEHeader()
+	if err != nil && err != io.EOF {
+		return fmt.Errorf("reading ICAP response: %v", err)
+	}
+	parts := strings.SplitN(status, " ", 3)
+	if len(parts) < 2 || parts[0] != "ICAP/1.0" {
+		return fmt.Errorf("malformed ICAP status line %q", status)
+	}
+	switch parts[1] {
+	case "204":
+		return nil
+	case "200":
+		reason := h.Get("X-Infection-Found")
+		if reason == "" {
+			reason = h.Get("X-Virus-ID")
+		}
+		if reason == "" {
+			reason = "blocked by ICAP server"
+		}
+		return fmt.Errorf("%w: %s", safehttp.ErrUploadRejected, reason)
+	default:
+		return fmt.Errorf("ICAP server: %s", status)
+	}
+}
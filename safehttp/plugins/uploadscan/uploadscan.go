@@ -0,0 +1,52 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package uploadscan provides safehttp.UploadScanner implementations backed by
+// malware scanners: ClamAV, through the clamd INSTREAM command, and any ICAP
+// server supporting request modification.
+//
+// # Usage
+//
+//	form, err := r.Uploads(safehttp.UploadOptions{
+//		Scanner: uploadscan.ClamAV{Address: "localhost:3310"},
+//		OnScan: func(s safehttp.UploadScan) {
+//			// Record metrics, quarantine rejected files, ...
+//		},
+//	})
+//	if errors.Is(err, safehttp.ErrUploadRejected) {
+//		return w.WriteError(safehttp.StatusUnprocessableEntity)
+//	}
+package uploadscan
+
+import (
+	"context"
+	"net"
+)
+
+// dial connects to the scanner and bounds the connection by the deadline of
+// the context, if any.
+func dial(ctx context.Context, network, address string) (net.Conn, error) {
+	if network == "" {
+		network = "tcp"
+	}
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, network, address)
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	return conn, nil
+}
@@ -0,0 +1,176 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package uploadscan_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/textproto"
+	"strings"
+	"testing"
+
+	"github.com/google/go-safeweb/safehttp"
+	"github.com/google/go-safeweb/safehttp/plugins/uploadscan"
+)
+
+const eicar = `X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`
+
+// serve accepts a single connection on a local listener and handles it with
+// h. The returned channel is closed once h returns.
+func serve(t *testing.T, h func(net.Conn)) (string, <-chan struct{}) {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.Listen() got err: %v", err)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer l.Close()
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		h(conn)
+	}()
+	return l.Addr().String(), done
+}
+
+func fakeClamd(t *testing.T) string {
+	addr, _ := serve(t, func(conn net.Conn) {
+		r := bufio.NewReader(conn)
+		cmd, err := r.ReadString(0)
+		if err != nil || cmd != "zINSTREAM\x00" {
+			conn.Write([]byte("UNKNOWN COMMAND ERROR\x00"))
+			return
+		}
+		var content bytes.Buffer
+		size := make([]byte, 4)
+		for {
+			if _, err := io.ReadFull(r, size); err != nil {
+				return
+			}
+			n := binary.BigEndian.Uint32(size)
+			if n == 0 {
+				break
+			}
+			io.CopyN(&content, r, int64(n))
+		}
+		if strings.Contains(content.String(), eicar) {
+			conn.Write([]byte("stream: Eicar-Test-Signature FOUND\x00"))
+			return
+		}
+		conn.Write([]byte("stream: OK\x00"))
+	})
+	return addr
+}
+
+func fakeICAP(t *testing.T) string {
+	addr, _ := serve(t, func(conn net.Conn) {
+		br := bufio.NewReader(conn)
+		tr := textproto.NewReader(br)
+		line, err := tr.ReadLine()
+		if err != nil || !strings.HasPrefix(line, "REQMOD icap://") {
+			conn.Write([]byte("ICAP/1.0 400 Bad Request\r\n\r\n"))
+			return
+		}
+		if _, err := tr.ReadMIMEHeader(); err != nil {
+			return
+		}
+		// The encapsulated HTTP request, followed by the chunked body.
+		if _, err := http.ReadRequest(br); err != nil {
+			conn.Write([]byte("ICAP/1.0 400 Bad Request\r\n\r\n"))
+			return
+		}
+		body, _ := ioutil.ReadAll(httputil.NewChunkedReader(br))
+		if strings.Contains(string(body), eicar) {
+			conn.Write([]byte("ICAP/1.0 200 OK\r\nX-Infection-Found: Type=0; Resolution=2; Threat=EICAR;\r\nEncapsulated: null-body=0\r\n\r\n"))
+			return
+		}
+		conn.Write([]byte("ICAP/1.0 204 No Content\r\nEncapsulated: null-body=0\r\n\r\n"))
+	})
+	return addr
+}
+
+func TestScanners(t *testing.T) {
+	scanners := []struct {
+		name    string
+		scanner func(t *testing.T) safehttp.UploadScanner
+	}{
+		{
+			name: "ClamAV",
+			scanner: func(t *testing.T) safehttp.UploadScanner {
+				return uploadscan.ClamAV{Address: fakeClamd(t)}
+			},
+		},
+		{
+			name: "ICAP",
+			scanner: func(t *testing.T) safehttp.UploadScanner {
+				return uploadscan.ICAP{Address: fakeICAP(t), Service: "avscan"}
+			},
+		},
+	}
+	for _, s := range scanners {
+		t.Run(s.name, func(t *testing.T) {
+			tests := []struct {
+				name, content string
+				wantRejected  bool
+			}{
+				{name: "Clean", content: "hello"},
+				{name: "Large", content: strings.Repeat("a", 200<<10)},
+				{name: "Infected", content: eicar, wantRejected: true},
+			}
+			for _, tt := range tests {
+				t.Run(tt.name, func(t *testing.T) {
+					f := &safehttp.UploadedFile{Filename: "a b.txt", Size: int64(len(tt.content)), ContentType: "text/plain"}
+					err := s.scanner(t).Scan(context.Background(), f, strings.NewReader(tt.content))
+					if got := errors.Is(err, safehttp.ErrUploadRejected); got != tt.wantRejected {
+						t.Errorf("Scan() got err: %v, want rejected: %v", err, tt.wantRejected)
+					}
+					if !tt.wantRejected && err != nil {
+						t.Errorf("Scan() got err: %v", err)
+					}
+				})
+			}
+		})
+	}
+}
+
+func TestScanUnavailable(t *testing.T) {
+	// Grab a free port and close it, so that connecting fails.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.Listen() got err: %v", err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	f := &safehttp.UploadedFile{Filename: "a.txt"}
+	for _, s := range []safehttp.UploadScanner{uploadscan.ClamAV{Address: addr}, uploadscan.ICAP{Address: addr}} {
+		err := s.Scan(context.Background(), f, strings.NewReader("a"))
+		if err == nil || errors.Is(err, safehttp.ErrUploadRejected) {
+			t.Errorf("%T.Scan() got err: %v, want connection error", s, err)
+		}
+	}
+}
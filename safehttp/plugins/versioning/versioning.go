@@ -0,0 +1,201 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package versioning provides a safehttp.Handler routing requests to the
+// handler of the API version they ask for.
+//
+// # Usage
+//
+// Create a Router with the Extractor matching how clients specify the
+// version, register a handler per version and register the Router itself on
+// the safehttp.ServeMux:
+//
+//	rt := versioning.NewRouter(versioning.PathPrefix())
+//	rt.Handle("v1", itemsV1)
+//	rt.Handle("v2", itemsV2)
+//	rt.Default("v2")
+//	mux.Handle("/", safehttp.MethodGet, rt)
+package versioning
+
+import (
+	"mime"
+	"strings"
+	"sync"
+
+	"github.com/google/go-safeweb/safehttp"
+)
+
+// Extractor extracts the requested API version from a request. It returns an
+// empty version if the request doesn't specify one, and the request to pass
+// to the version handler, e.g. with the version stripped from its path.
+type Extractor func(r *safehttp.IncomingRequest) (version string, vr *safehttp.IncomingRequest)
+
+// PathPrefix extracts the version from the first segment of the path, e.g.
+// "v2" from "/v2/items", if that segment is a "v" followed by digits. The
+// version is stripped from the path passed to the version handler, which
+// sees "/items".
+func PathPrefix() Extractor {
+	return func(r *safehttp.IncomingRequest) (string, *safehttp.IncomingRequest) {
+		p := strings.TrimPrefix(r.URL().Path(), "/")
+		seg := p
+		if i := strings.IndexByte(p, '/'); i >= 0 {
+			seg = p[:i]
+		}
+		if !isPathVersion(seg) {
+			return "", r
+		}
+		vr, err := r.WithStrippedURLPrefix("/" + seg)
+		if err != nil {
+			// The version is escaped in the raw path, which clients don't
+			// do for a plain version.
+			return "", r
+		}
+		return seg, vr
+	}
+}
+
+func isPathVersion(s string) bool {
+	if len(s) < 2 || s[0] != 'v' {
+		return false
+	}
+	for _, c := range s[1:] {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+type varyKey struct{}
+
+// vary records that the version of r is extracted from the named request
+// header, which the Router adds to the Vary header of the response.
+func vary(r *safehttp.IncomingRequest, name string) {
+	fv := safehttp.FlightValues(r.Context())
+	if fv == nil {
+		return
+	}
+	names, _ := fv.Get(varyKey{}).([]string)
+	fv.Put(varyKey{}, append(names, name))
+}
+
+// Header extracts the version from the value of the given request header,
+// e.g. "Api-Version: 2".
+func Header(name string) Extractor {
+	return func(r *safehttp.IncomingRequest) (string, *safehttp.IncomingRequest) {
+		vary(r, name)
+		return strings.TrimSpace(r.Header.Get(name)), r
+	}
+}
+
+// AcceptParameter extracts the version from the given parameter of the media
+// types in the Accept header, e.g. "2" from
+// "Accept: application/vnd.example+json; version=2" for the "version"
+// parameter. The first media type with the parameter wins.
+func AcceptParameter(param string) Extractor {
+	return func(r *safehttp.IncomingRequest) (string, *safehttp.IncomingRequest) {
+		vary(r, "Accept")
+		for _, accept := range r.Header.Values("Accept") {
+			for _, mt := range strings.Split(accept, ",") {
+				_, params, err := mime.ParseMediaType(mt)
+				if err != nil {
+					continue
+				}
+				if v := params[param]; v != "" {
+					return v, r
+				}
+			}
+		}
+		return "", r
+	}
+}
+
+// Router is a safehttp.Handler dispatching requests to the handler of their
+// API version. It's safe for concurrent use once the handlers are registered.
+type Router struct {
+	extract  Extractor
+	handlers map[string]safehttp.Handler
+	fallback string
+
+	mu      sync.Mutex
+	traffic map[string]int64
+}
+
+var _ safehttp.Handler = (*Router)(nil)
+
+// NewRouter creates a Router using extract to find the requested version.
+func NewRouter(extract Extractor) *Router {
+	return &Router{
+		extract:  extract,
+		handlers: map[string]safehttp.Handler{},
+		traffic:  map[string]int64{},
+	}
+}
+
+// Handle registers the handler for the given version. It panics if a handler
+// is already registered for that version.
+func (rt *Router) Handle(version string, h safehttp.Handler) {
+	if version == "" {
+		panic("versioning: empty version")
+	}
+	if _, ok := rt.handlers[version]; ok {
+		panic("versioning: multiple handlers for version " + version)
+	}
+	rt.handlers[version] = h
+}
+
+// Default sets the version used for requests which don't specify one. Without
+// a default version, those requests are responded to with 404 Not Found, like
+// requests for versions without a handler.
+func (rt *Router) Default(version string) {
+	rt.fallback = version
+}
+
+// ServeHTTP dispatches the request to the handler of its version. If the
+// version is extracted from a request header, the header is added to the Vary
+// header of the response, so that shared caches don't mix up versions.
+func (rt *Router) ServeHTTP(w safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+	v, vr := rt.extract(r)
+	if fv := safehttp.FlightValues(r.Context()); fv != nil {
+		if names, ok := fv.Get(varyKey{}).([]string); ok {
+			w.Header().Vary(names...)
+		}
+	}
+	if v == "" {
+		v = rt.fallback
+	}
+	h, ok := rt.handlers[v]
+	if !ok {
+		return w.WriteError(safehttp.StatusNotFound)
+	}
+
+	rt.mu.Lock()
+	rt.traffic[v]++
+	rt.mu.Unlock()
+	return h.ServeHTTP(w, vr)
+}
+
+// Traffic returns the number of requests served by each registered version
+// since the Router was created, including versions which didn't receive any.
+// Requests for versions without a handler aren't counted, so that clients
+// can't grow the report.
+func (rt *Router) Traffic() map[string]int64 {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	traffic := make(map[string]int64, len(rt.handlers))
+	for v := range rt.handlers {
+		traffic[v] = rt.traffic[v]
+	}
+	return traffic
+}
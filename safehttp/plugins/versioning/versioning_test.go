@@ -0,0 +1,136 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package versioning_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-safeweb/safehttp"
+	"github.com/google/go-safeweb/safehttp/plugins/versioning"
+	"github.com/google/safehtml"
+)
+
+func versionHandler(version string) safehttp.Handler {
+	return safehttp.HandlerFunc(func(w safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+		return w.Write(safehtml.HTMLEscaped(version + " " + r.URL().Path()))
+	})
+}
+
+func newMux(extract versioning.Extractor) (*safehttp.ServeMux, *versioning.Router) {
+	rt := versioning.NewRouter(extract)
+	rt.Handle("v1", versionHandler("v1"))
+	rt.Handle("v2", versionHandler("v2"))
+	rt.Handle("v3", versionHandler("v3"))
+	rt.Default("v1")
+	mux := safehttp.NewServeMuxConfig(nil).Mux()
+	mux.Handle("/", safehttp.MethodGet, rt)
+	return mux, rt
+}
+
+func TestRouter(t *testing.T) {
+	tests := []struct {
+		name     string
+		extract  versioning.Extractor
+		target   string
+		header   map[string]string
+		wantCode int
+		wantBody string
+		wantVary string
+	}{
+		{
+			name:     "Path prefix",
+			extract:  versioning.PathPrefix(),
+			target:   "/v2/items",
+			wantCode: http.StatusOK,
+			wantBody: "v2 /items",
+		},
+		{
+			name:     "Path prefix, default",
+			extract:  versioning.PathPrefix(),
+			target:   "/items",
+			wantCode: http.StatusOK,
+			wantBody: "v1 /items",
+		},
+		{
+			name:     "Path prefix, unknown version",
+			extract:  versioning.PathPrefix(),
+			target:   "/v9/items",
+			wantCode: http.StatusNotFound,
+			wantBody: "Not Found\n",
+		},
+		{
+			name:     "Header",
+			extract:  versioning.Header("Api-Version"),
+			target:   "/items",
+			header:   map[string]string{"Api-Version": "v2"},
+			wantCode: http.StatusOK,
+			wantBody: "v2 /items",
+			wantVary: "Api-Version",
+		},
+		{
+			name:     "Header, default",
+			extract:  versioning.Header("Api-Version"),
+			target:   "/items",
+			wantCode: http.StatusOK,
+			wantBody: "v1 /items",
+			wantVary: "Api-Version",
+		},
+		{
+			name:     "Accept parameter",
+			extract:  versioning.AcceptParameter("version"),
+			target:   "/items",
+			header:   map[string]string{"Accept": "text/html, application/vnd.example+json; version=v2"},
+			wantCode: http.StatusOK,
+			wantBody: "v2 /items",
+			wantVary: "Accept",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mux, _ := newMux(tt.extract)
+			req := httptest.NewRequest(http.MethodGet, "https://foo.com"+tt.target, nil)
+			for k, v := range tt.header {
+				req.Header.Set(k, v)
+			}
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, req)
+
+			if got := rr.Code; got != tt.wantCode {
+				t.Errorf("rr.Code: got %v, want %v", got, tt.wantCode)
+			}
+			if got := rr.Body.String(); got != tt.wantBody {
+				t.Errorf("rr.Body: got %q, want %q", got, tt.wantBody)
+			}
+			if got := rr.Header().Get("Vary"); got != tt.wantVary {
+				t.Errorf("Vary: got %q, want %q", got, tt.wantVary)
+			}
+		})
+	}
+}
+
+func TestRouterTraffic(t *testing.T) {
+	mux, rt := newMux(versioning.PathPrefix())
+	for _, target := range []string{"/v1/a", "/a", "/v2/a", "/v7/a"} {
+		mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "https://foo.com"+target, nil))
+	}
+
+	want := map[string]int64{"v1": 2, "v2": 1, "v3": 0}
+	if diff := cmp.Diff(want, rt.Traffic()); diff != "" {
+		t.Errorf("rt.Traffic() mismatch (-want +got):\n%s", diff)
+	}
+}
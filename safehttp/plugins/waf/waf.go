@@ -0,0 +1,333 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package waf provides a safehttp.Interceptor detecting, and optionally
+// blocking, requests carrying common injection and path traversal payloads.
+//
+// Rules are scored, similarly to the OWASP Core Rule Set: a request is
+// considered an attack when the scores of the rules it matches add up to the
+// threshold. This is a baseline for deployments without an external WAF, not
+// a replacement for the safe APIs of the framework.
+//
+// # Usage
+//
+// Install an Interceptor using safehttp.ServeMuxConfig.Intercept. Pass it an
+// inspect.Inspector to also inspect request bodies:
+//
+//	metrics := &waf.Metrics{}
+//	cfg.Intercept(waf.Interceptor{
+//		Rules:     waf.DefaultRules(),
+//		Inspector: inspect.NewInspector(inspect.Options{}),
+//		Metrics:   metrics,
+//	})
+//
+// Use a Config to change the sensitivity of specific handlers.
+package waf
+
+import (
+	"log"
+	"mime"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/google/go-safeweb/safehttp"
+	"github.com/google/go-safeweb/safehttp/plugins/inspect"
+	"github.com/google/go-safeweb/safehttp/restricted"
+)
+
+// Target is a set of request parts a rule applies to.
+type Target int
+
+const (
+	// Path is the decoded path of the request URL.
+	Path Target = 1 << iota
+	// Query is the decoded query of the request URL.
+	Query
+	// Headers are the values of the request headers, except Cookie.
+	Headers
+	// Body is the part of the request body returned by the inspect.Inspector.
+	// Form bodies (application/x-www-form-urlencoded) are matched both as
+	// they are and decoded.
+	Body
+
+	// All is every part of the request.
+	All = Path | Query | Headers | Body
+)
+
+// Rule is a detection rule.
+type Rule struct {
+	// ID identifies the rule in detections and metrics.
+	ID string
+	// Pattern is matched against the lowercased request parts in Targets.
+	Pattern *regexp.Regexp
+	// Targets are the request parts the rule applies to.
+	Targets Target
+	// Score is added to the score of the request when the rule matches.
+	Score int
+}
+
+// DefaultRules returns baseline rules detecting SQL injection, cross-site
+// scripting, path traversal and command injection payloads.
+func DefaultRules() []Rule {
+	return []Rule{
+		{ID: "sqli-union", Pattern: regexp.MustCompile(`\bunion\b[\s\S]*\bselect\b`), Targets: Query | Body, Score: 5},
+		{ID: "sqli-tautology", Pattern: regexp.MustCompile(`['"]\s*or\s+['"]?\w+['"]?\s*=\s*['"]?\w+`), Targets: Query | Body, Score: 5},
+		{ID: "sqli-comment", Pattern: regexp.MustCompile(`['"]\s*(--|#|/\*)`), Targets: Query | Body, Score: 3},
+		{ID: "xss-script", Pattern: regexp.MustCompile(`<\s*script\b`), Targets: Query | Body | Headers, Score: 5},
+		{ID: "xss-handler", Pattern: regexp.MustCompile(`\bon(error|load|mouseover|focus)\s*=`), Targets: Query | Body, Score: 3},
+		{ID: "xss-scheme", Pattern: regexp.MustCompile(`javascript\s*:`), Targets: Query | Body, Score: 3},
+		{ID: "traversal", Pattern: regexp.MustCompile(`(^|[/\\])\.\.([/\\]|$)`), Targets: Path | Query, Score: 5},
+		{ID: "traversal-sensitive-file", Pattern: regexp.MustCompile(`/etc/(passwd|shadow)|win\.ini`), Targets: Path | Query | Body, Score: 5},
+		{ID: "cmdi", Pattern: regexp.MustCompile(`[;&|]\s*(cat|curl|wget|nc|sh|bash)\b|\$\(`), Targets: Query | Body, Score: 5},
+	}
+}
+
+// DefaultThreshold is the score at which requests are considered attacks
+// when no threshold is configured.
+const DefaultThreshold = 5
+
+// Detection describes a request considered an attack.
+type Detection struct {
+	// Score is the sum of the scores of the matched rules.
+	Score int
+	// Rules are the IDs of the matched rules.
+	Rules []string
+	// Blocked reports whether the request was blocked.
+	Blocked bool
+}
+
+// Interceptor evaluates the rules against requests and blocks the ones
+// considered attacks with a 403 Forbidden, unless configured to only detect
+// them.
+type Interceptor struct {
+	// Rules are the detection rules.
+	Rules []Rule
+	// Threshold is the score at which requests are considered attacks. If
+	// zero, DefaultThreshold is used.
+	Threshold int
+	// DetectOnly disables blocking: attacks are only reported.
+	DetectOnly bool
+	// Inspector, if non-nil, gives access to the request bodies. Otherwise,
+	// rules targeting the Body are ignored.
+	Inspector *inspect.Inspector
+	// OnDetection is called for every request considered an attack. If nil,
+	// detections are logged.
+	OnDetection func(r *safehttp.IncomingRequest, d Detection)
+	// Metrics, if non-nil, counts the evaluated requests and detections.
+	Metrics *Metrics
+}
+
+var _ safehttp.Interceptor = Interceptor{}
+
+// Config is a safehttp.InterceptorConfig changing the sensitivity of the WAF
+// for a specific handler.
+type Config struct {
+	// Threshold overrides the threshold of the Interceptor, if non-zero.
+	// Lower it for sensitive endpoints, raise it for endpoints legitimately
+	// receiving payloads which look like attacks, e.g. code snippets.
+	Threshold int
+	// DetectOnly disables blocking for the handler.
+	DetectOnly bool
+	// Disabled disables the WAF for the handler.
+	Disabled bool
+}
+
+// Before evaluates the rules against the request and, if it's considered an
+// attack, reports it and writes a 403 Forbidden response unless blocking is
+// disabled.
+func (it Interceptor) Before(w safehttp.ResponseWriter, r *safehttp.IncomingRequest, cfg safehttp.InterceptorConfig) safehttp.Result {
+	threshold, detectOnly := it.Threshold, it.DetectOnly
+	if c, ok := cfg.(Config); ok {
+		if c.Disabled {
+			return safehttp.NotWritten()
+		}
+		if c.Threshold != 0 {
+			threshold = c.Threshold
+		}
+		detectOnly = detectOnly || c.DetectOnly
+	}
+	if threshold == 0 {
+		threshold = DefaultThreshold
+	}
+
+	d := it.evaluate(r)
+	attack := d.Score >= threshold
+	d.Blocked = attack && !detectOnly
+	if it.Metrics != nil {
+		it.Metrics.record(d, attack)
+	}
+	if !attack {
+		return safehttp.NotWritten()
+	}
+	if it.OnDetection != nil {
+		it.OnDetection(r, d)
+	} else {
+		log.Printf("waf: %s %q matched rules %v with score %d (blocked: %v)", r.Method(), r.URL().Path(), d.Rules, d.Score, d.Blocked)
+	}
+	if d.Blocked {
+		return w.WriteError(safehttp.StatusForbidden)
+	}
+	return safehttp.NotWritten()
+}
+
+func (it Interceptor) evaluate(r *safehttp.IncomingRequest) Detection {
+	req := restricted.RawRequest(r)
+	parts := map[Target][]string{
+		Path:  {strings.ToLower(req.URL.Path)},
+		Query: {strings.ToLower(formUnescape(req.URL.RawQuery))},
+	}
+	for name, values := range req.Header {
+		if name == "Cookie" {
+			continue
+		}
+		for _, v := range values {
+			parts[Headers] = append(parts[Headers], strings.ToLower(v))
+		}
+	}
+	if it.Inspector != nil {
+		// Errors reading the body are left for the handler to deal with.
+		if b, _, err := it.Inspector.Body(r); err == nil && len(b) > 0 {
+			parts[Body] = []string{strings.ToLower(string(b))}
+			if mt, _, err := mime.ParseMediaType(req.Header.Get("Content-Type")); err == nil && mt == "application/x-www-form-urlencoded" {
+				parts[Body] = append(parts[Body], strings.ToLower(formUnescape(string(b))))
+			}
+		}
+	}
+
+	var d Detection
+	for _, rule := range it.Rules {
+		if matchesAny(rule, parts) {
+			d.Score += rule.Score
+			d.Rules = append(d.Rules, rule.ID)
+		}
+	}
+	return d
+}
+
+func matchesAny(rule Rule, parts map[Target][]string) bool {
+	for _, t := range []Target{Path, Query, Headers, Body} {
+		if rule.Targets&t == 0 {
+			continue
+		}
+		for _, p := range parts[t] {
+			if rule.Pattern.MatchString(p) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// formUnescape decodes the percent-encoding and the pluses of a query or of a
+// form body. Unlike url.QueryUnescape, it doesn't give up on malformed escapes,
+// which are kept as they are, so that a single one can't hide the rest of the
+// payload.
+func formUnescape(raw string) string {
+	var b strings.Builder
+	b.Grow(len(raw))
+	for i := 0; i < len(raw); i++ {
+		switch c := raw[i]; {
+		case c == '+':
+			b.WriteByte(' ')
+		case c == '%' && i+2 < len(raw) && isHex(raw[i+1]) && isHex(raw[i+2]):
+			b.WriteByte(unhex(raw[i+1])<<4 | unhex(raw[i+2]))
+			i += 2
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+func isHex(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+func unhex(c byte) byte {
+	switch {
+	case c >= 'a':
+		return c - 'a' + 10
+	case c >= 'A':
+		return c - 'A' + 10
+	}
+	return c - '0'
+}
+
+// Commit is a no-op, required to satisfy the safehttp.Interceptor interface.
+func (Interceptor) Commit(w safehttp.ResponseHeadersWriter, r *safehttp.IncomingRequest, resp safehttp.Response, _ safehttp.InterceptorConfig) {
+}
+
+// Match recognizes Configs as WAF configurations.
+func (Interceptor) Match(cfg safehttp.InterceptorConfig) bool {
+	_, ok := cfg.(Config)
+	return ok
+}
+
+// Metrics counts the requests evaluated by an Interceptor. The zero value is
+// valid and ready to use. It's safe for concurrent use.
+type Metrics struct {
+	mu        sync.Mutex
+	evaluated int64
+	detected  int64
+	blocked   int64
+	rules     map[string]int64
+}
+
+// MetricsSnapshot is a point-in-time copy of Metrics.
+type MetricsSnapshot struct {
+	// Evaluated is the number of requests the rules were evaluated against.
+	Evaluated int64
+	// Detected is the number of requests considered attacks.
+	Detected int64
+	// Blocked is the number of requests blocked.
+	Blocked int64
+	// Rules is the number of attacks each rule matched, by ID.
+	Rules map[string]int64
+}
+
+func (m *Metrics) record(d Detection, attack bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.evaluated++
+	if !attack {
+		return
+	}
+	m.detected++
+	if d.Blocked {
+		m.blocked++
+	}
+	if m.rules == nil {
+		m.rules = map[string]int64{}
+	}
+	for _, id := range d.Rules {
+		m.rules[id]++
+	}
+}
+
+// Snapshot returns the current values of the metrics.
+func (m *Metrics) Snapshot() MetricsSnapshot {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s := MetricsSnapshot{
+		Evaluated: m.evaluated,
+		Detected:  m.detected,
+		Blocked:   m.blocked,
+		Rules:     make(map[string]int64, len(m.rules)),
+	}
+	for id, n := range m.rules {
+		s.Rules[id] = n
+	}
+	return s
+}
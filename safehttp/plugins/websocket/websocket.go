@@ -0,0 +1,159 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package websocket provides a safehttp.Handler upgrading requests to the
+// WebSocket protocol once they are deemed safe.
+//
+// Browsers don't apply the same-origin policy to WebSockets, so any website
+// can open one to the application with the cookies of the user (Cross-Site
+// WebSocket Hijacking). The handler only upgrades requests whose Origin is the
+// one of the application, or explicitly allowed.
+//
+// # Usage
+//
+// Register the handler for GET requests:
+//
+//	mux.Handle("/chat", safehttp.MethodGet, websocket.Handler(websocket.Options{}, func(c *websocket.Conn) {
+//		for {
+//			msg, err := c.ReadText()
+//			if err != nil {
+//				return
+//			}
+//			c.WriteText("echo: " + msg)
+//		}
+//	}))
+package websocket
+
+import (
+	"context"
+	"net/url"
+	"strings"
+
+	"github.com/google/go-safeweb/safehttp"
+	xwebsocket "golang.org/x/net/websocket"
+)
+
+// DefaultMaxMessageBytes is the maximum size of received messages used when
+// none is configured.
+const DefaultMaxMessageBytes = 1 << 20
+
+// Options configure the upgrade of requests.
+type Options struct {
+	// AllowedOrigins are the origins, other than the one of the application,
+	// allowed to open WebSockets, e.g. "https://app.example.com".
+	AllowedOrigins []string
+	// MaxMessageBytes is the maximum size of the messages received by Conns.
+	// If zero, DefaultMaxMessageBytes is used.
+	MaxMessageBytes int
+}
+
+// Conn is a WebSocket connection.
+type Conn struct {
+	ws  *xwebsocket.Conn
+	ctx context.Context
+}
+
+// Context returns the context of the upgrade request.
+func (c *Conn) Context() context.Context {
+	return c.ctx
+}
+
+// ReadText reads a text message.
+func (c *Conn) ReadText() (string, error) {
+	var s string
+	err := xwebsocket.Message.Receive(c.ws, &s)
+	return s, err
+}
+
+// WriteText writes a text message.
+func (c *Conn) WriteText(s string) error {
+	return xwebsocket.Message.Send(c.ws, s)
+}
+
+// ReadJSON reads a text message and unmarshals it, as JSON, into v.
+func (c *Conn) ReadJSON(v interface{}) error {
+	return xwebsocket.JSON.Receive(c.ws, v)
+}
+
+// WriteJSON writes v, marshalled as JSON, as a text message.
+func (c *Conn) WriteJSON(v interface{}) error {
+	return xwebsocket.JSON.Send(c.ws, v)
+}
+
+// Close closes the connection.
+func (c *Conn) Close() error {
+	return c.ws.Close()
+}
+
+// Handler returns a safehttp.Handler upgrading requests to the WebSocket
+// protocol and calling serve with the connection, which is closed when serve
+// returns.
+//
+// It responds with 400 Bad Request to requests which are not WebSocket
+// upgrade requests, and with 403 Forbidden to requests without an allowed
+// Origin or whose Fetch Metadata shows they were not made by the WebSocket
+// API.
+func Handler(opts Options, serve func(*Conn)) safehttp.Handler {
+	allowed := map[string]bool{}
+	for _, o := range opts.AllowedOrigins {
+		allowed[strings.ToLower(o)] = true
+	}
+	max := opts.MaxMessageBytes
+	if max == 0 {
+		max = DefaultMaxMessageBytes
+	}
+	return safehttp.HandlerFunc(func(w safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+		if !headerHasToken(r.Header.Get("Upgrade"), "websocket") || !headerHasToken(r.Header.Get("Connection"), "upgrade") {
+			return w.WriteError(safehttp.StatusBadRequest)
+		}
+		if !allowedOrigin(r, allowed) {
+			return w.WriteError(safehttp.StatusForbidden)
+		}
+		if mode := r.Header.Get("Sec-Fetch-Mode"); mode != "" && mode != "websocket" {
+			return w.WriteError(safehttp.StatusForbidden)
+		}
+		ctx := r.Context()
+		return w.Write(safehttp.WebSocketResponse{
+			Request: r,
+			Serve: func(ws *xwebsocket.Conn) {
+				ws.MaxPayloadBytes = max
+				serve(&Conn{ws: ws, ctx: ctx})
+			},
+		})
+	})
+}
+
+func headerHasToken(v, token string) bool {
+	for _, t := range strings.Split(v, ",") {
+		if strings.EqualFold(strings.TrimSpace(t), token) {
+			return true
+		}
+	}
+	return false
+}
+
+func allowedOrigin(r *safehttp.IncomingRequest, allowed map[string]bool) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return false
+	}
+	if allowed[strings.ToLower(origin)] {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(u.Host, r.Host())
+}
@@ -0,0 +1,148 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package websocket_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-safeweb/safehttp"
+	"github.com/google/go-safeweb/safehttp/plugins/websocket"
+	xwebsocket "golang.org/x/net/websocket"
+)
+
+func newServer(t *testing.T, opts websocket.Options) *httptest.Server {
+	t.Helper()
+	mux := safehttp.NewServeMuxConfig(nil).Mux()
+	mux.Handle("/echo", safehttp.MethodGet, websocket.Handler(opts, func(c *websocket.Conn) {
+		for {
+			msg, err := c.ReadText()
+			if err != nil {
+				return
+			}
+			if err := c.WriteText("echo: " + msg); err != nil {
+				return
+			}
+		}
+	}))
+	s := httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+	return s
+}
+
+func TestEcho(t *testing.T) {
+	tests := []struct {
+		name   string
+		opts   websocket.Options
+		origin func(s *httptest.Server) string
+	}{
+		{
+			name:   "Same origin",
+			origin: func(s *httptest.Server) string { return s.URL },
+		},
+		{
+			name:   "Allowed origin",
+			opts:   websocket.Options{AllowedOrigins: []string{"https://app.example.com"}},
+			origin: func(*httptest.Server) string { return "https://app.example.com" },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newServer(t, tt.opts)
+			ws, err := xwebsocket.Dial(strings.Replace(s.URL, "http", "ws", 1)+"/echo", "", tt.origin(s))
+			if err != nil {
+				t.Fatalf("Dial() got err: %v", err)
+			}
+			defer ws.Close()
+
+			if err := xwebsocket.Message.Send(ws, "hi"); err != nil {
+				t.Fatalf("Send() got err: %v", err)
+			}
+			var got string
+			if err := xwebsocket.Message.Receive(ws, &got); err != nil {
+				t.Fatalf("Receive() got err: %v", err)
+			}
+			if want := "echo: hi"; got != want {
+				t.Errorf("Receive(): got %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestRejected(t *testing.T) {
+	tests := []struct {
+		name     string
+		headers  map[string]string
+		wantCode int
+	}{
+		{
+			name:     "Not an upgrade request",
+			headers:  map[string]string{"Origin": "self"},
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name: "Cross-origin",
+			headers: map[string]string{
+				"Upgrade":    "websocket",
+				"Connection": "Upgrade",
+				"Origin":     "https://evil.com",
+			},
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name: "No origin",
+			headers: map[string]string{
+				"Upgrade":    "websocket",
+				"Connection": "Upgrade",
+			},
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name: "Not made by the WebSocket API",
+			headers: map[string]string{
+				"Upgrade":        "websocket",
+				"Connection":     "Upgrade",
+				"Origin":         "self",
+				"Sec-Fetch-Mode": "navigate",
+			},
+			wantCode: http.StatusForbidden,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newServer(t, websocket.Options{})
+			req, err := http.NewRequest(http.MethodGet, s.URL+"/echo", nil)
+			if err != nil {
+				t.Fatalf("http.NewRequest() got err: %v", err)
+			}
+			for k, v := range tt.headers {
+				if v == "self" {
+					v = s.URL
+				}
+				req.Header.Set(k, v)
+			}
+			resp, err := s.Client().Do(req)
+			if err != nil {
+				t.Fatalf("Do() got err: %v", err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.wantCode {
+				t.Errorf("status: got %d, want %d", resp.StatusCode, tt.wantCode)
+			}
+		})
+	}
+}
@@ -15,13 +15,11 @@
 package xsrfangular
 
 import (
-	"crypto/rand"
-	"encoding/base64"
-	"fmt"
 	"time"
 
 	"github.com/google/go-safeweb/safehttp"
 	"github.com/google/go-safeweb/safehttp/plugins/xsrf"
+	"github.com/google/go-safeweb/safehttp/random"
 )
 
 // Interceptor provides protection against Cross-Site Request Forgery attacks
@@ -50,10 +48,15 @@ func Default() *Interceptor {
 	}
 }
 
-// Before checks for the presence of a matching XSRF token, generated on the
-// first page access, in both a cookie and a header. Their names should be set
-// when the Interceptor is created.
+type addCookieKey struct{}
+
+// Before claims the token cookie and checks for the presence of a matching
+// XSRF token, generated on the first page access, in both a cookie and a
+// header. Their names should be set when the Interceptor is created.
 func (it *Interceptor) Before(w safehttp.ResponseWriter, r *safehttp.IncomingRequest, _ safehttp.InterceptorConfig) safehttp.Result {
+	add := w.Header().ClaimCookie(it.TokenCookieName, "xsrfangular.Interceptor")
+	safehttp.FlightValues(r.Context()).Put(addCookieKey{}, add)
+
 	if xsrf.StatePreserving(r) {
 		return safehttp.NotWritten()
 	}
@@ -74,12 +77,12 @@ func (it *Interceptor) Before(w safehttp.ResponseWriter, r *safehttp.IncomingReq
 	return safehttp.NotWritten()
 }
 
-func (it *Interceptor) addTokenCookie(w safehttp.ResponseHeadersWriter) error {
-	tok := make([]byte, 20)
-	if _, err := rand.Read(tok); err != nil {
-		return fmt.Errorf("crypto/rand.Read: %v", err)
+func (it *Interceptor) addTokenCookie(w safehttp.ResponseHeadersWriter, r *safehttp.IncomingRequest) error {
+	tok, err := random.Token(20)
+	if err != nil {
+		return err
 	}
-	c := safehttp.NewCookie(it.TokenCookieName, base64.StdEncoding.EncodeToString(tok))
+	c := safehttp.NewCookie(it.TokenCookieName, tok)
 
 	c.SameSite(safehttp.SameSiteStrictMode)
 	c.Path("/")
@@ -89,7 +92,13 @@ func (it *Interceptor) addTokenCookie(w safehttp.ResponseHeadersWriter) error {
 	// running on the same domain.
 	c.DisableHTTPOnly()
 
-	return w.AddCookie(c)
+	// The cookie is claimed in the Before phase, which doesn't run if an
+	// earlier interceptor already wrote the response.
+	add := w.AddCookie
+	if v := safehttp.FlightValues(r.Context()).Get(addCookieKey{}); v != nil {
+		add = v.(func(*safehttp.Cookie) error)
+	}
+	return add(c)
 }
 
 // Commit generates a cryptographically secure random cookie on the first state
@@ -107,7 +116,7 @@ func (it *Interceptor) Commit(w safehttp.ResponseHeadersWriter, r *safehttp.Inco
 		return
 	}
 
-	if err := it.addTokenCookie(w); err != nil {
+	if err := it.addTokenCookie(w, r); err != nil {
 		// This is a server misconfiguration.
 		panic("cannot add token cookie")
 	}
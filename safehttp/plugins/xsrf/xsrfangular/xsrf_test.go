@@ -154,3 +154,26 @@ func TestPostProtection(t *testing.T) {
 		})
 	}
 }
+
+func TestClaimedCookie(t *testing.T) {
+	req := safehttptest.NewRequest(safehttp.MethodGet, "/", nil)
+	fakeRW, rr := safehttptest.NewFakeResponseWriter()
+	it := Default()
+	it.Before(fakeRW, req, nil)
+
+	if err := fakeRW.AddCookie(safehttp.NewCookie(cookieName, "clobbered")); err == nil {
+		t.Error("fakeRW.AddCookie(XSRF cookie) got nil err, want error")
+	}
+
+	it.Commit(fakeRW, req, nil, nil)
+	if len(fakeRW.Cookies) != 0 {
+		t.Errorf("len(Cookies) = %v, want 0", len(fakeRW.Cookies))
+	}
+	cookies := rr.Header().Values("Set-Cookie")
+	if len(cookies) != 1 {
+		t.Fatalf(`len(rr.Header().Values("Set-Cookie")) = %v, want 1`, len(cookies))
+	}
+	if got, want := cookies[0], cookieName+"="; !strings.HasPrefix(got, want) {
+		t.Errorf("XSRF cookie got %q, want prefix %q", got, want)
+	}
+}
@@ -15,13 +15,10 @@
 package xsrfhtml
 
 import (
-	"crypto/rand"
-	"encoding/base64"
-	"fmt"
-
 	"github.com/google/go-safeweb/safehttp"
 	"github.com/google/go-safeweb/safehttp/plugins/htmlinject"
 	"github.com/google/go-safeweb/safehttp/plugins/xsrf"
+	"github.com/google/go-safeweb/safehttp/random"
 	"golang.org/x/net/xsrftoken"
 )
 
@@ -41,23 +38,41 @@ type Interceptor struct {
 
 var _ safehttp.Interceptor = &Interceptor{}
 
-func addCookieID(w safehttp.ResponseHeadersWriter) (*safehttp.Cookie, error) {
-	buf := make([]byte, 20)
-	if _, err := rand.Read(buf); err != nil {
-		return nil, fmt.Errorf("crypto/rand.Read: %v", err)
+type addCookieKey struct{}
+
+// claimCookieID claims the cookie holding the cookie ID so that handlers can't
+// overwrite it, and stores the function adding it for the Commit phase.
+func claimCookieID(w safehttp.ResponseWriter, r *safehttp.IncomingRequest) {
+	add := w.Header().ClaimCookie(cookieIDKey, "xsrfhtml.Interceptor")
+	safehttp.FlightValues(r.Context()).Put(addCookieKey{}, add)
+}
+
+func addCookieID(w safehttp.ResponseHeadersWriter, r *safehttp.IncomingRequest) (*safehttp.Cookie, error) {
+	id, err := random.Token(20)
+	if err != nil {
+		return nil, err
 	}
 
-	c := safehttp.NewCookie(cookieIDKey, base64.StdEncoding.EncodeToString(buf))
+	c := safehttp.NewCookie(cookieIDKey, id)
 	c.SameSite(safehttp.SameSiteStrictMode)
-	if err := w.AddCookie(c); err != nil {
+
+	// The cookie is claimed in the Before phase, which doesn't run if an
+	// earlier interceptor already wrote the response.
+	add := w.AddCookie
+	if v := safehttp.FlightValues(r.Context()).Get(addCookieKey{}); v != nil {
+		add = v.(func(*safehttp.Cookie) error)
+	}
+	if err := add(c); err != nil {
 		return nil, err
 	}
 	return c, nil
 }
 
-// Before checks for the presence of a XSRF token in the body of state changing
-// requests (all except GET, HEAD and OPTIONS) and validates it.
+// Before claims the XSRF cookie and checks for the presence of a XSRF token in
+// the body of state changing requests (all except GET, HEAD and OPTIONS) and
+// validates it.
 func (it *Interceptor) Before(w safehttp.ResponseWriter, r *safehttp.IncomingRequest, _ safehttp.InterceptorConfig) safehttp.Result {
+	claimCookieID(w, r)
 	if xsrf.StatePreserving(r) {
 		return safehttp.NotWritten()
 	}
@@ -103,7 +118,8 @@ func (it *Interceptor) Before(w safehttp.ResponseWriter, r *safehttp.IncomingReq
 //
 // For every authorized request, the interceptor also generates a
 // cryptographically-safe XSRF token using the appKey, the cookie and the path
-// visited. This is then injected as a hidden input field in HTML forms.
+// visited. This is then injected as a hidden input field in HTML forms, and
+// the compression of the response is disabled.
 func (it *Interceptor) Commit(w safehttp.ResponseHeadersWriter, r *safehttp.IncomingRequest, resp safehttp.Response, _ safehttp.InterceptorConfig) {
 	cookieID, err := r.Cookie(cookieIDKey)
 	if err != nil {
@@ -111,7 +127,7 @@ func (it *Interceptor) Commit(w safehttp.ResponseHeadersWriter, r *safehttp.Inco
 			// Not a state preserving request, so we won't be adding the cookie.
 			return
 		}
-		cookieID, err = addCookieID(w)
+		cookieID, err = addCookieID(w, r)
 		if err != nil {
 			// This is a server misconfiguration.
 			panic("cannot add cookie ID")
@@ -126,6 +142,9 @@ func (it *Interceptor) Commit(w safehttp.ResponseHeadersWriter, r *safehttp.Inco
 	}
 
 	tok := xsrftoken.Generate(it.SecretAppKey, cookieID.Value(), r.URL().Host())
+	// Compressing the token along with reflected data would expose it to
+	// BREACH attacks.
+	safehttp.DisableCompression(r)
 	if tmplResp.FuncMap == nil {
 		tmplResp.FuncMap = map[string]interface{}{}
 	}
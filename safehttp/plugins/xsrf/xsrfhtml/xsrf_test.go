@@ -15,11 +15,13 @@
 package xsrfhtml
 
 import (
+	"net/http/httptest"
 	"strings"
 	"testing"
 
 	"github.com/google/go-safeweb/safehttp"
 	"github.com/google/go-safeweb/safehttp/safehttptest"
+	"github.com/google/safehtml/template"
 	"golang.org/x/net/xsrftoken"
 )
 
@@ -260,6 +262,28 @@ func TestCommitTokenInResponse(t *testing.T) {
 	}
 }
 
+func TestCommitDisablesCompression(t *testing.T) {
+	mc := safehttp.NewServeMuxConfig(nil)
+	mc.Intercept(&Interceptor{SecretAppKey: "testSecretAppKey"})
+	mc.Compress(safehttp.CompressionOptions{})
+	mux := mc.Mux()
+	tmpl := template.Must(template.New("").
+		Funcs(map[string]interface{}{"XSRFToken": func() string { return "" }}).
+		Parse(`<form><input name="xsrf-token" value="{{XSRFToken}}"></form>`))
+	mux.Handle("/", safehttp.MethodGet, safehttp.HandlerFunc(func(w safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+		return w.Write(&safehttp.TemplateResponse{Template: tmpl})
+	}))
+
+	req := httptest.NewRequest(safehttp.MethodGet, "https://foo.com/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+
+	if got := rr.Header().Get("Content-Encoding"); got != "" {
+		t.Errorf("Content-Encoding: got %q, want none", got)
+	}
+}
+
 func TestCommitNotTemplateResponse(t *testing.T) {
 	fakeRW, rr := safehttptest.NewFakeResponseWriter()
 	req := safehttptest.NewRequest(safehttp.MethodGet, "https://foo.com/pizza", nil)
@@ -275,3 +299,27 @@ func TestCommitNotTemplateResponse(t *testing.T) {
 		t.Errorf("rr.Body.String(): got %q want %q", got, want)
 	}
 }
+
+func TestClaimedCookie(t *testing.T) {
+	fakeRW, rr := safehttptest.NewFakeResponseWriter()
+	req := safehttptest.NewRequest(safehttp.MethodGet, "https://foo.com/pizza", nil)
+
+	i := Interceptor{SecretAppKey: "testSecretAppKey"}
+	i.Before(fakeRW, req, nil)
+
+	if err := fakeRW.AddCookie(safehttp.NewCookie(cookieIDKey, "clobbered")); err == nil {
+		t.Error("fakeRW.AddCookie(XSRF cookie) got nil err, want error")
+	}
+
+	i.Commit(fakeRW, req, nil, nil)
+	if len(fakeRW.Cookies) != 0 {
+		t.Errorf("len(Cookies) = %v, want 0", len(fakeRW.Cookies))
+	}
+	cookies := rr.Header().Values("Set-Cookie")
+	if len(cookies) != 1 {
+		t.Fatalf(`len(rr.Header().Values("Set-Cookie")) = %v, want 1`, len(cookies))
+	}
+	if got, want := cookies[0], cookieIDKey+"="; !strings.HasPrefix(got, want) {
+		t.Errorf("XSRF cookie got %q, want prefix %q", got, want)
+	}
+}
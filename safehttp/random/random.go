@@ -0,0 +1,78 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package random provides the cryptographically secure random values used for
+// nonces and tokens, e.g. CSP nonces, XSRF tokens and session IDs.
+//
+// The values are read from crypto/rand.Reader. Tests can replace the source
+// with SetSourceForTesting to get deterministic values, but this is refused in
+// production builds.
+package random
+
+import (
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/google/go-safeweb/safehttp"
+	"github.com/google/go-safeweb/safehttp/internal/randsource"
+)
+
+// Bytes returns n random bytes.
+func Bytes(n int) ([]byte, error) {
+	b := make([]byte, n)
+	if err := randsource.Read(b); err != nil {
+		return nil, fmt.Errorf("failed to generate entropy: %v", err)
+	}
+	return b, nil
+}
+
+// Token returns n random bytes, encoded using base64.StdEncoding.
+func Token(n int) (string, error) {
+	b, err := Bytes(n)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(b), nil
+}
+
+// MustToken is like Token, but panics if the entropy can't be generated.
+func MustToken(n int) string {
+	t, err := Token(n)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// SetSourceForTesting replaces the source of randomness, including the one of
+// the random padding of compressed responses, and returns a function which
+// restores the previous one.
+//
+// Since a predictable source makes all nonces and tokens predictable,
+// SetSourceForTesting panics unless it is called from a test binary or while
+// in local development mode (see safehttp.UseLocalDev).
+func SetSourceForTesting(r io.Reader) (restore func()) {
+	if !inTestBinary() && !safehttp.IsLocalDev() {
+		panic("random.SetSourceForTesting called in a production build")
+	}
+	return randsource.Set(r)
+}
+
+// inTestBinary reports whether the binary is a test binary. The testing package
+// registers its flags before running any test.
+func inTestBinary() bool {
+	return flag.Lookup("test.v") != nil
+}
@@ -0,0 +1,76 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package random
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"testing"
+)
+
+func TestToken(t *testing.T) {
+	tok, err := Token(20)
+	if err != nil {
+		t.Fatalf("Token(20) got err: %v", err)
+	}
+	b, err := base64.StdEncoding.DecodeString(tok)
+	if err != nil {
+		t.Fatalf("base64.StdEncoding.DecodeString(%q) got err: %v", tok, err)
+	}
+	if len(b) != 20 {
+		t.Errorf("len(decoded token) = %d, want 20", len(b))
+	}
+	if other := MustToken(20); other == tok {
+		t.Errorf("two tokens are equal: %q", tok)
+	}
+}
+
+func TestSetSourceForTesting(t *testing.T) {
+	restore := SetSourceForTesting(bytes.NewReader([]byte("aaaabbbb")))
+	got, err := Bytes(4)
+	if err != nil {
+		t.Fatalf("Bytes(4) got err: %v", err)
+	}
+	if want := []byte("aaaa"); !bytes.Equal(got, want) {
+		t.Errorf("Bytes(4) = %q, want %q", got, want)
+	}
+
+	if _, err := Bytes(5); err == nil {
+		t.Error("Bytes(5) got nil err with only 4 bytes left, want error")
+	}
+
+	restore()
+	// The test source is exhausted, so this only succeeds with the original one.
+	if _, err := Bytes(8); err != nil {
+		t.Errorf("Bytes(8) after restore() got err: %v", err)
+	}
+}
+
+type errorReader struct{}
+
+func (errorReader) Read(b []byte) (int, error) {
+	return 0, errors.New("bad")
+}
+
+func TestMustTokenPanics(t *testing.T) {
+	defer SetSourceForTesting(errorReader{})()
+	defer func() {
+		if r := recover(); r == nil {
+			t.Error("MustToken(20) expected panic")
+		}
+	}()
+	MustToken(20)
+}
@@ -0,0 +1,72 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package safehttp
+
+import (
+	"net"
+	"strings"
+)
+
+// HTTPSRedirectMux returns a ServeMux permanently redirecting the GET and
+// HEAD requests for the given hosts to the same URL over HTTPS, on the
+// default port. Requests for other hosts are rejected with 404 Not Found, so
+// that the redirects can't point clients to arbitrary hosts, and other
+// methods with 405 Method Not Allowed.
+//
+// Redirecting all plaintext traffic is required to submit a domain to the HSTS
+// preload list, which protects first-time visitors: see the hsts plugin.
+// Additional handlers, e.g. for ACME challenges, can be registered on the
+// returned ServeMux.
+func HTTPSRedirectMux(hosts ...string) *ServeMux {
+	h := httpsRedirect{hosts: map[string]bool{}}
+	for _, host := range hosts {
+		h.hosts[strings.ToLower(host)] = true
+	}
+	mux := NewServeMuxConfig(nil).Mux()
+	mux.Handle("/", MethodGet, h)
+	mux.Handle("/", MethodHead, h)
+	return mux
+}
+
+// RedirectServer returns a Server listening on addr, or ":http" (port 80) if
+// empty, serving HTTPSRedirectMux(hosts...).
+func RedirectServer(addr string, hosts ...string) *Server {
+	if addr == "" {
+		addr = ":http"
+	}
+	return &Server{Addr: addr, Mux: HTTPSRedirectMux(hosts...)}
+}
+
+type httpsRedirect struct {
+	hosts map[string]bool
+}
+
+func (h httpsRedirect) ServeHTTP(w ResponseWriter, r *IncomingRequest) Result {
+	host := r.Host()
+	if hn, _, err := net.SplitHostPort(host); err == nil {
+		host = hn
+	}
+	host = strings.ToLower(host)
+	if !h.hosts[host] {
+		return w.WriteError(StatusNotFound)
+	}
+	// The path was sanitized by the ServeMux. It's kept escaped so that
+	// escaped delimiters, e.g. %3F, aren't turned into real ones.
+	target := "https://" + host + r.req.URL.EscapedPath()
+	if q := r.req.URL.RawQuery; q != "" {
+		target += "?" + q
+	}
+	return Redirect(w, r, target, StatusMovedPermanently)
+}
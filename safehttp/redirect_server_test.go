@@ -0,0 +1,90 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package safehttp_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-safeweb/safehttp"
+)
+
+func TestHTTPSRedirectMux(t *testing.T) {
+	tests := []struct {
+		name         string
+		method       string
+		target       string
+		wantCode     int
+		wantLocation string
+	}{
+		{
+			name:         "Redirect",
+			method:       safehttp.MethodGet,
+			target:       "http://example.com/a/b?q=1",
+			wantCode:     http.StatusMovedPermanently,
+			wantLocation: "https://example.com/a/b?q=1",
+		},
+		{
+			name:         "Escaped delimiters",
+			method:       safehttp.MethodGet,
+			target:       "http://example.com/a%3Fb%23c%20d?q=1",
+			wantCode:     http.StatusMovedPermanently,
+			wantLocation: "https://example.com/a%3Fb%23c%20d?q=1",
+		},
+		{
+			name:         "Port and case",
+			method:       safehttp.MethodHead,
+			target:       "http://WWW.Example.com:8080/",
+			wantCode:     http.StatusMovedPermanently,
+			wantLocation: "https://www.example.com/",
+		},
+		{
+			name:     "Unknown host",
+			method:   safehttp.MethodGet,
+			target:   "http://evil.com/",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Other method",
+			method:   safehttp.MethodPost,
+			target:   "http://example.com/",
+			wantCode: http.StatusMethodNotAllowed,
+		},
+	}
+	mux := safehttp.HTTPSRedirectMux("example.com", "www.example.com")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rw := httptest.NewRecorder()
+			mux.ServeHTTP(rw, httptest.NewRequest(tt.method, tt.target, nil))
+			if rw.Code != tt.wantCode {
+				t.Errorf("rw.Code: got %v, want %v", rw.Code, tt.wantCode)
+			}
+			if got := rw.Header().Get("Location"); got != tt.wantLocation {
+				t.Errorf("Location: got %q, want %q", got, tt.wantLocation)
+			}
+		})
+	}
+}
+
+func TestRedirectServer(t *testing.T) {
+	s := safehttp.RedirectServer("", "example.com")
+	if s.Addr != ":http" {
+		t.Errorf("s.Addr: got %q, want %q", s.Addr, ":http")
+	}
+	if s.Mux == nil {
+		t.Error("s.Mux: got nil")
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package safehttp
+
+import (
+	"context"
+	"net/http"
+	"sync"
+)
+
+// muxGenerations serves requests with the latest generation of ServeMux,
+// keeping track of the in-flight requests of the previous ones so that they
+// can be drained. Every request is served by a single generation from start
+// to end.
+type muxGenerations struct {
+	mu      sync.Mutex
+	current *muxGeneration
+}
+
+type muxGeneration struct {
+	mux *ServeMux
+	// active is the number of in-flight requests.
+	active int
+	// drained is created when the generation is retired and closed once it
+	// has no more in-flight requests.
+	drained chan struct{}
+}
+
+func newMuxGenerations(m *ServeMux) *muxGenerations {
+	return &muxGenerations{current: &muxGeneration{mux: m}}
+}
+
+func (g *muxGenerations) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	g.mu.Lock()
+	gen := g.current
+	gen.active++
+	g.mu.Unlock()
+
+	defer func() {
+		g.mu.Lock()
+		gen.active--
+		if gen.active == 0 && gen.drained != nil {
+			close(gen.drained)
+		}
+		g.mu.Unlock()
+	}()
+	gen.mux.ServeHTTP(w, r)
+}
+
+// swap makes m the current generation and waits for the previous one to be
+// drained, or for ctx to be done.
+func (g *muxGenerations) swap(ctx context.Context, m *ServeMux) error {
+	g.mu.Lock()
+	old := g.current
+	g.current = &muxGeneration{mux: m}
+	old.drained = make(chan struct{})
+	if old.active == 0 {
+		close(old.drained)
+	}
+	g.mu.Unlock()
+
+	select {
+	case <-old.drained:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -43,6 +43,19 @@ func WriteJSON(w ResponseWriter, data interface{}) Result {
 	return w.Write(JSONResponse{data})
 }
 
+// XMLResponse should encapsulate a value that will be serialised and written
+// to the http.ResponseWriter using an XML encoder, following the
+// encoding/xml.Marshal rules.
+type XMLResponse struct {
+	Data interface{}
+}
+
+// WriteXML creates an XMLResponse from the data object and calls the Write
+// function of the ResponseWriter, passing the response.
+func WriteXML(w ResponseWriter, data interface{}) Result {
+	return w.Write(XMLResponse{data})
+}
+
 // Template implements a template.
 type Template interface {
 	// Execute applies data to the template and then writes the result to
@@ -0,0 +1,91 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package safehttp
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+)
+
+// newSummaryWriter returns the writer to use instead of rw, and the
+// summaryWriter recording what's written to it.
+func newSummaryWriter(rw http.ResponseWriter) (http.ResponseWriter, *summaryWriter) {
+	sw := &summaryWriter{rw: rw}
+	if h, ok := rw.(http.Hijacker); ok {
+		return hijackableSummaryWriter{summaryWriter: sw, hijacker: h}, sw
+	}
+	return sw, sw
+}
+
+// summaryWriter records the status code and the size of the response written
+// to it, for the Finish phases of the interceptors.
+type summaryWriter struct {
+	rw   http.ResponseWriter
+	code int
+	size int64
+}
+
+func (w *summaryWriter) Header() http.Header {
+	return w.rw.Header()
+}
+
+func (w *summaryWriter) WriteHeader(code int) {
+	if w.code == 0 {
+		w.code = code
+	}
+	w.rw.WriteHeader(code)
+}
+
+func (w *summaryWriter) Write(b []byte) (int, error) {
+	if w.code == 0 {
+		w.code = http.StatusOK
+	}
+	n, err := w.rw.Write(b)
+	w.size += int64(n)
+	return n, err
+}
+
+// Flush sends the bytes written so far to the client, if the underlying
+// http.ResponseWriter supports it.
+func (w *summaryWriter) Flush() {
+	if f, ok := w.rw.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// hijackableSummaryWriter is a summaryWriter wrapping an http.Hijacker, so
+// that WebSocketResponses can still detect whether the connection can be
+// upgraded.
+type hijackableSummaryWriter struct {
+	*summaryWriter
+	hijacker http.Hijacker
+}
+
+// Hijack lets WebSocketResponses take over the connection.
+func (w hijackableSummaryWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if w.code == 0 {
+		w.code = http.StatusSwitchingProtocols
+	}
+	return w.hijacker.Hijack()
+}
+
+func (w *summaryWriter) status() StatusCode {
+	if w.code == 0 {
+		// net/http writes 200 OK if nothing was written.
+		return StatusOK
+	}
+	return StatusCode(w.code)
+}
@@ -0,0 +1,188 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package safehttp_test
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-safeweb/safehttp"
+	"github.com/google/safehtml"
+)
+
+type finishingInterceptor struct {
+	name     string
+	summary  *safehttp.ResponseSummary
+	order    *[]string
+	blocking bool
+}
+
+func (it finishingInterceptor) Before(w safehttp.ResponseWriter, _ *safehttp.IncomingRequest, _ safehttp.InterceptorConfig) safehttp.Result {
+	if it.blocking {
+		return w.WriteError(safehttp.StatusForbidden)
+	}
+	return safehttp.NotWritten()
+}
+
+func (finishingInterceptor) Commit(safehttp.ResponseHeadersWriter, *safehttp.IncomingRequest, safehttp.Response, safehttp.InterceptorConfig) {
+}
+
+func (finishingInterceptor) Match(safehttp.InterceptorConfig) bool {
+	return false
+}
+
+func (it finishingInterceptor) Finish(_ *safehttp.IncomingRequest, s safehttp.ResponseSummary, _ safehttp.InterceptorConfig) {
+	if it.summary != nil {
+		*it.summary = s
+	}
+	if it.order != nil {
+		*it.order = append(*it.order, it.name)
+	}
+}
+
+func TestResponseSummary(t *testing.T) {
+	body := strings.Repeat("<h1>Hello World!</h1>", 10)
+	tests := []struct {
+		name     string
+		compress bool
+		blocking bool
+		handler  safehttp.HandlerFunc
+		want     safehttp.ResponseSummary
+	}{
+		{
+			name: "response",
+			handler: func(w safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+				return w.Write(safehtml.HTMLEscaped(body))
+			},
+			want: safehttp.ResponseSummary{
+				Status:      safehttp.StatusOK,
+				Size:        int64(len(safehtml.HTMLEscaped(body).String())),
+				ContentType: "text/html; charset=utf-8",
+				Committed:   true,
+			},
+		},
+		{
+			name: "error",
+			handler: func(w safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+				return w.WriteError(safehttp.StatusNotFound)
+			},
+			want: safehttp.ResponseSummary{
+				Status:      safehttp.StatusNotFound,
+				Size:        int64(len("Not Found\n")),
+				ContentType: "text/plain; charset=utf-8",
+				Committed:   true,
+			},
+		},
+		{
+			name:     "blocked in Before",
+			blocking: true,
+			handler: func(w safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+				t.Error("handler called")
+				return w.Write(safehttp.NoContentResponse{})
+			},
+			want: safehttp.ResponseSummary{
+				Status:      safehttp.StatusForbidden,
+				Size:        int64(len("Forbidden\n")),
+				ContentType: "text/plain; charset=utf-8",
+				Committed:   true,
+			},
+		},
+		{
+			name: "not written",
+			handler: func(w safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+				return safehttp.NotWritten()
+			},
+			want: safehttp.ResponseSummary{Status: safehttp.StatusNoContent},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got safehttp.ResponseSummary
+			mc := safehttp.NewServeMuxConfig(nil)
+			mc.Intercept(finishingInterceptor{summary: &got, blocking: tt.blocking})
+			mux := mc.Mux()
+			mux.Handle("/", safehttp.MethodGet, tt.handler)
+
+			mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(safehttp.MethodGet, "/", nil))
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("ResponseSummary mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestResponseSummaryCompressedSize(t *testing.T) {
+	var got safehttp.ResponseSummary
+	mc := safehttp.NewServeMuxConfig(nil)
+	mc.Intercept(finishingInterceptor{summary: &got})
+	mc.Compress(safehttp.CompressionOptions{})
+	mux := mc.Mux()
+	body := safehtml.HTMLEscaped(strings.Repeat("Hello World!", 100))
+	mux.Handle("/", safehttp.MethodGet, safehttp.HandlerFunc(func(w safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+		return w.Write(body)
+	}))
+
+	req := httptest.NewRequest(safehttp.MethodGet, "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rw := httptest.NewRecorder()
+	mux.ServeHTTP(rw, req)
+
+	if got.Size != int64(rw.Body.Len()) || got.Size >= int64(len(body.String())) {
+		t.Errorf("Size: got %d, want the compressed size %d", got.Size, rw.Body.Len())
+	}
+}
+
+func TestFinishOrder(t *testing.T) {
+	var order []string
+	mc := safehttp.NewServeMuxConfig(nil)
+	mc.Intercept(finishingInterceptor{name: "first", order: &order})
+	mc.Intercept(panickingInterceptor{})
+	mc.Intercept(finishingInterceptor{name: "second", order: &order})
+	mc.InterceptWhen(func(r *safehttp.IncomingRequest) bool { return true }, finishingInterceptor{name: "applies", order: &order})
+	mc.InterceptWhen(func(r *safehttp.IncomingRequest) bool { return false }, finishingInterceptor{name: "skipped", order: &order})
+	mux := mc.Mux()
+	mux.Handle("/", safehttp.MethodGet, safehttp.HandlerFunc(func(w safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+		return w.Write(safehttp.NoContentResponse{})
+	}))
+
+	mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(safehttp.MethodGet, "/", nil))
+	if diff := cmp.Diff([]string{"applies", "second", "first"}, order); diff != "" {
+		t.Errorf("Finish order mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestFinishNotCalledOnPanic(t *testing.T) {
+	var order []string
+	mc := safehttp.NewServeMuxConfig(nil)
+	mc.Intercept(finishingInterceptor{name: "finisher", order: &order})
+	mux := mc.Mux()
+	mux.Handle("/", safehttp.MethodGet, safehttp.HandlerFunc(func(w safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+		panic("handler")
+	}))
+
+	func() {
+		defer func() {
+			if r := recover(); r == nil {
+				t.Error("expected panic")
+			}
+		}()
+		mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(safehttp.MethodGet, "/", nil))
+	}()
+	if len(order) != 0 {
+		t.Errorf("Finish called after a panic: %v", order)
+	}
+}
@@ -16,8 +16,9 @@ package safehttp
 
 // ResponseWriter is used to construct an HTTP response. When a Response is
 // passed to the ResponseWriter, it will invoke the Dispatcher with the
-// Response. An attempt to write to the ResponseWriter twice will
-// cause a panic.
+// Response. By default, an attempt to write to the ResponseWriter twice will
+// cause a panic with ErrResponseAlreadyWritten (see
+// ServeMuxConfig.HandleDoubleWrite).
 //
 // A ResponseWriter may not be used after the Handler.ServeHTTP method has returned.
 type ResponseWriter interface {
@@ -28,7 +29,8 @@ type ResponseWriter interface {
 
 	// WriteError writes an error response (400-599).
 	//
-	// If the ResponseWriter has already been written to, then this method panics.
+	// If the ResponseWriter has already been written to, then by default this
+	// method panics.
 	WriteError(resp ErrorResponse) Result
 }
 
@@ -44,5 +46,8 @@ type ResponseHeadersWriter interface {
 	// AddCookie adds a Set-Cookie header to the provided ResponseWriter's headers.
 	// The provided cookie must have a valid Name, otherwise an error will be
 	// returned.
+	//
+	// Cookies claimed with Header.ClaimCookie can't be added, and an error
+	// wrapping ErrCookieClaimed is returned instead.
 	AddCookie(c *Cookie) error
 }
@@ -0,0 +1,67 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package safehttp
+
+import "fmt"
+
+// RouteInfo documents a route, e.g. for the route catalog of the routecatalog
+// plugin, to help audits and onboarding. It doesn't change how requests are
+// served.
+//
+// Pass it to ServeMux.Handle along with the InterceptorConfigs of the handler,
+// or to RouteGroup.Configure to document all the routes of a group. The
+// RouteInfo passed to Handle takes precedence over the one of a group, as
+// does the one of a nested group.
+type RouteInfo struct {
+	// Owner is who is responsible for the route, e.g. a team.
+	Owner string
+	// Description is a human-readable description of what the route does.
+	Description string
+	// DataClassification is the sensitivity of the data the route handles,
+	// e.g. "public" or "confidential", using the classification of the
+	// organization.
+	DataClassification string
+}
+
+// routeInfo separates the RouteInfo from the InterceptorConfigs of a handler.
+// Only the first RouteInfo is kept, as the ones of the RouteGroups follow the
+// ones passed to Handle, which is given in handlerCfgs. It panics if more
+// than one RouteInfo was passed to Handle.
+func routeInfo(handlerCfgs, cfgs []InterceptorConfig) (RouteInfo, []InterceptorConfig) {
+	n := 0
+	for _, c := range handlerCfgs {
+		if _, ok := c.(RouteInfo); ok {
+			n++
+		}
+	}
+	if n > 1 {
+		panic(fmt.Sprintf("multiple RouteInfos specified: %v", handlerCfgs))
+	}
+
+	var info RouteInfo
+	found := false
+	var rest []InterceptorConfig
+	for _, c := range cfgs {
+		ri, ok := c.(RouteInfo)
+		if !ok {
+			rest = append(rest, c)
+			continue
+		}
+		if !found {
+			info, found = ri, true
+		}
+	}
+	return info, rest
+}
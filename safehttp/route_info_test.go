@@ -0,0 +1,81 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package safehttp_test
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-safeweb/safehttp"
+	"github.com/google/safehtml"
+)
+
+func TestRouteInfo(t *testing.T) {
+	mb := safehttp.NewServeMuxConfig(nil)
+	mb.Intercept(setHeaderConfigInterceptor{})
+	mb.Group("/admin/").Configure(safehttp.RouteInfo{Owner: "admin-team", DataClassification: "confidential"})
+	mb.Group("/admin/billing/").Configure(safehttp.RouteInfo{Owner: "billing-team"})
+	mux := mb.Mux()
+	h := safehttp.HandlerFunc(func(w safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+		return w.Write(safehtml.HTMLEscaped("ok"))
+	})
+	mux.Handle("/", safehttp.MethodGet, h)
+	mux.Handle("/items", safehttp.MethodGet, h,
+		safehttp.RouteInfo{Owner: "items-team", Description: "Lists the items."},
+		setHeaderConfig{name: "a", value: "b"})
+	mux.Handle("/admin/users", safehttp.MethodGet, h)
+	mux.Handle("/admin/billing/invoices", safehttp.MethodGet, h)
+	mux.Handle("/admin/billing/invoices", safehttp.MethodPost, h, safehttp.RouteInfo{Owner: "payments-team"})
+
+	got := map[string]safehttp.RouteInfo{}
+	for _, r := range mux.Routes() {
+		got[r.Method+" "+r.Pattern] = r.Info
+		for _, c := range r.Configs {
+			if _, ok := c.(safehttp.RouteInfo); ok {
+				t.Errorf("%s %s: RouteInfo among the configs %v", r.Method, r.Pattern, r.Configs)
+			}
+		}
+	}
+	want := map[string]safehttp.RouteInfo{
+		"GET /":                        {},
+		"GET /items":                   {Owner: "items-team", Description: "Lists the items."},
+		"GET /admin/users":             {Owner: "admin-team", DataClassification: "confidential"},
+		"GET /admin/billing/invoices":  {Owner: "billing-team"},
+		"POST /admin/billing/invoices": {Owner: "payments-team"},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("RouteInfo mismatch (-want +got):\n%s", diff)
+	}
+
+	// The RouteInfo doesn't affect the configuration of the interceptors.
+	rw := httptest.NewRecorder()
+	mux.ServeHTTP(rw, httptest.NewRequest(safehttp.MethodGet, "https://foo.com/items", nil))
+	if got, want := rw.Header().Get("a"), "b"; got != want {
+		t.Errorf(`rw.Header().Get("a") got: %q want: %q`, got, want)
+	}
+}
+
+func TestRouteInfoMultiple(t *testing.T) {
+	mux := safehttp.NewServeMuxConfig(nil).Mux()
+	defer func() {
+		if r := recover(); r == nil {
+			t.Error("expected panic")
+		}
+	}()
+	mux.Handle("/", safehttp.MethodGet, safehttp.HandlerFunc(func(w safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+		return w.Write(safehttp.NoContentResponse{})
+	}), safehttp.RouteInfo{Owner: "a"}, safehttp.RouteInfo{Owner: "b"})
+}
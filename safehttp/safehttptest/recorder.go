@@ -15,6 +15,7 @@
 package safehttptest
 
 import (
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 
@@ -80,11 +81,15 @@ func (frw *FakeResponseWriter) Header() safehttp.Header {
 	return frw.Headers
 }
 
-// AddCookie appends the given cookie to the Cookies field.
+// AddCookie appends the given cookie to the Cookies field. Like the real
+// ResponseWriter, it refuses cookies claimed through Headers.ClaimCookie.
 func (frw *FakeResponseWriter) AddCookie(c *safehttp.Cookie) error {
 	if len(c.Name()) == 0 {
 		panic("empty cookie name")
 	}
+	if claimant, ok := frw.Headers.CookieClaimant(c.Name()); ok {
+		return fmt.Errorf("%w: cookie %q is claimed by %s", safehttp.ErrCookieClaimed, c.Name(), claimant)
+	}
 
 	frw.Cookies = append(frw.Cookies, c)
 	return nil
@@ -20,6 +20,7 @@ import (
 	"errors"
 	"net"
 	"net/http"
+	"sync/atomic"
 	"time"
 )
 
@@ -64,7 +65,8 @@ type Server struct {
 	// configuration with methods like tls.Config.SetSessionTicketKeys.
 	//
 	// When the server is started the cloned configuration will be changed
-	// to set the minimum TLS version to 1.2 and to prefer Server Ciphers.
+	// to set the minimum TLS version to at least 1.2 and to prefer Server
+	// Ciphers. Use ServerTLSConfig to build a hardened configuration.
 	TLSConfig *tls.Config
 
 	// OnShutdown is a slice of functions to call on Shutdown.
@@ -77,8 +79,26 @@ type Server struct {
 	// DisableKeepAlives controls whether HTTP keep-alives should be disabled.
 	DisableKeepAlives bool
 
-	srv     *http.Server
-	started bool
+	// DrainDelay is the time Shutdown keeps accepting connections for after
+	// the handler returned by ReadinessHandler started failing, giving load
+	// balancers time to stop sending new requests.
+	DrainDelay time.Duration
+
+	// OnDrained is a slice of functions to call, in order, during Shutdown
+	// once all in-flight requests completed, e.g. to flush caches or report
+	// queues. They are called even if Shutdown timed out, with its context.
+	OnDrained []func(context.Context) error
+
+	// Listeners are additional addresses served along with the server, each
+	// with its own ServeMux, e.g. an internal plaintext listener for admin
+	// endpoints next to the public TLS one. See Listener.
+	Listeners []Listener
+
+	srv      *http.Server
+	gens     *muxGenerations
+	extra    []*extraListener
+	started  bool
+	draining int32
 }
 
 func (s *Server) buildStd() error {
@@ -93,9 +113,10 @@ func (s *Server) buildStd() error {
 		return errors.New("building server without a mux")
 	}
 
+	s.gens = newMuxGenerations(s.Mux)
 	srv := &http.Server{
 		Addr:           s.Addr,
-		Handler:        s.Mux,
+		Handler:        s.gens,
 		ReadTimeout:    5 * time.Second,
 		WriteTimeout:   5 * time.Second,
 		IdleTimeout:    120 * time.Second,
@@ -113,28 +134,44 @@ func (s *Server) buildStd() error {
 	if s.MaxHeaderBytes != 0 {
 		srv.MaxHeaderBytes = s.MaxHeaderBytes
 	}
-	if s.TLSConfig != nil {
-		cfg := s.TLSConfig.Clone()
-		cfg.MinVersion = tls.VersionTLS12
-		cfg.PreferServerCipherSuites = true
-		srv.TLSConfig = cfg
-	}
+	srv.TLSConfig = safeTLSConfig(s.TLSConfig)
 	for _, f := range s.OnShudown {
 		srv.RegisterOnShutdown(f)
 	}
 	if s.DisableKeepAlives {
 		srv.SetKeepAlivesEnabled(false)
 	}
-	s.srv = srv
+	extra, err := s.buildListeners(srv)
+	if err != nil {
+		return err
+	}
+	s.srv, s.extra = srv, extra
 	return nil
 }
 
+// safeTLSConfig returns a copy of cfg requiring at least TLS 1.2 and
+// preferring the cipher suites of the server, or nil if cfg is nil.
+func safeTLSConfig(cfg *tls.Config) *tls.Config {
+	if cfg == nil {
+		return nil
+	}
+	cfg = cfg.Clone()
+	if cfg.MinVersion < tls.VersionTLS12 {
+		cfg.MinVersion = tls.VersionTLS12
+	}
+	cfg.PreferServerCipherSuites = true
+	return cfg
+}
+
 // Clone returns an unstarted deep copy of Server that can be re-configured and re-started.
 func (s *Server) Clone() *Server {
 	cln := *s
 	cln.started = false
+	cln.draining = 0
 	cln.TLSConfig = s.TLSConfig.Clone()
 	cln.srv = nil
+	cln.gens = nil
+	cln.extra = nil
 	return &cln
 }
 
@@ -144,6 +181,9 @@ func (s *Server) ListenAndServe() error {
 		return err
 	}
 	s.started = true
+	if err := s.startListeners(); err != nil {
+		return err
+	}
 	return s.srv.ListenAndServe()
 }
 
@@ -153,6 +193,9 @@ func (s *Server) ListenAndServeTLS(certFile, keyFile string) error {
 		return err
 	}
 	s.started = true
+	if err := s.startListeners(); err != nil {
+		return err
+	}
 	return s.srv.ListenAndServeTLS(certFile, keyFile)
 }
 
@@ -162,6 +205,9 @@ func (s *Server) Serve(l net.Listener) error {
 		return err
 	}
 	s.started = true
+	if err := s.startListeners(); err != nil {
+		return err
+	}
 	return s.srv.Serve(l)
 }
 
@@ -171,16 +217,75 @@ func (s *Server) ServeTLS(l net.Listener, certFile, keyFile string) error {
 		return err
 	}
 	s.started = true
+	if err := s.startListeners(); err != nil {
+		return err
+	}
 	return s.srv.ServeTLS(l, certFile, keyFile)
 }
 
-// Shutdown is a wrapper for https://golang.org/pkg/net/http/#Server.Shutdown
+// Shutdown gracefully shuts down the server, like
+// https://golang.org/pkg/net/http/#Server.Shutdown does.
+//
+// First, the handler returned by ReadinessHandler starts failing. After
+// DrainDelay, the server and its Listeners stop accepting connections and
+// wait for in-flight requests to complete. Finally, the OnDrained functions
+// are called. The first error encountered is returned.
 func (s *Server) Shutdown(ctx context.Context) error {
 	if !s.started {
 		return errors.New("shutting down unstarted server")
 	}
+	atomic.StoreInt32(&s.draining, 1)
+	if s.DrainDelay > 0 {
+		t := time.NewTimer(s.DrainDelay)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+		}
+	}
 	s.srv.SetKeepAlivesEnabled(false)
-	return s.srv.Shutdown(ctx)
+	err := s.shutdownAll(ctx)
+	for _, f := range s.OnDrained {
+		if ferr := f(ctx); err == nil {
+			err = ferr
+		}
+	}
+	return err
+}
+
+// Reload switches the server to a new configuration: new requests are served
+// by m, while the ones in flight complete with the previous ServeMux, so that
+// no response mixes the policies of the two. Reload returns once the previous
+// ServeMux has no more requests in flight, or with an error when ctx is done
+// before that, in which case the remaining requests keep being served by it.
+//
+// The Mux field isn't changed, so Clone returns a server with the initial
+// ServeMux.
+func (s *Server) Reload(ctx context.Context, m *ServeMux) error {
+	if !s.started {
+		return errors.New("reloading unstarted server")
+	}
+	if m == nil {
+		return errors.New("reloading server without a mux")
+	}
+	return s.gens.swap(ctx, m)
+}
+
+// Draining reports whether Shutdown was called.
+func (s *Server) Draining() bool {
+	return atomic.LoadInt32(&s.draining) == 1
+}
+
+// ReadinessHandler returns a handler responding with 204 No Content while the
+// server is serving and with 503 Service Unavailable once Shutdown was called.
+// Register it as the readiness check of the load balancer.
+func (s *Server) ReadinessHandler() Handler {
+	return HandlerFunc(func(w ResponseWriter, r *IncomingRequest) Result {
+		if s.Draining() {
+			return w.WriteError(StatusServiceUnavailable)
+		}
+		return w.Write(NoContentResponse{})
+	})
 }
 
 // Close is a wrapper for https://golang.org/pkg/net/http/#Server.Close
@@ -188,5 +293,11 @@ func (s *Server) Close() error {
 	if !s.started {
 		return errors.New("closing unstarted server")
 	}
-	return s.srv.Close()
+	err := s.srv.Close()
+	for _, l := range s.extra {
+		if lerr := l.srv.Close(); err == nil {
+			err = lerr
+		}
+	}
+	return err
 }
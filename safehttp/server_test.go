@@ -17,8 +17,14 @@ package safehttp
 import (
 	"bufio"
 	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net"
 	"net/http"
+	"net/http/httptest"
 	"net/http/httputil"
+	"strings"
 	"testing"
 	"time"
 
@@ -73,3 +79,205 @@ func TestServer(t *testing.T) {
 		t.Errorf("Builder did not set WriteTimeout: got %v want %v", s.srv.WriteTimeout, 5*time.Second)
 	}
 }
+
+func TestServerShutdownDrains(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.Listen: %v", err)
+	}
+	started, release := make(chan struct{}), make(chan struct{})
+	mux := NewServeMuxConfig(nil).Mux()
+	mux.Handle("/slow", "GET", HandlerFunc(func(w ResponseWriter, r *IncomingRequest) Result {
+		close(started)
+		<-release
+		return w.Write(safehtml.HTMLEscaped("done"))
+	}))
+	var drained []string
+	s := &Server{
+		Mux:        mux,
+		DrainDelay: 10 * time.Millisecond,
+		OnDrained: []func(context.Context) error{
+			func(context.Context) error {
+				drained = append(drained, "first")
+				return nil
+			},
+			func(context.Context) error {
+				drained = append(drained, "second")
+				return errors.New("flush failed")
+			},
+		},
+	}
+	mux.Handle("/ready", "GET", s.ReadinessHandler())
+	go s.Serve(l)
+
+	ready := func() int {
+		rw := httptest.NewRecorder()
+		mux.ServeHTTP(rw, httptest.NewRequest("GET", "/ready", nil))
+		return rw.Code
+	}
+	if got, want := ready(), http.StatusNoContent; got != want {
+		t.Errorf("readiness before Shutdown: got %v, want %v", got, want)
+	}
+
+	respc := make(chan string)
+	go func() {
+		resp, err := http.Get("http://" + l.Addr().String() + "/slow")
+		if err != nil {
+			respc <- err.Error()
+			return
+		}
+		defer resp.Body.Close()
+		b, _ := ioutil.ReadAll(resp.Body)
+		respc <- string(b)
+	}()
+	<-started
+
+	shutdownErr := make(chan error)
+	go func() { shutdownErr <- s.Shutdown(context.Background()) }()
+	for !s.Draining() {
+		time.Sleep(time.Millisecond)
+	}
+	if got, want := ready(), http.StatusServiceUnavailable; got != want {
+		t.Errorf("readiness during Shutdown: got %v, want %v", got, want)
+	}
+	close(release)
+
+	if got, want := <-respc, "done"; got != want {
+		t.Errorf("in-flight response: got %q, want %q", got, want)
+	}
+	if err := <-shutdownErr; err == nil || err.Error() != "flush failed" {
+		t.Errorf("s.Shutdown(): got %v, want the OnDrained error", err)
+	}
+	if got, want := strings.Join(drained, ","), "first,second"; got != want {
+		t.Errorf("OnDrained calls: got %q, want %q", got, want)
+	}
+}
+
+func TestServerReload(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.Listen: %v", err)
+	}
+	started, release := make(chan struct{}), make(chan struct{})
+	newMux := func(generation string, block bool) *ServeMux {
+		mux := NewServeMuxConfig(nil).Mux()
+		mux.Handle("/", "GET", HandlerFunc(func(w ResponseWriter, r *IncomingRequest) Result {
+			if block {
+				close(started)
+				<-release
+			}
+			return w.Write(safehtml.HTMLEscaped(generation))
+		}))
+		return mux
+	}
+	s := &Server{Mux: newMux("old", true)}
+	go s.Serve(l)
+	defer s.Close()
+
+	get := func() string {
+		resp, err := http.Get("http://" + l.Addr().String() + "/")
+		if err != nil {
+			return err.Error()
+		}
+		defer resp.Body.Close()
+		b, _ := ioutil.ReadAll(resp.Body)
+		return string(b)
+	}
+	oldResp := make(chan string)
+	go func() { oldResp <- get() }()
+	<-started
+
+	reloaded := make(chan error)
+	go func() { reloaded <- s.Reload(context.Background(), newMux("new", false)) }()
+
+	for swapped := false; !swapped; time.Sleep(time.Millisecond) {
+		s.gens.mu.Lock()
+		swapped = s.gens.current.mux != s.Mux
+		s.gens.mu.Unlock()
+	}
+	// Requests received after the reload are served by the new ServeMux,
+	// while the old one still has a request in flight.
+	if got, want := get(), "new"; got != want {
+		t.Errorf("response after Reload: got %q, want %q", got, want)
+	}
+	select {
+	case err := <-reloaded:
+		t.Fatalf("s.Reload() returned before draining: %v", err)
+	default:
+	}
+
+	close(release)
+	if got, want := <-oldResp, "old"; got != want {
+		t.Errorf("in-flight response: got %q, want %q", got, want)
+	}
+	if err := <-reloaded; err != nil {
+		t.Errorf("s.Reload(): got %v, want nil", err)
+	}
+}
+
+func TestServerReloadTimeout(t *testing.T) {
+	gens := newMuxGenerations(NewServeMuxConfig(nil).Mux())
+	gens.current.active = 1
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := gens.swap(ctx, NewServeMuxConfig(nil).Mux()); !errors.Is(err, context.Canceled) {
+		t.Errorf("swap with a request in flight: got %v, want context.Canceled", err)
+	}
+}
+
+func TestServerListeners(t *testing.T) {
+	newMux := func(body string) *ServeMux {
+		mux := NewServeMuxConfig(nil).Mux()
+		mux.Handle("/", "GET", HandlerFunc(func(w ResponseWriter, r *IncomingRequest) Result {
+			return w.Write(safehtml.HTMLEscaped(body))
+		}))
+		return mux
+	}
+	public, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.Listen: %v", err)
+	}
+	admin, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.Listen: %v", err)
+	}
+	s := &Server{
+		Mux:       newMux("public"),
+		Listeners: []Listener{{Listener: admin, Mux: newMux("admin")}},
+	}
+	served := make(chan error)
+	go func() { served <- s.Serve(public) }()
+
+	get := func(l net.Listener) string {
+		resp, err := http.Get("http://" + l.Addr().String() + "/")
+		if err != nil {
+			return err.Error()
+		}
+		defer resp.Body.Close()
+		b, _ := ioutil.ReadAll(resp.Body)
+		return string(b)
+	}
+	if got, want := get(public), "public"; got != want {
+		t.Errorf("public listener: got %q, want %q", got, want)
+	}
+	if got, want := get(admin), "admin"; got != want {
+		t.Errorf("admin listener: got %q, want %q", got, want)
+	}
+
+	if err := s.Shutdown(context.Background()); err != nil {
+		t.Errorf("s.Shutdown(): %v", err)
+	}
+	if err := <-served; err != http.ErrServerClosed {
+		t.Errorf("s.Serve(): got %v, want http.ErrServerClosed", err)
+	}
+	if _, err := http.Get("http://" + admin.Addr().String() + "/"); err == nil {
+		t.Error("admin listener still serving after Shutdown")
+	}
+}
+
+func TestServerListenersInvalid(t *testing.T) {
+	s := &Server{Mux: NewServeMuxConfig(nil).Mux(), Listeners: []Listener{{Addr: "127.0.0.1:0"}}}
+	if err := s.ListenAndServe(); err == nil {
+		t.Error("s.ListenAndServe() with a listener without mux: got nil error")
+	}
+}
@@ -0,0 +1,158 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package safehttp
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// maxSimulatedBody is the maximum number of bytes of a response body recorded
+// by a Simulation.
+const maxSimulatedBody = 4 << 10
+
+// Simulation is the outcome of running a hypothetical request through the
+// interceptors of a ServeMux, see ServeMux.Simulate.
+type Simulation struct {
+	// Route is the handler the request was matched with, or nil if none was,
+	// e.g. because the path isn't registered or the method isn't allowed.
+	Route *Route
+	// Steps are the Before phases run, in order.
+	Steps []SimulationStep
+	// BlockedBy is the interceptor which wrote a response in its Before
+	// phase, or nil if none did.
+	BlockedBy Interceptor
+	// ReachedHandler reports whether the handler would have been called. It
+	// is never actually called.
+	ReachedHandler bool
+	// StatusCode, Header and Body are the response written instead of calling
+	// the handler, e.g. by the blocking interceptor. Body is truncated to
+	// 4KiB.
+	StatusCode StatusCode
+	Header     http.Header
+	Body       []byte
+}
+
+// SimulationStep is the Before phase of an interceptor run during a
+// Simulation.
+type SimulationStep struct {
+	Interceptor Interceptor
+	// Config is the InterceptorConfig of the handler matched by the
+	// interceptor, if any.
+	Config InterceptorConfig
+	// Wrote reports whether the interceptor wrote a response, ending the
+	// request processing.
+	Wrote bool
+}
+
+// String summarizes how the request was handled, e.g.
+// "GET /admin/: blocked by xsrf.Interceptor (403 Forbidden)".
+func (s *Simulation) String() string {
+	var b strings.Builder
+	if s.Route != nil {
+		fmt.Fprintf(&b, "%s %s: ", s.Route.Method, s.Route.Pattern)
+	}
+	switch {
+	case s.ReachedHandler:
+		fmt.Fprintf(&b, "reached the handler after %d interceptors", len(s.Steps))
+	case s.BlockedBy != nil:
+		fmt.Fprintf(&b, "blocked by %T (%d %s)", s.BlockedBy, s.StatusCode, s.StatusCode)
+	default:
+		fmt.Fprintf(&b, "not routed to a handler (%d %s)", s.StatusCode, s.StatusCode)
+	}
+	return b.String()
+}
+
+type simulationCtxKey struct{}
+
+func simulationFromContext(ctx context.Context) *Simulation {
+	s, _ := ctx.Value(simulationCtxKey{}).(*Simulation)
+	return s
+}
+
+// Simulate evaluates how r would be handled by the ServeMux without calling
+// the handler it matches: which interceptors would run, which one, if any,
+// would reject the request and with which response. It's meant for debugging
+// rejected requests and for building admin tooling.
+//
+// The Before phases of the interceptors, and the Commit phases of the
+// responses they write, run as they would for a real request. Interceptors
+// with side effects, e.g. counting requests against a quota, apply them.
+func (m *ServeMux) Simulate(r *http.Request) *Simulation {
+	sim := &Simulation{}
+	rec := &simulationRecorder{header: http.Header{}}
+	m.ServeHTTP(rec, r.WithContext(context.WithValue(r.Context(), simulationCtxKey{}, sim)))
+	if !sim.ReachedHandler {
+		sim.StatusCode = StatusCode(rec.code)
+		if sim.StatusCode == 0 {
+			sim.StatusCode = StatusOK
+		}
+		sim.Header = rec.header
+		sim.Body = rec.body.Bytes()
+	}
+	return sim
+}
+
+// simulate records the Before phases of a flight in sim instead of calling
+// the handler.
+func (f *flight) simulate(sim *Simulation) {
+	for _, it := range f.cfg.Interceptors {
+		it.Before(f, f.req)
+		sim.Steps = append(sim.Steps, SimulationStep{Interceptor: it.interceptor, Config: it.config, Wrote: f.written})
+		if f.written {
+			sim.BlockedBy = it.interceptor
+			return
+		}
+	}
+	if sim.Route == nil {
+		// The request isn't routed to a handler, e.g. its method isn't
+		// allowed, and is rejected by the handler configured for that.
+		f.cfg.Handler.ServeHTTP(f, f.req)
+		return
+	}
+	sim.ReachedHandler = true
+}
+
+// simulationRecorder is an http.ResponseWriter recording the response written
+// during a Simulation.
+type simulationRecorder struct {
+	header http.Header
+	code   int
+	body   bytes.Buffer
+}
+
+func (r *simulationRecorder) Header() http.Header {
+	return r.header
+}
+
+func (r *simulationRecorder) WriteHeader(code int) {
+	if r.code == 0 {
+		r.code = code
+	}
+}
+
+func (r *simulationRecorder) Write(b []byte) (int, error) {
+	r.WriteHeader(http.StatusOK)
+	if n := maxSimulatedBody - r.body.Len(); n > 0 {
+		if len(b) < n {
+			n = len(b)
+		}
+		r.body.Write(b[:n])
+	}
+	return len(b), nil
+}
@@ -0,0 +1,164 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package safehttp_test
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-safeweb/safehttp"
+	"github.com/google/safehtml"
+)
+
+// authInterceptor rejects requests without an Authorization header, unless
+// the handler is configured with authExempt.
+type authInterceptor struct{}
+
+type authExempt struct{}
+
+func (authInterceptor) Before(w safehttp.ResponseWriter, r *safehttp.IncomingRequest, cfg safehttp.InterceptorConfig) safehttp.Result {
+	if cfg == nil && r.Header.Get("Authorization") == "" {
+		return w.WriteError(safehttp.StatusUnauthorized)
+	}
+	return safehttp.NotWritten()
+}
+
+func (authInterceptor) Commit(w safehttp.ResponseHeadersWriter, r *safehttp.IncomingRequest, resp safehttp.Response, cfg safehttp.InterceptorConfig) {
+}
+
+func (authInterceptor) Match(cfg safehttp.InterceptorConfig) bool {
+	_, ok := cfg.(authExempt)
+	return ok
+}
+
+func TestMuxSimulate(t *testing.T) {
+	mb := safehttp.NewServeMuxConfig(nil)
+	mb.Intercept(setHeaderInterceptor{name: "Foo", value: "bar"}, authInterceptor{})
+	mux := mb.Mux()
+	called := false
+	h := safehttp.HandlerFunc(func(w safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+		called = true
+		return w.Write(safehtml.HTMLEscaped("ok"))
+	})
+	mux.Handle("/admin", safehttp.MethodGet, h)
+	mux.Handle("/public", safehttp.MethodGet, h, authExempt{})
+
+	tests := []struct {
+		name        string
+		method      string
+		path        string
+		auth        string
+		wantReached bool
+		wantBlocked bool
+		wantSteps   int
+		wantCode    safehttp.StatusCode
+		wantString  string
+	}{
+		{
+			name:        "Blocked",
+			method:      safehttp.MethodGet,
+			path:        "/admin",
+			wantBlocked: true,
+			wantSteps:   2,
+			wantCode:    safehttp.StatusUnauthorized,
+			wantString:  "GET /admin: blocked by safehttp_test.authInterceptor (401 Unauthorized)",
+		},
+		{
+			name:        "Authorized",
+			method:      safehttp.MethodGet,
+			path:        "/admin",
+			auth:        "Bearer token",
+			wantReached: true,
+			wantSteps:   2,
+			wantString:  "GET /admin: reached the handler after 2 interceptors",
+		},
+		{
+			name:        "Exempt",
+			method:      safehttp.MethodGet,
+			path:        "/public",
+			wantReached: true,
+			wantSteps:   2,
+			wantString:  "GET /public: reached the handler after 2 interceptors",
+		},
+		{
+			name:       "Not found",
+			method:     safehttp.MethodGet,
+			path:       "/missing",
+			wantCode:   safehttp.StatusNotFound,
+			wantString: "not routed to a handler (404 Not Found)",
+		},
+		{
+			name:       "Method not allowed",
+			method:     safehttp.MethodPost,
+			path:       "/public",
+			auth:       "Bearer token",
+			wantSteps:  2,
+			wantCode:   safehttp.StatusMethodNotAllowed,
+			wantString: "not routed to a handler (405 Method Not Allowed)",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "http://foo.com"+tt.path, nil)
+			if tt.auth != "" {
+				req.Header.Set("Authorization", tt.auth)
+			}
+			sim := mux.Simulate(req)
+
+			if called {
+				t.Fatal("handler called during simulation")
+			}
+			if sim.ReachedHandler != tt.wantReached {
+				t.Errorf("sim.ReachedHandler: got %v, want %v", sim.ReachedHandler, tt.wantReached)
+			}
+			if got := sim.BlockedBy != nil; got != tt.wantBlocked {
+				t.Errorf("sim.BlockedBy: got %v, want blocked %v", sim.BlockedBy, tt.wantBlocked)
+			}
+			if len(sim.Steps) != tt.wantSteps {
+				t.Errorf("len(sim.Steps): got %d, want %d", len(sim.Steps), tt.wantSteps)
+			}
+			if sim.StatusCode != tt.wantCode {
+				t.Errorf("sim.StatusCode: got %v, want %v", sim.StatusCode, tt.wantCode)
+			}
+			if got := sim.String(); got != tt.wantString {
+				t.Errorf("sim.String(): got %q, want %q", got, tt.wantString)
+			}
+		})
+	}
+}
+
+func TestMuxSimulateRecordsResponse(t *testing.T) {
+	mb := safehttp.NewServeMuxConfig(nil)
+	mb.Intercept(setHeaderInterceptor{name: "Foo", value: "bar"}, authInterceptor{})
+	mux := mb.Mux()
+	mux.Handle("/admin", safehttp.MethodGet, safehttp.HandlerFunc(func(w safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+		return w.Write(safehtml.HTMLEscaped("ok"))
+	}))
+
+	sim := mux.Simulate(httptest.NewRequest(safehttp.MethodGet, "http://foo.com/admin", nil))
+
+	if got, want := sim.Header.Get("Foo"), "bar"; got != want {
+		t.Errorf(`sim.Header.Get("Foo"): got %q, want %q`, got, want)
+	}
+	if got, want := string(sim.Body), "Unauthorized\n"; got != want {
+		t.Errorf("sim.Body: got %q, want %q", got, want)
+	}
+	if sim.Route == nil || sim.Route.Pattern != "/admin" || len(sim.Route.Interceptors) != 2 {
+		t.Errorf("sim.Route: got %+v, want /admin with 2 interceptors", sim.Route)
+	}
+	if sim.Steps[0].Wrote || !sim.Steps[1].Wrote {
+		t.Errorf("sim.Steps: got %+v, want only the second one to write", sim.Steps)
+	}
+}
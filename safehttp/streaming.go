@@ -0,0 +1,86 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package safehttp
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+)
+
+// StreamingResponse streams a large body, e.g. a CSV export or a long JSON
+// array, to the client as it's produced instead of materializing it in
+// memory.
+//
+// The response headers, including those set by the Commit phase of the
+// interceptors, are sent before Stream is called and can't be changed
+// afterwards. An error returned by Stream once bytes have been written can't
+// be turned into an error response anymore: the framework aborts the
+// response instead, so the client sees it as truncated.
+type StreamingResponse struct {
+	// ContentType is the Content-Type of the response. Its media type must be
+	// registered in the MIMETypes of the Dispatcher, and it's written as
+	// registered there, e.g. with a charset of utf-8 for CSV. Types which
+	// browsers render or execute, e.g. HTML or JavaScript, can't be streamed,
+	// as the streamed bytes are written as is. JSON responses are prefixed
+	// like JSONResponses to prevent XSSI.
+	ContentType string
+	// Stream writes the body of the response to sw. Stream should stop and
+	// return the error if writing fails, which happens when the client went
+	// away.
+	Stream func(sw *StreamWriter) error
+}
+
+// StreamWriter writes the body of a StreamingResponse. Written bytes are
+// buffered by the underlying connection until Flush is called.
+type StreamWriter struct {
+	rw      http.ResponseWriter
+	flusher http.Flusher
+}
+
+// Write writes p to the response body.
+func (sw *StreamWriter) Write(p []byte) (int, error) {
+	return sw.rw.Write(p)
+}
+
+// Flush sends the bytes written so far to the client.
+func (sw *StreamWriter) Flush() {
+	if sw.flusher != nil {
+		sw.flusher.Flush()
+	}
+}
+
+func writeStreaming(rw http.ResponseWriter, resp StreamingResponse, types *MIMETypes, xssiPrefix string) error {
+	mt, _, err := mime.ParseMediaType(resp.ContentType)
+	if err != nil || activeMediaTypes[mt] {
+		return fmt.Errorf("%w: %q can't be streamed", ErrUnsupportedResponseType, resp.ContentType)
+	}
+	ct, err := types.ContentType(resp.ContentType)
+	if err != nil {
+		return err
+	}
+	rw.Header().Set("Content-Type", ct)
+	if mt == "application/json" {
+		io.WriteString(rw, xssiPrefix)
+	}
+	flusher, _ := rw.(http.Flusher)
+	sw := &StreamWriter{rw: rw, flusher: flusher}
+	if err := resp.Stream(sw); err != nil {
+		return err
+	}
+	sw.Flush()
+	return nil
+}
@@ -0,0 +1,123 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package safehttp_test
+
+import (
+	"errors"
+	"io"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-safeweb/safehttp"
+)
+
+func TestStreamingResponse(t *testing.T) {
+	tests := []struct {
+		name            string
+		contentType     string
+		wantContentType string
+		wantBody        string
+	}{
+		{
+			name:            "CSV",
+			contentType:     "text/csv; charset=utf-8",
+			wantContentType: "text/csv; charset=utf-8",
+			wantBody:        "a,b\n1,2\n",
+		},
+		{
+			name:            "JSON",
+			contentType:     "application/json",
+			wantContentType: "application/json; charset=utf-8",
+			wantBody:        ")]}',\na,b\n1,2\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rw := httptest.NewRecorder()
+			var flushedBeforeEnd bool
+			resp := safehttp.StreamingResponse{
+				ContentType: tt.contentType,
+				Stream: func(sw *safehttp.StreamWriter) error {
+					io.WriteString(sw, "a,b\n")
+					sw.Flush()
+					flushedBeforeEnd = rw.Flushed
+					_, err := io.WriteString(sw, "1,2\n")
+					return err
+				},
+			}
+			if err := (safehttp.DefaultDispatcher{}).Write(rw, resp); err != nil {
+				t.Fatalf("Write() got err: %v", err)
+			}
+
+			if got := rw.Header().Get("Content-Type"); got != tt.wantContentType {
+				t.Errorf("Content-Type: got %q, want %q", got, tt.wantContentType)
+			}
+			if got := rw.Body.String(); got != tt.wantBody {
+				t.Errorf("body: got %q, want %q", got, tt.wantBody)
+			}
+			if !flushedBeforeEnd {
+				t.Error("Flush() didn't flush the response")
+			}
+		})
+	}
+}
+
+func TestStreamingResponseUnsafeContentType(t *testing.T) {
+	for _, ct := range []string{"text/html", "application/javascript", "image/svg+xml", "text/css", ""} {
+		t.Run(ct, func(t *testing.T) {
+			rw := httptest.NewRecorder()
+			called := false
+			resp := safehttp.StreamingResponse{
+				ContentType: ct,
+				Stream: func(sw *safehttp.StreamWriter) error {
+					called = true
+					return nil
+				},
+			}
+			err := (safehttp.DefaultDispatcher{}).Write(rw, resp)
+			if !errors.Is(err, safehttp.ErrUnsupportedResponseType) {
+				t.Errorf("Write() got err: %v, want %v", err, safehttp.ErrUnsupportedResponseType)
+			}
+			if called {
+				t.Error("Stream was called for an unsafe Content-Type")
+			}
+		})
+	}
+}
+
+func TestStreamingResponseCommitBeforeStream(t *testing.T) {
+	mb := safehttp.NewServeMuxConfig(nil)
+	mb.Intercept(committerInterceptor{})
+	mux := mb.Mux()
+	mux.Handle("/", safehttp.MethodGet, safehttp.HandlerFunc(func(w safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+		return w.Write(safehttp.StreamingResponse{
+			ContentType: "text/plain",
+			Stream: func(sw *safehttp.StreamWriter) error {
+				_, err := io.WriteString(sw, "hello")
+				return err
+			},
+		})
+	}))
+
+	rw := httptest.NewRecorder()
+	mux.ServeHTTP(rw, httptest.NewRequest("GET", "https://foo.com/", nil))
+	// The recorder snapshots the headers on the first write of the body.
+	if got, want := rw.Result().Header.Get("Foo"), "bar"; got != want {
+		t.Errorf("Foo header: got %q, want %q", got, want)
+	}
+	if got, want := rw.Body.String(), "hello"; got != want {
+		t.Errorf("body: got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,79 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package safehttp
+
+import (
+	"errors"
+	"net/http"
+	"time"
+)
+
+// TarpitResponse slowly trickles a minimal response to the client, one byte
+// at a time, to slow down abusive clients, e.g. scrapers, which would quickly
+// detect and work around an immediate error response.
+//
+// Writing a TarpitResponse blocks for the configured Duration, or until the
+// client goes away. Use the tarpit plugin to bound the number of concurrent
+// tarpitted requests.
+type TarpitResponse struct {
+	// Request is the request the response is written for. Trickling stops
+	// when its context is done. It's required.
+	Request *IncomingRequest
+	// Code is the status code of the response. If zero, 200 OK is used.
+	Code StatusCode
+	// Interval is the time between two bytes. If zero, one second is used.
+	Interval time.Duration
+	// Duration is how long the response is trickled for.
+	Duration time.Duration
+}
+
+func writeTarpit(rw http.ResponseWriter, resp TarpitResponse) error {
+	if resp.Request == nil {
+		return errors.New("TarpitResponse without a Request")
+	}
+	code := resp.Code
+	if code == 0 {
+		code = StatusOK
+	}
+	rw.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	rw.WriteHeader(int(code))
+	flusher, _ := rw.(http.Flusher)
+
+	done := resp.Request.Context().Done()
+	deadline := time.NewTimer(resp.Duration)
+	defer deadline.Stop()
+	interval := resp.Interval
+	if interval <= 0 {
+		interval = time.Second
+	}
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-done:
+			return nil
+		case <-deadline.C:
+			return nil
+		case <-tick.C:
+			if _, err := rw.Write([]byte{'\n'}); err != nil {
+				// The client went away.
+				return nil
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+	}
+}
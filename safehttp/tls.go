@@ -0,0 +1,187 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package safehttp
+
+import (
+	"crypto/tls"
+	"errors"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// certReloadInterval is how often certificate files are checked for changes.
+const certReloadInterval = time.Minute
+
+// ServerTLSConfig builds hardened TLS configurations for Server:
+//
+//   - TLS 1.2 is the minimum version, TLS 1.3 can be required with
+//     RequireTLS13,
+//   - with TLS 1.2, only ECDHE key exchanges with AEAD ciphers are allowed,
+//   - HTTP/2 is negotiated through ALPN,
+//   - certificates loaded from files are reloaded when the files change,
+//     without restarting the server.
+//
+// Use it with Server.ListenAndServeTLS or Server.ServeTLS, passing no
+// certificate files:
+//
+//	c := safehttp.NewServerTLSConfig()
+//	if err := c.LoadCertificate("cert.pem", "key.pem"); err != nil {
+//		// ...
+//	}
+//	s := &safehttp.Server{Mux: mux, TLSConfig: c.Config()}
+//	err := s.ListenAndServeTLS("", "")
+type ServerTLSConfig struct {
+	clock Clock
+	tls13 bool
+
+	mu    sync.Mutex
+	certs []*reloadableCert
+}
+
+// reloadableCert is a certificate loaded from files.
+type reloadableCert struct {
+	certFile, keyFile string
+	cert              *tls.Certificate
+	// modTimes are the modification times of the files the certificate was
+	// loaded from.
+	modTimes  [2]time.Time
+	checkedAt time.Time
+}
+
+// NewServerTLSConfig creates a ServerTLSConfig without certificates.
+func NewServerTLSConfig() *ServerTLSConfig {
+	return &ServerTLSConfig{clock: SystemClock()}
+}
+
+// LoadCertificate loads a PEM encoded certificate chain and its private key.
+// The files are checked for changes every minute during handshakes and the
+// certificate is reloaded if they changed. If a reload fails, the previous
+// certificate keeps being used.
+//
+// When multiple certificates are loaded, the first one supported by the
+// client is used, e.g. based on the SNI server name.
+func (c *ServerTLSConfig) LoadCertificate(certFile, keyFile string) error {
+	rc := &reloadableCert{certFile: certFile, keyFile: keyFile}
+	if err := rc.load(c.clock.Now()); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	c.certs = append(c.certs, rc)
+	c.mu.Unlock()
+	return nil
+}
+
+// RequireTLS13 makes TLS 1.3 the minimum version.
+func (c *ServerTLSConfig) RequireTLS13() {
+	c.tls13 = true
+}
+
+// Reload reloads all the certificates from their files, e.g. on SIGHUP, without
+// waiting for the periodic check. If a certificate fails to load, the
+// previous one is kept and the error is returned.
+func (c *ServerTLSConfig) Reload() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var err error
+	for _, rc := range c.certs {
+		if lerr := rc.load(c.clock.Now()); err == nil {
+			err = lerr
+		}
+	}
+	return err
+}
+
+// Config returns the tls.Config to use.
+func (c *ServerTLSConfig) Config() *tls.Config {
+	cfg := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		// Ignored with TLS 1.3, whose cipher suites are all secure.
+		CipherSuites: []uint16{
+			tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305,
+			tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305,
+		},
+		CurvePreferences: []tls.CurveID{tls.X25519, tls.CurveP256},
+		NextProtos:       []string{"h2", "http/1.1"},
+		GetCertificate:   c.getCertificate,
+	}
+	if c.tls13 {
+		cfg.MinVersion = tls.VersionTLS13
+	}
+	return cfg
+}
+
+func (c *ServerTLSConfig) getCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	now := c.clock.Now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.certs) == 0 {
+		return nil, errors.New("no TLS certificate configured")
+	}
+	for _, rc := range c.certs {
+		rc.reloadIfChanged(now)
+	}
+	for _, rc := range c.certs {
+		if hello.SupportsCertificate(rc.cert) == nil {
+			return rc.cert, nil
+		}
+	}
+	// Let the client decide whether the certificate is acceptable.
+	return c.certs[0].cert, nil
+}
+
+func (rc *reloadableCert) reloadIfChanged(now time.Time) {
+	if now.Sub(rc.checkedAt) < certReloadInterval {
+		return
+	}
+	rc.checkedAt = now
+	modTimes, err := rc.stat()
+	if err != nil || modTimes == rc.modTimes {
+		return
+	}
+	if err := rc.load(now); err != nil {
+		log.Printf("reloading TLS certificate %q: %v", rc.certFile, err)
+	}
+}
+
+func (rc *reloadableCert) load(now time.Time) error {
+	modTimes, err := rc.stat()
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(rc.certFile, rc.keyFile)
+	if err != nil {
+		return err
+	}
+	rc.cert, rc.modTimes, rc.checkedAt = &cert, modTimes, now
+	return nil
+}
+
+func (rc *reloadableCert) stat() ([2]time.Time, error) {
+	var modTimes [2]time.Time
+	for i, f := range []string{rc.certFile, rc.keyFile} {
+		fi, err := os.Stat(f)
+		if err != nil {
+			return modTimes, err
+		}
+		modTimes[i] = fi.ModTime()
+	}
+	return modTimes, nil
+}
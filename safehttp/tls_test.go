@@ -0,0 +1,154 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package safehttp
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// fixedClock is a Clock that only moves when told to. The safehttptest
+// FakeClock can't be used from the package's internal tests.
+type fixedClock struct {
+	now time.Time
+}
+
+func (c *fixedClock) Now() time.Time {
+	return c.now
+}
+
+// writeCert writes a self-signed certificate for the given name and its key
+// to dir, returning their paths.
+func writeCert(t *testing.T, dir, name string) (certFile, keyFile string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("ecdsa.GenerateKey: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("x509.CreateCertificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("x509.MarshalECPrivateKey: %v", err)
+	}
+	certFile, keyFile = filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if err := ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+func commonName(t *testing.T, cert *tls.Certificate) string {
+	t.Helper()
+	c, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatalf("x509.ParseCertificate: %v", err)
+	}
+	return c.Subject.CommonName
+}
+
+func TestServerTLSConfig(t *testing.T) {
+	c := NewServerTLSConfig()
+	cfg := c.Config()
+	if cfg.MinVersion != tls.VersionTLS12 {
+		t.Errorf("MinVersion: got %#x, want TLS 1.2", cfg.MinVersion)
+	}
+	for _, id := range cfg.CipherSuites {
+		for _, s := range tls.InsecureCipherSuites() {
+			if s.ID == id {
+				t.Errorf("CipherSuites: got insecure %s", s.Name)
+			}
+		}
+	}
+	if len(cfg.NextProtos) == 0 || cfg.NextProtos[0] != "h2" {
+		t.Errorf("NextProtos: got %v, want h2 first", cfg.NextProtos)
+	}
+	if _, err := cfg.GetCertificate(&tls.ClientHelloInfo{}); err == nil {
+		t.Error("GetCertificate without certificates: got nil error")
+	}
+
+	c.RequireTLS13()
+	if got := c.Config().MinVersion; got != tls.VersionTLS13 {
+		t.Errorf("MinVersion after RequireTLS13: got %#x, want TLS 1.3", got)
+	}
+}
+
+func TestServerTLSConfigReload(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeCert(t, dir, "old.example.com")
+	clock := &fixedClock{now: time.Now()}
+	c := NewServerTLSConfig()
+	c.clock = clock
+	if err := c.LoadCertificate(certFile, keyFile); err != nil {
+		t.Fatalf("LoadCertificate: %v", err)
+	}
+	cfg := c.Config()
+	get := func() string {
+		cert, err := cfg.GetCertificate(&tls.ClientHelloInfo{})
+		if err != nil {
+			t.Fatalf("GetCertificate: %v", err)
+		}
+		return commonName(t, cert)
+	}
+
+	writeCert(t, dir, "new.example.com")
+	// Make sure the modification times change, whatever their resolution.
+	later := time.Now().Add(time.Hour)
+	for _, f := range []string{certFile, keyFile} {
+		if err := os.Chtimes(f, later, later); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got, want := get(), "old.example.com"; got != want {
+		t.Errorf("certificate before the check interval: got %q, want %q", got, want)
+	}
+	clock.now = clock.now.Add(certReloadInterval)
+	if got, want := get(), "new.example.com"; got != want {
+		t.Errorf("certificate after the check interval: got %q, want %q", got, want)
+	}
+
+	if err := ioutil.WriteFile(certFile, []byte("garbage"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Reload(); err == nil {
+		t.Error("Reload with an invalid certificate: got nil error")
+	}
+	if got, want := get(), "new.example.com"; got != want {
+		t.Errorf("certificate after a failed reload: got %q, want %q", got, want)
+	}
+}
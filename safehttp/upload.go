@@ -0,0 +1,303 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package safehttp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const (
+	defaultUploadMaxMemory   = 10 << 20
+	defaultUploadMaxFileSize = 10 << 20
+	defaultUploadMaxFiles    = 10
+	defaultUploadScanTimeout = 30 * time.Second
+)
+
+// UploadOptions configures the parsing of file uploads.
+type UploadOptions struct {
+	// MaxMemory is the number of bytes of the files stored in main memory,
+	// the rest being stored on disk in temporary files. If zero, 10 MiB is
+	// used.
+	MaxMemory int64
+	// MaxFileSize is the maximum size of an uploaded file. If zero, 10 MiB is
+	// used.
+	MaxFileSize int64
+	// MaxFiles is the maximum number of uploaded files. If zero, 10 is used.
+	MaxFiles int
+	// Scanner, if set, scans every uploaded file before Uploads returns.
+	// Uploads fails if any file is rejected or can't be scanned, so handlers
+	// never see unscanned files.
+	Scanner UploadScanner
+	// ScanTimeout bounds the scan of each file. If zero, 30 seconds is used.
+	ScanTimeout time.Duration
+	// OnScan, if set, is called with the outcome of every scan, e.g. to
+	// record metrics or to copy rejected files to a quarantine area. The
+	// files are removed once Uploads returns an error.
+	OnScan func(UploadScan)
+}
+
+// UploadScanner scans uploaded files, e.g. for malware.
+type UploadScanner interface {
+	// Scan reads the content of the uploaded file and returns an error
+	// wrapping ErrUploadRejected if the file must be rejected, or any other
+	// error if the scan couldn't be completed.
+	Scan(ctx context.Context, f *UploadedFile, content io.Reader) error
+}
+
+// UploadScan is the outcome of the scan of an uploaded file.
+type UploadScan struct {
+	// Field is the form key the file was uploaded for.
+	Field string
+	// File is the scanned file.
+	File *UploadedFile
+	// Duration is how long the scan took.
+	Duration time.Duration
+	// Err is the error returned by the scanner, if any.
+	Err error
+}
+
+// UploadedFile is a file uploaded in a multipart form.
+type UploadedFile struct {
+	// Filename is the name of the file, without any directory and control
+	// characters. It's still chosen by the client and shouldn't be trusted,
+	// e.g. to pick where the file is stored.
+	Filename string
+	// Size is the size of the file in bytes.
+	Size int64
+	// ContentType is the Content-Type of the file, sniffed from its contents
+	// using net/http.DetectContentType.
+	ContentType string
+	// DeclaredContentType is the Content-Type sent by the client. It
+	// shouldn't be trusted.
+	DeclaredContentType string
+
+	fh *multipart.FileHeader
+}
+
+// Open opens the file.
+func (f *UploadedFile) Open() (multipart.File, error) {
+	return f.fh.Open()
+}
+
+// UploadForm is a parsed multipart form holding file uploads.
+type UploadForm struct {
+	Form
+	files map[string][]*UploadedFile
+	mf    *multipart.Form
+}
+
+// Files returns the files uploaded for the form key param, or a nil slice if
+// none.
+func (f *UploadForm) Files(param string) []*UploadedFile {
+	return f.files[param]
+}
+
+// RemoveFiles removes any temporary files associated with the form and
+// returns the first error that occurred, if any.
+func (f *UploadForm) RemoveFiles() error {
+	return f.mf.RemoveAll()
+}
+
+func (f *UploadForm) scan(ctx context.Context, opts UploadOptions) error {
+	keys := make([]string, 0, len(f.files))
+	for k := range f.files {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		for _, file := range f.files[k] {
+			start := time.Now()
+			err := scanFile(ctx, opts, file)
+			if opts.OnScan != nil {
+				opts.OnScan(UploadScan{Field: k, File: file, Duration: time.Since(start), Err: err})
+			}
+			if err != nil {
+				return fmt.Errorf("scanning file %q: %w", k, err)
+			}
+		}
+	}
+	return nil
+}
+
+func scanFile(ctx context.Context, opts UploadOptions, file *UploadedFile) error {
+	ctx, cancel := context.WithTimeout(ctx, opts.ScanTimeout)
+	defer cancel()
+	content, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer content.Close()
+	return opts.Scanner.Scan(ctx, file, content)
+}
+
+// Uploads parses the multipart/form-data body of a POST, PATCH or PUT request
+// holding file uploads. Forms with more than opts.MaxFiles files, or with a
+// file larger than opts.MaxFileSize, are rejected with an error wrapping
+// ErrBodyTooLarge. The body is read at most once, so Uploads can't be combined
+// with MultipartForm.
+//
+// If opts.Scanner is set, the files are scanned before Uploads returns, and a
+// rejected file makes Uploads return an error wrapping ErrUploadRejected.
+func (r *IncomingRequest) Uploads(opts UploadOptions) (*UploadForm, error) {
+	if m := r.req.Method; m != MethodPost && m != MethodPatch && m != MethodPut {
+		return nil, fmt.Errorf("got request method %s, want POST/PATCH/PUT", m)
+	}
+	if ct := r.req.Header.Get("Content-Type"); !strings.HasPrefix(ct, "multipart/form-data") {
+		return nil, fmt.Errorf("invalid method called for Content-Type: %s", ct)
+	}
+	if opts.MaxMemory == 0 {
+		opts.MaxMemory = defaultUploadMaxMemory
+	}
+	if opts.MaxFileSize == 0 {
+		opts.MaxFileSize = defaultUploadMaxFileSize
+	}
+	if opts.MaxFiles == 0 {
+		opts.MaxFiles = defaultUploadMaxFiles
+	}
+	if opts.ScanTimeout == 0 {
+		opts.ScanTimeout = defaultUploadScanTimeout
+	}
+
+	// Bound the resources used before the limits of the individual files can
+	// be checked. The extra MiB leaves room for the form values and the
+	// multipart framing.
+	maxBytes := int64(opts.MaxFiles)*opts.MaxFileSize + 1<<20
+	_, params, err := mime.ParseMediaType(r.req.Header.Get("Content-Type"))
+	if err != nil || params["boundary"] == "" {
+		return nil, errors.New("missing multipart boundary")
+	}
+	mr := multipart.NewReader(&limitedReader{r: r.req.Body, n: maxBytes}, params["boundary"])
+	mf, err := mr.ReadForm(opts.MaxMemory)
+	if err != nil {
+		if errors.Is(err, errBodyLimit) {
+			return nil, fmt.Errorf("%w: more than %d bytes", ErrBodyTooLarge, maxBytes)
+		}
+		return nil, err
+	}
+
+	form, err := newUploadForm(mf, opts)
+	if err != nil {
+		mf.RemoveAll()
+		return nil, err
+	}
+	if opts.Scanner != nil {
+		if err := form.scan(r.Context(), opts); err != nil {
+			mf.RemoveAll()
+			return nil, err
+		}
+	}
+	return form, nil
+}
+
+func newUploadForm(mf *multipart.Form, opts UploadOptions) (*UploadForm, error) {
+	keys := make([]string, 0, len(mf.File))
+	for k := range mf.File {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	files := map[string][]*UploadedFile{}
+	n := 0
+	for _, k := range keys {
+		for _, fh := range mf.File[k] {
+			n++
+			if n > opts.MaxFiles {
+				return nil, fmt.Errorf("%w: more than %d files", ErrBodyTooLarge, opts.MaxFiles)
+			}
+			if fh.Size > opts.MaxFileSize {
+				return nil, fmt.Errorf("%w: file %q larger than %d bytes", ErrBodyTooLarge, k, opts.MaxFileSize)
+			}
+			ct, err := sniffContentType(fh)
+			if err != nil {
+				return nil, err
+			}
+			files[k] = append(files[k], &UploadedFile{
+				Filename:            sanitizeFilename(fh.Filename),
+				Size:                fh.Size,
+				ContentType:         ct,
+				DeclaredContentType: fh.Header.Get("Content-Type"),
+				fh:                  fh,
+			})
+		}
+	}
+	return &UploadForm{Form: Form{values: mf.Value}, files: files, mf: mf}, nil
+}
+
+func sniffContentType(fh *multipart.FileHeader) (string, error) {
+	f, err := fh.Open()
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	buf := make([]byte, 512)
+	n, err := io.ReadFull(f, buf)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", err
+	}
+	return http.DetectContentType(buf[:n]), nil
+}
+
+// sanitizeFilename removes any directory, with either path separator, and
+// control characters from a file name.
+func sanitizeFilename(name string) string {
+	if i := strings.LastIndexAny(name, `/\`); i >= 0 {
+		name = name[i+1:]
+	}
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, name)
+	if name == "." || name == ".." {
+		return ""
+	}
+	return name
+}
+
+var errBodyLimit = errors.New("body limit reached")
+
+// limitedReader is like io.LimitedReader, but fails instead of returning
+// io.EOF when the limit is reached, so truncated bodies are not mistaken for
+// complete ones.
+type limitedReader struct {
+	r io.Reader
+	n int64
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.n <= 0 {
+		if n, _ := l.r.Read([]byte{0}); n == 0 {
+			return 0, io.EOF
+		}
+		return 0, errBodyLimit
+	}
+	if int64(len(p)) > l.n {
+		p = p[:l.n]
+	}
+	n, err := l.r.Read(p)
+	l.n -= int64(n)
+	return n, err
+}
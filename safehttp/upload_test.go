@@ -0,0 +1,225 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package safehttp_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/textproto"
+	"strings"
+	"testing"
+
+	"github.com/google/go-safeweb/safehttp"
+	"github.com/google/go-safeweb/safehttp/safehttptest"
+)
+
+type uploadPart struct {
+	field, filename, contentType, content string
+}
+
+func newUploadRequest(t *testing.T, parts ...uploadPart) *safehttp.IncomingRequest {
+	t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for _, p := range parts {
+		if p.filename == "" {
+			mw.WriteField(p.field, p.content)
+			continue
+		}
+		h := textproto.MIMEHeader{}
+		h.Set("Content-Disposition", `form-data; name="`+p.field+`"; filename="`+p.filename+`"`)
+		h.Set("Content-Type", p.contentType)
+		w, err := mw.CreatePart(h)
+		if err != nil {
+			t.Fatalf("mw.CreatePart() got err: %v", err)
+		}
+		w.Write([]byte(p.content))
+	}
+	mw.Close()
+	r := safehttptest.NewRequest(safehttp.MethodPost, "/", &body)
+	r.Header.Set("Content-Type", mw.FormDataContentType())
+	return r
+}
+
+func TestUploads(t *testing.T) {
+	r := newUploadRequest(t,
+		uploadPart{field: "title", content: "holidays"},
+		uploadPart{field: "photo", filename: `C:\Users\me\..\beach.png`, contentType: "text/html", content: "\x89PNG\r\n\x1a\nrest"},
+		uploadPart{field: "photo", filename: "../notes\t.txt", contentType: "text/plain", content: "hello"},
+	)
+	f, err := r.Uploads(safehttp.UploadOptions{})
+	if err != nil {
+		t.Fatalf("r.Uploads() got err: %v", err)
+	}
+	defer f.RemoveFiles()
+
+	if got, want := f.String("title", ""), "holidays"; got != want {
+		t.Errorf(`f.String("title"): got %q, want %q`, got, want)
+	}
+	files := f.Files("photo")
+	if len(files) != 2 {
+		t.Fatalf(`f.Files("photo"): got %d files, want 2`, len(files))
+	}
+	tests := []struct {
+		filename, contentType, declared, content string
+	}{
+		{"beach.png", "image/png", "text/html", "\x89PNG\r\n\x1a\nrest"},
+		{"notes.txt", "text/plain; charset=utf-8", "text/plain", "hello"},
+	}
+	for i, tt := range tests {
+		got := files[i]
+		if got.Filename != tt.filename || got.ContentType != tt.contentType || got.DeclaredContentType != tt.declared || got.Size != int64(len(tt.content)) {
+			t.Errorf("file %d: got %+v, want %+v", i, got, tt)
+		}
+		rc, err := got.Open()
+		if err != nil {
+			t.Fatalf("Open() got err: %v", err)
+		}
+		b, _ := ioutil.ReadAll(rc)
+		rc.Close()
+		if string(b) != tt.content {
+			t.Errorf("file %d content: got %q, want %q", i, b, tt.content)
+		}
+	}
+}
+
+func TestUploadsLimits(t *testing.T) {
+	tests := []struct {
+		name  string
+		parts []uploadPart
+		opts  safehttp.UploadOptions
+	}{
+		{
+			name: "Too many files",
+			parts: []uploadPart{
+				{field: "a", filename: "a.txt", content: "a"},
+				{field: "b", filename: "b.txt", content: "b"},
+			},
+			opts: safehttp.UploadOptions{MaxFiles: 1},
+		},
+		{
+			name:  "File too large",
+			parts: []uploadPart{{field: "a", filename: "a.txt", content: strings.Repeat("a", 100)}},
+			opts:  safehttp.UploadOptions{MaxFileSize: 50},
+		},
+		{
+			name:  "Body too large",
+			parts: []uploadPart{{field: "a", filename: "a.txt", content: strings.Repeat("a", 3<<20)}},
+			opts:  safehttp.UploadOptions{MaxFileSize: 1 << 20, MaxFiles: 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newUploadRequest(t, tt.parts...).Uploads(tt.opts)
+			if !errors.Is(err, safehttp.ErrBodyTooLarge) {
+				t.Errorf("r.Uploads() got err: %v, want %v", err, safehttp.ErrBodyTooLarge)
+			}
+		})
+	}
+}
+
+func TestUploadsWrongContentType(t *testing.T) {
+	r := safehttptest.NewRequest(safehttp.MethodPost, "/", strings.NewReader("a=b"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if _, err := r.Uploads(safehttp.UploadOptions{}); err == nil {
+		t.Error("r.Uploads() got nil err, want error")
+	}
+}
+
+type fakeScanner struct {
+	rejected string
+	err      error
+}
+
+func (s fakeScanner) Scan(ctx context.Context, f *safehttp.UploadedFile, content io.Reader) error {
+	b, err := ioutil.ReadAll(content)
+	if err != nil {
+		return err
+	}
+	if s.err != nil {
+		return s.err
+	}
+	if string(b) == s.rejected {
+		return fmt.Errorf("%w: EICAR", safehttp.ErrUploadRejected)
+	}
+	return nil
+}
+
+func TestUploadsScanner(t *testing.T) {
+	parts := []uploadPart{
+		{field: "a", filename: "a.txt", content: "clean"},
+		{field: "b", filename: "b.txt", content: "infected"},
+	}
+	tests := []struct {
+		name    string
+		scanner fakeScanner
+		wantErr error
+		// wantScans are the fields of the scanned files, followed by "!" if
+		// their scan failed.
+		wantScans []string
+	}{
+		{
+			name:      "Clean",
+			scanner:   fakeScanner{rejected: "virus"},
+			wantScans: []string{"a", "b"},
+		},
+		{
+			name:      "Rejected",
+			scanner:   fakeScanner{rejected: "infected"},
+			wantErr:   safehttp.ErrUploadRejected,
+			wantScans: []string{"a", "b!"},
+		},
+		{
+			name:      "Scanner error",
+			scanner:   fakeScanner{err: errors.New("scanner unavailable")},
+			wantErr:   errors.New("scanner unavailable"),
+			wantScans: []string{"a!"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var scans []string
+			opts := safehttp.UploadOptions{
+				Scanner: tt.scanner,
+				OnScan: func(s safehttp.UploadScan) {
+					if s.Err != nil {
+						scans = append(scans, s.Field+"!")
+					} else {
+						scans = append(scans, s.Field)
+					}
+				},
+			}
+			f, err := newUploadRequest(t, parts...).Uploads(opts)
+			switch {
+			case tt.wantErr == nil && err != nil:
+				t.Fatalf("r.Uploads() got err: %v", err)
+			case tt.wantErr == nil:
+				f.RemoveFiles()
+			case err == nil:
+				t.Fatalf("r.Uploads() got nil err, want %v", tt.wantErr)
+			case tt.wantErr == safehttp.ErrUploadRejected && !errors.Is(err, safehttp.ErrUploadRejected):
+				t.Errorf("r.Uploads() got err: %v, want %v", err, safehttp.ErrUploadRejected)
+			}
+			if got, want := strings.Join(scans, ","), strings.Join(tt.wantScans, ","); got != want {
+				t.Errorf("scanned fields: got %q, want %q", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package safehttp
+
+import (
+	"errors"
+	"net/http"
+
+	"golang.org/x/net/websocket"
+)
+
+// WebSocketResponse upgrades the connection to the WebSocket protocol and
+// hands it to Serve.
+//
+// The DefaultDispatcher doesn't validate the upgrade request: use the
+// websocket plugin, which checks the Origin and Fetch Metadata of requests
+// before writing a WebSocketResponse. The interceptors run as for any other
+// response, but the headers they set are not sent with the handshake
+// response, which is written by the WebSocket implementation.
+type WebSocketResponse struct {
+	// Request is the upgrade request.
+	Request *IncomingRequest
+	// Serve uses the upgraded connection. The connection is closed when
+	// Serve returns.
+	Serve func(*websocket.Conn)
+}
+
+func writeWebSocket(rw http.ResponseWriter, resp WebSocketResponse) error {
+	if _, ok := rw.(http.Hijacker); !ok {
+		return errors.New("the connection can't be upgraded to the WebSocket protocol")
+	}
+	s := websocket.Server{
+		// The request was already validated, and the default handshake
+		// rejects clients without an Origin header.
+		Handshake: func(*websocket.Config, *http.Request) error { return nil },
+		Handler:   resp.Serve,
+	}
+	s.ServeHTTP(rw, resp.Request.req)
+	return nil
+}
@@ -0,0 +1,103 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package safehttp
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"strings"
+)
+
+const (
+	defaultXMLMaxBytes = 1 << 20
+	defaultXMLMaxDepth = 64
+)
+
+// XMLOptions configures the decoding of XML request bodies.
+type XMLOptions struct {
+	// MaxBytes is the maximum size of the body. If zero, 1 MiB is used.
+	MaxBytes int64
+	// MaxDepth is the maximum nesting depth of elements. If zero, 64 is used.
+	MaxDepth int
+}
+
+// XMLBody decodes the XML body of a POST, PATCH or PUT request into v, using
+// encoding/xml.Unmarshal. The Content-Type of the request must be
+// application/xml, text/xml or end in +xml.
+//
+// Documents containing a DTD or any other directive are rejected, so entities
+// can't be declared at all and XXE attacks are not possible. Bodies larger
+// than opts.MaxBytes are rejected with an error wrapping ErrBodyTooLarge.
+func (r *IncomingRequest) XMLBody(v interface{}, opts XMLOptions) error {
+	if m := r.req.Method; m != MethodPost && m != MethodPatch && m != MethodPut {
+		return fmt.Errorf("got request method %s, want POST/PATCH/PUT", m)
+	}
+	ct, _, err := mime.ParseMediaType(r.req.Header.Get("Content-Type"))
+	if err != nil || (ct != "application/xml" && ct != "text/xml" && !strings.HasSuffix(ct, "+xml")) {
+		return fmt.Errorf("invalid method called for Content-Type: %s", r.req.Header.Get("Content-Type"))
+	}
+
+	if opts.MaxBytes == 0 {
+		opts.MaxBytes = defaultXMLMaxBytes
+	}
+	if opts.MaxDepth == 0 {
+		opts.MaxDepth = defaultXMLMaxDepth
+	}
+
+	b, err := ioutil.ReadAll(io.LimitReader(r.req.Body, opts.MaxBytes+1))
+	if err != nil {
+		return err
+	}
+	if int64(len(b)) > opts.MaxBytes {
+		return fmt.Errorf("%w: more than %d bytes", ErrBodyTooLarge, opts.MaxBytes)
+	}
+	if err := checkXML(b, opts.MaxDepth); err != nil {
+		return err
+	}
+	return xml.Unmarshal(b, v)
+}
+
+// checkXML verifies that the document has no directives and doesn't nest
+// elements deeper than maxDepth.
+func checkXML(b []byte, maxDepth int) error {
+	d := xml.NewDecoder(bytes.NewReader(b))
+	d.Strict = true
+	depth := 0
+	for {
+		tok, err := d.RawToken()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		switch tok.(type) {
+		case xml.Directive:
+			return errors.New("XML directives, such as DTDs, are not allowed")
+		case xml.StartElement:
+			depth++
+			if depth > maxDepth {
+				return fmt.Errorf("XML elements nested deeper than %d", maxDepth)
+			}
+		case xml.EndElement:
+			depth--
+		}
+	}
+}
@@ -0,0 +1,109 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package safehttp_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/google/go-safeweb/safehttp"
+	"github.com/google/go-safeweb/safehttp/safehttptest"
+)
+
+type xmlItem struct {
+	Name  string `xml:"name"`
+	Price int    `xml:"price"`
+}
+
+func newXMLRequest(body string) *safehttp.IncomingRequest {
+	r := safehttptest.NewRequest(safehttp.MethodPost, "/", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/xml; charset=utf-8")
+	return r
+}
+
+func TestXMLBody(t *testing.T) {
+	r := newXMLRequest(`<?xml version="1.0"?><item><name>pizza</name><price>10</price></item>`)
+	var got xmlItem
+	if err := r.XMLBody(&got, safehttp.XMLOptions{}); err != nil {
+		t.Fatalf("r.XMLBody() got err: %v", err)
+	}
+	if want := (xmlItem{Name: "pizza", Price: 10}); got != want {
+		t.Errorf("r.XMLBody() decoded %+v, want %+v", got, want)
+	}
+}
+
+func TestXMLBodyRejected(t *testing.T) {
+	tests := []struct {
+		name string
+		req  func() *safehttp.IncomingRequest
+		opts safehttp.XMLOptions
+	}{
+		{
+			name: "External entity",
+			req: func() *safehttp.IncomingRequest {
+				return newXMLRequest(`<?xml version="1.0"?>` +
+					`<!DOCTYPE item [<!ENTITY xxe SYSTEM "file:///etc/passwd">]>` +
+					`<item><name>&xxe;</name></item>`)
+			},
+		},
+		{
+			name: "Undeclared entity",
+			req: func() *safehttp.IncomingRequest {
+				return newXMLRequest(`<item><name>&xxe;</name></item>`)
+			},
+		},
+		{
+			name: "Too deep",
+			req: func() *safehttp.IncomingRequest {
+				return newXMLRequest(strings.Repeat("<a>", 3) + strings.Repeat("</a>", 3))
+			},
+			opts: safehttp.XMLOptions{MaxDepth: 2},
+		},
+		{
+			name: "Wrong Content-Type",
+			req: func() *safehttp.IncomingRequest {
+				r := newXMLRequest(`<item></item>`)
+				r.Header.Set("Content-Type", "application/json")
+				return r
+			},
+		},
+		{
+			name: "Wrong method",
+			req: func() *safehttp.IncomingRequest {
+				r := safehttptest.NewRequest(safehttp.MethodGet, "/", strings.NewReader(`<item></item>`))
+				r.Header.Set("Content-Type", "application/xml")
+				return r
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got xmlItem
+			if err := tt.req().XMLBody(&got, tt.opts); err == nil {
+				t.Errorf("XMLBody() decoded %+v, want error", got)
+			}
+		})
+	}
+}
+
+func TestXMLBodyTooLarge(t *testing.T) {
+	r := newXMLRequest(`<item><name>pizza</name></item>`)
+	var got xmlItem
+	err := r.XMLBody(&got, safehttp.XMLOptions{MaxBytes: 10})
+	if !errors.Is(err, safehttp.ErrBodyTooLarge) {
+		t.Errorf("r.XMLBody() got err: %v, want %v", err, safehttp.ErrBodyTooLarge)
+	}
+}
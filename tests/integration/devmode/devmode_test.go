@@ -69,4 +69,18 @@ func TestDevMode(t *testing.T) {
 			}
 		}
 	})
+	t.Run("handlers not writing fail in dev mode", func(t *testing.T) {
+		cfg := safehttp.NewServeMuxConfig(nil)
+		cfg.HandleNotWritten(safehttp.NotWrittenFail, nil)
+		mux := cfg.Mux()
+		mux.Handle("/test", "GET", safehttp.HandlerFunc(func(w safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+			return safehttp.NotWritten()
+		}))
+		defer func() {
+			if r := recover(); r == nil {
+				t.Error("mux.ServeHTTP: expected panic")
+			}
+		}()
+		mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "https://test.host.example/test", nil))
+	})
 }